@@ -0,0 +1,21 @@
+module github.com/nats-io/nats-server/v2/cmd/nats-server-js
+
+go 1.19
+
+require (
+	github.com/nats-io/nats-server/v2 v2.0.0
+	github.com/nats-io/nats.go v1.24.0
+)
+
+require (
+	github.com/klauspost/compress v1.16.0 // indirect
+	github.com/minio/highwayhash v1.0.2 // indirect
+	github.com/nats-io/jwt/v2 v2.3.0 // indirect
+	github.com/nats-io/nkeys v0.3.0 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	golang.org/x/crypto v0.6.0 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+	golang.org/x/time v0.3.0 // indirect
+)
+
+replace github.com/nats-io/nats-server/v2 => ../..
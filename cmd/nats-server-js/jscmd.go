@@ -0,0 +1,556 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command nats-server-js implements the "nats-server js" admin commands. It is a separate
+// module so the server does not depend on the NATS client.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+var jsCmdUsageStr = `
+Usage: nats-server js <command> [options] [args]
+       nats-server-js <command> [options] [args]
+
+Commands:
+    ls                               List streams
+    info <stream>                    Show stream information
+    rm <stream>                      Delete a stream
+    backup <stream> <dir>            Backup a stream to a directory
+    restore <dir>                    Restore a stream from a backup directory
+
+Offline Commands, these only read the store directory:
+    dump <stream>                    Print the messages of a stream as JSON, one per line
+    verify <stream>                  Verify the checksums of all messages of a stream
+
+Options:
+    -s, --server <url>               Server to connect to (default: nats://127.0.0.1:4222)
+        --user <user>                User to connect with
+        --pass <password>            Password to connect with
+        --creds <file>               Credentials file to connect with
+        --domain <domain>            JetStream domain
+    -sd,--store_dir <dir>            Operate offline on the store directory of a stopped server
+                                     (ls, info, rm and the offline commands)
+        --account <account>          Account of the streams when offline (default: $G)
+        --timeout <duration>         Timeout for requests (default: 5s)
+        --first <seq>                First sequence to dump (default: 1)
+        --last <seq>                 Last sequence to dump (default: last message)
+`
+
+// Names of the files in a backup directory.
+const (
+	jsBackupConfigFile = "backup.json"
+	jsBackupDataFile   = "stream.tar.s2"
+)
+
+// These match the layout and defaults of the server's file store.
+const (
+	streamsDir        = "streams"
+	dirPerms          = os.FileMode(0750)
+	filePerms         = os.FileMode(0640)
+	snapshotChunkSize = 128 * 1024
+)
+
+// jsCmd is a "js" subcommand of the server binary.
+type jsCmd struct {
+	out      io.Writer
+	url      string
+	user     string
+	pass     string
+	creds    string
+	domain   string
+	storeDir string
+	account  string
+	timeout  time.Duration
+	first    uint64
+	last     uint64
+	nc       *nats.Conn
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "nats-server js: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// run runs one of the "nats-server js" admin commands, writing its output to out.
+// Commands talk to a running server over its client port, or with a store directory, operate
+// offline on the files of a server that is not running.
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprintln(out, jsCmdUsageStr)
+		return nil
+	}
+	cmd, args := args[0], args[1:]
+
+	jc := &jsCmd{out: out}
+	fs := flag.NewFlagSet("nats-server js "+cmd, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&jc.url, "s", nats.DefaultURL, "")
+	fs.StringVar(&jc.url, "server", nats.DefaultURL, "")
+	fs.StringVar(&jc.user, "user", "", "")
+	fs.StringVar(&jc.pass, "pass", "", "")
+	fs.StringVar(&jc.creds, "creds", "", "")
+	fs.StringVar(&jc.domain, "domain", "", "")
+	fs.StringVar(&jc.storeDir, "sd", "", "")
+	fs.StringVar(&jc.storeDir, "store_dir", "", "")
+	fs.StringVar(&jc.account, "account", server.DEFAULT_GLOBAL_ACCOUNT, "")
+	fs.DurationVar(&jc.timeout, "timeout", 5*time.Second, "")
+	fs.Uint64Var(&jc.first, "first", 0, "")
+	fs.Uint64Var(&jc.last, "last", 0, "")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%v\n%s", err, jsCmdUsageStr)
+	}
+	args = fs.Args()
+
+	nargs := map[string]int{"ls": 0, "info": 1, "rm": 1, "backup": 2, "restore": 1, "dump": 1, "verify": 1}
+	n, ok := nargs[cmd]
+	if !ok {
+		return fmt.Errorf("unknown command %q\n%s", cmd, jsCmdUsageStr)
+	}
+	if len(args) != n {
+		return fmt.Errorf("%q expects %d argument(s)\n%s", cmd, n, jsCmdUsageStr)
+	}
+	if cmd != "ls" && cmd != "restore" && !isValidName(args[0]) {
+		return fmt.Errorf("invalid stream name %q", args[0])
+	}
+
+	if jc.storeDir != "" {
+		switch cmd {
+		case "ls":
+			return jc.offlineList()
+		case "info":
+			return jc.offlineInfo(args[0])
+		case "rm":
+			return jc.offlineRemove(args[0])
+		case "dump":
+			return jc.offlineDump(args[0])
+		case "verify":
+			return jc.offlineVerify(args[0])
+		default:
+			return fmt.Errorf("%q requires a running server", cmd)
+		}
+	}
+	if cmd == "dump" || cmd == "verify" {
+		return fmt.Errorf("%q requires a store directory", cmd)
+	}
+
+	if err := jc.connect(); err != nil {
+		return err
+	}
+	defer jc.nc.Close()
+
+	switch cmd {
+	case "ls":
+		return jc.list()
+	case "info":
+		return jc.info(args[0])
+	case "rm":
+		return jc.remove(args[0])
+	case "backup":
+		return jc.backup(args[0], args[1])
+	default:
+		return jc.restore(args[0])
+	}
+}
+
+func (jc *jsCmd) connect() error {
+	opts := []nats.Option{nats.Name("nats-server js")}
+	if jc.creds != "" {
+		opts = append(opts, nats.UserCredentials(jc.creds))
+	}
+	if jc.user != "" {
+		opts = append(opts, nats.UserInfo(jc.user, jc.pass))
+	}
+	nc, err := nats.Connect(jc.url, opts...)
+	if err != nil {
+		return fmt.Errorf("could not connect to %s: %v", jc.url, err)
+	}
+	jc.nc = nc
+	return nil
+}
+
+// apiSubject returns the subject for the API with our domain.
+func (jc *jsCmd) apiSubject(format string, args ...interface{}) string {
+	subj := fmt.Sprintf(format, args...)
+	if jc.domain != "" {
+		subj = strings.Replace(subj, server.JSApiPrefix, fmt.Sprintf("$JS.%s.API", jc.domain), 1)
+	}
+	return subj
+}
+
+// request sends an API request and decodes the response, returning API errors.
+func (jc *jsCmd) request(subj string, req, resp interface{}) error {
+	var data []byte
+	if req != nil {
+		var err error
+		if data, err = json.Marshal(req); err != nil {
+			return err
+		}
+	}
+	msg, err := jc.nc.Request(subj, data, jc.timeout)
+	if err != nil {
+		return err
+	}
+	var ar server.ApiResponse
+	if err := json.Unmarshal(msg.Data, &ar); err != nil {
+		return err
+	}
+	if ar.Error != nil {
+		return ar.Error
+	}
+	return json.Unmarshal(msg.Data, resp)
+}
+
+func (jc *jsCmd) printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(jc.out, string(b))
+	return err
+}
+
+func (jc *jsCmd) list() error {
+	tw := tabwriter.NewWriter(jc.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTORAGE\tMESSAGES\tBYTES\tLAST MESSAGE")
+	for offset := 0; ; {
+		var resp server.JSApiStreamListResponse
+		req := server.JSApiStreamListRequest{ApiPagedRequest: server.ApiPagedRequest{Offset: offset}}
+		if err := jc.request(jc.apiSubject(server.JSApiStreamList), &req, &resp); err != nil {
+			return err
+		}
+		for _, si := range resp.Streams {
+			var last string
+			if !si.State.LastTime.IsZero() {
+				last = si.State.LastTime.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", si.Config.Name, si.Config.Storage,
+				si.State.Msgs, friendlyBytes(int64(si.State.Bytes)), last)
+		}
+		offset += len(resp.Streams)
+		if len(resp.Streams) == 0 || offset >= resp.Total {
+			break
+		}
+	}
+	return tw.Flush()
+}
+
+func (jc *jsCmd) info(stream string) error {
+	var resp server.JSApiStreamInfoResponse
+	if err := jc.request(jc.apiSubject(server.JSApiStreamInfoT, stream), nil, &resp); err != nil {
+		return err
+	}
+	return jc.printJSON(resp.StreamInfo)
+}
+
+func (jc *jsCmd) remove(stream string) error {
+	var resp server.JSApiStreamDeleteResponse
+	if err := jc.request(jc.apiSubject(server.JSApiStreamDeleteT, stream), nil, &resp); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(jc.out, "Deleted stream %q\n", stream)
+	return err
+}
+
+// backup writes a snapshot of the stream, with its config and state, to the directory.
+func (jc *jsCmd) backup(stream, dir string) error {
+	if err := os.MkdirAll(dir, dirPerms); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, jsBackupDataFile), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, filePerms)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	inbox := nats.NewInbox()
+	sub, err := jc.nc.SubscribeSync(inbox)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	var resp server.JSApiStreamSnapshotResponse
+	req := server.JSApiStreamSnapshotRequest{DeliverSubject: inbox}
+	if err := jc.request(jc.apiSubject(server.JSApiStreamSnapshotT, stream), &req, &resp); err != nil {
+		return err
+	}
+
+	var size int
+	for {
+		msg, err := sub.NextMsg(jc.timeout)
+		if err != nil {
+			return fmt.Errorf("error receiving snapshot: %v", err)
+		}
+		// An empty message marks the end.
+		if len(msg.Data) == 0 {
+			break
+		}
+		if _, err := f.Write(msg.Data); err != nil {
+			return err
+		}
+		size += len(msg.Data)
+		// Acks are used for flow control.
+		if msg.Reply != "" {
+			msg.Respond(nil)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	meta := server.JSApiStreamRestoreRequest{Config: *resp.Config, State: *resp.State}
+	b, err := json.MarshalIndent(&meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, jsBackupConfigFile), b, filePerms); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(jc.out, "Backed up stream %q with %d messages (%s) to %q\n",
+		stream, meta.State.Msgs, friendlyBytes(int64(size)), dir)
+	return err
+}
+
+// restore creates the stream of a backup directory made with backup.
+func (jc *jsCmd) restore(dir string) error {
+	b, err := os.ReadFile(filepath.Join(dir, jsBackupConfigFile))
+	if err != nil {
+		return err
+	}
+	var req server.JSApiStreamRestoreRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return fmt.Errorf("invalid backup config: %v", err)
+	}
+	f, err := os.Open(filepath.Join(dir, jsBackupDataFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var resp server.JSApiStreamRestoreResponse
+	if err := jc.request(jc.apiSubject(server.JSApiStreamRestoreT, req.Config.Name), &req, &resp); err != nil {
+		return err
+	}
+
+	// Each chunk is acked, and errors are reported in the ack.
+	chunk := make([]byte, snapshotChunkSize)
+	for {
+		n, err := f.Read(chunk)
+		if n > 0 {
+			msg, rerr := jc.nc.Request(resp.DeliverSubject, chunk[:n], jc.timeout)
+			if rerr != nil {
+				return fmt.Errorf("error sending restore chunk: %v", rerr)
+			}
+			if len(msg.Data) > 0 {
+				return fmt.Errorf("error restoring stream: %s", msg.Data)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	// An empty message marks the end, the response has the restored stream.
+	var cresp server.JSApiStreamCreateResponse
+	if err := jc.request(resp.DeliverSubject, nil, &cresp); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(jc.out, "Restored stream %q with %d messages\n", cresp.Config.Name, cresp.State.Msgs)
+	return err
+}
+
+// offlineStreamsDir returns the directory with the streams of our account in the store directory.
+func (jc *jsCmd) offlineStreamsDir() (string, error) {
+	dir := filepath.Join(jc.storeDir, server.JetStreamStoreDir, jc.account, streamsDir)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("no streams for account %q in %q", jc.account, jc.storeDir)
+	}
+	return dir, nil
+}
+
+// offlineStreamInfo reads the meta data of a stream in the store directory.
+func (jc *jsCmd) offlineStreamInfo(dir string) (*server.FileStreamInfo, error) {
+	b, err := os.ReadFile(filepath.Join(dir, server.JetStreamMetaFile))
+	if err != nil {
+		return nil, err
+	}
+	var fsi server.FileStreamInfo
+	if err := json.Unmarshal(b, &fsi); err != nil {
+		return nil, errors.New("could not read stream meta data, the store may be encrypted")
+	}
+	return &fsi, nil
+}
+
+// offlineDiskUsage returns the size of the files of the stream in the store directory.
+func offlineDiskUsage(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func (jc *jsCmd) offlineList() error {
+	sdir, err := jc.offlineStreamsDir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(sdir)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(jc.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSUBJECTS\tDISK\tCREATED")
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(sdir, e.Name())
+		fsi, err := jc.offlineStreamInfo(dir)
+		if err != nil {
+			fmt.Fprintf(tw, "%s\t%v\t\t\n", e.Name(), err)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", fsi.Name, strings.Join(fsi.Subjects, ","),
+			friendlyBytes(offlineDiskUsage(dir)), fsi.Created.UTC().Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// offlineStreamReport is the output of the offline info command.
+type offlineStreamReport struct {
+	Config    *server.FileStreamInfo      `json:"config"`
+	Consumers []*server.InspectedConsumer `json:"consumers,omitempty"`
+}
+
+func (jc *jsCmd) offlineInspector(stream string) (*server.StoreInspector, error) {
+	sdir, err := jc.offlineStreamsDir()
+	if err != nil {
+		return nil, err
+	}
+	si, err := server.NewStoreInspector(filepath.Join(sdir, stream))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("stream %q not found", stream)
+	}
+	return si, err
+}
+
+func (jc *jsCmd) offlineInfo(stream string) error {
+	si, err := jc.offlineInspector(stream)
+	if err != nil {
+		return err
+	}
+	consumers, err := si.Consumers()
+	if err != nil {
+		return err
+	}
+	return jc.printJSON(&offlineStreamReport{Config: si.Config(), Consumers: consumers})
+}
+
+func (jc *jsCmd) offlineDump(stream string) error {
+	si, err := jc.offlineInspector(stream)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(jc.out)
+	return si.Dump(jc.first, jc.last, func(im *server.InspectedMsg) error { return enc.Encode(im) })
+}
+
+func (jc *jsCmd) offlineVerify(stream string) error {
+	si, err := jc.offlineInspector(stream)
+	if err != nil {
+		return err
+	}
+	ibs, err := si.Verify()
+	if err != nil {
+		return err
+	}
+	var bad int
+	tw := tabwriter.NewWriter(jc.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "BLOCK	FIRST	LAST	MESSAGES	DELETED	CORRUPT	ERROR")
+	for _, ib := range ibs {
+		if ib.Corrupt > 0 || ib.Error != "" {
+			bad++
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%d\t%s\n", ib.Index, ib.First, ib.Last, ib.Msgs, ib.Deleted, ib.Corrupt, ib.Error)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if bad > 0 {
+		return fmt.Errorf("%d of %d message blocks of stream %q failed verification", bad, len(ibs), stream)
+	}
+	return nil
+}
+
+func (jc *jsCmd) offlineRemove(stream string) error {
+	sdir, err := jc.offlineStreamsDir()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(sdir, stream)
+	// Make sure this is a stream directory before removing it.
+	if _, err := jc.offlineStreamInfo(dir); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("stream %q not found", stream)
+		}
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(jc.out, "Deleted stream %q\n", stream)
+	return err
+}
+
+// friendlyBytes returns a string with the given bytes int64
+// represented as a size, such as 1KB, 10MB, etc...
+func friendlyBytes(bytes int64) string {
+	fbytes := float64(bytes)
+	base := 1024
+	pre := []string{"K", "M", "G", "T", "P", "E"}
+	if fbytes < float64(base) {
+		return fmt.Sprintf("%v B", fbytes)
+	}
+	exp := int(math.Log(fbytes) / math.Log(float64(base)))
+	index := exp - 1
+	return fmt.Sprintf("%.2f %sB", fbytes/math.Pow(float64(base), float64(exp)), pre[index])
+}
+
+func isValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	return !strings.ContainsAny(name, " \t\r\n\f.*>")
+}
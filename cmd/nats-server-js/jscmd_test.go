@@ -0,0 +1,222 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+func runJetStreamServer(t *testing.T) (*server.Server, string) {
+	t.Helper()
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	return test.RunServer(&opts), opts.StoreDir
+}
+
+func runCmd(args ...string) (string, error) {
+	var out bytes.Buffer
+	err := run(args, &out)
+	return out.String(), err
+}
+
+func TestJetStreamCommands(t *testing.T) {
+	s, sd := runJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := js.Publish("foo", []byte("OK")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	out, err := runCmd("ls", "-s", s.ClientURL())
+	if err != nil || !strings.Contains(out, "TEST") || !strings.Contains(out, "100") {
+		t.Fatalf("Unexpected ls output %q: %v", out, err)
+	}
+
+	out, err = runCmd("info", "-s", s.ClientURL(), "TEST")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var si server.StreamInfo
+	if err := json.Unmarshal([]byte(out), &si); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if si.Config.Name != "TEST" || si.State.Msgs != 100 {
+		t.Fatalf("Unexpected stream info: %+v", si)
+	}
+
+	for _, args := range [][]string{
+		{"info", "-s", s.ClientURL(), "NOPE"},
+		{"info", "-s", s.ClientURL()},
+		{"nope"},
+	} {
+		if _, err := runCmd(args...); err == nil {
+			t.Fatalf("Expected an error for %q", args)
+		}
+	}
+
+	// Backup, delete and restore.
+	dir := filepath.Join(t.TempDir(), "backup")
+	if _, err := runCmd("backup", "-s", s.ClientURL(), "TEST", dir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := runCmd("rm", "-s", s.ClientURL(), "TEST"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := js.StreamInfo("TEST"); err != nats.ErrStreamNotFound {
+		t.Fatalf("Expected stream not found, got %v", err)
+	}
+	if _, err := runCmd("restore", "-s", s.ClientURL(), dir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nsi, err := js.StreamInfo("TEST")
+	if err != nil || nsi.State.Msgs != 100 {
+		t.Fatalf("Unexpected restored stream %+v: %v", nsi, err)
+	}
+
+	// Offline on the store directory.
+	nc.Close()
+	s.Shutdown()
+
+	if _, err := runCmd("backup", "-sd", sd, "TEST", dir); err == nil {
+		t.Fatalf("Expected backup to require a running server")
+	}
+	out, err = runCmd("ls", "-sd", sd)
+	if err != nil || !strings.Contains(out, "TEST") || !strings.Contains(out, "foo") {
+		t.Fatalf("Unexpected ls output %q: %v", out, err)
+	}
+	out, err = runCmd("info", "-sd", sd, "TEST")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var report offlineStreamReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Config.Name != "TEST" {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	if _, err := runCmd("rm", "-sd", sd, "TEST"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := runCmd("info", "-sd", sd, "TEST"); err == nil {
+		t.Fatalf("Expected stream to be removed")
+	}
+}
+
+func TestJetStreamOfflineCommands(t *testing.T) {
+	s, sd := runJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo.*"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 1; i <= 20; i++ {
+		if _, err := js.Publish(fmt.Sprintf("foo.%d", i), []byte(fmt.Sprintf("MSG-%d", i))); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := js.DeleteMsg("TEST", 5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nc.Close()
+	s.Shutdown()
+
+	cmd := func(name string, args ...string) (string, error) {
+		return runCmd(append(append([]string{name, "-sd", sd}, args...), "TEST")...)
+	}
+
+	// Dump a range, skipping the deleted message.
+	out, err := cmd("dump", "--first", "4", "--last", "7")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var seqs []uint64
+	dec := json.NewDecoder(strings.NewReader(out))
+	for dec.More() {
+		var im server.InspectedMsg
+		if err := dec.Decode(&im); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(im.Data) != fmt.Sprintf("MSG-%d", im.Sequence) {
+			t.Fatalf("Unexpected message %+v", im)
+		}
+		seqs = append(seqs, im.Sequence)
+	}
+	if fmt.Sprint(seqs) != "[4 6 7]" {
+		t.Fatalf("Unexpected sequences %v", seqs)
+	}
+
+	if _, err := cmd("verify"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Both need a store directory.
+	if err := run([]string{"verify", "TEST"}, io.Discard); err == nil {
+		t.Fatalf("Expected verify to require a store directory")
+	}
+
+	// Corrupt a message and check verify reports it.
+	blk := filepath.Join(sd, server.JetStreamStoreDir, server.DEFAULT_GLOBAL_ACCOUNT, streamsDir, "TEST", "msgs", "1.blk")
+	buf, err := os.ReadFile(blk)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	idx := bytes.Index(buf, []byte("MSG-10"))
+	if idx < 0 {
+		t.Fatalf("Message not found in block")
+	}
+	buf[idx] = 'X'
+	if err := os.WriteFile(blk, buf, filePerms); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, err = cmd("verify")
+	if err == nil || !strings.Contains(out, "CORRUPT") {
+		t.Fatalf("Expected verify to fail, got %q: %v", out, err)
+	}
+}
@@ -16,9 +16,11 @@ package main
 //go:generate go run server/errors_gen.go
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/exec"
 
 	"github.com/nats-io/nats-server/v2/server"
 	"go.uber.org/automaxprocs/maxprocs"
@@ -26,6 +28,7 @@ import (
 
 var usageStr = `
 Usage: nats-server [options]
+       nats-server js <command> [options] [args]
 
 Server Options:
     -a, --addr, --net <host>         Bind to host address (default: 0.0.0.0)
@@ -59,6 +62,10 @@ JetStream Options:
     -js, --jetstream                 Enable JetStream functionality
     -sd, --store_dir <dir>           Set the storage directory
 
+JetStream Admin Commands:
+    js ls|info|rm|backup|restore     Manage streams of a running server, or offline in a store directory
+                                     (see nats-server js --help, requires nats-server-js in the PATH)
+
 Authorization Options:
         --user <user>                User required for connections
         --pass <password>            Password required for connections
@@ -89,6 +96,25 @@ Common Options:
         --help_tls                   TLS help
 `
 
+// runJetStreamCommand runs the nats-server-js tool and exits with its status.
+func runJetStreamCommand(exe string, args []string) {
+	path, err := exec.LookPath("nats-server-js")
+	if err != nil {
+		server.PrintAndDie(fmt.Sprintf("%s js: requires nats-server-js, install it with "+
+			"\"go install github.com/nats-io/nats-server/v2/cmd/nats-server-js@latest\"", exe))
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			os.Exit(ee.ExitCode())
+		}
+		server.PrintAndDie(fmt.Sprintf("%s js: %s", exe, err))
+	}
+	os.Exit(0)
+}
+
 // usage will print out the flag options for the server.
 func usage() {
 	fmt.Printf("%s\n", usageStr)
@@ -98,6 +124,12 @@ func usage() {
 func main() {
 	exe := "nats-server"
 
+	// JetStream admin commands do not run a server, they are a separate
+	// tool so the server does not depend on the NATS client.
+	if len(os.Args) > 1 && os.Args[1] == "js" {
+		runJetStreamCommand(exe, os.Args[2:])
+	}
+
 	// Create a FlagSet and sets the usage
 	fs := flag.NewFlagSet(exe, flag.ExitOnError)
 	fs.Usage = usage
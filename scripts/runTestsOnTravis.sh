@@ -94,4 +94,8 @@ elif [ "$1" = "non_srv_pkg_tests" ]; then
 
     go test -race -v -p=1 $(go list ./... | grep -v "/server") -count=1 -vet=off -timeout=30m -failfast
 
+    # The nats-server-js tool is its own module.
+
+    (cd cmd/nats-server-js && go test -race -v -p=1 ./... -count=1 -vet=off -timeout=30m -failfast)
+
 fi
@@ -78,6 +78,10 @@ type Account struct {
 	exports      exportMap
 	js           *jsAccount
 	jsLimits     map[string]JetStreamAccountLimits
+	jsTemplate   bool   // Set when jsLimits come from the JetStream account template.
+	jsKey        string // At rest encryption key of our JetStream assets, see jsAccountKey.
+	jsTokens     []*JSAPIToken
+	aggregate    *AccountAggregate
 	limits
 	expired      bool
 	incomplete   bool
@@ -304,6 +308,10 @@ func (a *Account) shallowCopy() *Account {
 	}
 	// JetStream
 	na.jsLimits = a.jsLimits
+	na.jsTemplate = a.jsTemplate
+	na.jsKey = a.jsKey
+	na.jsTokens = a.jsTokens
+	na.aggregate = a.aggregate
 	// Server config account limits.
 	na.limits = a.limits
 
@@ -3319,6 +3327,7 @@ func (s *Server) updateAccountClaimsWithRefresh(a *Account, ac *jwt.AccountClaim
 		a.srv = s
 	}
 
+	a.jsTemplate = false
 	if ac.Limits.IsJSEnabled() {
 		toUnlimited := func(value int64) int64 {
 			if value > 0 {
@@ -3355,6 +3364,9 @@ func (s *Server) updateAccountClaimsWithRefresh(a *Account, ac *jwt.AccountClaim
 				}
 			}
 		}
+	} else if limits := s.jsAccountTemplateLimits(a.Name); limits != nil {
+		// Accounts that do not enable JetStream themselves get it from the template.
+		a.jsLimits, a.jsTemplate = limits, true
 	} else if a.jsLimits != nil {
 		// covers failed update followed by disable
 		a.jsLimits = nil
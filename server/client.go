@@ -17,8 +17,10 @@ import (
 	"bytes"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"math/rand"
 	"net"
@@ -2777,6 +2779,33 @@ func (c *client) canSubscribe(subject string, optQueue ...string) bool {
 	return allowed
 }
 
+// qsubHashIndex uses rendezvous hashing to select the queue subscriber for the key.
+// The same key will select the same subscriber for as long as it is a member.
+func qsubHashIndex(key []byte, qsubs []*subscription) int {
+	var (
+		best   uint64
+		sindex int
+		_id    [8]byte
+	)
+	h := fnv.New64a()
+	for i, sub := range qsubs {
+		if sub == nil {
+			continue
+		}
+		h.Reset()
+		h.Write(key)
+		h.Write(sub.sid)
+		if sub.client != nil {
+			binary.LittleEndian.PutUint64(_id[:], sub.client.cid)
+			h.Write(_id[:])
+		}
+		if score := h.Sum64(); score >= best {
+			best, sindex = score, i
+		}
+	}
+	return sindex
+}
+
 func queueMatches(queue string, qsubs [][]*subscription) bool {
 	if len(qsubs) == 0 {
 		return true
@@ -3766,6 +3795,27 @@ func removeHeaderIfPresent(hdr []byte, key string) []byte {
 	return hdr
 }
 
+// Will remove all headers whose key starts with prefix, e.g. JetStream control headers
+// from untrusted sources.
+func removeHeadersWithPrefix(hdr []byte, prefix string) []byte {
+	if len(hdr) == 0 || !bytes.Contains(hdr, []byte(prefix)) {
+		return hdr
+	}
+	lines := bytes.SplitAfter(hdr, []byte(_CRLF_))
+	var bb bytes.Buffer
+	// The first line is the status line, the last is the empty line that ends the header.
+	for i, line := range lines {
+		if i > 0 && bytes.HasPrefix(line, []byte(prefix)) {
+			continue
+		}
+		bb.Write(line)
+	}
+	if bb.Len() <= len(emptyHdrLine) && bytes.HasPrefix(bb.Bytes(), []byte(hdrLine)) {
+		return nil
+	}
+	return bb.Bytes()
+}
+
 // Generate a new header based on optional original header and key value.
 // More used in JetStream layers.
 func genHeader(hdr []byte, key, value string) []byte {
@@ -3974,8 +4024,10 @@ func (c *client) processServiceImport(si *serviceImport, acc *Account, msg []byt
 		} else if c.kind != LEAF || c.pa.hdr < 0 || len(getHeader(ClientInfoHdr, msg[:c.pa.hdr])) == 0 {
 			ci = c.getClientInfo(share)
 			// If we did not share but the imports destination is the system account add in the server and cluster info.
-			if !share && isSysImport {
+			// Together with the connection id this identifies the requestor, e.g. for partition workers bound to it.
+			if !share && isSysImport && ci != nil {
 				c.addServerAndClusterInfo(ci)
+				ci.ID = c.cid
 			}
 		} else if c.kind == LEAF && (si.share || isSysImport) {
 			// We have a leaf header here for ci, augment as above.
@@ -4324,7 +4376,11 @@ func (c *client) processMsgResults(acc *Account, r *SublistResult, msg, deliver,
 		sindex := 0
 		lqs := len(qsubs)
 		if lqs > 1 {
-			sindex = c.in.prand.Int() % lqs
+			if len(c.pa.qkey) > 0 {
+				sindex = qsubHashIndex(c.pa.qkey, qsubs)
+			} else {
+				sindex = c.in.prand.Int() % lqs
+			}
 		}
 
 		// Find a subscription that is able to deliver this message starting at a random index.
@@ -15,10 +15,14 @@ package server
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"reflect"
 	"sort"
@@ -38,19 +42,50 @@ const (
 	JSPullRequestPendingBytes = "Nats-Pending-Bytes"
 )
 
+// Headers sent when a pull request exceeds a request limit of the consumer,
+// the name of the limit, one of max_batch, max_expires or max_bytes, and its value.
+const (
+	JSPullRequestLimit      = "Nats-Request-Limit"
+	JSPullRequestLimitValue = "Nats-Request-Limit-Value"
+)
+
+// Header required on pull requests and acks when a consumer has a bind token.
+const JSConsumerToken = "Nats-Consumer-Token"
+
 type ConsumerInfo struct {
-	Stream         string          `json:"stream_name"`
-	Name           string          `json:"name"`
-	Created        time.Time       `json:"created"`
-	Config         *ConsumerConfig `json:"config,omitempty"`
-	Delivered      SequenceInfo    `json:"delivered"`
-	AckFloor       SequenceInfo    `json:"ack_floor"`
-	NumAckPending  int             `json:"num_ack_pending"`
-	NumRedelivered int             `json:"num_redelivered"`
-	NumWaiting     int             `json:"num_waiting"`
-	NumPending     uint64          `json:"num_pending"`
-	Cluster        *ClusterInfo    `json:"cluster,omitempty"`
-	PushBound      bool            `json:"push_bound,omitempty"`
+	Stream         string            `json:"stream_name"`
+	Name           string            `json:"name"`
+	Created        time.Time         `json:"created"`
+	Config         *ConsumerConfig   `json:"config,omitempty"`
+	Delivered      SequenceInfo      `json:"delivered"`
+	AckFloor       SequenceInfo      `json:"ack_floor"`
+	NumAckPending  int               `json:"num_ack_pending"`
+	NumRedelivered int               `json:"num_redelivered"`
+	NumWaiting     int               `json:"num_waiting"`
+	NumPending     uint64            `json:"num_pending"`
+	Lag            uint64            `json:"lag"`
+	OldestPending  time.Duration     `json:"oldest_pending_age,omitempty"`
+	AckRate        float64           `json:"ack_rate"`
+	Cluster        *ClusterInfo      `json:"cluster,omitempty"`
+	PushBound      bool              `json:"push_bound,omitempty"`
+	PausedUntil    *time.Time        `json:"paused_until,omitempty"`
+	DeliverQueue   *DeliverQueueInfo `json:"deliver_queue,omitempty"`
+	// Time from delivery to ack, only on the leader.
+	AckLatency *ConsumerAckLatency `json:"ack_latency,omitempty"`
+	// How the shared ack floor advanced, only for AckAll consumers on the leader.
+	AckFloorStats *ConsumerAckFloorStats `json:"ack_floor_stats,omitempty"`
+	// Estimated memory used by pending and redelivery state.
+	PendingMemory int64 `json:"pending_memory,omitempty"`
+	// Set when new deliveries are stopped due to the pending memory limits.
+	PendingMemoryExceeded bool `json:"pending_memory_exceeded,omitempty"`
+	// Set when delivery is paused because the client we deliver to is falling behind.
+	Degraded bool `json:"degraded,omitempty"`
+	// Identifies the stream to mirrors and sources, only set for direct consumers.
+	Resume *StreamResumeToken `json:"resume,omitempty"`
+	// Set when a durable pull consumer had no pull requests for longer than the orphans threshold.
+	Orphaned *ConsumerOrphanInfo `json:"orphaned,omitempty"`
+	// Set when a push consumer failed to deliver, only on the leader.
+	DeliveryFailures *ConsumerDeliveryFailures `json:"delivery_failures,omitempty"`
 }
 
 type ConsumerConfig struct {
@@ -67,6 +102,7 @@ type ConsumerConfig struct {
 	BackOff         []time.Duration `json:"backoff,omitempty"`
 	FilterSubject   string          `json:"filter_subject,omitempty"`
 	ReplayPolicy    ReplayPolicy    `json:"replay_policy"`
+	ReplaySpeed     float64         `json:"replay_speed,omitempty"`   // Multiplier for original timing, e.g. 2 is twice as fast
 	RateLimit       uint64          `json:"rate_limit_bps,omitempty"` // Bits per sec
 	SampleFrequency string          `json:"sample_freq,omitempty"`
 	MaxWaiting      int             `json:"max_waiting,omitempty"`
@@ -83,10 +119,19 @@ type ConsumerConfig struct {
 	// Push based consumers.
 	DeliverSubject string `json:"deliver_subject,omitempty"`
 	DeliverGroup   string `json:"deliver_group,omitempty"`
+	// Optional subject token, 1 based, to consistently select the deliver group member.
+	// Messages with the same token go to the same member for as long as it is a member.
+	// Only members connected to the server of the consumer are selected this way, so this
+	// is not supported in clustered mode. Members behind a leafnode or gateway connection
+	// are selected per connection, and that server then picks one of its members.
+	DeliverGroupHashToken int `json:"deliver_group_hash_token,omitempty"`
 
 	// Ephemeral inactivity threshold.
 	InactiveThreshold time.Duration `json:"inactive_threshold,omitempty"`
 
+	// Number of redeliveries of a message that will trigger an advisory.
+	RedeliveryAdvisoryThreshold uint64 `json:"redelivery_advisory_threshold,omitempty"`
+
 	// Generally inherited by parent stream and other markers, now can be configured directly.
 	Replicas int `json:"num_replicas"`
 	// Force memory storage.
@@ -94,6 +139,59 @@ type ConsumerConfig struct {
 
 	// Don't add to general clients.
 	Direct bool `json:"direct,omitempty"`
+
+	// Optional token that must be presented on pull requests and acks.
+	// Only its hash is kept, so it is not returned in consumer info or advisories.
+	BindToken string `json:"bind_token,omitempty"`
+
+	// Optional HTTP(S) endpoint that push deliveries will be POSTed to.
+	Webhook string `json:"webhook_url,omitempty"`
+
+	// Optional outbound queue of our own for push deliveries.
+	DeliverQueue *DeliverQueueConfig `json:"deliver_queue,omitempty"`
+
+	// Optional subjects that get a copy of each push delivery, e.g. for a debugging tap.
+	// Copies are not tracked for acks and never redelivered.
+	DeliverCopies []string `json:"deliver_copies,omitempty"`
+
+	// Optional changes to message payloads at delivery time, e.g. to redact sensitive fields.
+	DeliverTransform *DeliverTransformConfig `json:"deliver_transform,omitempty"`
+
+	// Optional limit on the estimated memory used by pending and redelivery state.
+	// When reached no new messages will be delivered until some are acked.
+	MaxPendingMemory int64 `json:"max_pending_mem,omitempty"`
+
+	// Set on an update of a durable to move it to the message it delivered with this consumer sequence.
+	// Messages from there on are delivered again, or skipped if past the next one it would deliver.
+	OptStartConsumerSeq uint64 `json:"opt_start_consumer_seq,omitempty"`
+
+	// Deliver the origin of messages recorded by the stream in their headers.
+	OriginHeaders bool `json:"origin_headers,omitempty"`
+	// Deliver the stream and consumer sequences, delivery count, pending count and timestamp
+	// of messages in their headers, so pull clients do not need to parse the ack subject.
+	MetadataHeaders bool `json:"metadata_headers,omitempty"`
+
+	// Whether new messages are held back while redelivered ones are pending.
+	RedeliveryOrder RedeliveryOrder `json:"redelivery_order,omitempty"`
+	// Optional window redeliveries are spread over. Each message is redelivered up to this much later
+	// than its ack wait or backoff, so messages that time out together are not redelivered in a burst.
+	RedeliveryJitter time.Duration `json:"redelivery_jitter,omitempty"`
+	// Only deliver a sample of the messages, e.g. for analytics on high volume streams. Either every Nth
+	// message of the stream by sequence, or a percentage of them. Other messages are skipped as if filtered,
+	// so sampling is not allowed on work queue or interest streams where they would never be removed.
+	SampleEvery   uint64  `json:"sample_every,omitempty"`
+	SamplePercent float64 `json:"sample_percent,omitempty"`
+	// Only deliver during these windows of time, delivery is paused outside of them.
+	DeliverySchedule *ConsumerSchedule `json:"delivery_schedule,omitempty"`
+	// What a push consumer does once MaxAckPending is reached, block or drop the oldest pending message.
+	MaxAckPendingPolicy MaxAckPendingPolicy `json:"max_ack_pending_policy,omitempty"`
+
+	// Ordered push consumers are rewound by the server to the last sequence
+	// confirmed by flow control if interest is lost or a gap is suspected.
+	Ordered bool `json:"ordered,omitempty"`
+
+	// Only the client attached with JSApiConsumerAttach may pull from and ack this durable pull consumer.
+	Exclusive bool `json:"exclusive,omitempty"`
 }
 
 // SequenceInfo has both the consumer and the stream sequence and last activity.
@@ -106,6 +204,8 @@ type SequenceInfo struct {
 type CreateConsumerRequest struct {
 	Stream string         `json:"stream_name"`
 	Config ConsumerConfig `json:"config"`
+	// Only bind to an existing consumer. Fails if it does not exist or the config differs from the stored one.
+	Bind bool `json:"bind,omitempty"`
 }
 
 // ConsumerNakOptions is for optional NAK values, e.g. delay.
@@ -113,6 +213,11 @@ type ConsumerNakOptions struct {
 	Delay time.Duration `json:"delay"`
 }
 
+// ConsumerPauseOptions is for PAUSE values.
+type ConsumerPauseOptions struct {
+	Duration time.Duration `json:"duration"`
+}
+
 // DeliverPolicy determines how the consumer should select the first message to deliver.
 type DeliverPolicy int
 
@@ -209,6 +314,8 @@ var (
 	AckNext = []byte("+NXT")
 	// Terminate delivery of the message.
 	AckTerm = []byte("+TERM")
+	// Pause delivery for this consumer, the message will be redelivered when resumed.
+	AckPause = []byte("+PAUSE")
 )
 
 // Calculate accurate replicas for the consumer config with the parent stream config.
@@ -251,18 +358,40 @@ type consumer struct {
 	rlimit            *rate.Limiter
 	reqSub            *subscription
 	ackSub            *subscription
-	ackReplyT         string
+	ackReplyPre       string
+	arb               []byte // Scratch buffer for ack replies.
 	ackSubj           string
 	nextMsgSubj       string
 	maxp              int
+	pmem              int64 // Pending memory as last added to our account's total.
+	pmemx             bool  // Set when over pending memory limits.
+	sapend            int   // Ack pending as last added to our stream's total.
+	degraded          bool  // Set when delivery is paused for a slow client.
+	slowTmr           *time.Timer
+	slowChk           int64 // Unix nanos of our last slow delivery check, accessed atomically.
+	dfails            *ConsumerDeliveryFailures
+	attached          *consumerAttachment
+	orphan            *consumerOrphan
+	accpm             int64 // Account pending memory limit.
 	pblimit           int
 	maxpb             int
 	pbytes            int
 	fcsz              int
 	fcid              string
 	fcSub             *subscription
+	fcsent            time.Time
+	fcsseq            uint64
+	fcdseq            uint64
+	ordSseq           uint64
+	ordDseq           uint64
+	whSub             *subscription
+	whMsgs            *ipQueue[*jsAckMsg]
+	dq                *deliverQueue
+	dghtok            uint8
 	outq              *jsOutQ
+	advq              *jsOutQ
 	pending           map[uint64]*Pending
+	pendq             []uint64 // pending stream sequences in order, only when dropping old messages.
 	ptmr              *time.Timer
 	rdq               []uint64
 	rdqi              map[uint64]struct{}
@@ -284,11 +413,28 @@ type consumer struct {
 	sfreq             int32
 	ackEventT         string
 	nakEventT         string
+	pauseEventT       string
 	deliveryExcEventT string
-	created           time.Time
-	ldt               time.Time
-	lat               time.Time
-	closed            bool
+	// Delivery exceeded advisories waiting to be sent, in order, with the trace context of their message.
+	dexq             []deliveryExceeded
+	dexqSending      bool
+	redeliveryEventT string
+	created          time.Time
+	ldt              time.Time
+	lat              time.Time
+	pauseUntil       time.Time
+	pauseTmr         *time.Timer
+	sched            *consumerSchedule
+	schedTmr         *time.Timer
+	closed           bool
+
+	// For the ack rate and latency.
+	ackCount uint64
+	arCount  uint64
+	arTime   time.Time
+	arRate   float64
+	ackLat   ackLatencyHistogram
+	afStats  ConsumerAckFloorStats
 
 	// Clustered.
 	ca        *consumerAssignment
@@ -331,10 +477,23 @@ const (
 	JsFlowControlMaxPending = 32 * 1024 * 1024
 	// JsDefaultMaxAckPending is set for consumers with explicit ack that do not set the max ack pending.
 	JsDefaultMaxAckPending = 1000
+	// JsOrderedHeartbeatDefault is the default idle heartbeat for ordered consumers.
+	JsOrderedHeartbeatDefault = 5 * time.Second
 )
 
 // Helper function to set consumer config defaults from above.
 func setConsumerConfigDefaults(config *ConsumerConfig, lim *JSLimitOpts, accLim *JetStreamAccountLimits) {
+	// Only keep the hash of a bind token.
+	if t := config.BindToken; t != _EMPTY_ && !strings.HasPrefix(t, bindTokenHashPrefix) {
+		config.BindToken = hashBindToken([]byte(t))
+	}
+	// Ordered consumers always use flow control and heartbeats.
+	if config.Ordered {
+		config.FlowControl = true
+		if config.Heartbeat == 0 {
+			config.Heartbeat = JsOrderedHeartbeatDefault
+		}
+	}
 	// Set to default if not specified.
 	if config.DeliverSubject == _EMPTY_ && config.MaxWaiting == 0 {
 		config.MaxWaiting = JSWaitQueueDefaultMax
@@ -366,6 +525,10 @@ func setConsumerConfigDefaults(config *ConsumerConfig, lim *JSLimitOpts, accLim
 	if config.DeliverSubject == _EMPTY_ && config.MaxRequestBatch == 0 && lim.MaxRequestBatch > 0 {
 		config.MaxRequestBatch = lim.MaxRequestBatch
 	}
+	// same for max request bytes
+	if config.DeliverSubject == _EMPTY_ && config.MaxRequestMaxBytes == 0 && lim.MaxRequestMaxBytes > 0 {
+		config.MaxRequestMaxBytes = lim.MaxRequestMaxBytes
+	}
 }
 
 // Check the consumer config. If we are recovering don't check filter subjects.
@@ -406,6 +569,18 @@ func checkConsumerCfg(
 		return NewJSConsumerDescriptionTooLongError(JSMaxDescriptionLen)
 	}
 
+	if config.Ordered {
+		if config.DeliverSubject == _EMPTY_ || config.DeliverGroup != _EMPTY_ {
+			return NewJSConsumerInvalidOrderedError(errors.New("ordered consumer requires a deliver subject and no deliver group"))
+		}
+		if config.AckPolicy != AckNone {
+			return NewJSConsumerInvalidOrderedError(errors.New("ordered consumer requires ack policy none"))
+		}
+		if isDurableConsumer(config) {
+			return NewJSConsumerInvalidOrderedError(errors.New("ordered consumer can not be durable"))
+		}
+	}
+
 	// For now expect a literal subject if its not empty. Empty means work queue mode (pull mode).
 	if config.DeliverSubject != _EMPTY_ {
 		if !subjectIsLiteral(config.DeliverSubject) {
@@ -452,6 +627,12 @@ func checkConsumerCfg(
 		if srvLim.MaxRequestBatch > 0 && config.MaxRequestBatch > srvLim.MaxRequestBatch {
 			return NewJSConsumerMaxRequestBatchExceededError(srvLim.MaxRequestBatch)
 		}
+		if config.MaxRequestMaxBytes < 0 {
+			return NewJSConsumerMaxRequestMaxBytesNegativeError()
+		}
+		if srvLim.MaxRequestMaxBytes > 0 && config.MaxRequestMaxBytes > srvLim.MaxRequestMaxBytes {
+			return NewJSConsumerMaxRequestMaxBytesExceededError(srvLim.MaxRequestMaxBytes)
+		}
 	}
 	if srvLim.MaxAckPending > 0 && config.MaxAckPending > srvLim.MaxAckPending {
 		return NewJSConsumerMaxPendingAckExcessError(srvLim.MaxAckPending)
@@ -470,9 +651,118 @@ func checkConsumerCfg(
 		}
 	}
 
+	if config.ReplaySpeed < 0 {
+		return NewJSConsumerInvalidReplaySpeedError(errors.New("replay speed can not be negative"))
+	}
+	if config.ReplaySpeed > 0 && config.ReplayPolicy != ReplayOriginal {
+		return NewJSConsumerInvalidReplaySpeedError(errors.New("replay speed requires replay policy original"))
+	}
+
+	if config.Webhook != _EMPTY_ {
+		if err := checkConsumerWebhook(config); err != nil {
+			return NewJSConsumerInvalidWebhookError(err)
+		}
+		// Targets allowed may have changed since, those are refused when posting.
+		if !isRecovering {
+			acc.mu.RLock()
+			s := acc.srv
+			acc.mu.RUnlock()
+			if s != nil {
+				if err := checkWebhookTarget(config.Webhook, s.getOpts().JetStreamWebhooks); err != nil {
+					return NewJSConsumerInvalidWebhookError(err)
+				}
+			}
+		}
+	}
+
+	if config.DeliverGroupHashToken != 0 {
+		if config.DeliverGroup == _EMPTY_ {
+			return NewJSConsumerInvalidDeliverGroupHashError(errors.New("deliver group hash token requires a deliver group"))
+		}
+		if config.DeliverGroupHashToken < 0 || config.DeliverGroupHashToken > math.MaxUint8 {
+			return NewJSConsumerInvalidDeliverGroupHashError(fmt.Errorf("deliver group hash token needs to be between 1 and %d", math.MaxUint8))
+		}
+	}
+
+	if config.DeliverQueue != nil {
+		if err := checkConsumerDeliverQueue(config); err != nil {
+			return NewJSConsumerInvalidDeliverQueueError(err)
+		}
+	}
+
+	if len(config.DeliverCopies) > 0 {
+		if err := checkConsumerDeliverCopies(cfg, config); err != nil {
+			return NewJSConsumerInvalidDeliverCopiesError(err)
+		}
+	}
+
+	if config.DeliverTransform != nil {
+		if err := checkConsumerDeliverTransform(config); err != nil {
+			return NewJSConsumerInvalidDeliverTransformError(err)
+		}
+	}
+
+	if config.MaxPendingMemory != 0 {
+		if err := checkConsumerPendingMemory(config); err != nil {
+			return NewJSConsumerInvalidPendingMemoryError(err)
+		}
+	}
+
+	if config.RedeliveryOrder == RedeliveryStrict && config.AckPolicy == AckNone {
+		return NewJSConsumerInvalidPolicyError(errors.New("strict redelivery order requires acks"))
+	}
+
+	if config.RedeliveryJitter != 0 {
+		if err := checkConsumerRedeliveryJitter(config); err != nil {
+			return NewJSConsumerInvalidPolicyError(err)
+		}
+	}
+
+	if config.SampleEvery > 0 || config.SamplePercent != 0 {
+		if err := checkConsumerSample(config, cfg); err != nil {
+			return NewJSConsumerInvalidPolicyError(err)
+		}
+	}
+
+	if config.DeliverySchedule != nil {
+		if err := checkConsumerSchedule(config); err != nil {
+			return NewJSConsumerInvalidPolicyError(err)
+		}
+	}
+
+	if config.MetadataHeaders {
+		if err := checkConsumerMetadataHeaders(config); err != nil {
+			return NewJSConsumerInvalidPolicyError(err)
+		}
+	}
+
+	if config.MaxAckPendingPolicy == MaxAckPendingDropOld {
+		if err := checkConsumerMaxAckPendingPolicy(config); err != nil {
+			return NewJSConsumerInvalidPolicyError(err)
+		}
+	}
+
+	if config.OptStartConsumerSeq > 0 {
+		if err := checkConsumerStartConsumerSeq(config); err != nil {
+			return NewJSConsumerInvalidStartConsumerSeqError(err)
+		}
+	}
+
+	if config.Exclusive {
+		if err := checkConsumerExclusive(config); err != nil {
+			return NewJSConsumerInvalidExclusiveError(err)
+		}
+	}
+
 	// As best we can make sure the filtered subject is valid.
 	if config.FilterSubject != _EMPTY_ {
-		subjects := copyStrings(cfg.Subjects)
+		subjects := append(copyStrings(cfg.Subjects), cfg.aliasStoredSubjects()...)
+		if cfg.Canary != nil {
+			subjects = append(subjects, cfg.Canary.storedSubjects()...)
+		}
+		if cfg.Aggregate != nil {
+			subjects = append(subjects, cfg.Aggregate.storedSubjects()...)
+		}
 		// explicitly skip validFilteredSubject when recovering
 		hasExt := isRecovering
 		if !isRecovering {
@@ -641,6 +931,12 @@ func (mset *stream) addConsumerWithAssignment(config *ConsumerConfig, oname stri
 		}
 	}
 
+	// A durable can only be moved by consumer sequence once it exists.
+	if config.OptStartConsumerSeq > 0 && ca == nil && !isRecovering {
+		mset.mu.Unlock()
+		return nil, NewJSConsumerInvalidStartConsumerSeqError(errors.New("start consumer sequence requires an existing durable"))
+	}
+
 	// Check for any limits, if the config for the consumer sets a limit we check against that
 	// but if not we use the value from account limits, if account limits is more restrictive
 	// than stream config we prefer the account limits to handle cases where account limits are
@@ -705,6 +1001,7 @@ func (mset *stream) addConsumerWithAssignment(config *ConsumerConfig, oname stri
 		cfg:       *config,
 		dsubj:     config.DeliverSubject,
 		outq:      mset.outq,
+		advq:      mset.outq,
 		active:    true,
 		qch:       make(chan struct{}),
 		uch:       make(chan struct{}, 1),
@@ -712,6 +1009,7 @@ func (mset *stream) addConsumerWithAssignment(config *ConsumerConfig, oname stri
 		sfreq:     int32(sampleFreq),
 		maxdc:     uint64(config.MaxDeliver),
 		maxp:      config.MaxAckPending,
+		accpm:     selectedLimits.MaxPendingMemory,
 		retention: retention,
 		created:   time.Now().UTC(),
 	}
@@ -746,6 +1044,16 @@ func (mset *stream) addConsumerWithAssignment(config *ConsumerConfig, oname stri
 	}
 	// Create ackMsgs queue now that we have a consumer name
 	o.ackMsgs = newIPQueue[*jsAckMsg](s, fmt.Sprintf("[ACC:%s] consumer '%s' on stream '%s' ackMsgs", accName, o.name, mset.cfg.Name))
+	if config.Webhook != _EMPTY_ {
+		o.whMsgs = newIPQueue[*jsAckMsg](s, fmt.Sprintf("[ACC:%s] consumer '%s' on stream '%s' webhook", accName, o.name, mset.cfg.Name))
+	}
+	o.dghtok = uint8(config.DeliverGroupHashToken)
+	o.sched, _ = newConsumerSchedule(config.DeliverySchedule)
+	// With a deliver queue all our outbound messages go through it instead of the stream's.
+	if config.DeliverQueue != nil {
+		o.dq = newDeliverQueue(s, fmt.Sprintf("[ACC:%s] consumer '%s' on stream '%s' deliver queue", accName, o.name, mset.cfg.Name), config.DeliverQueue)
+		o.outq = o.dq.q
+	}
 
 	// Create our request waiting queue.
 	if o.isPullMode() {
@@ -761,7 +1069,9 @@ func (mset *stream) addConsumerWithAssignment(config *ConsumerConfig, oname stri
 	o.stream = mset.cfg.Name
 	o.ackEventT = JSMetricConsumerAckPre + "." + o.stream + "." + o.name
 	o.nakEventT = JSAdvisoryConsumerMsgNakPre + "." + o.stream + "." + o.name
+	o.pauseEventT = JSAdvisoryConsumerPausedPre + "." + o.stream + "." + o.name
 	o.deliveryExcEventT = JSAdvisoryConsumerMaxDeliveryExceedPre + "." + o.stream + "." + o.name
+	o.redeliveryEventT = JSAdvisoryConsumerRedeliveryThresholdPre + "." + o.stream + "." + o.name
 
 	if !isValidName(o.name) {
 		mset.mu.Unlock()
@@ -822,7 +1132,7 @@ func (mset *stream) addConsumerWithAssignment(config *ConsumerConfig, oname stri
 	// that to scanf them back in.
 	mn := mset.cfg.Name
 	pre := fmt.Sprintf(jsAckT, mn, o.name)
-	o.ackReplyT = fmt.Sprintf("%s.%%d.%%d.%%d.%%d.%%d", pre)
+	o.ackReplyPre = pre + tsep
 	o.ackSubj = fmt.Sprintf("%s.*.*.*.*.*", pre)
 	o.nextMsgSubj = fmt.Sprintf(JSApiRequestNextT, mn, o.name)
 
@@ -1017,6 +1327,11 @@ func (o *consumer) setLeader(isLeader bool) {
 		// Restore our saved state. During non-leader status we just update our underlying store.
 		o.readStoredState(lseq)
 
+		// Ordered consumers start from what has been delivered so far.
+		if o.cfg.Ordered {
+			o.ordSseq, o.ordDseq = o.sseq-1, o.dseq-1
+		}
+
 		// Setup initial num pending.
 		o.streamNumPending()
 
@@ -1063,6 +1378,15 @@ func (o *consumer) setLeader(isLeader bool) {
 			}
 		}
 
+		// If we feed a webhook we subscribe to our own deliveries.
+		if o.whMsgs != nil {
+			if o.whSub, err = o.subscribeInternal(o.cfg.DeliverSubject, o.pushWebhook); err != nil {
+				o.mu.Unlock()
+				o.deleteWithoutAdvisory()
+				return
+			}
+		}
+
 		// If push mode, register for notifications on interest.
 		if o.isPushMode() {
 			o.inch = make(chan bool, 8)
@@ -1110,6 +1434,16 @@ func (o *consumer) setLeader(isLeader bool) {
 		// Now start up Go routine to process acks.
 		go o.processInboundAcks(qch)
 
+		// If we feed a webhook start up the Go routine to POST msgs.
+		if o.whMsgs != nil {
+			go o.processWebhooks(qch)
+		}
+
+		// If we have our own deliver queue start up the Go routine to send from it.
+		if o.dq != nil {
+			go o.processDeliverQueue(qch)
+		}
+
 		// If we are R>1 spin up our proposal loop.
 		if node != nil {
 			// Determine if we can send pending requests info to the group.
@@ -1129,12 +1463,20 @@ func (o *consumer) setLeader(isLeader bool) {
 		// Make sure to clear out any re delivery queues
 		stopAndClearTimer(&o.ptmr)
 		o.rdq, o.rdqi = nil, nil
+		// The new leader will check its delivery for slow clients.
+		stopAndClearTimer(&o.slowTmr)
+		o.degraded = false
+		o.dfails = nil
+		// Clients need to attach to the new leader.
+		o.attached = nil
 		o.pending = nil
+		o.releaseStreamAckPending()
 		// ok if they are nil, we protect inside unsubscribe()
 		o.unsubscribe(o.ackSub)
 		o.unsubscribe(o.reqSub)
 		o.unsubscribe(o.fcSub)
-		o.ackSub, o.reqSub, o.fcSub = nil, nil, nil
+		o.unsubscribe(o.whSub)
+		o.ackSub, o.reqSub, o.fcSub, o.whSub = nil, nil, nil, nil
 		if o.infoSub != nil {
 			o.srv.sysUnsubscribe(o.infoSub)
 			o.infoSub = nil
@@ -1191,9 +1533,10 @@ func (o *consumer) unsubscribe(sub *subscription) {
 }
 
 // We need to make sure we protect access to the outq.
-// Do all advisory sends here.
+// Do all advisory sends here. These always go through the stream's
+// queue, since a deliver queue stops with the consumer.
 func (o *consumer) sendAdvisory(subj string, msg []byte) {
-	o.outq.sendMsg(subj, msg)
+	o.advq.sendMsg(subj, msg)
 }
 
 func (o *consumer) sendDeleteAdvisoryLocked() {
@@ -1218,8 +1561,60 @@ func (o *consumer) sendDeleteAdvisoryLocked() {
 	o.sendAdvisory(subj, j)
 }
 
+// Lock should be held.
+func (o *consumer) sendActivityAdvisoryLocked() {
+	e := JSConsumerActivityAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSConsumerActivityAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:   o.stream,
+		Consumer: o.name,
+		Active:   o.active,
+		Domain:   o.srv.getOpts().JetStreamDomain,
+	}
+
+	j, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	pre := JSAdvisoryConsumerInactivePre
+	if o.active {
+		pre = JSAdvisoryConsumerActivePre
+	}
+	o.sendAdvisory(pre+"."+o.stream+"."+o.name, j)
+}
+
+// Lock should be held.
+func (o *consumer) sendInactiveDeletedAdvisoryLocked() {
+	e := JSConsumerInactiveDeletedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSConsumerInactiveDeletedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:            o.stream,
+		Consumer:          o.name,
+		Durable:           o.isDurable(),
+		InactiveThreshold: o.cfg.InactiveThreshold,
+		Domain:            o.srv.getOpts().JetStreamDomain,
+	}
+
+	j, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	subj := JSAdvisoryConsumerInactiveDeletedPre + "." + o.stream + "." + o.name
+	o.sendAdvisory(subj, j)
+}
+
 func (o *consumer) sendCreateAdvisory() {
 	o.mu.Lock()
+	// Call any registered hook once we have released the lock.
+	defer o.srv.hookConsumerCreated(o.acc.Name, o.stream, o.name)
 	defer o.mu.Unlock()
 
 	e := JSConsumerActionAdvisory{
@@ -1312,14 +1707,26 @@ func (o *consumer) updateDeliveryInterest(localInterest bool) bool {
 	}
 
 	if interest && !o.active {
+		// We may have lost messages, so rewind.
+		if o.cfg.Ordered {
+			o.resetOrdered()
+		}
 		o.signalNewMessages()
 	}
+	wasActive := o.active
 	// Update active status, if not active clear any queue group we captured.
 	if o.active = interest; !o.active {
 		o.qgroup = _EMPTY_
 	} else {
 		o.checkQueueInterest()
 	}
+	// Only send once we are up and running as leader, not for our initial state.
+	if wasActive != o.active && o.ackSub != nil {
+		o.sendActivityAdvisoryLocked()
+		if !o.active {
+			o.recordDeliveryFailure(deliveryFailedNoInterest)
+		}
+	}
 
 	// If the delete timer has already been set do not clear here and return.
 	// Note that durable can now have an inactive threshold, so don't check
@@ -1378,9 +1785,25 @@ func (o *consumer) deleteNotActive() {
 		}
 	}
 
+	if !o.cfg.Direct {
+		o.sendInactiveDeletedAdvisoryLocked()
+	}
+	o.mu.Unlock()
+
+	o.deleteSelf()
+}
+
+// deleteSelf will delete the consumer when we decided to do so ourselves. If we are clustered
+// the removal of our assignment is proposed to the metacontroller leader as well.
+func (o *consumer) deleteSelf() {
+	o.mu.RLock()
+	if o.mset == nil {
+		o.mu.RUnlock()
+		return
+	}
 	s, js := o.mset.srv, o.mset.srv.js
 	acc, stream, name, isDirect := o.acc.Name, o.stream, o.name, o.cfg.Direct
-	o.mu.Unlock()
+	o.mu.RUnlock()
 
 	// If we are clustered, check if we still have this consumer assigned.
 	// If we do forward a proposal to delete ourselves to the metacontroller leader.
@@ -1547,6 +1970,18 @@ func (acc *Account) checkNewConsumerConfig(cfg, ncfg *ConsumerConfig) error {
 	if cfg.MaxWaiting != ncfg.MaxWaiting {
 		return errors.New("max waiting can not be updated")
 	}
+	if cfg.Webhook != ncfg.Webhook {
+		return errors.New("webhook can not be updated")
+	}
+	if !reflect.DeepEqual(cfg.DeliverQueue, ncfg.DeliverQueue) {
+		return errors.New("deliver queue can not be updated")
+	}
+	if cfg.DeliverGroupHashToken != ncfg.DeliverGroupHashToken {
+		return errors.New("deliver group hash token can not be updated")
+	}
+	if cfg.Ordered != ncfg.Ordered {
+		return errors.New("ordered can not be updated")
+	}
 
 	// Deliver Subject is conditional on if its bound.
 	if cfg.DeliverSubject != ncfg.DeliverSubject {
@@ -1579,6 +2014,16 @@ func (o *consumer) updateConfig(cfg *ConsumerConfig) error {
 		return err
 	}
 
+	// Move to the message delivered with the start consumer sequence if it changed.
+	// If clustered the leader moves and replicates our new state to the followers.
+	var moved bool
+	if cfg.OptStartConsumerSeq > 0 && cfg.OptStartConsumerSeq != o.cfg.OptStartConsumerSeq && o.isLeader() {
+		if err := o.moveToConsumerSeq(cfg.OptStartConsumerSeq); err != nil {
+			return NewJSConsumerInvalidStartConsumerSeqError(err)
+		}
+		moved = true
+	}
+
 	if o.store != nil {
 		// Update local state always.
 		if err := o.store.UpdateConfig(cfg); err != nil {
@@ -1642,13 +2087,33 @@ func (o *consumer) updateConfig(cfg *ConsumerConfig) error {
 		o.mu.Lock()
 	}
 
+	// Delivery schedule
+	if !reflect.DeepEqual(cfg.DeliverySchedule, o.cfg.DeliverySchedule) {
+		o.updateSchedule(cfg.DeliverySchedule)
+	}
+
+	// We may have been holding back new messages.
+	relaxed := o.cfg.RedeliveryOrder == RedeliveryStrict && cfg.RedeliveryOrder != RedeliveryStrict
+
 	// Record new config for others that do not need special handling.
 	// Allowed but considered no-op, [Description, SampleFrequency, MaxWaiting, HeadersOnly]
 	o.cfg = *cfg
+	if !cfg.Exclusive {
+		o.attached = nil
+	}
 
 	// Re-calculate num pending on update.
 	o.streamNumPending()
 
+	if moved {
+		if err := o.resetStoreState(); err != nil {
+			return err
+		}
+		o.signalNewMessages()
+	} else if relaxed {
+		o.signalNewMessages()
+	}
+
 	return nil
 }
 
@@ -1735,13 +2200,18 @@ func (o *consumer) pushAck(_ *subscription, c *client, _ *Account, subject, repl
 func (o *consumer) processAck(subject, reply string, hdr int, rmsg []byte) {
 	defer atomic.AddInt64(&o.awl, -1)
 
-	var msg []byte
+	var msg, hdrs []byte
 	if hdr > 0 {
-		msg = rmsg[hdr:]
+		hdrs, msg = rmsg[:hdr], rmsg[hdr:]
 	} else {
 		msg = rmsg
 	}
 
+	// Silently drop acks that do not carry our bind token, or the fencing token of the attached client.
+	if !o.checkBindToken(hdrs) || !o.checkFence(hdrs) {
+		return
+	}
+
 	sseq, dseq, dc := ackReplyInfo(subject)
 
 	skipAckReply := sseq == 0
@@ -1759,6 +2229,8 @@ func (o *consumer) processAck(subject, reply string, hdr int, rmsg []byte) {
 		o.progressUpdate(sseq)
 	case bytes.Equal(msg, AckTerm):
 		o.processTerm(sseq, dseq, dc)
+	case bytes.HasPrefix(msg, AckPause):
+		o.processPause(sseq, dseq, dc, msg)
 	}
 
 	// Ack the ack if requested.
@@ -1995,6 +2467,9 @@ func (o *consumer) releaseAnyPendingRequests() {
 
 // Process a NAK.
 func (o *consumer) processNak(sseq, dseq, dc uint64, nak []byte) {
+	// Get the trace context first, we do not want to load the message while holding our lock.
+	tc := o.traceContext(o.nakEventT, sseq)
+
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
@@ -2020,6 +2495,7 @@ func (o *consumer) processNak(sseq, dseq, dc uint64, nak []byte) {
 		StreamSeq:   sseq,
 		Deliveries:  dc,
 		Domain:      o.srv.getOpts().JetStreamDomain,
+		TraceParent: tc.traceParent(),
 	}
 
 	j, err := json.Marshal(e)
@@ -2027,7 +2503,7 @@ func (o *consumer) processNak(sseq, dseq, dc uint64, nak []byte) {
 		return
 	}
 
-	o.sendAdvisory(o.nakEventT, j)
+	o.sendTracedAdvisory(o.nakEventT, j, tc)
 
 	// Check to see if we have delays attached.
 	if len(nak) > len(AckNak) {
@@ -2075,8 +2551,79 @@ func (o *consumer) processNak(sseq, dseq, dc uint64, nak []byte) {
 	o.signalNewMessages()
 }
 
+// Process a PAUSE. This will stop delivery for the requested duration
+// and redeliver the message once we resume.
+// Paused state is only kept by the current leader.
+func (o *consumer) processPause(sseq, dseq, dc uint64, pause []byte) {
+	var d time.Duration
+	var err error
+	arg := bytes.TrimSpace(pause[len(AckPause):])
+	if len(arg) > 0 && arg[0] == '{' {
+		var po ConsumerPauseOptions
+		if err = json.Unmarshal(arg, &po); err == nil {
+			d = po.Duration
+		}
+	} else {
+		d, err = time.ParseDuration(string(arg))
+	}
+	if err != nil || d <= 0 {
+		// Treat this as normal NAK.
+		o.srv.Warnf("JetStream consumer '%s > %s > %s' bad PAUSE duration value: %q", o.acc.Name, o.stream, o.name, arg)
+		o.processNak(sseq, dseq, dc, AckNak)
+		return
+	}
+
+	// Queue this message for redelivery after we are paused, it will be sent first once we resume.
+	defer o.processNak(sseq, dseq, dc, AckNak)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.mset == nil {
+		return
+	}
+	o.pauseUntil = time.Now().Add(d)
+	if o.pauseTmr == nil {
+		o.pauseTmr = time.AfterFunc(d, o.signalNewMessages)
+	} else {
+		o.pauseTmr.Reset(d)
+	}
+
+	// Deliver an advisory
+	e := JSConsumerPausedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSConsumerPausedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:      o.stream,
+		Consumer:    o.name,
+		ConsumerSeq: dseq,
+		StreamSeq:   sseq,
+		PausedUntil: o.pauseUntil.UTC(),
+		Domain:      o.srv.getOpts().JetStreamDomain,
+	}
+
+	j, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	o.sendAdvisory(o.pauseEventT, j)
+}
+
+// isPaused returns if delivery has been paused by the client.
+// Lock should be held.
+func (o *consumer) isPaused() bool {
+	return !o.pauseUntil.IsZero() && time.Now().Before(o.pauseUntil)
+}
+
 // Process a TERM
 func (o *consumer) processTerm(sseq, dseq, dc uint64) {
+	// Get the trace context first, the ack may remove the message.
+	subj := JSAdvisoryConsumerMsgTerminatedPre + "." + o.stream + "." + o.name
+	tc := o.traceContext(subj, sseq)
+
 	// Treat like an ack to suppress redelivery.
 	o.processAckMsg(sseq, dseq, dc, false)
 
@@ -2096,6 +2643,7 @@ func (o *consumer) processTerm(sseq, dseq, dc uint64) {
 		StreamSeq:   sseq,
 		Deliveries:  dc,
 		Domain:      o.srv.getOpts().JetStreamDomain,
+		TraceParent: tc.traceParent(),
 	}
 
 	j, err := json.Marshal(e)
@@ -2103,8 +2651,7 @@ func (o *consumer) processTerm(sseq, dseq, dc uint64) {
 		return
 	}
 
-	subj := JSAdvisoryConsumerMsgTerminatedPre + "." + o.stream + "." + o.name
-	o.sendAdvisory(subj, j)
+	o.sendTracedAdvisory(subj, j, tc)
 }
 
 // Introduce a small delay in when timer fires to check pending.
@@ -2257,6 +2804,61 @@ func (o *consumer) info() *ConsumerInfo {
 	return o.infoWithSnap(false)
 }
 
+// How often we sample the ack rate.
+var consumerAckRateInterval = 10 * time.Second
+
+// lag returns how far behind the last message in the stream our deliveries are.
+// Lock should be held.
+func (o *consumer) lag() uint64 {
+	if o.mset == nil || o.mset.store == nil {
+		return 0
+	}
+	var state StreamState
+	o.mset.store.FastState(&state)
+	if dsseq := o.sseq - 1; state.LastSeq > dsseq {
+		return state.LastSeq - dsseq
+	}
+	return 0
+}
+
+// oldestPendingAge returns the age of the oldest message we are waiting on an ack for.
+// Lock should be held.
+func (o *consumer) oldestPendingAge(now time.Time) time.Duration {
+	if len(o.pending) == 0 || o.mset == nil || o.mset.store == nil {
+		return 0
+	}
+	var oldest uint64
+	for seq := range o.pending {
+		if oldest == 0 || seq < oldest {
+			oldest = seq
+		}
+	}
+	var smv StoreMsg
+	sm, err := o.mset.store.LoadMsg(oldest, &smv)
+	if err != nil || sm == nil {
+		return 0
+	}
+	if age := now.Sub(time.Unix(0, sm.ts)); age > 0 {
+		return age
+	}
+	return 0
+}
+
+// sampleAckRate will return the ack rate, taking a new sample
+// if the last one is older than the sampling interval.
+// Lock should be held.
+func (o *consumer) sampleAckRate(now time.Time) float64 {
+	if o.arTime.IsZero() {
+		o.arCount, o.arTime = o.ackCount, now
+		return 0
+	}
+	if elapsed := now.Sub(o.arTime); elapsed >= consumerAckRateInterval {
+		o.arRate = float64(o.ackCount-o.arCount) / elapsed.Seconds()
+		o.arCount, o.arTime = o.ackCount, now
+	}
+	return o.arRate
+}
+
 func (o *consumer) infoWithSnap(snap bool) *ConsumerInfo {
 	return o.infoWithSnapAndReply(snap, _EMPTY_)
 }
@@ -2298,7 +2900,30 @@ func (o *consumer) infoWithSnapAndReply(snap bool, reply string) *ConsumerInfo {
 		NumRedelivered: len(o.rdc),
 		NumPending:     o.checkNumPending(),
 		PushBound:      o.isPushMode() && o.active,
-	}
+		PendingMemory:  o.pendingMemory(),
+	}
+	now := time.Now()
+	info.Lag = o.lag()
+	info.OldestPending = o.oldestPendingAge(now)
+	info.AckRate = o.sampleAckRate(now)
+	info.AckLatency = o.ackLat.info()
+	info.AckFloorStats = o.ackFloorStats()
+	if o.isPaused() {
+		pu := o.pauseUntil.UTC()
+		info.PausedUntil = &pu
+	}
+	// Our schedule may pause us for longer.
+	if su := o.scheduledUntil(); !su.IsZero() && (info.PausedUntil == nil || su.After(*info.PausedUntil)) {
+		su = su.UTC()
+		info.PausedUntil = &su
+	}
+	if o.dq != nil {
+		info.DeliverQueue = o.dq.info()
+	}
+	info.PendingMemoryExceeded = o.pmemx
+	info.Degraded = o.degraded
+	info.Orphaned = o.orphanInfo()
+	info.DeliveryFailures = o.deliveryFailures()
 	// Adjust active based on non-zero etc. Also make UTC here.
 	if !o.ldt.IsZero() {
 		ldt := o.ldt.UTC() // This copies as well.
@@ -2326,6 +2951,11 @@ func (o *consumer) infoWithSnapAndReply(snap bool, reply string) *ConsumerInfo {
 		info.Cluster = js.clusterInfo(rg)
 	}
 
+	// Mirrors and sources use this to detect if we were reset.
+	if cfg.Direct {
+		info.Resume = mset.resumeToken()
+	}
+
 	// If we have a reply subject send the response here.
 	if reply != _EMPTY_ && sysc != nil {
 		sysc.sendInternalMsg(reply, _EMPTY_, nil, info)
@@ -2357,7 +2987,8 @@ func (o *consumer) shouldSample() bool {
 	return rand.Int31n(100) <= o.sfreq
 }
 
-func (o *consumer) sampleAck(sseq, dseq, dc uint64) {
+// Lock should be held, so the trace context of the message is loaded by the caller.
+func (o *consumer) sampleAck(sseq, dseq, dc uint64, tc *jsTraceContext) {
 	if !o.shouldSample() {
 		return
 	}
@@ -2378,6 +3009,7 @@ func (o *consumer) sampleAck(sseq, dseq, dc uint64) {
 		Delay:       unow - o.pending[sseq].Timestamp,
 		Deliveries:  dc,
 		Domain:      o.srv.getOpts().JetStreamDomain,
+		TraceParent: tc.traceParent(),
 	}
 
 	j, err := json.Marshal(e)
@@ -2385,10 +3017,21 @@ func (o *consumer) sampleAck(sseq, dseq, dc uint64) {
 		return
 	}
 
-	o.sendAdvisory(o.ackEventT, j)
+	o.sendTracedAdvisory(o.ackEventT, j, tc)
 }
 
 func (o *consumer) processAckMsg(sseq, dseq, dc uint64, doSample bool) {
+	// Get the trace context for the ack metric first, without holding our lock.
+	var tc *jsTraceContext
+	if doSample {
+		o.mu.RLock()
+		sampling := o.sfreq > 0
+		o.mu.RUnlock()
+		if sampling {
+			tc = o.traceContext(o.ackEventT, sseq)
+		}
+	}
+
 	o.mu.Lock()
 	if o.closed {
 		o.mu.Unlock()
@@ -2398,11 +3041,18 @@ func (o *consumer) processAckMsg(sseq, dseq, dc uint64, doSample bool) {
 	var sagap uint64
 	var needSignal bool
 
+	// With a strict redelivery order we may be holding back new messages for a redelivered one.
+	if o.cfg.RedeliveryOrder == RedeliveryStrict && len(o.rdc) > 0 {
+		needSignal = true
+	}
+
 	switch o.cfg.AckPolicy {
 	case AckExplicit:
 		if p, ok := o.pending[sseq]; ok {
+			o.ackCount++
+			o.recordAckLatency(p, time.Now().UnixNano())
 			if doSample {
-				o.sampleAck(sseq, dseq, dc)
+				o.sampleAck(sseq, dseq, dc, tc)
 			}
 			if o.maxp > 0 && len(o.pending) >= o.maxp {
 				needSignal = true
@@ -2410,6 +3060,7 @@ func (o *consumer) processAckMsg(sseq, dseq, dc uint64, doSample bool) {
 			delete(o.pending, sseq)
 			// Use the original deliver sequence from our pending record.
 			dseq = p.Sequence
+			pendingPool.Put(p)
 		}
 		if len(o.pending) == 0 {
 			o.adflr, o.asflr = o.dseq-1, o.sseq-1
@@ -2428,21 +3079,17 @@ func (o *consumer) processAckMsg(sseq, dseq, dc uint64, doSample bool) {
 		delete(o.rdc, sseq)
 		o.removeFromRedeliverQueue(sseq)
 	case AckAll:
-		// no-op
-		if dseq <= o.adflr || sseq <= o.asflr {
-			o.mu.Unlock()
-			return
-		}
 		if o.maxp > 0 && len(o.pending) >= o.maxp {
 			needSignal = true
 		}
-		sagap = sseq - o.asflr
-		o.adflr, o.asflr = dseq, sseq
-		for seq := sseq; seq > sseq-sagap; seq-- {
-			delete(o.pending, seq)
-			delete(o.rdc, seq)
-			o.removeFromRedeliverQueue(seq)
+		var ok bool
+		if sagap, ok = o.advanceAckAllFloor(sseq, dseq); !ok {
+			// no-op
+			o.mu.Unlock()
+			return
 		}
+		// The delivered floor may be past this one.
+		dseq = o.adflr
 	case AckNone:
 		// FIXME(dlc) - This is error but do we care?
 		o.mu.Unlock()
@@ -2452,6 +3099,18 @@ func (o *consumer) processAckMsg(sseq, dseq, dc uint64, doSample bool) {
 	// Update underlying store.
 	o.updateAcks(dseq, sseq)
 
+	// If we were over our pending memory limits we may be able to deliver again.
+	if o.cfg.MaxPendingMemory > 0 || o.accpm > 0 {
+		o.updatePendingMemory()
+		if o.pmemx {
+			needSignal = true
+		}
+	}
+	// Our stream will signal its consumers once below its ack pending limit.
+	if o.tracksStreamAckPending() {
+		o.updateStreamAckPending()
+	}
+
 	mset := o.mset
 	clustered := o.node != nil
 	o.mu.Unlock()
@@ -2557,37 +3216,74 @@ func (o *consumer) needAck(sseq uint64, subj string) bool {
 	return needAck
 }
 
+// deliverGroupKey returns the key used to select the deliver group member for a message subject.
+// This is immutable so no lock is needed.
+func (o *consumer) deliverGroupKey(subj string) []byte {
+	if o.dghtok == 0 {
+		return nil
+	}
+	return []byte(tokenAt(subj, o.dghtok))
+}
+
 // Helper for the next message requests.
-func nextReqFromMsg(msg []byte) (time.Time, int, int, bool, time.Duration, time.Time, error) {
+func nextReqFromMsg(msg []byte) (time.Time, int, int, bool, time.Duration, time.Time, uint64, error) {
 	req := bytes.TrimSpace(msg)
 
 	switch {
 	case len(req) == 0:
-		return time.Time{}, 1, 0, false, 0, time.Time{}, nil
+		return time.Time{}, 1, 0, false, 0, time.Time{}, 0, nil
 
 	case req[0] == '{':
 		var cr JSApiConsumerGetNextRequest
 		if err := json.Unmarshal(req, &cr); err != nil {
-			return time.Time{}, -1, 0, false, 0, time.Time{}, err
+			return time.Time{}, -1, 0, false, 0, time.Time{}, 0, err
 		}
 		var hbt time.Time
 		if cr.Heartbeat > 0 {
 			if cr.Heartbeat*2 > cr.Expires {
-				return time.Time{}, 1, 0, false, 0, time.Time{}, errors.New("heartbeat value too large")
+				return time.Time{}, 1, 0, false, 0, time.Time{}, 0, errors.New("heartbeat value too large")
 			}
 			hbt = time.Now().Add(cr.Heartbeat)
 		}
 		if cr.Expires == time.Duration(0) {
-			return time.Time{}, cr.Batch, cr.MaxBytes, cr.NoWait, cr.Heartbeat, hbt, nil
+			return time.Time{}, cr.Batch, cr.MaxBytes, cr.NoWait, cr.Heartbeat, hbt, cr.Barrier, nil
 		}
-		return time.Now().Add(cr.Expires), cr.Batch, cr.MaxBytes, cr.NoWait, cr.Heartbeat, hbt, nil
+		return time.Now().Add(cr.Expires), cr.Batch, cr.MaxBytes, cr.NoWait, cr.Heartbeat, hbt, cr.Barrier, nil
 	default:
 		if n, err := strconv.Atoi(string(req)); err == nil {
-			return time.Time{}, n, 0, false, 0, time.Time{}, nil
+			return time.Time{}, n, 0, false, 0, time.Time{}, 0, nil
 		}
 	}
 
-	return time.Time{}, 1, 0, false, 0, time.Time{}, nil
+	return time.Time{}, 1, 0, false, 0, time.Time{}, 0, nil
+}
+
+// barrierReached returns true if the stream has stored the barrier sequence.
+// Lock should be held.
+func (o *consumer) barrierReached(barrier uint64) bool {
+	if barrier == 0 || o.mset == nil || o.mset.store == nil {
+		return true
+	}
+	var state StreamState
+	o.mset.store.FastState(&state)
+	return state.LastSeq >= barrier
+}
+
+// waitingBarrierReached returns true if any waiting request has its barrier stored, so
+// requests waiting for the stream to catch up do not hold up the others.
+// Lock should be held.
+func (o *consumer) waitingBarrierReached() bool {
+	wq := o.waiting
+	if wq.isEmpty() {
+		return false
+	}
+	for i, rp := 0, wq.rp; i < wq.n; i++ {
+		if wr := wq.reqs[rp]; wr != nil && o.barrierReached(wr.barrier) {
+			return true
+		}
+		rp = (rp + 1) % cap(wq.reqs)
+	}
+	return false
 }
 
 // Represents a request that is on the internal waiting queue
@@ -2602,6 +3298,7 @@ type waitingRequest struct {
 	received time.Time
 	hb       time.Duration
 	hbt      time.Time
+	barrier  uint64 // Stream sequence that needs to be stored before we deliver.
 	noWait   bool
 }
 
@@ -2715,6 +3412,17 @@ func (wq *waitQueue) pop() *waitingRequest {
 	return wr
 }
 
+// cycle will move the current head entry to the end of the list.
+func (wq *waitQueue) cycle() {
+	if wq.n <= 1 {
+		return
+	}
+	wr, last := wq.peek(), wq.last
+	wq.removeCurrent()
+	wq.add(wr)
+	wq.last = last
+}
+
 // Removes the current read pointer (head FIFO) entry.
 func (wq *waitQueue) removeCurrent() {
 	if wq.rp < 0 {
@@ -2769,10 +3477,19 @@ func (o *consumer) nextWaiting(sz int) *waitingRequest {
 	if o.waiting == nil || o.waiting.isEmpty() {
 		return nil
 	}
+	var waiting int
 	for wr := o.waiting.peek(); !o.waiting.isEmpty(); wr = o.waiting.peek() {
 		if wr == nil {
 			break
 		}
+		// Skip requests still waiting for the stream to store their barrier.
+		if !o.barrierReached(wr.barrier) {
+			if waiting++; waiting >= o.waiting.len() {
+				break
+			}
+			o.waiting.cycle()
+			continue
+		}
 		// Check if we have max bytes set.
 		if wr.b > 0 {
 			if sz <= wr.b {
@@ -2840,7 +3557,26 @@ func (o *consumer) processNextMsgReq(_ *subscription, c *client, _ *Account, _,
 	if reply == _EMPTY_ {
 		return
 	}
-	_, msg = c.msgParts(msg)
+	hdr, msg := c.msgParts(msg)
+
+	if !o.checkBindToken(hdr) {
+		o.mu.RLock()
+		outq := o.outq
+		o.mu.RUnlock()
+		if outq != nil {
+			outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, []byte("NATS/1.0 403 Invalid Consumer Token\r\n\r\n"), nil, nil, 0))
+		}
+		return
+	}
+	if !o.checkFence(hdr) {
+		o.mu.RLock()
+		outq := o.outq
+		o.mu.RUnlock()
+		if outq != nil {
+			outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, []byte("NATS/1.0 409 Consumer Fenced\r\n\r\n"), nil, nil, 0))
+		}
+		return
+	}
 
 	inlineOk := c.kind != ROUTER && c.kind != GATEWAY && c.kind != LEAF
 	if !inlineOk {
@@ -2870,6 +3606,11 @@ func (o *consumer) processNextMsgRequest(reply string, msg []byte) {
 		hdr := []byte(fmt.Sprintf("NATS/1.0 %d %s\r\n\r\n", status, description))
 		o.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
 	}
+	sendLimitErr := func(description, limit string, value interface{}) {
+		const limitT = "NATS/1.0 409 %s\r\n%s: %s\r\n%s: %v\r\n\r\n"
+		hdr := []byte(fmt.Sprintf(limitT, description, JSPullRequestLimit, limit, JSPullRequestLimitValue, value))
+		o.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+	}
 
 	if o.isPushMode() || o.waiting == nil {
 		sendErr(409, "Consumer is push based")
@@ -2877,7 +3618,7 @@ func (o *consumer) processNextMsgRequest(reply string, msg []byte) {
 	}
 
 	// Check payload here to see if they sent in batch size or a formal request.
-	expires, batchSize, maxBytes, noWait, hb, hbt, err := nextReqFromMsg(msg)
+	expires, batchSize, maxBytes, noWait, hb, hbt, barrier, err := nextReqFromMsg(msg)
 	if err != nil {
 		sendErr(400, fmt.Sprintf("Bad Request - %v", err))
 		return
@@ -2885,19 +3626,23 @@ func (o *consumer) processNextMsgRequest(reply string, msg []byte) {
 
 	// Check for request limits
 	if o.cfg.MaxRequestBatch > 0 && batchSize > o.cfg.MaxRequestBatch {
-		sendErr(409, fmt.Sprintf("Exceeded MaxRequestBatch of %d", o.cfg.MaxRequestBatch))
+		sendLimitErr(fmt.Sprintf("Exceeded MaxRequestBatch of %d", o.cfg.MaxRequestBatch), "max_batch", o.cfg.MaxRequestBatch)
 		return
 	}
 
 	if !expires.IsZero() && o.cfg.MaxRequestExpires > 0 && expires.After(time.Now().Add(o.cfg.MaxRequestExpires)) {
-		sendErr(409, fmt.Sprintf("Exceeded MaxRequestExpires of %v", o.cfg.MaxRequestExpires))
+		sendLimitErr(fmt.Sprintf("Exceeded MaxRequestExpires of %v", o.cfg.MaxRequestExpires), "max_expires", o.cfg.MaxRequestExpires)
 		return
 	}
 
 	if maxBytes > 0 && o.cfg.MaxRequestMaxBytes > 0 && maxBytes > o.cfg.MaxRequestMaxBytes {
-		sendErr(409, fmt.Sprintf("Exceeded MaxRequestMaxBytes of %v", o.cfg.MaxRequestMaxBytes))
+		sendLimitErr(fmt.Sprintf("Exceeded MaxRequestMaxBytes of %v", o.cfg.MaxRequestMaxBytes), "max_bytes", o.cfg.MaxRequestMaxBytes)
 		return
 	}
+	// Requests that do not ask for max bytes get our limit.
+	if maxBytes == 0 && o.cfg.MaxRequestMaxBytes > 0 {
+		maxBytes = o.cfg.MaxRequestMaxBytes
+	}
 
 	// If we have the max number of requests already pending try to expire.
 	if o.waiting.isFull() {
@@ -2910,7 +3655,7 @@ func (o *consumer) processNextMsgRequest(reply string, msg []byte) {
 		msgsPending := o.numPending() + uint64(len(o.rdq))
 		// If no pending at all, decide what to do with request.
 		// If no expires was set then fail.
-		if msgsPending == 0 && expires.IsZero() {
+		if (msgsPending == 0 || !o.barrierReached(barrier)) && expires.IsZero() {
 			o.waiting.last = time.Now()
 			sendErr(404, "No Messages")
 			return
@@ -2933,7 +3678,7 @@ func (o *consumer) processNextMsgRequest(reply string, msg []byte) {
 	// Create a waiting request.
 	wr := wrPool.Get().(*waitingRequest)
 	wr.acc, wr.interest, wr.reply, wr.n, wr.d, wr.noWait, wr.expires, wr.hb, wr.hbt = acc, interest, reply, batchSize, 0, noWait, expires, hb, hbt
-	wr.b = maxBytes
+	wr.b, wr.barrier = maxBytes, barrier
 	wr.received = time.Now()
 
 	if err := o.waiting.add(wr); err != nil {
@@ -2947,6 +3692,30 @@ func (o *consumer) processNextMsgRequest(reply string, msg []byte) {
 	}
 }
 
+// Prefix of the bind token hashes we keep in consumer configs.
+const bindTokenHashPrefix = "sha256:"
+
+// hashBindToken returns the hash of a bind token we keep in consumer configs.
+func hashBindToken(token []byte) string {
+	h := sha256.Sum256(token)
+	return bindTokenHashPrefix + hex.EncodeToString(h[:])
+}
+
+// checkBindToken will check that the headers carry our bind token if we have one.
+func (o *consumer) checkBindToken(hdr []byte) bool {
+	o.mu.RLock()
+	hash := o.cfg.BindToken
+	o.mu.RUnlock()
+	if hash == _EMPTY_ {
+		return true
+	}
+	token := getHeader(JSConsumerToken, hdr)
+	if token == nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashBindToken(token)), []byte(hash)) == 1
+}
+
 func trackDownAccountAndInterest(acc *Account, interest string) (*Account, string) {
 	for strings.HasPrefix(interest, replyPrefix) {
 		oa := acc
@@ -2977,14 +3746,74 @@ func (o *consumer) incDeliveryCount(sseq uint64) uint64 {
 	return o.rdc[sseq] + 1
 }
 
+// A message that exceeded its max deliveries.
+type deliveryExceeded struct {
+	sseq, dc uint64
+}
+
 // send a delivery exceeded advisory.
+// Lock should be held, so if anyone is listening the advisory is queued for a Go routine
+// that can load the trace context of the message without holding our lock.
 func (o *consumer) notifyDeliveryExceeded(sseq, dc uint64) {
+	if !o.hasAdvisoryInterest(o.deliveryExcEventT) {
+		return
+	}
+	o.dexq = append(o.dexq, deliveryExceeded{sseq, dc})
+	if !o.dexqSending {
+		o.dexqSending = true
+		go o.sendDeliveryExceeded()
+	}
+}
+
+// Sends the queued delivery exceeded advisories in order.
+func (o *consumer) sendDeliveryExceeded() {
+	for {
+		o.mu.Lock()
+		if len(o.dexq) == 0 {
+			o.dexq, o.dexqSending = nil, false
+			o.mu.Unlock()
+			return
+		}
+		de := o.dexq[0]
+		o.dexq = o.dexq[1:]
+		o.mu.Unlock()
+
+		o.sendDeliveryExceededAdvisory(de.sseq, de.dc)
+	}
+}
+
+func (o *consumer) sendDeliveryExceededAdvisory(sseq, dc uint64) {
+	tc := o.traceContext(o.deliveryExcEventT, sseq)
 	e := JSConsumerDeliveryExceededAdvisory{
 		TypedEvent: TypedEvent{
 			Type: JSConsumerDeliveryExceededAdvisoryType,
 			ID:   nuid.Next(),
 			Time: time.Now().UTC(),
 		},
+		Stream:      o.stream,
+		Consumer:    o.name,
+		StreamSeq:   sseq,
+		Deliveries:  dc,
+		Domain:      o.srv.getOpts().JetStreamDomain,
+		TraceParent: tc.traceParent(),
+	}
+
+	j, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	o.sendTracedAdvisory(o.deliveryExcEventT, j, tc)
+}
+
+// send a redelivery threshold advisory.
+func (o *consumer) notifyRedeliveryThreshold(sseq, dc uint64) {
+	e := JSConsumerRedeliveryThresholdAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSConsumerRedeliveryThresholdAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
 		Stream:     o.stream,
 		Consumer:   o.name,
 		StreamSeq:  sseq,
@@ -2997,7 +3826,7 @@ func (o *consumer) notifyDeliveryExceeded(sseq, dc uint64) {
 		return
 	}
 
-	o.sendAdvisory(o.deliveryExcEventT, j)
+	o.sendAdvisory(o.redeliveryEventT, j)
 }
 
 // Check to see if the candidate subject matches a filter if its present.
@@ -3042,6 +3871,9 @@ func (o *consumer) getNextMsg() (*jsPubMsg, uint64, error) {
 				delete(o.pending, seq)
 				continue
 			}
+			if t := o.cfg.RedeliveryAdvisoryThreshold; t > 0 && dc-1 == t {
+				o.notifyRedeliveryThreshold(seq, dc)
+			}
 			if seq > 0 {
 				pmsg := getJSPubMsgFromPool()
 				sm, err := o.mset.store.LoadMsg(seq, &pmsg.StoreMsg)
@@ -3055,6 +3887,10 @@ func (o *consumer) getNextMsg() (*jsPubMsg, uint64, error) {
 		// Fallback if all redeliveries are gone.
 		seq, dc = o.sseq, 1
 	}
+	// With a strict order new messages wait until redelivered ones have been resolved.
+	if o.cfg.RedeliveryOrder == RedeliveryStrict && o.hasRedeliveredPending() {
+		return nil, 0, errMaxAckPending
+	}
 	// Don't make it a "else" because it is possible that there were redeliveries
 	// but we exhausted the redelivery count and are back to try deliver the next message.
 	if o.hasSkipListPending() {
@@ -3069,32 +3905,59 @@ func (o *consumer) getNextMsg() (*jsPubMsg, uint64, error) {
 	}
 
 	// Check if we have max pending.
+	var dropOld bool
 	if o.maxp > 0 && len(o.pending) >= o.maxp {
 		// maxp only set when ack policy != AckNone and user set MaxAckPending
-		// Stall if we have hit max pending.
+		// Stall if we have hit max pending, unless we should drop the oldest pending message
+		// once we know there is a new one.
+		if o.cfg.MaxAckPendingPolicy != MaxAckPendingDropOld || !o.isPushMode() {
+			return nil, 0, errMaxAckPending
+		}
+		dropOld = true
+	}
+	// Same if we are using too much memory for our pending state.
+	if (o.cfg.MaxPendingMemory > 0 || o.accpm > 0) && o.pendingMemoryExceeded() {
+		return nil, 0, errMaxAckPending
+	}
+	// Or all consumers of our stream together reached its ack pending limit.
+	if o.tracksStreamAckPending() && o.streamAckPendingExceeded() {
 		return nil, 0, errMaxAckPending
 	}
 
 	store := o.mset.store
-	filter, filterWC := o.cfg.FilterSubject, o.filterWC
+	filter, filterWC, sample := o.cfg.FilterSubject, o.filterWC, o.sample()
 
 	// Grab next message applicable to us.
 	// We will unlock here in case lots of contention, e.g. WQ.
 	o.mu.Unlock()
 	pmsg := getJSPubMsgFromPool()
 	sm, sseq, err := store.LoadNextMsg(filter, filterWC, seq, &pmsg.StoreMsg)
+	// Skip messages that are not part of our sample, those are not counted in num pending.
+	var lskip uint64
+	for sm != nil && !sample.includes(sseq) {
+		lskip = sseq
+		sm, sseq, err = store.LoadNextMsg(filter, filterWC, sseq+1, &pmsg.StoreMsg)
+	}
 	if sm == nil {
 		pmsg.returnToPool()
 		pmsg, dc = nil, 0
 	}
 	o.mu.Lock()
 
+	// Do not look at skipped messages again.
+	if lskip >= o.sseq {
+		o.sseq = lskip + 1
+	}
+
 	if sseq >= o.sseq {
 		o.sseq = sseq + 1
 		if err == ErrStoreEOF {
 			o.updateSkipped()
 		}
 	}
+	if dropOld && sm != nil && len(o.pending) >= o.maxp {
+		o.dropOldestPending()
+	}
 
 	return pmsg, dc, err
 }
@@ -3295,6 +4158,9 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 			delay    time.Duration
 			sz       int
 		)
+		// Check this before we grab our lock since it needs the client locks.
+		slow := o.checkSlowDelivery()
+
 		o.mu.Lock()
 		// consumer is closed when mset is set to nil.
 		if o.mset == nil {
@@ -3305,14 +4171,26 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 		// Clear last error.
 		err = nil
 
+		// If we have been paused by the client or our schedule do not send anything.
+		if o.isPaused() || o.outsideSchedule() {
+			goto waitForMsgs
+		}
+
 		// If we are in push mode and not active or under flowcontrol let's stop sending.
 		if o.isPushMode() {
-			if !o.active || (o.maxpb > 0 && o.pbytes > o.maxpb) {
+			if !o.active || slow || (o.maxpb > 0 && o.pbytes > o.maxpb) {
+				goto waitForMsgs
+			}
+			// If our deliver queue is full and we park, wait for room.
+			if o.dq != nil && o.dq.shouldPark() {
 				goto waitForMsgs
 			}
 		} else if o.waiting.isEmpty() {
 			// If we are in pull mode and no one is waiting already break and wait.
 			goto waitForMsgs
+		} else if !o.waitingBarrierReached() {
+			// All requests need to wait for the stream to catch up.
+			goto waitForMsgs
 		}
 
 		// Grab our next msg.
@@ -3339,10 +4217,18 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 		// Pre-calculate ackReply
 		ackReply = o.ackReply(pmsg.seq, o.dseq, dc, pmsg.ts, o.numPending())
 
+		if !o.cfg.OriginHeaders {
+			stripOriginHeader(pmsg)
+		}
 		// If headers only do not send msg payload.
 		// Add in msg size itself as header.
 		if o.cfg.HeadersOnly {
 			convertToHeadersOnly(pmsg)
+		} else if o.cfg.DeliverTransform != nil {
+			applyDeliverTransform(pmsg, o.cfg.DeliverTransform)
+		}
+		if o.cfg.MetadataHeaders {
+			addMetadataHeaders(pmsg, o.stream, o.name, o.dseq, dc, o.numPending())
 		}
 		// Calculate payload size. This can be calculated on client side.
 		// We do not include transport subject here since not generally known on client.
@@ -3369,7 +4255,11 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 
 		// If we are in a replay scenario and have not caught up check if we need to delay here.
 		if o.replay && lts > 0 {
-			if delay = time.Duration(pmsg.ts - lts); delay > time.Millisecond {
+			delay = time.Duration(pmsg.ts - lts)
+			if o.cfg.ReplaySpeed > 0 {
+				delay = time.Duration(float64(delay) / o.cfg.ReplaySpeed)
+			}
+			if delay > time.Millisecond {
 				o.mu.Unlock()
 				select {
 				case <-qch:
@@ -3454,6 +4344,7 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 				o.mu.RLock()
 				o.sendIdleHeartbeat(odsubj)
 				o.mu.RUnlock()
+				o.checkOrdered(hbd)
 			}
 			// Reset our idle heartbeat timer.
 			hb.Reset(hbd)
@@ -3474,8 +4365,20 @@ func (o *consumer) sendIdleHeartbeat(subj string) {
 	o.outq.send(newJSPubMsg(subj, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
 }
 
+// Lock should be held.
 func (o *consumer) ackReply(sseq, dseq, dc uint64, ts int64, pending uint64) string {
-	return fmt.Sprintf(o.ackReplyT, dc, sseq, dseq, ts, pending)
+	b := append(o.arb[:0], o.ackReplyPre...)
+	b = strconv.AppendUint(b, dc, 10)
+	b = append(b, btsep)
+	b = strconv.AppendUint(b, sseq, 10)
+	b = append(b, btsep)
+	b = strconv.AppendUint(b, dseq, 10)
+	b = append(b, btsep)
+	b = strconv.AppendInt(b, ts, 10)
+	b = append(b, btsep)
+	b = strconv.AppendUint(b, pending, 10)
+	o.arb = b
+	return string(b)
 }
 
 // Used mostly for testing. Sets max pending bytes for flow control setups.
@@ -3544,7 +4447,7 @@ func (o *consumer) streamNumPending() uint64 {
 		isLastPerSubject := o.cfg.DeliverPolicy == DeliverLastPerSubject
 		// Set our num pending and valid sequence floor.
 		npc, npf := o.mset.store.NumPending(o.sseq, o.cfg.FilterSubject, isLastPerSubject)
-		o.npc, o.npf = int64(npc), npf
+		o.npc, o.npf = int64(o.sample().pending(npc)), npf
 	}
 
 	return o.numPending()
@@ -3599,11 +4502,28 @@ func (o *consumer) deliverMsg(dsubj, ackReply string, pmsg *jsPubMsg, dc uint64,
 
 	// Cant touch pmsg after this sending so capture what we need.
 	seq, ts := pmsg.seq, pmsg.ts
-	// Send message.
-	o.outq.send(pmsg)
+	if len(o.cfg.DeliverCopies) > 0 {
+		o.sendCopies(pmsg)
+	}
+	// Send message. A full deliver queue may drop it, which for
+	// acked messages means they will be redelivered after AckWait.
+	if o.dq != nil {
+		o.dq.send(pmsg)
+	} else {
+		o.outq.send(pmsg)
+	}
+	if mset.jsa != nil {
+		atomic.AddUint64(&mset.jsa.delivered, 1)
+	}
 
 	if ap == AckExplicit || ap == AckAll {
 		o.trackPending(seq, dseq)
+		if o.cfg.MaxPendingMemory > 0 || o.accpm > 0 {
+			o.updatePendingMemory()
+		}
+		if o.tracksStreamAckPending() {
+			o.updateStreamAckPending()
+		}
 	} else if ap == AckNone {
 		o.adflr = dseq
 		o.asflr = seq
@@ -3672,9 +4592,51 @@ func (o *consumer) processFlowControl(_ *subscription, c *client, _ *Account, su
 	}
 	o.fcid, o.fcsz = _EMPTY_, 0
 
+	// Everything up to the flow control has been received.
+	if o.cfg.Ordered {
+		o.ordSseq, o.ordDseq = o.fcsseq, o.fcdseq
+	}
+
 	o.signalNewMessages()
 }
 
+// checkOrdered is called on idle heartbeats for ordered consumers.
+// If a flow control request has gone unanswered for two heartbeats we assume
+// the client missed messages and rewind. Otherwise we send a flow control
+// request so the client can confirm what it has received so far.
+func (o *consumer) checkOrdered(hbd time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.cfg.Ordered || o.mset == nil {
+		return
+	}
+	if o.fcid != _EMPTY_ {
+		if time.Since(o.fcsent) > 2*hbd {
+			o.resetOrdered()
+			o.signalNewMessages()
+		}
+	} else if o.adflr > o.ordDseq {
+		o.sendFlowControl()
+	}
+}
+
+// resetOrdered will rewind an ordered consumer to the last sequence
+// confirmed by the client. Clients will see this as a redelivery of
+// consumer sequences they may have already received and should skip those.
+// Lock should be held.
+func (o *consumer) resetOrdered() {
+	if o.dseq == o.ordDseq+1 {
+		return
+	}
+	o.srv.Debugf("JetStream ordered consumer '%s > %s > %s' resetting to stream sequence %d",
+		o.acc.Name, o.stream, o.name, o.ordSseq+1)
+	o.sseq, o.dseq = o.ordSseq+1, o.ordDseq+1
+	o.asflr, o.adflr = o.ordSseq, o.ordDseq
+	o.pbytes, o.fcid, o.fcsz = 0, _EMPTY_, 0
+	o.streamNumPending()
+}
+
 // Lock should be held.
 func (o *consumer) fcReply() string {
 	var sb strings.Builder
@@ -3701,6 +4663,7 @@ func (o *consumer) sendFlowControl() {
 	}
 	subj, rply := o.cfg.DeliverSubject, o.fcReply()
 	o.fcsz, o.fcid = o.pbytes, rply
+	o.fcsent, o.fcsseq, o.fcdseq = time.Now(), o.asflr, o.adflr
 	hdr := []byte("NATS/1.0 100 FlowControl Request\r\n\r\n")
 	o.outq.send(newJSPubMsg(subj, _EMPTY_, rply, hdr, nil, nil, 0))
 }
@@ -3718,10 +4681,25 @@ func (o *consumer) trackPending(sseq, dseq uint64) {
 		p.Timestamp = time.Now().UnixNano()
 		p.Sequence = dseq
 	} else {
-		o.pending[sseq] = &Pending{dseq, time.Now().UnixNano()}
+		p = pendingPool.Get().(*Pending)
+		p.Sequence, p.Timestamp = dseq, time.Now().UnixNano()
+		o.pending[sseq] = p
+		if o.cfg.MaxAckPendingPolicy == MaxAckPendingDropOld {
+			o.trackPendingOrder(sseq)
+		} else {
+			o.pendq = nil
+		}
 	}
 }
 
+// sync.Pool for our pending records.
+// Records can only be recycled once removed from pending and not referenced anywhere else.
+var pendingPool = sync.Pool{
+	New: func() interface{} {
+		return new(Pending)
+	},
+}
+
 // didNotDeliver is called when a delivery for a consumer message failed.
 // Depending on our state, we will process the failure.
 func (o *consumer) didNotDeliver(seq uint64) {
@@ -3749,8 +4727,19 @@ func (o *consumer) didNotDeliver(seq uint64) {
 	}
 	o.mu.Unlock()
 
-	// If we do not have interest update that here.
-	if checkDeliveryInterest && o.hasNoLocalInterest() {
+	if !checkDeliveryInterest {
+		return
+	}
+	// Record why we failed, and if we do not have interest update that here.
+	noInterest := o.hasNoLocalInterest()
+	o.mu.Lock()
+	if noInterest {
+		o.recordDeliveryFailure(deliveryFailedNoInterest)
+	} else {
+		o.recordDeliveryFailure(deliveryFailedNotAccepted)
+	}
+	o.mu.Unlock()
+	if noInterest {
 		o.updateDeliveryInterest(false)
 	}
 }
@@ -3885,6 +4874,7 @@ func (o *consumer) checkPending() {
 				next = nextBackoff
 			}
 		}
+		deadline += o.redeliveryJitter(seq, o.rdc[seq])
 		if elapsed >= deadline {
 			if !o.onRedeliverQueue(seq) {
 				expired = append(expired, seq)
@@ -3924,6 +4914,11 @@ func (o *consumer) checkPending() {
 		o.pending = nil
 	}
 
+	// Pending we dropped no longer counts towards our stream's limit.
+	if o.tracksStreamAckPending() {
+		o.updateStreamAckPending()
+	}
+
 	// Update our state if needed.
 	if shouldUpdateState {
 		if err := o.writeStoreStateUnlocked(); err != nil && o.srv != nil && o.mset != nil && !o.closed {
@@ -4047,9 +5042,14 @@ func (o *consumer) selectStartingSeqNo() {
 			} else if o.cfg.DeliverPolicy == DeliverLast {
 				o.sseq = state.LastSeq
 				// If we are partitioned here this will be properly set when we become leader.
+				// Only the last message is needed, so the store can skip blocks without matching subjects.
 				if o.cfg.FilterSubject != _EMPTY_ {
-					ss := o.mset.store.FilteredState(1, o.cfg.FilterSubject)
-					o.sseq = ss.Last
+					var smv StoreMsg
+					if sm, _ := o.mset.store.LoadLastMsg(o.cfg.FilterSubject, &smv); sm != nil {
+						o.sseq = sm.seq
+					} else {
+						o.sseq = 0
+					}
 				}
 			} else if o.cfg.DeliverPolicy == DeliverLastPerSubject {
 				if mss := o.mset.store.SubjectsState(o.cfg.FilterSubject); len(mss) > 0 {
@@ -4279,6 +5279,9 @@ func (o *consumer) stopWithFlags(dflag, sdflag, doSignal, advisory bool) error {
 		o.qch = nil
 	}
 
+	o.releasePendingMemory()
+	o.releaseStreamAckPending()
+
 	a := o.acc
 	store := o.store
 	mset := o.mset
@@ -4287,9 +5290,11 @@ func (o *consumer) stopWithFlags(dflag, sdflag, doSignal, advisory bool) error {
 	o.unsubscribe(o.ackSub)
 	o.unsubscribe(o.reqSub)
 	o.unsubscribe(o.fcSub)
+	o.unsubscribe(o.whSub)
 	o.ackSub = nil
 	o.reqSub = nil
 	o.fcSub = nil
+	o.whSub = nil
 	if o.infoSub != nil {
 		o.srv.sysUnsubscribe(o.infoSub)
 		o.infoSub = nil
@@ -4301,6 +5306,9 @@ func (o *consumer) stopWithFlags(dflag, sdflag, doSignal, advisory bool) error {
 	stopAndClearTimer(&o.ptmr)
 	stopAndClearTimer(&o.dtmr)
 	stopAndClearTimer(&o.gwdtmr)
+	stopAndClearTimer(&o.pauseTmr)
+	stopAndClearTimer(&o.schedTmr)
+	stopAndClearTimer(&o.slowTmr)
 	delivery := o.cfg.DeliverSubject
 	o.waiting = nil
 	// Break us out of the readLoop.
@@ -4310,6 +5318,12 @@ func (o *consumer) stopWithFlags(dflag, sdflag, doSignal, advisory bool) error {
 	n := o.node
 	qgroup := o.cfg.DeliverGroup
 	o.ackMsgs.unregister()
+	if o.whMsgs != nil {
+		o.whMsgs.unregister()
+	}
+	if o.dq != nil {
+		o.dq.q.unregister()
+	}
 
 	// For cleaning up the node assignment.
 	var ca *consumerAssignment
@@ -4369,7 +5383,7 @@ func (o *consumer) stopWithFlags(dflag, sdflag, doSignal, advisory bool) error {
 
 		// These can be removed.
 		for _, seq := range rmseqs {
-			mset.store.RemoveMsg(seq)
+			mset.removeMsgViaRetention(seq, RetentionInterest, nil)
 		}
 	}
 
@@ -4426,22 +5440,26 @@ func deliveryFormsCycle(cfg *StreamConfig, deliverySubject string) bool {
 
 // Check that the filtered subject is valid given a set of stream subjects.
 func validFilteredSubject(filteredSubject string, subjects []string) bool {
+	return len(filteredSubjectMatches(filteredSubject, subjects)) > 0
+}
+
+// filteredSubjectMatches returns the subjects the filtered subject matches.
+func filteredSubjectMatches(filteredSubject string, subjects []string) []string {
 	if !IsValidSubject(filteredSubject) {
-		return false
+		return nil
 	}
 	hasWC := subjectHasWildcard(filteredSubject)
 
+	var matches []string
 	for _, subject := range subjects {
-		if subjectIsSubsetMatch(filteredSubject, subject) {
-			return true
-		}
 		// If we have a wildcard as the filtered subject check to see if we are
 		// a wider scope but do match a subject.
-		if hasWC && subjectIsSubsetMatch(subject, filteredSubject) {
-			return true
+		if subjectIsSubsetMatch(filteredSubject, subject) ||
+			hasWC && subjectIsSubsetMatch(subject, filteredSubject) {
+			matches = append(matches, subject)
 		}
 	}
-	return false
+	return matches
 }
 
 // switchToEphemeral is called on startup when recovering ephemerals.
@@ -4471,7 +5489,7 @@ func (o *consumer) requestNextMsgSubject() string {
 func (o *consumer) decStreamPending(sseq uint64, subj string) {
 	o.mu.Lock()
 	// Update our cached num pending only if we think deliverMsg has not done so.
-	if sseq >= o.sseq && o.isFilteredMatch(subj) {
+	if sseq >= o.sseq && o.isFilteredMatch(subj) && o.sample().includes(sseq) {
 		o.npc--
 	}
 
@@ -4529,7 +5547,7 @@ func (o *consumer) processStreamSignal(_ *subscription, _ *client, _ *Account, s
 	if o.mset == nil {
 		return
 	}
-	if seq > o.npf {
+	if seq > o.npf && o.sample().includes(seq) {
 		o.npc++
 	}
 	if seq < o.sseq {
@@ -0,0 +1,73 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "time"
+
+// ConsumerAckFloorStats are metrics on how the shared ack floor of an AckAll consumer advanced,
+// since the consumer was loaded on the current leader.
+type ConsumerAckFloorStats struct {
+	// Acks that moved the ack floor.
+	Advances uint64 `json:"advances"`
+	// Messages acked by those, including the ones implicitly acked below the acked one.
+	Acked uint64 `json:"acked"`
+	// Acks at or below the ack floor that were ignored, e.g. late acks from other clients.
+	Stale uint64 `json:"stale"`
+}
+
+// advanceAckAllFloor processes a cumulative ack for an AckAll consumer.
+//
+// An ack for stream sequence sseq acks every pending message up to and including sseq,
+// regardless of which client it was delivered to, so all clients of the consumer share one floor.
+// The stream sequence decides, since with redeliveries delivery sequences are not in stream order.
+// The floor never regresses, acks at or below it and acks for messages not delivered yet are ignored.
+// Returns the number of stream sequences acked and whether the floor advanced.
+// Lock should be held.
+func (o *consumer) advanceAckAllFloor(sseq, dseq uint64) (uint64, bool) {
+	if sseq <= o.asflr || sseq >= o.sseq {
+		o.afStats.Stale++
+		return 0, false
+	}
+	sagap := sseq - o.asflr
+	o.asflr = sseq
+	// A redelivered message has a newer delivery sequence, but may have been acked
+	// after messages delivered later, so only move the delivered floor forward.
+	if dseq > o.adflr {
+		o.adflr = dseq
+	}
+	now := time.Now().UnixNano()
+	for seq := sseq; seq > sseq-sagap; seq-- {
+		if p, ok := o.pending[seq]; ok {
+			o.recordAckLatency(p, now)
+			delete(o.pending, seq)
+			pendingPool.Put(p)
+			o.ackCount++
+			o.afStats.Acked++
+		}
+		delete(o.rdc, seq)
+		o.removeFromRedeliverQueue(seq)
+	}
+	o.afStats.Advances++
+	return sagap, true
+}
+
+// ackFloorStats returns the ack floor metrics, only for AckAll consumers.
+// Lock should be held.
+func (o *consumer) ackFloorStats() *ConsumerAckFloorStats {
+	if o.cfg.AckPolicy != AckAll {
+		return nil
+	}
+	stats := o.afStats
+	return &stats
+}
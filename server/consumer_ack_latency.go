@@ -0,0 +1,95 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"math/bits"
+	"time"
+)
+
+// Bucket i of the ack latency histogram counts latencies up to ackLatencyMin << i,
+// so roughly 1ms up to 70min. The last one also counts everything above.
+const (
+	ackLatencyMin     = time.Millisecond
+	ackLatencyBuckets = 23
+)
+
+// ConsumerAckLatency is the time from delivery to ack of messages acked by the consumer,
+// since the consumer was loaded on the current leader. Percentiles are approximate, they
+// are the upper bound of the histogram bucket they fall in.
+type ConsumerAckLatency struct {
+	Count uint64        `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+}
+
+// ackLatencyHistogram is a fixed size histogram with exponential buckets, so recording is cheap.
+type ackLatencyHistogram struct {
+	count   uint64
+	buckets [ackLatencyBuckets]uint64
+}
+
+// record will add a latency to the histogram.
+func (h *ackLatencyHistogram) record(lat time.Duration) {
+	var i int
+	if lat > ackLatencyMin {
+		// Smallest i with lat <= ackLatencyMin << i.
+		i = bits.Len64(uint64((lat - 1) / ackLatencyMin))
+		if i >= ackLatencyBuckets {
+			i = ackLatencyBuckets - 1
+		}
+	}
+	h.buckets[i]++
+	h.count++
+}
+
+// percentile returns the upper bound of the bucket the percentile falls in.
+func (h *ackLatencyHistogram) percentile(p float64) time.Duration {
+	target := uint64(float64(h.count)*p + 0.5)
+	if target == 0 {
+		target = 1
+	}
+	var n uint64
+	for i, c := range h.buckets {
+		if n += c; n >= target {
+			return ackLatencyMin << i
+		}
+	}
+	return ackLatencyMin << (ackLatencyBuckets - 1)
+}
+
+// info returns the percentiles, nil if nothing was recorded.
+func (h *ackLatencyHistogram) info() *ConsumerAckLatency {
+	if h == nil || h.count == 0 {
+		return nil
+	}
+	return &ConsumerAckLatency{
+		Count: h.count,
+		P50:   h.percentile(0.50),
+		P95:   h.percentile(0.95),
+		P99:   h.percentile(0.99),
+	}
+}
+
+// recordAckLatency will record the time since the pending message was delivered.
+// Lock should be held.
+func (o *consumer) recordAckLatency(p *Pending, now int64) {
+	if p == nil || p.Timestamp == 0 {
+		return
+	}
+	if lat := time.Duration(now - p.Timestamp); lat >= 0 {
+		o.ackLat.record(lat)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"reflect"
+)
+
+// checkConsumerBind is used when a client binds to an existing consumer instead of creating one.
+// The consumer needs to exist and the config, with defaults applied, needs to match the stored one,
+// so a client can not silently create or fork consumer state.
+func checkConsumerBind(cfg, existing *ConsumerConfig) *ApiError {
+	if existing == nil {
+		return NewJSConsumerNotFoundError()
+	}
+	// Legacy durable requests do not carry the name.
+	c := *cfg
+	if c.Name == _EMPTY_ && c.Durable == existing.Durable {
+		c.Name = existing.Name
+	}
+	if !reflect.DeepEqual(&c, existing) {
+		return NewJSConsumerBindConfigMismatchError()
+	}
+	return nil
+}
+
+// checkConsumerBind will check a bind request against our consumers, this is for single server mode.
+// The config will have defaults applied the same way as when the consumer was created.
+func (mset *stream) checkConsumerBind(config *ConsumerConfig) *ApiError {
+	mset.mu.RLock()
+	s, jsa, tierName := mset.srv, mset.jsa, mset.tier
+	mset.mu.RUnlock()
+
+	jsa.usageMu.RLock()
+	selectedLimits, limitsFound := jsa.limits[tierName]
+	jsa.usageMu.RUnlock()
+	if !limitsFound {
+		return NewJSNoLimitsError()
+	}
+	cfg := *config
+	setConsumerConfigDefaults(&cfg, &s.getOpts().JetStreamLimits, &selectedLimits)
+
+	name := cfg.Name
+	if name == _EMPTY_ {
+		name = cfg.Durable
+	}
+	var existing *ConsumerConfig
+	if o := mset.lookupConsumer(name); name != _EMPTY_ && o != nil {
+		ocfg := o.config()
+		existing = &ocfg
+	}
+	return checkConsumerBind(&cfg, existing)
+}
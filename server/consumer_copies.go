@@ -0,0 +1,61 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// checkConsumerDeliverCopies will make sure the subjects a push consumer copies its deliveries to are valid.
+func checkConsumerDeliverCopies(cfg *StreamConfig, config *ConsumerConfig) error {
+	if config.DeliverSubject == _EMPTY_ {
+		return errors.New("consumer deliver copies require a deliver subject")
+	}
+	seen := make(map[string]struct{}, len(config.DeliverCopies))
+	for _, subj := range config.DeliverCopies {
+		if !subjectIsLiteral(subj) || !IsValidSubject(subj) {
+			return fmt.Errorf("consumer deliver copy subject %q is not a valid literal subject", subj)
+		}
+		if subj == config.DeliverSubject {
+			return fmt.Errorf("consumer deliver copy subject %q is the deliver subject", subj)
+		}
+		if _, ok := seen[subj]; ok {
+			return fmt.Errorf("consumer deliver copy subject %q is a duplicate", subj)
+		}
+		if deliveryFormsCycle(cfg, subj) {
+			return fmt.Errorf("consumer deliver copy subject %q forms a cycle", subj)
+		}
+		seen[subj] = struct{}{}
+	}
+	return nil
+}
+
+// sendCopies will send a copy of the delivery to each of our deliver copy subjects.
+// Copies have no reply subject so they can not be acked and are never redelivered,
+// instead they carry the stream name and sequence as headers.
+// Lock should be held.
+func (o *consumer) sendCopies(pmsg *jsPubMsg) {
+	if o.mset == nil || o.mset.outq == nil {
+		return
+	}
+	hdr := genHeader(pmsg.hdr, JSStream, o.stream)
+	hdr = genHeader(hdr, JSSequence, strconv.FormatUint(pmsg.seq, 10))
+	msg := copyBytes(pmsg.msg)
+	// The copies share hdr and msg which are not modified after this.
+	for _, dsubj := range o.cfg.DeliverCopies {
+		o.mset.outq.send(newJSPubMsg(dsubj, pmsg.subj, _EMPTY_, hdr, msg, nil, 0))
+	}
+}
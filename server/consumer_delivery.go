@@ -0,0 +1,249 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// DeliverQueueConfig gives a push consumer its own outbound queue and delivery loop,
+// instead of sharing the one of its stream with all other consumers.
+type DeliverQueueConfig struct {
+	// Limits for the queue, zero means unlimited.
+	MaxMsgs  int `json:"max_msgs,omitempty"`
+	MaxBytes int `json:"max_bytes,omitempty"`
+	// What to do when the queue is full.
+	Policy DeliverQueuePolicy `json:"policy"`
+	// Number of messages sent between flushes, zero flushes once per batch.
+	FlushSize int `json:"flush_size,omitempty"`
+}
+
+// DeliverQueuePolicy determines what happens to deliveries when a deliver queue is full.
+type DeliverQueuePolicy int
+
+const (
+	// DeliverQueuePark will stop delivering new messages until the queue has room again.
+	DeliverQueuePark DeliverQueuePolicy = iota
+	// DeliverQueueDrop will drop the delivery. Acked messages will be redelivered after AckWait.
+	DeliverQueueDrop
+)
+
+func (p DeliverQueuePolicy) String() string {
+	switch p {
+	case DeliverQueuePark:
+		return "park"
+	case DeliverQueueDrop:
+		return "drop"
+	default:
+		return "unknown deliver queue policy"
+	}
+}
+
+func (p DeliverQueuePolicy) MarshalJSON() ([]byte, error) {
+	switch p {
+	case DeliverQueuePark:
+		return json.Marshal("park")
+	case DeliverQueueDrop:
+		return json.Marshal("drop")
+	default:
+		return nil, fmt.Errorf("can not marshal %v", p)
+	}
+}
+
+func (p *DeliverQueuePolicy) UnmarshalJSON(data []byte) error {
+	switch strings.ToLower(string(data)) {
+	case jsonString("park"):
+		*p = DeliverQueuePark
+	case jsonString("drop"):
+		*p = DeliverQueueDrop
+	default:
+		return fmt.Errorf("can not unmarshal %q", data)
+	}
+	return nil
+}
+
+// DeliverQueueInfo has the state and stats of a consumer's deliver queue.
+type DeliverQueueInfo struct {
+	Pending      int    `json:"pending"`
+	PendingBytes int64  `json:"pending_bytes"`
+	Delivered    uint64 `json:"delivered"`
+	Dropped      uint64 `json:"dropped"`
+	Parked       uint64 `json:"parked"`
+}
+
+// deliverQueue is the outbound queue of a consumer with a DeliverQueueConfig.
+type deliverQueue struct {
+	q     *jsOutQ
+	cfg   DeliverQueueConfig
+	bytes int64  // atomic
+	dlvd  uint64 // atomic
+	drops uint64 // atomic
+	parks uint64 // atomic
+	park  int32  // atomic, set when the consumer is waiting for room.
+}
+
+// checkConsumerDeliverQueue will make sure the consumer can use a deliver queue.
+func checkConsumerDeliverQueue(config *ConsumerConfig) error {
+	dq := config.DeliverQueue
+	if config.DeliverSubject == _EMPTY_ {
+		return errors.New("consumer deliver queue requires a deliver subject")
+	}
+	if config.Webhook != _EMPTY_ {
+		return errors.New("consumer deliver queue can not be used with a webhook")
+	}
+	if dq.MaxMsgs < 0 || dq.MaxBytes < 0 || dq.FlushSize < 0 {
+		return errors.New("consumer deliver queue limits can not be negative")
+	}
+	if dq.Policy != DeliverQueuePark && dq.Policy != DeliverQueueDrop {
+		return errors.New("consumer deliver queue policy is invalid")
+	}
+	return nil
+}
+
+func newDeliverQueue(s *Server, name string, cfg *DeliverQueueConfig) *deliverQueue {
+	return &deliverQueue{q: &jsOutQ{newIPQueue[*jsPubMsg](s, name)}, cfg: *cfg}
+}
+
+// isFull returns true if the queue is at either of its limits.
+func (dq *deliverQueue) isFull() bool {
+	if dq.cfg.MaxMsgs > 0 && dq.q.len() >= dq.cfg.MaxMsgs {
+		return true
+	}
+	return dq.cfg.MaxBytes > 0 && atomic.LoadInt64(&dq.bytes) >= int64(dq.cfg.MaxBytes)
+}
+
+// shouldPark returns true if the consumer should wait for room before sending more messages.
+func (dq *deliverQueue) shouldPark() bool {
+	if dq.cfg.Policy != DeliverQueuePark || !dq.isFull() {
+		return false
+	}
+	if atomic.CompareAndSwapInt32(&dq.park, 0, 1) {
+		atomic.AddUint64(&dq.parks, 1)
+	}
+	return true
+}
+
+// send will queue the delivery, or drop it if full and so configured.
+// Returns false if the message was dropped.
+func (dq *deliverQueue) send(pmsg *jsPubMsg) bool {
+	if dq.cfg.Policy == DeliverQueueDrop && dq.isFull() {
+		atomic.AddUint64(&dq.drops, 1)
+		pmsg.returnToPool()
+		return false
+	}
+	atomic.AddInt64(&dq.bytes, int64(pmsg.size()))
+	dq.q.send(pmsg)
+	return true
+}
+
+func (dq *deliverQueue) info() *DeliverQueueInfo {
+	return &DeliverQueueInfo{
+		Pending:      dq.q.len(),
+		PendingBytes: atomic.LoadInt64(&dq.bytes),
+		Delivered:    atomic.LoadUint64(&dq.dlvd),
+		Dropped:      atomic.LoadUint64(&dq.drops),
+		Parked:       atomic.LoadUint64(&dq.parks),
+	}
+}
+
+// Runs in its own Go routine while we are leader and sends everything
+// from our deliver queue with our own internal client.
+func (o *consumer) processDeliverQueue(qch chan struct{}) {
+	o.mu.RLock()
+	s, acc, dq := o.srv, o.acc, o.dq
+	o.mu.RUnlock()
+
+	c := s.createInternalJetStreamClient()
+	c.registerWithAccount(acc)
+	defer c.closeConnection(ClientClosed)
+
+	// Raw scratch buffer.
+	var _r [1024]byte
+
+	for {
+		select {
+		case <-dq.q.ch:
+			pms := dq.q.pop()
+			for i, pm := range pms {
+				sz := pm.size()
+				c.pa.subject = []byte(pm.dsubj)
+				c.pa.deliver = []byte(pm.subj)
+				c.pa.size = len(pm.msg) + len(pm.hdr)
+				c.pa.szb = []byte(strconv.Itoa(c.pa.size))
+				c.pa.reply = []byte(pm.reply)
+				if pm.o != nil {
+					c.pa.qkey = pm.o.deliverGroupKey(pm.subj)
+				}
+
+				var msg []byte
+				if len(pm.buf) > 0 {
+					msg = pm.buf
+				} else if len(pm.hdr) > 0 {
+					msg = pm.hdr
+					if len(pm.msg) > 0 {
+						msg = _r[:0]
+						msg = append(msg, pm.hdr...)
+						msg = append(msg, pm.msg...)
+					}
+				} else if len(pm.msg) > 0 {
+					msg = pm.msg
+				}
+
+				if len(pm.hdr) > 0 {
+					c.pa.hdr = len(pm.hdr)
+					c.pa.hdb = []byte(strconv.Itoa(c.pa.hdr))
+				} else {
+					c.pa.hdr = -1
+					c.pa.hdb = nil
+				}
+
+				msg = append(msg, _CRLF_...)
+
+				didDeliver, _ := c.processInboundClientMsg(msg)
+				c.pa.szb, c.pa.subject, c.pa.deliver, c.pa.qkey = nil, nil, nil, nil
+
+				// Deliveries are the only ones accounted for in our limits.
+				if pm.o != nil && pm.seq > 0 {
+					atomic.AddInt64(&dq.bytes, -int64(sz))
+					if didDeliver {
+						atomic.AddUint64(&dq.dlvd, 1)
+					} else {
+						pm.o.didNotDeliver(pm.seq)
+					}
+				}
+				pm.returnToPool()
+
+				if fs := dq.cfg.FlushSize; fs > 0 && (i+1)%fs == 0 {
+					c.flushClients(0)
+				}
+			}
+			c.flushClients(0)
+			dq.q.recycle(&pms)
+
+			// If we were parked let the consumer know there is room again.
+			if atomic.CompareAndSwapInt32(&dq.park, 1, 0) {
+				o.signalNewMessages()
+			}
+		case <-qch:
+			return
+		case <-s.quitCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// Header required on pull requests and acks of an exclusive consumer, with the fencing token
+// returned to the client that attached to it.
+const JSConsumerFence = "Nats-Consumer-Fence"
+
+// How long the attached client of an exclusive consumer can be idle before another client can
+// attach without taking over. Pull requests and acks of the attached client keep it active.
+const consumerAttachIdleThreshold = 30 * time.Second
+
+// consumerAttachment is the client attached to an exclusive consumer.
+// Kept on the leader only, so clients need to attach again after a leader change.
+type consumerAttachment struct {
+	fence string
+	last  time.Time
+}
+
+// Check the config of an exclusive consumer.
+func checkConsumerExclusive(config *ConsumerConfig) error {
+	if !isDurableConsumer(config) {
+		return errors.New("exclusive consumers need to be durable")
+	}
+	if config.DeliverSubject != _EMPTY_ {
+		return errors.New("exclusive consumers need to be pull consumers")
+	}
+	return nil
+}
+
+// attach will attach a client to the exclusive consumer and return its fencing token.
+// A client that is attached already and presents its token keeps it. Fails if another
+// client is attached and active, unless taking over, which fences off the previous client.
+func (o *consumer) attach(fence string, takeover bool) (string, *ApiError) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.cfg.Exclusive {
+		return _EMPTY_, NewJSConsumerNotExclusiveError()
+	}
+	now := time.Now()
+	if a := o.attached; a != nil {
+		if fence != _EMPTY_ && subtle.ConstantTimeCompare([]byte(fence), []byte(a.fence)) == 1 {
+			a.last = now
+			return a.fence, nil
+		}
+		if now.Sub(a.last) < consumerAttachIdleThreshold && !takeover {
+			return _EMPTY_, NewJSConsumerAttachedError()
+		}
+		// Requests of the previous client will not be served anymore.
+		o.fencePendingRequests()
+	}
+	o.attached = &consumerAttachment{fence: nuid.Next(), last: now}
+	return o.attached.fence, nil
+}
+
+// checkFence will check that the headers carry the fencing token of the attached client,
+// and mark the client as active. Always true if we are not exclusive.
+func (o *consumer) checkFence(hdr []byte) bool {
+	// Fast path, acks and pull requests of most consumers should not contend on our lock.
+	o.mu.RLock()
+	exclusive := o.cfg.Exclusive
+	o.mu.RUnlock()
+	if !exclusive {
+		return true
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// Could have been updated.
+	if !o.cfg.Exclusive {
+		return true
+	}
+	a := o.attached
+	if a == nil || subtle.ConstantTimeCompare(getHeader(JSConsumerFence, hdr), []byte(a.fence)) != 1 {
+		return false
+	}
+	a.last = time.Now()
+	return true
+}
+
+// fencePendingRequests will release all waiting pull requests, they are from a client that was fenced off.
+// Lock should be held.
+func (o *consumer) fencePendingRequests() {
+	if o.waiting.len() == 0 {
+		return
+	}
+	hdr := []byte("NATS/1.0 409 Consumer Fenced\r\n\r\n")
+	wq := o.waiting
+	o.waiting = newWaitQueue(o.cfg.MaxWaiting)
+	for i, rp := 0, wq.rp; i < wq.n; i++ {
+		if wr := wq.reqs[rp]; wr != nil {
+			if o.outq != nil {
+				o.outq.send(newJSPubMsg(wr.reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+			}
+			wr.recycle()
+		}
+		rp = (rp + 1) % cap(wq.reqs)
+	}
+}
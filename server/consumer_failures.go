@@ -0,0 +1,59 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "time"
+
+// Reasons a push consumer failed to deliver.
+const (
+	deliveryFailedNoInterest   = "no interest on deliver subject"
+	deliveryFailedNotAccepted  = "subscribers on deliver subject did not accept the message, e.g. due to their permissions"
+	deliveryFailedSlowConsumer = "client on deliver subject is a slow consumer, delivery paused"
+)
+
+// ConsumerDeliveryFailures is reported in the consumer info of a push consumer that failed
+// to deliver, to help tell why a consumer is not receiving messages.
+// Kept on the leader only, so it starts over after a leader change.
+type ConsumerDeliveryFailures struct {
+	// Number of times delivery failed, or stopped since interest was lost.
+	Count uint64 `json:"count"`
+	// Why delivery failed last.
+	LastError string `json:"last_error"`
+	// When delivery failed first and last.
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+}
+
+// recordDeliveryFailure will record that a delivery failed for the given reason.
+// Lock should be held.
+func (o *consumer) recordDeliveryFailure(reason string) {
+	now := time.Now().UTC()
+	df := o.dfails
+	if df == nil {
+		df = &ConsumerDeliveryFailures{First: now}
+		o.dfails = df
+	}
+	df.Count++
+	df.LastError, df.Last = reason, now
+}
+
+// deliveryFailures returns a copy of our delivery failures, nil if we have none.
+// Lock should be held.
+func (o *consumer) deliveryFailures() *ConsumerDeliveryFailures {
+	if o.dfails == nil {
+		return nil
+	}
+	df := *o.dfails
+	return &df
+}
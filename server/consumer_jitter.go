@@ -0,0 +1,52 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+)
+
+// Check the redelivery jitter of a consumer config.
+func checkConsumerRedeliveryJitter(config *ConsumerConfig) error {
+	if config.RedeliveryJitter < 0 {
+		return errors.New("redelivery jitter can not be negative")
+	}
+	if config.AckPolicy == AckNone {
+		return errors.New("redelivery jitter requires acks")
+	}
+	return nil
+}
+
+// redeliveryJitter returns how much later than its ack wait or backoff the message with the given
+// stream sequence and delivery count is redelivered, somewhere within our jitter window.
+// It is derived from both, so it is the same on every check and for all replicas, but differs
+// for each delivery attempt.
+// Lock should be held.
+func (o *consumer) redeliveryJitter(seq, dc uint64) int64 {
+	window := int64(o.cfg.RedeliveryJitter)
+	if window <= 0 {
+		return 0
+	}
+	return int64(mix64(seq^(dc<<48)) % uint64(window))
+}
+
+// mix64 is the finalizer of splitmix64, spreads consecutive values over the whole range.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Rough estimates of the memory used to track pending and redelivered messages.
+const (
+	// Pending map entry and its record.
+	pendingEntryMem = 64
+	// Redelivered count map entry.
+	rdcEntryMem = 48
+	// Redelivery queue entry and its index map entry.
+	rdqEntryMem = 40
+	// Pending order entry, when dropping old messages.
+	pendqEntryMem = 8
+)
+
+// checkConsumerPendingMemory will make sure the pending memory limit is valid.
+func checkConsumerPendingMemory(config *ConsumerConfig) error {
+	if config.MaxPendingMemory < 0 {
+		return errors.New("consumer max pending memory can not be negative")
+	}
+	if config.AckPolicy == AckNone {
+		return errors.New("consumer max pending memory requires an ack policy")
+	}
+	return nil
+}
+
+// pendingMemory estimates the memory used by our pending and redelivery state.
+// Lock should be held.
+func (o *consumer) pendingMemory() int64 {
+	return int64(len(o.pending))*pendingEntryMem + int64(len(o.rdc))*rdcEntryMem + int64(len(o.rdq))*rdqEntryMem +
+		int64(len(o.pendq))*pendqEntryMem
+}
+
+// updatePendingMemory will update our account's total with our current pending memory.
+// Lock should be held.
+func (o *consumer) updatePendingMemory() {
+	if o.mset == nil || o.mset.jsa == nil {
+		return
+	}
+	if pmem := o.pendingMemory(); pmem != o.pmem {
+		atomic.AddInt64(&o.mset.jsa.pmem, pmem-o.pmem)
+		o.pmem = pmem
+	}
+}
+
+// releasePendingMemory will remove our pending memory from our account's total.
+// Lock should be held.
+func (o *consumer) releasePendingMemory() {
+	if o.pmem != 0 && o.mset != nil && o.mset.jsa != nil {
+		atomic.AddInt64(&o.mset.jsa.pmem, -o.pmem)
+	}
+	o.pmem = 0
+}
+
+// pendingMemoryExceeded returns true if we or our account are over the pending memory limits,
+// in which case we should not deliver new messages.
+// Lock should be held.
+func (o *consumer) pendingMemoryExceeded() bool {
+	if o.mset == nil || o.mset.jsa == nil {
+		return false
+	}
+	o.updatePendingMemory()
+	o.pmemx = o.cfg.MaxPendingMemory > 0 && o.pmem >= o.cfg.MaxPendingMemory ||
+		o.accpm > 0 && atomic.LoadInt64(&o.mset.jsa.pmem) >= o.accpm
+	return o.pmemx
+}
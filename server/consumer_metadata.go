@@ -0,0 +1,78 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Headers with the metadata of messages delivered by consumers with metadata headers, next to
+// the stream name, stream sequence and timestamp. Same as what is encoded in the ack subject.
+const (
+	JSConsumerName     = "Nats-Consumer"
+	JSConsumerSequence = "Nats-Consumer-Sequence"
+	JSNumDelivered     = "Nats-Num-Delivered"
+	JSNumPending       = "Nats-Num-Pending"
+)
+
+// The headers we set, any with the same name stored with the message are replaced.
+var jsMetadataHeaders = []string{JSStream, JSConsumerName, JSSequence, JSConsumerSequence, JSNumDelivered, JSNumPending, JSTimeStamp}
+
+// Check the metadata headers of a consumer config.
+func checkConsumerMetadataHeaders(config *ConsumerConfig) error {
+	if config.DeliverSubject != _EMPTY_ {
+		return errors.New("metadata headers require a pull consumer")
+	}
+	return nil
+}
+
+// addMetadataHeaders will add the metadata headers to a message we are about to deliver.
+func addMetadataHeaders(pmsg *jsPubMsg, stream, consumer string, dseq, dc, pending uint64) {
+	hdr := pmsg.hdr
+	if len(hdr) > 0 {
+		hdr = copyBytes(hdr)
+		for _, key := range jsMetadataHeaders {
+			hdr = removeHeaderIfPresent(hdr, key)
+		}
+	}
+	var bb bytes.Buffer
+	if len(hdr) > LEN_CR_LF {
+		bb.Write(hdr[:len(hdr)-LEN_CR_LF])
+	} else {
+		bb.WriteString(hdrLine)
+	}
+	for _, kv := range [][2]string{
+		{JSStream, stream},
+		{JSConsumerName, consumer},
+		{JSSequence, strconv.FormatUint(pmsg.seq, 10)},
+		{JSConsumerSequence, strconv.FormatUint(dseq, 10)},
+		{JSNumDelivered, strconv.FormatUint(dc, 10)},
+		{JSNumPending, strconv.FormatUint(pending, 10)},
+		{JSTimeStamp, time.Unix(0, pmsg.ts).UTC().Format(time.RFC3339Nano)},
+	} {
+		bb.WriteString(kv[0])
+		bb.WriteString(": ")
+		bb.WriteString(kv[1])
+		bb.WriteString(CR_LF)
+	}
+	bb.WriteString(CR_LF)
+	hlen := bb.Len()
+	bb.Write(pmsg.msg)
+	// The underlying buf is what gets sent, so replace it.
+	buf := bb.Bytes()
+	pmsg.buf, pmsg.hdr, pmsg.msg = buf, buf[:hlen], buf[hlen:]
+}
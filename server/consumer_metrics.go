@@ -0,0 +1,146 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// JSConsumerMetricsOpts configure publishing the delivery metrics of all consumers we lead, so
+// collectors can subscribe to them instead of requesting the info of every consumer. Metrics are
+// published in the account of the consumer on the subject followed by the stream and consumer name.
+type JSConsumerMetricsOpts struct {
+	// Subject the metrics are published on, JSMetricConsumerDeliveryPre if empty.
+	Subject string
+	// Time between metrics of a consumer.
+	Interval time.Duration
+}
+
+// Default time between delivery metrics of a consumer.
+const defaultConsumerMetricsInterval = 10 * time.Second
+
+func validateJetStreamConsumerMetrics(o *Options) error {
+	mo := o.JetStreamMetrics
+	if mo == nil {
+		return nil
+	}
+	if mo.Interval < 0 {
+		return errors.New("jetstream consumer metrics interval can not be negative")
+	}
+	if mo.Subject != _EMPTY_ && !IsValidLiteralSubject(mo.Subject) {
+		return fmt.Errorf("jetstream consumer metrics subject %q is not a valid literal subject", mo.Subject)
+	}
+	return nil
+}
+
+// publishConsumerMetrics will periodically publish the delivery metrics of all consumers we lead.
+func (js *jetStream) publishConsumerMetrics() {
+	s := js.srv
+	defer s.grWG.Done()
+
+	mo := s.getOpts().JetStreamMetrics
+	if mo == nil {
+		return
+	}
+	subject := mo.Subject
+	if subject == _EMPTY_ {
+		subject = JSMetricConsumerDeliveryPre
+	}
+	interval := mo.Interval
+	if interval == 0 {
+		interval = defaultConsumerMetricsInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	js.mu.RLock()
+	qch := js.quitCh
+	js.mu.RUnlock()
+
+	for {
+		select {
+		case <-qch:
+			return
+		case <-s.quitCh:
+			return
+		case <-t.C:
+			if !js.isEnabled() {
+				continue
+			}
+			js.mu.RLock()
+			accounts := make([]*jsAccount, 0, len(js.accounts))
+			for _, jsa := range js.accounts {
+				accounts = append(accounts, jsa)
+			}
+			js.mu.RUnlock()
+
+			for _, jsa := range accounts {
+				jsa.mu.RLock()
+				streams := make([]*stream, 0, len(jsa.streams))
+				for _, mset := range jsa.streams {
+					streams = append(streams, mset)
+				}
+				jsa.mu.RUnlock()
+				for _, mset := range streams {
+					for _, o := range mset.getPublicConsumers() {
+						if o.isLeader() {
+							o.sendDeliveryMetric(subject)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// sendDeliveryMetric will publish our delivery metrics on the subject followed by our stream and name.
+func (o *consumer) sendDeliveryMetric(subject string) {
+	o.mu.Lock()
+	if o.closed || o.mset == nil {
+		o.mu.Unlock()
+		return
+	}
+	m := JSConsumerDeliveryMetric{
+		TypedEvent: TypedEvent{
+			Type: JSConsumerDeliveryMetricType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:   o.stream,
+		Consumer: o.name,
+		Delivered: SequenceInfo{
+			Consumer: o.dseq - 1,
+			Stream:   o.sseq - 1,
+		},
+		AckFloor: SequenceInfo{
+			Consumer: o.adflr,
+			Stream:   o.asflr,
+		},
+		NumAckPending:  len(o.pending),
+		NumRedelivered: len(o.rdc),
+		NumPending:     o.checkNumPending(),
+		Domain:         o.srv.getOpts().JetStreamDomain,
+	}
+	subj := fmt.Sprintf("%s.%s.%s", subject, o.stream, o.name)
+	o.mu.Unlock()
+
+	if j, err := json.Marshal(m); err == nil {
+		o.sendAdvisory(subj, j)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RedeliveryOrder determines how redeliveries are ordered with respect to new deliveries.
+type RedeliveryOrder int
+
+const (
+	// RedeliveryInterleaved will keep delivering new messages while redelivered ones are pending.
+	RedeliveryInterleaved RedeliveryOrder = iota
+	// RedeliveryStrict will not deliver new messages while any message is due for redelivery,
+	// until all redelivered messages have been acked or terminated, or have exceeded MaxDeliver.
+	RedeliveryStrict
+)
+
+func (ro RedeliveryOrder) String() string {
+	switch ro {
+	case RedeliveryInterleaved:
+		return "interleaved"
+	case RedeliveryStrict:
+		return "strict"
+	default:
+		return "unknown redelivery order"
+	}
+}
+
+func (ro RedeliveryOrder) MarshalJSON() ([]byte, error) {
+	switch ro {
+	case RedeliveryInterleaved:
+		return json.Marshal("interleaved")
+	case RedeliveryStrict:
+		return json.Marshal("strict")
+	default:
+		return nil, fmt.Errorf("can not marshal %v", ro)
+	}
+}
+
+func (ro *RedeliveryOrder) UnmarshalJSON(data []byte) error {
+	switch strings.ToLower(string(data)) {
+	case jsonString("interleaved"):
+		*ro = RedeliveryInterleaved
+	case jsonString("strict"):
+		*ro = RedeliveryStrict
+	default:
+		return fmt.Errorf("can not unmarshal %q", data)
+	}
+	return nil
+}
+
+// Returns true if a message that was redelivered is still pending, or a pending message
+// has passed its ack deadline and will be redelivered once our pending timer fires.
+// With a strict redelivery order we hold off on new deliveries until it is resolved.
+// Lock should be held.
+func (o *consumer) hasRedeliveredPending() bool {
+	for seq := range o.rdc {
+		if _, ok := o.pending[seq]; ok {
+			return true
+		}
+	}
+	now := time.Now().UnixNano()
+	for seq, p := range o.pending {
+		if now-p.Timestamp >= o.ackDeadline(seq) {
+			return true
+		}
+	}
+	return false
+}
+
+// ackDeadline returns how long after it was delivered the pending message will be redelivered.
+// Lock should be held.
+func (o *consumer) ackDeadline(seq uint64) int64 {
+	deadline := int64(o.cfg.AckWait)
+	if l := len(o.cfg.BackOff); l > 0 {
+		dc := int(o.rdc[seq])
+		if dc >= l {
+			dc = l - 1
+		}
+		deadline = int64(o.cfg.BackOff[dc])
+	}
+	return deadline + o.redeliveryJitter(seq, o.rdc[seq])
+}
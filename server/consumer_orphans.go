@@ -0,0 +1,226 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// JSOrphanOpts configure detecting durable pull consumers that nobody uses anymore. A consumer
+// is orphaned when it had no pull requests for longer than the threshold. Orphans are reported
+// with an advisory and in their consumer info, and are deleted after the grace period when
+// auto delete is enabled.
+type JSOrphanOpts struct {
+	// How long a durable pull consumer can go without pull requests before it is orphaned.
+	Threshold time.Duration
+	// Delete orphans, otherwise they are only reported.
+	AutoDelete bool
+	// How long after the orphaned advisory an orphan is deleted.
+	Grace time.Duration
+}
+
+const (
+	// Default time between orphaned advisory and deleting the orphan.
+	defaultOrphanGrace = time.Hour
+	// Upper bound of the time between checks for orphans.
+	maxOrphanCheckInterval = time.Minute
+)
+
+// ConsumerOrphanInfo is reported in the consumer info of an orphaned consumer.
+type ConsumerOrphanInfo struct {
+	// Last time we saw a pull request, or the consumer leader started tracking activity.
+	LastActive time.Time `json:"last_active"`
+	// When the consumer was orphaned.
+	Since time.Time `json:"since"`
+	// When the consumer will be deleted, only set with auto delete.
+	DeleteAt *time.Time `json:"delete_at,omitempty"`
+}
+
+// consumerOrphan tracks the activity of a durable pull consumer.
+// Kept on the leader only, so tracking starts over after a leader change.
+type consumerOrphan struct {
+	last  time.Time
+	since time.Time
+	grace time.Duration
+}
+
+func validateJetStreamOrphans(o *Options) error {
+	oo := o.JetStreamOrphans
+	if oo == nil {
+		return nil
+	}
+	if oo.Threshold <= 0 {
+		return errors.New("jetstream orphans threshold needs to be positive")
+	}
+	if oo.Grace < 0 {
+		return errors.New("jetstream orphans grace period can not be negative")
+	}
+	return nil
+}
+
+// monitorOrphans will periodically check all durable pull consumers we lead for orphans.
+func (js *jetStream) monitorOrphans() {
+	s := js.srv
+	defer s.grWG.Done()
+
+	oo := s.getOpts().JetStreamOrphans
+	if oo == nil || oo.Threshold <= 0 {
+		return
+	}
+	grace := oo.Grace
+	if grace == 0 {
+		grace = defaultOrphanGrace
+	}
+	if !oo.AutoDelete {
+		grace = 0
+	}
+	interval := oo.Threshold / 4
+	if interval > maxOrphanCheckInterval {
+		interval = maxOrphanCheckInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	js.mu.RLock()
+	qch := js.quitCh
+	js.mu.RUnlock()
+
+	for {
+		select {
+		case <-qch:
+			return
+		case <-s.quitCh:
+			return
+		case now := <-t.C:
+			if !js.isEnabled() {
+				continue
+			}
+			js.mu.RLock()
+			accounts := make([]*jsAccount, 0, len(js.accounts))
+			for _, jsa := range js.accounts {
+				accounts = append(accounts, jsa)
+			}
+			js.mu.RUnlock()
+
+			for _, jsa := range accounts {
+				jsa.mu.RLock()
+				streams := make([]*stream, 0, len(jsa.streams))
+				for _, mset := range jsa.streams {
+					streams = append(streams, mset)
+				}
+				jsa.mu.RUnlock()
+				for _, mset := range streams {
+					for _, o := range mset.getPublicConsumers() {
+						if o.checkOrphaned(now, oo.Threshold, grace) {
+							o.deleteOrphan()
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// checkOrphaned will track the activity of a durable pull consumer, and send the orphaned
+// advisory once it had no pull requests for longer than the threshold. A zero grace period
+// means orphans are not deleted. Returns true if the orphan should be deleted now.
+func (o *consumer) checkOrphaned(now time.Time, threshold, grace time.Duration) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.mset == nil || o.closed || !o.isLeader() || !o.isDurable() || !o.isPullMode() {
+		o.orphan = nil
+		return false
+	}
+	if o.orphan == nil {
+		o.orphan = &consumerOrphan{last: now}
+	}
+	op := o.orphan
+	if o.waiting.last.After(op.last) {
+		op.last = o.waiting.last
+	}
+	// Requests still waiting count as interest.
+	if o.checkWaitingForInterest() {
+		op.last = now
+	}
+	if now.Sub(op.last) < threshold {
+		op.since, op.grace = time.Time{}, 0
+		return false
+	}
+	if op.since.IsZero() {
+		op.since, op.grace = now, grace
+		o.sendOrphanedAdvisoryLocked()
+		return false
+	}
+	return op.grace > 0 && now.Sub(op.since) >= op.grace
+}
+
+// orphanInfo returns the orphan info if we are orphaned.
+// Lock should be held.
+func (o *consumer) orphanInfo() *ConsumerOrphanInfo {
+	op := o.orphan
+	if op == nil || op.since.IsZero() {
+		return nil
+	}
+	oi := &ConsumerOrphanInfo{LastActive: op.last.UTC(), Since: op.since.UTC()}
+	if op.grace > 0 {
+		da := op.since.Add(op.grace).UTC()
+		oi.DeleteAt = &da
+	}
+	return oi
+}
+
+// Lock should be held.
+func (o *consumer) sendOrphanedAdvisoryLocked() {
+	e := JSConsumerOrphanedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSConsumerOrphanedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:   o.stream,
+		Consumer: o.name,
+		Orphan:   o.orphanInfo(),
+		Domain:   o.srv.getOpts().JetStreamDomain,
+	}
+
+	j, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	subj := JSAdvisoryConsumerOrphanedPre + "." + o.stream + "." + o.name
+	o.sendAdvisory(subj, j)
+}
+
+// deleteOrphan will delete an orphaned consumer.
+func (o *consumer) deleteOrphan() {
+	o.mu.RLock()
+	s, acc, stream, name := o.srv, o.acc, o.stream, o.name
+	o.mu.RUnlock()
+
+	s.Noticef("Deleting orphaned consumer '%s > %s > %s'", acc.Name, stream, name)
+	o.deleteSelf()
+}
+
+// isOrphaned returns if we are orphaned.
+func (o *consumer) isOrphaned() bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.orphanInfo() != nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// MaxAckPendingPolicy determines what a push consumer does once MaxAckPending is reached.
+type MaxAckPendingPolicy int
+
+const (
+	// MaxAckPendingBlock will not deliver new messages until pending ones are acked.
+	MaxAckPendingBlock MaxAckPendingPolicy = iota
+	// MaxAckPendingDropOld will drop the oldest pending message to deliver a new one, and send an advisory.
+	// For workloads where the newest data matters most, e.g. telemetry.
+	MaxAckPendingDropOld
+)
+
+func (mp MaxAckPendingPolicy) String() string {
+	switch mp {
+	case MaxAckPendingBlock:
+		return "block"
+	case MaxAckPendingDropOld:
+		return "drop_old"
+	default:
+		return "unknown max ack pending policy"
+	}
+}
+
+func (mp MaxAckPendingPolicy) MarshalJSON() ([]byte, error) {
+	switch mp {
+	case MaxAckPendingBlock:
+		return json.Marshal("block")
+	case MaxAckPendingDropOld:
+		return json.Marshal("drop_old")
+	default:
+		return nil, fmt.Errorf("can not marshal %v", mp)
+	}
+}
+
+func (mp *MaxAckPendingPolicy) UnmarshalJSON(data []byte) error {
+	switch strings.ToLower(string(data)) {
+	case jsonString("block"):
+		*mp = MaxAckPendingBlock
+	case jsonString("drop_old"):
+		*mp = MaxAckPendingDropOld
+	default:
+		return fmt.Errorf("can not unmarshal %q", data)
+	}
+	return nil
+}
+
+// Check the max ack pending policy of a consumer config.
+func checkConsumerMaxAckPendingPolicy(config *ConsumerConfig) error {
+	if config.DeliverSubject == _EMPTY_ {
+		return errors.New("dropping old messages at max ack pending requires a push consumer")
+	}
+	if config.AckPolicy == AckNone || config.MaxAckPending <= 0 {
+		return errors.New("dropping old messages requires acks and a max ack pending limit")
+	}
+	return nil
+}
+
+// trackPendingOrder will add a new pending message to the order we drop old messages in.
+// Sequences are only removed once they are at the front, so acked ones are compacted away
+// when there are too many. The order is rebuilt from our pending messages if not in use yet,
+// e.g. after restoring our state, or if we went back in the stream.
+// Lock should be held.
+func (o *consumer) trackPendingOrder(sseq uint64) {
+	if o.pendq == nil || (len(o.pendq) > 0 && sseq < o.pendq[len(o.pendq)-1]) {
+		o.pendq = nil
+		return
+	}
+	o.pendq = append(o.pendq, sseq)
+	if len(o.pendq) > 2*len(o.pending)+64 {
+		pendq := make([]uint64, 0, len(o.pending))
+		for _, seq := range o.pendq {
+			if _, ok := o.pending[seq]; ok {
+				pendq = append(pendq, seq)
+			}
+		}
+		o.pendq = pendq
+	}
+}
+
+// dropOldestPending will drop the oldest pending message so a new one can be delivered.
+// It is no longer redelivered, as if it was acked. The stream is informed outside of our
+// lock for interest and workqueue retention, and an advisory is sent.
+// Lock should be held.
+func (o *consumer) dropOldestPending() bool {
+	if o.pendq == nil {
+		o.pendq = make([]uint64, 0, len(o.pending))
+		for seq := range o.pending {
+			o.pendq = append(o.pendq, seq)
+		}
+		sort.Slice(o.pendq, func(i, j int) bool { return o.pendq[i] < o.pendq[j] })
+	}
+	var sseq uint64
+	var p *Pending
+	for len(o.pendq) > 0 && p == nil {
+		sseq, o.pendq = o.pendq[0], o.pendq[1:]
+		p = o.pending[sseq]
+	}
+	if p == nil {
+		return false
+	}
+	dseq, dc := p.Sequence, o.rdc[sseq]+1
+
+	delete(o.pending, sseq)
+	pendingPool.Put(p)
+	delete(o.rdc, sseq)
+	o.removeFromRedeliverQueue(sseq)
+
+	// Since this was the oldest the ack floor moves up to it.
+	if sseq > o.asflr {
+		o.asflr = sseq
+	}
+	if dseq > o.adflr {
+		o.adflr = dseq
+	}
+	o.updateAcks(dseq, sseq)
+	o.updatePendingMemory()
+
+	if mset := o.mset; o.node == nil && mset != nil && mset.cfg.Retention != LimitsPolicy {
+		go mset.ackMsg(o, sseq)
+	}
+
+	e := JSConsumerDeliveryDroppedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSConsumerDeliveryDroppedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:      o.stream,
+		Consumer:    o.name,
+		ConsumerSeq: dseq,
+		StreamSeq:   sseq,
+		Deliveries:  dc,
+		Domain:      o.srv.getOpts().JetStreamDomain,
+	}
+	if j, err := json.Marshal(e); err == nil {
+		o.sendAdvisory(JSAdvisoryConsumerMsgDroppedPre+"."+o.stream+"."+o.name, j)
+	}
+	return true
+}
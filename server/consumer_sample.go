@@ -0,0 +1,79 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+)
+
+// Check the sampling of a consumer config.
+func checkConsumerSample(config *ConsumerConfig, cfg *StreamConfig) error {
+	if config.SampleEvery > 0 && config.SamplePercent != 0 {
+		return errors.New("sample every and sample percent are mutually exclusive")
+	}
+	if config.SamplePercent < 0 || config.SamplePercent > 100 {
+		return errors.New("sample percent must be a percentage")
+	}
+	// Messages that are not sampled would never be removed.
+	switch cfg.Retention {
+	case WorkQueuePolicy:
+		return errors.New("sampling not allowed on work queue streams")
+	case InterestPolicy:
+		return errors.New("sampling not allowed on interest streams")
+	}
+	return nil
+}
+
+// consumerSample decides which messages a sampling consumer delivers. It only depends on the
+// stream sequence, so all replicas and leaders sample the same messages.
+type consumerSample struct {
+	every uint64
+	// Out of 1<<32.
+	threshold uint64
+}
+
+// sample returns how we sample, nil if we deliver everything.
+// Lock should be held.
+func (o *consumer) sample() *consumerSample {
+	if o.cfg.SampleEvery > 1 {
+		return &consumerSample{every: o.cfg.SampleEvery}
+	}
+	if p := o.cfg.SamplePercent; p > 0 && p < 100 {
+		return &consumerSample{threshold: uint64(p / 100 * (1 << 32))}
+	}
+	return nil
+}
+
+// includes returns if the message with the given stream sequence is part of the sample.
+func (cs *consumerSample) includes(seq uint64) bool {
+	if cs == nil {
+		return true
+	}
+	if cs.every > 0 {
+		return seq%cs.every == 0
+	}
+	return mix64(seq)>>32 < cs.threshold
+}
+
+// pending returns how many of the given pending messages we expect to be part of the sample.
+// Which ones are is only known once loaded, so this is an estimate when recalculating num pending.
+func (cs *consumerSample) pending(np uint64) uint64 {
+	if cs == nil {
+		return np
+	}
+	if cs.every > 0 {
+		return np / cs.every
+	}
+	return uint64(float64(np) * float64(cs.threshold) / (1 << 32))
+}
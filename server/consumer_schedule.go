@@ -0,0 +1,208 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ConsumerSchedule restricts delivery to windows of time, e.g. for batch processing consumers
+// that must not receive messages during business hours. Outside of the windows the consumer
+// is paused, including redeliveries, and resumes once the next window opens.
+type ConsumerSchedule struct {
+	// Windows during which messages are delivered.
+	Windows []ScheduleWindow `json:"windows"`
+	// Time zone of the windows, e.g. "Europe/Berlin", UTC if empty.
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// ScheduleWindow is a daily window of time, e.g. from "02:00" to "04:00". Windows that end
+// before they start span midnight, and end "24:00" is the end of the day.
+type ScheduleWindow struct {
+	// Days of the week the window starts on, e.g. ["sat", "sun"], every day if empty.
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// How far ahead we look for the next window to open, a schedule repeats every week.
+const scheduleHorizon = 8
+
+// consumerSchedule is the parsed schedule of a consumer.
+type consumerSchedule struct {
+	loc     *time.Location
+	windows []scheduleWindow
+}
+
+type scheduleWindow struct {
+	// Bit per time.Weekday.
+	days       uint8
+	start, end int
+}
+
+var scheduleDays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// newConsumerSchedule will parse the schedule, nil if we have none.
+func newConsumerSchedule(cs *ConsumerSchedule) (*consumerSchedule, error) {
+	if cs == nil {
+		return nil, nil
+	}
+	return parseSchedule("delivery schedule", cs.Windows, cs.TimeZone)
+}
+
+// parseSchedule will parse windows in the given time zone, what is used in errors.
+func parseSchedule(what string, windows []ScheduleWindow, tz string) (*consumerSchedule, error) {
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("%s requires windows", what)
+	}
+	sched := &consumerSchedule{loc: time.UTC}
+	if tz != _EMPTY_ {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("%s time zone %q is invalid", what, tz)
+		}
+		sched.loc = loc
+	}
+	for _, w := range windows {
+		var sw scheduleWindow
+		for _, day := range w.Days {
+			wd, ok := scheduleDays[strings.ToLower(day)]
+			if !ok {
+				return nil, fmt.Errorf("%s day %q is invalid", what, day)
+			}
+			sw.days |= 1 << wd
+		}
+		if sw.days == 0 {
+			sw.days = 1<<7 - 1
+		}
+		var err error
+		if sw.start, err = parseScheduleTime(w.Start); err != nil || sw.start == 24*60 {
+			return nil, fmt.Errorf("%s start %q is invalid", what, w.Start)
+		}
+		if sw.end, err = parseScheduleTime(w.End); err != nil {
+			return nil, fmt.Errorf("%s end %q is invalid", what, w.End)
+		}
+		if sw.start == sw.end {
+			return nil, fmt.Errorf("%s window can not be empty", what)
+		}
+		sched.windows = append(sched.windows, sw)
+	}
+	return sched, nil
+}
+
+// parseScheduleTime returns the minute of the day of a "HH:MM" time.
+func parseScheduleTime(hm string) (int, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(hm, "%d:%d", &h, &m); err != nil || n != 2 || len(hm) != 5 {
+		return 0, errors.New("invalid time")
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, errors.New("invalid time")
+	}
+	return h*60 + m, nil
+}
+
+// isOpen returns if we deliver at the given time.
+func (cs *consumerSchedule) isOpen(t time.Time) bool {
+	t = t.In(cs.loc)
+	wd, m := t.Weekday(), t.Hour()*60+t.Minute()
+	yd := (wd + 6) % 7
+	for _, w := range cs.windows {
+		if w.start < w.end {
+			if w.days&(1<<wd) != 0 && m >= w.start && m < w.end {
+				return true
+			}
+		} else if (w.days&(1<<wd) != 0 && m >= w.start) || (w.days&(1<<yd) != 0 && m < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextOpen returns when the next window opens after the given time.
+func (cs *consumerSchedule) nextOpen(t time.Time) time.Time {
+	lt := t.In(cs.loc)
+	var next time.Time
+	for off := 0; off < scheduleHorizon; off++ {
+		day := time.Date(lt.Year(), lt.Month(), lt.Day()+off, 0, 0, 0, 0, cs.loc)
+		for _, w := range cs.windows {
+			if w.days&(1<<day.Weekday()) == 0 {
+				continue
+			}
+			start := time.Date(day.Year(), day.Month(), day.Day(), w.start/60, w.start%60, 0, 0, cs.loc)
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+		if !next.IsZero() {
+			break
+		}
+	}
+	return next
+}
+
+// Check the delivery schedule of a consumer config.
+func checkConsumerSchedule(config *ConsumerConfig) error {
+	_, err := newConsumerSchedule(config.DeliverySchedule)
+	return err
+}
+
+// outsideSchedule returns if delivery is paused by our schedule, and will make sure we are
+// signaled once the next window opens.
+// Lock should be held.
+func (o *consumer) outsideSchedule() bool {
+	if o.sched == nil {
+		return false
+	}
+	now := time.Now()
+	if o.sched.isOpen(now) {
+		return false
+	}
+	next := o.sched.nextOpen(now)
+	if next.IsZero() {
+		return true
+	}
+	if d := next.Sub(now); o.schedTmr == nil {
+		o.schedTmr = time.AfterFunc(d, o.signalNewMessages)
+	} else {
+		o.schedTmr.Reset(d)
+	}
+	return true
+}
+
+// scheduledUntil returns when our schedule resumes delivery, zero if it does not pause us now.
+// Lock should be held.
+func (o *consumer) scheduledUntil() time.Time {
+	if o.sched == nil {
+		return time.Time{}
+	}
+	if now := time.Now(); !o.sched.isOpen(now) {
+		return o.sched.nextOpen(now)
+	}
+	return time.Time{}
+}
+
+// updateSchedule will apply a new delivery schedule, which was checked already.
+// Lock should be held.
+func (o *consumer) updateSchedule(cs *ConsumerSchedule) {
+	o.sched, _ = newConsumerSchedule(cs)
+	stopAndClearTimer(&o.schedTmr)
+	o.signalNewMessages()
+}
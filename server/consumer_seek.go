@@ -0,0 +1,126 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Check the start consumer sequence for a durable.
+func checkConsumerStartConsumerSeq(config *ConsumerConfig) error {
+	if !isDurableConsumer(config) {
+		return errors.New("start consumer sequence requires a durable consumer")
+	}
+	if config.Direct {
+		return errors.New("start consumer sequence not allowed for direct consumers")
+	}
+	return nil
+}
+
+// moveToConsumerSeq will move a durable to the message it delivered with the given consumer sequence,
+// so that it and the ones after it will be delivered again. A sequence past the next one we would
+// deliver skips the messages in between as if they had been delivered and acked.
+// Our delivery sequence never goes backwards, so messages delivered again get new sequences.
+// Lock should be held.
+func (o *consumer) moveToConsumerSeq(dseq uint64) error {
+	if dseq == o.dseq {
+		return nil
+	}
+	if dseq > o.dseq {
+		return o.skipToConsumerSeq(dseq)
+	}
+
+	sseq, ok := o.streamSeqForConsumerSeq(dseq)
+	if !ok {
+		return fmt.Errorf("consumer sequence %d is neither pending nor the ack floor", dseq)
+	}
+	// Everything from there on will be delivered again.
+	for seq, p := range o.pending {
+		if seq >= sseq {
+			delete(o.pending, seq)
+			delete(o.rdc, seq)
+			o.removeFromRedeliverQueue(seq)
+			pendingPool.Put(p)
+		}
+	}
+	// If we go back past our ack floor, count what we delivered so far as acked.
+	if sseq <= o.asflr {
+		o.adflr, o.asflr = o.dseq-1, sseq-1
+	}
+	o.sseq = sseq
+	o.updatePendingMemory()
+	return nil
+}
+
+// resetStoreState will store our state after we moved, which can go back,
+// and replicate it if we are clustered.
+// Lock should be held.
+func (o *consumer) resetStoreState() error {
+	if o.store == nil {
+		return nil
+	}
+	state := &ConsumerState{
+		Delivered:   SequencePair{Consumer: o.dseq - 1, Stream: o.sseq - 1},
+		AckFloor:    SequencePair{Consumer: o.adflr, Stream: o.asflr},
+		Pending:     o.pending,
+		Redelivered: o.rdc,
+	}
+	if err := o.store.Reset(state); err != nil {
+		return err
+	}
+	if o.node != nil {
+		o.propose(append([]byte{byte(resetConsumerStateOp)}, encodeConsumerState(state)...))
+	}
+	return nil
+}
+
+// Returns the stream sequence of the message we delivered with the given consumer sequence.
+// We only know for our ack floor and the messages still pending.
+// Lock should be held.
+func (o *consumer) streamSeqForConsumerSeq(dseq uint64) (uint64, bool) {
+	if dseq == o.adflr && o.adflr > 0 {
+		return o.asflr, true
+	}
+	for sseq, p := range o.pending {
+		if p.Sequence == dseq {
+			return sseq, true
+		}
+	}
+	return 0, false
+}
+
+// Skips the messages we would deliver next until our next delivery has the given consumer sequence.
+// Lock should be held.
+func (o *consumer) skipToConsumerSeq(dseq uint64) error {
+	if o.mset == nil || o.mset.store == nil {
+		return errors.New("invalid stream")
+	}
+	store, filter, filterWC := o.mset.store, o.cfg.FilterSubject, o.filterWC
+
+	var smv StoreMsg
+	seq := o.sseq
+	for n := o.dseq; n < dseq; n++ {
+		sm, nseq, err := store.LoadNextMsg(filter, filterWC, seq, &smv)
+		if sm == nil || err != nil {
+			return fmt.Errorf("consumer sequence %d is past the messages available to deliver", dseq)
+		}
+		seq = nseq + 1
+	}
+	o.sseq, o.dseq = seq, dseq
+	if len(o.pending) == 0 {
+		o.adflr, o.asflr = o.dseq-1, o.sseq-1
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// A push consumer delivering to a client that can not keep up would eventually have that
+// client disconnected as a slow consumer, dropping whatever is in its send buffer.
+// Instead we pause delivery once a client is half way to its max pending, and mark the
+// consumer as degraded until the client has drained most of what is pending.
+//
+// Only clients connected to this server can be checked. Interest across routes, gateways
+// and leafnodes shares a connection with other traffic, so we do not pause for those and
+// rely on flow control for push consumers delivering to remote clients.
+
+// How often we check the clients we deliver to, and if a degraded consumer can resume delivery.
+const slowDeliveryCheckInterval = 50 * time.Millisecond
+
+// checkSlowDelivery will check the clients we deliver to and return true if we are degraded
+// and should not deliver. Checks are done at most once per slowDeliveryCheckInterval since
+// they need a sublist match and the client locks, so our lock should not be held.
+func (o *consumer) checkSlowDelivery() bool {
+	o.mu.RLock()
+	if o.mset == nil || !o.isPushMode() || !o.isLeader() {
+		o.mu.RUnlock()
+		return false
+	}
+	acc, deliver, active, degraded := o.acc, o.cfg.DeliverSubject, o.active, o.degraded
+	o.mu.RUnlock()
+
+	now := time.Now().UnixNano()
+	if last := atomic.LoadInt64(&o.slowChk); now-last < int64(slowDeliveryCheckInterval) {
+		return degraded
+	}
+	atomic.StoreInt64(&o.slowChk, now)
+
+	slow, drained := false, true
+	if active && acc != nil && acc.sl != nil {
+		check := func(sub *subscription) {
+			c := sub.client
+			if c == nil || c.kind != CLIENT {
+				return
+			}
+			c.mu.Lock()
+			pb, mp := c.out.pb, c.out.mp
+			c.mu.Unlock()
+			if mp <= 0 {
+				return
+			}
+			if pb > mp/2 {
+				slow = true
+			}
+			if pb > mp/4 {
+				drained = false
+			}
+		}
+		r := acc.sl.Match(deliver)
+		for _, sub := range r.psubs {
+			check(sub)
+		}
+		for _, qsub := range r.qsubs {
+			for _, sub := range qsub {
+				check(sub)
+			}
+		}
+	}
+
+	// Fast path, nothing changed.
+	if !degraded && !slow {
+		return false
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.mset == nil {
+		return false
+	}
+	if !o.degraded && slow {
+		o.degraded = true
+		o.recordDeliveryFailure(deliveryFailedSlowConsumer)
+		o.sendDegradedAdvisoryLocked()
+	} else if o.degraded && drained {
+		o.degraded = false
+		o.sendDegradedAdvisoryLocked()
+		stopAndClearTimer(&o.slowTmr)
+		return false
+	}
+	// Nothing to signal us while the client drains, so check again in a bit.
+	if o.degraded {
+		if o.slowTmr == nil {
+			o.slowTmr = time.AfterFunc(slowDeliveryCheckInterval, o.signalNewMessages)
+		} else {
+			o.slowTmr.Reset(slowDeliveryCheckInterval)
+		}
+	}
+	return o.degraded
+}
+
+// Lock should be held.
+func (o *consumer) sendDegradedAdvisoryLocked() {
+	e := JSConsumerDegradedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSConsumerDegradedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:   o.stream,
+		Consumer: o.name,
+		Degraded: o.degraded,
+		Domain:   o.srv.getOpts().JetStreamDomain,
+	}
+
+	j, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	o.sendAdvisory(JSAdvisoryConsumerDegradedPre+"."+o.stream+"."+o.name, j)
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Consumer templates are named consumer configs of a stream that consumers can be created from
+// with JSApiConsumerTemplateCreate. Placeholders of the form {{param}} in the names, description,
+// filter and deliver subjects are replaced by the parameters of the request. Applications can be
+// allowed to create consumers from templates only, by allowing them that API but not the others.
+
+// Placeholder of a template parameter.
+var consumerTemplateParam = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_-]+)\s*\}\}`)
+
+// checkConsumerTemplates checks the consumer templates of the stream config.
+func checkConsumerTemplates(cfg *StreamConfig) error {
+	for name, tc := range cfg.ConsumerTemplates {
+		if !isValidName(name) {
+			return fmt.Errorf("consumer template name %q is invalid", name)
+		}
+		for _, v := range consumerTemplateFields(&tc) {
+			if rest := consumerTemplateParam.ReplaceAllString(*v, _EMPTY_); strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+				return fmt.Errorf("consumer template %q has an invalid placeholder in %q", name, *v)
+			}
+		}
+	}
+	return nil
+}
+
+// consumerTemplateFields returns the fields of a consumer config that can hold placeholders.
+func consumerTemplateFields(cfg *ConsumerConfig) []*string {
+	return []*string{&cfg.Durable, &cfg.Name, &cfg.Description, &cfg.FilterSubject, &cfg.DeliverSubject, &cfg.DeliverGroup}
+}
+
+// instantiateConsumerTemplate returns the consumer config of the template with all placeholders
+// replaced by the parameters. All placeholders need a parameter and all parameters need to be used.
+// Values need to be a single subject token, so they can not widen what the template allows.
+func instantiateConsumerTemplate(tc *ConsumerConfig, params map[string]string) (*ConsumerConfig, error) {
+	for _, k := range sortedParamNames(params) {
+		if v := params[k]; v == _EMPTY_ || strings.ContainsAny(v, ".*> \t\r\n\\/") {
+			return nil, fmt.Errorf("consumer template parameter %q has invalid value %q", k, v)
+		}
+	}
+
+	cfg := *tc
+	used := make(map[string]struct{}, len(params))
+	var missing string
+	for _, v := range consumerTemplateFields(&cfg) {
+		*v = consumerTemplateParam.ReplaceAllStringFunc(*v, func(ph string) string {
+			k := consumerTemplateParam.FindStringSubmatch(ph)[1]
+			pv, ok := params[k]
+			if !ok {
+				if missing == _EMPTY_ {
+					missing = k
+				}
+				return ph
+			}
+			used[k] = struct{}{}
+			return pv
+		})
+	}
+	if missing != _EMPTY_ {
+		return nil, fmt.Errorf("consumer template parameter %q is missing", missing)
+	}
+	for _, k := range sortedParamNames(params) {
+		if _, ok := used[k]; !ok {
+			return nil, fmt.Errorf("consumer template has no parameter %q", k)
+		}
+	}
+	return &cfg, nil
+}
+
+func sortedParamNames(params map[string]string) []string {
+	names := make([]string, 0, len(params))
+	for k := range params {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// DeliverTransformConfig changes message payloads as they are delivered to a consumer,
+// so consumers with less trust can be given access to streams with sensitive data.
+// The stored messages are not changed.
+type DeliverTransformConfig struct {
+	// Fields to remove from JSON object payloads, nested fields are separated by dots.
+	// Messages with payloads that are not JSON objects are delivered with an empty payload.
+	RedactFields []string `json:"redact_fields,omitempty"`
+	// Truncate payloads to this many bytes. The original size will be in the Nats-Msg-Size header.
+	Truncate int `json:"truncate,omitempty"`
+}
+
+// checkConsumerDeliverTransform will make sure the deliver transform is valid.
+func checkConsumerDeliverTransform(config *ConsumerConfig) error {
+	dt := config.DeliverTransform
+	if config.HeadersOnly {
+		return errors.New("consumer deliver transform can not be used with headers only")
+	}
+	if dt.Truncate < 0 {
+		return errors.New("consumer deliver transform truncate can not be negative")
+	}
+	if len(dt.RedactFields) == 0 && dt.Truncate == 0 {
+		return errors.New("consumer deliver transform is empty")
+	}
+	for _, field := range dt.RedactFields {
+		for _, tok := range strings.Split(field, ".") {
+			if tok == _EMPTY_ {
+				return errors.New("consumer deliver transform redact field is invalid")
+			}
+		}
+	}
+	return nil
+}
+
+// applyDeliverTransform will change the payload of the message to be delivered.
+func applyDeliverTransform(pmsg *jsPubMsg, dt *DeliverTransformConfig) {
+	hdr, msg := pmsg.hdr, pmsg.msg
+	if len(dt.RedactFields) > 0 {
+		msg = redactJSONFields(msg, dt.RedactFields)
+	}
+	if dt.Truncate > 0 && len(msg) > dt.Truncate {
+		hdr = genHeader(hdr, JSMsgSize, strconv.Itoa(len(msg)))
+		msg = msg[:dt.Truncate]
+	}
+	// The underlying buf is what gets sent, so replace it.
+	// Can not reuse it since hdr and msg may still point into it.
+	buf := make([]byte, 0, len(hdr)+len(msg))
+	buf = append(buf, hdr...)
+	buf = append(buf, msg...)
+	pmsg.buf, pmsg.hdr, pmsg.msg = buf, buf[:len(hdr)], buf[len(hdr):]
+}
+
+// redactJSONFields returns the JSON object payload without the given fields.
+// If the payload is not a JSON object we can not tell what is in there, so returns nil.
+// Everything else is kept as it was, so we do not escape HTML characters like json.Marshal would.
+func redactJSONFields(msg []byte, fields []string) []byte {
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	// Keep numbers as they were.
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil || obj == nil {
+		return nil
+	}
+	for _, field := range fields {
+		m, toks := obj, strings.Split(field, ".")
+		for _, tok := range toks[:len(toks)-1] {
+			if m, _ = m[tok].(map[string]interface{}); m == nil {
+				break
+			}
+		}
+		if m != nil {
+			delete(m, toks[len(toks)-1])
+		}
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(obj); err != nil {
+		return nil
+	}
+	// Encode adds a newline.
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+}
@@ -0,0 +1,309 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Headers added to webhook requests.
+const (
+	JSWebhookSubject   = "Nats-Subject"
+	JSWebhookStreamSeq = "Nats-Stream-Sequence"
+	JSWebhookDelivered = "Nats-Num-Delivered"
+)
+
+const (
+	webhookContentType  = "application/octet-stream"
+	webhookUserAgentFmt = "nats-server/%s"
+	// Backoff for naks when the consumer has no BackOff configured.
+	webhookMinBackoff = time.Second
+	webhookMaxBackoff = time.Minute
+)
+
+// JSWebhookOpts restrict the targets consumer webhooks can post to.
+type JSWebhookOpts struct {
+	// URLs webhooks can post to, matching scheme, host and path prefix. Any if empty.
+	Allow []string
+	// Allow posting to loopback and link-local addresses, which are refused by default.
+	AllowLocal bool
+	// Allow posting to private network addresses, which are refused by default.
+	AllowPrivate bool
+}
+
+func validateJetStreamWebhooks(o *Options) error {
+	wo := o.JetStreamWebhooks
+	if wo == nil {
+		return nil
+	}
+	for _, a := range wo.Allow {
+		u, err := url.Parse(a)
+		if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == _EMPTY_ {
+			return fmt.Errorf("jetstream webhooks allowed url %q must be an absolute http or https url", a)
+		}
+	}
+	return nil
+}
+
+// Shared address space of carrier-grade NAT, RFC 6598, which net.IP.IsPrivate does not cover.
+var webhookSharedNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// checkWebhookIP returns an error for addresses webhooks can not post to unless allowed.
+// This covers cloud metadata endpoints such as 169.254.169.254, which are link-local.
+func checkWebhookIP(ip net.IP, wo *JSWebhookOpts) error {
+	if (wo == nil || !wo.AllowLocal) &&
+		(ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()) {
+		return fmt.Errorf("loopback or link-local address %s", ip)
+	}
+	if (wo == nil || !wo.AllowPrivate) && (ip.IsPrivate() || webhookSharedNet.Contains(ip)) {
+		return fmt.Errorf("private address %s", ip)
+	}
+	return nil
+}
+
+// checkWebhookTarget will make sure the server allows posting to the webhook url.
+func checkWebhookTarget(whURL string, wo *JSWebhookOpts) error {
+	u, err := url.Parse(whURL)
+	if err != nil {
+		return fmt.Errorf("consumer webhook url is invalid: %v", err)
+	}
+	if wo != nil && len(wo.Allow) > 0 {
+		var allowed bool
+		for _, a := range wo.Allow {
+			au, err := url.Parse(a)
+			if err != nil {
+				continue
+			}
+			if u.Scheme == au.Scheme && strings.EqualFold(u.Host, au.Host) && strings.HasPrefix(u.Path, au.Path) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errors.New("consumer webhook url is not allowed by the server")
+		}
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") && (wo == nil || !wo.AllowLocal) {
+		return errors.New("consumer webhook url can not target a loopback or link-local address")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if err := checkWebhookIP(ip, wo); err != nil {
+			return fmt.Errorf("consumer webhook url can not target a %v", err)
+		}
+	}
+	return nil
+}
+
+// webhookDialControl returns a dialer control that refuses connections to addresses
+// that are not allowed, which names could resolve to.
+func webhookDialControl(wo *JSWebhookOpts) func(_, address string, _ syscall.RawConn) error {
+	return func(_, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			if err := checkWebhookIP(ip, wo); err != nil {
+				return fmt.Errorf("consumer webhook can not connect to %v", err)
+			}
+		}
+		return nil
+	}
+}
+
+// checkConsumerWebhook will make sure the consumer can be fed by a webhook.
+// Webhook consumers are push consumers whose deliveries are acknowledged
+// by the server depending on the response of the HTTP endpoint.
+func checkConsumerWebhook(config *ConsumerConfig) error {
+	u, err := url.Parse(config.Webhook)
+	if err != nil {
+		return fmt.Errorf("consumer webhook url is invalid: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == _EMPTY_ {
+		return errors.New("consumer webhook url must be an absolute http or https url")
+	}
+	if config.DeliverSubject == _EMPTY_ {
+		return errors.New("consumer webhook requires a deliver subject")
+	}
+	if config.DeliverGroup != _EMPTY_ {
+		return errors.New("consumer webhook can not be used with a deliver group")
+	}
+	if config.AckPolicy != AckExplicit {
+		return errors.New("consumer webhook requires explicit ack policy")
+	}
+	if config.FlowControl || config.Heartbeat > 0 {
+		return errors.New("consumer webhook can not be used with flow control or heartbeats")
+	}
+	return nil
+}
+
+// Internal subscription callback for messages delivered to a webhook consumer.
+// This is coming on the wire so do not block here.
+func (o *consumer) pushWebhook(_ *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	o.whMsgs.push(newJSAckMsg(subject, reply, c.pa.hdr, copyBytes(rmsg)))
+}
+
+// Runs in its own Go routine while we are leader and POSTs each delivered message to the webhook.
+func (o *consumer) processWebhooks(qch chan struct{}) {
+	o.mu.RLock()
+	s, whMsgs, ackWait := o.srv, o.whMsgs, o.cfg.AckWait
+	o.mu.RUnlock()
+
+	// Make sure a request does not outlive the ack wait.
+	// Redirects are not followed since they could lead anywhere.
+	hc := &http.Client{
+		Timeout: ackWait,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	if wo := s.getOpts().JetStreamWebhooks; wo == nil || !wo.AllowLocal || !wo.AllowPrivate {
+		dialer := &net.Dialer{Timeout: ackWait, Control: webhookDialControl(wo)}
+		hc.Transport = &http.Transport{DialContext: dialer.DialContext}
+	}
+	defer hc.CloseIdleConnections()
+
+	for {
+		select {
+		case <-whMsgs.ch:
+			msgs := whMsgs.pop()
+			for _, m := range msgs {
+				select {
+				case <-qch:
+				default:
+					o.postWebhook(hc, m)
+				}
+				m.returnToPool()
+			}
+			whMsgs.recycle(&msgs)
+		case <-qch:
+			return
+		case <-s.quitCh:
+			return
+		}
+	}
+}
+
+// postWebhook will POST the message and process the response as an ack.
+// A 2xx is an ack, a 429, 5xx or transport error is a nak with backoff,
+// and anything else will terminate delivery of the message.
+func (o *consumer) postWebhook(hc *http.Client, m *jsAckMsg) {
+	var hdr, msg []byte
+	if m.hdr > 0 {
+		hdr, msg = m.msg[:m.hdr], m.msg[m.hdr:]
+	} else {
+		msg = m.msg
+	}
+	sseq, dseq, dc := ackReplyInfo(m.reply)
+	if sseq == 0 {
+		return
+	}
+
+	o.mu.RLock()
+	whURL, backoff, name, stream, accName := o.cfg.Webhook, o.cfg.BackOff, o.name, o.stream, o.acc.Name
+	o.mu.RUnlock()
+
+	// The allowed targets could have changed since the consumer was created.
+	if err := checkWebhookTarget(whURL, o.srv.getOpts().JetStreamWebhooks); err != nil {
+		o.srv.RateLimitWarnf("JetStream consumer '%s > %s > %s' webhook refused: %v", accName, stream, name, err)
+		o.processTerm(sseq, dseq, dc)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, whURL, bytes.NewReader(msg))
+	if err != nil {
+		o.processTerm(sseq, dseq, dc)
+		return
+	}
+	if len(hdr) > 0 {
+		if h, err := webhookHeaders(hdr); err == nil {
+			for k, v := range h {
+				req.Header[k] = v
+			}
+		}
+	}
+	req.Header.Set("Content-Type", webhookContentType)
+	req.Header.Set("User-Agent", fmt.Sprintf(webhookUserAgentFmt, VERSION))
+	req.Header.Set(JSWebhookSubject, m.subject)
+	req.Header.Set(JSWebhookStreamSeq, strconv.FormatUint(sseq, 10))
+	req.Header.Set(JSWebhookDelivered, strconv.FormatUint(dc, 10))
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		o.srv.RateLimitWarnf("JetStream consumer '%s > %s > %s' webhook error: %v", accName, stream, name, err)
+		o.processNak(sseq, dseq, dc, webhookNak(backoff, dc))
+		return
+	}
+	resp.Body.Close()
+
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		o.processAckMsg(sseq, dseq, dc, true)
+	case code == http.StatusTooManyRequests || code >= 500:
+		o.processNak(sseq, dseq, dc, webhookNak(backoff, dc))
+	default:
+		o.srv.RateLimitWarnf("JetStream consumer '%s > %s > %s' webhook returned %q, terminating delivery", accName, stream, name, resp.Status)
+		o.processTerm(sseq, dseq, dc)
+	}
+}
+
+// webhookNak will return a NAK with a delay based on the number of deliveries.
+// We use the consumer's BackOff if set, otherwise an exponential backoff.
+func webhookNak(backoff []time.Duration, dc uint64) []byte {
+	var d time.Duration
+	if lbo := len(backoff); lbo > 0 {
+		if dc > uint64(lbo) {
+			dc = uint64(lbo)
+		}
+		d = backoff[dc-1]
+	} else {
+		d = webhookMinBackoff
+		for i := uint64(1); i < dc && d < webhookMaxBackoff; i++ {
+			d *= 2
+		}
+		if d > webhookMaxBackoff {
+			d = webhookMaxBackoff
+		}
+	}
+	return append(append(copyBytes(AckNak), ' '), d.String()...)
+}
+
+// webhookHeaders will convert the NATS headers into HTTP headers.
+func webhookHeaders(hdr []byte) (http.Header, error) {
+	if !bytes.HasPrefix(hdr, []byte(hdrLine[:len(hdrLine)-LEN_CR_LF])) {
+		return nil, errors.New("invalid header")
+	}
+	// Skip the status line.
+	if i := bytes.Index(hdr, []byte(_CRLF_)); i > 0 {
+		hdr = hdr[i+LEN_CR_LF:]
+	}
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(hdr)))
+	h, err := tp.ReadMIMEHeader()
+	if err != nil && len(h) == 0 {
+		return nil, err
+	}
+	return http.Header(h), nil
+}
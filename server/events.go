@@ -42,6 +42,11 @@ const (
 	accClaimsReqSubj   = "$SYS.REQ.CLAIMS.UPDATE"
 	accDeleteReqSubj   = "$SYS.REQ.CLAIMS.DELETE"
 
+	// JetStream account management, only available to the system account.
+	accJSEnableReqSubj  = "$SYS.REQ.ACCOUNT.%s.JS.ENABLE"
+	accJSDisableReqSubj = "$SYS.REQ.ACCOUNT.%s.JS.DISABLE"
+	accJSUpdateReqSubj  = "$SYS.REQ.ACCOUNT.%s.JS.UPDATE"
+
 	connectEventSubj    = "$SYS.ACCOUNT.%s.CONNECT"
 	disconnectEventSubj = "$SYS.ACCOUNT.%s.DISCONNECT"
 	accDirectReqSubj    = "$SYS.REQ.ACCOUNT.%s.%s"
@@ -62,6 +67,7 @@ const (
 	leafNodeConnectEventSubj = "$SYS.ACCOUNT.%s.LEAFNODE.CONNECT" // for internal use only
 	remoteLatencyEventSubj   = "$SYS.LATENCY.M2.%s"
 	inboxRespSubj            = "$SYS._INBOX.%s.%s"
+	serverJszFleetReqSubj    = "$SYS.REQ.SERVER.JSZ"
 
 	// FIXME(dlc) - Should account scope, even with wc for now, but later on
 	// we can then shard as needed.
@@ -918,6 +924,18 @@ func (s *Server) initEventTracking() {
 			optz := &HealthzEventOptions{}
 			s.zReq(c, reply, msg, &optz.EventFilterOptions, optz, func() (interface{}, error) { return s.healthz(&optz.HealthzOptions), nil })
 		},
+		"JSSHIP": func(sub *subscription, c *client, _ *Account, subject, reply string, msg []byte) {
+			optz := &JSShipEventOptions{}
+			s.zReq(c, reply, msg, &optz.EventFilterOptions, optz, func() (interface{}, error) { return s.jsShipReq(&optz.JSShipOptions) })
+		},
+		"JSSTANDBY": func(sub *subscription, c *client, _ *Account, subject, reply string, msg []byte) {
+			optz := &JSStandbyEventOptions{}
+			s.zReq(c, reply, msg, &optz.EventFilterOptions, optz, func() (interface{}, error) { return s.jsStandbyReq(&optz.JSStandbyOptions) })
+		},
+		"JSMIGRATE": func(sub *subscription, c *client, _ *Account, subject, reply string, msg []byte) {
+			optz := &JSMigrateEventOptions{}
+			s.zReq(c, reply, msg, &optz.EventFilterOptions, optz, func() (interface{}, error) { return s.jsMigrateReq(&optz.JSMigrateOptions) })
+		},
 	}
 	for name, req := range monSrvc {
 		subject = fmt.Sprintf(serverDirectReqSubj, s.info.ID, name)
@@ -929,6 +947,10 @@ func (s *Server) initEventTracking() {
 			s.Errorf("Error setting up internal tracking: %v", err)
 		}
 	}
+	// Fleet wide JetStream overview, only one server needs to answer.
+	if _, err := s.sysSubscribeQ(serverJszFleetReqSubj, "jsz", s.jszFleetReq); err != nil {
+		s.Errorf("Error setting up internal tracking: %v", err)
+	}
 	extractAccount := func(c *client, subject string, msg []byte) (string, error) {
 		if tk := strings.Split(subject, tsep); len(tk) != accReqTokens {
 			return _EMPTY_, fmt.Errorf("subject %q is malformed", subject)
@@ -1022,6 +1044,38 @@ func (s *Server) initEventTracking() {
 		}
 	}
 
+	jsAccSrvc := map[string]func(acc *Account, optz *JSAccountEventOptions) (interface{}, error){
+		accJSEnableReqSubj: func(acc *Account, optz *JSAccountEventOptions) (interface{}, error) {
+			if err := acc.EnableJetStream(optz.Limits); err != nil {
+				return nil, err
+			}
+			return acc.JetStreamUsage(), nil
+		},
+		accJSUpdateReqSubj: func(acc *Account, optz *JSAccountEventOptions) (interface{}, error) {
+			if len(optz.Limits) == 0 {
+				return nil, errors.New("jetstream limits are required")
+			}
+			if err := acc.UpdateJetStreamLimits(optz.Limits); err != nil {
+				return nil, err
+			}
+			return acc.JetStreamUsage(), nil
+		},
+		accJSDisableReqSubj: func(acc *Account, optz *JSAccountEventOptions) (interface{}, error) {
+			return nil, acc.DisableJetStreamGraceful(optz.Retention)
+		},
+	}
+	for subj, f := range jsAccSrvc {
+		f := f
+		if _, err := s.sysSubscribe(fmt.Sprintf(subj, "*"), func(sub *subscription, c *client, _ *Account, subject, reply string, msg []byte) {
+			optz := &JSAccountEventOptions{}
+			s.zReq(c, reply, msg, &optz.EventFilterOptions, optz, func() (interface{}, error) {
+				return s.accountJetStreamReq(subject, optz, f)
+			})
+		}); err != nil {
+			s.Errorf("Error setting up internal tracking: %v", err)
+		}
+	}
+
 	// For now only the STATZ subject has an account specific ping equivalent.
 	if _, err := s.sysSubscribe(fmt.Sprintf(accPingReqSubj, "STATZ"),
 		func(sub *subscription, c *client, _ *Account, subject, reply string, msg []byte) {
@@ -1428,6 +1482,17 @@ type AccInfoEventOptions struct {
 	EventFilterOptions
 }
 
+// In the context of system events, JSAccountEventOptions are options passed to
+// the requests that enable, update or disable JetStream for an account.
+type JSAccountEventOptions struct {
+	// Limits indexed by tier, use the empty tier when not tiered.
+	// Enabling without limits uses dynamic limits.
+	Limits map[string]JetStreamAccountLimits `json:"limits,omitempty"`
+	// When disabling, keep the data read only for this long, see DisableJetStreamGraceful.
+	Retention time.Duration `json:"retention,omitempty"`
+	EventFilterOptions
+}
+
 // In the context of system events, ConnzEventOptions are options passed to Connz
 type ConnzEventOptions struct {
 	ConnzOptions
@@ -1627,6 +1692,23 @@ func (s *Server) zReq(c *client, reply string, rmsg []byte, fOpts *EventFilterOp
 	s.sendInternalResponse(reply, response)
 }
 
+// accountJetStreamReq applies a JetStream enable, update or disable request to the account in the subject.
+// Every server applies it to its own view of the account, use the event filter options to pick servers.
+// In operator mode the JetStream limits come from the account JWT, so these requests are rejected.
+func (s *Server) accountJetStreamReq(subject string, optz *JSAccountEventOptions, f func(*Account, *JSAccountEventOptions) (interface{}, error)) (interface{}, error) {
+	if s.trustedKeys != nil {
+		return nil, errors.New("jetstream limits are managed by account JWTs")
+	}
+	if !s.JetStreamEnabled() {
+		return nil, NewJSNotEnabledError()
+	}
+	acc, err := s.LookupAccount(tokenAt(subject, accReqAccIndex+1))
+	if err != nil {
+		return nil, err
+	}
+	return f(acc, optz)
+}
+
 // remoteConnsUpdate gets called when we receive a remote update from another server.
 func (s *Server) remoteConnsUpdate(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if !s.eventsRunning() {
@@ -1661,7 +1661,7 @@ func TestSystemAccountWithGateways(t *testing.T) {
 
 	// If this tests fails with wrong number after 10 seconds we may have
 	// added a new inititial subscription for the eventing system.
-	checkExpectedSubs(t, 45, sa)
+	checkExpectedSubs(t, 55, sa)
 
 	// Create a client on B and see if we receive the event
 	urlb := fmt.Sprintf("nats://%s:%d", ob.Host, ob.Port)
@@ -2536,3 +2536,85 @@ func Benchmark_GetHash(b *testing.B) {
 	default:
 	}
 }
+
+func TestServerEventsAccountJetStreamRequests(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {max_mem_store: 64MB, max_file_store: 64MB, store_dir: %q}
+		system_account: SYS
+		accounts: {
+			A: { users: [ {user: a, password: a} ] }
+			SYS: { users: [ {user: sys, password: sys} ] }
+		}
+	`, t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	snc := natsConnect(t, s.ClientURL(), nats.UserInfo("sys", "sys"))
+	defer snc.Close()
+	nc := natsConnect(t, s.ClientURL(), nats.UserInfo("a", "a"))
+	defer nc.Close()
+
+	req := func(subj string, optz *JSAccountEventOptions) *ServerAPIResponse {
+		t.Helper()
+		b, err := json.Marshal(optz)
+		require_NoError(t, err)
+		msg, err := snc.Request(fmt.Sprintf(subj, "A"), b, time.Second)
+		require_NoError(t, err)
+		var resp ServerAPIResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		return &resp
+	}
+	accountInfo := func() *JSApiAccountInfoResponse {
+		t.Helper()
+		msg, err := nc.Request(JSApiAccountInfo, nil, time.Second)
+		require_NoError(t, err)
+		var info JSApiAccountInfoResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &info))
+		return &info
+	}
+
+	acc, err := s.LookupAccount("A")
+	require_NoError(t, err)
+	require_False(t, acc.JetStreamEnabled())
+
+	// Updates need an account with JetStream enabled.
+	resp := req(accJSUpdateReqSubj, &JSAccountEventOptions{
+		Limits: map[string]JetStreamAccountLimits{_EMPTY_: {MaxMemory: 1024, MaxStore: 1024, MaxStreams: 1, MaxConsumers: 1}},
+	})
+	require_True(t, resp.Error != nil)
+
+	resp = req(accJSEnableReqSubj, &JSAccountEventOptions{})
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error)
+	}
+	require_True(t, acc.JetStreamEnabled())
+	require_True(t, accountInfo().Error == nil)
+
+	limits := JetStreamAccountLimits{MaxMemory: 1024 * 1024, MaxStore: 1024 * 1024, MaxStreams: 2, MaxConsumers: 3, MaxAckPending: -1, MemoryMaxStreamBytes: -1, StoreMaxStreamBytes: -1}
+	resp = req(accJSUpdateReqSubj, &JSAccountEventOptions{Limits: map[string]JetStreamAccountLimits{_EMPTY_: limits}})
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error)
+	}
+	info := accountInfo()
+	require_True(t, info.Error == nil)
+	require_True(t, info.Limits == limits)
+
+	resp = req(accJSDisableReqSubj, &JSAccountEventOptions{})
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error)
+	}
+	require_False(t, acc.JetStreamEnabled())
+
+	// Unknown accounts are an error.
+	b, _ := json.Marshal(&JSAccountEventOptions{})
+	msg, err := snc.Request(fmt.Sprintf(accJSEnableReqSubj, "B"), b, time.Second)
+	require_NoError(t, err)
+	var eresp ServerAPIResponse
+	require_NoError(t, json.Unmarshal(msg.Data, &eresp))
+	require_True(t, eresp.Error != nil)
+
+	// Not available to other accounts.
+	_, err = nc.Request(fmt.Sprintf(accJSEnableReqSubj, "A"), b, 250*time.Millisecond)
+	require_Error(t, err)
+}
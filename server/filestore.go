@@ -55,8 +55,19 @@ type FileStoreConfig struct {
 	SyncInterval time.Duration
 	// AsyncFlush allows async flush to batch write operations.
 	AsyncFlush bool
+	// SyncAlways will sync writes to disk before they are acknowledged.
+	// Concurrent writes are grouped into a single sync.
+	SyncAlways bool
+	// SyncMaxDelay is how long we can wait to group more writes into a single sync with SyncAlways.
+	SyncMaxDelay time.Duration
 	// Cipher is the cipher to use when encrypting.
 	Cipher StoreCipher
+	// Preallocate will reserve disk space for a full block when a block is created, on Linux.
+	Preallocate bool
+	// DropPageCache will keep message blocks out of the page cache as much as possible, on Linux.
+	// Writes are written back right away and cached pages are dropped after syncs and reads.
+	// This is only advice to the kernel, not O_DIRECT, which would need aligned buffers for all I/O.
+	DropPageCache bool
 }
 
 // FileStreamInfo allows us to remember created time.
@@ -103,6 +114,9 @@ type psi struct {
 	total uint64
 	fblk  uint32
 	lblk  uint32
+	// Runs of blocks between fblk and lblk that hold messages of the subject,
+	// only set if these blocks are not contiguous.
+	runs []blkRun
 }
 
 type fileStore struct {
@@ -111,6 +125,8 @@ type fileStore struct {
 	state       StreamState
 	ld          *LostStreamData
 	scb         StorageUpdateHandler
+	rcb         RetentionUpdateHandler
+	head        *memHead
 	ageChk      *time.Timer
 	syncTmr     *time.Timer
 	cfg         FileStreamInfo
@@ -123,11 +139,17 @@ type fileStore struct {
 	psim        map[string]*psi
 	hh          hash.Hash64
 	qch         chan struct{}
+	gcMu        sync.Mutex
+	gcCbs       []func()
+	gcKick      chan struct{}
+	gcQuit      chan struct{}
+	gcIndex     uint32
 	cfs         []ConsumerStore
 	sips        int
 	closed      bool
 	fip         bool
 	receivedAny bool
+	lowIO       int32
 }
 
 // Represents a message store block and its data.
@@ -314,9 +336,9 @@ func newFileStoreWithCreated(fcfg FileStoreConfig, cfg StreamConfig, created tim
 	}
 
 	tmpfile.Close()
-	<-dios
+	dios.acquire(ioBackground)
 	os.Remove(tmpfile.Name())
-	dios <- struct{}{}
+	dios.release(ioBackground)
 
 	fs := &fileStore{
 		fcfg: fcfg,
@@ -329,6 +351,7 @@ func newFileStoreWithCreated(fcfg FileStoreConfig, cfg StreamConfig, created tim
 
 	// Set flush in place to AsyncFlush which by default is false.
 	fs.fip = !fcfg.AsyncFlush
+	fs.setLowIOPriority(cfg.LowIOPriority)
 
 	// Check if this is a new setup.
 	mdir := filepath.Join(fcfg.StoreDir, msgDir)
@@ -352,6 +375,13 @@ func newFileStoreWithCreated(fcfg FileStoreConfig, cfg StreamConfig, created tim
 		return nil, err
 	}
 
+	// Keep our most recent messages in memory if configured.
+	if cfg.MemoryHeadBytes > 0 {
+		fs.mu.Lock()
+		fs.setMemoryHead(cfg.MemoryHeadBytes)
+		fs.mu.Unlock()
+	}
+
 	// Write our meta data if it does not exist or is zero'd out.
 	meta := filepath.Join(fcfg.StoreDir, JetStreamMetaFile)
 	fi, err := os.Stat(meta)
@@ -374,6 +404,15 @@ func newFileStoreWithCreated(fcfg FileStoreConfig, cfg StreamConfig, created tim
 
 	fs.syncTmr = time.AfterFunc(fs.fcfg.SyncInterval, fs.syncBlocks)
 
+	// Group commits if we need to sync all writes.
+	if fcfg.SyncAlways {
+		if fs.lmb != nil {
+			fs.gcIndex = fs.lmb.index
+		}
+		fs.gcKick, fs.gcQuit = make(chan struct{}, 1), make(chan struct{})
+		go fs.groupCommitLoop(fs.gcQuit)
+	}
+
 	return fs, nil
 }
 
@@ -419,10 +458,14 @@ func (fs *fileStore) UpdateConfig(cfg *StreamConfig) error {
 	fs.lockAllMsgBlocks()
 	fs.cfg = new_cfg
 	fs.unlockAllMsgBlocks()
+	fs.setLowIOPriority(cfg.LowIOPriority)
+	fs.setMemoryHead(cfg.MemoryHeadBytes)
 	if err := fs.writeStreamMeta(); err != nil {
 		fs.lockAllMsgBlocks()
 		fs.cfg = old_cfg
 		fs.unlockAllMsgBlocks()
+		fs.setLowIOPriority(old_cfg.LowIOPriority)
+		fs.setMemoryHead(old_cfg.MemoryHeadBytes)
 		fs.mu.Unlock()
 		return err
 	}
@@ -745,7 +788,7 @@ func (fs *fileStore) recoverMsgBlock(fi os.FileInfo, index uint32) (*msgBlock, e
 	var lchk [8]byte
 	if mb.rbytes >= checksumSize {
 		if mb.bek != nil {
-			if buf, _ := mb.loadBlock(nil); len(buf) >= checksumSize {
+			if buf, _ := mb.loadBlock(nil, ioBackground); len(buf) >= checksumSize {
 				mb.bek.XORKeyStream(buf, buf)
 				copy(lchk[0:], buf[len(buf)-checksumSize:])
 			}
@@ -883,7 +926,7 @@ func (mb *msgBlock) convertCipher() error {
 		return err
 	}
 
-	buf, _ := mb.loadBlock(nil)
+	buf, _ := mb.loadBlock(nil, ioBackground)
 	bek.XORKeyStream(buf, buf)
 	// Make sure we can parse with old cipher and key file.
 	if err = mb.indexCacheBuf(buf); err != nil {
@@ -915,7 +958,7 @@ func (mb *msgBlock) convertToEncrypted() error {
 	if mb.bek == nil {
 		return nil
 	}
-	buf, err := mb.loadBlock(nil)
+	buf, err := mb.loadBlock(nil, ioBackground)
 	if err != nil {
 		return err
 	}
@@ -951,7 +994,7 @@ func (mb *msgBlock) rebuildState() (*LostStreamData, error) {
 func (mb *msgBlock) rebuildStateLocked() (*LostStreamData, error) {
 	startLastSeq := mb.last.seq
 
-	buf, err := mb.loadBlock(nil)
+	buf, err := mb.loadBlock(nil, ioBackground)
 	if err != nil || len(buf) == 0 {
 		var ld *LostStreamData
 		// No data to rebuild from here.
@@ -1151,11 +1194,11 @@ func (fs *fileStore) recoverMsgs() error {
 
 	// Check for any left over purged messages.
 	pdir := filepath.Join(fs.fcfg.StoreDir, purgeDir)
-	<-dios
+	dios.acquire(ioBackground)
 	if _, err := os.Stat(pdir); err == nil {
 		os.RemoveAll(pdir)
 	}
-	dios <- struct{}{}
+	dios.release(ioBackground)
 
 	mdir := filepath.Join(fs.fcfg.StoreDir, msgDir)
 	fis, err := os.ReadDir(mdir)
@@ -1242,8 +1285,11 @@ func (fs *fileStore) recoverMsgs() error {
 	fs.enforceBytesLimit()
 
 	// Do age checks too, make sure to call in place.
+	// Pinned messages are skipped one by one when the age timer fires instead.
 	if fs.cfg.MaxAge != 0 {
-		fs.expireMsgsOnRecover()
+		if len(fs.cfg.Pinned) == 0 {
+			fs.expireMsgsOnRecover()
+		}
 		fs.startAgeChk()
 	}
 
@@ -1433,11 +1479,20 @@ func (fs *fileStore) GetSeqFromTime(t time.Time) uint64 {
 
 	var smv StoreMsg
 
-	// Linear search, hence the dumb part..
+	// Binary search since timestamps are always increasing.
+	// Interior deletes are skipped by looking at the next message.
 	ts := t.UnixNano()
-	for seq := fseq; seq <= lseq; seq++ {
-		sm, _, _ := mb.fetchMsg(seq, &smv)
-		if sm != nil && sm.ts >= ts {
+	index := sort.Search(int(lseq-fseq+1), func(i int) bool {
+		for seq := uint64(i) + fseq; seq <= lseq; seq++ {
+			if sm, _, _ := mb.fetchMsg(seq, &smv); sm != nil {
+				return sm.ts >= ts
+			}
+		}
+		return true
+	})
+	// Make sure we return a message that exists.
+	for seq := uint64(index) + fseq; seq <= lseq; seq++ {
+		if sm, _, _ := mb.fetchMsg(seq, &smv); sm != nil {
 			return sm.seq
 		}
 	}
@@ -2067,6 +2122,13 @@ func (fs *fileStore) RegisterStorageUpdates(cb StorageUpdateHandler) {
 	}
 }
 
+// RegisterRetentionUpdates registers a callback for messages removed to honor our limits.
+func (fs *fileStore) RegisterRetentionUpdates(cb RetentionUpdateHandler) {
+	fs.mu.Lock()
+	fs.rcb = cb
+	fs.mu.Unlock()
+}
+
 // Helper to get hash key for specific message block.
 // Lock should be held
 func (fs *fileStore) hashKeyForBlock(index uint32) []byte {
@@ -2145,6 +2207,10 @@ func (fs *fileStore) newMsgBlockForWrite() (*msgBlock, error) {
 		return nil, fmt.Errorf("Error creating msg block file [%q]: %v", mb.mfn, err)
 	}
 	mb.mfd = mfd
+	if fs.fcfg.Preallocate {
+		// Not all filesystems support this, in which case blocks grow as before.
+		preallocate(mfd, int64(fs.fcfg.BlockSize))
+	}
 
 	mb.ifn = filepath.Join(mdir, fmt.Sprintf(indexScan, mb.index))
 	ifd, err := os.OpenFile(mb.ifn, os.O_CREATE|os.O_RDWR, defaultFilePerms)
@@ -2267,11 +2333,9 @@ func (fs *fileStore) storeRawMsg(subj string, hdr, msg []byte, seq uint64, ts in
 		index := fs.lmb.index
 		if info, ok := fs.psim[subj]; ok {
 			info.total++
-			if index > info.lblk {
-				info.lblk = index
-			}
+			info.addBlock(index)
 		} else {
-			fs.psim[subj] = &psi{total: 1, fblk: index, lblk: index}
+			fs.psim[subj] = newPSI(1, index)
 		}
 	}
 
@@ -2286,6 +2350,7 @@ func (fs *fileStore) storeRawMsg(subj string, hdr, msg []byte, seq uint64, ts in
 	fs.state.Bytes += n
 	fs.state.LastSeq = seq
 	fs.state.LastTime = now
+	fs.head.add(seq, subj, hdr, msg, ts)
 
 	// Enforce per message limits.
 	// We snapshotted psmc before our actual write, so >= comparison needed.
@@ -2294,12 +2359,12 @@ func (fs *fileStore) storeRawMsg(subj string, hdr, msg []byte, seq uint64, ts in
 		if fseq == 0 {
 			fseq, _ = fs.firstSeqForSubj(subj)
 		}
-		if ok, _ := fs.removeMsgViaLimits(fseq); ok {
+		if ok, _ := fs.removeMsgViaLimits(fseq, RetentionMaxMsgsPer); ok {
 			// Make sure we are below the limit.
 			if psmc--; psmc >= mmp {
 				for info, ok := fs.psim[subj]; ok && info.total > mmp; info, ok = fs.psim[subj] {
 					if seq, _ := fs.firstSeqForSubj(subj); seq > 0 {
-						if ok, _ := fs.removeMsgViaLimits(seq); !ok {
+						if ok, _ := fs.removeMsgViaLimits(seq, RetentionMaxMsgsPer); !ok {
 							break
 						}
 					} else {
@@ -2349,7 +2414,7 @@ func (fs *fileStore) StoreRawMsg(subj string, hdr, msg []byte, seq uint64, ts in
 // Store stores a message. We hold the main filestore lock for any write operation.
 func (fs *fileStore) StoreMsg(subj string, hdr, msg []byte) (uint64, int64, error) {
 	fs.mu.Lock()
-	seq, ts := fs.state.LastSeq+1, time.Now().UnixNano()
+	seq, ts := fs.state.LastSeq+1, nextMsgTimestamp(time.Now().UnixNano(), fs.state.LastTime)
 	err := fs.storeRawMsg(subj, hdr, msg, seq, ts)
 	cb := fs.scb
 	fs.mu.Unlock()
@@ -2446,13 +2511,14 @@ func (fs *fileStore) firstSeqForSubj(subj string) (uint64, error) {
 
 	// See if we can optimize where we start.
 	start, stop := fs.blks[0].index, fs.lmb.index
-	if info, ok := fs.psim[subj]; ok {
+	info := fs.psim[subj]
+	if info != nil {
 		start, stop = info.fblk, info.lblk
 	}
 
 	for i := start; i <= stop; i++ {
 		mb := fs.bim[i]
-		if mb == nil {
+		if mb == nil || info != nil && !info.hasBlock(i) {
 			continue
 		}
 		mb.mu.Lock()
@@ -2464,10 +2530,8 @@ func (fs *fileStore) firstSeqForSubj(subj string) (uint64, error) {
 		mb.mu.Unlock()
 		if ss != nil {
 			// Adjust first if it was not where we thought it should be.
-			if i != start {
-				if info, ok := fs.psim[subj]; ok {
-					info.fblk = i
-				}
+			if i != start && info != nil {
+				info.setFirstBlock(i)
 			}
 			return ss.First, nil
 		}
@@ -2482,7 +2546,9 @@ func (fs *fileStore) enforceMsgLimit() {
 		return
 	}
 	for nmsgs := fs.state.Msgs; nmsgs > uint64(fs.cfg.MaxMsgs); nmsgs = fs.state.Msgs {
-		if removed, err := fs.deleteFirstMsg(); err != nil || !removed {
+		if removed, err := fs.deleteFirstMsg(RetentionMaxMsgs); err == errOnlyPinnedMsgs {
+			return
+		} else if err != nil || !removed {
 			fs.rebuildFirst()
 			return
 		}
@@ -2496,7 +2562,9 @@ func (fs *fileStore) enforceBytesLimit() {
 		return
 	}
 	for bs := fs.state.Bytes; bs > uint64(fs.cfg.MaxBytes); bs = fs.state.Bytes {
-		if removed, err := fs.deleteFirstMsg(); err != nil || !removed {
+		if removed, err := fs.deleteFirstMsg(RetentionMaxBytes); err == errOnlyPinnedMsgs {
+			return
+		} else if err != nil || !removed {
 			fs.rebuildFirst()
 			return
 		}
@@ -2551,7 +2619,7 @@ func (fs *fileStore) enforceMsgPerSubjectLimit() {
 				m, _, err := mb.firstMatching(subj, false, seq, &sm)
 				if err == nil {
 					seq = m.seq + 1
-					if removed, _ := fs.removeMsgViaLimits(m.seq); removed {
+					if removed, _ := fs.removeMsgViaLimits(m.seq, RetentionMaxMsgsPer); removed {
 						total--
 						blks[mb] = struct{}{}
 					}
@@ -2570,26 +2638,38 @@ func (fs *fileStore) enforceMsgPerSubjectLimit() {
 	}
 }
 
+// Will skip pinned messages, returning errOnlyPinnedMsgs if those are all that is left.
 // Lock should be held.
-func (fs *fileStore) deleteFirstMsg() (bool, error) {
-	return fs.removeMsgViaLimits(fs.state.FirstSeq)
+func (fs *fileStore) deleteFirstMsg(reason RetentionReason) (bool, error) {
+	seq := fs.state.FirstSeq
+	if fs.cfg.isPinned(seq) {
+		var smv StoreMsg
+		sm, _, err := fs.loadNextUnpinnedMsgLocked(seq+1, &smv)
+		if err == ErrStoreEOF {
+			return false, errOnlyPinnedMsgs
+		} else if err != nil {
+			return false, err
+		}
+		seq = sm.seq
+	}
+	return fs.removeMsgViaLimits(seq, reason)
 }
 
 // If we remove via limits that can always be recovered on a restart we
 // do not force the system to update the index file.
 // Lock should be held.
-func (fs *fileStore) removeMsgViaLimits(seq uint64) (bool, error) {
-	return fs.removeMsg(seq, false, true, false)
+func (fs *fileStore) removeMsgViaLimits(seq uint64, reason RetentionReason) (bool, error) {
+	return fs.removeMsg(seq, false, reason, false)
 }
 
 // RemoveMsg will remove the message from this store.
 // Will return the number of bytes removed.
 func (fs *fileStore) RemoveMsg(seq uint64) (bool, error) {
-	return fs.removeMsg(seq, false, false, true)
+	return fs.removeMsg(seq, false, _EMPTY_, true)
 }
 
 func (fs *fileStore) EraseMsg(seq uint64) (bool, error) {
-	return fs.removeMsg(seq, true, false, true)
+	return fs.removeMsg(seq, true, _EMPTY_, true)
 }
 
 // Convenience function to remove per subject tracking at the filestore level.
@@ -2609,7 +2689,9 @@ func (fs *fileStore) removePerSubject(subj string) {
 }
 
 // Remove a message, optionally rewriting the mb file.
-func (fs *fileStore) removeMsg(seq uint64, secure, viaLimits, needFSLock bool) (bool, error) {
+// The reason is set when removed via limits.
+func (fs *fileStore) removeMsg(seq uint64, secure bool, reason RetentionReason, needFSLock bool) (bool, error) {
+	viaLimits := reason != _EMPTY_
 	if seq == 0 {
 		return false, ErrStoreMsgNotFound
 	}
@@ -2714,6 +2796,7 @@ func (fs *fileStore) removeMsg(seq uint64, secure, viaLimits, needFSLock bool) (
 	// If we are tracking multiple subjects here make sure we update that accounting.
 	mb.removeSeqPerSubject(sm.subj, seq, &smv)
 	fs.removePerSubject(sm.subj)
+	fs.head.remove(seq)
 
 	if secure {
 		// Grab record info.
@@ -2771,7 +2854,7 @@ func (fs *fileStore) removeMsg(seq uint64, secure, viaLimits, needFSLock bool) (
 	if shouldWriteIndex {
 		qch, fch = mb.qch, mb.fch
 	}
-	cb := fs.scb
+	cb, rcb := fs.scb, fs.rcb
 
 	if secure {
 		if ld, _ := mb.flushPendingMsgsLocked(); ld != nil {
@@ -2828,6 +2911,13 @@ func (fs *fileStore) removeMsg(seq uint64, secure, viaLimits, needFSLock bool) (
 		delta := int64(msz)
 		cb(-1, -delta, seq, subj)
 	}
+	if viaLimits && rcb != nil {
+		subj := _EMPTY_
+		if sm != nil {
+			subj = sm.subj
+		}
+		rcb(seq, subj, msz, reason)
+	}
 
 	if !needFSLock {
 		fs.mu.Lock()
@@ -2924,11 +3014,13 @@ func (mb *msgBlock) compact() {
 
 	// We will write to a new file and mv/rename it in case of failure.
 	mfn := filepath.Join(filepath.Join(mb.fs.fcfg.StoreDir, msgDir), fmt.Sprintf(newScan, mb.index))
-	if err := os.WriteFile(mfn, nbuf, defaultFilePerms); err != nil {
-		os.Remove(mfn)
-		return
+	dios.acquire(ioBackground)
+	err := os.WriteFile(mfn, nbuf, defaultFilePerms)
+	if err == nil {
+		err = os.Rename(mfn, mb.mfn)
 	}
-	if err := os.Rename(mfn, mb.mfn); err != nil {
+	dios.release(ioBackground)
+	if err != nil {
 		os.Remove(mfn)
 		return
 	}
@@ -3474,9 +3566,9 @@ func (fs *fileStore) expireMsgs() {
 	minAge := time.Now().UnixNano() - maxAge
 	fs.mu.RUnlock()
 
-	for sm, _ = fs.msgForSeq(0, &smv); sm != nil && sm.ts <= minAge; sm, _ = fs.msgForSeq(0, &smv) {
+	for sm = fs.firstUnpinnedMsg(&smv); sm != nil && sm.ts <= minAge; sm = fs.firstUnpinnedMsg(&smv) {
 		fs.mu.Lock()
-		fs.removeMsgViaLimits(sm.seq)
+		fs.removeMsgViaLimits(sm.seq, RetentionMaxAge)
 		fs.mu.Unlock()
 		// Recalculate in case we are expiring a bunch.
 		minAge = time.Now().UnixNano() - maxAge
@@ -3497,6 +3589,22 @@ func (fs *fileStore) expireMsgs() {
 	}
 }
 
+// Returns the first message that is not pinned.
+// Lock should not be held.
+func (fs *fileStore) firstUnpinnedMsg(smv *StoreMsg) *StoreMsg {
+	sm, _ := fs.msgForSeq(0, smv)
+	if sm == nil {
+		return nil
+	}
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	if !fs.cfg.isPinned(sm.seq) {
+		return sm
+	}
+	sm, _, _ = fs.loadNextUnpinnedMsgLocked(sm.seq+1, smv)
+	return sm
+}
+
 // Lock should be held.
 func (fs *fileStore) checkAndFlushAllBlocks() {
 	for _, mb := range fs.blks {
@@ -3819,6 +3927,9 @@ func (fs *fileStore) syncBlocks() {
 		if !mb.closed {
 			if mb.mfd != nil {
 				mb.mfd.Sync()
+				if mb.fs.fcfg.DropPageCache {
+					dropPageCache(mb.mfd)
+				}
 			}
 			if mb.ifd != nil {
 				mb.ifd.Truncate(mb.liwsz)
@@ -3837,6 +3948,113 @@ func (fs *fileStore) syncBlocks() {
 	fs.mu.Unlock()
 }
 
+// afterSync will call cb once everything written so far has been synced to disk.
+// Writes from many publishers are grouped into a single sync.
+func (fs *fileStore) afterSync(cb func()) {
+	fs.gcMu.Lock()
+	fs.gcCbs = append(fs.gcCbs, cb)
+	fs.gcMu.Unlock()
+	select {
+	case fs.gcKick <- struct{}{}:
+	default:
+	}
+}
+
+// Runs in its own Go routine with SyncAlways and syncs groups of writes.
+// Whatever was written while we were syncing will be in the next group.
+func (fs *fileStore) groupCommitLoop(qch chan struct{}) {
+	var delay *time.Timer
+	if d := fs.fcfg.SyncMaxDelay; d > 0 {
+		delay = time.NewTimer(d)
+		delay.Stop()
+		defer delay.Stop()
+	}
+
+	for {
+		select {
+		case <-qch:
+			return
+		case <-fs.gcKick:
+		}
+		// Wait to group more writes if allowed.
+		if delay != nil {
+			delay.Reset(fs.fcfg.SyncMaxDelay)
+			select {
+			case <-qch:
+				return
+			case <-delay.C:
+			}
+		}
+
+		fs.gcMu.Lock()
+		cbs := fs.gcCbs
+		fs.gcCbs = nil
+		fs.gcMu.Unlock()
+
+		// If we could not sync do not call back, e.g. to not ack what may be lost.
+		if len(cbs) == 0 || fs.syncWrites() != nil {
+			continue
+		}
+		for _, cb := range cbs {
+			cb()
+		}
+	}
+}
+
+// syncWrites will sync all blocks written to since the last call.
+// Only called from the group commit loop.
+func (fs *fileStore) syncWrites() error {
+	fs.mu.RLock()
+	if fs.closed || fs.lmb == nil {
+		fs.mu.RUnlock()
+		return ErrStoreClosed
+	}
+	var blks []*msgBlock
+	for _, mb := range fs.blks {
+		if mb.index >= fs.gcIndex {
+			blks = append(blks, mb)
+		}
+	}
+	lindex := fs.lmb.index
+	fs.mu.RUnlock()
+
+	for _, mb := range blks {
+		if mb.pendingWriteSize() > 0 {
+			if err := mb.flushPendingMsgs(); err != nil {
+				return err
+			}
+		}
+		mb.mu.Lock()
+		err := mb.syncLocked()
+		mb.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	fs.gcIndex = lindex
+	return nil
+}
+
+// syncLocked will sync the block's message file, opening it if needed.
+// Lock should be held.
+func (mb *msgBlock) syncLocked() error {
+	if mb.closed {
+		return nil
+	}
+	if mb.mfd != nil {
+		return mb.mfd.Sync()
+	}
+	fd, err := os.OpenFile(mb.mfn, os.O_RDWR, defaultFilePerms)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer fd.Close()
+	return fd.Sync()
+}
+
 // Select the message block where this message should be found.
 // Return nil if not in the set.
 // Read lock should be held.
@@ -4031,7 +4249,10 @@ func (mb *msgBlock) flushPendingMsgsLocked() (*LostStreamData, error) {
 
 	// Append new data to the message block file.
 	for lbb := lob; lbb > 0; lbb = len(buf) {
+		iop := mb.fs.ioPriority(ioInteractive)
+		dios.acquire(iop)
 		n, err := mb.writeAt(buf, woff)
+		dios.release(iop)
 		if err != nil {
 			mb.removePerSubjectInfoLocked()
 			mb.removeIndexFileLocked()
@@ -4050,6 +4271,10 @@ func (mb *msgBlock) flushPendingMsgsLocked() (*LostStreamData, error) {
 			break
 		}
 	}
+	// Write back right away, so the pages can be dropped from the page cache once synced.
+	if mb.fs.fcfg.DropPageCache && mb.mfd != nil {
+		startWriteback(mb.mfd, woff-int64(lob), int64(lob))
+	}
 
 	// Clear any error.
 	mb.werr = nil
@@ -4123,7 +4348,11 @@ func (mb *msgBlock) cacheNotLoaded() bool {
 
 // Used to load in the block contents.
 // Lock should be held and all conditionals satisfied prior.
-func (mb *msgBlock) loadBlock(buf []byte) ([]byte, error) {
+func (mb *msgBlock) loadBlock(buf []byte, p ioPriority) ([]byte, error) {
+	p = mb.fs.ioPriority(p)
+	dios.acquire(p)
+	defer dios.release(p)
+
 	f, err := os.Open(mb.mfn)
 	if err != nil {
 		return nil, err
@@ -4156,6 +4385,10 @@ func (mb *msgBlock) loadBlock(buf []byte) ([]byte, error) {
 	}
 
 	n, err := io.ReadFull(f, buf)
+	// We cache the block ourselves.
+	if mb.fs.fcfg.DropPageCache {
+		dropPageCache(f)
+	}
 	return buf[:n], err
 }
 
@@ -4201,7 +4434,7 @@ checkCache:
 
 	// Load in the whole block.
 	// We want to hold the mb lock here to avoid any changes to state.
-	buf, err := mb.loadBlock(nil)
+	buf, err := mb.loadBlock(nil, ioInteractive)
 	if err != nil {
 		return err
 	}
@@ -4263,20 +4496,21 @@ func (mb *msgBlock) fetchMsg(seq uint64, sm *StoreMsg) (*StoreMsg, bool, error)
 }
 
 var (
-	errNoCache       = errors.New("no message cache")
-	errBadMsg        = errors.New("malformed or corrupt message")
-	errDeletedMsg    = errors.New("deleted message")
-	errPartialCache  = errors.New("partial cache")
-	errNoPending     = errors.New("message block does not have pending data")
-	errNotReadable   = errors.New("storage directory not readable")
-	errCorruptState  = errors.New("corrupt state file")
-	errPendingData   = errors.New("pending data still present")
-	errNoEncryption  = errors.New("encryption not enabled")
-	errBadKeySize    = errors.New("encryption bad key size")
-	errNoMsgBlk      = errors.New("no message block")
-	errMsgBlkTooBig  = errors.New("message block size exceeded int capacity")
-	errUnknownCipher = errors.New("unknown cipher")
-	errDIOStalled    = errors.New("IO is stalled")
+	errNoCache        = errors.New("no message cache")
+	errBadMsg         = errors.New("malformed or corrupt message")
+	errDeletedMsg     = errors.New("deleted message")
+	errPartialCache   = errors.New("partial cache")
+	errNoPending      = errors.New("message block does not have pending data")
+	errNotReadable    = errors.New("storage directory not readable")
+	errCorruptState   = errors.New("corrupt state file")
+	errPendingData    = errors.New("pending data still present")
+	errNoEncryption   = errors.New("encryption not enabled")
+	errBadKeySize     = errors.New("encryption bad key size")
+	errNoMsgBlk       = errors.New("no message block")
+	errMsgBlkTooBig   = errors.New("message block size exceeded int capacity")
+	errUnknownCipher  = errors.New("unknown cipher")
+	errDIOStalled     = errors.New("IO is stalled")
+	errOnlyPinnedMsgs = errors.New("only pinned messages left")
 )
 
 // Used for marking messages that have had their checksums checked.
@@ -4387,6 +4621,10 @@ func (fs *fileStore) msgForSeq(seq uint64, sm *StoreMsg) (*StoreMsg, error) {
 	if seq == 0 {
 		seq = fs.state.FirstSeq
 	}
+	if hsm, ok := fs.head.load(seq, sm); ok {
+		fs.mu.RUnlock()
+		return hsm, nil
+	}
 	// Make sure to snapshot here.
 	mb, lmb, lseq := fs.selectMsgBlock(seq), fs.lmb, fs.state.LastSeq
 	fs.mu.RUnlock()
@@ -4466,11 +4704,13 @@ func (mb *msgBlock) msgFromBuf(buf []byte, sm *StoreMsg, hh hash.Hash64) (*Store
 		hl := le.Uint32(data[slen:])
 		bi := slen + 4
 		li := bi + int(hl)
+		sm.reserve(end - bi)
 		sm.buf = append(sm.buf, data[bi:end]...)
 		li, end = li-bi, end-bi
 		sm.hdr = sm.buf[0:li:li]
 		sm.msg = sm.buf[li:end]
 	} else {
+		sm.reserve(end - slen)
 		sm.buf = append(sm.buf, data[slen:end]...)
 		sm.msg = sm.buf[0 : end-slen]
 	}
@@ -4530,19 +4770,19 @@ func (fs *fileStore) loadLast(subj string, sm *StoreMsg) (lsm *StoreMsg, err err
 
 	start, stop := fs.lmb.index, fs.blks[0].index
 	wc := subjectHasWildcard(subj)
-	// If literal subject check for presence.
-	if !wc {
-		if info := fs.psim[subj]; info == nil {
+	// For literal subjects only walk the blocks that hold it.
+	info, indexed := fs.subjectBlocks(subj)
+	if indexed {
+		if info == nil {
 			return nil, ErrStoreMsgNotFound
-		} else {
-			start, stop = info.lblk, info.fblk
 		}
+		start, stop = info.lblk, info.fblk
 	}
 
 	// Walk blocks backwards.
 	for i := start; i >= stop; i-- {
 		mb := fs.bim[i]
-		if mb == nil {
+		if mb == nil || indexed && !info.hasBlock(i) {
 			continue
 		}
 		mb.mu.Lock()
@@ -4585,13 +4825,38 @@ func (fs *fileStore) LoadLastMsg(subject string, smv *StoreMsg) (sm *StoreMsg, e
 func (fs *fileStore) LoadNextMsg(filter string, wc bool, start uint64, sm *StoreMsg) (*StoreMsg, uint64, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
+	return fs.loadNextMsgLocked(filter, wc, start, sm)
+}
 
+// Will return the next message at or after start that is not pinned.
+// Lock should be held.
+func (fs *fileStore) loadNextUnpinnedMsgLocked(start uint64, sm *StoreMsg) (*StoreMsg, uint64, error) {
+	for {
+		nsm, seq, err := fs.loadNextMsgLocked(fwcs, true, start, sm)
+		if err != nil || !fs.cfg.isPinned(seq) {
+			return nsm, seq, err
+		}
+		start = seq + 1
+	}
+}
+
+// Lock should be held.
+func (fs *fileStore) loadNextMsgLocked(filter string, wc bool, start uint64, sm *StoreMsg) (*StoreMsg, uint64, error) {
 	if fs.closed {
 		return nil, 0, ErrStoreClosed
 	}
 	if start < fs.state.FirstSeq {
 		start = fs.state.FirstSeq
 	}
+	if sm, ok := fs.loadNextFromMemoryHead(filter, wc, start, sm); ok {
+		return sm, sm.seq, nil
+	}
+
+	// For literal subjects we can skip the blocks that do not hold it.
+	info, indexed := fs.subjectBlocks(filter)
+	if indexed && info == nil {
+		return nil, fs.state.LastSeq, ErrStoreEOF
+	}
 
 	// TODO(dlc) - If num blocks gets large maybe use selectMsgBlock but have it return index b/c
 	// we need to keep walking if no match found in first mb.
@@ -4600,6 +4865,14 @@ func (fs *fileStore) LoadNextMsg(filter string, wc bool, start uint64, sm *Store
 		if start > atomic.LoadUint64(&mb.last.seq) {
 			continue
 		}
+		if info != nil {
+			if mb.index > info.lblk {
+				break
+			}
+			if !info.hasBlock(mb.index) {
+				continue
+			}
+		}
 		if sm, expireOk, err := mb.firstMatching(filter, wc, start, sm); err == nil {
 			if expireOk && mb != fs.lmb {
 				mb.tryForceExpireCache()
@@ -5068,6 +5341,7 @@ func (fs *fileStore) PurgeEx(subject string, sequence, keep uint64) (purged uint
 					mb.bytes -= rl
 					purged++
 					bytes += rl
+					fs.head.remove(seq)
 				}
 				// FSS updates.
 				mb.removeSeqPerSubject(sm.subj, seq, &smv)
@@ -5146,6 +5420,7 @@ func (fs *fileStore) purge(fseq uint64) (uint64, error) {
 
 	fs.state.Bytes = 0
 	fs.state.Msgs = 0
+	fs.head.purge()
 
 	for _, mb := range fs.blks {
 		mb.dirtyClose()
@@ -5359,6 +5634,7 @@ SKIP:
 	// Update top level accounting.
 	fs.state.Msgs -= purged
 	fs.state.Bytes -= bytes
+	fs.head.compact(seq)
 
 	cb := fs.scb
 	fs.mu.Unlock()
@@ -5401,6 +5677,7 @@ func (fs *fileStore) reset() error {
 	// Update msgs and bytes.
 	fs.state.Msgs = 0
 	fs.state.Bytes = 0
+	fs.head.purge()
 
 	// Reset blocks.
 	fs.blks, fs.lmb = nil, nil
@@ -5481,6 +5758,7 @@ func (fs *fileStore) Truncate(seq uint64) error {
 	// Update msgs and bytes.
 	fs.state.Msgs -= purged
 	fs.state.Bytes -= bytes
+	fs.head.truncate(seq)
 
 	// Reset our subject lookup info.
 	fs.resetGlobalPerSubjectInfo()
@@ -5846,11 +6124,9 @@ func (fs *fileStore) populateGlobalPerSubjectInfo(mb *msgBlock) {
 		if len(subj) > 0 {
 			if info, ok := fs.psim[subj]; ok {
 				info.total += ss.Msgs
-				if mb.index > info.lblk {
-					info.lblk = mb.index
-				}
+				info.addBlock(mb.index)
 			} else {
-				fs.psim[subj] = &psi{total: ss.Msgs, fblk: mb.index, lblk: mb.index}
+				fs.psim[subj] = newPSI(ss.Msgs, mb.index)
 			}
 		}
 	}
@@ -5946,14 +6222,13 @@ func (mb *msgBlock) writePerSubjectInfo() error {
 	// Since we have the lock we would rather fail here then block.
 	// This is an optional structure that can be rebuilt on restart.
 	var err error
-	select {
-	case <-dios:
+	if dios.tryAcquire() {
 		if err = os.WriteFile(mb.sfn, b.Bytes(), defaultFilePerms); err == nil {
 			// Clear write flag if no error.
 			mb.fssNeedsWrite = false
 		}
-		dios <- struct{}{}
-	default:
+		dios.release(ioBackground)
+	} else {
 		err = errDIOStalled
 	}
 
@@ -6069,6 +6344,11 @@ func (fs *fileStore) Stop() error {
 	fs.cancelSyncTimer()
 	fs.cancelAgeChk()
 
+	if fs.gcQuit != nil {
+		close(fs.gcQuit)
+		fs.gcQuit = nil
+	}
+
 	var _cfs [256]ConsumerStore
 	cfs := append(_cfs[:0], fs.cfs...)
 	fs.cfs = nil
@@ -6146,6 +6426,13 @@ func (fs *fileStore) streamSnapshot(w io.WriteCloser, state *StreamState, includ
 	if writeFile(JetStreamMetaFileSum, sum) != nil {
 		return
 	}
+	// Resume tokens of our upstream streams if we are a mirror or have sources.
+	// If not there that is ok and not fatal.
+	if buf, err := os.ReadFile(filepath.Join(fs.fcfg.StoreDir, streamResumeFile)); err == nil {
+		if writeFile(streamResumeFile, buf) != nil {
+			return
+		}
+	}
 
 	// Can't use join path here, tar only recognizes relative paths with forward slashes.
 	msgPre := msgDir + "/"
@@ -6161,7 +6448,9 @@ func (fs *fileStore) streamSnapshot(w io.WriteCloser, state *StreamState, includ
 			mb.writeIndexInfo()
 		}
 		mb.mu.Lock()
+		dios.acquire(ioBackground)
 		buf, err := os.ReadFile(mb.ifn)
+		dios.release(ioBackground)
 		if err != nil {
 			mb.mu.Unlock()
 			writeErr(fmt.Sprintf("Could not read message block [%d] index file: %v", mb.index, err))
@@ -6182,7 +6471,7 @@ func (fs *fileStore) streamSnapshot(w io.WriteCloser, state *StreamState, includ
 		}
 		// We could stream but don't want to hold the lock and prevent changes, so just read in and
 		// release the lock for now.
-		bbuf, err = mb.loadBlock(bbuf)
+		bbuf, err = mb.loadBlock(bbuf, ioBackground)
 		if err != nil {
 			mb.mu.Unlock()
 			writeErr(fmt.Sprintf("Could not read message block [%d]: %v", mb.index, err))
@@ -6200,7 +6489,9 @@ func (fs *fileStore) streamSnapshot(w io.WriteCloser, state *StreamState, includ
 		}
 		// Make sure we snapshot the per subject info.
 		mb.writePerSubjectInfo()
+		dios.acquire(ioBackground)
 		buf, err = os.ReadFile(mb.sfn)
+		dios.release(ioBackground)
 		// If not there that is ok and not fatal.
 		if err == nil && writeFile(msgPre+fmt.Sprintf(fssScan, mb.index), buf) != nil {
 			mb.mu.Unlock()
@@ -6686,19 +6977,20 @@ func (o *consumerFileStore) UpdateAcks(dseq, sseq uint64) error {
 		return ErrNoAckPolicy
 	}
 
-	// On restarts the old leader may get a replay from the raft logs that are old.
-	if dseq <= o.state.AckFloor.Consumer {
-		return nil
-	}
-
-	if len(o.state.Pending) == 0 || o.state.Pending[sseq] == nil {
-		return ErrStoreMsgNotFound
-	}
-
 	// Check for AckAll here.
+	// The stream sequence decides if the floor advances, see advanceAckAllFloor.
 	if o.cfg.AckPolicy == AckAll {
+		// On restarts the old leader may get a replay from the raft logs that are old.
+		if sseq <= o.state.AckFloor.Stream {
+			return nil
+		}
+		if len(o.state.Pending) == 0 || o.state.Pending[sseq] == nil {
+			return ErrStoreMsgNotFound
+		}
 		sgap := sseq - o.state.AckFloor.Stream
-		o.state.AckFloor.Consumer = dseq
+		if dseq > o.state.AckFloor.Consumer {
+			o.state.AckFloor.Consumer = dseq
+		}
 		o.state.AckFloor.Stream = sseq
 		for seq := sseq; seq > sseq-sgap; seq-- {
 			delete(o.state.Pending, seq)
@@ -6712,6 +7004,15 @@ func (o *consumerFileStore) UpdateAcks(dseq, sseq uint64) error {
 
 	// AckExplicit
 
+	// On restarts the old leader may get a replay from the raft logs that are old.
+	if dseq <= o.state.AckFloor.Consumer {
+		return nil
+	}
+
+	if len(o.state.Pending) == 0 || o.state.Pending[sseq] == nil {
+		return ErrStoreMsgNotFound
+	}
+
 	// First delete from our pending state.
 	if p, ok := o.state.Pending[sseq]; ok {
 		delete(o.state.Pending, sseq)
@@ -6777,11 +7078,20 @@ func (o *consumerFileStore) UpdateConfig(cfg *ConsumerConfig) error {
 }
 
 func (o *consumerFileStore) Update(state *ConsumerState) error {
+	return o.update(state, false)
+}
+
+// Reset will replace our state, also when it goes back, e.g. when a durable was moved.
+func (o *consumerFileStore) Reset(state *ConsumerState) error {
+	return o.update(state, true)
+}
+
+func (o *consumerFileStore) update(state *ConsumerState, reset bool) error {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
 	// Check to see if this is an outdated update.
-	if state.Delivered.Consumer < o.state.Delivered.Consumer || state.AckFloor.Stream < o.state.AckFloor.Stream {
+	if !reset && (state.Delivered.Consumer < o.state.Delivered.Consumer || state.AckFloor.Stream < o.state.AckFloor.Stream) {
 		return nil
 	}
 
@@ -6834,22 +7144,6 @@ func (o *consumerFileStore) encryptState(buf []byte) []byte {
 	return o.aek.Seal(nonce, nonce, buf, nil)
 }
 
-// Used to limit number of disk IO calls in flight since they could all be blocking an OS thread.
-// https://github.com/nats-io/nats-server/issues/2742
-var dios chan struct{}
-
-// Used to setup our simplistic counting semaphore using buffered channels.
-// golang.org's semaphore seemed a bit heavy.
-func init() {
-	// Limit ourselves to a max of 4 blocking IO calls.
-	const nIO = 4
-	dios = make(chan struct{}, nIO)
-	// Fill it up to start.
-	for i := 0; i < nIO; i++ {
-		dios <- struct{}{}
-	}
-}
-
 func (o *consumerFileStore) writeState(buf []byte) error {
 	// Check if we have the index file open.
 	o.mu.Lock()
@@ -6869,9 +7163,9 @@ func (o *consumerFileStore) writeState(buf []byte) error {
 	o.mu.Unlock()
 
 	// Lock not held here but we do limit number of outstanding calls that could block OS threads.
-	<-dios
+	dios.acquire(ioBackground)
 	err := os.WriteFile(ifn, buf, defaultFilePerms)
-	dios <- struct{}{}
+	dios.release(ioBackground)
 
 	o.mu.Lock()
 	if err != nil {
@@ -7212,9 +7506,9 @@ func (o *consumerFileStore) Stop() error {
 
 	if len(buf) > 0 {
 		o.waitOnFlusher()
-		<-dios
+		dios.acquire(ioBackground)
 		err = os.WriteFile(ifn, buf, defaultFilePerms)
-		dios <- struct{}{}
+		dios.release(ioBackground)
 	}
 	return err
 }
@@ -7262,9 +7556,9 @@ func (o *consumerFileStore) delete(streamDeleted bool) error {
 
 	// If our stream was not deleted this will remove the directories.
 	if odir != _EMPTY_ && !streamDeleted {
-		<-dios
+		dios.acquire(ioBackground)
 		err = os.RemoveAll(odir)
-		dios <- struct{}{}
+		dios.release(ioBackground)
 	}
 
 	if !streamDeleted {
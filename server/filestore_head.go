@@ -0,0 +1,299 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// memHead keeps the most recent messages of a file store in memory, up to a number of bytes,
+// so real-time consumers and direct gets are served without touching the message blocks.
+// The message blocks stay the source of truth, every message in the head is also on disk.
+// It has its own lock, the file store lock is held when it changes, so it is always taken after.
+type memHead struct {
+	mu    sync.RWMutex
+	max   uint64
+	bytes uint64
+	msgs  map[uint64]*StoreMsg
+	// Sequences in the order stored, oldest first. Can hold sequences removed since.
+	seqs []uint64
+}
+
+// Most bytes a stream can keep in its memory head.
+const maxMemoryHeadBytes = 1024 * 1024 * 1024
+
+func newMemHead(max int64) *memHead {
+	return &memHead{max: uint64(max), msgs: make(map[uint64]*StoreMsg)}
+}
+
+// Check the memory head of a stream config.
+func checkStreamMemoryHead(cfg *StreamConfig) error {
+	if cfg.MemoryHeadBytes < 0 {
+		return errors.New("memory head bytes can not be negative")
+	}
+	if cfg.MemoryHeadBytes > maxMemoryHeadBytes {
+		return fmt.Errorf("memory head bytes can not exceed %s", friendlyBytes(maxMemoryHeadBytes))
+	}
+	if cfg.Storage != FileStorage {
+		return errors.New("memory head requires file storage")
+	}
+	return nil
+}
+
+// The memory head is reserved against the memory limits of the account and the server,
+// like the max bytes of a memory stream.
+
+// memoryHeadConfig returns the config to select the memory reserved by other streams
+// with, when checking the memory head of cfg.
+func memoryHeadConfig(cfg *StreamConfig) *StreamConfig {
+	mcfg := *cfg
+	mcfg.Storage = MemoryStorage
+	return &mcfg
+}
+
+// memoryHeadReservation returns the memory reserved by the memory head of sa when
+// selecting the reservations of other streams for cfg.
+func memoryHeadReservation(sa, cfg *StreamConfig) int64 {
+	if cfg.Storage != MemoryStorage || sa.MemoryHeadBytes <= 0 || sa.Name == cfg.Name {
+		return 0
+	}
+	return int64(sa.Replicas) * sa.MemoryHeadBytes
+}
+
+// checkMemoryHeadLimits will check if the memory head of a stream exceeds our account limits,
+// and optionally those of the server. For updates old is the config the stream has now.
+// Read Lock should be held.
+func (js *jetStream) checkMemoryHeadLimits(selected *JetStreamAccountLimits, cfg, old *StreamConfig, checkServer bool, currentRes int64) error {
+	head := cfg.MemoryHeadBytes
+	if old != nil {
+		// Reservations do not account for this stream.
+		currentRes += int64(old.Replicas) * old.MemoryHeadBytes
+		head -= old.MemoryHeadBytes
+	}
+	if head <= 0 {
+		return nil
+	}
+	return js.checkBytesLimits(selected, head, MemoryStorage, cfg.Replicas, checkServer, currentRes, 0)
+}
+
+// add will add a message just stored, evicting the oldest messages to stay within our limit.
+func (h *memHead) add(seq uint64, subj string, hdr, msg []byte, ts int64) {
+	if h == nil {
+		return
+	}
+	sz := fileStoreMsgSize(subj, hdr, msg)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if sz > h.max {
+		return
+	}
+	// Copy since the caller may reuse its buffers.
+	buf := make([]byte, 0, len(hdr)+len(msg))
+	buf = append(append(buf, hdr...), msg...)
+	h.msgs[seq] = &StoreMsg{
+		subj: strings.Clone(subj),
+		hdr:  buf[:len(hdr):len(hdr)],
+		msg:  buf[len(hdr):],
+		buf:  buf,
+		seq:  seq,
+		ts:   ts,
+	}
+	h.seqs = append(h.seqs, seq)
+	h.bytes += sz
+	h.evict()
+}
+
+// evict will drop the oldest messages until we are within our limit.
+// Lock should be held.
+func (h *memHead) evict() {
+	for h.bytes > h.max && len(h.seqs) > 0 {
+		h.drop(h.seqs[0])
+		h.seqs = h.seqs[1:]
+	}
+}
+
+// drop will remove a message from our map and accounting.
+// Lock should be held.
+func (h *memHead) drop(seq uint64) {
+	if sm := h.msgs[seq]; sm != nil {
+		h.bytes -= fileStoreMsgSize(sm.subj, sm.hdr, sm.msg)
+		delete(h.msgs, seq)
+	}
+}
+
+// load will copy the message into sm if we hold it.
+func (h *memHead) load(seq uint64, sm *StoreMsg) (*StoreMsg, bool) {
+	if h == nil {
+		return nil, false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	hsm := h.msgs[seq]
+	if hsm == nil {
+		return nil, false
+	}
+	if sm == nil {
+		sm = new(StoreMsg)
+	}
+	hsm.copy(sm)
+	return sm, true
+}
+
+// remove will drop a message removed from the store.
+func (h *memHead) remove(seq uint64) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.msgs[seq]; !ok {
+		return
+	}
+	h.drop(seq)
+	// Removals are mostly in order, e.g. for work queues, trim those from the front.
+	for len(h.seqs) > 0 && h.msgs[h.seqs[0]] == nil {
+		h.seqs = h.seqs[1:]
+	}
+	// Otherwise do not let removed sequences build up.
+	if len(h.seqs) > 2*len(h.msgs)+64 {
+		h.rebuild()
+	}
+}
+
+// removeIf will drop all messages with a sequence that matches.
+func (h *memHead) removeIf(match func(seq uint64) bool) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for seq := range h.msgs {
+		if match(seq) {
+			h.drop(seq)
+		}
+	}
+	h.rebuild()
+}
+
+// purge will drop all messages.
+func (h *memHead) purge() {
+	h.removeIf(func(uint64) bool { return true })
+}
+
+// compact will drop all messages below seq.
+func (h *memHead) compact(seq uint64) {
+	h.removeIf(func(hseq uint64) bool { return hseq < seq })
+}
+
+// truncate will drop all messages above seq.
+func (h *memHead) truncate(seq uint64) {
+	h.removeIf(func(hseq uint64) bool { return hseq > seq })
+}
+
+// rebuild will drop removed sequences from our order.
+// Lock should be held.
+func (h *memHead) rebuild() {
+	seqs := make([]uint64, 0, len(h.msgs))
+	for _, seq := range h.seqs {
+		if h.msgs[seq] != nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	h.seqs = seqs
+}
+
+// setMax will update our limit, evicting if needed.
+func (h *memHead) setMax(max int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.max = uint64(max)
+	h.evict()
+}
+
+// size returns the number of messages and bytes we hold.
+func (h *memHead) size() (msgs int, bytes uint64) {
+	if h == nil {
+		return 0, 0
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.msgs), h.bytes
+}
+
+// setMemoryHead will create, resize or remove our memory head to match our config.
+// A new head is filled with our most recent messages.
+// Lock should be held.
+func (fs *fileStore) setMemoryHead(max int64) {
+	switch {
+	case max <= 0:
+		fs.head = nil
+	case fs.head != nil:
+		fs.head.setMax(max)
+	default:
+		fs.head = newMemHead(max)
+		fs.warmMemoryHead()
+	}
+}
+
+// warmMemoryHead will fill our memory head with our most recent messages.
+// Lock should be held.
+func (fs *fileStore) warmMemoryHead() {
+	h := fs.head
+	if h == nil || fs.state.Msgs == 0 {
+		return
+	}
+	// Walk back from our last message until we would go over the limit.
+	var msgs []*StoreMsg
+	var bytes uint64
+	for i := len(fs.blks) - 1; i >= 0 && bytes < h.max; i-- {
+		mb := fs.blks[i]
+		mb.mu.RLock()
+		first, last := mb.first.seq, mb.last.seq
+		mb.mu.RUnlock()
+		for seq := last; seq >= first && seq > 0; seq-- {
+			sm, _, err := mb.fetchMsg(seq, nil)
+			if err != nil || sm == nil {
+				continue
+			}
+			if bytes += fileStoreMsgSize(sm.subj, sm.hdr, sm.msg); bytes > h.max {
+				break
+			}
+			msgs = append(msgs, sm)
+		}
+		if mb != fs.lmb {
+			mb.tryForceExpireCache()
+		}
+	}
+	for i := len(msgs) - 1; i >= 0; i-- {
+		sm := msgs[i]
+		h.add(sm.seq, sm.subj, sm.hdr, sm.msg, sm.ts)
+	}
+}
+
+// loadNextFromMemoryHead returns the message at start if we hold it in our memory head and it
+// matches the filter. Real-time consumers are right behind the last message, so this is their
+// common case, anything else is served by the message blocks.
+func (fs *fileStore) loadNextFromMemoryHead(filter string, wc bool, start uint64, sm *StoreMsg) (*StoreMsg, bool) {
+	hsm, ok := fs.head.load(start, sm)
+	if !ok {
+		return nil, false
+	}
+	if filter == _EMPTY_ || filter == fwcs || (wc && subjectIsSubsetMatch(hsm.subj, filter)) || (!wc && hsm.subj == filter) {
+		return hsm, true
+	}
+	return nil, false
+}
@@ -0,0 +1,302 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/minio/highwayhash"
+)
+
+// InspectedMsg is a message read from the files of a stream.
+type InspectedMsg struct {
+	Sequence uint64    `json:"seq"`
+	Subject  string    `json:"subject"`
+	Time     time.Time `json:"time"`
+	Header   []byte    `json:"hdrs,omitempty"`
+	Data     []byte    `json:"data,omitempty"`
+}
+
+// InspectedBlock is the result of verifying a message block of a stream.
+type InspectedBlock struct {
+	Index uint32 `json:"index"`
+	First uint64 `json:"first_seq"`
+	Last  uint64 `json:"last_seq"`
+	Msgs  uint64 `json:"msgs"`
+	// Messages that are removed but not erased yet, known from the index file.
+	Deleted uint64 `json:"deleted"`
+	// Messages with a checksum mismatch.
+	Corrupt uint64 `json:"corrupt"`
+	// Set when the block could not be read completely.
+	Error string `json:"error,omitempty"`
+}
+
+// InspectedConsumer is the meta data and state of a consumer read from the files of a stream.
+type InspectedConsumer struct {
+	Name    string          `json:"name"`
+	Created time.Time       `json:"created"`
+	Config  *ConsumerConfig `json:"config,omitempty"`
+	State   *ConsumerState  `json:"state,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// StoreInspector reads the files of a stream in a store directory without changing them,
+// e.g. to recover data when the server can not start. Encrypted stores are not supported.
+type StoreInspector struct {
+	dir string
+	cfg FileStreamInfo
+	// Used to reuse the record decoding of a message block.
+	mb *msgBlock
+}
+
+// NewStoreInspector opens the stream stored in dir for inspection.
+func NewStoreInspector(dir string) (*StoreInspector, error) {
+	if _, err := os.Stat(filepath.Join(dir, JetStreamMetaFileKey)); err == nil {
+		return nil, errors.New("encrypted stores can not be inspected offline")
+	}
+	buf, err := os.ReadFile(filepath.Join(dir, JetStreamMetaFile))
+	if err != nil {
+		return nil, err
+	}
+	si := &StoreInspector{dir: dir}
+	if err := json.Unmarshal(buf, &si.cfg); err != nil {
+		return nil, fmt.Errorf("could not decode stream meta data: %v", err)
+	}
+	si.mb = &msgBlock{fs: &fileStore{cfg: si.cfg}}
+	return si, nil
+}
+
+// Config returns the stream meta data of the inspected store.
+func (si *StoreInspector) Config() *FileStreamInfo {
+	return &si.cfg
+}
+
+// blocks returns the indexes of the message blocks in order.
+func (si *StoreInspector) blocks() ([]uint32, error) {
+	fis, err := os.ReadDir(filepath.Join(si.dir, msgDir))
+	if err != nil {
+		return nil, err
+	}
+	var indexes []uint32
+	for _, fi := range fis {
+		var index uint32
+		if n, err := fmt.Sscanf(fi.Name(), blkScan, &index); err == nil && n == 1 {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	return indexes, nil
+}
+
+// readIndex returns the first sequence and deleted messages of a block from its index file.
+// The index file is optional, without it all messages in the block are assumed to be present.
+func (si *StoreInspector) readIndex(index uint32) (uint64, map[uint64]struct{}) {
+	buf, err := os.ReadFile(filepath.Join(si.dir, msgDir, fmt.Sprintf(indexScan, index)))
+	if err != nil || checkHeader(buf) != nil {
+		return 0, nil
+	}
+	bi := hdrLen
+	read := func() uint64 {
+		if bi < 0 || bi >= len(buf) {
+			bi = -1
+			return 0
+		}
+		v, n := binary.Uvarint(buf[bi:])
+		if n <= 0 {
+			bi = -1
+			return 0
+		}
+		bi += n
+		return v
+	}
+	// Msgs and bytes, first seq and ts, last seq and ts. Timestamps are signed, but encode to the same length.
+	read()
+	read()
+	first := read() &^ ebit
+	read()
+	read()
+	read()
+	dmapLen := read()
+	if bi < 0 || bi+checksumSize > len(buf) {
+		return 0, nil
+	}
+	bi += checksumSize
+	var dmap map[uint64]struct{}
+	for i := uint64(0); i < dmapLen; i++ {
+		seq := read()
+		if bi < 0 || seq == 0 {
+			break
+		}
+		if dmap == nil {
+			dmap = make(map[uint64]struct{}, dmapLen)
+		}
+		dmap[seq+first] = struct{}{}
+	}
+	return first, dmap
+}
+
+// walkBlock reads all records of a message block, checking their checksums, and calls cb for each message.
+func (si *StoreInspector) walkBlock(index uint32, cb func(im *InspectedMsg) error) (*InspectedBlock, error) {
+	ib := &InspectedBlock{Index: index}
+	buf, err := os.ReadFile(filepath.Join(si.dir, msgDir, fmt.Sprintf(blkScan, index)))
+	if err != nil {
+		ib.Error = err.Error()
+		return ib, nil
+	}
+	first, dmap := si.readIndex(index)
+	key := sha256.Sum256(si.mb.fs.hashKeyForBlock(index))
+	hh, err := highwayhash.New64(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var le = binary.LittleEndian
+	var sm StoreMsg
+	for ri, lbuf := uint32(0), uint32(len(buf)); ri < lbuf; {
+		if ri+msgHdrSize > lbuf {
+			ib.Error = fmt.Sprintf("short record at offset %d", ri)
+			break
+		}
+		rl := le.Uint32(buf[ri:]) &^ hbit
+		if rl < msgHdrSize+checksumSize || rl > rlBadThresh || ri+rl > lbuf {
+			ib.Error = fmt.Sprintf("bad record at offset %d", ri)
+			break
+		}
+		rec := buf[ri : ri+rl]
+		ri += rl
+
+		seq := le.Uint64(rec[4:])
+		if seq == 0 || seq&ebit != 0 || seq < first {
+			continue
+		}
+		if _, ok := dmap[seq]; ok {
+			ib.Deleted++
+			continue
+		}
+		if ib.First == 0 {
+			ib.First = seq
+		}
+		ib.Last = seq
+		if _, err := si.mb.msgFromBuf(rec, &sm, hh); err != nil {
+			ib.Corrupt++
+			continue
+		}
+		ib.Msgs++
+		if cb != nil {
+			im := &InspectedMsg{Sequence: sm.seq, Subject: sm.subj, Time: time.Unix(0, sm.ts).UTC()}
+			if len(sm.hdr) > 0 {
+				im.Header = copyBytes(sm.hdr)
+			}
+			if len(sm.msg) > 0 {
+				im.Data = copyBytes(sm.msg)
+			}
+			if err := cb(im); err != nil {
+				return ib, err
+			}
+		}
+	}
+	return ib, nil
+}
+
+// Verify checks all message blocks of the stream.
+func (si *StoreInspector) Verify() ([]*InspectedBlock, error) {
+	indexes, err := si.blocks()
+	if err != nil {
+		return nil, err
+	}
+	ibs := make([]*InspectedBlock, 0, len(indexes))
+	for _, index := range indexes {
+		ib, err := si.walkBlock(index, nil)
+		if err != nil {
+			return nil, err
+		}
+		ibs = append(ibs, ib)
+	}
+	return ibs, nil
+}
+
+// errInspectDone is used to stop walking the blocks once we are past the last sequence.
+var errInspectDone = errors.New("inspect done")
+
+// Dump calls cb for all messages with a sequence from first up to and including last, zero means no limit.
+func (si *StoreInspector) Dump(first, last uint64, cb func(im *InspectedMsg) error) error {
+	indexes, err := si.blocks()
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		_, err := si.walkBlock(index, func(im *InspectedMsg) error {
+			if last > 0 && im.Sequence > last {
+				return errInspectDone
+			}
+			if im.Sequence < first {
+				return nil
+			}
+			return cb(im)
+		})
+		if err == errInspectDone {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Consumers reads the meta data and state of all consumers of the stream.
+func (si *StoreInspector) Consumers() ([]*InspectedConsumer, error) {
+	odir := filepath.Join(si.dir, consumerDir)
+	fis, err := os.ReadDir(odir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var ics []*InspectedConsumer
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		ic := &InspectedConsumer{Name: fi.Name()}
+		ics = append(ics, ic)
+		buf, err := os.ReadFile(filepath.Join(odir, fi.Name(), JetStreamMetaFile))
+		if err != nil {
+			ic.Error = err.Error()
+			continue
+		}
+		var cfg FileConsumerInfo
+		if err := json.Unmarshal(buf, &cfg); err != nil {
+			ic.Error = fmt.Sprintf("could not decode consumer meta data: %v", err)
+			continue
+		}
+		ic.Created, ic.Config = cfg.Created, &cfg.ConsumerConfig
+		if cfg.Name != _EMPTY_ {
+			ic.Name = cfg.Name
+		}
+		if buf, err := os.ReadFile(filepath.Join(odir, fi.Name(), consumerState)); err == nil {
+			if ic.State, err = decodeConsumerState(buf); err != nil {
+				ic.Error = fmt.Sprintf("could not decode consumer state: %v", err)
+			}
+		}
+	}
+	return ics, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ioPriority is the priority of disk IO, see diskIOScheduler.
+type ioPriority int
+
+const (
+	// Work a client is waiting on, e.g. writing messages before the pub ack or loading messages for delivery.
+	ioInteractive ioPriority = iota
+	// Maintenance work, e.g. compaction, snapshots and writing state files.
+	ioBackground
+)
+
+const (
+	// Limit ourselves to a max of 4 blocking background IO calls.
+	diskIOBackgroundSlots = 4
+	// Default number of interactive IO calls that complete before waiting background work goes ahead.
+	defaultDiskIOWeight = 4
+)
+
+// diskIOScheduler gives interactive disk IO priority over background IO.
+// Interactive IO never waits, it is tracked so background IO only starts when there is none in flight,
+// or after weight interactive calls completed while it was waiting, so it is not starved.
+// Background IO is also limited in the number of calls in flight since they could all be blocking an OS thread.
+// https://github.com/nats-io/nats-server/issues/2742
+type diskIOScheduler struct {
+	mu      sync.Mutex
+	avail   int
+	active  int
+	passed  int
+	weight  int
+	waiting []chan struct{}
+}
+
+func newDiskIOScheduler(slots, weight int) *diskIOScheduler {
+	return &diskIOScheduler{avail: slots, weight: weight}
+}
+
+// setWeight sets the number of interactive calls that complete before waiting background work goes ahead.
+func (d *diskIOScheduler) setWeight(weight int) {
+	if weight <= 0 {
+		weight = defaultDiskIOWeight
+	}
+	d.mu.Lock()
+	d.weight = weight
+	d.grant()
+	d.mu.Unlock()
+}
+
+// acquire is called before disk IO with the given priority, background IO may have to wait.
+// Every call needs to be paired with release of the same priority.
+func (d *diskIOScheduler) acquire(p ioPriority) {
+	d.mu.Lock()
+	if p == ioInteractive {
+		d.active++
+		d.mu.Unlock()
+		return
+	}
+	if len(d.waiting) == 0 && d.canGrant() {
+		d.avail--
+		d.mu.Unlock()
+		return
+	}
+	ch := make(chan struct{})
+	d.waiting = append(d.waiting, ch)
+	d.mu.Unlock()
+	<-ch
+}
+
+// tryAcquire is for background IO done while holding locks, where we would rather fail than wait.
+func (d *diskIOScheduler) tryAcquire() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.waiting) == 0 && d.canGrant() {
+		d.avail--
+		return true
+	}
+	return false
+}
+
+// release is called when disk IO of the given priority is done.
+func (d *diskIOScheduler) release(p ioPriority) {
+	d.mu.Lock()
+	if p == ioInteractive {
+		d.active--
+		if len(d.waiting) > 0 {
+			d.passed++
+		}
+	} else {
+		d.avail++
+	}
+	d.grant()
+	d.mu.Unlock()
+}
+
+// Lock should be held.
+func (d *diskIOScheduler) canGrant() bool {
+	return d.avail > 0 && (d.active == 0 || d.passed >= d.weight)
+}
+
+// Let waiting background IO go ahead in order if we can.
+// Lock should be held.
+func (d *diskIOScheduler) grant() {
+	for len(d.waiting) > 0 && d.canGrant() {
+		ch := d.waiting[0]
+		d.waiting[0] = nil
+		d.waiting = d.waiting[1:]
+		d.avail--
+		d.passed = 0
+		close(ch)
+	}
+}
+
+// Used to schedule disk IO calls of all stores.
+var dios = newDiskIOScheduler(diskIOBackgroundSlots, defaultDiskIOWeight)
+
+// ioPriority returns the priority for IO of this store, streams with a low IO priority only do background IO.
+func (fs *fileStore) ioPriority(p ioPriority) ioPriority {
+	if atomic.LoadInt32(&fs.lowIO) == 1 {
+		return ioBackground
+	}
+	return p
+}
+
+// Sets if all our IO is background IO.
+func (fs *fileStore) setLowIOPriority(low bool) {
+	var v int32
+	if low {
+		v = 1
+	}
+	atomic.StoreInt32(&fs.lowIO, v)
+}
@@ -0,0 +1,27 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package server
+
+import "os"
+
+// Preallocation and page cache control are only supported on Linux.
+
+func preallocate(f *os.File, size int64) error { return nil }
+
+func startWriteback(f *os.File, off, n int64) error { return nil }
+
+func dropPageCache(f *os.File) error { return nil }
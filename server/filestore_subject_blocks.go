@@ -0,0 +1,107 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "sort"
+
+// blkRun is a run of consecutive blocks, by index, that hold messages of a subject.
+type blkRun struct {
+	first uint32
+	last  uint32
+}
+
+func newPSI(total uint64, index uint32) *psi {
+	return &psi{total: total, fblk: index, lblk: index}
+}
+
+// addBlock will record that the block with the given index holds messages of our subject.
+// Blocks are usually added in order of their index, but not when recovering, since block
+// files are read in the order of their names.
+func (info *psi) addBlock(index uint32) {
+	if info.hasBlock(index) {
+		return
+	}
+	// Contiguous blocks do not need runs.
+	if info.runs == nil && index == info.lblk+1 {
+		info.lblk = index
+		return
+	}
+	runs := info.runs
+	if runs == nil {
+		runs = []blkRun{{info.fblk, info.lblk}}
+	}
+	// The first run past index, we know index is not in it.
+	i := sort.Search(len(runs), func(i int) bool { return runs[i].last >= index })
+	mergePrev := i > 0 && runs[i-1].last+1 == index
+	mergeNext := i < len(runs) && runs[i].first == index+1
+	switch {
+	case mergePrev && mergeNext:
+		runs[i-1].last = runs[i].last
+		runs = append(runs[:i], runs[i+1:]...)
+	case mergePrev:
+		runs[i-1].last = index
+	case mergeNext:
+		runs[i].first = index
+	default:
+		runs = append(runs, blkRun{})
+		copy(runs[i+1:], runs[i:])
+		runs[i] = blkRun{index, index}
+	}
+	info.fblk, info.lblk = runs[0].first, runs[len(runs)-1].last
+	if len(runs) == 1 {
+		runs = nil
+	}
+	info.runs = runs
+}
+
+// setFirstBlock will move our first block forward, dropping the runs before it.
+func (info *psi) setFirstBlock(index uint32) {
+	info.fblk = index
+	if len(info.runs) == 0 {
+		return
+	}
+	i := sort.Search(len(info.runs), func(i int) bool { return info.runs[i].last >= index })
+	info.runs = info.runs[i:]
+	if len(info.runs) > 0 && info.runs[0].first < index {
+		info.runs[0].first = index
+	}
+	if len(info.runs) <= 1 {
+		info.runs = nil
+	}
+}
+
+// hasBlock returns true if the block with the given index may hold messages of our subject.
+// Blocks are only dropped lazily once their messages of our subject were removed.
+func (info *psi) hasBlock(index uint32) bool {
+	if index < info.fblk || index > info.lblk {
+		return false
+	}
+	if len(info.runs) == 0 {
+		return true
+	}
+	i := sort.Search(len(info.runs), func(i int) bool { return info.runs[i].last >= index })
+	return i < len(info.runs) && info.runs[i].first <= index
+}
+
+// subjectBlocks returns the per subject info of a literal subject, so blocks that do not hold it
+// can be skipped without loading their per subject info. The info is nil if we have no messages.
+// Wildcards would have to match all of our subjects, so they return false and all blocks need
+// to be checked.
+// Lock should be held.
+func (fs *fileStore) subjectBlocks(filter string) (*psi, bool) {
+	if filter == _EMPTY_ || subjectHasWildcard(filter) || fs.noTrackSubjects() {
+		return nil, false
+	}
+	return fs.psim[filter], true
+}
@@ -31,6 +31,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -643,6 +644,52 @@ func TestFileStoreAgeLimit(t *testing.T) {
 	})
 }
 
+func TestFileStoreLimitsPinned(t *testing.T) {
+	maxAge := 250 * time.Millisecond
+
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fcfg.BlockSize = 256
+
+		cfg := StreamConfig{Name: "zzz", Storage: FileStorage, MaxMsgs: 50, MaxPinned: 2, Pinned: []uint64{1, 2}}
+		fs, err := newFileStore(fcfg, cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer fs.Stop()
+
+		subj, msg := "foo", []byte("Hello World")
+		for i := 0; i < 100; i++ {
+			if _, _, err := fs.StoreMsg(subj, nil, msg); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		state := fs.State()
+		if state.Msgs != 50 || state.FirstSeq != 1 {
+			t.Fatalf("Unexpected state: %+v", state)
+		}
+		if _, err := fs.LoadMsg(53, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// Now age everything else out.
+		cfg.MaxMsgs, cfg.MaxAge = 0, maxAge
+		if err := fs.UpdateConfig(&cfg); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		checkFor(t, 2*time.Second, maxAge, func() error {
+			if state := fs.State(); state.Msgs != 2 {
+				return fmt.Errorf("Expected 2 msgs, got %d", state.Msgs)
+			}
+			return nil
+		})
+		for _, seq := range []uint64{1, 2} {
+			if _, err := fs.LoadMsg(seq, nil); err != nil {
+				t.Fatalf("Expected pinned msg %d to be present: %v", seq, err)
+			}
+		}
+	})
+}
+
 func TestFileStoreTimeStamps(t *testing.T) {
 	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
 		fs, err := newFileStore(fcfg, StreamConfig{Name: "zzz", Storage: FileStorage})
@@ -5372,3 +5419,538 @@ func TestFileStoreSubjectsTotals(t *testing.T) {
 		t.Fatalf("Expected %d subjects for %q, got %d", expected, "*.*", len(st))
 	}
 }
+
+func TestFileStoreGetSeqFromTimeWithInteriorDeletes(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fs, err := newFileStore(fcfg, StreamConfig{Name: "zzz", Storage: FileStorage})
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		start := time.Now()
+		for i := 1; i <= 10; i++ {
+			ts := start.Add(time.Duration(i) * time.Second).UnixNano()
+			require_NoError(t, fs.StoreRawMsg("foo", nil, []byte("ok"), uint64(i), ts))
+		}
+		for seq := uint64(4); seq <= 6; seq++ {
+			_, err := fs.RemoveMsg(seq)
+			require_NoError(t, err)
+		}
+
+		require_True(t, fs.GetSeqFromTime(start) == 1)
+		require_True(t, fs.GetSeqFromTime(start.Add(2*time.Second)) == 2)
+		require_True(t, fs.GetSeqFromTime(start.Add(2500*time.Millisecond)) == 3)
+		require_True(t, fs.GetSeqFromTime(start.Add(3500*time.Millisecond)) == 7)
+		require_True(t, fs.GetSeqFromTime(start.Add(4500*time.Millisecond)) == 7)
+		require_True(t, fs.GetSeqFromTime(start.Add(8*time.Second)) == 8)
+		require_True(t, fs.GetSeqFromTime(start.Add(time.Minute)) == 11)
+	})
+}
+
+func TestFileStoreSyncAlwaysGroupCommit(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		// Small blocks so we sync across block boundaries.
+		fcfg.BlockSize = 256
+		fcfg.SyncAlways = true
+		fcfg.SyncMaxDelay = 10 * time.Millisecond
+
+		fs, err := newFileStore(fcfg, StreamConfig{Name: "zzz", Storage: FileStorage})
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		const toStore = 100
+		var synced int32
+		done := make(chan struct{})
+		for i := 0; i < toStore; i++ {
+			_, _, err := fs.StoreMsg("foo", nil, []byte("Hello World"))
+			require_NoError(t, err)
+			fs.afterSync(func() {
+				if atomic.AddInt32(&synced, 1) == toStore {
+					close(done)
+				}
+			})
+		}
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Only %d of %d writes were synced", atomic.LoadInt32(&synced), toStore)
+		}
+		fs.mu.RLock()
+		lindex := fs.lmb.index
+		fs.mu.RUnlock()
+		require_True(t, lindex > 1)
+		require_True(t, fs.gcIndex == lindex)
+	})
+}
+
+func TestFileStoreLoadMsgReservesRoomForDelivery(t *testing.T) {
+	testFileStoreAllPermutations(t, func(t *testing.T, fcfg FileStoreConfig) {
+		fs, err := newFileStore(fcfg, StreamConfig{Name: "zzz", Storage: FileStorage})
+		require_NoError(t, err)
+		defer fs.Stop()
+
+		ms, err := newMemStore(&StreamConfig{Name: "zzz", Storage: MemoryStorage})
+		require_NoError(t, err)
+		defer ms.Stop()
+
+		// Sizes that fill up buffers exactly.
+		msg := bytes.Repeat([]byte("Z"), 1024)
+		hdr := []byte("NATS/1.0\r\nA: B\r\n\r\n")
+		for _, st := range []StreamStore{fs, ms} {
+			_, _, err = st.StoreMsg("foo", nil, msg)
+			require_NoError(t, err)
+			_, _, err = st.StoreMsg("foo", hdr, msg[:1024-len(hdr)])
+			require_NoError(t, err)
+			for seq := uint64(1); seq <= 2; seq++ {
+				sm, err := st.LoadMsg(seq, nil)
+				require_NoError(t, err)
+				// Delivery will append a CR_LF, which should not need a new buffer.
+				buf := append(sm.buf, _CRLF_...)
+				require_True(t, &buf[0] == &sm.buf[0])
+			}
+		}
+	})
+}
+
+func TestFileStoreDiskIOScheduler(t *testing.T) {
+	d := newDiskIOScheduler(1, 2)
+
+	// Background IO goes ahead right away when idle, but only up to the number of slots.
+	require_True(t, d.tryAcquire())
+	require_False(t, d.tryAcquire())
+	d.release(ioBackground)
+
+	// Background IO waits for interactive IO in flight.
+	for i := 0; i < 3; i++ {
+		d.acquire(ioInteractive)
+	}
+	require_False(t, d.tryAcquire())
+
+	granted := make(chan struct{})
+	go func() {
+		d.acquire(ioBackground)
+		close(granted)
+	}()
+	checkFor(t, time.Second, 10*time.Millisecond, func() error {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if len(d.waiting) != 1 {
+			return fmt.Errorf("Expected background IO to be waiting")
+		}
+		return nil
+	})
+
+	// It is not starved, but goes ahead after weight interactive calls completed.
+	d.release(ioInteractive)
+	select {
+	case <-granted:
+		t.Fatalf("Background IO should still be waiting")
+	case <-time.After(50 * time.Millisecond):
+	}
+	d.release(ioInteractive)
+	select {
+	case <-granted:
+	case <-time.After(time.Second):
+		t.Fatalf("Background IO should have been granted")
+	}
+	d.release(ioInteractive)
+	d.release(ioBackground)
+	require_True(t, d.tryAcquire())
+	d.release(ioBackground)
+}
+
+func TestFileStoreLowIOPriority(t *testing.T) {
+	sd := t.TempDir()
+	cfg := StreamConfig{Name: "zzz", Storage: FileStorage, LowIOPriority: true}
+	fs, err := newFileStore(FileStoreConfig{StoreDir: sd}, cfg)
+	require_NoError(t, err)
+	defer fs.Stop()
+
+	// All IO of the store is background IO.
+	require_True(t, fs.ioPriority(ioInteractive) == ioBackground)
+	for i := 0; i < 10; i++ {
+		_, _, err = fs.StoreMsg("foo", nil, []byte("ok"))
+		require_NoError(t, err)
+	}
+	fs.mu.RLock()
+	mb := fs.lmb
+	fs.mu.RUnlock()
+	mb.mu.Lock()
+	mb.clearCacheAndOffset()
+	mb.mu.Unlock()
+	sm, err := fs.LoadMsg(5, nil)
+	require_NoError(t, err)
+	require_True(t, sm.subj == "foo")
+
+	cfg.LowIOPriority = false
+	require_NoError(t, fs.UpdateConfig(&cfg))
+	require_True(t, fs.ioPriority(ioInteractive) == ioInteractive)
+}
+
+func TestFileStorePreallocateAndDropPageCache(t *testing.T) {
+	sd := t.TempDir()
+	fcfg := FileStoreConfig{StoreDir: sd, BlockSize: 64 * 1024, Preallocate: true, DropPageCache: true}
+	cfg := StreamConfig{Name: "zzz", Storage: FileStorage}
+	fs, err := newFileStore(fcfg, cfg)
+	require_NoError(t, err)
+	defer fs.Stop()
+
+	for i := 0; i < 100; i++ {
+		_, _, err = fs.StoreMsg("foo", nil, []byte("ok"))
+		require_NoError(t, err)
+	}
+	fs.syncBlocks()
+
+	// Preallocating does not change the size of the block, recovery relies on it.
+	fs.mu.RLock()
+	mb := fs.lmb
+	fs.mu.RUnlock()
+	mb.mu.Lock()
+	mfn, rbytes := mb.mfn, mb.rbytes
+	mb.clearCacheAndOffset()
+	mb.mu.Unlock()
+	fi, err := os.Stat(mfn)
+	require_NoError(t, err)
+	require_True(t, uint64(fi.Size()) == rbytes)
+
+	sm, err := fs.LoadMsg(50, nil)
+	require_NoError(t, err)
+	require_True(t, sm.subj == "foo")
+
+	fs.Stop()
+	fs, err = newFileStore(fcfg, cfg)
+	require_NoError(t, err)
+	defer fs.Stop()
+	state := fs.State()
+	require_True(t, state.Msgs == 100 && state.LastSeq == 100)
+}
+
+func TestFileStoreMemoryHead(t *testing.T) {
+	sd := t.TempDir()
+	fcfg := FileStoreConfig{StoreDir: sd, BlockSize: 1024}
+	msg := bytes.Repeat([]byte("Z"), 100)
+	msz := fileStoreMsgSize("foo", nil, msg)
+	cfg := StreamConfig{Name: "zzz", Storage: FileStorage, MemoryHeadBytes: int64(10 * msz)}
+	fs, err := newFileStore(fcfg, cfg)
+	require_NoError(t, err)
+	defer fs.Stop()
+
+	for i := 0; i < 50; i++ {
+		_, _, err = fs.StoreMsg("foo", nil, msg)
+		require_NoError(t, err)
+	}
+	checkHead := func(first, last uint64) {
+		t.Helper()
+		fs.mu.RLock()
+		h := fs.head
+		fs.mu.RUnlock()
+		msgs, bytes := h.size()
+		if msgs != int(last-first+1) || bytes != uint64(msgs)*msz {
+			t.Fatalf("Expected memory head with %d msgs, got %d with %d bytes", last-first+1, msgs, bytes)
+		}
+		for seq := first; seq <= last; seq++ {
+			if _, ok := h.load(seq, nil); !ok {
+				t.Fatalf("Expected seq %d in memory head", seq)
+			}
+		}
+	}
+	// Only the most recent messages fit.
+	checkHead(41, 50)
+
+	// Messages in the head are served without loading their block.
+	fs.mu.RLock()
+	mb := fs.selectMsgBlock(45)
+	fs.mu.RUnlock()
+	mb.mu.Lock()
+	mb.clearCacheAndOffset()
+	mb.mu.Unlock()
+	sm, err := fs.LoadMsg(45, nil)
+	require_NoError(t, err)
+	require_True(t, sm.seq == 45 && sm.subj == "foo" && bytes.Equal(sm.msg, msg))
+	sm, _, err = fs.LoadNextMsg("foo", false, 45, nil)
+	require_NoError(t, err)
+	require_True(t, sm.seq == 45)
+	mb.mu.RLock()
+	require_True(t, mb.cacheNotLoaded())
+	mb.mu.RUnlock()
+
+	// Older messages and other filters are served by the blocks.
+	sm, err = fs.LoadMsg(5, nil)
+	require_NoError(t, err)
+	require_True(t, sm.seq == 5 && bytes.Equal(sm.msg, msg))
+	_, _, err = fs.LoadNextMsg("bar", false, 45, nil)
+	require_Error(t, err, ErrStoreEOF)
+
+	// Removed messages are gone from the head as well.
+	removed, err := fs.RemoveMsg(50)
+	require_NoError(t, err)
+	require_True(t, removed)
+	_, err = fs.LoadMsg(50, nil)
+	require_Error(t, err, ErrStoreMsgNotFound, ErrStoreEOF)
+	checkHead(41, 49)
+
+	// On restart the head is filled with the most recent messages.
+	fs.Stop()
+	fs, err = newFileStore(fcfg, cfg)
+	require_NoError(t, err)
+	defer fs.Stop()
+	checkHead(40, 49)
+
+	// Shrinking evicts the oldest messages.
+	cfg.MemoryHeadBytes = int64(5 * msz)
+	require_NoError(t, fs.UpdateConfig(&cfg))
+	checkHead(45, 49)
+
+	_, err = fs.Compact(47)
+	require_NoError(t, err)
+	checkHead(47, 49)
+	require_NoError(t, fs.Truncate(48))
+	checkHead(47, 48)
+	_, err = fs.Purge()
+	require_NoError(t, err)
+	msgs, _ := fs.head.size()
+	require_True(t, msgs == 0)
+
+	cfg.MemoryHeadBytes = 0
+	require_NoError(t, fs.UpdateConfig(&cfg))
+	fs.mu.RLock()
+	require_True(t, fs.head == nil)
+	fs.mu.RUnlock()
+}
+
+func TestFileStoreSubjectBlocksIndex(t *testing.T) {
+	sd := t.TempDir()
+	fcfg := FileStoreConfig{StoreDir: sd, BlockSize: 1024}
+	cfg := StreamConfig{Name: "zzz", Subjects: []string{"foo.*", "bar.*"}, Storage: FileStorage}
+	fs, err := newFileStore(fcfg, cfg)
+	require_NoError(t, err)
+	defer fs.Stop()
+
+	// Messages on foo.a are only in the first and last blocks.
+	msg := bytes.Repeat([]byte("Z"), 100)
+	store := func(subj string, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			_, _, err := fs.StoreMsg(subj, nil, msg)
+			require_NoError(t, err)
+		}
+	}
+	store("foo.a", 1)
+	store("bar.b", 50)
+	store("foo.a", 1)
+
+	checkIndex := func() {
+		t.Helper()
+		fs.mu.RLock()
+		defer fs.mu.RUnlock()
+		info := fs.psim["foo.a"]
+		require_True(t, info != nil && info.total == 2)
+		require_True(t, len(info.runs) == 2)
+		require_True(t, info.hasBlock(fs.blks[0].index))
+		require_True(t, info.hasBlock(fs.lmb.index))
+		for _, mb := range fs.blks[1 : len(fs.blks)-1] {
+			require_False(t, info.hasBlock(mb.index))
+		}
+		// Contiguous blocks do not need runs.
+		require_True(t, fs.psim["bar.b"].runs == nil)
+	}
+	checkIndex()
+
+	// Blocks without foo.a are skipped without loading their per subject info.
+	clearFSS := func() {
+		fs.mu.RLock()
+		defer fs.mu.RUnlock()
+		for _, mb := range fs.blks {
+			mb.mu.Lock()
+			mb.fss = nil
+			mb.mu.Unlock()
+		}
+	}
+	checkSkipped := func() {
+		t.Helper()
+		fs.mu.RLock()
+		defer fs.mu.RUnlock()
+		for _, mb := range fs.blks[1 : len(fs.blks)-1] {
+			mb.mu.RLock()
+			loaded := mb.fss != nil
+			mb.mu.RUnlock()
+			require_False(t, loaded)
+		}
+	}
+	clearFSS()
+	sm, _, err := fs.LoadNextMsg("foo.a", false, 2, nil)
+	require_NoError(t, err)
+	require_True(t, sm.seq == 52)
+	checkSkipped()
+
+	clearFSS()
+	sm, err = fs.LoadLastMsg("foo.*", nil)
+	require_NoError(t, err)
+	require_True(t, sm.seq == 52)
+	sm, err = fs.LoadLastMsg("foo.a", nil)
+	require_NoError(t, err)
+	require_True(t, sm.seq == 52)
+	checkSkipped()
+
+	_, err = fs.LoadLastMsg("foo.b", nil)
+	require_Error(t, err, ErrStoreMsgNotFound)
+	_, _, err = fs.LoadNextMsg("foo.b", false, 1, nil)
+	require_Error(t, err, ErrStoreEOF)
+
+	// The index is rebuilt on restart.
+	fs.Stop()
+	fs, err = newFileStore(fcfg, cfg)
+	require_NoError(t, err)
+	defer fs.Stop()
+	checkIndex()
+
+	// Runs before the first block of the subject are dropped.
+	fs.mu.Lock()
+	info := fs.psim["foo.a"]
+	info.setFirstBlock(fs.lmb.index)
+	require_True(t, info.runs == nil)
+	require_False(t, info.hasBlock(fs.blks[0].index))
+	require_True(t, info.hasBlock(fs.lmb.index))
+	fs.mu.Unlock()
+}
+
+func TestFileStoreSubjectBlocksIndexRecoverOutOfOrder(t *testing.T) {
+	sd := t.TempDir()
+	fcfg := FileStoreConfig{StoreDir: sd, BlockSize: 256}
+	cfg := StreamConfig{Name: "zzz", Subjects: []string{"*"}, Storage: FileStorage}
+	fs, err := newFileStore(fcfg, cfg)
+	require_NoError(t, err)
+	defer fs.Stop()
+
+	// One message per block, "a" is in blocks 1, 2 and 10 to 12. Blocks are
+	// recovered in the order of their file names, so 1, 10, 11, 12, 2, ...
+	msg := bytes.Repeat([]byte("Z"), 200)
+	var expected []uint64
+	for i := 1; i <= 14; i++ {
+		subj := "b"
+		if i <= 2 || i >= 10 && i <= 12 {
+			subj = "a"
+		}
+		seq, _, err := fs.StoreMsg(subj, nil, msg)
+		require_NoError(t, err)
+		if subj == "a" {
+			expected = append(expected, seq)
+		}
+	}
+	fs.mu.RLock()
+	nblks := len(fs.blks)
+	fs.mu.RUnlock()
+	require_True(t, nblks == 14)
+
+	check := func() {
+		t.Helper()
+		var seqs []uint64
+		for seq := uint64(0); ; seq++ {
+			sm, nseq, err := fs.LoadNextMsg("a", false, seq, nil)
+			if err == ErrStoreEOF {
+				break
+			}
+			require_NoError(t, err)
+			seqs = append(seqs, sm.seq)
+			seq = nseq
+		}
+		require_True(t, reflect.DeepEqual(seqs, expected))
+		sm, err := fs.LoadLastMsg("a", nil)
+		require_NoError(t, err)
+		require_True(t, sm.seq == expected[len(expected)-1])
+	}
+	check()
+
+	fs.Stop()
+	fs, err = newFileStore(fcfg, cfg)
+	require_NoError(t, err)
+	defer fs.Stop()
+	check()
+
+	fs.mu.RLock()
+	info := fs.psim["a"]
+	require_True(t, info.fblk == 1 && info.lblk == 12)
+	require_True(t, reflect.DeepEqual(info.runs, []blkRun{{1, 2}, {10, 12}}))
+	fs.mu.RUnlock()
+
+	// Removing the first messages moves the first block forward.
+	for _, seq := range expected[:2] {
+		_, err := fs.RemoveMsg(seq)
+		require_NoError(t, err)
+	}
+	expected = expected[2:]
+	check()
+}
+
+func TestFileStoreSubjectBlocksAddOutOfOrder(t *testing.T) {
+	info := newPSI(1, 10)
+	for _, index := range []uint32{12, 2, 11, 1, 4, 3, 20} {
+		info.addBlock(index)
+	}
+	require_True(t, info.fblk == 1 && info.lblk == 20)
+	require_True(t, reflect.DeepEqual(info.runs, []blkRun{{1, 4}, {10, 12}, {20, 20}}))
+	for index := uint32(0); index <= 21; index++ {
+		has := index >= 1 && index <= 4 || index >= 10 && index <= 12 || index == 20
+		require_True(t, info.hasBlock(index) == has)
+	}
+	// Filling the gaps leaves a single contiguous range.
+	for index := uint32(5); index < 20; index++ {
+		info.addBlock(index)
+	}
+	require_True(t, info.runs == nil && info.fblk == 1 && info.lblk == 20)
+}
+
+func TestFileStoreMaintainConcurrent(t *testing.T) {
+	fs, err := newFileStore(FileStoreConfig{StoreDir: t.TempDir(), BlockSize: 4 * 1024}, StreamConfig{Name: "zzz", Subjects: []string{"foo.*"}, Storage: FileStorage})
+	require_NoError(t, err)
+	defer fs.Stop()
+
+	msg := bytes.Repeat([]byte("Z"), 256)
+	for i := 0; i < 500; i++ {
+		_, _, err := fs.StoreMsg(fmt.Sprintf("foo.%d", i%10), nil, msg)
+		require_NoError(t, err)
+	}
+
+	// Maintain while messages are removed from the blocks being compacted, and new ones stored.
+	qch, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		b := newIOBudget(0)
+		for {
+			select {
+			case <-qch:
+				return
+			default:
+			}
+			var ms maintenanceStats
+			fs.maintain(b, &ms, func() bool { return false }, qch, nil)
+		}
+	}()
+
+	var removed uint64
+	for seq := uint64(1); seq <= 500; seq++ {
+		if seq%4 != 0 {
+			_, err := fs.RemoveMsg(seq)
+			require_NoError(t, err)
+			removed++
+		}
+		if seq%50 == 0 {
+			_, _, err := fs.StoreMsg("foo.new", nil, msg)
+			require_NoError(t, err)
+		}
+	}
+	close(qch)
+	<-done
+
+	var state StreamState
+	fs.FastState(&state)
+	require_True(t, state.Msgs == 500-removed+10)
+	var smv StoreMsg
+	for seq := uint64(1); seq <= 510; seq++ {
+		_, err := fs.LoadMsg(seq, &smv)
+		if seq <= 500 && seq%4 != 0 {
+			require_Error(t, err)
+		} else {
+			require_NoError(t, err)
+		}
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -47,13 +48,21 @@ type JetStreamConfig struct {
 
 // Statistics about JetStream for this server.
 type JetStreamStats struct {
-	Memory         uint64            `json:"memory"`
-	Store          uint64            `json:"storage"`
-	ReservedMemory uint64            `json:"reserved_memory"`
-	ReservedStore  uint64            `json:"reserved_storage"`
-	Accounts       int               `json:"accounts"`
-	HAAssets       int               `json:"ha_assets"`
-	API            JetStreamAPIStats `json:"api"`
+	Memory           uint64            `json:"memory"`
+	Store            uint64            `json:"storage"`
+	ReservedMemory   uint64            `json:"reserved_memory"`
+	ReservedStore    uint64            `json:"reserved_storage"`
+	Accounts         int               `json:"accounts"`
+	HAAssets         int               `json:"ha_assets"`
+	API              JetStreamAPIStats `json:"api"`
+	MemoryTimeToFull time.Duration     `json:"memory_time_to_full,omitempty"`
+	StoreTimeToFull  time.Duration     `json:"storage_time_to_full,omitempty"`
+
+	// Totals of the streams and consumers on this server, replicas included.
+	Streams   int    `json:"streams"`
+	Consumers int    `json:"consumers"`
+	Messages  uint64 `json:"messages"`
+	Bytes     uint64 `json:"bytes"`
 }
 
 type JetStreamAccountLimits struct {
@@ -65,6 +74,7 @@ type JetStreamAccountLimits struct {
 	MemoryMaxStreamBytes int64 `json:"memory_max_stream_bytes"`
 	StoreMaxStreamBytes  int64 `json:"storage_max_stream_bytes"`
 	MaxBytesRequired     bool  `json:"max_bytes_required"`
+	MaxPendingMemory     int64 `json:"max_pending_memory,omitempty"`
 }
 
 type JetStreamTier struct {
@@ -99,7 +109,9 @@ type jetStream struct {
 	storeReserved int64
 	memUsed       int64
 	storeUsed     int64
+	chunkMem      int64
 	clustered     int32
+	standby       int32
 	mu            sync.RWMutex
 	srv           *Server
 	config        JetStreamConfig
@@ -109,11 +121,36 @@ type jetStream struct {
 	started       time.Time
 
 	// System level request to purge a stream move
-	accountPurge   *subscription
+	accountPurge *subscription
+	// System level request to bulk load a stream from a local file
+	bulkLoad       *subscription
 	metaRecovering bool
 	standAlone     bool
 	disabled       bool
 	oos            bool
+
+	// Catch all subscription for API requests.
+	apiSub *subscription
+	// Store directories besides our primary one, by name.
+	sdirs map[string]string
+	// Closed on shutdown, go routines of this instance exit since we may be enabled again.
+	// Never reset, should be read under the lock.
+	quitCh chan struct{}
+
+	// Storage forecasts for this server.
+	memFcast   storageForecast
+	storeFcast storageForecast
+
+	// Format version of our store directory.
+	storeFormat int
+
+	// Set while we are the warm standby of another server.
+	sb *jsStandby
+
+	// Administrative audit trail.
+	auditMu   sync.Mutex
+	auditSeq  uint64
+	auditHash string
 }
 
 type remoteUsage struct {
@@ -133,6 +170,14 @@ type jsaStorage struct {
 // an internal sub for a stream, so we will direct link to the stream
 // and walk backwards as needed vs multiple hash lookups and locks, etc.
 type jsAccount struct {
+	// Estimated memory used by pending state of all our consumers.
+	// Atomic, and first for alignment on 32bit systems.
+	pmem int64
+	// Messages delivered by our consumers on this server, for usage reporting. Atomic.
+	delivered uint64
+	// Memory held by incomplete chunked messages of our streams. Atomic.
+	cmem int64
+
 	mu        sync.RWMutex
 	js        *jetStream
 	account   *Account
@@ -145,6 +190,9 @@ type jsAccount struct {
 	// From server
 	sendq *ipQueue[*pubMsg]
 
+	// System account holding the audit trail, not charged against the limits of the server.
+	sys bool
+
 	// Usage/limits related fields that will be protected by usageMu
 	usageMu    sync.RWMutex
 	limits     map[string]JetStreamAccountLimits // indexed by tierName
@@ -158,6 +206,12 @@ type jsAccount struct {
 	updatesSub *subscription
 	lupdate    time.Time
 	utimer     *time.Timer
+	memFcast   storageForecast
+	storeFcast storageForecast
+
+	// Set when JetStream was gracefully disabled and we retain the data read only.
+	readOnly int32
+	dtimer   *time.Timer
 }
 
 // Track general usage for this account.
@@ -213,7 +267,34 @@ type keyGen func(context []byte) ([]byte, error)
 // Return a key generation function or nil if encryption not enabled.
 // keyGen defined in filestore.go - keyGen func(iv, context []byte) []byte
 func (s *Server) jsKeyGen(info string) keyGen {
-	if ek := s.getOpts().JetStreamKey; ek != _EMPTY_ {
+	return jsKeyGenFromKey(s.getOpts().JetStreamKey, info)
+}
+
+// jsAccKeyGen returns the key generation function for assets of the account.
+func (s *Server) jsAccKeyGen(accName, info string) keyGen {
+	return jsKeyGenFromKey(s.jsAccountKey(accName), info)
+}
+
+// jsAccountKey returns the at rest encryption key for the account,
+// which will be its own key if configured, otherwise the server key.
+// Keys are not rotated, assets stay encrypted with the key they were created with and can not be
+// read with another one. To change the key of an account its streams need to be re-encrypted:
+// back them up, which decrypts them, delete them, change the key and restore them.
+func (s *Server) jsAccountKey(accName string) string {
+	if v, ok := s.accounts.Load(accName); ok {
+		acc := v.(*Account)
+		acc.mu.RLock()
+		ek := acc.jsKey
+		acc.mu.RUnlock()
+		if ek != _EMPTY_ {
+			return ek
+		}
+	}
+	return s.getOpts().JetStreamKey
+}
+
+func jsKeyGenFromKey(ek, info string) keyGen {
+	if ek != _EMPTY_ {
 		return func(context []byte) ([]byte, error) {
 			h := hmac.New(sha256.New, []byte(ek))
 			if _, err := h.Write([]byte(info)); err != nil {
@@ -233,7 +314,7 @@ func (s *Server) decryptMeta(sc StoreCipher, ekey, buf []byte, acc, context stri
 	if len(ekey) < minMetaKeySize {
 		return nil, errBadKeySize
 	}
-	prf := s.jsKeyGen(acc)
+	prf := s.jsAccKeyGen(acc, acc)
 	if prf == nil {
 		return nil, errNoEncryption
 	}
@@ -325,12 +406,18 @@ func (s *Server) checkStoreDir(cfg *JetStreamConfig) error {
 
 // enableJetStream will start up the JetStream subsystem.
 func (s *Server) enableJetStream(cfg JetStreamConfig) error {
-	js := &jetStream{srv: s, config: cfg, accounts: make(map[string]*jsAccount), apiSubs: NewSublistNoCache()}
+	js := &jetStream{srv: s, config: cfg, accounts: make(map[string]*jsAccount), apiSubs: NewSublistNoCache(), quitCh: make(chan struct{})}
 	s.gcbMu.Lock()
 	if s.gcbOutMax = s.getOpts().JetStreamMaxCatchup; s.gcbOutMax == 0 {
 		s.gcbOutMax = defaultMaxTotalCatchupOutBytes
 	}
 	s.gcbMu.Unlock()
+	// The disk IO scheduler is shared by all stores of the process.
+	dios.setWeight(s.getOpts().JetStreamIOWeight)
+	// Streams can be spread across more store directories.
+	if err := js.setupStoreDirs(s.getOpts().JetStreamStoreDirs); err != nil {
+		return err
+	}
 
 	s.mu.Lock()
 	s.js = js
@@ -354,6 +441,11 @@ func (s *Server) enableJetStream(cfg JetStreamConfig) error {
 		os.Remove(tmpfile.Name())
 	}
 
+	// Make sure we can read the store before we recover anything from it.
+	if err := js.checkStoreFormat(); err != nil {
+		return err
+	}
+
 	// JetStream is an internal service so we need to make sure we have a system account.
 	// This system account will export the JetStream service endpoints.
 	if s.SystemAccount() == nil {
@@ -378,6 +470,14 @@ func (s *Server) enableJetStream(cfg JetStreamConfig) error {
 	if ek := opts.JetStreamKey; ek != _EMPTY_ {
 		s.Noticef("  Encryption:      %s", opts.JetStreamCipher)
 	}
+	// Continue the hash chain of our audit trail.
+	if opts.JetStreamAudit {
+		if err := js.loadAuditHead(); err != nil {
+			return err
+		}
+	}
+	// Before we recover our streams, a standby does not let them take messages.
+	js.setupStandby()
 	s.Noticef("-------------------------------------------")
 
 	// Setup our internal subscriptions.
@@ -412,6 +512,37 @@ func (s *Server) enableJetStream(cfg JetStreamConfig) error {
 		}
 	}
 
+	// Start forecasting our storage usage.
+	s.startGoRoutine(js.monitorStorageForecast)
+	// And keeping the stats history of our streams.
+	if s.getOpts().JetStreamStatsHistory != nil {
+		s.startGoRoutine(js.monitorStreamStats)
+	}
+	// And shipping from our primary if we are a standby.
+	if js.isStandby() && !s.startGoRoutine(js.runStandby) {
+		close(js.sb.done)
+	}
+	// And posting our usage to the billing webhook.
+	if s.getOpts().JetStreamBilling != nil {
+		s.startGoRoutine(js.runBilling)
+	}
+	// And looking for orphaned consumers.
+	if s.getOpts().JetStreamOrphans != nil {
+		s.startGoRoutine(js.monitorOrphans)
+	}
+	// And maintaining our file based streams.
+	if s.getOpts().JetStreamMaintenance != nil {
+		s.startGoRoutine(js.runMaintenance)
+	}
+	// And publishing the delivery metrics of our consumers.
+	if s.getOpts().JetStreamMetrics != nil {
+		s.startGoRoutine(js.publishConsumerMetrics)
+	}
+	// And keeping the administrative audit trail in the system account.
+	if s.getOpts().JetStreamAudit {
+		s.startGoRoutine(js.createAdminAuditStream)
+	}
+
 	// Mark when we are up and running.
 	js.setStarted()
 
@@ -538,6 +669,8 @@ func (s *Server) handleOutOfSpace(mset *stream) {
 
 // DisableJetStream will turn off JetStream and signals in clustered mode
 // to have the metacontroller remove us from the peer list.
+// Streams are stopped and flushed, internal subscriptions removed and
+// resources released, so JetStream can be enabled again with a new config.
 func (s *Server) DisableJetStream() error {
 	if !s.JetStreamEnabled() {
 		return nil
@@ -619,6 +752,15 @@ func (a *Account) enableAllJetStreamServiceImportsAndMappings() error {
 		}
 	}
 
+	// Share client details with the system account for the administrative audit trail.
+	if s.getOpts().JetStreamAudit {
+		a.mu.Lock()
+		if si := a.imports.services[jsAllAPI]; si != nil {
+			si.share = true
+		}
+		a.mu.Unlock()
+	}
+
 	// Check if we have a Domain specified.
 	// If so add in a subject mapping that will allow local connected clients to reach us here as well.
 	if opts := s.getOpts(); opts.JetStreamDomain != _EMPTY_ {
@@ -654,6 +796,13 @@ func (s *Server) configJetStream(acc *Account) error {
 	if acc == nil {
 		return nil
 	}
+	// The system account can only hold the audit trail, if enabled for the server.
+	if acc == s.SystemAccount() && s.getOpts().JetStreamAudit {
+		if acc.JetStreamEnabled() {
+			return nil
+		}
+		return acc.enableSystemJetStream()
+	}
 	acc.mu.RLock()
 	jsLimits := acc.jsLimits
 	acc.mu.RUnlock()
@@ -663,6 +812,7 @@ func (s *Server) configJetStream(acc *Account) error {
 			if err := acc.enableAllJetStreamServiceImportsAndMappings(); err != nil {
 				return err
 			}
+			acc.restoreJetStream()
 			if err := acc.UpdateJetStreamLimits(jsLimits); err != nil {
 				return err
 			}
@@ -676,7 +826,7 @@ func (s *Server) configJetStream(acc *Account) error {
 		}
 	} else if acc != s.SystemAccount() {
 		if acc.JetStreamEnabled() {
-			acc.DisableJetStream()
+			acc.DisableJetStreamGraceful(s.getOpts().JetStreamDisRetention)
 		}
 		// We will setup basic service imports to respond to
 		// requests if JS is enabled for this account.
@@ -709,6 +859,9 @@ func (s *Server) configAllJetStreamAccounts() error {
 		saccName := s.sys.account.Name
 		accStoreDirs, _ := os.ReadDir(js.config.StoreDir)
 		for _, acc := range accStoreDirs {
+			if !acc.IsDir() || acc.Name() == jsStoreFormatDir {
+				continue
+			}
 			if accName := acc.Name(); accName != saccName {
 				// no op if not empty
 				accDir := filepath.Join(js.config.StoreDir, accName)
@@ -738,6 +891,9 @@ func (s *Server) configAllJetStreamAccounts() error {
 	// This is important in resolver/operator models.
 	fis, _ := os.ReadDir(js.config.StoreDir)
 	for _, fi := range fis {
+		if !fi.IsDir() || fi.Name() == jsStoreFormatDir {
+			continue
+		}
 		if accName := fi.Name(); accName != _EMPTY_ {
 			// Only load up ones not already loaded since they are processed above.
 			if _, ok := accounts.Load(accName); !ok {
@@ -760,6 +916,13 @@ func (js *jetStream) setStarted() {
 	js.started = time.Now()
 }
 
+// isStarted returns if we are done recovering our accounts and streams.
+func (js *jetStream) isStarted() bool {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+	return !js.started.IsZero()
+}
+
 func (js *jetStream) isEnabled() bool {
 	if js == nil {
 		return false
@@ -780,8 +943,17 @@ func (js *jetStream) setJetStreamStandAlone(isStandAlone bool) {
 
 	if isStandAlone {
 		js.accountPurge, _ = js.srv.systemSubscribe(JSApiAccountPurge, _EMPTY_, false, nil, js.srv.jsLeaderAccountPurgeRequest)
-	} else if js.accountPurge != nil {
-		js.srv.sysUnsubscribe(js.accountPurge)
+		if js.bulkLoad == nil {
+			js.bulkLoad, _ = js.srv.systemSubscribe(JSApiServerStreamBulkLoad, _EMPTY_, false, nil, js.srv.jsStreamBulkLoadRequest)
+		}
+	} else {
+		if js.accountPurge != nil {
+			js.srv.sysUnsubscribe(js.accountPurge)
+		}
+		if js.bulkLoad != nil {
+			js.srv.sysUnsubscribe(js.bulkLoad)
+			js.bulkLoad = nil
+		}
 	}
 }
 
@@ -885,13 +1057,25 @@ func (s *Server) shutdownJetStream() {
 			accounts = append(accounts, a)
 		}
 	}
-	accPurgeSub := js.accountPurge
-	js.accountPurge = nil
+	accPurgeSub, bulkLoadSub, apiSub := js.accountPurge, js.bulkLoad, js.apiSub
+	js.accountPurge, js.bulkLoad, js.apiSub = nil, nil, nil
+	// Keep the closed channel around, go routines that grab it after this point will still exit.
+	select {
+	case <-js.quitCh:
+	default:
+		close(js.quitCh)
+	}
 	js.mu.Unlock()
 
 	if accPurgeSub != nil {
 		s.sysUnsubscribe(accPurgeSub)
 	}
+	if bulkLoadSub != nil {
+		s.sysUnsubscribe(bulkLoadSub)
+	}
+	if apiSub != nil {
+		s.sysUnsubscribe(apiSub)
+	}
 
 	for _, a := range accounts {
 		a.removeJetStream()
@@ -980,6 +1164,75 @@ func (s *Server) JetStreamReservedResources() (int64, int64, error) {
 	return js.memReserved, js.storeReserved, nil
 }
 
+// JetStreamPublish will publish a message into the named account without a client
+// connection and wait for the stream to acknowledge it. This allows embedded users and
+// other server subsystems to persist messages directly. Since the call blocks until the
+// message has been stored, callers are naturally subject to backpressure.
+func (s *Server) JetStreamPublish(accName, subject string, hdr map[string]string, data []byte, timeout time.Duration) (*PubAck, error) {
+	if !s.JetStreamEnabled() {
+		return nil, NewJSNotEnabledError()
+	}
+	acc, err := s.LookupAccount(accName)
+	if err != nil {
+		return nil, err
+	}
+	if !acc.JetStreamEnabled() {
+		return nil, NewJSNotEnabledForAccountError()
+	}
+	// Fail fast if no stream, local or remote, is interested in this subject.
+	if r := acc.sl.Match(subject); len(r.psubs)+len(r.qsubs) == 0 {
+		return nil, NewJSStreamNotFoundError()
+	}
+
+	rmsg, err := s.jsAccountRequest(acc, subject, hdr, data, timeout)
+	if err != nil {
+		return nil, err
+	}
+	var resp JSPubAckResponse
+	if err := json.Unmarshal(rmsg, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.PubAck, nil
+}
+
+// jsAccountRequest will send a request in the context of the account and wait for the response.
+func (s *Server) jsAccountRequest(acc *Account, subject string, hdr map[string]string, data []byte, timeout time.Duration) ([]byte, error) {
+	results := make(chan []byte, 1)
+	inbox := fmt.Sprintf("_INBOX.%s", nuid.Next())
+	sub, err := acc.subscribeInternal(inbox, func(_ *subscription, c *client, _ *Account, _, _ string, rmsg []byte) {
+		_, msg := c.msgParts(rmsg)
+		select {
+		case results <- copyBytes(msg):
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer sub.client.processUnsub(sub.sid)
+
+	// Service imports, e.g. for the JetStream API, are subscriptions of the account's
+	// internal client, so we need echo for those to see our request.
+	if err := s.sendInternalAccountMsgWithReply(acc, subject, inbox, hdr, data, true); err != nil {
+		return nil, err
+	}
+
+	notActive := time.NewTimer(timeout)
+	defer notActive.Stop()
+
+	select {
+	case <-s.quitCh:
+		return nil, errReqSrvExit
+	case <-notActive.C:
+		return nil, errReqTimeout
+	case msg := <-results:
+		return msg, nil
+	}
+}
+
 func (s *Server) getJetStream() *jetStream {
 	s.mu.RLock()
 	js := s.js
@@ -1008,6 +1261,23 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 		return fmt.Errorf("jetstream can not be enabled on the system account")
 	}
 
+	return a.enableJetStream(s, limits, false)
+}
+
+// enableSystemJetStream will enable JetStream for the system account, so it can hold the audit trail.
+// Its usage and reservations are not charged against the limits of the server.
+func (a *Account) enableSystemJetStream() error {
+	a.mu.RLock()
+	s := a.srv
+	a.mu.RUnlock()
+
+	if s == nil {
+		return fmt.Errorf("jetstream account not registered")
+	}
+	return a.enableJetStream(s, nil, true)
+}
+
+func (a *Account) enableJetStream(s *Server, limits map[string]JetStreamAccountLimits, sys bool) error {
 	s.mu.Lock()
 	sendq := s.sys.sendq
 	s.mu.Unlock()
@@ -1026,20 +1296,27 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 	}
 
 	js.mu.Lock()
-	if _, ok := js.accounts[a.Name]; ok && a.JetStreamEnabled() {
+	if jsa, ok := js.accounts[a.Name]; ok && a.JetStreamEnabled() {
 		js.mu.Unlock()
+		// If we were gracefully disabled restore with the new limits.
+		if jsa.isReadOnly() {
+			a.restoreJetStream()
+			return a.UpdateJetStreamLimits(limits)
+		}
 		return fmt.Errorf("jetstream already enabled for account")
 	}
 
 	// Check the limits against existing reservations.
-	if err := js.sufficientResources(limits); err != nil {
-		js.mu.Unlock()
-		return err
+	if !sys {
+		if err := js.sufficientResources(limits); err != nil {
+			js.mu.Unlock()
+			return err
+		}
 	}
 
 	sysNode := s.Node()
 
-	jsa := &jsAccount{js: js, account: a, limits: limits, streams: make(map[string]*stream), sendq: sendq, usage: make(map[string]*jsaStorage)}
+	jsa := &jsAccount{js: js, account: a, limits: limits, streams: make(map[string]*stream), sendq: sendq, usage: make(map[string]*jsaStorage), sys: sys}
 	jsa.storeDir = filepath.Join(js.config.StoreDir, a.Name)
 
 	jsa.usageMu.Lock()
@@ -1057,9 +1334,11 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 	a.js = jsa
 	a.mu.Unlock()
 
-	// Create the proper imports here.
-	if err := a.enableAllJetStreamServiceImportsAndMappings(); err != nil {
-		return err
+	// Create the proper imports here. The system account serves the API itself.
+	if !sys {
+		if err := a.enableAllJetStreamServiceImportsAndMappings(); err != nil {
+			return err
+		}
 	}
 
 	s.Debugf("Enabled JetStream for account %q", a.Name)
@@ -1151,13 +1430,17 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 	var ipstreams []*stream
 
 	// Remember if we should be encrypted and what cipher we think we should use.
-	encrypted := s.getOpts().JetStreamKey != _EMPTY_
-	plaintext := true
+	encrypted := s.jsAccountKey(a.Name) != _EMPTY_
 	sc := s.getOpts().JetStreamCipher
 
-	// Now recover the streams.
-	fis, _ := os.ReadDir(sdir)
-	for _, fi := range fis {
+	// Now recover the streams. This can take a while for large file based streams,
+	// so we recover a bounded number of them in parallel.
+	var (
+		rmu  sync.Mutex
+		rwg  sync.WaitGroup
+		rerr error
+	)
+	recoverStream := func(sdir string, fi os.DirEntry) error {
 		mdir := filepath.Join(sdir, fi.Name())
 		key := sha256.Sum256([]byte(fi.Name()))
 		hh, err := highwayhash.New64(key[:])
@@ -1168,30 +1451,31 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 		metasum := filepath.Join(mdir, JetStreamMetaFileSum)
 		if _, err := os.Stat(metafile); os.IsNotExist(err) {
 			s.Warnf("  Missing stream metafile for %q", metafile)
-			continue
+			return nil
 		}
 		buf, err := os.ReadFile(metafile)
 		if err != nil {
 			s.Warnf("  Error reading metafile %q: %v", metafile, err)
-			continue
+			return nil
 		}
 		if _, err := os.Stat(metasum); os.IsNotExist(err) {
 			s.Warnf("  Missing stream checksum file %q", metasum)
-			continue
+			return nil
 		}
 		sum, err := os.ReadFile(metasum)
 		if err != nil {
 			s.Warnf("  Error reading Stream metafile checksum %q: %v", metasum, err)
-			continue
+			return nil
 		}
 		hh.Write(buf)
 		checksum := hex.EncodeToString(hh.Sum(nil))
 		if checksum != string(sum) {
 			s.Warnf("  Stream metafile %q: checksums do not match %q vs %q", metafile, sum, checksum)
-			continue
+			return nil
 		}
 
-		// Track if we are converting ciphers.
+		// Track if we are converting from plaintext or ciphers.
+		plaintext := true
 		var osc StoreCipher
 		var convertingCiphers bool
 
@@ -1201,7 +1485,7 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 			s.Debugf("  Stream metafile is encrypted, reading encrypted keyfile")
 			if len(key) < minMetaKeySize {
 				s.Warnf("  Bad stream encryption key length of %d", len(key))
-				continue
+				return nil
 			}
 			// Decode the buffer before proceeding.
 			nbuf, err := s.decryptMeta(sc, key, buf, a.Name, fi.Name())
@@ -1217,7 +1501,7 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 				}
 				if err != nil {
 					s.Warnf("  Error decrypting our stream metafile: %v", err)
-					continue
+					return nil
 				}
 			}
 			buf = nbuf
@@ -1230,7 +1514,7 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 		var cfg FileStreamInfo
 		if err := json.Unmarshal(buf, &cfg); err != nil {
 			s.Warnf("  Error unmarshalling stream metafile %q: %v", metafile, err)
-			continue
+			return nil
 		}
 
 		if cfg.Template != _EMPTY_ {
@@ -1259,7 +1543,7 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 			}
 		}
 		if hadSubjErr {
-			continue
+			return nil
 		}
 
 		// The other possible bug is assigning subjects to mirrors, so check for that and patch as well.
@@ -1283,7 +1567,7 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 		mset, err := a.addStream(&cfg.StreamConfig)
 		if err != nil {
 			s.Warnf("  Error recreating stream %q: %v", cfg.Name, err)
-			continue
+			return nil
 		}
 		if !cfg.Created.IsZero() {
 			mset.setCreatedTime(cfg.Created)
@@ -1292,6 +1576,9 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 		state := mset.state()
 		s.Noticef("  Restored %s messages for stream '%s > %s'", comma(int64(state.Msgs)), mset.accName(), mset.name())
 
+		rmu.Lock()
+		defer rmu.Unlock()
+
 		// Collect to check for dangling messages.
 		// TODO(dlc) - Can be removed eventually.
 		if cfg.StreamConfig.Retention == InterestPolicy {
@@ -1301,83 +1588,44 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 		// Now do the consumers.
 		odir := filepath.Join(sdir, fi.Name(), consumerDir)
 		consumers = append(consumers, &ce{mset, odir})
+		return nil
 	}
 
-	for _, e := range consumers {
-		ofis, _ := os.ReadDir(e.odir)
-		if len(ofis) > 0 {
-			s.Noticef("  Recovering %d consumers for stream - '%s > %s'", len(ofis), e.mset.accName(), e.mset.name())
-		}
-		for _, ofi := range ofis {
-			metafile := filepath.Join(e.odir, ofi.Name(), JetStreamMetaFile)
-			metasum := filepath.Join(e.odir, ofi.Name(), JetStreamMetaFileSum)
-			if _, err := os.Stat(metafile); os.IsNotExist(err) {
-				s.Warnf("    Missing consumer metafile %q", metafile)
-				continue
-			}
-			buf, err := os.ReadFile(metafile)
-			if err != nil {
-				s.Warnf("    Error reading consumer metafile %q: %v", metafile, err)
-				continue
-			}
-			if _, err := os.Stat(metasum); os.IsNotExist(err) {
-				s.Warnf("    Missing consumer checksum for %q", metasum)
+	// Streams can be in any of our store directories.
+	sem := make(chan struct{}, runtime.NumCPU())
+	for _, sdir := range js.streamsDirs(a.Name) {
+		fis, _ := os.ReadDir(sdir)
+		for _, fi := range fis {
+			// Left behind by an interrupted relocation, the stream is still in its old directory.
+			if strings.HasSuffix(fi.Name(), streamRelocateSuffix) {
+				os.RemoveAll(filepath.Join(sdir, fi.Name()))
 				continue
 			}
-
-			// Check if we are encrypted.
-			if key, err := os.ReadFile(filepath.Join(e.odir, ofi.Name(), JetStreamMetaFileKey)); err == nil {
-				s.Debugf("  Consumer metafile is encrypted, reading encrypted keyfile")
-				// Decode the buffer before proceeding.
-				ctxName := e.mset.name() + tsep + ofi.Name()
-				nbuf, err := s.decryptMeta(sc, key, buf, a.Name, ctxName)
-				if err != nil {
-					// See if we are changing ciphers.
-					switch sc {
-					case ChaCha:
-						nbuf, err = s.decryptMeta(AES, key, buf, a.Name, ctxName)
-					case AES:
-						nbuf, err = s.decryptMeta(ChaCha, key, buf, a.Name, ctxName)
-					}
-					if err != nil {
-						s.Warnf("  Error decrypting our consumer metafile: %v", err)
-						continue
+			sem <- struct{}{}
+			rwg.Add(1)
+			go func(sdir string, fi os.DirEntry) {
+				defer func() {
+					<-sem
+					rwg.Done()
+				}()
+				if err := recoverStream(sdir, fi); err != nil {
+					rmu.Lock()
+					if rerr == nil {
+						rerr = err
 					}
+					rmu.Unlock()
 				}
-				buf = nbuf
-			}
-
-			var cfg FileConsumerInfo
-			if err := json.Unmarshal(buf, &cfg); err != nil {
-				s.Warnf("    Error unmarshalling consumer metafile %q: %v", metafile, err)
-				continue
-			}
-			isEphemeral := !isDurableConsumer(&cfg.ConsumerConfig)
-			if isEphemeral {
-				// This is an ephermal consumer and this could fail on restart until
-				// the consumer can reconnect. We will create it as a durable and switch it.
-				cfg.ConsumerConfig.Durable = ofi.Name()
-			}
-			obs, err := e.mset.addConsumerWithAssignment(&cfg.ConsumerConfig, _EMPTY_, nil, true)
-			if err != nil {
-				s.Warnf("    Error adding consumer %q: %v", cfg.Name, err)
-				continue
-			}
-			if isEphemeral {
-				obs.switchToEphemeral()
-			}
-			if !cfg.Created.IsZero() {
-				obs.setCreatedTime(cfg.Created)
-			}
-			lseq := e.mset.lastSeq()
-			obs.mu.Lock()
-			err = obs.readStoredState(lseq)
-			obs.mu.Unlock()
-			if err != nil {
-				s.Warnf("    Error restoring consumer %q state: %v", cfg.Name, err)
-			}
+			}(sdir, fi)
 		}
 	}
+	rwg.Wait()
+	if rerr != nil {
+		return rerr
+	}
+
+	for _, e := range consumers {
+		a.recoverConsumers(e.mset, e.odir)
+	}
 
 	// Make sure to cleanup any old remaining snapshots.
 	os.RemoveAll(filepath.Join(jsa.storeDir, snapsDir))
@@ -1393,6 +1641,89 @@ func (a *Account) EnableJetStream(limits map[string]JetStreamAccountLimits) erro
 	return nil
 }
 
+// recoverConsumers will recover the consumers of a stream from their directory.
+// Consumers that fail to recover are skipped.
+func (a *Account) recoverConsumers(mset *stream, odir string) {
+	a.mu.RLock()
+	s := a.srv
+	a.mu.RUnlock()
+	sc := s.getOpts().JetStreamCipher
+
+	ofis, _ := os.ReadDir(odir)
+	if len(ofis) > 0 {
+		s.Noticef("  Recovering %d consumers for stream - '%s > %s'", len(ofis), mset.accName(), mset.name())
+	}
+	for _, ofi := range ofis {
+		metafile := filepath.Join(odir, ofi.Name(), JetStreamMetaFile)
+		metasum := filepath.Join(odir, ofi.Name(), JetStreamMetaFileSum)
+		if _, err := os.Stat(metafile); os.IsNotExist(err) {
+			s.Warnf("    Missing consumer metafile %q", metafile)
+			continue
+		}
+		buf, err := os.ReadFile(metafile)
+		if err != nil {
+			s.Warnf("    Error reading consumer metafile %q: %v", metafile, err)
+			continue
+		}
+		if _, err := os.Stat(metasum); os.IsNotExist(err) {
+			s.Warnf("    Missing consumer checksum for %q", metasum)
+			continue
+		}
+
+		// Check if we are encrypted.
+		if key, err := os.ReadFile(filepath.Join(odir, ofi.Name(), JetStreamMetaFileKey)); err == nil {
+			s.Debugf("  Consumer metafile is encrypted, reading encrypted keyfile")
+			// Decode the buffer before proceeding.
+			ctxName := mset.name() + tsep + ofi.Name()
+			nbuf, err := s.decryptMeta(sc, key, buf, a.Name, ctxName)
+			if err != nil {
+				// See if we are changing ciphers.
+				switch sc {
+				case ChaCha:
+					nbuf, err = s.decryptMeta(AES, key, buf, a.Name, ctxName)
+				case AES:
+					nbuf, err = s.decryptMeta(ChaCha, key, buf, a.Name, ctxName)
+				}
+				if err != nil {
+					s.Warnf("  Error decrypting our consumer metafile: %v", err)
+					continue
+				}
+			}
+			buf = nbuf
+		}
+
+		var cfg FileConsumerInfo
+		if err := json.Unmarshal(buf, &cfg); err != nil {
+			s.Warnf("    Error unmarshalling consumer metafile %q: %v", metafile, err)
+			continue
+		}
+		isEphemeral := !isDurableConsumer(&cfg.ConsumerConfig)
+		if isEphemeral {
+			// This is an ephermal consumer and this could fail on restart until
+			// the consumer can reconnect. We will create it as a durable and switch it.
+			cfg.ConsumerConfig.Durable = ofi.Name()
+		}
+		obs, err := mset.addConsumerWithAssignment(&cfg.ConsumerConfig, _EMPTY_, nil, true)
+		if err != nil {
+			s.Warnf("    Error adding consumer %q: %v", cfg.Name, err)
+			continue
+		}
+		if isEphemeral {
+			obs.switchToEphemeral()
+		}
+		if !cfg.Created.IsZero() {
+			obs.setCreatedTime(cfg.Created)
+		}
+		lseq := mset.lastSeq()
+		obs.mu.Lock()
+		err = obs.readStoredState(lseq)
+		obs.mu.Unlock()
+		if err != nil {
+			s.Warnf("    Error restoring consumer %q state: %v", cfg.Name, err)
+		}
+	}
+}
+
 // Return whether we require MaxBytes to be set and if > 0 an upper limit for stream size exists
 // Both limits are independent of each other.
 func (a *Account) maxBytesLimits(cfg *StreamConfig) (bool, int64) {
@@ -1645,13 +1976,114 @@ func (a *Account) DisableJetStream() error {
 	return a.removeJetStream()
 }
 
+// DisableJetStreamGraceful will disable JetStream for the account but retain the stored data
+// read only for the retention period. Publishes and changes to streams or consumers will be
+// rejected, but existing streams and consumers can still be read. Enabling JetStream for the
+// account again within the retention period will restore it, otherwise it will be disabled.
+func (a *Account) DisableJetStreamGraceful(retention time.Duration) error {
+	if retention <= 0 {
+		return a.DisableJetStream()
+	}
+	a.mu.RLock()
+	s, jsa := a.srv, a.js
+	a.mu.RUnlock()
+
+	if s == nil {
+		return fmt.Errorf("jetstream account not registered")
+	}
+	if jsa == nil {
+		return NewJSNotEnabledForAccountError()
+	}
+
+	jsa.mu.Lock()
+	defer jsa.mu.Unlock()
+	// If we are already disabling keep the original deadline.
+	if jsa.dtimer != nil {
+		return nil
+	}
+	atomic.StoreInt32(&jsa.readOnly, 1)
+	jsa.dtimer = time.AfterFunc(retention, func() { a.disableRetainedJetStream(jsa) })
+	s.Noticef("JetStream disabled for account %q, retaining data read only for %v", a.Name, retention)
+	return nil
+}
+
+// Called when the retention period of a gracefully disabled account expires.
+func (a *Account) disableRetainedJetStream(jsa *jsAccount) {
+	jsa.mu.Lock()
+	expired := jsa.dtimer != nil
+	jsa.dtimer = nil
+	jsa.mu.Unlock()
+
+	a.mu.RLock()
+	s, cur := a.srv, a.js
+	a.mu.RUnlock()
+
+	// Check we were not restored in the meantime.
+	if !expired || cur != jsa || s == nil {
+		return
+	}
+	s.Noticef("JetStream retention period for account %q expired", a.Name)
+	a.removeJetStream()
+	// Keep answering info requests like any other account without JetStream.
+	if a != s.SystemAccount() {
+		if err := a.enableJetStreamInfoServiceImportOnly(); err != nil {
+			s.Warnf("Error setting up jetstream info service imports for account %q: %v", a.Name, err)
+		}
+	}
+}
+
+// restore will undo a graceful disable. Returns true if we were gracefully disabled.
+func (jsa *jsAccount) restore() bool {
+	jsa.mu.Lock()
+	defer jsa.mu.Unlock()
+	if jsa.dtimer == nil {
+		return false
+	}
+	jsa.dtimer.Stop()
+	jsa.dtimer = nil
+	atomic.StoreInt32(&jsa.readOnly, 0)
+	return true
+}
+
+// restoreJetStream will undo a graceful disable of JetStream for the account.
+func (a *Account) restoreJetStream() {
+	a.mu.RLock()
+	s, jsa := a.srv, a.js
+	a.mu.RUnlock()
+	if jsa != nil && jsa.restore() {
+		s.Noticef("JetStream restored for account %q", a.Name)
+	}
+}
+
+// isReadOnly returns true if JetStream was gracefully disabled for the account.
+func (jsa *jsAccount) isReadOnly() bool {
+	return jsa != nil && atomic.LoadInt32(&jsa.readOnly) == 1
+}
+
+// jetStreamReadOnly returns true if JetStream was gracefully disabled for the account
+// and we only retain the stored data read only.
+func (a *Account) jetStreamReadOnly() bool {
+	if a == nil {
+		return false
+	}
+	a.mu.RLock()
+	jsa := a.js
+	a.mu.RUnlock()
+	return jsa.isReadOnly()
+}
+
 // removeJetStream is called when JetStream has been disabled for this account.
 func (a *Account) removeJetStream() error {
 	a.mu.Lock()
-	s := a.srv
+	s, jsa := a.srv, a.js
 	a.js = nil
 	a.mu.Unlock()
 
+	// Make sure to stop any retention timer.
+	if jsa != nil {
+		jsa.restore()
+	}
+
 	if s == nil {
 		return fmt.Errorf("jetstream account not registered")
 	}
@@ -1800,11 +2232,15 @@ func (jsa *jsAccount) updateUsage(tierName string, storeType StorageType, delta
 	if storeType == MemoryStorage {
 		s.local.mem += delta
 		s.total.mem += delta
-		atomic.AddInt64(&js.memUsed, delta)
+		if !jsa.sys {
+			atomic.AddInt64(&js.memUsed, delta)
+		}
 	} else {
 		s.local.store += delta
 		s.total.store += delta
-		atomic.AddInt64(&js.storeUsed, delta)
+		if !jsa.sys {
+			atomic.AddInt64(&js.storeUsed, delta)
+		}
 	}
 	// Publish our local updates if in clustered mode.
 	if isClustered {
@@ -2099,6 +2535,10 @@ func (js *jetStream) usageStats() *JetStreamStats {
 	stats.ReservedMemory = (uint64)(js.memReserved)
 	stats.ReservedStore = (uint64)(js.storeReserved)
 	s := js.srv
+	accounts := make([]*jsAccount, 0, len(js.accounts))
+	for _, jsa := range js.accounts {
+		accounts = append(accounts, jsa)
+	}
 	js.mu.RUnlock()
 	stats.API.Total = (uint64)(atomic.LoadInt64(&js.apiTotal))
 	stats.API.Errors = (uint64)(atomic.LoadInt64(&js.apiErrors))
@@ -2106,6 +2546,25 @@ func (js *jetStream) usageStats() *JetStreamStats {
 	stats.Memory = (uint64)(atomic.LoadInt64(&js.memUsed))
 	stats.Store = (uint64)(atomic.LoadInt64(&js.storeUsed))
 	stats.HAAssets = s.numRaftNodes()
+	js.mu.RLock()
+	stats.MemoryTimeToFull, stats.StoreTimeToFull = js.memFcast.ttf, js.storeFcast.ttf
+	js.mu.RUnlock()
+
+	for _, jsa := range accounts {
+		jsa.mu.RLock()
+		streams := make([]*stream, 0, len(jsa.streams))
+		for _, mset := range jsa.streams {
+			streams = append(streams, mset)
+		}
+		jsa.mu.RUnlock()
+		stats.Streams += len(streams)
+		for _, mset := range streams {
+			state := mset.state()
+			stats.Messages += state.Msgs
+			stats.Bytes += state.Bytes
+			stats.Consumers += state.Consumers
+		}
+	}
 	return &stats
 }
 
@@ -2169,16 +2628,22 @@ func (js *jetStream) sufficientResources(limits map[string]JetStreamAccountLimit
 // This will reserve the stream resources requested.
 // This will spin off off of MaxBytes.
 func (js *jetStream) reserveStreamResources(cfg *StreamConfig) {
-	if cfg == nil || cfg.MaxBytes <= 0 {
+	if cfg == nil || cfg.MaxBytes <= 0 && cfg.MemoryHeadBytes <= 0 {
 		return
 	}
 
 	js.mu.Lock()
-	switch cfg.Storage {
-	case MemoryStorage:
-		js.memReserved += cfg.MaxBytes
-	case FileStorage:
-		js.storeReserved += cfg.MaxBytes
+	if cfg.MaxBytes > 0 {
+		switch cfg.Storage {
+		case MemoryStorage:
+			js.memReserved += cfg.MaxBytes
+		case FileStorage:
+			js.storeReserved += cfg.MaxBytes
+		}
+	}
+	// The memory head of a file store is held in memory.
+	if cfg.MemoryHeadBytes > 0 {
+		js.memReserved += cfg.MemoryHeadBytes
 	}
 	s, clustered := js.srv, !js.standAlone
 	js.mu.Unlock()
@@ -2190,16 +2655,21 @@ func (js *jetStream) reserveStreamResources(cfg *StreamConfig) {
 
 // Release reserved resources held by a stream.
 func (js *jetStream) releaseStreamResources(cfg *StreamConfig) {
-	if cfg == nil || cfg.MaxBytes <= 0 {
+	if cfg == nil || cfg.MaxBytes <= 0 && cfg.MemoryHeadBytes <= 0 {
 		return
 	}
 
 	js.mu.Lock()
-	switch cfg.Storage {
-	case MemoryStorage:
-		js.memReserved -= cfg.MaxBytes
-	case FileStorage:
-		js.storeReserved -= cfg.MaxBytes
+	if cfg.MaxBytes > 0 {
+		switch cfg.Storage {
+		case MemoryStorage:
+			js.memReserved -= cfg.MaxBytes
+		case FileStorage:
+			js.storeReserved -= cfg.MaxBytes
+		}
+	}
+	if cfg.MemoryHeadBytes > 0 {
+		js.memReserved -= cfg.MemoryHeadBytes
 	}
 	s, clustered := js.srv, !js.standAlone
 	js.mu.Unlock()
@@ -2677,6 +3147,49 @@ func validateJetStreamOptions(o *Options) error {
 			return fmt.Errorf("invalid domain name: may not contain ., * or >")
 		}
 	}
+	// API tokens identify the account, so need to be unique.
+	tokens := make(map[string]string)
+	for _, acc := range o.Accounts {
+		for _, jt := range acc.jsTokens {
+			if a, ok := tokens[jt.Token]; ok {
+				return fmt.Errorf("duplicate JetStream API token in accounts %q and %q", a, acc.Name)
+			}
+			tokens[jt.Token] = acc.Name
+		}
+	}
+	if err := validateJetStreamStandby(o); err != nil {
+		return err
+	}
+	if err := validateJetStreamBilling(o); err != nil {
+		return err
+	}
+	if err := validateJetStreamOrphans(o); err != nil {
+		return err
+	}
+	if err := validateJetStreamMaintenance(o); err != nil {
+		return err
+	}
+	if err := validateJetStreamConsumerMetrics(o); err != nil {
+		return err
+	}
+	if err := validateJetStreamStatsHistory(o); err != nil {
+		return err
+	}
+	if err := validateJetStreamStoreDirs(o); err != nil {
+		return err
+	}
+	if err := validateJetStreamClockSkew(o); err != nil {
+		return err
+	}
+	if err := validateJetStreamWebhooks(o); err != nil {
+		return err
+	}
+	if err := validateJetStreamRemotes(o); err != nil {
+		return err
+	}
+	if err := validateJetStreamAggregates(o); err != nil {
+		return err
+	}
 	// If not clustered no checks needed past here.
 	if !o.JetStream || o.Cluster.Port == 0 {
 		return nil
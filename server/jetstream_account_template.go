@@ -0,0 +1,82 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"path"
+)
+
+// JSAccountTemplate enables JetStream with the same limits for accounts that do not enable it
+// themselves, e.g. accounts that are registered dynamically or resolved from JWTs.
+type JSAccountTemplate struct {
+	// Patterns of the account names the template applies to, e.g. "tenant-*". All accounts when empty,
+	// except the global account, which is only enabled by a pattern matching it.
+	Accounts []string
+	Limits   map[string]JetStreamAccountLimits
+}
+
+// matches returns true if the template applies to the account name.
+func (t *JSAccountTemplate) matches(name string) bool {
+	if len(t.Accounts) == 0 {
+		return name != globalAccountName
+	}
+	for _, p := range t.Accounts {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// jsAccountTemplateLimits returns the limits of the JetStream account template if it applies to the account.
+// The system account is never enabled this way.
+func (s *Server) jsAccountTemplateLimits(name string) map[string]JetStreamAccountLimits {
+	opts := s.getOpts()
+	t := opts.JetStreamAccTemplate
+	if t == nil || name == opts.SystemAccount || name == DEFAULT_SYSTEM_ACCOUNT || !t.matches(name) {
+		return nil
+	}
+	limits := make(map[string]JetStreamAccountLimits, len(t.Limits))
+	for tier, l := range t.Limits {
+		limits[tier] = l
+	}
+	return limits
+}
+
+// reloadJetStreamAccountTemplate applies a changed JetStream account template to the existing
+// accounts that do not enable JetStream themselves, enabling, updating or disabling JetStream.
+func (s *Server) reloadJetStreamAccountTemplate() {
+	if !s.JetStreamEnabled() {
+		return
+	}
+	var changed []*Account
+	s.accounts.Range(func(k, v interface{}) bool {
+		acc := v.(*Account)
+		acc.mu.Lock()
+		if acc.jsTemplate || len(acc.jsLimits) == 0 {
+			limits := s.jsAccountTemplateLimits(acc.Name)
+			if acc.jsTemplate || limits != nil {
+				acc.jsLimits, acc.jsTemplate = limits, limits != nil
+				changed = append(changed, acc)
+			}
+		}
+		acc.mu.Unlock()
+		return true
+	})
+	for _, acc := range changed {
+		if err := s.configJetStream(acc); err != nil {
+			s.Errorf("Error configuring jetstream for account [%s]: %v", acc.traceLabel(), err)
+		}
+	}
+}
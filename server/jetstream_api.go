@@ -15,6 +15,8 @@ package server
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -42,6 +44,7 @@ const (
 	JSApiPrefix = "$JS.API"
 
 	// JSApiAccountInfo is for obtaining general information about JetStream for this account.
+	// The response also has the capabilities of the server, for clients to detect features.
 	// Will return JSON response.
 	JSApiAccountInfo = "$JS.API.INFO"
 
@@ -74,12 +77,87 @@ const (
 	JSApiStreamUpdate  = "$JS.API.STREAM.UPDATE.*"
 	JSApiStreamUpdateT = "$JS.API.STREAM.UPDATE.%s"
 
+	// JSApiStreamConfigHistory is the endpoint to get the config revisions of a stream.
+	// Will return JSON response.
+	JSApiStreamConfigHistory  = "$JS.API.STREAM.CONFIG.HISTORY.*"
+	JSApiStreamConfigHistoryT = "$JS.API.STREAM.CONFIG.HISTORY.%s"
+
+	// JSApiStreamStatsHistory is the endpoint to get the recent stats history of a stream.
+	// Will return JSON response.
+	JSApiStreamStatsHistory  = "$JS.API.STREAM.STATS.HISTORY.*"
+	JSApiStreamStatsHistoryT = "$JS.API.STREAM.STATS.HISTORY.%s"
+
+	// JSApiStreamFilterCheck is the endpoint to check a proposed consumer filter subject against a stream.
+	// Will return JSON response.
+	JSApiStreamFilterCheck  = "$JS.API.STREAM.FILTER.CHECK.*"
+	JSApiStreamFilterCheckT = "$JS.API.STREAM.FILTER.CHECK.%s"
+
+	// JSApiStreamPartitionHeartbeat is the endpoint for a worker to join the partitions of a WorkQueue stream and stay alive.
+	// Will return JSON response.
+	JSApiStreamPartitionHeartbeat  = "$JS.API.STREAM.PARTITION.HEARTBEAT.*"
+	JSApiStreamPartitionHeartbeatT = "$JS.API.STREAM.PARTITION.HEARTBEAT.%s"
+
+	// JSApiStreamPartitionLeave is the endpoint for a worker to leave the partitions of a WorkQueue stream.
+	// Will return JSON response.
+	JSApiStreamPartitionLeave  = "$JS.API.STREAM.PARTITION.LEAVE.*"
+	JSApiStreamPartitionLeaveT = "$JS.API.STREAM.PARTITION.LEAVE.%s"
+
+	// JSApiStreamPartitionInfo is the endpoint to get the partitions of all workers of a WorkQueue stream.
+	// Will return JSON response.
+	JSApiStreamPartitionInfo  = "$JS.API.STREAM.PARTITION.INFO.*"
+	JSApiStreamPartitionInfoT = "$JS.API.STREAM.PARTITION.INFO.%s"
+
+	// JSApiStreamRetentionPreview is the endpoint to preview what new limits would remove from a stream.
+	// Will return JSON response.
+	JSApiStreamRetentionPreview  = "$JS.API.STREAM.RETENTION.PREVIEW.*"
+	JSApiStreamRetentionPreviewT = "$JS.API.STREAM.RETENTION.PREVIEW.%s"
+
+	// JSApiStreamShadowSample is the endpoint to change the sample rate of a stream shadow.
+	// Will return JSON response.
+	JSApiStreamShadowSample  = "$JS.API.STREAM.SHADOW.SAMPLE.*"
+	JSApiStreamShadowSampleT = "$JS.API.STREAM.SHADOW.SAMPLE.%s"
+
+	// JSApiStreamReopen is the endpoint to let a stream that failed after repeated store errors accept messages again.
+	// Will return JSON response.
+	JSApiStreamReopen  = "$JS.API.STREAM.REOPEN.*"
+	JSApiStreamReopenT = "$JS.API.STREAM.REOPEN.%s"
+
+	// JSApiStreamTombstones is the endpoint to get the tombstones of messages removed from a stream.
+	// Will return JSON response.
+	JSApiStreamTombstones  = "$JS.API.STREAM.TOMBSTONES.*"
+	JSApiStreamTombstonesT = "$JS.API.STREAM.TOMBSTONES.%s"
+
+	// JSApiStreamConfigRollback is the endpoint to update a stream back to a prior config revision.
+	// Will return JSON response.
+	JSApiStreamConfigRollback  = "$JS.API.STREAM.CONFIG.ROLLBACK.*"
+	JSApiStreamConfigRollbackT = "$JS.API.STREAM.CONFIG.ROLLBACK.%s"
+
 	// JSApiStreams is the endpoint to list all stream names for this account.
 	// Will return JSON response.
 	JSApiStreams = "$JS.API.STREAM.NAMES"
 	// JSApiStreamList is the endpoint that will return all detailed stream information
 	JSApiStreamList = "$JS.API.STREAM.LIST"
 
+	// JSApiStreamBatch is the endpoint to store a batch of messages across streams, on a best effort basis.
+	// Messages stored before one fails are removed again. Not supported in clustered mode.
+	// Will return JSON response.
+	JSApiStreamBatch = "$JS.API.STREAM.BATCH"
+
+	// JSApiShardedStreamCreate is the endpoint to create a stream sharded across multiple streams.
+	// Will return JSON response.
+	JSApiShardedStreamCreate  = "$JS.API.STREAM.SHARDED.CREATE.*"
+	JSApiShardedStreamCreateT = "$JS.API.STREAM.SHARDED.CREATE.%s"
+
+	// JSApiShardedStreamInfo is the endpoint to get information and aggregate state of a sharded stream.
+	// Will return JSON response.
+	JSApiShardedStreamInfo  = "$JS.API.STREAM.SHARDED.INFO.*"
+	JSApiShardedStreamInfoT = "$JS.API.STREAM.SHARDED.INFO.%s"
+
+	// JSApiShardedStreamDelete is the endpoint to delete all shards of a sharded stream.
+	// Will return JSON response.
+	JSApiShardedStreamDelete  = "$JS.API.STREAM.SHARDED.DELETE.*"
+	JSApiShardedStreamDeleteT = "$JS.API.STREAM.SHARDED.DELETE.%s"
+
 	// JSApiStreamInfo is for obtaining general information about a named stream.
 	// Will return JSON response.
 	JSApiStreamInfo  = "$JS.API.STREAM.INFO.*"
@@ -112,11 +190,31 @@ const (
 	JSApiMsgDelete  = "$JS.API.STREAM.MSG.DELETE.*"
 	JSApiMsgDeleteT = "$JS.API.STREAM.MSG.DELETE.%s"
 
+	// JSApiMsgPin is the endpoint to pin or unpin a message in a stream.
+	// Will return JSON response.
+	JSApiMsgPin  = "$JS.API.STREAM.MSG.PIN.*"
+	JSApiMsgPinT = "$JS.API.STREAM.MSG.PIN.%s"
+
+	// JSApiStreamWriter is the endpoint to acquire, or release, the writer lease of a single writer stream.
+	// The stream leader answers. Will return JSON response.
+	JSApiStreamWriter  = "$JS.API.STREAM.WRITER.*"
+	JSApiStreamWriterT = "$JS.API.STREAM.WRITER.%s"
+
+	// JSApiStreamRelocate is the endpoint to move the files of a stream to another store directory of the server.
+	// Will return JSON response.
+	JSApiStreamRelocate  = "$JS.API.STREAM.RELOCATE.*"
+	JSApiStreamRelocateT = "$JS.API.STREAM.RELOCATE.%s"
+
 	// JSApiMsgGet is the template for direct requests for a message by its stream sequence number.
 	// Will return JSON response.
 	JSApiMsgGet  = "$JS.API.STREAM.MSG.GET.*"
 	JSApiMsgGetT = "$JS.API.STREAM.MSG.GET.%s"
 
+	// JSApiMsgLookup is the endpoint to get the messages of a stream by the value of its indexed header.
+	// Will return JSON response.
+	JSApiMsgLookup  = "$JS.API.STREAM.MSG.LOOKUP.*"
+	JSApiMsgLookupT = "$JS.API.STREAM.MSG.LOOKUP.%s"
+
 	// JSDirectMsgGet is the template for non-api layer direct requests for a message by its stream sequence number or last by subject.
 	// Will return the message similar to how a consumer receives the message, no JSON processing.
 	// If the message can not be found we will use a status header of 404. If the stream does not exist the client will get a no-responders or timeout.
@@ -140,11 +238,31 @@ const (
 	JSApiConsumerCreateEx  = "$JS.API.CONSUMER.CREATE.*.>"
 	JSApiConsumerCreateExT = "$JS.API.CONSUMER.CREATE.%s.%s.%s"
 
+	// JSApiShardedConsumerCreate is the endpoint to create consumers on the shard of a sharded stream
+	// selected by the consumer's filter subject. Will return JSON response.
+	JSApiShardedConsumerCreate  = "$JS.API.CONSUMER.SHARDED.CREATE.*"
+	JSApiShardedConsumerCreateT = "$JS.API.CONSUMER.SHARDED.CREATE.%s"
+
 	// JSApiDurableCreate is the endpoint to create durable consumers for streams.
 	// You need to include the stream and consumer name in the subject.
 	JSApiDurableCreate  = "$JS.API.CONSUMER.DURABLE.CREATE.*.*"
 	JSApiDurableCreateT = "$JS.API.CONSUMER.DURABLE.CREATE.%s.%s"
 
+	// JSApiConsumerReattach is the endpoint to reattach to an existing consumer by name, e.g. an
+	// ephemeral within its inactivity threshold. Will return JSON response.
+	JSApiConsumerReattach  = "$JS.API.CONSUMER.REATTACH.*.*"
+	JSApiConsumerReattachT = "$JS.API.CONSUMER.REATTACH.%s.%s"
+
+	// JSApiConsumerAttach is the endpoint to attach to an exclusive consumer. The consumer leader answers.
+	// Will return JSON response.
+	JSApiConsumerAttach  = "$JS.API.CONSUMER.ATTACH.*.*"
+	JSApiConsumerAttachT = "$JS.API.CONSUMER.ATTACH.%s.%s"
+
+	// JSApiConsumerTemplateCreate is the endpoint to create a consumer from a consumer template of the stream.
+	// Will return JSON response.
+	JSApiConsumerTemplateCreate  = "$JS.API.CONSUMER.TEMPLATE.CREATE.*.*"
+	JSApiConsumerTemplateCreateT = "$JS.API.CONSUMER.TEMPLATE.CREATE.%s.%s"
+
 	// JSApiConsumers is the endpoint to list all consumer names for the stream.
 	// Will return JSON response.
 	JSApiConsumers  = "$JS.API.CONSUMER.NAMES.*"
@@ -217,6 +335,12 @@ const (
 	JSApiServerStreamCancelMove  = "$JS.API.ACCOUNT.STREAM.CANCEL_MOVE.*.*"
 	JSApiServerStreamCancelMoveT = "$JS.API.ACCOUNT.STREAM.CANCEL_MOVE.%s.%s"
 
+	// JSApiServerStreamBulkLoad is the endpoint to bulk load a stream from a file local to the server.
+	// Only works from system account and for streams that are not clustered.
+	// Will return JSON response.
+	JSApiServerStreamBulkLoad  = "$JS.API.ACCOUNT.STREAM.BULK_LOAD.*.*"
+	JSApiServerStreamBulkLoadT = "$JS.API.ACCOUNT.STREAM.BULK_LOAD.%s.%s"
+
 	// jsAckT is the template for the ack message stream coming back from a consumer
 	// when they ACK/NAK, etc a message.
 	jsAckT      = "$JS.ACK.%s.%s"
@@ -237,6 +361,9 @@ const (
 	// JSMetricConsumerAckPre is a metric containing ack latency.
 	JSMetricConsumerAckPre = "$JS.EVENT.METRIC.CONSUMER.ACK"
 
+	// JSMetricConsumerDeliveryPre is a metric containing the delivery state of a consumer, published periodically.
+	JSMetricConsumerDeliveryPre = "$JS.EVENT.METRIC.CONSUMER.DELIVERY"
+
 	// JSAdvisoryConsumerMaxDeliveryExceedPre is a notification published when a message exceeds its delivery threshold.
 	JSAdvisoryConsumerMaxDeliveryExceedPre = "$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES"
 
@@ -246,6 +373,33 @@ const (
 	// JSAdvisoryConsumerMsgTerminatedPre is a notification published when a message has been terminated.
 	JSAdvisoryConsumerMsgTerminatedPre = "$JS.EVENT.ADVISORY.CONSUMER.MSG_TERMINATED"
 
+	// JSAdvisoryConsumerMsgDroppedPre is a notification published when a pending message has been dropped at max ack pending.
+	JSAdvisoryConsumerMsgDroppedPre = "$JS.EVENT.ADVISORY.CONSUMER.MSG_DROPPED"
+
+	// JSAdvisoryConsumerPausedPre is a notification published when a consumer has been paused by a client.
+	JSAdvisoryConsumerPausedPre = "$JS.EVENT.ADVISORY.CONSUMER.PAUSED"
+
+	// JSAdvisoryConsumerDegradedPre is a notification published when a push consumer pauses or resumes delivery for a slow client.
+	JSAdvisoryConsumerDegradedPre = "$JS.EVENT.ADVISORY.CONSUMER.DEGRADED"
+
+	// JSAdvisoryConsumerActivePre is a notification published when a push consumer gains delivery interest.
+	JSAdvisoryConsumerActivePre = "$JS.EVENT.ADVISORY.CONSUMER.ACTIVE"
+
+	// JSAdvisoryConsumerInactivePre is a notification published when a push consumer loses delivery interest.
+	JSAdvisoryConsumerInactivePre = "$JS.EVENT.ADVISORY.CONSUMER.INACTIVE"
+
+	// JSAdvisoryConsumerInactiveDeletedPre is a notification published when a consumer is deleted
+	// because it was inactive for longer than its inactive threshold.
+	JSAdvisoryConsumerInactiveDeletedPre = "$JS.EVENT.ADVISORY.CONSUMER.INACTIVE_DELETED"
+
+	// JSAdvisoryConsumerOrphanedPre is a notification published when a durable pull consumer
+	// is orphaned, before it is deleted if orphans are deleted automatically.
+	JSAdvisoryConsumerOrphanedPre = "$JS.EVENT.ADVISORY.CONSUMER.ORPHANED"
+
+	// JSAdvisoryConsumerRedeliveryThresholdPre is a notification published when a message has been
+	// redelivered as many times as the consumer's redelivery advisory threshold.
+	JSAdvisoryConsumerRedeliveryThresholdPre = "$JS.EVENT.ADVISORY.CONSUMER.REDELIVERY_THRESHOLD"
+
 	// JSAdvisoryStreamCreatedPre notification that a stream was created.
 	JSAdvisoryStreamCreatedPre = "$JS.EVENT.ADVISORY.STREAM.CREATED"
 
@@ -255,6 +409,9 @@ const (
 	// JSAdvisoryStreamUpdatedPre notification that a stream was updated.
 	JSAdvisoryStreamUpdatedPre = "$JS.EVENT.ADVISORY.STREAM.UPDATED"
 
+	// JSAdvisoryStreamPartitionsPre notification that the partitions of a stream were assigned to its workers.
+	JSAdvisoryStreamPartitionsPre = "$JS.EVENT.ADVISORY.STREAM.PARTITIONS"
+
 	// JSAdvisoryConsumerCreatedPre notification that a template created.
 	JSAdvisoryConsumerCreatedPre = "$JS.EVENT.ADVISORY.CONSUMER.CREATED"
 
@@ -279,6 +436,18 @@ const (
 	// JSAdvisoryStreamQuorumLostPre notification that a stream and its consumers are stalled.
 	JSAdvisoryStreamQuorumLostPre = "$JS.EVENT.ADVISORY.STREAM.QUORUM_LOST"
 
+	// JSAdvisoryStreamFailedPre notification that a stream rejects messages after repeated store errors.
+	JSAdvisoryStreamFailedPre = "$JS.EVENT.ADVISORY.STREAM.FAILED"
+
+	// JSAdvisoryStreamReopenedPre notification that a failed stream accepts messages again.
+	JSAdvisoryStreamReopenedPre = "$JS.EVENT.ADVISORY.STREAM.REOPENED"
+
+	// JSAdvisoryStreamAckPendingPre notification that the consumers of a stream reached or dropped below its ack pending limit.
+	JSAdvisoryStreamAckPendingPre = "$JS.EVENT.ADVISORY.STREAM.ACK_PENDING"
+
+	// JSAdvisoryStreamMsgDeletedPre notification that messages were removed from a stream that keeps tombstones.
+	JSAdvisoryStreamMsgDeletedPre = "$JS.EVENT.ADVISORY.STREAM.MSG_DELETED"
+
 	// JSAdvisoryConsumerLeaderElectedPre notification that a replicated consumer has elected a leader.
 	JSAdvisoryConsumerLeaderElectedPre = "$JS.EVENT.ADVISORY.CONSUMER.LEADER_ELECTED"
 
@@ -291,9 +460,21 @@ const (
 	// JSAdvisoryServerRemoved notification that a server has been removed from the system.
 	JSAdvisoryServerRemoved = "$JS.EVENT.ADVISORY.SERVER.REMOVED"
 
+	// JSAdvisoryServerStorageForecast notification that server storage is forecasted to be full soon.
+	JSAdvisoryServerStorageForecast = "$JS.EVENT.ADVISORY.SERVER.STORAGE_FORECAST"
+
+	// JSAdvisoryAccountStorageForecast notification that account storage is forecasted to be full soon.
+	JSAdvisoryAccountStorageForecast = "$JS.EVENT.ADVISORY.ACCOUNT.STORAGE_FORECAST"
+
 	// JSAuditAdvisory is a notification about JetStream API access.
 	// FIXME - Add in details about who..
 	JSAuditAdvisory = "$JS.EVENT.ADVISORY.API"
+
+	// JSAdminAuditT is the system account subject for the administrative audit trail of an account.
+	JSAdminAuditT = "$JS.EVENT.AUDIT.ADMIN.%s"
+
+	// JSAdminAuditStream is the stream in the system account holding the administrative audit trail.
+	JSAdminAuditStream = "ADMIN_AUDIT"
 )
 
 var denyAllClientJs = []string{jsAllAPI, "$KV.>", "$OBJ.>"}
@@ -370,12 +551,23 @@ type ApiPaged struct {
 // ApiPagedRequest includes parameters allowing specific pages to be requests from APIs responding with ApiPaged
 type ApiPagedRequest struct {
 	Offset int `json:"offset"`
+	// Optional maximum number of entries to return, can not go above the API limit.
+	Limit int `json:"limit,omitempty"`
+}
+
+// pageLimit returns the number of entries to return for this request given the API limit.
+func (r *ApiPagedRequest) pageLimit(max int) int {
+	if r.Limit > 0 && r.Limit < max {
+		return r.Limit
+	}
+	return max
 }
 
 // JSApiAccountInfoResponse reports back information on jetstream for this account.
 type JSApiAccountInfoResponse struct {
 	ApiResponse
 	*JetStreamAccountStats
+	Capabilities *JSApiCapabilities `json:"capabilities,omitempty"`
 }
 
 const JSApiAccountInfoResponseType = "io.nats.jetstream.api.v1.account_info_response"
@@ -482,6 +674,129 @@ type JSApiStreamUpdateResponse struct {
 
 const JSApiStreamUpdateResponseType = "io.nats.jetstream.api.v1.stream_update_response"
 
+// JSApiStreamConfigHistoryResponse has the config revisions of a stream, oldest first.
+// Revisions are kept in memory and start over when the server restarts.
+type JSApiStreamConfigHistoryResponse struct {
+	ApiResponse
+	Revisions []*StreamConfigRevision `json:"revisions"`
+}
+
+const JSApiStreamConfigHistoryResponseType = "io.nats.jetstream.api.v1.stream_config_history_response"
+
+// JSApiStreamStatsHistoryRequest is optional, to only get samples taken after Since.
+type JSApiStreamStatsHistoryRequest struct {
+	Since time.Time `json:"since,omitempty"`
+}
+
+// JSApiStreamStatsHistoryResponse has the stats samples of a stream taken by the stream leader, oldest first.
+// Samples are kept in memory, start over when the server restarts and only if the stats history is configured.
+type JSApiStreamStatsHistoryResponse struct {
+	ApiResponse
+	Interval time.Duration        `json:"interval"`
+	Samples  []*StreamStatsSample `json:"samples"`
+}
+
+const JSApiStreamStatsHistoryResponseType = "io.nats.jetstream.api.v1.stream_stats_history_response"
+
+// JSApiStreamFilterCheckRequest has the proposed consumer filter subject, empty for an unfiltered consumer.
+type JSApiStreamFilterCheckRequest struct {
+	Filter string `json:"filter"`
+}
+
+// JSApiStreamFilterCheckResponse reports how a proposed consumer filter subject relates to a stream.
+type JSApiStreamFilterCheckResponse struct {
+	ApiResponse
+	Filter string `json:"filter"`
+	// Whether a consumer with this filter would be accepted by the stream.
+	Valid bool `json:"valid"`
+	// Stream subjects, including those from sources and mirrors, the filter matches.
+	Subjects []string `json:"subjects"`
+	// Set when the stream has external sources or mirrors whose subjects can not be checked.
+	External bool `json:"external,omitempty"`
+	// Consumers of a WorkQueue stream whose partitions overlap with the filter.
+	Overlaps []string `json:"overlapping_consumers,omitempty"`
+}
+
+const JSApiStreamFilterCheckResponseType = "io.nats.jetstream.api.v1.stream_filter_check_response"
+
+// JSApiStreamPartitionRequest is for a worker to heartbeat or leave the partitions of a WorkQueue stream.
+type JSApiStreamPartitionRequest struct {
+	Worker string `json:"worker"`
+	// How long the worker can go without a heartbeat before its partitions are reassigned.
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+// JSApiStreamPartitionResponse has the partitions of the worker, or of all workers for info requests.
+// Partitions are the names of the filtered consumers of the stream.
+type JSApiStreamPartitionResponse struct {
+	ApiResponse
+	// Changes with every rebalance.
+	Generation  uint64              `json:"generation"`
+	Partitions  []string            `json:"partitions,omitempty"`
+	Assignments map[string][]string `json:"assignments,omitempty"`
+}
+
+const JSApiStreamPartitionResponseType = "io.nats.jetstream.api.v1.stream_partition_response"
+
+// JSApiStreamRetentionPreviewRequest has the proposed limits of a stream.
+// Limits that are not set keep their current value, negative values remove the limit.
+type JSApiStreamRetentionPreviewRequest struct {
+	MaxAge   time.Duration `json:"max_age,omitempty"`
+	MaxMsgs  int64         `json:"max_msgs,omitempty"`
+	MaxBytes int64         `json:"max_bytes,omitempty"`
+}
+
+// JSApiStreamRetentionPreviewResponse reports what the proposed limits would remove from a stream
+// if they were applied now, and the limits that were used.
+type JSApiStreamRetentionPreviewResponse struct {
+	ApiResponse
+	MaxAge   time.Duration `json:"max_age"`
+	MaxMsgs  int64         `json:"max_msgs"`
+	MaxBytes int64         `json:"max_bytes"`
+	Msgs     uint64        `json:"msgs"`
+	Bytes    uint64        `json:"bytes"`
+	// The first sequence of the stream after the messages were removed.
+	FirstSeq uint64 `json:"first_seq"`
+}
+
+const JSApiStreamRetentionPreviewResponseType = "io.nats.jetstream.api.v1.stream_retention_preview_response"
+
+// JSApiStreamConfigRollbackRequest is to update a stream back to a prior config revision.
+// The response to this will come as JSApiStreamUpdateResponse/JSApiStreamUpdateResponseType.
+type JSApiStreamConfigRollbackRequest struct {
+	Revision uint64 `json:"revision"`
+}
+
+// JSApiStreamShadowSampleRequest is to change the percentage of messages a stream shadow forwards.
+// The response to this will come as JSApiStreamUpdateResponse/JSApiStreamUpdateResponseType.
+type JSApiStreamShadowSampleRequest struct {
+	Sample int `json:"sample"`
+}
+
+// JSApiStreamReopenResponse is the response to re-opening a failed stream.
+type JSApiStreamReopenResponse struct {
+	ApiResponse
+	Success bool `json:"success,omitempty"`
+}
+
+const JSApiStreamReopenResponseType = "io.nats.jetstream.api.v1.stream_reopen_response"
+
+// JSApiStreamTombstonesRequest is optional, to only get the tombstones overlapping with a range of sequences.
+type JSApiStreamTombstonesRequest struct {
+	StartSeq uint64 `json:"start_seq,omitempty"`
+	EndSeq   uint64 `json:"end_seq,omitempty"`
+}
+
+// JSApiStreamTombstonesResponse has the tombstones the stream leader keeps, oldest first.
+// Tombstones are kept in memory and start over when the server restarts.
+type JSApiStreamTombstonesResponse struct {
+	ApiResponse
+	Retention  time.Duration `json:"retention"`
+	Tombstones []*Tombstone  `json:"tombstones"`
+}
+
+const JSApiStreamTombstonesResponseType = "io.nats.jetstream.api.v1.stream_tombstones_response"
+
 // JSApiMsgDeleteRequest delete message request.
 type JSApiMsgDeleteRequest struct {
 	Seq     uint64 `json:"seq"`
@@ -495,6 +810,105 @@ type JSApiMsgDeleteResponse struct {
 
 const JSApiMsgDeleteResponseType = "io.nats.jetstream.api.v1.stream_msg_delete_response"
 
+// JSApiMsgPinRequest will pin, or unpin, a message so it is not removed by the stream limits.
+// The response to this will come as JSApiStreamUpdateResponse/JSApiStreamUpdateResponseType.
+type JSApiMsgPinRequest struct {
+	Seq   uint64 `json:"seq"`
+	Unpin bool   `json:"unpin,omitempty"`
+}
+
+// Header the stream leader sets on the stream updates that change the pins, and only the pins.
+// Regular updates keep the current pins. A forged header can at most pin messages that exist,
+// the stream leader drops the pins of others.
+const (
+	jsPinUpdateHdr = "Nats-Pin-Update"
+	// How long the stream leader waits for a pin update to be applied.
+	jsPinUpdateTimeout = 4 * time.Second
+)
+
+// JSApiStreamWriterRequest is to acquire the writer lease of a single writer stream. The writer
+// can acquire again with its fencing token, e.g. after reconnecting, and keeps it, or release it.
+// Taking over from the writer fences it off, its publishes are rejected.
+type JSApiStreamWriterRequest struct {
+	Fence    string `json:"fence,omitempty"`
+	Takeover bool   `json:"takeover,omitempty"`
+	Release  bool   `json:"release,omitempty"`
+}
+
+// JSApiStreamWriterResponse has the fencing token the writer needs to send in the
+// JSWriterFence header of its publishes.
+type JSApiStreamWriterResponse struct {
+	ApiResponse
+	Fence string        `json:"fence,omitempty"`
+	Lease time.Duration `json:"lease,omitempty"`
+}
+
+const JSApiStreamWriterResponseType = "io.nats.jetstream.api.v1.stream_writer_response"
+
+// JSApiStreamRelocateRequest is to move the files of a stream to another store directory.
+// The files are copied in the background, the stream is briefly unavailable when it switches
+// over to the new directory.
+type JSApiStreamRelocateRequest struct {
+	StoreDir string `json:"store_dir"`
+}
+
+// JSApiStreamRelocateResponse is sent once the relocation started. It is done once the
+// store directory is in the config of the stream.
+type JSApiStreamRelocateResponse struct {
+	ApiResponse
+	Relocating bool `json:"relocating,omitempty"`
+}
+
+const JSApiStreamRelocateResponseType = "io.nats.jetstream.api.v1.stream_relocate_response"
+
+// JSApiStreamBatchRequest is a batch of messages to store across any streams of the account.
+// If one can not be stored the ones before it are removed again. This is not isolated,
+// consumers can receive messages that are removed again.
+type JSApiStreamBatchRequest struct {
+	ID   string           `json:"batch_id"`
+	Msgs []*JSApiBatchMsg `json:"msgs"`
+}
+
+// JSApiBatchMsg is a single message of a batch.
+type JSApiBatchMsg struct {
+	Subject string `json:"subject"`
+	Header  []byte `json:"hdrs,omitempty"`
+	Data    []byte `json:"data,omitempty"`
+}
+
+// JSApiStreamBatchResponse has the acks for all messages in the batch in order.
+type JSApiStreamBatchResponse struct {
+	ApiResponse
+	ID   string    `json:"batch_id"`
+	Acks []*PubAck `json:"acks,omitempty"`
+}
+
+const JSApiStreamBatchResponseType = "io.nats.jetstream.api.v1.stream_batch_response"
+
+// JSApiShardedStreamCreateRequest is for creating a stream sharded across multiple streams.
+// The subject token at Token needs to be a single token wildcard in all subjects.
+type JSApiShardedStreamCreateRequest struct {
+	Config StreamConfig `json:"config"`
+	Shards int          `json:"shards"`
+	Token  int          `json:"token"`
+}
+
+// JSApiShardedStreamCreateResponse has the info for all shards that were created.
+type JSApiShardedStreamCreateResponse struct {
+	ApiResponse
+	*ShardedStreamInfo
+}
+
+const JSApiShardedStreamCreateResponseType = "io.nats.jetstream.api.v1.sharded_stream_create_response"
+
+// JSApiShardedStreamInfoResponse has the info for all shards and their aggregate state.
+type JSApiShardedStreamInfoResponse struct {
+	ApiResponse
+	*ShardedStreamInfo
+}
+
+const JSApiShardedStreamInfoResponseType = "io.nats.jetstream.api.v1.sharded_stream_info_response"
+
 type JSApiStreamSnapshotRequest struct {
 	// Subject to deliver the chunks to for the snapshot.
 	DeliverSubject string `json:"deliver_subject"`
@@ -606,6 +1020,8 @@ type JSApiMetaServerStreamMoveRequest struct {
 	Domain string `json:"domain,omitempty"`
 	// Ephemeral placement tags for the move
 	Tags []string `json:"tags,omitempty"`
+	// Cluster to move the stream to, defaults to any cluster with room
+	TargetCluster string `json:"target_cluster,omitempty"`
 }
 
 const JSApiAccountPurgeResponseType = "io.nats.jetstream.api.v1.account_purge_response"
@@ -621,6 +1037,13 @@ type JSApiMsgGetRequest struct {
 	Seq     uint64 `json:"seq,omitempty"`
 	LastFor string `json:"last_by_subj,omitempty"`
 	NextFor string `json:"next_by_subj,omitempty"`
+
+	// Get the first message stored at or after this time.
+	// Can be combined with NextFor to also filter by subject.
+	StartTime *time.Time `json:"start_time,omitempty"`
+
+	// Include the origin of the message, if recorded by the stream.
+	Origin bool `json:"origin,omitempty"`
 }
 
 type JSApiMsgGetResponse struct {
@@ -630,6 +1053,25 @@ type JSApiMsgGetResponse struct {
 
 const JSApiMsgGetResponseType = "io.nats.jetstream.api.v1.stream_msg_get_response"
 
+// JSApiMsgLookupRequest looks up messages by the value of the indexed header of a stream.
+type JSApiMsgLookupRequest struct {
+	Value string `json:"value"`
+	// Only return messages at or after this sequence, to page through many matches.
+	Seq uint64 `json:"seq,omitempty"`
+	// Most messages to return, capped at JSApiMsgLookupMaxMsgs.
+	Limit int `json:"limit,omitempty"`
+}
+
+// JSApiMsgLookupResponse holds the matching messages in stream order.
+// More is set when there are more than returned.
+type JSApiMsgLookupResponse struct {
+	ApiResponse
+	Messages []*StoredMsg `json:"messages,omitempty"`
+	More     bool         `json:"more,omitempty"`
+}
+
+const JSApiMsgLookupResponseType = "io.nats.jetstream.api.v1.stream_msg_lookup_response"
+
 // JSWaitQueueDefaultMax is the default max number of outstanding requests for pull consumers.
 const JSWaitQueueDefaultMax = 512
 
@@ -640,6 +1082,37 @@ type JSApiConsumerCreateResponse struct {
 
 const JSApiConsumerCreateResponseType = "io.nats.jetstream.api.v1.consumer_create_response"
 
+// JSApiConsumerReattachRequest is to reattach to an existing consumer.
+// Push consumers need the deliver subject of the reattaching client.
+// The response to this will come as JSApiConsumerCreateResponse/JSApiConsumerCreateResponseType.
+type JSApiConsumerReattachRequest struct {
+	DeliverSubject string `json:"deliver_subject,omitempty"`
+}
+
+// JSApiConsumerTemplateCreateRequest is to create a consumer from a consumer template of a stream,
+// with the values of the placeholders of the template. Existing consumers are not updated.
+// The response to this will come as JSApiConsumerCreateResponse/JSApiConsumerCreateResponseType.
+type JSApiConsumerTemplateCreateRequest struct {
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// JSApiConsumerAttachRequest is to attach to an exclusive consumer. The attached client
+// can attach again with its fencing token, e.g. after reconnecting, and keeps it.
+// Taking over from an attached client fences it off, its pull requests and acks are rejected.
+type JSApiConsumerAttachRequest struct {
+	Fence    string `json:"fence,omitempty"`
+	Takeover bool   `json:"takeover,omitempty"`
+}
+
+// JSApiConsumerAttachResponse has the fencing token the attached client needs to send
+// in the JSConsumerFence header of its pull requests and acks.
+type JSApiConsumerAttachResponse struct {
+	ApiResponse
+	Fence string `json:"fence,omitempty"`
+}
+
+const JSApiConsumerAttachResponseType = "io.nats.jetstream.api.v1.consumer_attach_response"
+
 type JSApiConsumerDeleteResponse struct {
 	ApiResponse
 	Success bool `json:"success,omitempty"`
@@ -656,6 +1129,11 @@ const JSApiConsumerInfoResponseType = "io.nats.jetstream.api.v1.consumer_info_re
 
 type JSApiConsumersRequest struct {
 	ApiPagedRequest
+	// Only consumers whose filter subject overlaps with this subject.
+	// Consumers without a filter subject will always match.
+	Subject string `json:"subject,omitempty"`
+	// Only orphaned consumers, not supported for consumer names.
+	Orphaned bool `json:"orphaned,omitempty"`
 }
 
 type JSApiConsumerNamesResponse struct {
@@ -682,6 +1160,10 @@ type JSApiConsumerGetNextRequest struct {
 	MaxBytes  int           `json:"max_bytes,omitempty"`
 	NoWait    bool          `json:"no_wait,omitempty"`
 	Heartbeat time.Duration `json:"idle_heartbeat,omitempty"`
+	// Barrier is a stream sequence that needs to be stored before any messages are
+	// delivered for this request. Mirrors keep the sequences of the origin stream, so a
+	// reader of a nearby mirror can pass the sequence from its PubAck to read its writes.
+	Barrier uint64 `json:"barrier,omitempty"`
 }
 
 // JSApiStreamTemplateCreateResponse for creating templates.
@@ -739,8 +1221,9 @@ func (js *jetStream) apiDispatch(sub *subscription, c *client, acc *Account, sub
 
 	hdr, _ := c.msgParts(rmsg)
 	if len(getHeader(ClientInfoHdr, hdr)) == 0 {
-		// Check if this is the system account. We will let these through for the account info only.
-		if s.SystemAccount() != acc || subject != JSApiAccountInfo {
+		// Check if this is the system account. We will let these through for the account info only,
+		// unless the system account has JetStream enabled for the audit trail.
+		if s.SystemAccount() != acc || (subject != JSApiAccountInfo && !acc.JetStreamEnabled()) {
 			return
 		}
 	}
@@ -777,7 +1260,7 @@ func (js *jetStream) apiDispatch(sub *subscription, c *client, acc *Account, sub
 	s.jsAPIRoutedReqs.push(&jsAPIRoutedReq{jsub, sub, acc, subject, reply, copyBytes(rmsg), c.pa})
 }
 
-func (s *Server) processJSAPIRoutedRequests() {
+func (s *Server) processJSAPIRoutedRequests(qch chan struct{}) {
 	defer s.grWG.Done()
 
 	s.mu.Lock()
@@ -798,6 +1281,8 @@ func (s *Server) processJSAPIRoutedRequests() {
 				}
 			}
 			queue.recycle(&reqs)
+		case <-qch:
+			return
 		case <-s.quitCh:
 			return
 		}
@@ -813,12 +1298,19 @@ func (s *Server) setJetStreamExportSubs() error {
 	// Start the go routine that will process API requests received by the
 	// subscription below when they are coming from routes, etc..
 	s.jsAPIRoutedReqs = newIPQueue[*jsAPIRoutedReq](s, "Routed JS API Requests")
-	s.startGoRoutine(s.processJSAPIRoutedRequests)
+	js.mu.RLock()
+	qch := js.quitCh
+	js.mu.RUnlock()
+	s.startGoRoutine(func() { s.processJSAPIRoutedRequests(qch) })
 
 	// This is the catch all now for all JetStream API calls.
-	if _, err := s.sysSubscribe(jsAllAPI, js.apiDispatch); err != nil {
+	sub, err := s.sysSubscribe(jsAllAPI, js.apiDispatch)
+	if err != nil {
 		return err
 	}
+	js.mu.Lock()
+	js.apiSub = sub
+	js.mu.Unlock()
 
 	if err := s.SystemAccount().AddServiceExport(jsAllAPI, nil); err != nil {
 		s.Warnf("Error setting up jetstream service exports: %v", err)
@@ -837,7 +1329,22 @@ func (s *Server) setJetStreamExportSubs() error {
 		{JSApiTemplateDelete, s.jsTemplateDeleteRequest},
 		{JSApiStreamCreate, s.jsStreamCreateRequest},
 		{JSApiStreamUpdate, s.jsStreamUpdateRequest},
+		{JSApiStreamConfigHistory, s.jsStreamConfigHistoryRequest},
+		{JSApiStreamStatsHistory, s.jsStreamStatsHistoryRequest},
+		{JSApiStreamFilterCheck, s.jsStreamFilterCheckRequest},
+		{JSApiStreamPartitionHeartbeat, s.jsStreamPartitionRequest},
+		{JSApiStreamPartitionLeave, s.jsStreamPartitionRequest},
+		{JSApiStreamPartitionInfo, s.jsStreamPartitionRequest},
+		{JSApiStreamRetentionPreview, s.jsStreamRetentionPreviewRequest},
+		{JSApiStreamConfigRollback, s.jsStreamConfigRollbackRequest},
+		{JSApiStreamReopen, s.jsStreamReopenRequest},
+		{JSApiStreamTombstones, s.jsStreamTombstonesRequest},
+		{JSApiStreamShadowSample, s.jsStreamShadowSampleRequest},
 		{JSApiStreams, s.jsStreamNamesRequest},
+		{JSApiStreamBatch, s.jsStreamBatchRequest},
+		{JSApiShardedStreamCreate, s.jsShardedStreamCreateRequest},
+		{JSApiShardedStreamInfo, s.jsShardedStreamInfoRequest},
+		{JSApiShardedStreamDelete, s.jsShardedStreamDeleteRequest},
 		{JSApiStreamList, s.jsStreamListRequest},
 		{JSApiStreamInfo, s.jsStreamInfoRequest},
 		{JSApiStreamDelete, s.jsStreamDeleteRequest},
@@ -848,10 +1355,18 @@ func (s *Server) setJetStreamExportSubs() error {
 		{JSApiStreamLeaderStepDown, s.jsStreamLeaderStepDownRequest},
 		{JSApiConsumerLeaderStepDown, s.jsConsumerLeaderStepDownRequest},
 		{JSApiMsgDelete, s.jsMsgDeleteRequest},
+		{JSApiMsgPin, s.jsMsgPinRequest},
+		{JSApiStreamWriter, s.jsStreamWriterRequest},
+		{JSApiStreamRelocate, s.jsStreamRelocateRequest},
 		{JSApiMsgGet, s.jsMsgGetRequest},
+		{JSApiMsgLookup, s.jsMsgLookupRequest},
 		{JSApiConsumerCreateEx, s.jsConsumerCreateRequest},
 		{JSApiConsumerCreate, s.jsConsumerCreateRequest},
 		{JSApiDurableCreate, s.jsConsumerCreateRequest},
+		{JSApiShardedConsumerCreate, s.jsShardedConsumerCreateRequest},
+		{JSApiConsumerReattach, s.jsConsumerReattachRequest},
+		{JSApiConsumerAttach, s.jsConsumerAttachRequest},
+		{JSApiConsumerTemplateCreate, s.jsConsumerTemplateCreateRequest},
 		{JSApiConsumers, s.jsConsumerNamesRequest},
 		{JSApiConsumerList, s.jsConsumerListRequest},
 		{JSApiConsumerInfo, s.jsConsumerInfoRequest},
@@ -929,6 +1444,10 @@ func (s *Server) getRequestInfo(c *client, raw []byte) (pci *ClientInfo, acc *Ac
 		if acc == nil {
 			acc = s.SystemAccount()
 		}
+		// Assignments for streams in the system account need to know their account.
+		if acc != nil {
+			ci.Account = acc.Name
+		}
 	}
 	if acc == nil {
 		return nil, nil, nil, nil, ErrMissingAccount
@@ -1018,6 +1537,7 @@ func (s *Server) jsAccountInfoRequest(sub *subscription, c *client, _ *Account,
 		stats := acc.JetStreamUsage()
 		resp.JetStreamAccountStats = &stats
 	}
+	resp.Capabilities = s.jsCapabilities()
 	b, err := json.Marshal(resp)
 	if err != nil {
 		return
@@ -1251,6 +1771,7 @@ func (jsa *jsAccount) tieredReservation(tier string, cfg *StreamConfig) int64 {
 					reservation += (int64(sa.cfg.Replicas) * sa.cfg.MaxBytes)
 				}
 			}
+			reservation += memoryHeadReservation(&sa.cfg, cfg)
 		}
 	} else {
 		for _, sa := range jsa.streams {
@@ -1260,6 +1781,7 @@ func (jsa *jsAccount) tieredReservation(tier string, cfg *StreamConfig) int64 {
 						reservation += (int64(sa.cfg.Replicas) * sa.cfg.MaxBytes)
 					}
 				}
+				reservation += memoryHeadReservation(&sa.cfg, cfg)
 			}
 		}
 	}
@@ -1304,6 +1826,12 @@ func (s *Server) jsStreamCreateRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
 	var cfg StreamConfig
 	if err := json.Unmarshal(msg, &cfg); err != nil {
 		resp.Error = NewJSInvalidJSONError()
@@ -1376,11 +1904,12 @@ func (s *Server) jsStreamUpdateRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 
-	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	ci, acc, hdr, msg, err := s.getRequestInfo(c, rmsg)
 	if err != nil {
 		s.Warnf(badAPIRequestT, msg)
 		return
 	}
+	pinUpdate := len(getHeader(jsPinUpdateHdr, hdr)) > 0
 
 	var resp = JSApiStreamUpdateResponse{ApiResponse: ApiResponse{Type: JSApiStreamUpdateResponseType}}
 
@@ -1408,6 +1937,12 @@ func (s *Server) jsStreamUpdateRequest(sub *subscription, c *client, _ *Account,
 		}
 		return
 	}
+
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 	var ncfg StreamConfig
 	if err := json.Unmarshal(msg, &ncfg); err != nil {
 		resp.Error = NewJSInvalidJSONError()
@@ -1432,7 +1967,7 @@ func (s *Server) jsStreamUpdateRequest(sub *subscription, c *client, _ *Account,
 	// Handle clustered version here.
 	if s.JetStreamIsClustered() {
 		// Always do in separate Go routine.
-		go s.jsClusteredStreamUpdateRequest(ci, acc, subject, reply, copyBytes(rmsg), &cfg, nil)
+		go s.jsClusteredStreamUpdateRequest(ci, acc, subject, reply, copyBytes(rmsg), &cfg, nil, pinUpdate)
 		return
 	}
 
@@ -1442,8 +1977,10 @@ func (s *Server) jsStreamUpdateRequest(sub *subscription, c *client, _ *Account,
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
+	cur := mset.config()
+	cfg = *cfg.withPinned(&cur, pinUpdate)
 
-	if err := mset.update(&cfg); err != nil {
+	if err := mset.updateWithAdvisory(&cfg, ci, true); err != nil {
 		resp.Error = NewJSStreamUpdateError(err, Unless(err))
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
@@ -1460,8 +1997,51 @@ func (s *Server) jsStreamUpdateRequest(sub *subscription, c *client, _ *Account,
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// Request for the list of all stream names.
-func (s *Server) jsStreamNamesRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// jsStreamLeaderCheck is for requests that the stream leader answers. Returns true if we should
+// proceed, which in clustered mode is only when we are the stream leader. Otherwise returns the
+// error to respond with, if we are the ones to respond.
+func (s *Server) jsStreamLeaderCheck(acc *Account, stream string) (bool, *ApiError) {
+	if !s.JetStreamIsClustered() {
+		return true, nil
+	}
+	// Check to make sure the stream is assigned.
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil {
+		return false, nil
+	}
+	if js.isLeaderless() {
+		return false, NewJSClusterNotAvailError()
+	}
+
+	js.mu.RLock()
+	isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+	js.mu.RUnlock()
+
+	if isLeader && sa == nil {
+		// We can't find the stream, so mimic what would be the errors of the request.
+		if hasJS, doErr := acc.checkJetStream(); !hasJS {
+			if doErr {
+				return false, NewJSNotEnabledForAccountError()
+			}
+			return false, nil
+		}
+		// No stream present.
+		return false, NewJSStreamNotFoundError()
+	} else if sa == nil {
+		return false, nil
+	}
+
+	// Check to see if we are a member of the group and if the group has no leader.
+	if js.isGroupLeaderless(sa.Group) {
+		return false, NewJSClusterNotAvailError()
+	}
+
+	// We have the stream assigned and a leader, so only the stream leader should answer.
+	return acc.JetStreamIsStreamLeader(stream), nil
+}
+
+// Request for the config revisions of a stream.
+func (s *Server) jsStreamConfigHistoryRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
@@ -1471,23 +2051,17 @@ func (s *Server) jsStreamNamesRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 
-	var resp = JSApiStreamNamesResponse{ApiResponse: ApiResponse{Type: JSApiStreamNamesResponseType}}
+	stream := tokenAt(subject, 6)
 
-	// Determine if we should proceed here when we are in clustered mode.
-	if s.JetStreamIsClustered() {
-		js, cc := s.getJetStreamCluster()
-		if js == nil || cc == nil {
-			return
-		}
-		if js.isLeaderless() {
-			resp.Error = NewJSClusterNotAvailError()
+	var resp = JSApiStreamConfigHistoryResponse{ApiResponse: ApiResponse{Type: JSApiStreamConfigHistoryResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if ok, apiErr := s.jsStreamLeaderCheck(acc, stream); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
-		// Make sure we are meta leader.
-		if !s.JetStreamIsLeader() {
-			return
 		}
+		return
 	}
 
 	if hasJS, doErr := acc.checkJetStream(); !hasJS {
@@ -1498,99 +2072,77 @@ func (s *Server) jsStreamNamesRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 
-	var offset int
-	var filter string
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	resp.Revisions = mset.configRevisions()
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
 
-	if !isEmptyRequest(msg) {
-		var req JSApiStreamNamesRequest
-		if err := json.Unmarshal(msg, &req); err != nil {
-			resp.Error = NewJSInvalidJSONError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
-		offset = req.Offset
-		if req.Subject != _EMPTY_ {
-			filter = req.Subject
-		}
+// Request for the stats history of a stream.
+func (s *Server) jsStreamStatsHistoryRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
 	}
 
-	// TODO(dlc) - Maybe hold these results for large results that we expect to be paged.
-	// TODO(dlc) - If this list is long maybe do this in a Go routine?
-	var numStreams int
-	if s.JetStreamIsClustered() {
-		js, cc := s.getJetStreamCluster()
-		if js == nil || cc == nil {
-			// TODO(dlc) - Debug or Warn?
-			return
-		}
-		js.mu.RLock()
-		for stream, sa := range cc.streams[acc.Name] {
-			if IsNatsErr(sa.err, JSClusterNotAssignedErr) {
-				continue
-			}
-			if filter != _EMPTY_ {
-				// These could not have subjects auto-filled in since they are raw and unprocessed.
-				if len(sa.Config.Subjects) == 0 {
-					if SubjectsCollide(filter, sa.Config.Name) {
-						resp.Streams = append(resp.Streams, stream)
-					}
-				} else {
-					for _, subj := range sa.Config.Subjects {
-						if SubjectsCollide(filter, subj) {
-							resp.Streams = append(resp.Streams, stream)
-							break
-						}
-					}
-				}
-			} else {
-				resp.Streams = append(resp.Streams, stream)
-			}
-		}
-		js.mu.RUnlock()
-		if len(resp.Streams) > 1 {
-			sort.Slice(resp.Streams, func(i, j int) bool { return strings.Compare(resp.Streams[i], resp.Streams[j]) < 0 })
-		}
-		numStreams = len(resp.Streams)
-		if offset > numStreams {
-			offset = numStreams
-		}
-		if offset > 0 {
-			resp.Streams = resp.Streams[offset:]
-		}
-		if len(resp.Streams) > JSApiNamesLimit {
-			resp.Streams = resp.Streams[:JSApiNamesLimit]
-		}
-	} else {
-		msets := acc.filteredStreams(filter)
-		// Since we page results order matters.
-		if len(msets) > 1 {
-			sort.Slice(msets, func(i, j int) bool {
-				return strings.Compare(msets[i].cfg.Name, msets[j].cfg.Name) < 0
-			})
-		}
+	stream := tokenAt(subject, 6)
 
-		numStreams = len(msets)
-		if offset > numStreams {
-			offset = numStreams
+	var resp = JSApiStreamStatsHistoryResponse{ApiResponse: ApiResponse{Type: JSApiStreamStatsHistoryResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if ok, apiErr := s.jsStreamLeaderCheck(acc, stream); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		}
+		return
+	}
 
-		for _, mset := range msets[offset:] {
-			resp.Streams = append(resp.Streams, mset.cfg.Name)
-			if len(resp.Streams) >= JSApiNamesLimit {
-				break
-			}
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		}
+		return
 	}
-	resp.Total = numStreams
-	resp.Limit = JSApiNamesLimit
-	resp.Offset = offset
 
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	var req JSApiStreamStatsHistoryRequest
+	if !isEmptyRequest(msg) {
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+	interval, _ := s.statsHistoryOpts()
+	if interval == 0 {
+		resp.Error = NewJSStreamStatsHistoryDisabledError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	resp.Interval = interval
+	resp.Samples = mset.statsHistory(req.Since)
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// Request for the list of all detailed stream info.
-// TODO(dlc) - combine with above long term
-func (s *Server) jsStreamListRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request to check a proposed consumer filter subject against a stream.
+// The stream leader has the consumers to check partitions against, so it answers.
+func (s *Server) jsStreamFilterCheckRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
@@ -1600,26 +2152,17 @@ func (s *Server) jsStreamListRequest(sub *subscription, c *client, _ *Account, s
 		return
 	}
 
-	var resp = JSApiStreamListResponse{
-		ApiResponse: ApiResponse{Type: JSApiStreamListResponseType},
-		Streams:     []*StreamInfo{},
-	}
+	stream := tokenAt(subject, 6)
 
-	// Determine if we should proceed here when we are in clustered mode.
-	if s.JetStreamIsClustered() {
-		js, cc := s.getJetStreamCluster()
-		if js == nil || cc == nil {
-			return
-		}
-		if js.isLeaderless() {
-			resp.Error = NewJSClusterNotAvailError()
+	var resp = JSApiStreamFilterCheckResponse{ApiResponse: ApiResponse{Type: JSApiStreamFilterCheckResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if ok, apiErr := s.jsStreamLeaderCheck(acc, stream); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
-		// Make sure we are meta leader.
-		if !s.JetStreamIsLeader() {
-			return
 		}
+		return
 	}
 
 	if hasJS, doErr := acc.checkJetStream(); !hasJS {
@@ -1630,168 +2173,183 @@ func (s *Server) jsStreamListRequest(sub *subscription, c *client, _ *Account, s
 		return
 	}
 
-	var offset int
-	var filter string
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 
+	var req JSApiStreamFilterCheckRequest
 	if !isEmptyRequest(msg) {
-		var req JSApiStreamListRequest
 		if err := json.Unmarshal(msg, &req); err != nil {
 			resp.Error = NewJSInvalidJSONError()
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 			return
 		}
-		offset = req.Offset
-		if req.Subject != _EMPTY_ {
-			filter = req.Subject
-		}
 	}
+	resp.Filter = req.Filter
+	resp.Subjects, resp.External, resp.Overlaps = mset.checkFilter(req.Filter)
+	resp.Valid = (len(resp.Subjects) > 0 || resp.External) && len(resp.Overlaps) == 0
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
 
-	// Clustered mode will invoke a scatter and gather.
-	if s.JetStreamIsClustered() {
-		// Need to copy these off before sending.. don't move this inside startGoRoutine!!!
-		msg = copyBytes(msg)
-		s.startGoRoutine(func() { s.jsClusteredStreamListRequest(acc, ci, filter, offset, subject, reply, msg) })
+// Request for a worker to heartbeat or leave the partitions of a WorkQueue stream, or for their assignments.
+// The stream leader assigns the partitions, so it answers.
+func (s *Server) jsStreamPartitionRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
 		return
 	}
 
-	// TODO(dlc) - Maybe hold these results for large results that we expect to be paged.
-	// TODO(dlc) - If this list is long maybe do this in a Go routine?
-	var msets []*stream
-	if filter == _EMPTY_ {
-		msets = acc.streams()
-	} else {
-		msets = acc.filteredStreams(filter)
+	op, stream := tokenAt(subject, 5), tokenAt(subject, 6)
+
+	var resp = JSApiStreamPartitionResponse{ApiResponse: ApiResponse{Type: JSApiStreamPartitionResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if ok, apiErr := s.jsStreamLeaderCheck(acc, stream); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
 	}
 
-	sort.Slice(msets, func(i, j int) bool {
-		return strings.Compare(msets[i].cfg.Name, msets[j].cfg.Name) < 0
-	})
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
 
-	scnt := len(msets)
-	if offset > scnt {
-		offset = scnt
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
 	}
 
-	for _, mset := range msets[offset:] {
-		config := mset.config()
-		resp.Streams = append(resp.Streams, &StreamInfo{
-			Created: mset.createdTime(),
-			State:   mset.state(),
-			Config:  config,
-			Domain:  s.getOpts().JetStreamDomain,
-			Mirror:  mset.mirrorInfo(),
-			Sources: mset.sourcesInfo(),
-		})
-		if len(resp.Streams) >= JSApiListLimit {
-			break
+	var req JSApiStreamPartitionRequest
+	if !isEmptyRequest(msg) {
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
 		}
 	}
-	resp.Total = scnt
-	resp.Limit = JSApiListLimit
-	resp.Offset = offset
+	if op != "INFO" && req.Worker == _EMPTY_ {
+		resp.Error = NewJSStreamPartitionsError(errors.New("worker name required"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	sp, err := mset.partitionGroup()
+	if err != nil {
+		resp.Error = NewJSStreamPartitionsError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	switch op {
+	case "HEARTBEAT":
+		resp.Generation, resp.Partitions, err = sp.heartbeat(req.Worker, ci.partitionConn(), req.TTL)
+	case "LEAVE":
+		resp.Generation, err = sp.leave(req.Worker, ci.partitionConn())
+	default:
+		resp.Generation, resp.Assignments = sp.assignments()
+	}
+	if err != nil {
+		resp.Error = NewJSStreamPartitionsError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// Request for information about a stream.
-func (s *Server) jsStreamInfoRequest(sub *subscription, c *client, a *Account, subject, reply string, rmsg []byte) {
+// Request to preview what new limits would remove from a stream, before applying them with an update.
+// The stream leader answers.
+func (s *Server) jsStreamRetentionPreviewRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
-	ci, acc, hdr, msg, err := s.getRequestInfo(c, rmsg)
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
 	if err != nil {
 		s.Warnf(badAPIRequestT, msg)
 		return
 	}
 
-	streamName := streamNameFromSubject(subject)
-
-	var resp = JSApiStreamInfoResponse{ApiResponse: ApiResponse{Type: JSApiStreamInfoResponseType}}
-
-	// If someone creates a duplicate stream that is identical we will get this request forwarded to us.
-	// Make sure the response type is for a create call.
-	if rt := getHeader(JSResponseType, hdr); len(rt) > 0 && string(rt) == jsCreateResponse {
-		resp.ApiResponse.Type = JSApiStreamCreateResponseType
-	}
+	stream := tokenAt(subject, 6)
 
-	var clusterWideConsCount int
+	var resp = JSApiStreamRetentionPreviewResponse{ApiResponse: ApiResponse{Type: JSApiStreamRetentionPreviewResponseType}}
 
 	// If we are in clustered mode we need to be the stream leader to proceed.
-	if s.JetStreamIsClustered() {
-		// Check to make sure the stream is assigned.
-		js, cc := s.getJetStreamCluster()
-		if js == nil || cc == nil {
-			return
+	if ok, apiErr := s.jsStreamLeaderCheck(acc, stream); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		}
+		return
+	}
 
-		js.mu.RLock()
-		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, streamName)
-		var offline bool
-		if sa != nil {
-			clusterWideConsCount = len(sa.consumers)
-			offline = s.allPeersOffline(sa.Group)
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		}
-		js.mu.RUnlock()
+		return
+	}
 
-		if isLeader && sa == nil {
-			// We can't find the stream, so mimic what would be the errors below.
-			if hasJS, doErr := acc.checkJetStream(); !hasJS {
-				if doErr {
-					resp.Error = NewJSNotEnabledForAccountError()
-					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-				}
-				return
-			}
-			// No stream present.
-			resp.Error = NewJSStreamNotFoundError()
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	var req JSApiStreamRetentionPreviewRequest
+	if !isEmptyRequest(msg) {
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 			return
-		} else if sa == nil {
-			if js.isLeaderless() {
-				resp.Error = NewJSClusterNotAvailError()
-				// Delaying an error response gives the leader a chance to respond before us
-				s.sendDelayedAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp), nil)
-			}
-			return
-		} else if isLeader && offline {
-			resp.Error = NewJSStreamOfflineError()
-			s.sendDelayedAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp), nil)
-			return
 		}
+	}
+	resp.MaxAge, resp.MaxMsgs, resp.MaxBytes = mset.previewLimits(&req)
+	resp.Msgs, resp.Bytes, resp.FirstSeq, err = mset.previewRetention(resp.MaxAge, resp.MaxMsgs, resp.MaxBytes)
+	if err != nil {
+		resp.Error = NewJSStreamGeneralError(err, Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
 
-		// Check to see if we are a member of the group and if the group has no leader.
-		isLeaderless := js.isGroupLeaderless(sa.Group)
+// Request to update a stream back to a prior config revision.
+// The stream leader has the revisions, so it answers and applies the old config as a regular update.
+func (s *Server) jsStreamConfigRollbackRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
 
-		// We have the stream assigned and a leader, so only the stream leader should answer.
-		if !acc.JetStreamIsStreamLeader(streamName) && !isLeaderless {
-			if js.isLeaderless() {
-				resp.Error = NewJSClusterNotAvailError()
-				// Delaying an error response gives the leader a chance to respond before us
-				s.sendDelayedAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp), sa.Group)
-				return
-			}
+	stream := tokenAt(subject, 6)
 
-			// We may be in process of electing a leader, but if this is a scale up from 1 we will still be the state leader
-			// while the new members work through the election and catchup process.
-			// Double check for that instead of exiting here and being silent. e.g. nats stream update test --replicas=3
-			js.mu.RLock()
-			rg := sa.Group
-			var ourID string
-			if cc.meta != nil {
-				ourID = cc.meta.ID()
-			}
-			// We have seen cases where rg or rg.node is nil at this point,
-			// so check explicitly on those conditions and bail if that is
-			// the case.
-			bail := rg == nil || rg.node == nil || !rg.isMember(ourID)
-			if !bail {
-				// We know we are a member here, if this group is new and we are preferred allow us to answer.
-				bail = rg.Preferred != ourID || time.Since(rg.node.Created()) > lostQuorumIntervalDefault
-			}
-			js.mu.RUnlock()
-			if bail {
-				return
-			}
+	var resp = JSApiStreamUpdateResponse{ApiResponse: ApiResponse{Type: JSApiStreamUpdateResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if ok, apiErr := s.jsStreamLeaderCheck(acc, stream); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		}
+		return
 	}
 
 	if hasJS, doErr := acc.checkJetStream(); !hasJS {
@@ -1801,96 +2359,36 @@ func (s *Server) jsStreamInfoRequest(sub *subscription, c *client, a *Account, s
 		}
 		return
 	}
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 
-	var details bool
-	var subjects string
-	var offset int
-	if !isEmptyRequest(msg) {
-		var req JSApiStreamInfoRequest
-		if err := json.Unmarshal(msg, &req); err != nil {
-			resp.Error = NewJSInvalidJSONError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
-		details, subjects = req.DeletedDetails, req.SubjectsFilter
-		offset = req.Offset
+	var req JSApiStreamConfigRollbackRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
 	}
 
-	mset, err := acc.lookupStream(streamName)
+	mset, err := acc.lookupStream(stream)
 	if err != nil {
 		resp.Error = NewJSStreamNotFoundError(Unless(err))
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
-	config := mset.config()
-
-	js, _ := s.getJetStreamCluster()
-
-	resp.StreamInfo = &StreamInfo{
-		Created:    mset.createdTime(),
-		State:      mset.stateWithDetail(details),
-		Config:     config,
-		Domain:     s.getOpts().JetStreamDomain,
-		Cluster:    js.clusterInfo(mset.raftGroup()),
-		Mirror:     mset.mirrorInfo(),
-		Sources:    mset.sourcesInfo(),
-		Alternates: js.streamAlternates(ci, config.Name),
-	}
-	if clusterWideConsCount > 0 {
-		resp.StreamInfo.State.Consumers = clusterWideConsCount
-	}
-
-	// Check if they have asked for subject details.
-	if subjects != _EMPTY_ {
-		st := mset.store.SubjectsTotals(subjects)
-		if lst := len(st); lst > 0 {
-			// Common for both cases.
-			resp.Offset = offset
-			resp.Limit = JSMaxSubjectDetails
-			resp.Total = lst
-
-			if offset == 0 && lst <= JSMaxSubjectDetails {
-				resp.StreamInfo.State.Subjects = st
-			} else {
-				// Here we have to filter list due to offset or maximum constraints.
-				subjs := make([]string, 0, len(st))
-				for subj := range st {
-					subjs = append(subjs, subj)
-				}
-				// Sort it
-				sort.Strings(subjs)
-
-				if offset > len(subjs) {
-					offset = len(subjs)
-				}
-
-				end := offset + JSMaxSubjectDetails
-				if end > len(subjs) {
-					end = len(subjs)
-				}
-				actualSize := end - offset
-				var sd map[string]uint64
-
-				if actualSize > 0 {
-					sd = make(map[string]uint64, actualSize)
-					for _, ss := range subjs[offset:end] {
-						sd[ss] = st[ss]
-					}
-				}
-				resp.StreamInfo.State.Subjects = sd
-			}
-		}
-	}
-	// Check for out of band catchups.
-	if mset.hasCatchupPeers() {
-		mset.checkClusterInfo(resp.StreamInfo.Cluster)
+	rev := mset.configRevision(req.Revision)
+	if rev == nil {
+		resp.Error = NewJSStreamConfigRevisionNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
 	}
-
-	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+	s.jsStreamUpdateFromLeader(ci, acc, mset, subject, reply, string(msg), &rev.Config)
 }
 
-// Request to have a stream leader stepdown.
-func (s *Server) jsStreamLeaderStepDownRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request to let a stream that failed after repeated store errors accept messages again.
+func (s *Server) jsStreamReopenRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
@@ -1900,89 +2398,102 @@ func (s *Server) jsStreamLeaderStepDownRequest(sub *subscription, c *client, _ *
 		return
 	}
 
-	// Have extra token for this one.
-	name := tokenAt(subject, 6)
+	stream := tokenAt(subject, 5)
 
-	var resp = JSApiStreamLeaderStepDownResponse{ApiResponse: ApiResponse{Type: JSApiStreamLeaderStepDownResponseType}}
+	var resp = JSApiStreamReopenResponse{ApiResponse: ApiResponse{Type: JSApiStreamReopenResponseType}}
 
-	// If we are not in clustered mode this is a failed request.
-	if !s.JetStreamIsClustered() {
-		resp.Error = NewJSClusterRequiredError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if ok, apiErr := s.jsStreamLeaderCheck(acc, stream); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
 
-	// If we are here we are clustered. See if we are the stream leader in order to proceed.
-	js, cc := s.getJetStreamCluster()
-	if js == nil || cc == nil {
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
-	if js.isLeaderless() {
-		resp.Error = NewJSClusterNotAvailError()
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	js.mu.RLock()
-	isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, name)
-	js.mu.RUnlock()
-
-	if isLeader && sa == nil {
-		resp.Error = NewJSStreamNotFoundError()
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
-	} else if sa == nil {
+	}
+	if err := mset.reopen(); err != nil {
+		resp.Error = NewJSStreamFailedError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
+	resp.Success = true
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
 
-	if hasJS, doErr := acc.checkJetStream(); !hasJS {
-		if doErr {
-			resp.Error = NewJSNotEnabledForAccountError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		}
+// Request for the tombstones of a stream.
+func (s *Server) jsStreamTombstonesRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
-	if !isEmptyRequest(msg) {
-		resp.Error = NewJSBadRequestError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
 		return
 	}
 
-	// Check to see if we are a member of the group and if the group has no leader.
-	if js.isGroupLeaderless(sa.Group) {
-		resp.Error = NewJSClusterNotAvailError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	stream := tokenAt(subject, 5)
+
+	var resp = JSApiStreamTombstonesResponse{ApiResponse: ApiResponse{Type: JSApiStreamTombstonesResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if ok, apiErr := s.jsStreamLeaderCheck(acc, stream); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
 
-	// We have the stream assigned and a leader, so only the stream leader should answer.
-	if !acc.JetStreamIsStreamLeader(name) {
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
 
-	mset, err := acc.lookupStream(name)
+	mset, err := acc.lookupStream(stream)
 	if err != nil {
 		resp.Error = NewJSStreamNotFoundError(Unless(err))
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	// Call actual stepdown.
-	if mset != nil {
-		if node := mset.raftNode(); node != nil {
-			mset.setLeader(false)
-			// TODO (mh) eventually make sure all go routines exited and all channels are cleared
-			time.Sleep(250 * time.Millisecond)
-			node.StepDown()
+	var req JSApiStreamTombstonesRequest
+	if !isEmptyRequest(msg) {
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
 		}
 	}
-
-	resp.Success = true
+	resp.Retention = mset.config().Tombstones
+	resp.Tombstones = mset.tombstones(req.StartSeq, req.EndSeq)
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// Request to have a consumer leader stepdown.
-func (s *Server) jsConsumerLeaderStepDownRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request to change the sample rate of a stream shadow at runtime.
+// The stream leader applies it as a regular update of its current config.
+func (s *Server) jsStreamShadowSampleRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
@@ -1992,101 +2503,128 @@ func (s *Server) jsConsumerLeaderStepDownRequest(sub *subscription, c *client, _
 		return
 	}
 
-	var resp = JSApiConsumerLeaderStepDownResponse{ApiResponse: ApiResponse{Type: JSApiConsumerLeaderStepDownResponseType}}
+	stream := tokenAt(subject, 6)
 
-	// If we are not in clustered mode this is a failed request.
-	if !s.JetStreamIsClustered() {
-		resp.Error = NewJSClusterRequiredError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	var resp = JSApiStreamUpdateResponse{ApiResponse: ApiResponse{Type: JSApiStreamUpdateResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if ok, apiErr := s.jsStreamLeaderCheck(acc, stream); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
 
-	// If we are here we are clustered. See if we are the stream leader in order to proceed.
-	js, cc := s.getJetStreamCluster()
-	if js == nil || cc == nil {
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
-	if js.isLeaderless() {
-		resp.Error = NewJSClusterNotAvailError()
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	// Have extra token for this one.
-	stream := tokenAt(subject, 6)
-	consumer := tokenAt(subject, 7)
-
-	js.mu.RLock()
-	isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
-	js.mu.RUnlock()
-
-	if isLeader && sa == nil {
-		resp.Error = NewJSStreamNotFoundError()
+	var req JSApiStreamShadowSampleRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
-	} else if sa == nil {
-		return
-	}
-	var ca *consumerAssignment
-	if sa.consumers != nil {
-		ca = sa.consumers[consumer]
 	}
-	if ca == nil {
-		resp.Error = NewJSConsumerNotFoundError()
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
-	// Check to see if we are a member of the group and if the group has no leader.
-	if js.isGroupLeaderless(ca.Group) {
-		resp.Error = NewJSClusterNotAvailError()
+	ncfg := mset.config()
+	if ncfg.Shadow == nil {
+		resp.Error = NewJSStreamInvalidConfigError(errors.New("stream has no shadow"))
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
+	shadow := *ncfg.Shadow
+	shadow.Sample = req.Sample
+	ncfg.Shadow = &shadow
+	s.jsStreamUpdateFromLeader(ci, acc, mset, subject, reply, string(msg), &ncfg)
+}
 
-	if !acc.JetStreamIsConsumerLeader(stream, consumer) {
+// Will apply a new config decided on by the stream leader as a regular stream update.
+// In clustered mode the config is handed to the meta leader, which will respond to the requestor directly.
+func (s *Server) jsStreamUpdateFromLeader(ci *ClientInfo, acc *Account, mset *stream, subject, reply, msg string, ncfg *StreamConfig) {
+	if s.JetStreamIsClustered() {
+		// We want to make sure we send along the client info.
+		cij, _ := json.Marshal(ci)
+		hdr := map[string]string{ClientInfoHdr: string(cij)}
+		// Send this as system account, but include client info header.
+		s.sendInternalAccountMsgWithReply(nil, fmt.Sprintf(JSApiStreamUpdateT, ncfg.Name), reply, hdr, ncfg, true)
 		return
 	}
 
-	if hasJS, doErr := acc.checkJetStream(); !hasJS {
-		if doErr {
-			resp.Error = NewJSNotEnabledForAccountError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		}
-		return
-	}
-	if !isEmptyRequest(msg) {
-		resp.Error = NewJSBadRequestError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	cur := mset.config()
+	resp := s.jsStreamUpdateLocal(ci, acc, mset, ncfg.withPinned(&cur, false))
+	if resp.Error != nil {
+		s.sendAPIErrResponse(ci, acc, subject, reply, msg, s.jsonResponse(resp))
 		return
 	}
+	s.sendAPIResponse(ci, acc, subject, reply, msg, s.jsonResponse(resp))
+}
 
-	mset, err := acc.lookupStream(stream)
-	if err != nil {
-		resp.Error = NewJSStreamNotFoundError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
+// Will update a stream that is not clustered with the config as is.
+func (s *Server) jsStreamUpdateLocal(ci *ClientInfo, acc *Account, mset *stream, ncfg *StreamConfig) *JSApiStreamUpdateResponse {
+	var resp = JSApiStreamUpdateResponse{ApiResponse: ApiResponse{Type: JSApiStreamUpdateResponseType}}
+	cfg, apiErr := s.checkStreamCfg(ncfg, acc)
+	if apiErr != nil {
+		resp.Error = apiErr
+		return &resp
 	}
-	o := mset.lookupConsumer(consumer)
-	if o == nil {
-		resp.Error = NewJSConsumerNotFoundError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
+	if err := mset.updateWithAdvisory(&cfg, ci, true); err != nil {
+		resp.Error = NewJSStreamUpdateError(err, Unless(err))
+		return &resp
 	}
 
-	// Call actual stepdown.
-	if n := o.raftNode(); n != nil {
-		o.setLeader(false)
-		// TODO (mh) eventually make sure all go routines exited and all channels are cleared
-		time.Sleep(250 * time.Millisecond)
-		n.StepDown()
+	resp.StreamInfo = &StreamInfo{
+		Created: mset.createdTime(),
+		State:   mset.state(),
+		Config:  mset.config(),
+		Domain:  s.getOpts().JetStreamDomain,
+		Mirror:  mset.mirrorInfo(),
+		Sources: mset.sourcesInfo(),
 	}
+	return &resp
+}
 
-	resp.Success = true
-	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+// Will apply the pins of the config decided on by the stream leader, and wait for the update to be applied.
+// In clustered mode the config is handed to the meta leader, the stream leader responds once it has applied it.
+func (s *Server) jsStreamPinUpdate(ci *ClientInfo, acc *Account, mset *stream, ncfg *StreamConfig) *JSApiStreamUpdateResponse {
+	if !s.JetStreamIsClustered() {
+		cur := mset.config()
+		return s.jsStreamUpdateLocal(ci, acc, mset, ncfg.withPinned(&cur, true))
+	}
+
+	var resp = JSApiStreamUpdateResponse{ApiResponse: ApiResponse{Type: JSApiStreamUpdateResponseType}}
+	cij, _ := json.Marshal(ci)
+	hdr := map[string]string{ClientInfoHdr: string(cij), jsPinUpdateHdr: "true"}
+	b, _ := json.Marshal(ncfg)
+	rmsg, err := s.jsAccountRequest(s.SystemAccount(), fmt.Sprintf(JSApiStreamUpdateT, ncfg.Name), hdr, b, jsPinUpdateTimeout)
+	if err == nil {
+		err = json.Unmarshal(rmsg, &resp)
+	}
+	if err != nil {
+		resp.Error = NewJSStreamUpdateError(err, Unless(err))
+	}
+	return &resp
 }
 
-// Request to remove a peer from a clustered stream.
-func (s *Server) jsStreamRemovePeerRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request to pin or unpin a message in a stream.
+// The stream leader checks the message is present and applies the pinned set as a pin update.
+// Pin updates of a stream are applied one at a time, so they do not lose each other's changes.
+func (s *Server) jsMsgPinRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
@@ -2096,642 +2634,633 @@ func (s *Server) jsStreamRemovePeerRequest(sub *subscription, c *client, _ *Acco
 		return
 	}
 
-	// Have extra token for this one.
-	name := tokenAt(subject, 6)
+	stream := tokenAt(subject, 6)
 
-	var resp = JSApiStreamRemovePeerResponse{ApiResponse: ApiResponse{Type: JSApiStreamRemovePeerResponseType}}
+	var resp = JSApiStreamUpdateResponse{ApiResponse: ApiResponse{Type: JSApiStreamUpdateResponseType}}
 
-	// If we are not in clustered mode this is a failed request.
-	if !s.JetStreamIsClustered() {
-		resp.Error = NewJSClusterRequiredError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if ok, apiErr := s.jsStreamLeaderCheck(acc, stream); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
 
-	// If we are here we are clustered. See if we are the stream leader in order to proceed.
-	js, cc := s.getJetStreamCluster()
-	if js == nil || cc == nil {
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
-	if js.isLeaderless() {
-		resp.Error = NewJSClusterNotAvailError()
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	js.mu.RLock()
-	isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, name)
-	js.mu.RUnlock()
+	var req JSApiMsgPinRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 
-	// Make sure we are meta leader.
-	if !isLeader {
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	if hasJS, doErr := acc.checkJetStream(); !hasJS {
-		if doErr {
-			resp.Error = NewJSNotEnabledForAccountError()
+	pin := func() {
+		mset.pinMu.Lock()
+		defer mset.pinMu.Unlock()
+
+		cfg, apiErr := mset.pinnedConfig(&req)
+		if apiErr != nil {
+			resp.Error = apiErr
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
 		}
-		return
+		presp := s.jsStreamPinUpdate(ci, acc, mset, cfg)
+		if presp.Error != nil {
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(presp))
+			return
+		}
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(presp))
 	}
-	if isEmptyRequest(msg) {
-		resp.Error = NewJSBadRequestError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+
+	// In clustered mode we wait for the update to be applied, so do this in a separate Go routine.
+	if s.JetStreamIsClustered() {
+		msg = copyBytes(msg)
+		go pin()
 		return
 	}
+	pin()
+}
 
-	var req JSApiStreamRemovePeerRequest
-	if err := json.Unmarshal(msg, &req); err != nil {
-		resp.Error = NewJSInvalidJSONError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+// Request to acquire or release the writer lease of a single writer stream.
+// The lease is kept by the stream leader, so it answers.
+func (s *Server) jsStreamWriterRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
-	if req.Peer == _EMPTY_ {
-		resp.Error = NewJSBadRequestError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
 		return
 	}
 
-	if sa == nil {
-		// No stream present.
-		resp.Error = NewJSStreamNotFoundError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	stream := streamNameFromSubject(subject)
+
+	var resp = JSApiStreamWriterResponse{ApiResponse: ApiResponse{Type: JSApiStreamWriterResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if ok, apiErr := s.jsStreamLeaderCheck(acc, stream); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
 
-	// Check to see if we are a member of the group and if the group has no leader.
-	// Peers here is a server name, convert to node name.
-	nodeName := getHash(req.Peer)
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
 
-	js.mu.RLock()
-	rg := sa.Group
-	isMember := rg.isMember(nodeName)
-	js.mu.RUnlock()
+	var req JSApiStreamWriterRequest
+	if !isEmptyRequest(msg) {
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
 
-	// Make sure we are a member.
-	if !isMember {
-		resp.Error = NewJSClusterPeerNotMemberError()
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	// If we are here we have a valid peer member set for removal.
-	if !js.removePeerFromStream(sa, nodeName) {
-		resp.Error = NewJSPeerRemapError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	if req.Release {
+		if apiErr := mset.releaseWriter(req.Fence); apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 		return
 	}
 
-	resp.Success = true
+	fence, apiErr := mset.acquireWriter(req.Fence, req.Takeover)
+	if apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	mset.mu.RLock()
+	resp.Fence, resp.Lease = fence, mset.writerLease()
+	mset.mu.RUnlock()
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// Request to have the metaleader remove a peer from the system.
-func (s *Server) jsLeaderServerRemoveRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request to move the files of a stream to another store directory.
+// Streams are only relocated when not clustered.
+func (s *Server) jsStreamRelocateRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
-
 	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
 	if err != nil {
 		s.Warnf(badAPIRequestT, msg)
 		return
 	}
 
-	js, cc := s.getJetStreamCluster()
-	if js == nil || cc == nil || cc.meta == nil {
-		return
-	}
-
-	// Extra checks here but only leader is listening.
-	js.mu.RLock()
-	isLeader := cc.isLeader()
-	js.mu.RUnlock()
+	var resp = JSApiStreamRelocateResponse{ApiResponse: ApiResponse{Type: JSApiStreamRelocateResponseType}}
 
-	if !isLeader {
+	// The meta leader answers when clustered.
+	if s.JetStreamIsClustered() {
+		if s.JetStreamIsLeader() {
+			resp.Error = NewJSStreamRelocateError(errors.New("not supported for clustered streams"))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
 
-	var resp = JSApiMetaServerRemoveResponse{ApiResponse: ApiResponse{Type: JSApiMetaServerRemoveResponseType}}
-
-	if isEmptyRequest(msg) {
-		resp.Error = NewJSBadRequestError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
 
-	var req JSApiMetaServerRemoveRequest
+	var req JSApiStreamRelocateRequest
 	if err := json.Unmarshal(msg, &req); err != nil {
 		resp.Error = NewJSInvalidJSONError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	var found string
-	js.mu.RLock()
-	for _, p := range cc.meta.Peers() {
-		// If Peer is specified, it takes precedence
-		if req.Peer != _EMPTY_ {
-			if p.ID == req.Peer {
-				found = req.Peer
-				break
-			}
-			continue
-		}
-		si, ok := s.nodeToInfo.Load(p.ID)
-		if ok && si.(nodeInfo).name == req.Server {
-			found = p.ID
-			break
-		}
+	mset, err := acc.lookupStream(streamNameFromSubject(subject))
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
 	}
-	js.mu.RUnlock()
-
-	if found == _EMPTY_ {
-		resp.Error = NewJSClusterServerNotMemberError()
+	if apiErr := mset.relocate(req.StoreDir); apiErr != nil {
+		resp.Error = apiErr
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
-
-	// So we have a valid peer.
-	js.mu.Lock()
-	cc.meta.ProposeRemovePeer(found)
-	js.mu.Unlock()
-
-	resp.Success = true
-	s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	resp.Relocating = true
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-func (s *Server) peerSetToNames(ps []string) []string {
-	names := make([]string, len(ps))
-	for i := 0; i < len(ps); i++ {
-		if si, ok := s.nodeToInfo.Load(ps[i]); !ok {
-			names[i] = ps[i]
-		} else {
-			names[i] = si.(nodeInfo).name
-		}
-	}
-	return names
-}
-
-// looks up the peer id for a given server name. Cluster and domain name are optional filter criteria
-func (s *Server) nameToPeer(js *jetStream, serverName, clusterName, domainName string) string {
-	js.mu.RLock()
-	cc := js.cluster
-	defer js.mu.RUnlock()
-	for _, p := range cc.meta.Peers() {
-		si, ok := s.nodeToInfo.Load(p.ID)
-		if ok && si.(nodeInfo).name == serverName {
-			if clusterName == _EMPTY_ || clusterName == si.(nodeInfo).cluster {
-				if domainName == _EMPTY_ || domainName == si.(nodeInfo).domain {
-					return p.ID
-				}
-			}
-		}
-	}
-	return _EMPTY_
-}
-
-// Request to have the metaleader move a stream on a peer to another
-func (s *Server) jsLeaderServerStreamMoveRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request for the list of all stream names.
+func (s *Server) jsStreamNamesRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
-
 	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
 	if err != nil {
 		s.Warnf(badAPIRequestT, msg)
 		return
 	}
 
-	js, cc := s.getJetStreamCluster()
-	if js == nil || cc == nil || cc.meta == nil {
-		return
-	}
-
-	// Extra checks here but only leader is listening.
-	js.mu.RLock()
-	isLeader := cc.isLeader()
-	js.mu.RUnlock()
+	var resp = JSApiStreamNamesResponse{ApiResponse: ApiResponse{Type: JSApiStreamNamesResponseType}}
 
-	if !isLeader {
-		return
+	// Determine if we should proceed here when we are in clustered mode.
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		// Make sure we are meta leader.
+		if !s.JetStreamIsLeader() {
+			return
+		}
 	}
 
-	accName := tokenAt(subject, 6)
-	streamName := tokenAt(subject, 7)
-
-	var resp = JSApiStreamUpdateResponse{ApiResponse: ApiResponse{Type: JSApiStreamUpdateResponseType}}
-
-	var req JSApiMetaServerStreamMoveRequest
-	if err := json.Unmarshal(msg, &req); err != nil {
-		resp.Error = NewJSInvalidJSONError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
 
-	srcPeer := _EMPTY_
-	if req.Server != _EMPTY_ {
-		srcPeer = s.nameToPeer(js, req.Server, req.Cluster, req.Domain)
-	}
-
-	targetAcc, ok := s.accounts.Load(accName)
-	if !ok {
-		resp.Error = NewJSNoAccountError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
-	}
+	var offset int
+	var filter string
+	limit := JSApiNamesLimit
 
-	var streamFound bool
-	cfg := StreamConfig{}
-	currPeers := []string{}
-	currCluster := _EMPTY_
-	js.mu.Lock()
-	streams, ok := cc.streams[accName]
-	if ok {
-		sa, ok := streams[streamName]
-		if ok {
-			cfg = *sa.Config
-			streamFound = true
-			currPeers = sa.Group.Peers
-			currCluster = sa.Group.Cluster
+	if !isEmptyRequest(msg) {
+		var req JSApiStreamNamesRequest
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		offset, limit = req.Offset, req.pageLimit(JSApiNamesLimit)
+		if req.Subject != _EMPTY_ {
+			filter = req.Subject
 		}
-	}
-	js.mu.Unlock()
-
-	if !streamFound {
-		resp.Error = NewJSStreamNotFoundError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
 	}
 
-	// if server was picked, make sure src peer exists and move it to first position.
-	// removal will drop peers from the left
-	if req.Server != _EMPTY_ {
-		if srcPeer == _EMPTY_ {
-			resp.Error = NewJSClusterServerNotMemberError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	// TODO(dlc) - Maybe hold these results for large results that we expect to be paged.
+	// TODO(dlc) - If this list is long maybe do this in a Go routine?
+	var numStreams int
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			// TODO(dlc) - Debug or Warn?
 			return
 		}
-		var peerFound bool
-		for i := 0; i < len(currPeers); i++ {
-			if currPeers[i] == srcPeer {
-				copy(currPeers[1:], currPeers[:i])
-				currPeers[0] = srcPeer
-				peerFound = true
-				break
+		js.mu.RLock()
+		for stream, sa := range cc.streams[acc.Name] {
+			if IsNatsErr(sa.err, JSClusterNotAssignedErr) {
+				continue
+			}
+			if filter != _EMPTY_ {
+				// These could not have subjects auto-filled in since they are raw and unprocessed.
+				if len(sa.Config.Subjects) == 0 {
+					if SubjectsCollide(filter, sa.Config.Name) {
+						resp.Streams = append(resp.Streams, stream)
+					}
+				} else {
+					for _, subj := range sa.Config.Subjects {
+						if SubjectsCollide(filter, subj) {
+							resp.Streams = append(resp.Streams, stream)
+							break
+						}
+					}
+				}
+			} else {
+				resp.Streams = append(resp.Streams, stream)
 			}
 		}
-		if !peerFound {
-			resp.Error = NewJSClusterPeerNotMemberError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
+		js.mu.RUnlock()
+		if len(resp.Streams) > 1 {
+			sort.Slice(resp.Streams, func(i, j int) bool { return strings.Compare(resp.Streams[i], resp.Streams[j]) < 0 })
 		}
-	}
-
-	// make sure client is scoped to requested account
-	ciNew := *(ci)
-	ciNew.Account = accName
-
-	// backup placement such that peers can be looked up with modified tag list
-	var origPlacement *Placement
-	if cfg.Placement != nil {
-		tmp := *cfg.Placement
-		origPlacement = &tmp
-	}
-
-	if len(req.Tags) > 0 {
-		if cfg.Placement == nil {
-			cfg.Placement = &Placement{}
+		numStreams = len(resp.Streams)
+		if offset > numStreams {
+			offset = numStreams
+		}
+		if offset > 0 {
+			resp.Streams = resp.Streams[offset:]
+		}
+		if len(resp.Streams) > limit {
+			resp.Streams = resp.Streams[:limit]
+		}
+	} else {
+		msets := acc.filteredStreams(filter)
+		// Since we page results order matters.
+		if len(msets) > 1 {
+			sort.Slice(msets, func(i, j int) bool {
+				return strings.Compare(msets[i].cfg.Name, msets[j].cfg.Name) < 0
+			})
 		}
-		cfg.Placement.Tags = append(cfg.Placement.Tags, req.Tags...)
-	}
 
-	peers, e := cc.selectPeerGroup(cfg.Replicas+1, currCluster, &cfg, currPeers, 1, nil)
-	if len(peers) <= cfg.Replicas {
-		// since expanding in the same cluster did not yield a result, try in different cluster
-		peers = nil
+		numStreams = len(msets)
+		if offset > numStreams {
+			offset = numStreams
+		}
 
-		clusters := map[string]struct{}{}
-		s.nodeToInfo.Range(func(_, ni interface{}) bool {
-			if currCluster != ni.(nodeInfo).cluster {
-				clusters[ni.(nodeInfo).cluster] = struct{}{}
-			}
-			return true
-		})
-		errs := &selectPeerError{}
-		errs.accumulate(e)
-		for cluster := range clusters {
-			newPeers, e := cc.selectPeerGroup(cfg.Replicas, cluster, &cfg, nil, 0, nil)
-			if len(newPeers) >= cfg.Replicas {
-				peers = append([]string{}, currPeers...)
-				peers = append(peers, newPeers[:cfg.Replicas]...)
+		for _, mset := range msets[offset:] {
+			resp.Streams = append(resp.Streams, mset.cfg.Name)
+			if len(resp.Streams) >= limit {
 				break
 			}
-			errs.accumulate(e)
-		}
-		if peers == nil {
-			resp.Error = NewJSClusterNoPeersError(errs)
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
 		}
 	}
+	resp.Total = numStreams
+	resp.Limit = limit
+	resp.Offset = offset
 
-	cfg.Placement = origPlacement
-
-	s.Noticef("Requested move for stream '%s > %s' R=%d from %+v to %+v",
-		streamName, accName, cfg.Replicas, s.peerSetToNames(currPeers), s.peerSetToNames(peers))
-
-	// We will always have peers and therefore never do a callout, therefore it is safe to call inline
-	s.jsClusteredStreamUpdateRequest(&ciNew, targetAcc.(*Account), subject, reply, rmsg, &cfg, peers)
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// Request to have the metaleader move a stream on a peer to another
-func (s *Server) jsLeaderServerStreamCancelMoveRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request for the list of all detailed stream info.
+// TODO(dlc) - combine with above long term
+func (s *Server) jsStreamListRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
-
 	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
 	if err != nil {
 		s.Warnf(badAPIRequestT, msg)
 		return
 	}
 
-	js, cc := s.getJetStreamCluster()
-	if js == nil || cc == nil || cc.meta == nil {
-		return
-	}
-
-	// Extra checks here but only leader is listening.
-	js.mu.RLock()
-	isLeader := cc.isLeader()
-	js.mu.RUnlock()
-
-	if !isLeader {
-		return
+	var resp = JSApiStreamListResponse{
+		ApiResponse: ApiResponse{Type: JSApiStreamListResponseType},
+		Streams:     []*StreamInfo{},
 	}
 
-	var resp = JSApiStreamUpdateResponse{ApiResponse: ApiResponse{Type: JSApiStreamUpdateResponseType}}
-
-	accName := tokenAt(subject, 6)
-	streamName := tokenAt(subject, 7)
+	// Determine if we should proceed here when we are in clustered mode.
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		// Make sure we are meta leader.
+		if !s.JetStreamIsLeader() {
+			return
+		}
+	}
 
-	targetAcc, ok := s.accounts.Load(accName)
-	if !ok {
-		resp.Error = NewJSNoAccountError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
 
-	streamFound := false
-	cfg := StreamConfig{}
-	currPeers := []string{}
-	js.mu.Lock()
-	streams, ok := cc.streams[accName]
-	if ok {
-		sa, ok := streams[streamName]
-		if ok {
-			cfg = *sa.Config
-			streamFound = true
-			currPeers = sa.Group.Peers
+	var offset int
+	var filter string
+	limit := JSApiListLimit
+
+	if !isEmptyRequest(msg) {
+		var req JSApiStreamListRequest
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		offset, limit = req.Offset, req.pageLimit(JSApiListLimit)
+		if req.Subject != _EMPTY_ {
+			filter = req.Subject
 		}
 	}
-	js.mu.Unlock()
 
-	if !streamFound {
-		resp.Error = NewJSStreamNotFoundError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	// Clustered mode will invoke a scatter and gather.
+	if s.JetStreamIsClustered() {
+		// Need to copy these off before sending.. don't move this inside startGoRoutine!!!
+		msg = copyBytes(msg)
+		s.startGoRoutine(func() { s.jsClusteredStreamListRequest(acc, ci, filter, offset, limit, subject, reply, msg) })
 		return
 	}
 
-	if len(currPeers) <= cfg.Replicas {
-		resp.Error = NewJSStreamMoveNotInProgressError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
+	// TODO(dlc) - Maybe hold these results for large results that we expect to be paged.
+	// TODO(dlc) - If this list is long maybe do this in a Go routine?
+	var msets []*stream
+	if filter == _EMPTY_ {
+		msets = acc.streams()
+	} else {
+		msets = acc.filteredStreams(filter)
 	}
 
-	// make sure client is scoped to requested account
-	ciNew := *(ci)
-	ciNew.Account = accName
-
-	peers := currPeers[:cfg.Replicas]
+	sort.Slice(msets, func(i, j int) bool {
+		return strings.Compare(msets[i].cfg.Name, msets[j].cfg.Name) < 0
+	})
 
-	// Remove placement in case tags don't match
-	// This can happen if the move was initiated by modifying the tags.
-	// This is an account operation.
-	// This can NOT happen when the move was initiated by the system account.
-	// There move honors the original tag list.
-	if cfg.Placement != nil && len(cfg.Placement.Tags) != 0 {
-	FOR_TAGCHECK:
-		for _, peer := range peers {
-			si, ok := s.nodeToInfo.Load(peer)
-			if !ok {
-				// can't verify tags, do the safe thing and error
-				resp.Error = NewJSStreamGeneralError(
-					fmt.Errorf("peer %s not present for tag validation", peer))
-				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-				return
-			}
-			nodeTags := si.(nodeInfo).tags
-			for _, tag := range cfg.Placement.Tags {
-				if !nodeTags.Contains(tag) {
-					// clear placement as tags don't match
-					cfg.Placement = nil
-					break FOR_TAGCHECK
-				}
-			}
+	scnt := len(msets)
+	if offset > scnt {
+		offset = scnt
+	}
 
+	for _, mset := range msets[offset:] {
+		config := mset.config()
+		resp.Streams = append(resp.Streams, &StreamInfo{
+			Created: mset.createdTime(),
+			State:   mset.state(),
+			Config:  config,
+			Domain:  s.getOpts().JetStreamDomain,
+			Mirror:  mset.mirrorInfo(),
+			Sources: mset.sourcesInfo(),
+		})
+		if len(resp.Streams) >= limit {
+			break
 		}
 	}
-
-	s.Noticef("Requested cancel of move: R=%d '%s > %s' to peer set %+v and restore previous peer set %+v",
-		cfg.Replicas, streamName, accName, s.peerSetToNames(currPeers), s.peerSetToNames(peers))
-
-	// We will always have peers and therefore never do a callout, therefore it is safe to call inline
-	s.jsClusteredStreamUpdateRequest(&ciNew, targetAcc.(*Account), subject, reply, rmsg, &cfg, peers)
+	resp.Total = scnt
+	resp.Limit = limit
+	resp.Offset = offset
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// Request to have an account purged
-func (s *Server) jsLeaderAccountPurgeRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request for information about a stream.
+func (s *Server) jsStreamInfoRequest(sub *subscription, c *client, a *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
-
-	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	ci, acc, hdr, msg, err := s.getRequestInfo(c, rmsg)
 	if err != nil {
 		s.Warnf(badAPIRequestT, msg)
 		return
 	}
 
-	js := s.getJetStream()
-	if js == nil {
-		return
+	streamName := streamNameFromSubject(subject)
+
+	var resp = JSApiStreamInfoResponse{ApiResponse: ApiResponse{Type: JSApiStreamInfoResponseType}}
+
+	// If someone creates a duplicate stream that is identical we will get this request forwarded to us.
+	// Make sure the response type is for a create call.
+	if rt := getHeader(JSResponseType, hdr); len(rt) > 0 && string(rt) == jsCreateResponse {
+		resp.ApiResponse.Type = JSApiStreamCreateResponseType
 	}
 
-	accName := tokenAt(subject, 5)
+	var clusterWideConsCount int
 
-	var resp = JSApiAccountPurgeResponse{ApiResponse: ApiResponse{Type: JSApiAccountPurgeResponseType}}
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if s.JetStreamIsClustered() {
+		// Check to make sure the stream is assigned.
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
 
-	if !s.JetStreamIsClustered() {
-		var streams []*stream
-		var ac *Account
-		if ac, err = s.lookupAccount(accName); err == nil && ac != nil {
-			streams = ac.streams()
+		js.mu.RLock()
+		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, streamName)
+		var offline bool
+		if sa != nil {
+			clusterWideConsCount = len(sa.consumers)
+			offline = s.allPeersOffline(sa.Group)
 		}
+		js.mu.RUnlock()
 
-		s.Noticef("Purge request for account %s (streams: %d, hasAccount: %t)",
-			accName, len(streams), ac != nil)
+		if isLeader && sa == nil {
+			// We can't find the stream, so mimic what would be the errors below.
+			if hasJS, doErr := acc.checkJetStream(); !hasJS {
+				if doErr {
+					resp.Error = NewJSNotEnabledForAccountError()
+					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				}
+				return
+			}
+			// No stream present.
+			resp.Error = NewJSStreamNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		} else if sa == nil {
+			if js.isLeaderless() {
+				resp.Error = NewJSClusterNotAvailError()
+				// Delaying an error response gives the leader a chance to respond before us
+				s.sendDelayedAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp), nil)
+			}
+			return
+		} else if isLeader && offline {
+			resp.Error = NewJSStreamOfflineError()
+			s.sendDelayedAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp), nil)
+			return
+		}
 
-		for _, mset := range streams {
-			err := mset.delete()
-			if err != nil {
-				resp.Error = NewJSStreamDeleteError(err)
-				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		// Check to see if we are a member of the group and if the group has no leader.
+		isLeaderless := js.isGroupLeaderless(sa.Group)
+
+		// We have the stream assigned and a leader, so only the stream leader should answer.
+		if !acc.JetStreamIsStreamLeader(streamName) && !isLeaderless {
+			if js.isLeaderless() {
+				resp.Error = NewJSClusterNotAvailError()
+				// Delaying an error response gives the leader a chance to respond before us
+				s.sendDelayedAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp), sa.Group)
+				return
+			}
+
+			// We may be in process of electing a leader, but if this is a scale up from 1 we will still be the state leader
+			// while the new members work through the election and catchup process.
+			// Double check for that instead of exiting here and being silent. e.g. nats stream update test --replicas=3
+			js.mu.RLock()
+			rg := sa.Group
+			var ourID string
+			if cc.meta != nil {
+				ourID = cc.meta.ID()
+			}
+			// We have seen cases where rg or rg.node is nil at this point,
+			// so check explicitly on those conditions and bail if that is
+			// the case.
+			bail := rg == nil || rg.node == nil || !rg.isMember(ourID)
+			if !bail {
+				// We know we are a member here, if this group is new and we are preferred allow us to answer.
+				bail = rg.Preferred != ourID || time.Since(rg.node.Created()) > lostQuorumIntervalDefault
+			}
+			js.mu.RUnlock()
+			if bail {
 				return
 			}
 		}
-		if err := os.RemoveAll(filepath.Join(js.config.StoreDir, accName)); err != nil {
-			resp.Error = NewJSStreamGeneralError(err)
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
 		}
-		resp.Initiated = true
-		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	_, cc := s.getJetStreamCluster()
-	if cc == nil || cc.meta == nil || !cc.isLeader() {
-		return
+	var details bool
+	var subjects string
+	var offset int
+	if !isEmptyRequest(msg) {
+		var req JSApiStreamInfoRequest
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		details, subjects = req.DeletedDetails, req.SubjectsFilter
+		offset = req.Offset
 	}
 
-	if js.isMetaRecovering() {
-		// While in recovery mode, the data structures are not fully initialized
-		resp.Error = NewJSClusterNotAvailError()
+	mset, err := acc.lookupStream(streamName)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
+	config := mset.config()
 
-	js.mu.RLock()
-	ns, nc := 0, 0
-	streams, hasAccount := cc.streams[accName]
-	for _, osa := range streams {
-		for _, oca := range osa.consumers {
-			oca.deleted = true
-			ca := &consumerAssignment{Group: oca.Group, Stream: oca.Stream, Name: oca.Name, Config: oca.Config, Subject: subject, Client: oca.Client}
-			cc.meta.Propose(encodeDeleteConsumerAssignment(ca))
-			nc++
-		}
-		sa := &streamAssignment{Group: osa.Group, Config: osa.Config, Subject: subject, Client: osa.Client}
-		cc.meta.Propose(encodeDeleteStreamAssignment(sa))
-		ns++
-	}
-	js.mu.RUnlock()
-
-	s.Noticef("Purge request for account %s (streams: %d, consumer: %d, hasAccount: %t)", accName, ns, nc, hasAccount)
-
-	resp.Initiated = true
-	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-}
+	js, _ := s.getJetStreamCluster()
 
-// Request to have the meta leader stepdown.
-// These will only be received the the meta leaders, so less checking needed.
-func (s *Server) jsLeaderStepDownRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
-	if c == nil || !s.JetStreamEnabled() {
-		return
+	resp.StreamInfo = &StreamInfo{
+		Created:    mset.createdTime(),
+		State:      mset.stateWithDetail(details),
+		Config:     config,
+		Domain:     s.getOpts().JetStreamDomain,
+		Cluster:    js.clusterInfo(mset.raftGroup()),
+		Mirror:     mset.mirrorInfo(),
+		Sources:    mset.sourcesInfo(),
+		Alternates: js.streamAlternates(ci, config.Name),
+		PubAcks:    mset.pubAckStats(),
+		Failed:     mset.failureInfo(),
+		Remote:     mset.remoteInfo(),
 	}
-
-	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
-	if err != nil {
-		s.Warnf(badAPIRequestT, msg)
-		return
+	if clusterWideConsCount > 0 {
+		resp.StreamInfo.State.Consumers = clusterWideConsCount
 	}
 
-	js, cc := s.getJetStreamCluster()
-	if js == nil || cc == nil || cc.meta == nil {
-		return
-	}
+	// Check if they have asked for subject details.
+	if subjects != _EMPTY_ {
+		st := mset.store.SubjectsTotals(subjects)
+		if lst := len(st); lst > 0 {
+			// Common for both cases.
+			resp.Offset = offset
+			resp.Limit = JSMaxSubjectDetails
+			resp.Total = lst
 
-	// Extra checks here but only leader is listening.
-	js.mu.RLock()
-	isLeader := cc.isLeader()
-	js.mu.RUnlock()
+			if offset == 0 && lst <= JSMaxSubjectDetails {
+				resp.StreamInfo.State.Subjects = st
+			} else {
+				// Here we have to filter list due to offset or maximum constraints.
+				subjs := make([]string, 0, len(st))
+				for subj := range st {
+					subjs = append(subjs, subj)
+				}
+				// Sort it
+				sort.Strings(subjs)
 
-	if !isLeader {
-		return
-	}
+				if offset > len(subjs) {
+					offset = len(subjs)
+				}
 
-	var preferredLeader string
-	var resp = JSApiLeaderStepDownResponse{ApiResponse: ApiResponse{Type: JSApiLeaderStepDownResponseType}}
+				end := offset + JSMaxSubjectDetails
+				if end > len(subjs) {
+					end = len(subjs)
+				}
+				actualSize := end - offset
+				var sd map[string]uint64
 
-	if !isEmptyRequest(msg) {
-		var req JSApiLeaderStepdownRequest
-		if err := json.Unmarshal(msg, &req); err != nil {
-			resp.Error = NewJSInvalidJSONError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
-		if len(req.Placement.Tags) > 0 {
-			// Tags currently not supported.
-			resp.Error = NewJSClusterTagsError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
-		cn := req.Placement.Cluster
-		var peers []string
-		ourID := cc.meta.ID()
-		for _, p := range cc.meta.Peers() {
-			if si, ok := s.nodeToInfo.Load(p.ID); ok && si != nil {
-				if ni := si.(nodeInfo); ni.offline || ni.cluster != cn || p.ID == ourID {
-					continue
+				if actualSize > 0 {
+					sd = make(map[string]uint64, actualSize)
+					for _, ss := range subjs[offset:end] {
+						sd[ss] = st[ss]
+					}
 				}
-				peers = append(peers, p.ID)
+				resp.StreamInfo.State.Subjects = sd
 			}
 		}
-		if len(peers) == 0 {
-			resp.Error = NewJSClusterNoPeersError(fmt.Errorf("no replacement peer connected"))
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
-		// Randomize and select.
-		if len(peers) > 1 {
-			rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
-		}
-		preferredLeader = peers[0]
 	}
-
-	// Call actual stepdown.
-	err = cc.meta.StepDown(preferredLeader)
-	if err != nil {
-		resp.Error = NewJSRaftGeneralError(err, Unless(err))
-	} else {
-		resp.Success = true
+	// Check for out of band catchups.
+	if mset.hasCatchupPeers() {
+		mset.checkClusterInfo(resp.StreamInfo.Cluster)
 	}
-	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
-}
 
-func isEmptyRequest(req []byte) bool {
-	if len(req) == 0 {
-		return true
-	}
-	if bytes.Equal(req, []byte("{}")) {
-		return true
-	}
-	// If we are here we didn't get our simple match, but still could be valid.
-	var v interface{}
-	if err := json.Unmarshal(req, &v); err != nil {
-		return false
-	}
-	vm, ok := v.(map[string]interface{})
-	if !ok {
-		return false
-	}
-	return len(vm) == 0
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// Request to delete a stream.
-func (s *Server) jsStreamDeleteRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request to have a stream leader stepdown.
+func (s *Server) jsStreamLeaderStepDownRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
@@ -2741,23 +3270,39 @@ func (s *Server) jsStreamDeleteRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 
-	var resp = JSApiStreamDeleteResponse{ApiResponse: ApiResponse{Type: JSApiStreamDeleteResponseType}}
+	// Have extra token for this one.
+	name := tokenAt(subject, 6)
 
-	// Determine if we should proceed here when we are in clustered mode.
-	if s.JetStreamIsClustered() {
-		js, cc := s.getJetStreamCluster()
-		if js == nil || cc == nil {
-			return
-		}
-		if js.isLeaderless() {
-			resp.Error = NewJSClusterNotAvailError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
-		// Make sure we are meta leader.
-		if !s.JetStreamIsLeader() {
-			return
-		}
+	var resp = JSApiStreamLeaderStepDownResponse{ApiResponse: ApiResponse{Type: JSApiStreamLeaderStepDownResponseType}}
+
+	// If we are not in clustered mode this is a failed request.
+	if !s.JetStreamIsClustered() {
+		resp.Error = NewJSClusterRequiredError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	// If we are here we are clustered. See if we are the stream leader in order to proceed.
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil {
+		return
+	}
+	if js.isLeaderless() {
+		resp.Error = NewJSClusterNotAvailError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	js.mu.RLock()
+	isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, name)
+	js.mu.RUnlock()
+
+	if isLeader && sa == nil {
+		resp.Error = NewJSStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	} else if sa == nil {
+		return
 	}
 
 	if hasJS, doErr := acc.checkJetStream(); !hasJS {
@@ -2767,39 +3312,47 @@ func (s *Server) jsStreamDeleteRequest(sub *subscription, c *client, _ *Account,
 		}
 		return
 	}
-
 	if !isEmptyRequest(msg) {
-		resp.Error = NewJSNotEmptyRequestError()
+		resp.Error = NewJSBadRequestError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
-	stream := streamNameFromSubject(subject)
 
-	// Clustered.
-	if s.JetStreamIsClustered() {
-		s.jsClusteredStreamDeleteRequest(ci, acc, stream, subject, reply, msg)
+	// Check to see if we are a member of the group and if the group has no leader.
+	if js.isGroupLeaderless(sa.Group) {
+		resp.Error = NewJSClusterNotAvailError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	mset, err := acc.lookupStream(stream)
+	// We have the stream assigned and a leader, so only the stream leader should answer.
+	if !acc.JetStreamIsStreamLeader(name) {
+		return
+	}
+
+	mset, err := acc.lookupStream(name)
 	if err != nil {
 		resp.Error = NewJSStreamNotFoundError(Unless(err))
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	if err := mset.delete(); err != nil {
-		resp.Error = NewJSStreamDeleteError(err, Unless(err))
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
+	// Call actual stepdown.
+	if mset != nil {
+		if node := mset.raftNode(); node != nil {
+			mset.setLeader(false)
+			// TODO (mh) eventually make sure all go routines exited and all channels are cleared
+			time.Sleep(250 * time.Millisecond)
+			node.StepDown()
+		}
 	}
+
 	resp.Success = true
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// Request to delete a message.
-// This expects a stream sequence number as the msg body.
-func (s *Server) jsMsgDeleteRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request to have a consumer leader stepdown.
+func (s *Server) jsConsumerLeaderStepDownRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
@@ -2809,55 +3362,59 @@ func (s *Server) jsMsgDeleteRequest(sub *subscription, c *client, _ *Account, su
 		return
 	}
 
-	stream := tokenAt(subject, 6)
+	var resp = JSApiConsumerLeaderStepDownResponse{ApiResponse: ApiResponse{Type: JSApiConsumerLeaderStepDownResponseType}}
 
-	var resp = JSApiMsgDeleteResponse{ApiResponse: ApiResponse{Type: JSApiMsgDeleteResponseType}}
+	// If we are not in clustered mode this is a failed request.
+	if !s.JetStreamIsClustered() {
+		resp.Error = NewJSClusterRequiredError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 
-	// If we are in clustered mode we need to be the stream leader to proceed.
-	if s.JetStreamIsClustered() {
-		// Check to make sure the stream is assigned.
-		js, cc := s.getJetStreamCluster()
-		if js == nil || cc == nil {
-			return
-		}
-		if js.isLeaderless() {
-			resp.Error = NewJSClusterNotAvailError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
+	// If we are here we are clustered. See if we are the stream leader in order to proceed.
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil {
+		return
+	}
+	if js.isLeaderless() {
+		resp.Error = NewJSClusterNotAvailError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 
-		js.mu.RLock()
-		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
-		js.mu.RUnlock()
+	// Have extra token for this one.
+	stream := tokenAt(subject, 6)
+	consumer := tokenAt(subject, 7)
 
-		if isLeader && sa == nil {
-			// We can't find the stream, so mimic what would be the errors below.
-			if hasJS, doErr := acc.checkJetStream(); !hasJS {
-				if doErr {
-					resp.Error = NewJSNotEnabledForAccountError()
-					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-				}
-				return
-			}
-			// No stream present.
-			resp.Error = NewJSStreamNotFoundError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		} else if sa == nil {
-			return
-		}
+	js.mu.RLock()
+	isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+	js.mu.RUnlock()
 
-		// Check to see if we are a member of the group and if the group has no leader.
-		if js.isGroupLeaderless(sa.Group) {
-			resp.Error = NewJSClusterNotAvailError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
+	if isLeader && sa == nil {
+		resp.Error = NewJSStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	} else if sa == nil {
+		return
+	}
+	var ca *consumerAssignment
+	if sa.consumers != nil {
+		ca = sa.consumers[consumer]
+	}
+	if ca == nil {
+		resp.Error = NewJSConsumerNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	// Check to see if we are a member of the group and if the group has no leader.
+	if js.isGroupLeaderless(ca.Group) {
+		resp.Error = NewJSClusterNotAvailError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 
-		// We have the stream assigned and a leader, so only the stream leader should answer.
-		if !acc.JetStreamIsStreamLeader(stream) {
-			return
-		}
+	if !acc.JetStreamIsConsumerLeader(stream, consumer) {
+		return
 	}
 
 	if hasJS, doErr := acc.checkJetStream(); !hasJS {
@@ -2867,58 +3424,39 @@ func (s *Server) jsMsgDeleteRequest(sub *subscription, c *client, _ *Account, su
 		}
 		return
 	}
-	if isEmptyRequest(msg) {
+	if !isEmptyRequest(msg) {
 		resp.Error = NewJSBadRequestError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
-	var req JSApiMsgDeleteRequest
-	if err := json.Unmarshal(msg, &req); err != nil {
-		resp.Error = NewJSInvalidJSONError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
-	}
 
 	mset, err := acc.lookupStream(stream)
 	if err != nil {
-		resp.Error = NewJSStreamNotFoundError(Unless(err))
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
-	}
-	if mset.cfg.Sealed {
-		resp.Error = NewJSStreamSealedError()
+		resp.Error = NewJSStreamNotFoundError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
-	if mset.cfg.DenyDelete {
-		resp.Error = NewJSStreamMsgDeleteFailedError(errors.New("message delete not permitted"))
+	o := mset.lookupConsumer(consumer)
+	if o == nil {
+		resp.Error = NewJSConsumerNotFoundError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	if s.JetStreamIsClustered() {
-		s.jsClusteredMsgDeleteRequest(ci, acc, mset, stream, subject, reply, &req, rmsg)
-		return
+	// Call actual stepdown.
+	if n := o.raftNode(); n != nil {
+		o.setLeader(false)
+		// TODO (mh) eventually make sure all go routines exited and all channels are cleared
+		time.Sleep(250 * time.Millisecond)
+		n.StepDown()
 	}
 
-	var removed bool
-	if req.NoErase {
-		removed, err = mset.removeMsg(req.Seq)
-	} else {
-		removed, err = mset.eraseMsg(req.Seq)
-	}
-	if err != nil {
-		resp.Error = NewJSStreamMsgDeleteFailedError(err, Unless(err))
-	} else if !removed {
-		resp.Error = NewJSSequenceNotFoundError(req.Seq)
-	} else {
-		resp.Success = true
-	}
+	resp.Success = true
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// Request to get a raw stream message.
-func (s *Server) jsMsgGetRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request to remove a peer from a clustered stream.
+func (s *Server) jsStreamRemovePeerRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
@@ -2928,55 +3466,36 @@ func (s *Server) jsMsgGetRequest(sub *subscription, c *client, _ *Account, subje
 		return
 	}
 
-	stream := tokenAt(subject, 6)
-
-	var resp = JSApiMsgGetResponse{ApiResponse: ApiResponse{Type: JSApiMsgGetResponseType}}
+	// Have extra token for this one.
+	name := tokenAt(subject, 6)
 
-	// If we are in clustered mode we need to be the stream leader to proceed.
-	if s.JetStreamIsClustered() {
-		// Check to make sure the stream is assigned.
-		js, cc := s.getJetStreamCluster()
-		if js == nil || cc == nil {
-			return
-		}
-		if js.isLeaderless() {
-			resp.Error = NewJSClusterNotAvailError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
+	var resp = JSApiStreamRemovePeerResponse{ApiResponse: ApiResponse{Type: JSApiStreamRemovePeerResponseType}}
 
-		js.mu.RLock()
-		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
-		js.mu.RUnlock()
+	// If we are not in clustered mode this is a failed request.
+	if !s.JetStreamIsClustered() {
+		resp.Error = NewJSClusterRequiredError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 
-		if isLeader && sa == nil {
-			// We can't find the stream, so mimic what would be the errors below.
-			if hasJS, doErr := acc.checkJetStream(); !hasJS {
-				if doErr {
-					resp.Error = NewJSNotEnabledForAccountError()
-					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-				}
-				return
-			}
-			// No stream present.
-			resp.Error = NewJSStreamNotFoundError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		} else if sa == nil {
-			return
-		}
+	// If we are here we are clustered. See if we are the stream leader in order to proceed.
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil {
+		return
+	}
+	if js.isLeaderless() {
+		resp.Error = NewJSClusterNotAvailError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 
-		// Check to see if we are a member of the group and if the group has no leader.
-		if js.isGroupLeaderless(sa.Group) {
-			resp.Error = NewJSClusterNotAvailError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
+	js.mu.RLock()
+	isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, name)
+	js.mu.RUnlock()
 
-		// We have the stream assigned and a leader, so only the stream leader should answer.
-		if !acc.JetStreamIsStreamLeader(stream) {
-			return
-		}
+	// Make sure we are meta leader.
+	if !isLeader {
+		return
 	}
 
 	if hasJS, doErr := acc.checkJetStream(); !hasJS {
@@ -2991,461 +3510,1715 @@ func (s *Server) jsMsgGetRequest(sub *subscription, c *client, _ *Account, subje
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
-	var req JSApiMsgGetRequest
+
+	var req JSApiStreamRemovePeerRequest
 	if err := json.Unmarshal(msg, &req); err != nil {
 		resp.Error = NewJSInvalidJSONError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
-
-	// Check that we do not have both options set.
-	if req.Seq > 0 && req.LastFor != _EMPTY_ || req.Seq == 0 && req.LastFor == _EMPTY_ && req.NextFor == _EMPTY_ {
-		resp.Error = NewJSBadRequestError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
-	}
-	// Check that both last and next not both set.
-	if req.LastFor != _EMPTY_ && req.NextFor != _EMPTY_ {
+	if req.Peer == _EMPTY_ {
 		resp.Error = NewJSBadRequestError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	mset, err := acc.lookupStream(stream)
-	if err != nil {
+	if sa == nil {
+		// No stream present.
 		resp.Error = NewJSStreamNotFoundError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	var svp StoreMsg
-	var sm *StoreMsg
+	// Check to see if we are a member of the group and if the group has no leader.
+	// Peers here is a server name, convert to node name.
+	nodeName := getHash(req.Peer)
 
-	if req.Seq > 0 && req.NextFor == _EMPTY_ {
-		sm, err = mset.store.LoadMsg(req.Seq, &svp)
-	} else if req.NextFor != _EMPTY_ {
-		sm, _, err = mset.store.LoadNextMsg(req.NextFor, subjectHasWildcard(req.NextFor), req.Seq, &svp)
-	} else {
-		sm, err = mset.store.LoadLastMsg(req.LastFor, &svp)
-	}
-	if err != nil {
-		resp.Error = NewJSNoMessageFoundError()
+	js.mu.RLock()
+	rg := sa.Group
+	isMember := rg.isMember(nodeName)
+	js.mu.RUnlock()
+
+	// Make sure we are a member.
+	if !isMember {
+		resp.Error = NewJSClusterPeerNotMemberError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
-	resp.Message = &StoredMsg{
-		Subject:  sm.subj,
-		Sequence: sm.seq,
-		Header:   sm.hdr,
-		Data:     sm.msg,
-		Time:     time.Unix(0, sm.ts).UTC(),
+
+	// If we are here we have a valid peer member set for removal.
+	if !js.removePeerFromStream(sa, nodeName) {
+		resp.Error = NewJSPeerRemapError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
 	}
 
-	// Don't send response through API layer for this call.
-	s.sendInternalAccountMsg(nil, reply, s.jsonResponse(resp))
+	resp.Success = true
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// Request to purge a stream.
-func (s *Server) jsStreamPurgeRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request to have the metaleader remove a peer from the system.
+func (s *Server) jsLeaderServerRemoveRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
+
 	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
 	if err != nil {
 		s.Warnf(badAPIRequestT, msg)
 		return
 	}
 
-	stream := streamNameFromSubject(subject)
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil || cc.meta == nil {
+		return
+	}
 
-	var resp = JSApiStreamPurgeResponse{ApiResponse: ApiResponse{Type: JSApiStreamPurgeResponseType}}
+	// Extra checks here but only leader is listening.
+	js.mu.RLock()
+	isLeader := cc.isLeader()
+	js.mu.RUnlock()
 
-	// If we are in clustered mode we need to be the stream leader to proceed.
-	if s.JetStreamIsClustered() {
-		// Check to make sure the stream is assigned.
-		js, cc := s.getJetStreamCluster()
-		if js == nil || cc == nil {
-			return
-		}
-
-		js.mu.RLock()
-		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
-		js.mu.RUnlock()
-
-		if isLeader && sa == nil {
-			// We can't find the stream, so mimic what would be the errors below.
-			if hasJS, doErr := acc.checkJetStream(); !hasJS {
-				if doErr {
-					resp.Error = NewJSNotEnabledForAccountError()
-					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-				}
-				return
-			}
-			// No stream present.
-			resp.Error = NewJSStreamNotFoundError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		} else if sa == nil {
-			if js.isLeaderless() {
-				resp.Error = NewJSClusterNotAvailError()
-				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			}
-			return
-		}
+	if !isLeader {
+		return
+	}
 
-		// Check to see if we are a member of the group and if the group has no leader.
-		if js.isGroupLeaderless(sa.Group) {
-			resp.Error = NewJSClusterNotAvailError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
+	var resp = JSApiMetaServerRemoveResponse{ApiResponse: ApiResponse{Type: JSApiMetaServerRemoveResponseType}}
 
-		// We have the stream assigned and a leader, so only the stream leader should answer.
-		if !acc.JetStreamIsStreamLeader(stream) {
-			if js.isLeaderless() {
-				resp.Error = NewJSClusterNotAvailError()
-				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			}
-			return
-		}
+	if isEmptyRequest(msg) {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
 	}
 
-	if hasJS, doErr := acc.checkJetStream(); !hasJS {
-		if doErr {
-			resp.Error = NewJSNotEnabledForAccountError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		}
+	var req JSApiMetaServerRemoveRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	var purgeRequest *JSApiStreamPurgeRequest
-	if !isEmptyRequest(msg) {
-		var req JSApiStreamPurgeRequest
-		if err := json.Unmarshal(msg, &req); err != nil {
-			resp.Error = NewJSInvalidJSONError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
+	var found string
+	js.mu.RLock()
+	for _, p := range cc.meta.Peers() {
+		// If Peer is specified, it takes precedence
+		if req.Peer != _EMPTY_ {
+			if p.ID == req.Peer {
+				found = req.Peer
+				break
+			}
+			continue
 		}
-		if req.Sequence > 0 && req.Keep > 0 {
-			resp.Error = NewJSBadRequestError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
+		si, ok := s.nodeToInfo.Load(p.ID)
+		if ok && si.(nodeInfo).name == req.Server {
+			found = p.ID
+			break
 		}
-		purgeRequest = &req
 	}
+	js.mu.RUnlock()
 
-	mset, err := acc.lookupStream(stream)
-	if err != nil {
-		resp.Error = NewJSStreamNotFoundError(Unless(err))
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
-	}
-	if mset.cfg.Sealed {
-		resp.Error = NewJSStreamSealedError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
-	}
-	if mset.cfg.DenyPurge {
-		resp.Error = NewJSStreamPurgeFailedError(errors.New("stream purge not permitted"))
+	if found == _EMPTY_ {
+		resp.Error = NewJSClusterServerNotMemberError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	if s.JetStreamIsClustered() {
-		s.jsClusteredStreamPurgeRequest(ci, acc, mset, stream, subject, reply, rmsg, purgeRequest)
-		return
-	}
+	// So we have a valid peer.
+	js.mu.Lock()
+	cc.meta.ProposeRemovePeer(found)
+	js.mu.Unlock()
 
-	purged, err := mset.purge(purgeRequest)
-	if err != nil {
-		resp.Error = NewJSStreamGeneralError(err, Unless(err))
-	} else {
-		resp.Purged = purged
-		resp.Success = true
-	}
-	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+	resp.Success = true
+	s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 }
 
-func (acc *Account) jsNonClusteredStreamLimitsCheck(cfg *StreamConfig) *ApiError {
-	selectedLimits, tier, jsa, apiErr := acc.selectLimits(cfg)
-	if apiErr != nil {
-		return apiErr
-	}
-	jsa.mu.RLock()
-	defer jsa.mu.RUnlock()
-	if selectedLimits.MaxStreams > 0 && jsa.countStreams(tier, cfg) >= selectedLimits.MaxStreams {
-		return NewJSMaximumStreamsLimitError()
+func (s *Server) peerSetToNames(ps []string) []string {
+	names := make([]string, len(ps))
+	for i := 0; i < len(ps); i++ {
+		if si, ok := s.nodeToInfo.Load(ps[i]); !ok {
+			names[i] = ps[i]
+		} else {
+			names[i] = si.(nodeInfo).name
+		}
 	}
-	reserved := jsa.tieredReservation(tier, cfg)
-	if err := jsa.js.checkAllLimits(selectedLimits, cfg, reserved, 0); err != nil {
-		return NewJSStreamLimitsError(err, Unless(err))
+	return names
+}
+
+// looks up the peer id for a given server name. Cluster and domain name are optional filter criteria
+func (s *Server) nameToPeer(js *jetStream, serverName, clusterName, domainName string) string {
+	js.mu.RLock()
+	cc := js.cluster
+	defer js.mu.RUnlock()
+	for _, p := range cc.meta.Peers() {
+		si, ok := s.nodeToInfo.Load(p.ID)
+		if ok && si.(nodeInfo).name == serverName {
+			if clusterName == _EMPTY_ || clusterName == si.(nodeInfo).cluster {
+				if domainName == _EMPTY_ || domainName == si.(nodeInfo).domain {
+					return p.ID
+				}
+			}
+		}
 	}
-	return nil
+	return _EMPTY_
 }
 
-// Request to restore a stream.
-func (s *Server) jsStreamRestoreRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
-	if c == nil || !s.JetStreamIsLeader() {
+// Request to have the metaleader move a stream on a peer to another
+func (s *Server) jsLeaderServerStreamMoveRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
+
 	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
 	if err != nil {
 		s.Warnf(badAPIRequestT, msg)
 		return
 	}
 
-	var resp = JSApiStreamRestoreResponse{ApiResponse: ApiResponse{Type: JSApiStreamRestoreResponseType}}
-	if !acc.JetStreamEnabled() {
-		resp.Error = NewJSNotEnabledForAccountError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil || cc.meta == nil {
 		return
 	}
-	if isEmptyRequest(msg) {
-		resp.Error = NewJSBadRequestError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+
+	// Extra checks here but only leader is listening.
+	js.mu.RLock()
+	isLeader := cc.isLeader()
+	js.mu.RUnlock()
+
+	if !isLeader {
 		return
 	}
 
-	var req JSApiStreamRestoreRequest
+	accName := tokenAt(subject, 6)
+	streamName := tokenAt(subject, 7)
+
+	var resp = JSApiStreamUpdateResponse{ApiResponse: ApiResponse{Type: JSApiStreamUpdateResponseType}}
+
+	var req JSApiMetaServerStreamMoveRequest
 	if err := json.Unmarshal(msg, &req); err != nil {
 		resp.Error = NewJSInvalidJSONError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	stream := streamNameFromSubject(subject)
-
-	if stream != req.Config.Name && req.Config.Name == _EMPTY_ {
-		req.Config.Name = stream
+	srcPeer := _EMPTY_
+	if req.Server != _EMPTY_ {
+		srcPeer = s.nameToPeer(js, req.Server, req.Cluster, req.Domain)
 	}
 
-	// check stream config at the start of the restore process, not at the end
-	cfg, apiErr := s.checkStreamCfg(&req.Config, acc)
-	if apiErr != nil {
-		resp.Error = apiErr
+	targetAcc, ok := s.accounts.Load(accName)
+	if !ok {
+		resp.Error = NewJSNoAccountError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	if s.JetStreamIsClustered() {
-		s.jsClusteredStreamRestoreRequest(ci, acc, &req, stream, subject, reply, rmsg)
-		return
-	}
-
-	if err := acc.jsNonClusteredStreamLimitsCheck(&cfg); err != nil {
-		resp.Error = err
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
+	var streamFound bool
+	cfg := StreamConfig{}
+	currPeers := []string{}
+	currCluster := _EMPTY_
+	js.mu.Lock()
+	streams, ok := cc.streams[accName]
+	if ok {
+		sa, ok := streams[streamName]
+		if ok {
+			cfg = *sa.Config
+			streamFound = true
+			currPeers = sa.Group.Peers
+			currCluster = sa.Group.Cluster
+		}
 	}
+	js.mu.Unlock()
 
-	if _, err := acc.lookupStream(stream); err == nil {
-		resp.Error = NewJSStreamNameExistRestoreFailedError()
+	if !streamFound {
+		resp.Error = NewJSStreamNotFoundError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	if hasJS, doErr := acc.checkJetStream(); !hasJS {
-		if doErr {
-			resp.Error = NewJSNotEnabledForAccountError()
+	// if server was picked, make sure src peer exists and move it to first position.
+	// removal will drop peers from the left
+	if req.Server != _EMPTY_ {
+		if srcPeer == _EMPTY_ {
+			resp.Error = NewJSClusterServerNotMemberError()
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
 		}
-		return
-	}
-
-	s.processStreamRestore(ci, acc, &req.Config, subject, reply, string(msg))
-}
-
-func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamConfig, subject, reply, msg string) <-chan error {
-	js := s.getJetStream()
-
-	var resp = JSApiStreamRestoreResponse{ApiResponse: ApiResponse{Type: JSApiStreamRestoreResponseType}}
-
-	snapDir := filepath.Join(js.config.StoreDir, snapStagingDir)
-	if _, err := os.Stat(snapDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(snapDir, defaultDirPerms); err != nil {
-			resp.Error = &ApiError{Code: 503, Description: "JetStream unable to create temp storage for restore"}
+		var peerFound bool
+		for i := 0; i < len(currPeers); i++ {
+			if currPeers[i] == srcPeer {
+				copy(currPeers[1:], currPeers[:i])
+				currPeers[0] = srcPeer
+				peerFound = true
+				break
+			}
+		}
+		if !peerFound {
+			resp.Error = NewJSClusterPeerNotMemberError()
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return nil
+			return
 		}
 	}
 
-	tfile, err := os.CreateTemp(snapDir, "js-restore-")
-	if err != nil {
-		resp.Error = NewJSTempStorageFailedError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, msg, s.jsonResponse(&resp))
-		return nil
-	}
-
-	streamName := cfg.Name
-	s.Noticef("Starting restore for stream '%s > %s'", acc.Name, streamName)
-
-	start := time.Now().UTC()
-	domain := s.getOpts().JetStreamDomain
-	s.publishAdvisory(acc, JSAdvisoryStreamRestoreCreatePre+"."+streamName, &JSRestoreCreateAdvisory{
-		TypedEvent: TypedEvent{
-			Type: JSRestoreCreateAdvisoryType,
-			ID:   nuid.Next(),
-			Time: start,
-		},
-		Stream: streamName,
-		Client: ci,
-		Domain: domain,
-	})
-
-	// Create our internal subscription to accept the snapshot.
-	restoreSubj := fmt.Sprintf(jsRestoreDeliverT, streamName, nuid.Next())
+	// make sure client is scoped to requested account
+	ciNew := *(ci)
+	ciNew.Account = accName
 
-	type result struct {
-		err   error
-		reply string
+	// backup placement such that peers can be looked up with modified tag list
+	var origPlacement *Placement
+	if cfg.Placement != nil {
+		tmp := *cfg.Placement
+		origPlacement = &tmp
 	}
 
-	// For signaling to upper layers.
-	resultCh := make(chan result, 1)
-	activeQ := newIPQueue[int](s, fmt.Sprintf("[ACC:%s] stream '%s' restore", acc.Name, streamName)) // of int
+	if len(req.Tags) > 0 {
+		if cfg.Placement == nil {
+			cfg.Placement = &Placement{}
+		}
+		cfg.Placement.Tags = append(cfg.Placement.Tags, req.Tags...)
+	}
 
-	var total int
+	var peers []string
+	var e *selectPeerError
+	// Try to expand in the same cluster unless asked to move to a different one.
+	if req.TargetCluster == _EMPTY_ || req.TargetCluster == currCluster {
+		peers, e = cc.selectPeerGroup(cfg.Replicas+1, currCluster, &cfg, currPeers, 1, nil)
+	}
+	if len(peers) <= cfg.Replicas {
+		// since expanding in the same cluster did not yield a result, try in different cluster
+		peers = nil
 
-	// FIXM(dlc) - Probably take out of network path eventually due to disk I/O?
-	processChunk := func(sub *subscription, c *client, _ *Account, subject, reply string, msg []byte) {
-		// We require reply subjects to communicate back failures, flow etc. If they do not have one log and cancel.
-		if reply == _EMPTY_ {
-			sub.client.processUnsub(sub.sid)
-			resultCh <- result{
-				fmt.Errorf("restore for stream '%s > %s' requires reply subject for each chunk", acc.Name, streamName),
-				reply,
+		clusters := map[string]struct{}{}
+		if req.TargetCluster != _EMPTY_ {
+			if req.TargetCluster != currCluster {
+				clusters[req.TargetCluster] = struct{}{}
 			}
-			return
+		} else {
+			s.nodeToInfo.Range(func(_, ni interface{}) bool {
+				if currCluster != ni.(nodeInfo).cluster {
+					clusters[ni.(nodeInfo).cluster] = struct{}{}
+				}
+				return true
+			})
 		}
-		// Account client messages have \r\n on end. This is an error.
-		if len(msg) < LEN_CR_LF {
-			sub.client.processUnsub(sub.sid)
-			resultCh <- result{
-				fmt.Errorf("restore for stream '%s > %s' received short chunk", acc.Name, streamName),
-				reply,
+		errs := &selectPeerError{}
+		errs.accumulate(e)
+		for cluster := range clusters {
+			newPeers, e := cc.selectPeerGroup(cfg.Replicas, cluster, &cfg, nil, 0, nil)
+			if len(newPeers) >= cfg.Replicas {
+				peers = append([]string{}, currPeers...)
+				peers = append(peers, newPeers[:cfg.Replicas]...)
+				break
 			}
-			return
+			errs.accumulate(e)
 		}
-		// Adjust.
-		msg = msg[:len(msg)-LEN_CR_LF]
-
-		// This means we are complete with our transfer from the client.
-		if len(msg) == 0 {
-			s.Debugf("Finished staging restore for stream '%s > %s'", acc.Name, streamName)
-			resultCh <- result{err, reply}
+		if peers == nil {
+			resp.Error = NewJSClusterNoPeersError(errs)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 			return
 		}
+	}
 
-		// We track total and check on server limits.
-		// TODO(dlc) - We could check apriori and cancel initial request if we know it won't fit.
-		total += len(msg)
-		if js.wouldExceedLimits(FileStorage, total) {
-			s.resourcesExeededError()
-			resultCh <- result{NewJSInsufficientResourcesError(), reply}
-			return
-		}
+	cfg.Placement = origPlacement
 
-		// Append chunk to temp file. Mark as issue if we encounter an error.
-		if n, err := tfile.Write(msg); n != len(msg) || err != nil {
-			resultCh <- result{err, reply}
-			if reply != _EMPTY_ {
-				s.sendInternalAccountMsg(acc, reply, "-ERR 'storage failure during restore'")
-			}
-			return
-		}
+	s.Noticef("Requested move for stream '%s > %s' R=%d from %+v to %+v",
+		streamName, accName, cfg.Replicas, s.peerSetToNames(currPeers), s.peerSetToNames(peers))
 
-		activeQ.push(len(msg))
+	// We will always have peers and therefore never do a callout, therefore it is safe to call inline
+	s.jsClusteredStreamUpdateRequest(&ciNew, targetAcc.(*Account), subject, reply, rmsg, &cfg, peers, false)
+}
 
-		s.sendInternalAccountMsg(acc, reply, nil)
+// Request to have the metaleader move a stream on a peer to another
+func (s *Server) jsLeaderServerStreamCancelMoveRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
 	}
 
-	sub, err := acc.subscribeInternal(restoreSubj, processChunk)
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
 	if err != nil {
-		tfile.Close()
-		os.Remove(tfile.Name())
-		resp.Error = NewJSRestoreSubscribeFailedError(err, restoreSubj)
-		s.sendAPIErrResponse(ci, acc, subject, reply, msg, s.jsonResponse(&resp))
-		return nil
+		s.Warnf(badAPIRequestT, msg)
+		return
 	}
 
-	// Mark the subject so the end user knows where to send the snapshot chunks.
-	resp.DeliverSubject = restoreSubj
-	s.sendAPIResponse(ci, acc, subject, reply, msg, s.jsonResponse(resp))
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil || cc.meta == nil {
+		return
+	}
 
-	doneCh := make(chan error, 1)
+	// Extra checks here but only leader is listening.
+	js.mu.RLock()
+	isLeader := cc.isLeader()
+	js.mu.RUnlock()
 
-	// Monitor the progress from another Go routine.
-	s.startGoRoutine(func() {
-		defer s.grWG.Done()
-		defer func() {
-			tfile.Close()
-			os.Remove(tfile.Name())
-			sub.client.processUnsub(sub.sid)
-			activeQ.unregister()
-		}()
+	if !isLeader {
+		return
+	}
 
-		const activityInterval = 5 * time.Second
-		notActive := time.NewTimer(activityInterval)
-		defer notActive.Stop()
+	var resp = JSApiStreamUpdateResponse{ApiResponse: ApiResponse{Type: JSApiStreamUpdateResponseType}}
 
-		total := 0
-		for {
-			select {
-			case result := <-resultCh:
-				err := result.err
-				var mset *stream
+	accName := tokenAt(subject, 6)
+	streamName := tokenAt(subject, 7)
 
-				// If we staged properly go ahead and do restore now.
-				if err == nil {
-					s.Debugf("Finalizing restore for stream '%s > %s'", acc.Name, streamName)
-					tfile.Seek(0, 0)
-					mset, err = acc.RestoreStream(cfg, tfile)
-				} else {
-					errStr := err.Error()
-					tmp := []rune(errStr)
-					tmp[0] = unicode.ToUpper(tmp[0])
-					s.Warnf(errStr)
-				}
+	targetAcc, ok := s.accounts.Load(accName)
+	if !ok {
+		resp.Error = NewJSNoAccountError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 
-				end := time.Now().UTC()
+	streamFound := false
+	cfg := StreamConfig{}
+	currPeers := []string{}
+	js.mu.Lock()
+	streams, ok := cc.streams[accName]
+	if ok {
+		sa, ok := streams[streamName]
+		if ok {
+			cfg = *sa.Config
+			streamFound = true
+			currPeers = sa.Group.Peers
+		}
+	}
+	js.mu.Unlock()
 
-				// TODO(rip) - Should this have the error code in it??
-				s.publishAdvisory(acc, JSAdvisoryStreamRestoreCompletePre+"."+streamName, &JSRestoreCompleteAdvisory{
-					TypedEvent: TypedEvent{
-						Type: JSRestoreCompleteAdvisoryType,
-						ID:   nuid.Next(),
-						Time: end,
-					},
-					Stream: streamName,
-					Start:  start,
-					End:    end,
-					Bytes:  int64(total),
-					Client: ci,
-					Domain: domain,
-				})
+	if !streamFound {
+		resp.Error = NewJSStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 
-				var resp = JSApiStreamCreateResponse{ApiResponse: ApiResponse{Type: JSApiStreamCreateResponseType}}
+	if len(currPeers) <= cfg.Replicas {
+		resp.Error = NewJSStreamMoveNotInProgressError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 
-				if err != nil {
-					resp.Error = NewJSStreamRestoreError(err, Unless(err))
-					s.Warnf("Restore failed for %s for stream '%s > %s' in %v",
-						friendlyBytes(int64(total)), streamName, acc.Name, end.Sub(start))
-				} else {
-					resp.StreamInfo = &StreamInfo{Created: mset.createdTime(), State: mset.state(), Config: mset.config()}
-					s.Noticef("Completed restore of %s for stream '%s > %s' in %v",
-						friendlyBytes(int64(total)), streamName, acc.Name, end.Sub(start))
-				}
+	// make sure client is scoped to requested account
+	ciNew := *(ci)
+	ciNew.Account = accName
 
-				// On the last EOF, send back the stream info or error status.
-				s.sendInternalAccountMsg(acc, result.reply, s.jsonResponse(&resp))
-				// Signal to the upper layers.
-				doneCh <- err
-				return
-			case <-activeQ.ch:
-				if n, ok := activeQ.popOne(); ok {
-					total += n
-					notActive.Reset(activityInterval)
-				}
+	peers := currPeers[:cfg.Replicas]
+
+	// Remove placement in case tags don't match
+	// This can happen if the move was initiated by modifying the tags.
+	// This is an account operation.
+	// This can NOT happen when the move was initiated by the system account.
+	// There move honors the original tag list.
+	if cfg.Placement != nil && len(cfg.Placement.Tags) != 0 {
+	FOR_TAGCHECK:
+		for _, peer := range peers {
+			si, ok := s.nodeToInfo.Load(peer)
+			if !ok {
+				// can't verify tags, do the safe thing and error
+				resp.Error = NewJSStreamGeneralError(
+					fmt.Errorf("peer %s not present for tag validation", peer))
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				return
+			}
+			nodeTags := si.(nodeInfo).tags
+			for _, tag := range cfg.Placement.Tags {
+				if !nodeTags.Contains(tag) {
+					// clear placement as tags don't match
+					cfg.Placement = nil
+					break FOR_TAGCHECK
+				}
+			}
+
+		}
+	}
+
+	s.Noticef("Requested cancel of move: R=%d '%s > %s' to peer set %+v and restore previous peer set %+v",
+		cfg.Replicas, streamName, accName, s.peerSetToNames(currPeers), s.peerSetToNames(peers))
+
+	// We will always have peers and therefore never do a callout, therefore it is safe to call inline
+	s.jsClusteredStreamUpdateRequest(&ciNew, targetAcc.(*Account), subject, reply, rmsg, &cfg, peers, false)
+}
+
+// Request to have an account purged
+func (s *Server) jsLeaderAccountPurgeRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	js := s.getJetStream()
+	if js == nil {
+		return
+	}
+
+	accName := tokenAt(subject, 5)
+
+	var resp = JSApiAccountPurgeResponse{ApiResponse: ApiResponse{Type: JSApiAccountPurgeResponseType}}
+
+	if !s.JetStreamIsClustered() {
+		var streams []*stream
+		var ac *Account
+		if ac, err = s.lookupAccount(accName); err == nil && ac != nil {
+			streams = ac.streams()
+		}
+
+		s.Noticef("Purge request for account %s (streams: %d, hasAccount: %t)",
+			accName, len(streams), ac != nil)
+
+		for _, mset := range streams {
+			err := mset.delete()
+			if err != nil {
+				resp.Error = NewJSStreamDeleteError(err)
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				return
+			}
+		}
+		if err := os.RemoveAll(filepath.Join(js.config.StoreDir, accName)); err != nil {
+			resp.Error = NewJSStreamGeneralError(err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		resp.Initiated = true
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	_, cc := s.getJetStreamCluster()
+	if cc == nil || cc.meta == nil || !cc.isLeader() {
+		return
+	}
+
+	if js.isMetaRecovering() {
+		// While in recovery mode, the data structures are not fully initialized
+		resp.Error = NewJSClusterNotAvailError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	js.mu.RLock()
+	ns, nc := 0, 0
+	streams, hasAccount := cc.streams[accName]
+	for _, osa := range streams {
+		for _, oca := range osa.consumers {
+			oca.deleted = true
+			ca := &consumerAssignment{Group: oca.Group, Stream: oca.Stream, Name: oca.Name, Config: oca.Config, Subject: subject, Client: oca.Client}
+			cc.meta.Propose(encodeDeleteConsumerAssignment(ca))
+			nc++
+		}
+		sa := &streamAssignment{Group: osa.Group, Config: osa.Config, Subject: subject, Client: osa.Client}
+		cc.meta.Propose(encodeDeleteStreamAssignment(sa))
+		ns++
+	}
+	js.mu.RUnlock()
+
+	s.Noticef("Purge request for account %s (streams: %d, consumer: %d, hasAccount: %t)", accName, ns, nc, hasAccount)
+
+	resp.Initiated = true
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+}
+
+// Request to have the meta leader stepdown.
+// These will only be received the the meta leaders, so less checking needed.
+func (s *Server) jsLeaderStepDownRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil || cc.meta == nil {
+		return
+	}
+
+	// Extra checks here but only leader is listening.
+	js.mu.RLock()
+	isLeader := cc.isLeader()
+	js.mu.RUnlock()
+
+	if !isLeader {
+		return
+	}
+
+	var preferredLeader string
+	var resp = JSApiLeaderStepDownResponse{ApiResponse: ApiResponse{Type: JSApiLeaderStepDownResponseType}}
+
+	if !isEmptyRequest(msg) {
+		var req JSApiLeaderStepdownRequest
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		if len(req.Placement.Tags) > 0 {
+			// Tags currently not supported.
+			resp.Error = NewJSClusterTagsError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		cn := req.Placement.Cluster
+		var peers []string
+		ourID := cc.meta.ID()
+		for _, p := range cc.meta.Peers() {
+			if si, ok := s.nodeToInfo.Load(p.ID); ok && si != nil {
+				if ni := si.(nodeInfo); ni.offline || ni.cluster != cn || p.ID == ourID {
+					continue
+				}
+				peers = append(peers, p.ID)
+			}
+		}
+		if len(peers) == 0 {
+			resp.Error = NewJSClusterNoPeersError(fmt.Errorf("no replacement peer connected"))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		// Randomize and select.
+		if len(peers) > 1 {
+			rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+		}
+		preferredLeader = peers[0]
+	}
+
+	// Call actual stepdown.
+	err = cc.meta.StepDown(preferredLeader)
+	if err != nil {
+		resp.Error = NewJSRaftGeneralError(err, Unless(err))
+	} else {
+		resp.Success = true
+	}
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
+
+func isEmptyRequest(req []byte) bool {
+	if len(req) == 0 {
+		return true
+	}
+	if bytes.Equal(req, []byte("{}")) {
+		return true
+	}
+	// If we are here we didn't get our simple match, but still could be valid.
+	var v interface{}
+	if err := json.Unmarshal(req, &v); err != nil {
+		return false
+	}
+	vm, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	return len(vm) == 0
+}
+
+// Request to delete a stream.
+func (s *Server) jsStreamDeleteRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiStreamDeleteResponse{ApiResponse: ApiResponse{Type: JSApiStreamDeleteResponseType}}
+
+	// Determine if we should proceed here when we are in clustered mode.
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		// Make sure we are meta leader.
+		if !s.JetStreamIsLeader() {
+			return
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if !isEmptyRequest(msg) {
+		resp.Error = NewJSNotEmptyRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	stream := streamNameFromSubject(subject)
+
+	// Clustered.
+	if s.JetStreamIsClustered() {
+		s.jsClusteredStreamDeleteRequest(ci, acc, stream, subject, reply, msg)
+		return
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if err := mset.delete(); err != nil {
+		resp.Error = NewJSStreamDeleteError(err, Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	resp.Success = true
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
+
+// Request to store a batch of messages across streams, removing them again if one fails.
+// This is best effort and not atomic, see storeBatch.
+func (s *Server) jsStreamBatchRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiStreamBatchResponse{ApiResponse: ApiResponse{Type: JSApiStreamBatchResponseType}}
+
+	// Batches span multiple stream groups which we can not coordinate
+	// in clustered mode, so let the meta leader respond with an error.
+	if s.JetStreamIsClustered() {
+		if s.JetStreamIsLeader() {
+			resp.Error = NewJSClusterUnSupportFeatureError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	if isEmptyRequest(msg) {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	var req JSApiStreamBatchRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	resp.ID = req.ID
+	if req.ID == _EMPTY_ || len(req.Msgs) == 0 {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if resp.Acks, resp.Error = acc.storeBatch(req.ID, req.Msgs); resp.Error != nil {
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+}
+
+// Will check if we should handle a sharded stream request. In clustered mode the meta leader
+// handles these and sends regular API requests to each shard.
+// Returns an error if we should respond with one.
+func (s *Server) checkShardedRequest(acc *Account) (bool, *ApiError) {
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return false, nil
+		}
+		if js.isLeaderless() {
+			return false, NewJSClusterNotAvailError()
+		}
+		// Make sure we are meta leader.
+		if !s.JetStreamIsLeader() {
+			return false, nil
+		}
+	}
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			return false, NewJSNotEnabledForAccountError()
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// Request to create a sharded stream.
+func (s *Server) jsShardedStreamCreateRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiShardedStreamCreateResponse{ApiResponse: ApiResponse{Type: JSApiShardedStreamCreateResponseType}}
+
+	if ok, apiErr := s.checkShardedRequest(acc); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	if isEmptyRequest(msg) {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	var req JSApiShardedStreamCreateRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	streamName := tokenAt(subject, 6)
+	if req.Config.Name == _EMPTY_ {
+		req.Config.Name = streamName
+	}
+	if streamName != req.Config.Name {
+		resp.Error = NewJSStreamMismatchError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if req.Shards < 1 || req.Shards > JSMaxShards {
+		resp.Error = NewJSStreamInvalidConfigError(fmt.Errorf("stream shard count must be between 1 and %d", JSMaxShards))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if req.Config.Shard != nil || req.Config.Mirror != nil || len(req.Config.Sources) > 0 {
+		resp.Error = NewJSStreamInvalidConfigError(fmt.Errorf("sharded streams can not be mirrors or have sources"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if err := checkShardToken(req.Config.Subjects, req.Token); err != nil {
+		resp.Error = NewJSStreamInvalidConfigError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	// We wait on the shards so do this in a separate Go routine.
+	msg = copyBytes(msg)
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+		if resp.ShardedStreamInfo, resp.Error = s.jsShardedStreamCreate(acc, &req.Config, req.Shards, req.Token); resp.Error != nil {
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	})
+}
+
+// Request for information about a sharded stream.
+func (s *Server) jsShardedStreamInfoRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiShardedStreamInfoResponse{ApiResponse: ApiResponse{Type: JSApiShardedStreamInfoResponseType}}
+
+	if ok, apiErr := s.checkShardedRequest(acc); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	if !isEmptyRequest(msg) {
+		resp.Error = NewJSNotEmptyRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	streamName := tokenAt(subject, 6)
+	msg = copyBytes(msg)
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+		if resp.ShardedStreamInfo, resp.Error = s.jsShardedStreamInfo(acc, streamName); resp.Error != nil {
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	})
+}
+
+// Request to delete all shards of a sharded stream.
+func (s *Server) jsShardedStreamDeleteRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiStreamDeleteResponse{ApiResponse: ApiResponse{Type: JSApiStreamDeleteResponseType}}
+
+	if ok, apiErr := s.checkShardedRequest(acc); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	if !isEmptyRequest(msg) {
+		resp.Error = NewJSNotEmptyRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	streamName := tokenAt(subject, 6)
+	msg = copyBytes(msg)
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+		if resp.Error = s.jsShardedStreamDelete(acc, streamName); resp.Error != nil {
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		resp.Success = true
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	})
+}
+
+// Request to create a consumer on a sharded stream.
+// This will be created on the shard selected by the filter subject.
+func (s *Server) jsShardedConsumerCreateRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiConsumerCreateResponse{ApiResponse: ApiResponse{Type: JSApiConsumerCreateResponseType}}
+
+	if ok, apiErr := s.checkShardedRequest(acc); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	var req CreateConsumerRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	streamName := tokenAt(subject, 6)
+	if req.Stream != _EMPTY_ && req.Stream != streamName {
+		resp.Error = NewJSStreamMismatchError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	msg = copyBytes(msg)
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+		if resp.ConsumerInfo, resp.Error = s.jsShardedConsumerCreate(acc, streamName, &req); resp.Error != nil {
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	})
+}
+
+// Request to delete a message.
+// This expects a stream sequence number as the msg body.
+func (s *Server) jsMsgDeleteRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	stream := tokenAt(subject, 6)
+
+	var resp = JSApiMsgDeleteResponse{ApiResponse: ApiResponse{Type: JSApiMsgDeleteResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if s.JetStreamIsClustered() {
+		// Check to make sure the stream is assigned.
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		js.mu.RLock()
+		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+		js.mu.RUnlock()
+
+		if isLeader && sa == nil {
+			// We can't find the stream, so mimic what would be the errors below.
+			if hasJS, doErr := acc.checkJetStream(); !hasJS {
+				if doErr {
+					resp.Error = NewJSNotEnabledForAccountError()
+					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				}
+				return
+			}
+			// No stream present.
+			resp.Error = NewJSStreamNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		} else if sa == nil {
+			return
+		}
+
+		// Check to see if we are a member of the group and if the group has no leader.
+		if js.isGroupLeaderless(sa.Group) {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		// We have the stream assigned and a leader, so only the stream leader should answer.
+		if !acc.JetStreamIsStreamLeader(stream) {
+			return
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if isEmptyRequest(msg) {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	var req JSApiMsgDeleteRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if mset.cfg.Sealed {
+		resp.Error = NewJSStreamSealedError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if mset.cfg.DenyDelete {
+		resp.Error = NewJSStreamMsgDeleteFailedError(errors.New("message delete not permitted"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if s.JetStreamIsClustered() {
+		s.jsClusteredMsgDeleteRequest(ci, acc, mset, stream, subject, reply, &req, rmsg)
+		return
+	}
+
+	var removed bool
+	if req.NoErase {
+		removed, err = mset.removeMsg(req.Seq)
+	} else {
+		removed, err = mset.eraseMsg(req.Seq)
+	}
+	if err != nil {
+		resp.Error = NewJSStreamMsgDeleteFailedError(err, Unless(err))
+	} else if !removed {
+		resp.Error = NewJSSequenceNotFoundError(req.Seq)
+	} else {
+		resp.Success = true
+	}
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
+
+// Request to get a raw stream message.
+func (s *Server) jsMsgGetRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	stream := tokenAt(subject, 6)
+
+	var resp = JSApiMsgGetResponse{ApiResponse: ApiResponse{Type: JSApiMsgGetResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if s.JetStreamIsClustered() {
+		// Check to make sure the stream is assigned.
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		js.mu.RLock()
+		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+		js.mu.RUnlock()
+
+		if isLeader && sa == nil {
+			// We can't find the stream, so mimic what would be the errors below.
+			if hasJS, doErr := acc.checkJetStream(); !hasJS {
+				if doErr {
+					resp.Error = NewJSNotEnabledForAccountError()
+					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				}
+				return
+			}
+			// No stream present.
+			resp.Error = NewJSStreamNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		} else if sa == nil {
+			return
+		}
+
+		// Check to see if we are a member of the group and if the group has no leader.
+		if js.isGroupLeaderless(sa.Group) {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		// We have the stream assigned and a leader, so only the stream leader should answer.
+		if !acc.JetStreamIsStreamLeader(stream) {
+			return
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	if isEmptyRequest(msg) {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	var req JSApiMsgGetRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	// Check that we do not have both options set.
+	if req.Seq > 0 && req.LastFor != _EMPTY_ || req.Seq == 0 && req.LastFor == _EMPTY_ && req.NextFor == _EMPTY_ && req.StartTime == nil {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	// Check that both last and next not both set.
+	if req.LastFor != _EMPTY_ && req.NextFor != _EMPTY_ {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	// Start time can not be combined with a sequence or last by subject.
+	if req.StartTime != nil && (req.Seq > 0 || req.LastFor != _EMPTY_) {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	var svp StoreMsg
+	var sm *StoreMsg
+
+	if req.StartTime != nil {
+		sm, err = loadMsgFromTime(mset.store, *req.StartTime, req.NextFor, &svp)
+	} else if req.Seq > 0 && req.NextFor == _EMPTY_ {
+		sm, err = mset.store.LoadMsg(req.Seq, &svp)
+	} else if req.NextFor != _EMPTY_ {
+		sm, _, err = mset.store.LoadNextMsg(req.NextFor, subjectHasWildcard(req.NextFor), req.Seq, &svp)
+	} else {
+		sm, err = mset.store.LoadLastMsg(req.LastFor, &svp)
+	}
+	if err != nil {
+		resp.Error = NewJSNoMessageFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	hdr := sm.hdr
+	if !req.Origin {
+		hdr = removeOriginHeader(hdr)
+	}
+	resp.Message = &StoredMsg{
+		Subject:  sm.subj,
+		Sequence: sm.seq,
+		Header:   hdr,
+		Data:     sm.msg,
+		Time:     time.Unix(0, sm.ts).UTC(),
+	}
+
+	// Don't send response through API layer for this call.
+	s.sendInternalAccountMsg(nil, reply, s.jsonResponse(resp))
+}
+
+func (s *Server) jsMsgLookupRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	stream := tokenAt(subject, 6)
+
+	var resp = JSApiMsgLookupResponse{ApiResponse: ApiResponse{Type: JSApiMsgLookupResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if ok, apiErr := s.jsStreamLeaderCheck(acc, stream); !ok {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	if isEmptyRequest(msg) {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	var req JSApiMsgLookupRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if req.Value == _EMPTY_ || req.Limit < 0 {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	msgs, more, apiErr := mset.lookupByHeader(req.Value, req.Seq, req.Limit)
+	if apiErr == nil && len(msgs) == 0 {
+		apiErr = NewJSNoMessageFoundError()
+	}
+	if apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	resp.Messages, resp.More = msgs, more
+
+	// Don't send response through API layer for this call.
+	s.sendInternalAccountMsg(nil, reply, s.jsonResponse(resp))
+}
+
+// loadMsgFromTime will load the first message stored at or after the given time,
+// optionally filtered by subject.
+func loadMsgFromTime(store StreamStore, start time.Time, filter string, smp *StoreMsg) (*StoreMsg, error) {
+	if filter == _EMPTY_ {
+		filter = fwcs
+	}
+	seq := store.GetSeqFromTime(start)
+	sm, _, err := store.LoadNextMsg(filter, subjectHasWildcard(filter), seq, smp)
+	return sm, err
+}
+
+// Request to purge a stream.
+func (s *Server) jsStreamPurgeRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	stream := streamNameFromSubject(subject)
+
+	var resp = JSApiStreamPurgeResponse{ApiResponse: ApiResponse{Type: JSApiStreamPurgeResponseType}}
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if s.JetStreamIsClustered() {
+		// Check to make sure the stream is assigned.
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+
+		js.mu.RLock()
+		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+		js.mu.RUnlock()
+
+		if isLeader && sa == nil {
+			// We can't find the stream, so mimic what would be the errors below.
+			if hasJS, doErr := acc.checkJetStream(); !hasJS {
+				if doErr {
+					resp.Error = NewJSNotEnabledForAccountError()
+					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				}
+				return
+			}
+			// No stream present.
+			resp.Error = NewJSStreamNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		} else if sa == nil {
+			if js.isLeaderless() {
+				resp.Error = NewJSClusterNotAvailError()
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			}
+			return
+		}
+
+		// Check to see if we are a member of the group and if the group has no leader.
+		if js.isGroupLeaderless(sa.Group) {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		// We have the stream assigned and a leader, so only the stream leader should answer.
+		if !acc.JetStreamIsStreamLeader(stream) {
+			if js.isLeaderless() {
+				resp.Error = NewJSClusterNotAvailError()
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			}
+			return
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	var purgeRequest *JSApiStreamPurgeRequest
+	if !isEmptyRequest(msg) {
+		var req JSApiStreamPurgeRequest
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		if req.Sequence > 0 && req.Keep > 0 {
+			resp.Error = NewJSBadRequestError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		purgeRequest = &req
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if mset.cfg.Sealed {
+		resp.Error = NewJSStreamSealedError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if mset.cfg.DenyPurge {
+		resp.Error = NewJSStreamPurgeFailedError(errors.New("stream purge not permitted"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if s.JetStreamIsClustered() {
+		s.jsClusteredStreamPurgeRequest(ci, acc, mset, stream, subject, reply, rmsg, purgeRequest)
+		return
+	}
+
+	purged, err := mset.purge(purgeRequest)
+	if err != nil {
+		resp.Error = NewJSStreamGeneralError(err, Unless(err))
+	} else {
+		resp.Purged = purged
+		resp.Success = true
+	}
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
+
+func (acc *Account) jsNonClusteredStreamLimitsCheck(cfg *StreamConfig) *ApiError {
+	selectedLimits, tier, jsa, apiErr := acc.selectLimits(cfg)
+	if apiErr != nil {
+		return apiErr
+	}
+	jsa.mu.RLock()
+	defer jsa.mu.RUnlock()
+	if selectedLimits.MaxStreams > 0 && jsa.countStreams(tier, cfg) >= selectedLimits.MaxStreams {
+		return NewJSMaximumStreamsLimitError()
+	}
+	reserved := jsa.tieredReservation(tier, cfg)
+	if err := jsa.js.checkAllLimits(selectedLimits, cfg, reserved, 0); err != nil {
+		return NewJSStreamLimitsError(err, Unless(err))
+	}
+	reserved = jsa.tieredReservation(tier, memoryHeadConfig(cfg))
+	if err := jsa.js.checkMemoryHeadLimits(selectedLimits, cfg, nil, true, reserved); err != nil {
+		return NewJSStreamLimitsError(err, Unless(err))
+	}
+	return nil
+}
+
+// Request to restore a stream.
+func (s *Server) jsStreamRestoreRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamIsLeader() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiStreamRestoreResponse{ApiResponse: ApiResponse{Type: JSApiStreamRestoreResponseType}}
+	if !acc.JetStreamEnabled() {
+		resp.Error = NewJSNotEnabledForAccountError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if isEmptyRequest(msg) {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	var req JSApiStreamRestoreRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	stream := streamNameFromSubject(subject)
+
+	if stream != req.Config.Name && req.Config.Name == _EMPTY_ {
+		req.Config.Name = stream
+	}
+
+	// check stream config at the start of the restore process, not at the end
+	cfg, apiErr := s.checkStreamCfg(&req.Config, acc)
+	if apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if s.JetStreamIsClustered() {
+		s.jsClusteredStreamRestoreRequest(ci, acc, &req, stream, subject, reply, rmsg)
+		return
+	}
+
+	if err := acc.jsNonClusteredStreamLimitsCheck(&cfg); err != nil {
+		resp.Error = err
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if _, err := acc.lookupStream(stream); err == nil {
+		resp.Error = NewJSStreamNameExistRestoreFailedError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	s.processStreamRestore(ci, acc, &req.Config, subject, reply, string(msg))
+}
+
+func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamConfig, subject, reply, msg string) <-chan error {
+	js := s.getJetStream()
+
+	var resp = JSApiStreamRestoreResponse{ApiResponse: ApiResponse{Type: JSApiStreamRestoreResponseType}}
+
+	snapDir := filepath.Join(js.config.StoreDir, snapStagingDir)
+	if _, err := os.Stat(snapDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(snapDir, defaultDirPerms); err != nil {
+			resp.Error = &ApiError{Code: 503, Description: "JetStream unable to create temp storage for restore"}
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return nil
+		}
+	}
+
+	tfile, err := os.CreateTemp(snapDir, "js-restore-")
+	if err != nil {
+		resp.Error = NewJSTempStorageFailedError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, msg, s.jsonResponse(&resp))
+		return nil
+	}
+
+	streamName := cfg.Name
+	s.Noticef("Starting restore for stream '%s > %s'", acc.Name, streamName)
+
+	start := time.Now().UTC()
+	domain := s.getOpts().JetStreamDomain
+	s.publishAdvisory(acc, JSAdvisoryStreamRestoreCreatePre+"."+streamName, &JSRestoreCreateAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSRestoreCreateAdvisoryType,
+			ID:   nuid.Next(),
+			Time: start,
+		},
+		Stream: streamName,
+		Client: ci,
+		Domain: domain,
+	})
+
+	// Create our internal subscription to accept the snapshot.
+	restoreSubj := fmt.Sprintf(jsRestoreDeliverT, streamName, nuid.Next())
+
+	type result struct {
+		err   error
+		reply string
+	}
+
+	// For signaling to upper layers.
+	resultCh := make(chan result, 1)
+	activeQ := newIPQueue[int](s, fmt.Sprintf("[ACC:%s] stream '%s' restore", acc.Name, streamName)) // of int
+
+	var total int
+
+	// FIXM(dlc) - Probably take out of network path eventually due to disk I/O?
+	processChunk := func(sub *subscription, c *client, _ *Account, subject, reply string, msg []byte) {
+		// We require reply subjects to communicate back failures, flow etc. If they do not have one log and cancel.
+		if reply == _EMPTY_ {
+			sub.client.processUnsub(sub.sid)
+			resultCh <- result{
+				fmt.Errorf("restore for stream '%s > %s' requires reply subject for each chunk", acc.Name, streamName),
+				reply,
+			}
+			return
+		}
+		// Account client messages have \r\n on end. This is an error.
+		if len(msg) < LEN_CR_LF {
+			sub.client.processUnsub(sub.sid)
+			resultCh <- result{
+				fmt.Errorf("restore for stream '%s > %s' received short chunk", acc.Name, streamName),
+				reply,
+			}
+			return
+		}
+		// Adjust.
+		msg = msg[:len(msg)-LEN_CR_LF]
+
+		// This means we are complete with our transfer from the client.
+		if len(msg) == 0 {
+			s.Debugf("Finished staging restore for stream '%s > %s'", acc.Name, streamName)
+			resultCh <- result{err, reply}
+			return
+		}
+
+		// We track total and check on server limits.
+		// TODO(dlc) - We could check apriori and cancel initial request if we know it won't fit.
+		total += len(msg)
+		if js.wouldExceedLimits(FileStorage, total) {
+			s.resourcesExeededError()
+			resultCh <- result{NewJSInsufficientResourcesError(), reply}
+			return
+		}
+
+		// Append chunk to temp file. Mark as issue if we encounter an error.
+		if n, err := tfile.Write(msg); n != len(msg) || err != nil {
+			resultCh <- result{err, reply}
+			if reply != _EMPTY_ {
+				s.sendInternalAccountMsg(acc, reply, "-ERR 'storage failure during restore'")
+			}
+			return
+		}
+
+		activeQ.push(len(msg))
+
+		s.sendInternalAccountMsg(acc, reply, nil)
+	}
+
+	sub, err := acc.subscribeInternal(restoreSubj, processChunk)
+	if err != nil {
+		tfile.Close()
+		os.Remove(tfile.Name())
+		resp.Error = NewJSRestoreSubscribeFailedError(err, restoreSubj)
+		s.sendAPIErrResponse(ci, acc, subject, reply, msg, s.jsonResponse(&resp))
+		return nil
+	}
+
+	// Mark the subject so the end user knows where to send the snapshot chunks.
+	resp.DeliverSubject = restoreSubj
+	s.sendAPIResponse(ci, acc, subject, reply, msg, s.jsonResponse(resp))
+
+	doneCh := make(chan error, 1)
+
+	// Monitor the progress from another Go routine.
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+		defer func() {
+			tfile.Close()
+			os.Remove(tfile.Name())
+			sub.client.processUnsub(sub.sid)
+			activeQ.unregister()
+		}()
+
+		const activityInterval = 5 * time.Second
+		notActive := time.NewTimer(activityInterval)
+		defer notActive.Stop()
+
+		total := 0
+		for {
+			select {
+			case result := <-resultCh:
+				err := result.err
+				var mset *stream
+
+				// If we staged properly go ahead and do restore now.
+				if err == nil {
+					s.Debugf("Finalizing restore for stream '%s > %s'", acc.Name, streamName)
+					tfile.Seek(0, 0)
+					mset, err = acc.RestoreStream(cfg, tfile)
+				} else {
+					errStr := err.Error()
+					tmp := []rune(errStr)
+					tmp[0] = unicode.ToUpper(tmp[0])
+					s.Warnf(errStr)
+				}
+
+				end := time.Now().UTC()
+
+				// TODO(rip) - Should this have the error code in it??
+				s.publishAdvisory(acc, JSAdvisoryStreamRestoreCompletePre+"."+streamName, &JSRestoreCompleteAdvisory{
+					TypedEvent: TypedEvent{
+						Type: JSRestoreCompleteAdvisoryType,
+						ID:   nuid.Next(),
+						Time: end,
+					},
+					Stream: streamName,
+					Start:  start,
+					End:    end,
+					Bytes:  int64(total),
+					Client: ci,
+					Domain: domain,
+				})
+
+				var resp = JSApiStreamCreateResponse{ApiResponse: ApiResponse{Type: JSApiStreamCreateResponseType}}
+
+				if err != nil {
+					resp.Error = NewJSStreamRestoreError(err, Unless(err))
+					s.Warnf("Restore failed for %s for stream '%s > %s' in %v",
+						friendlyBytes(int64(total)), streamName, acc.Name, end.Sub(start))
+				} else {
+					resp.StreamInfo = &StreamInfo{Created: mset.createdTime(), State: mset.state(), Config: mset.config()}
+					s.Noticef("Completed restore of %s for stream '%s > %s' in %v",
+						friendlyBytes(int64(total)), streamName, acc.Name, end.Sub(start))
+				}
+
+				// On the last EOF, send back the stream info or error status.
+				s.sendInternalAccountMsg(acc, result.reply, s.jsonResponse(&resp))
+				// Signal to the upper layers.
+				doneCh <- err
+				return
+			case <-activeQ.ch:
+				if n, ok := activeQ.popOne(); ok {
+					total += n
+					notActive.Reset(activityInterval)
+				}
 			case <-notActive.C:
 				err := fmt.Errorf("restore for stream '%s > %s' is stalled", acc, streamName)
 				doneCh <- err
@@ -3454,11 +5227,435 @@ func (s *Server) processStreamRestore(ci *ClientInfo, acc *Account, cfg *StreamC
 		}
 	})
 
-	return doneCh
+	return doneCh
+}
+
+// Process a snapshot request.
+func (s *Server) jsStreamSnapshotRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	smsg := string(msg)
+	stream := streamNameFromSubject(subject)
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if s.JetStreamIsClustered() && !acc.JetStreamIsStreamLeader(stream) {
+		return
+	}
+
+	var resp = JSApiStreamSnapshotResponse{ApiResponse: ApiResponse{Type: JSApiStreamSnapshotResponseType}}
+	if !acc.JetStreamEnabled() {
+		resp.Error = NewJSNotEnabledForAccountError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
+		return
+	}
+	if isEmptyRequest(msg) {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
+		return
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
+		return
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	var req JSApiStreamSnapshotRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
+		return
+	}
+	if !IsValidSubject(req.DeliverSubject) {
+		resp.Error = NewJSSnapshotDeliverSubjectInvalidError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
+		return
+	}
+
+	// We will do the snapshot in a go routine as well since check msgs may
+	// stall this go routine.
+	go func() {
+		if req.CheckMsgs {
+			s.Noticef("Starting health check and snapshot for stream '%s > %s'", mset.jsa.account.Name, mset.name())
+		} else {
+			s.Noticef("Starting snapshot for stream '%s > %s'", mset.jsa.account.Name, mset.name())
+		}
+
+		start := time.Now().UTC()
+
+		sr, err := mset.snapshot(0, req.CheckMsgs, !req.NoConsumers)
+		if err != nil {
+			s.Warnf("Snapshot of stream '%s > %s' failed: %v", mset.jsa.account.Name, mset.name(), err)
+			resp.Error = NewJSStreamSnapshotError(err, Unless(err))
+			s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
+			return
+		}
+
+		config := mset.config()
+		resp.State = &sr.State
+		resp.Config = &config
+
+		s.sendAPIResponse(ci, acc, subject, reply, smsg, s.jsonResponse(resp))
+
+		s.publishAdvisory(acc, JSAdvisoryStreamSnapshotCreatePre+"."+mset.name(), &JSSnapshotCreateAdvisory{
+			TypedEvent: TypedEvent{
+				Type: JSSnapshotCreatedAdvisoryType,
+				ID:   nuid.Next(),
+				Time: time.Now().UTC(),
+			},
+			Stream: mset.name(),
+			State:  sr.State,
+			Client: ci,
+			Domain: s.getOpts().JetStreamDomain,
+		})
+
+		// Now do the real streaming.
+		s.streamSnapshot(ci, acc, mset, sr, &req)
+
+		end := time.Now().UTC()
+
+		s.publishAdvisory(acc, JSAdvisoryStreamSnapshotCompletePre+"."+mset.name(), &JSSnapshotCompleteAdvisory{
+			TypedEvent: TypedEvent{
+				Type: JSSnapshotCompleteAdvisoryType,
+				ID:   nuid.Next(),
+				Time: end,
+			},
+			Stream: mset.name(),
+			Start:  start,
+			End:    end,
+			Client: ci,
+			Domain: s.getOpts().JetStreamDomain,
+		})
+
+		s.Noticef("Completed snapshot of %s for stream '%s > %s' in %v",
+			friendlyBytes(int64(sr.State.Bytes)),
+			mset.jsa.account.Name,
+			mset.name(),
+			end.Sub(start))
+	}()
+}
+
+// Default chunk size for now.
+const defaultSnapshotChunkSize = 128 * 1024
+const defaultSnapshotWindowSize = 8 * 1024 * 1024 // 8MB
+
+// streamSnapshot will stream out our snapshot to the reply subject.
+func (s *Server) streamSnapshot(ci *ClientInfo, acc *Account, mset *stream, sr *SnapshotResult, req *JSApiStreamSnapshotRequest) {
+	chunkSize := req.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = defaultSnapshotChunkSize
+	}
+	// Setup for the chunk stream.
+	reply := req.DeliverSubject
+	r := sr.Reader
+	defer r.Close()
+
+	// Check interest for the snapshot deliver subject.
+	inch := make(chan bool, 1)
+	acc.sl.RegisterNotification(req.DeliverSubject, inch)
+	defer acc.sl.ClearNotification(req.DeliverSubject, inch)
+	hasInterest := <-inch
+	if !hasInterest {
+		// Allow 2 seconds or so for interest to show up.
+		select {
+		case <-inch:
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	// Create our ack flow handler.
+	// This is very simple for now.
+	acks := make(chan struct{}, 1)
+	acks <- struct{}{}
+
+	// Track bytes outstanding.
+	var out int32
+
+	// We will place sequence number and size of chunk sent in the reply.
+	ackSubj := fmt.Sprintf(jsSnapshotAckT, mset.name(), nuid.Next())
+	ackSub, _ := mset.subscribeInternalUnlocked(ackSubj+".>", func(_ *subscription, _ *client, _ *Account, subject, _ string, _ []byte) {
+		cs, _ := strconv.Atoi(tokenAt(subject, 6))
+		// This is very crude and simple, but ok for now.
+		// This only matters when sending multiple chunks.
+		if atomic.AddInt32(&out, int32(-cs)) < defaultSnapshotWindowSize {
+			select {
+			case acks <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer mset.unsubscribeUnlocked(ackSub)
+
+	// TODO(dlc) - Add in NATS-Chunked-Sequence header
+
+	for index := 1; ; index++ {
+		chunk := make([]byte, chunkSize)
+		n, err := r.Read(chunk)
+		chunk = chunk[:n]
+		if err != nil {
+			if n > 0 {
+				mset.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, chunk, nil, 0))
+			}
+			break
+		}
+
+		// Wait on acks for flow control if past our window size.
+		// Wait up to 10ms for now if no acks received.
+		if atomic.LoadInt32(&out) > defaultSnapshotWindowSize {
+			select {
+			case <-acks:
+			case <-inch: // Lost interest
+				goto done
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		ackReply := fmt.Sprintf("%s.%d.%d", ackSubj, len(chunk), index)
+		mset.outq.send(newJSPubMsg(reply, _EMPTY_, ackReply, nil, chunk, nil, 0))
+		atomic.AddInt32(&out, int32(len(chunk)))
+	}
+done:
+	// Send last EOF
+	// TODO(dlc) - place hash in header
+	mset.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, nil, nil, 0))
+}
+
+// For determining consumer request type.
+type ccReqType uint8
+
+const (
+	ccNew = iota
+	ccLegacyEphemeral
+	ccLegacyDurable
+)
+
+// Request to create a consumer where stream and optional consumer name are part of the subject, and optional
+// filtered subjects can be at the tail end.
+// Assumes stream and consumer names are single tokens.
+func (s *Server) jsConsumerCreateRequest(sub *subscription, c *client, a *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiConsumerCreateResponse{ApiResponse: ApiResponse{Type: JSApiConsumerCreateResponseType}}
+
+	var req CreateConsumerRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	var js *jetStream
+	isClustered := s.JetStreamIsClustered()
+
+	// Determine if we should proceed here when we are in clustered mode.
+	if isClustered {
+		if req.Config.Direct {
+			// Check to see if we have this stream and are the stream leader.
+			if !acc.JetStreamIsStreamLeader(streamNameFromSubject(subject)) {
+				return
+			}
+		} else {
+			var cc *jetStreamCluster
+			js, cc = s.getJetStreamCluster()
+			if js == nil || cc == nil {
+				return
+			}
+			if js.isLeaderless() {
+				resp.Error = NewJSClusterNotAvailError()
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				return
+			}
+			// Make sure we are meta leader.
+			if !s.JetStreamIsLeader() {
+				return
+			}
+		}
+	}
+
+	var streamName, consumerName, filteredSubject string
+	var rt ccReqType
+
+	if n := numTokens(subject); n < 5 {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	} else if n == 5 {
+		// Legacy ephemeral.
+		rt = ccLegacyEphemeral
+		streamName = streamNameFromSubject(subject)
+	} else {
+		// New style and durable legacy.
+		if tokenAt(subject, 4) == "DURABLE" {
+			rt = ccLegacyDurable
+			if n != 7 {
+				resp.Error = NewJSConsumerDurableNameNotInSubjectError()
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				return
+			}
+			streamName = tokenAt(subject, 6)
+			consumerName = tokenAt(subject, 7)
+		} else {
+			streamName = streamNameFromSubject(subject)
+			consumerName = consumerNameFromSubject(subject)
+		}
+		// New has optional filtered subject as part of main subject..
+		if n > 7 {
+			tokens := strings.Split(subject, tsep)
+			filteredSubject = strings.Join(tokens[6:], tsep)
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if streamName != req.Stream {
+		resp.Error = NewJSStreamMismatchError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if consumerName != _EMPTY_ {
+		// Check for path like separators in the name.
+		if strings.ContainsAny(consumerName, `\/`) {
+			resp.Error = NewJSConsumerNameContainsPathSeparatorsError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
+	// Should we expect a durable name
+	if rt == ccLegacyDurable {
+		if numTokens(subject) < 7 {
+			resp.Error = NewJSConsumerDurableNameNotInSubjectError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		// Now check on requirements for durable request.
+		if req.Config.Durable == _EMPTY_ {
+			resp.Error = NewJSConsumerDurableNameNotSetError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		if consumerName != req.Config.Durable {
+			resp.Error = NewJSConsumerDurableNameNotMatchSubjectError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+	// If new style and durable set make sure they match.
+	if rt == ccNew {
+		if req.Config.Durable != _EMPTY_ {
+			if consumerName != req.Config.Durable {
+				resp.Error = NewJSConsumerDurableNameNotMatchSubjectError()
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				return
+			}
+		}
+		// New style ephemeral so we need to honor the name.
+		req.Config.Name = consumerName
+	}
+	// Check for legacy ephemeral mis-configuration.
+	if rt == ccLegacyEphemeral && req.Config.Durable != _EMPTY_ {
+		resp.Error = NewJSConsumerEphemeralWithDurableNameError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	// Check for a filter subject.
+	if filteredSubject != _EMPTY_ && req.Config.FilterSubject != filteredSubject {
+		resp.Error = NewJSConsumerCreateFilterSubjectMismatchError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if isClustered && !req.Config.Direct {
+		// If we are inline with client, we still may need to do a callout for consumer info
+		// during this call, so place in Go routine to not block client.
+		// Router and Gateway API calls already in separate context.
+		if c.kind != ROUTER && c.kind != GATEWAY {
+			go s.jsClusteredConsumerRequest(ci, acc, subject, reply, rmsg, req.Stream, &req.Config, req.Bind)
+		} else {
+			s.jsClusteredConsumerRequest(ci, acc, subject, reply, rmsg, req.Stream, &req.Config, req.Bind)
+		}
+		return
+	}
+
+	// If we are here we are single server mode.
+	if req.Config.Replicas > 1 {
+		resp.Error = NewJSStreamReplicasNotSupportedError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	stream, err := acc.lookupStream(req.Stream)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if req.Bind {
+		if apiErr := stream.checkConsumerBind(&req.Config); apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
+	o, err := stream.addConsumer(&req.Config)
+
+	if err != nil {
+		if IsNatsErr(err, JSConsumerStoreFailedErrF) {
+			cname := req.Config.Durable // Will be empty if ephemeral.
+			s.Warnf("Consumer create failed for '%s > %s > %s': %v", acc, req.Stream, cname, err)
+			err = errConsumerStoreFailed
+		}
+		resp.Error = NewJSConsumerCreateError(err, Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	resp.ConsumerInfo = o.initialInfo()
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// Process a snapshot request.
-func (s *Server) jsStreamSnapshotRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+// Request to reattach to an existing consumer. The names of ephemeral consumers are part of the reply
+// subjects of their deliveries, so a client that was disconnected can resume where it left off, as
+// long as the consumer was not removed for being inactive. This is an update of the consumer that
+// only changes the deliver subject, so is processed by the meta leader when clustered.
+func (s *Server) jsConsumerReattachRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
@@ -3468,289 +5665,157 @@ func (s *Server) jsStreamSnapshotRequest(sub *subscription, c *client, _ *Accoun
 		return
 	}
 
-	smsg := string(msg)
-	stream := streamNameFromSubject(subject)
-
-	// If we are in clustered mode we need to be the stream leader to proceed.
-	if s.JetStreamIsClustered() && !acc.JetStreamIsStreamLeader(stream) {
-		return
-	}
+	var resp = JSApiConsumerCreateResponse{ApiResponse: ApiResponse{Type: JSApiConsumerCreateResponseType}}
 
-	var resp = JSApiStreamSnapshotResponse{ApiResponse: ApiResponse{Type: JSApiStreamSnapshotResponseType}}
-	if !acc.JetStreamEnabled() {
-		resp.Error = NewJSNotEnabledForAccountError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
-		return
-	}
-	if isEmptyRequest(msg) {
-		resp.Error = NewJSBadRequestError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
-		return
-	}
+	var js *jetStream
+	isClustered := s.JetStreamIsClustered()
 
-	mset, err := acc.lookupStream(stream)
-	if err != nil {
-		resp.Error = NewJSStreamNotFoundError(Unless(err))
-		s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
-		return
+	// Determine if we should proceed here when we are in clustered mode.
+	if isClustered {
+		var cc *jetStreamCluster
+		js, cc = s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
+		}
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		// Make sure we are meta leader.
+		if !s.JetStreamIsLeader() {
+			return
+		}
 	}
 
 	if hasJS, doErr := acc.checkJetStream(); !hasJS {
 		if doErr {
 			resp.Error = NewJSNotEnabledForAccountError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		}
 		return
 	}
-
-	var req JSApiStreamSnapshotRequest
-	if err := json.Unmarshal(msg, &req); err != nil {
-		resp.Error = NewJSInvalidJSONError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
-		return
-	}
-	if !IsValidSubject(req.DeliverSubject) {
-		resp.Error = NewJSSnapshotDeliverSubjectInvalidError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	// We will do the snapshot in a go routine as well since check msgs may
-	// stall this go routine.
-	go func() {
-		if req.CheckMsgs {
-			s.Noticef("Starting health check and snapshot for stream '%s > %s'", mset.jsa.account.Name, mset.name())
-		} else {
-			s.Noticef("Starting snapshot for stream '%s > %s'", mset.jsa.account.Name, mset.name())
+	var req JSApiConsumerReattachRequest
+	if !isEmptyRequest(msg) {
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
 		}
+	}
 
-		start := time.Now().UTC()
+	streamName, consumerName := streamNameFromSubject(subject), consumerNameFromSubject(subject)
 
-		sr, err := mset.snapshot(0, req.CheckMsgs, !req.NoConsumers)
-		if err != nil {
-			s.Warnf("Snapshot of stream '%s > %s' failed: %v", mset.jsa.account.Name, mset.name(), err)
-			resp.Error = NewJSStreamSnapshotError(err, Unless(err))
-			s.sendAPIErrResponse(ci, acc, subject, reply, smsg, s.jsonResponse(&resp))
+	// Grab the current config.
+	var cfg ConsumerConfig
+	var mset *stream
+	if isClustered {
+		js.mu.RLock()
+		sa := js.streamAssignment(acc.Name, streamName)
+		var ca *consumerAssignment
+		if sa != nil {
+			if ca = sa.consumers[consumerName]; ca != nil && !ca.deleted {
+				cfg = *ca.Config
+			}
+		}
+		js.mu.RUnlock()
+		if sa == nil {
+			resp.Error = NewJSStreamNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 			return
 		}
-
-		config := mset.config()
-		resp.State = &sr.State
-		resp.Config = &config
-
-		s.sendAPIResponse(ci, acc, subject, reply, smsg, s.jsonResponse(resp))
-
-		s.publishAdvisory(acc, JSAdvisoryStreamSnapshotCreatePre+"."+mset.name(), &JSSnapshotCreateAdvisory{
-			TypedEvent: TypedEvent{
-				Type: JSSnapshotCreatedAdvisoryType,
-				ID:   nuid.Next(),
-				Time: time.Now().UTC(),
-			},
-			Stream: mset.name(),
-			State:  sr.State,
-			Client: ci,
-			Domain: s.getOpts().JetStreamDomain,
-		})
-
-		// Now do the real streaming.
-		s.streamSnapshot(ci, acc, mset, sr, &req)
-
-		end := time.Now().UTC()
-
-		s.publishAdvisory(acc, JSAdvisoryStreamSnapshotCompletePre+"."+mset.name(), &JSSnapshotCompleteAdvisory{
-			TypedEvent: TypedEvent{
-				Type: JSSnapshotCompleteAdvisoryType,
-				ID:   nuid.Next(),
-				Time: end,
-			},
-			Stream: mset.name(),
-			Start:  start,
-			End:    end,
-			Client: ci,
-			Domain: s.getOpts().JetStreamDomain,
-		})
-
-		s.Noticef("Completed snapshot of %s for stream '%s > %s' in %v",
-			friendlyBytes(int64(sr.State.Bytes)),
-			mset.jsa.account.Name,
-			mset.name(),
-			end.Sub(start))
-	}()
-}
-
-// Default chunk size for now.
-const defaultSnapshotChunkSize = 128 * 1024
-const defaultSnapshotWindowSize = 8 * 1024 * 1024 // 8MB
-
-// streamSnapshot will stream out our snapshot to the reply subject.
-func (s *Server) streamSnapshot(ci *ClientInfo, acc *Account, mset *stream, sr *SnapshotResult, req *JSApiStreamSnapshotRequest) {
-	chunkSize := req.ChunkSize
-	if chunkSize == 0 {
-		chunkSize = defaultSnapshotChunkSize
-	}
-	// Setup for the chunk stream.
-	reply := req.DeliverSubject
-	r := sr.Reader
-	defer r.Close()
-
-	// Check interest for the snapshot deliver subject.
-	inch := make(chan bool, 1)
-	acc.sl.RegisterNotification(req.DeliverSubject, inch)
-	defer acc.sl.ClearNotification(req.DeliverSubject, inch)
-	hasInterest := <-inch
-	if !hasInterest {
-		// Allow 2 seconds or so for interest to show up.
-		select {
-		case <-inch:
-		case <-time.After(2 * time.Second):
+		if ca == nil || ca.deleted {
+			resp.Error = NewJSConsumerNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
 		}
+	} else {
+		if mset, err = acc.lookupStream(streamName); err != nil {
+			resp.Error = NewJSStreamNotFoundError(Unless(err))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		o := mset.lookupConsumer(consumerName)
+		if o == nil {
+			resp.Error = NewJSConsumerNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		cfg = o.config()
 	}
 
-	// Create our ack flow handler.
-	// This is very simple for now.
-	acks := make(chan struct{}, 1)
-	acks <- struct{}{}
-
-	// Track bytes outstanding.
-	var out int32
-
-	// We will place sequence number and size of chunk sent in the reply.
-	ackSubj := fmt.Sprintf(jsSnapshotAckT, mset.name(), nuid.Next())
-	ackSub, _ := mset.subscribeInternalUnlocked(ackSubj+".>", func(_ *subscription, _ *client, _ *Account, subject, _ string, _ []byte) {
-		cs, _ := strconv.Atoi(tokenAt(subject, 6))
-		// This is very crude and simple, but ok for now.
-		// This only matters when sending multiple chunks.
-		if atomic.AddInt32(&out, int32(-cs)) < defaultSnapshotWindowSize {
-			select {
-			case acks <- struct{}{}:
-			default:
-			}
+	// Pull consumers keep their config, push consumers switch to the new deliver subject.
+	// Pending messages will be redelivered there.
+	if cfg.DeliverSubject != req.DeliverSubject {
+		if cfg.DeliverSubject == _EMPTY_ || req.DeliverSubject == _EMPTY_ {
+			resp.Error = NewJSConsumerCreateError(errors.New("deliver subject is required to reattach to push consumers only"))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
 		}
-	})
-	defer mset.unsubscribeUnlocked(ackSub)
-
-	// TODO(dlc) - Add in NATS-Chunked-Sequence header
+		cfg.DeliverSubject = req.DeliverSubject
+	}
+	if !isDurableConsumer(&cfg) {
+		cfg.Name = consumerName
+	}
 
-	for index := 1; ; index++ {
-		chunk := make([]byte, chunkSize)
-		n, err := r.Read(chunk)
-		chunk = chunk[:n]
-		if err != nil {
-			if n > 0 {
-				mset.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, chunk, nil, 0))
-			}
-			break
+	if isClustered {
+		// Same as for creates, do not block the client inline.
+		if c.kind != ROUTER && c.kind != GATEWAY {
+			go s.jsClusteredConsumerRequest(ci, acc, subject, reply, rmsg, streamName, &cfg, false)
+		} else {
+			s.jsClusteredConsumerRequest(ci, acc, subject, reply, rmsg, streamName, &cfg, false)
 		}
+		return
+	}
 
-		// Wait on acks for flow control if past our window size.
-		// Wait up to 10ms for now if no acks received.
-		if atomic.LoadInt32(&out) > defaultSnapshotWindowSize {
-			select {
-			case <-acks:
-			case <-inch: // Lost interest
-				goto done
-			case <-time.After(10 * time.Millisecond):
-			}
-		}
-		ackReply := fmt.Sprintf("%s.%d.%d", ackSubj, len(chunk), index)
-		mset.outq.send(newJSPubMsg(reply, _EMPTY_, ackReply, nil, chunk, nil, 0))
-		atomic.AddInt32(&out, int32(len(chunk)))
+	o, err := mset.addConsumer(&cfg)
+	if err != nil {
+		resp.Error = NewJSConsumerCreateError(err, Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
 	}
-done:
-	// Send last EOF
-	// TODO(dlc) - place hash in header
-	mset.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, nil, nil, 0))
+	resp.ConsumerInfo = o.initialInfo()
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
-// For determining consumer request type.
-type ccReqType uint8
-
-const (
-	ccNew = iota
-	ccLegacyEphemeral
-	ccLegacyDurable
-)
-
-// Request to create a consumer where stream and optional consumer name are part of the subject, and optional
-// filtered subjects can be at the tail end.
-// Assumes stream and consumer names are single tokens.
-func (s *Server) jsConsumerCreateRequest(sub *subscription, c *client, a *Account, subject, reply string, rmsg []byte) {
+// Request to create a consumer from a consumer template of the stream. Processed as a create of the
+// resulting config, so by the meta leader when clustered.
+func (s *Server) jsConsumerTemplateCreateRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
 		return
 	}
-
 	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
 	if err != nil {
 		s.Warnf(badAPIRequestT, msg)
 		return
 	}
 
-	var resp = JSApiConsumerCreateResponse{ApiResponse: ApiResponse{Type: JSApiConsumerCreateResponseType}}
-
-	var req CreateConsumerRequest
-	if err := json.Unmarshal(msg, &req); err != nil {
-		resp.Error = NewJSInvalidJSONError()
-		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-		return
-	}
-
+	var resp = JSApiConsumerCreateResponse{ApiResponse: ApiResponse{Type: JSApiConsumerCreateResponseType}}
+
 	var js *jetStream
 	isClustered := s.JetStreamIsClustered()
 
 	// Determine if we should proceed here when we are in clustered mode.
 	if isClustered {
-		if req.Config.Direct {
-			// Check to see if we have this stream and are the stream leader.
-			if !acc.JetStreamIsStreamLeader(streamNameFromSubject(subject)) {
-				return
-			}
-		} else {
-			var cc *jetStreamCluster
-			js, cc = s.getJetStreamCluster()
-			if js == nil || cc == nil {
-				return
-			}
-			if js.isLeaderless() {
-				resp.Error = NewJSClusterNotAvailError()
-				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-				return
-			}
-			// Make sure we are meta leader.
-			if !s.JetStreamIsLeader() {
-				return
-			}
+		var cc *jetStreamCluster
+		js, cc = s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
 		}
-	}
-
-	var streamName, consumerName, filteredSubject string
-	var rt ccReqType
-
-	if n := numTokens(subject); n < 5 {
-		s.Warnf(badAPIRequestT, msg)
-		return
-	} else if n == 5 {
-		// Legacy ephemeral.
-		rt = ccLegacyEphemeral
-		streamName = streamNameFromSubject(subject)
-	} else {
-		// New style and durable legacy.
-		if tokenAt(subject, 4) == "DURABLE" {
-			rt = ccLegacyDurable
-			if n != 7 {
-				resp.Error = NewJSConsumerDurableNameNotInSubjectError()
-				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-				return
-			}
-			streamName = tokenAt(subject, 6)
-			consumerName = tokenAt(subject, 7)
-		} else {
-			streamName = streamNameFromSubject(subject)
-			consumerName = consumerNameFromSubject(subject)
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
 		}
-		// New has optional filtered subject as part of main subject..
-		if n > 7 {
-			tokens := strings.Split(subject, tsep)
-			filteredSubject = strings.Join(tokens[6:], tsep)
+		// Make sure we are meta leader.
+		if !s.JetStreamIsLeader() {
+			return
 		}
 	}
 
@@ -3761,106 +5826,195 @@ func (s *Server) jsConsumerCreateRequest(sub *subscription, c *client, a *Accoun
 		}
 		return
 	}
-
-	if streamName != req.Stream {
-		resp.Error = NewJSStreamMismatchError()
+	if acc.jetStreamReadOnly() {
+		resp.Error = NewJSAccountReadOnlyError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	if consumerName != _EMPTY_ {
-		// Check for path like separators in the name.
-		if strings.ContainsAny(consumerName, `\/`) {
-			resp.Error = NewJSConsumerNameContainsPathSeparatorsError()
+	var req JSApiConsumerTemplateCreateRequest
+	if !isEmptyRequest(msg) {
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 			return
 		}
 	}
 
-	// Should we expect a durable name
-	if rt == ccLegacyDurable {
-		if numTokens(subject) < 7 {
-			resp.Error = NewJSConsumerDurableNameNotInSubjectError()
-			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-			return
-		}
-		// Now check on requirements for durable request.
-		if req.Config.Durable == _EMPTY_ {
-			resp.Error = NewJSConsumerDurableNameNotSetError()
+	streamName, templateName := tokenAt(subject, 6), tokenAt(subject, 7)
+
+	// Grab the template from the stream config.
+	var scfg StreamConfig
+	var mset *stream
+	if isClustered {
+		var ok bool
+		if scfg, ok = js.clusterStreamConfig(acc.Name, streamName); !ok {
+			resp.Error = NewJSStreamNotFoundError()
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 			return
 		}
-		if consumerName != req.Config.Durable {
-			resp.Error = NewJSConsumerDurableNameNotMatchSubjectError()
+	} else {
+		if mset, err = acc.lookupStream(streamName); err != nil {
+			resp.Error = NewJSStreamNotFoundError(Unless(err))
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 			return
 		}
+		scfg = mset.config()
 	}
-	// If new style and durable set make sure they match.
-	if rt == ccNew {
-		if req.Config.Durable != _EMPTY_ {
-			if consumerName != req.Config.Durable {
-				resp.Error = NewJSConsumerDurableNameNotMatchSubjectError()
-				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
-				return
-			}
-		}
-		// New style ephemeral so we need to honor the name.
-		req.Config.Name = consumerName
-	}
-	// Check for legacy ephemeral mis-configuration.
-	if rt == ccLegacyEphemeral && req.Config.Durable != _EMPTY_ {
-		resp.Error = NewJSConsumerEphemeralWithDurableNameError()
+	tc, ok := scfg.ConsumerTemplates[templateName]
+	if !ok {
+		resp.Error = NewJSConsumerTemplateNotFoundError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
-
-	// Check for a filter subject.
-	if filteredSubject != _EMPTY_ && req.Config.FilterSubject != filteredSubject {
-		resp.Error = NewJSConsumerCreateFilterSubjectMismatchError()
+	cfg, err := instantiateConsumerTemplate(&tc, req.Params)
+	if err != nil {
+		resp.Error = NewJSConsumerTemplateInvalidError(err)
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
 
-	if isClustered && !req.Config.Direct {
-		// If we are inline with client, we still may need to do a callout for consumer info
-		// during this call, so place in Go routine to not block client.
-		// Router and Gateway API calls already in separate context.
+	// Templates only create consumers, they do not update existing ones.
+	name := cfg.Name
+	if name == _EMPTY_ {
+		name = cfg.Durable
+	}
+	if name != _EMPTY_ {
+		var exists bool
+		if isClustered {
+			js.mu.RLock()
+			exists = js.consumerAssignment(acc.Name, streamName, name) != nil
+			js.mu.RUnlock()
+		} else {
+			exists = mset.lookupConsumer(name) != nil
+		}
+		if exists {
+			resp.Error = NewJSConsumerNameExistError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
+	if isClustered {
+		// Same as for creates, do not block the client inline.
 		if c.kind != ROUTER && c.kind != GATEWAY {
-			go s.jsClusteredConsumerRequest(ci, acc, subject, reply, rmsg, req.Stream, &req.Config)
+			go s.jsClusteredConsumerRequest(ci, acc, subject, reply, rmsg, streamName, cfg, false)
 		} else {
-			s.jsClusteredConsumerRequest(ci, acc, subject, reply, rmsg, req.Stream, &req.Config)
+			s.jsClusteredConsumerRequest(ci, acc, subject, reply, rmsg, streamName, cfg, false)
 		}
 		return
 	}
 
-	// If we are here we are single server mode.
-	if req.Config.Replicas > 1 {
+	if cfg.Replicas > 1 {
 		resp.Error = NewJSStreamReplicasNotSupportedError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
-
-	stream, err := acc.lookupStream(req.Stream)
+	o, err := mset.addConsumer(cfg)
 	if err != nil {
-		resp.Error = NewJSStreamNotFoundError(Unless(err))
+		resp.Error = NewJSConsumerCreateError(err, Unless(err))
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
+	resp.ConsumerInfo = o.initialInfo()
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
 
-	o, err := stream.addConsumer(&req.Config)
-
+// Request to attach to an exclusive consumer. The attachment is kept by the consumer leader, so it answers.
+func (s *Server) jsConsumerAttachRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
 	if err != nil {
-		if IsNatsErr(err, JSConsumerStoreFailedErrF) {
-			cname := req.Config.Durable // Will be empty if ephemeral.
-			s.Warnf("Consumer create failed for '%s > %s > %s': %v", acc, req.Stream, cname, err)
-			err = errConsumerStoreFailed
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	streamName, consumerName := streamNameFromSubject(subject), consumerNameFromSubject(subject)
+
+	var resp = JSApiConsumerAttachResponse{ApiResponse: ApiResponse{Type: JSApiConsumerAttachResponseType}}
+
+	// If we are in clustered mode we need to be the consumer leader to proceed.
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return
 		}
-		resp.Error = NewJSConsumerCreateError(err, Unless(err))
+		if js.isLeaderless() {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
+		js.mu.RLock()
+		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, streamName)
+		var ca *consumerAssignment
+		if sa != nil && sa.consumers != nil {
+			ca = sa.consumers[consumerName]
+		}
+		js.mu.RUnlock()
+
+		if sa == nil || ca == nil {
+			// The meta leader answers for what is not there.
+			if isLeader {
+				if sa == nil {
+					resp.Error = NewJSStreamNotFoundError()
+				} else {
+					resp.Error = NewJSConsumerNotFoundError()
+				}
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			}
+			return
+		}
+		// Check to see if we are a member of the group and if the group has no leader.
+		if js.isGroupLeaderless(ca.Group) {
+			resp.Error = NewJSClusterNotAvailError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		if !acc.JetStreamIsConsumerLeader(streamName, consumerName) {
+			return
+		}
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	var req JSApiConsumerAttachRequest
+	if !isEmptyRequest(msg) {
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
+	mset, err := acc.lookupStream(streamName)
+	if err != nil {
+		resp.Error = NewJSStreamNotFoundError(Unless(err))
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
-	resp.ConsumerInfo = o.initialInfo()
+	o := mset.lookupConsumer(consumerName)
+	if o == nil {
+		resp.Error = NewJSConsumerNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	fence, apiErr := o.attach(req.Fence, req.Takeover)
+	if apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	resp.Fence = fence
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
@@ -3906,6 +6060,8 @@ func (s *Server) jsConsumerNamesRequest(sub *subscription, c *client, _ *Account
 	}
 
 	var offset int
+	var filter string
+	limit := JSApiNamesLimit
 	if !isEmptyRequest(msg) {
 		var req JSApiConsumersRequest
 		if err := json.Unmarshal(msg, &req); err != nil {
@@ -3913,7 +6069,7 @@ func (s *Server) jsConsumerNamesRequest(sub *subscription, c *client, _ *Account
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 			return
 		}
-		offset = req.Offset
+		offset, limit, filter = req.Offset, req.pageLimit(JSApiNamesLimit), req.Subject
 	}
 
 	streamName := streamNameFromSubject(subject)
@@ -3940,8 +6096,10 @@ func (s *Server) jsConsumerNamesRequest(sub *subscription, c *client, _ *Account
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 			return
 		}
-		for consumer := range sa.consumers {
-			resp.Consumers = append(resp.Consumers, consumer)
+		for consumer, ca := range sa.consumers {
+			if filter == _EMPTY_ || ca.Config == nil || consumerFilterMatches(ca.Config, filter) {
+				resp.Consumers = append(resp.Consumers, consumer)
+			}
 		}
 		if len(resp.Consumers) > 1 {
 			sort.Slice(resp.Consumers, func(i, j int) bool { return strings.Compare(resp.Consumers[i], resp.Consumers[j]) < 0 })
@@ -3951,8 +6109,8 @@ func (s *Server) jsConsumerNamesRequest(sub *subscription, c *client, _ *Account
 			offset = numConsumers
 		}
 		resp.Consumers = resp.Consumers[offset:]
-		if len(resp.Consumers) > JSApiNamesLimit {
-			resp.Consumers = resp.Consumers[:JSApiNamesLimit]
+		if len(resp.Consumers) > limit {
+			resp.Consumers = resp.Consumers[:limit]
 		}
 		js.mu.RUnlock()
 
@@ -3964,7 +6122,7 @@ func (s *Server) jsConsumerNamesRequest(sub *subscription, c *client, _ *Account
 			return
 		}
 
-		obs := mset.getPublicConsumers()
+		obs := mset.filteredConsumers(filter)
 		sort.Slice(obs, func(i, j int) bool {
 			return strings.Compare(obs[i].name, obs[j].name) < 0
 		})
@@ -3976,13 +6134,13 @@ func (s *Server) jsConsumerNamesRequest(sub *subscription, c *client, _ *Account
 
 		for _, o := range obs[offset:] {
 			resp.Consumers = append(resp.Consumers, o.String())
-			if len(resp.Consumers) >= JSApiNamesLimit {
+			if len(resp.Consumers) >= limit {
 				break
 			}
 		}
 	}
 	resp.Total = numConsumers
-	resp.Limit = JSApiNamesLimit
+	resp.Limit = limit
 	resp.Offset = offset
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
@@ -4030,6 +6188,9 @@ func (s *Server) jsConsumerListRequest(sub *subscription, c *client, _ *Account,
 	}
 
 	var offset int
+	var filter string
+	var orphaned bool
+	limit := JSApiListLimit
 	if !isEmptyRequest(msg) {
 		var req JSApiConsumersRequest
 		if err := json.Unmarshal(msg, &req); err != nil {
@@ -4037,7 +6198,7 @@ func (s *Server) jsConsumerListRequest(sub *subscription, c *client, _ *Account,
 			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 			return
 		}
-		offset = req.Offset
+		offset, limit, filter, orphaned = req.Offset, req.pageLimit(JSApiListLimit), req.Subject, req.Orphaned
 	}
 
 	streamName := streamNameFromSubject(subject)
@@ -4047,7 +6208,7 @@ func (s *Server) jsConsumerListRequest(sub *subscription, c *client, _ *Account,
 		// Need to copy these off before sending.. don't move this inside startGoRoutine!!!
 		msg = copyBytes(msg)
 		s.startGoRoutine(func() {
-			s.jsClusteredConsumerListRequest(acc, ci, offset, streamName, subject, reply, msg)
+			s.jsClusteredConsumerListRequest(acc, ci, filter, orphaned, offset, limit, streamName, subject, reply, msg)
 		})
 		return
 	}
@@ -4059,7 +6220,16 @@ func (s *Server) jsConsumerListRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 
-	obs := mset.getPublicConsumers()
+	obs := mset.filteredConsumers(filter)
+	if orphaned {
+		var oobs []*consumer
+		for _, o := range obs {
+			if o.isOrphaned() {
+				oobs = append(oobs, o)
+			}
+		}
+		obs = oobs
+	}
 	sort.Slice(obs, func(i, j int) bool {
 		return strings.Compare(obs[i].name, obs[j].name) < 0
 	})
@@ -4071,12 +6241,12 @@ func (s *Server) jsConsumerListRequest(sub *subscription, c *client, _ *Account,
 
 	for _, o := range obs[offset:] {
 		resp.Consumers = append(resp.Consumers, o.info())
-		if len(resp.Consumers) >= JSApiListLimit {
+		if len(resp.Consumers) >= limit {
 			break
 		}
 	}
 	resp.Total = ocnt
-	resp.Limit = JSApiListLimit
+	resp.Limit = limit
 	resp.Offset = offset
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
@@ -4323,4 +6493,91 @@ func (s *Server) sendJetStreamAPIAuditAdvisory(ci *ClientInfo, acc *Account, sub
 		Response: response,
 		Domain:   s.getOpts().JetStreamDomain,
 	})
+
+	// Creating the audit stream is not part of the audit trail, it could not hold the entry yet.
+	if acc == s.SystemAccount() && subject == fmt.Sprintf(JSApiStreamCreateT, JSAdminAuditStream) {
+		return
+	}
+	if s.getOpts().JetStreamAudit && isJSApiAdminSubject(subject) {
+		s.sendJetStreamAdminAudit(ci, acc, subject, request, response)
+	}
+}
+
+// Read only API requests, these are not part of the administrative audit trail.
+// Matched as a whole so stream or consumer names can not make a request look read only.
+var jsApiReadOnlySubjects = []string{
+	JSApiAccountInfo,
+	JSApiTemplates,
+	JSApiTemplateInfo,
+	JSApiStreamConfigHistory,
+	JSApiStreamStatsHistory,
+	JSApiStreamFilterCheck,
+	JSApiStreamPartitionInfo,
+	JSApiStreamRetentionPreview,
+	JSApiStreamTombstones,
+	JSApiStreams,
+	JSApiStreamList,
+	JSApiShardedStreamInfo,
+	JSApiStreamInfo,
+	JSApiMsgGet,
+	JSApiMsgLookup,
+	JSDirectMsgGet,
+	JSDirectGetLastBySubject,
+	JSApiConsumers,
+	JSApiConsumerList,
+	JSApiConsumerInfo,
+}
+
+// isJSApiAdminSubject returns true if the API subject is for an administrative action.
+func isJSApiAdminSubject(subject string) bool {
+	for _, ro := range jsApiReadOnlySubjects {
+		if subjectIsSubsetMatch(subject, ro) {
+			return false
+		}
+	}
+	return true
+}
+
+// sendJetStreamAdminAudit will add an entry to the administrative audit trail in the system account.
+// Entries are chained by hash so removed or modified entries can be detected.
+func (s *Server) sendJetStreamAdminAudit(ci *ClientInfo, acc *Account, subject, request, response string) {
+	js := s.getJetStream()
+	if js == nil || acc == nil {
+		return
+	}
+
+	entry := &JSAdminAudit{
+		TypedEvent: TypedEvent{
+			Type: JSAdminAuditType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Server:   s.Name(),
+		Account:  acc.Name,
+		Client:   ci,
+		Subject:  subject,
+		Request:  request,
+		Response: response,
+		Domain:   s.getOpts().JetStreamDomain,
+	}
+
+	// Hold the lock while sending so the audit trail is published in chain order.
+	js.auditMu.Lock()
+	defer js.auditMu.Unlock()
+
+	js.auditSeq++
+	entry.Seq, entry.PrevHash = js.auditSeq, js.auditHash
+	b, err := json.Marshal(entry)
+	if err != nil {
+		s.Warnf("Audit entry could not be serialized for account %q: %v", acc.Name, err)
+		return
+	}
+	h := sha256.Sum256(b)
+	entry.Hash = hex.EncodeToString(h[:])
+	js.auditHash = entry.Hash
+	if err := js.storeAuditHead(); err != nil {
+		s.Warnf("Audit head could not be stored: %v", err)
+	}
+
+	s.publishAdvisory(nil, fmt.Sprintf(JSAdminAuditT, acc.Name), entry)
 }
@@ -0,0 +1,166 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File in the store directory holding the head of our administrative audit trail,
+// so the hash chain continues across restarts.
+const jsAuditHeadFile = "audit.head"
+
+// How long we wait for the audit stream to be created before asking again.
+const jsAuditStreamRetry = 2 * time.Second
+
+// Last entry of our administrative audit trail.
+type jsAuditHead struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// loadAuditHead restores the head of the audit trail from the store directory.
+func (js *jetStream) loadAuditHead() error {
+	buf, err := os.ReadFile(filepath.Join(js.config.StoreDir, jsAuditHeadFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not read audit head: %v", err)
+	}
+	var head jsAuditHead
+	if err := json.Unmarshal(buf, &head); err != nil {
+		return fmt.Errorf("audit head file is corrupt")
+	}
+	js.auditMu.Lock()
+	js.auditSeq, js.auditHash = head.Seq, head.Hash
+	js.auditMu.Unlock()
+	return nil
+}
+
+// storeAuditHead writes the head of the audit trail, replacing the old one only once
+// the new one is on disk.
+// Lock (auditMu) should be held.
+func (js *jetStream) storeAuditHead() error {
+	b, err := json.Marshal(&jsAuditHead{Seq: js.auditSeq, Hash: js.auditHash})
+	if err != nil {
+		return err
+	}
+	fn := filepath.Join(js.config.StoreDir, jsAuditHeadFile)
+	tmp := fn + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, defaultFilePerms)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
+
+// adminAuditStreamConfig is the configuration of the stream in the system account
+// holding the administrative audit trail of all accounts.
+func (s *Server) adminAuditStreamConfig() StreamConfig {
+	cfg := StreamConfig{
+		Name:       JSAdminAuditStream,
+		Subjects:   []string{fmt.Sprintf(JSAdminAuditT, fwcs)},
+		Storage:    FileStorage,
+		Retention:  LimitsPolicy,
+		Replicas:   s.mqttDetermineReplicas(),
+		DenyDelete: true,
+		DenyPurge:  true,
+	}
+	// Internal requests do not carry the cluster they came from.
+	if s.JetStreamIsClustered() {
+		cfg.Placement = &Placement{Cluster: s.ClusterName()}
+	}
+	return cfg
+}
+
+// createAdminAuditStream makes sure the audit stream exists in the system account.
+// This goes through the API so it works the same whether we are clustered or not.
+func (js *jetStream) createAdminAuditStream() {
+	s := js.srv
+	defer s.grWG.Done()
+
+	js.mu.RLock()
+	qch := js.quitCh
+	js.mu.RUnlock()
+
+	req, err := json.Marshal(s.adminAuditStreamConfig())
+	if err != nil {
+		s.Warnf("Audit stream config could not be serialized: %v", err)
+		return
+	}
+	subj := fmt.Sprintf(JSApiStreamCreateT, JSAdminAuditStream)
+
+	rc := make(chan *JSApiStreamCreateResponse, 1)
+	s.mu.Lock()
+	if s.sys == nil || s.sys.replies == nil {
+		s.mu.Unlock()
+		return
+	}
+	inbox := s.newRespInbox()
+	s.sys.replies[inbox] = func(_ *subscription, _ *client, _ *Account, _, _ string, msg []byte) {
+		var resp JSApiStreamCreateResponse
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			s.Warnf("Error unmarshaling audit stream create response: %v", err)
+			return
+		}
+		select {
+		case rc <- &resp:
+		default:
+		}
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		if s.sys != nil && s.sys.replies != nil {
+			delete(s.sys.replies, inbox)
+		}
+		s.mu.Unlock()
+	}()
+
+	t := time.NewTimer(0)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-qch:
+			return
+		case <-s.quitCh:
+			return
+		case resp := <-rc:
+			// Servers can pick different replicas or clusters, the first one wins.
+			if resp.Error == nil || IsNatsErr(resp.Error, JSStreamNameExistErr) {
+				return
+			}
+			s.Warnf("Audit stream could not be created: %v", resp.Error)
+		case <-t.C:
+			// Our API subscriptions belong to the system client as well, so we need the echo.
+			s.sendInternalAccountMsgWithReply(nil, subj, inbox, nil, req, true)
+			t.Reset(jsAuditStreamRetry)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// JSBillingOpts configure posting the JetStream usage of all accounts on this server to an HTTPS
+// endpoint, e.g. for a billing pipeline. Every server posts its own usage, so in a cluster the
+// endpoint sums the reports of all servers.
+type JSBillingOpts struct {
+	// Endpoint to POST the usage to, needs to be https.
+	URL string
+	// Secret requests are signed with.
+	Secret string
+	// How often to post the usage.
+	Interval time.Duration
+	// Optional CA certificates to verify the endpoint with, otherwise the system roots are used.
+	CAFile string
+}
+
+// Headers of the requests to the billing webhook. The signature is the hex encoded HMAC-SHA256
+// of the timestamp, a '.' and the body with the secret as key, prefixed with "sha256=".
+const (
+	JSBillingTimestamp = "Nats-Timestamp"
+	JSBillingSignature = "Nats-Signature"
+)
+
+const (
+	// Default time between posting usage.
+	defaultBillingInterval = time.Minute
+	// How long we wait for the endpoint to respond.
+	billingRequestTimeout = 10 * time.Second
+)
+
+// JSBillingReport is posted to the billing webhook. Counters are for the period from start to
+// end, which starts at the end of the last report the endpoint accepted, so no usage is lost
+// when posting fails. Memory and storage are what is in use at the end of the period.
+type JSBillingReport struct {
+	Server   string                   `json:"server"`
+	ServerID string                   `json:"server_id"`
+	Domain   string                   `json:"domain,omitempty"`
+	Start    time.Time                `json:"start"`
+	End      time.Time                `json:"end"`
+	Accounts []*JSBillingAccountUsage `json:"accounts"`
+}
+
+// JSBillingAccountUsage is the JetStream usage of an account on this server.
+type JSBillingAccountUsage struct {
+	Account   string `json:"account"`
+	Memory    uint64 `json:"memory"`
+	Store     uint64 `json:"storage"`
+	API       uint64 `json:"api"`
+	APIErrors uint64 `json:"api_errors"`
+	Delivered uint64 `json:"delivered"`
+}
+
+// jsBillingCounters are the totals of an account we report the changes of.
+type jsBillingCounters struct {
+	api       uint64
+	apiErrors uint64
+	delivered uint64
+}
+
+// validateJetStreamBilling will check the billing webhook options.
+func validateJetStreamBilling(o *Options) error {
+	bo := o.JetStreamBilling
+	if bo == nil {
+		return nil
+	}
+	u, err := url.Parse(bo.URL)
+	if err != nil {
+		return fmt.Errorf("jetstream billing webhook url is invalid: %v", err)
+	}
+	if u.Scheme != "https" || u.Host == _EMPTY_ {
+		return errors.New("jetstream billing webhook url must be an absolute https url")
+	}
+	if bo.Secret == _EMPTY_ {
+		return errors.New("jetstream billing webhook requires a secret")
+	}
+	if bo.Interval < 0 {
+		return errors.New("jetstream billing webhook interval can not be negative")
+	}
+	if bo.CAFile != _EMPTY_ {
+		if _, err := billingRootCAs(bo.CAFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// billingRootCAs loads the CA certificates to verify the billing endpoint with.
+func billingRootCAs(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("jetstream billing webhook ca file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("jetstream billing webhook ca file has no valid certificates")
+	}
+	return pool, nil
+}
+
+// Runs in its own Go routine and periodically posts the usage of all accounts to the billing webhook.
+func (js *jetStream) runBilling() {
+	s := js.srv
+	defer s.grWG.Done()
+
+	bo := s.getOpts().JetStreamBilling
+	if bo == nil {
+		return
+	}
+	js.mu.RLock()
+	qch := js.quitCh
+	js.mu.RUnlock()
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if bo.CAFile != _EMPTY_ {
+		pool, err := billingRootCAs(bo.CAFile)
+		if err != nil {
+			s.Errorf("JetStream billing webhook disabled: %v", err)
+			return
+		}
+		tlsConfig.RootCAs = pool
+	}
+	hc := &http.Client{Timeout: billingRequestTimeout, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	defer hc.CloseIdleConnections()
+
+	interval := bo.Interval
+	if interval <= 0 {
+		interval = defaultBillingInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	start, last := time.Now().UTC(), make(map[string]jsBillingCounters)
+	for {
+		select {
+		case <-qch:
+			return
+		case <-s.quitCh:
+			return
+		case now := <-t.C:
+			if !js.isEnabled() {
+				continue
+			}
+			report, totals := js.billingReport(start, now.UTC(), last)
+			if err := postBillingReport(hc, bo, report); err != nil {
+				s.RateLimitWarnf("JetStream billing webhook error: %v", err)
+				continue
+			}
+			start, last = report.End, totals
+		}
+	}
+}
+
+// billingReport returns the usage of all accounts since the last totals, and the current totals.
+func (js *jetStream) billingReport(start, end time.Time, last map[string]jsBillingCounters) (*JSBillingReport, map[string]jsBillingCounters) {
+	s := js.srv
+	js.mu.RLock()
+	domain := js.config.Domain
+	accounts := make([]*jsAccount, 0, len(js.accounts))
+	for _, jsa := range js.accounts {
+		accounts = append(accounts, jsa)
+	}
+	js.mu.RUnlock()
+
+	report := &JSBillingReport{
+		Server:   s.Name(),
+		ServerID: s.ID(),
+		Domain:   domain,
+		Start:    start,
+		End:      end,
+		Accounts: make([]*JSBillingAccountUsage, 0, len(accounts)),
+	}
+	totals := make(map[string]jsBillingCounters, len(accounts))
+	for _, jsa := range accounts {
+		jsa.mu.RLock()
+		name := jsa.account.Name
+		jsa.mu.RUnlock()
+
+		usage := &JSBillingAccountUsage{Account: name}
+		jsa.usageMu.RLock()
+		for _, sa := range jsa.usage {
+			usage.Memory += uint64(sa.local.mem)
+			usage.Store += uint64(sa.local.store)
+		}
+		cur := jsBillingCounters{api: jsa.usageApi, apiErrors: jsa.usageErr}
+		jsa.usageMu.RUnlock()
+		cur.delivered = atomic.LoadUint64(&jsa.delivered)
+
+		prev := last[name]
+		usage.API = billingDelta(cur.api, prev.api)
+		usage.APIErrors = billingDelta(cur.apiErrors, prev.apiErrors)
+		usage.Delivered = billingDelta(cur.delivered, prev.delivered)
+		report.Accounts = append(report.Accounts, usage)
+		totals[name] = cur
+	}
+	sort.Slice(report.Accounts, func(i, j int) bool { return report.Accounts[i].Account < report.Accounts[j].Account })
+	return report, totals
+}
+
+// billingDelta returns the change of a counter, which starts over if JetStream was re-enabled for the account.
+func billingDelta(cur, prev uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+// postBillingReport will POST the signed report, any response other than a 2xx is an error.
+func postBillingReport(hc *http.Client, bo *JSBillingOpts, report *JSBillingReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, bo.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf(webhookUserAgentFmt, VERSION))
+	req.Header.Set(JSBillingTimestamp, ts)
+	req.Header.Set(JSBillingSignature, billingSignature(bo.Secret, ts, body))
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %q", resp.Status)
+	}
+	return nil
+}
+
+// billingSignature returns the signature of a request to the billing webhook.
+func billingSignature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
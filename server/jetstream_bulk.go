@@ -0,0 +1,279 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// BulkLoadFormat is the format of the records in a bulk load file.
+type BulkLoadFormat int
+
+const (
+	// BulkLoadJSON is newline delimited JSON, one BulkRecord per line.
+	BulkLoadJSON BulkLoadFormat = iota
+	// BulkLoadBinary is length prefixed binary records. Each record is the subject,
+	// the header and the message, each prefixed by its length as a big endian uint32.
+	// The header, if present, is in the NATS header format.
+	BulkLoadBinary
+)
+
+// String returns the name of the format used in bulk load requests.
+func (f BulkLoadFormat) String() string {
+	switch f {
+	case BulkLoadJSON:
+		return "json"
+	case BulkLoadBinary:
+		return "binary"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (f BulkLoadFormat) MarshalJSON() ([]byte, error) {
+	switch f {
+	case BulkLoadJSON, BulkLoadBinary:
+		return json.Marshal(f.String())
+	default:
+		return nil, fmt.Errorf("can not marshal %v", f)
+	}
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *BulkLoadFormat) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case jsonString("json"):
+		*f = BulkLoadJSON
+	case jsonString("binary"):
+		*f = BulkLoadBinary
+	default:
+		return fmt.Errorf("can not unmarshal %q", data)
+	}
+	return nil
+}
+
+// BulkRecord is a single message in a newline delimited JSON bulk load file.
+type BulkRecord struct {
+	Subject string            `json:"subject"`
+	Header  map[string]string `json:"headers,omitempty"`
+	Data    []byte            `json:"data,omitempty"`
+}
+
+const (
+	// Size of the buffer we use to read bulk load files.
+	bulkLoadBufSize = 1024 * 1024
+	// Sanity limit on a binary record length.
+	bulkLoadMaxLen = 64 * 1024 * 1024
+)
+
+// JSApiStreamBulkLoadRequest has the file local to the server to bulk load a stream from.
+type JSApiStreamBulkLoadRequest struct {
+	Path   string         `json:"path"`
+	Format BulkLoadFormat `json:"format"`
+}
+
+// JSApiStreamBulkLoadResponse has the number of records stored, also when the load failed part way.
+type JSApiStreamBulkLoadResponse struct {
+	ApiResponse
+	Stored uint64 `json:"stored"`
+}
+
+const JSApiStreamBulkLoadResponseType = "io.nats.jetstream.api.v1.stream_bulk_load_response"
+
+// Request to bulk load a stream from a file local to the server.
+// Only the server that has the stream will respond.
+func (s *Server) jsStreamBulkLoadRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, _, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+	// Accounts import all of the JetStream API from the system account, so check where this came from.
+	if acc != s.SystemAccount() {
+		return
+	}
+
+	accName, stream := tokenAt(subject, 6), tokenAt(subject, 7)
+	if ta, err := s.lookupAccount(accName); err != nil {
+		return
+	} else if _, err := ta.lookupStream(stream); err != nil {
+		return
+	}
+
+	var resp = JSApiStreamBulkLoadResponse{ApiResponse: ApiResponse{Type: JSApiStreamBulkLoadResponseType}}
+	var req JSApiStreamBulkLoadRequest
+	if err := json.Unmarshal(msg, &req); err != nil || req.Path == _EMPTY_ {
+		resp.Error = NewJSInvalidJSONError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	// Loading can take a while, so do not hold up the system account.
+	s.startGoRoutine(func() {
+		defer s.grWG.Done()
+
+		s.Noticef("Bulk load request for stream '%s > %s' from %q", accName, stream, req.Path)
+		resp.Stored, err = s.JetStreamBulkLoad(accName, stream, req.Path, req.Format)
+		if err != nil {
+			s.Warnf("Bulk load of stream '%s > %s' failed after %d records: %v", accName, stream, resp.Stored, err)
+			if apiErr, ok := err.(*ApiError); ok {
+				resp.Error = apiErr
+			} else {
+				resp.Error = NewJSStreamGeneralError(err, Unless(err))
+			}
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+	})
+}
+
+// JetStreamBulkLoad will load all records from the local file at path directly into
+// the stream, bypassing the client protocol. This is meant for initial data migrations.
+// Records are stored in order and the usual stream limits and checks apply.
+// Records that are duplicates based on their message ID are skipped, so a
+// failed load can be safely repeated. Returns the number of records stored.
+// Clustered streams are not supported.
+func (s *Server) JetStreamBulkLoad(accName, stream, path string, format BulkLoadFormat) (uint64, error) {
+	if !s.JetStreamEnabled() {
+		return 0, NewJSNotEnabledError()
+	}
+	acc, err := s.LookupAccount(accName)
+	if err != nil {
+		return 0, err
+	}
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		return 0, NewJSStreamNotFoundError(Unless(err))
+	}
+	if mset.isClustered() {
+		return 0, NewJSClusterUnSupportFeatureError()
+	}
+	if mset.isMirror() {
+		return 0, errors.New("can not bulk load into a mirror")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var next func() (string, []byte, []byte, error)
+	br := bufio.NewReaderSize(f, bulkLoadBufSize)
+	switch format {
+	case BulkLoadJSON:
+		next = func() (string, []byte, []byte, error) { return readBulkJSONRecord(br) }
+	case BulkLoadBinary:
+		next = func() (string, []byte, []byte, error) { return readBulkBinaryRecord(br) }
+	default:
+		return 0, fmt.Errorf("unknown bulk load format %d", format)
+	}
+
+	var stored, n uint64
+	for {
+		subj, hdr, msg, err := next()
+		if err == io.EOF {
+			return stored, nil
+		}
+		n++
+		if err != nil {
+			return stored, fmt.Errorf("bulk load record %d: %v", n, err)
+		}
+		if !IsValidLiteralSubject(subj) || !mset.subjectMatches(subj) {
+			return stored, fmt.Errorf("bulk load record %d: subject %q does not match stream %q", n, subj, stream)
+		}
+		if err := mset.processJetStreamMsg(subj, _EMPTY_, hdr, msg, 0, 0, false); err != nil {
+			if err == errMsgIdDuplicate {
+				continue
+			}
+			return stored, fmt.Errorf("bulk load record %d: %v", n, err)
+		}
+		stored++
+	}
+}
+
+// Reads the next newline delimited JSON record, skipping empty lines.
+func readBulkJSONRecord(br *bufio.Reader) (string, []byte, []byte, error) {
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return _EMPTY_, nil, nil, err
+			}
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return _EMPTY_, nil, nil, err
+		}
+		var r BulkRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return _EMPTY_, nil, nil, err
+		}
+		var hdr []byte
+		if len(r.Header) > 0 {
+			keys := make([]string, 0, len(r.Header))
+			for k := range r.Header {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				hdr = genHeader(hdr, k, r.Header[k])
+			}
+		}
+		return r.Subject, hdr, r.Data, nil
+	}
+}
+
+// Reads the next length prefixed binary record.
+func readBulkBinaryRecord(br *bufio.Reader) (string, []byte, []byte, error) {
+	var parts [3][]byte
+	for i := range parts {
+		var lb [4]byte
+		if _, err := io.ReadFull(br, lb[:]); err != nil {
+			// A clean EOF is only valid at the start of a record.
+			if i > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return _EMPTY_, nil, nil, err
+		}
+		l := binary.BigEndian.Uint32(lb[:])
+		if l > bulkLoadMaxLen {
+			return _EMPTY_, nil, nil, fmt.Errorf("record length %d too large", l)
+		}
+		if l == 0 {
+			continue
+		}
+		parts[i] = make([]byte, l)
+		if _, err := io.ReadFull(br, parts[i]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return _EMPTY_, nil, nil, err
+		}
+	}
+	return string(parts[0]), parts[1], parts[2], nil
+}
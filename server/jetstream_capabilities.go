@@ -0,0 +1,116 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "time"
+
+// JSApiLevel is the level of the JetStream API supported by this server.
+// It is raised when the API changes in a way clients need to know about.
+const JSApiLevel = 1
+
+// Features clients can check for before relying on them, instead of failing
+// at runtime against servers that do not have them. Keep sorted.
+var jsApiFeatures = []string{
+	"ack_pause",
+	"consumer_bind",
+	"consumer_bind_token",
+	"consumer_deliver_copies",
+	"consumer_deliver_queue",
+	"consumer_deliver_transform",
+	"consumer_delivery_schedule",
+	"consumer_exclusive",
+	"consumer_metadata_headers",
+	"consumer_origin_headers",
+	"consumer_orphans",
+	"consumer_pending_memory",
+	"consumer_reattach",
+	"consumer_redelivery_jitter",
+	"consumer_redelivery_order",
+	"consumer_replay_speed",
+	"consumer_sample",
+	"consumer_start_consumer_seq",
+	"consumer_templates",
+	"consumer_webhook",
+	"deliver_group_hash",
+	"msg_get_start_time",
+	"msg_time",
+	"ordered_consumers",
+	"pull_sequence_barrier",
+	"stream_ack_pending_total",
+	"stream_aggregate",
+	"stream_async_replication",
+	"stream_batch",
+	"stream_canary",
+	"stream_chunked",
+	"stream_config_rollback",
+	"stream_evictions",
+	"stream_filter_check",
+	"stream_header_index",
+	"stream_ingest_rate",
+	"stream_memory_head",
+	"stream_origin",
+	"stream_partitions",
+	"stream_pinned_msgs",
+	"stream_relocate",
+	"stream_remote",
+	"stream_reopen",
+	"stream_retention_preview",
+	"stream_schema",
+	"stream_shadow",
+	"stream_sharding",
+	"stream_single_writer",
+	"stream_stats_history",
+	"stream_tombstones",
+	"trace_context",
+}
+
+// JSApiCapabilities describes what this server supports. It is part of the account info
+// response, so clients can detect features with the request they already make first.
+type JSApiCapabilities struct {
+	APILevel  int             `json:"api_level"`
+	Version   string          `json:"version"`
+	Features  []string        `json:"features"`
+	Clustered bool            `json:"clustered"`
+	Limits    JSApiLimitsInfo `json:"limits"`
+}
+
+// JSApiLimitsInfo has the server wide limits that apply to all accounts.
+// Zero means the server does not limit it.
+type JSApiLimitsInfo struct {
+	MaxPayload         int32         `json:"max_payload"`
+	MaxRequestBatch    int           `json:"max_request_batch,omitempty"`
+	MaxRequestMaxBytes int           `json:"max_request_max_bytes,omitempty"`
+	MaxAckPending      int           `json:"max_ack_pending,omitempty"`
+	MaxHAAssets        int           `json:"max_ha_assets,omitempty"`
+	Duplicates         time.Duration `json:"max_duplicate_window,omitempty"`
+}
+
+// jsCapabilities returns the capabilities of this server.
+func (s *Server) jsCapabilities() *JSApiCapabilities {
+	opts := s.getOpts()
+	return &JSApiCapabilities{
+		APILevel:  JSApiLevel,
+		Version:   VERSION,
+		Features:  jsApiFeatures,
+		Clustered: s.JetStreamIsClustered(),
+		Limits: JSApiLimitsInfo{
+			MaxPayload:         opts.MaxPayload,
+			MaxRequestBatch:    opts.JetStreamLimits.MaxRequestBatch,
+			MaxRequestMaxBytes: opts.JetStreamLimits.MaxRequestMaxBytes,
+			MaxAckPending:      opts.JetStreamLimits.MaxAckPending,
+			MaxHAAssets:        opts.JetStreamLimits.MaxHAAssets,
+			Duplicates:         opts.JetStreamLimits.Duplicates,
+		},
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -102,6 +103,8 @@ const (
 	removePendingRequest
 	// For sending compressed streams, either through RAFT or catchup.
 	compressedStreamMsgOp
+	// For moving a durable by its consumer sequence.
+	resetConsumerStateOp
 )
 
 // raftGroups are controlled by the metagroup controller.
@@ -159,6 +162,8 @@ type streamPurge struct {
 	Subject string                   `json:"subject"`
 	Reply   string                   `json:"reply"`
 	Request *JSApiStreamPurgeRequest `json:"request,omitempty"`
+	// Used by mirrors to start over when their upstream stream was reset.
+	Reset bool `json:"reset,omitempty"`
 }
 
 // streamMsgDelete is what the stream leader will replicate when deleting a message.
@@ -510,14 +515,18 @@ func (js *jetStream) isConsumerCurrent(account, stream, consumer string) bool {
 // subjectsOverlap checks all existing stream assignments for the account cross-cluster for subject overlap
 // Use only for clustered JetStream
 // Read lock should be held.
-func (jsc *jetStreamCluster) subjectsOverlap(acc string, subjects []string, osa *streamAssignment) bool {
+func (jsc *jetStreamCluster) subjectsOverlap(acc string, subjects []string, shard *StreamShard, osa *streamAssignment) bool {
 	asa := jsc.streams[acc]
 	for _, sa := range asa {
 		// can't overlap yourself, assume osa pre-checked for deep equal if passed
 		if osa != nil && sa == osa {
 			continue
 		}
-		for _, subj := range sa.Config.Subjects {
+		// Shards of the same stream share their subjects.
+		if shard.sharesSubjects(subjects, sa.Config.Shard, sa.Config.ingestSubjects()) {
+			continue
+		}
+		for _, subj := range sa.Config.ingestSubjects() {
 			for _, tsubj := range subjects {
 				if SubjectsCollide(tsubj, subj) {
 					return true
@@ -1839,7 +1848,7 @@ func (js *jetStream) createRaftGroup(accName string, rg *raftGroup, storage Stor
 			FileStoreConfig{StoreDir: storeDir, BlockSize: defaultMediumBlockSize, AsyncFlush: false, SyncInterval: 5 * time.Minute},
 			StreamConfig{Name: rg.Name, Storage: FileStorage},
 			time.Now().UTC(),
-			s.jsKeyGen(rg.Name),
+			s.jsAccKeyGen(accName, rg.Name),
 		)
 		if err != nil {
 			s.Errorf("Error creating filestore WAL: %v", err)
@@ -2600,11 +2609,13 @@ func (js *jetStream) applyStreamEntries(mset *stream, ce *CommittedEntry, isReco
 					last := mset.store.SkipMsg()
 					mset.setLastSeq(last)
 					mset.clearAllPreAcks(last)
+					// Only mirrors skip, for what their upstream removed.
+					mset.recordRemoved(last, last)
 					continue
 				}
 
 				// Process the actual message here.
-				if err := mset.processJetStreamMsg(subject, reply, hdr, msg, lseq, ts); err != nil {
+				if err := mset.processJetStreamMsg(subject, reply, hdr, msg, lseq, ts, false); err != nil {
 					// Only return in place if we are going to reset stream or we are out of space.
 					if isClusterResetErr(err) || isOutOfSpaceErr(err) {
 						return err
@@ -2668,6 +2679,15 @@ func (js *jetStream) applyStreamEntries(mset *stream, ce *CommittedEntry, isReco
 					}
 					panic(err.Error())
 				}
+				if sp.Reset {
+					// When recovering only reset if nothing was stored since.
+					if !isRecovering || mset.lastSeq() == sp.LastSeq {
+						mset.mu.Lock()
+						mset.resetStore()
+						mset.mu.Unlock()
+					}
+					continue
+				}
 				// Ignore if we are recovering and we have already processed.
 				if isRecovering {
 					if mset.state().FirstSeq <= sp.LastSeq {
@@ -3178,7 +3198,7 @@ func (js *jetStream) processClusterUpdateStream(acc *Account, osa, sa *streamAss
 			js.mu.Unlock()
 		}
 		// Call update.
-		if err = mset.updateWithAdvisory(cfg, !recovering); err != nil {
+		if err = mset.updateWithAdvisory(cfg, sa.Client, !recovering); err != nil {
 			s.Warnf("JetStream cluster error updating stream %q for account %q: %v", cfg.Name, acc.Name, err)
 		}
 		// Set the new stream assignment.
@@ -3318,7 +3338,7 @@ func (js *jetStream) processClusterCreateStream(acc *Account, sa *streamAssignme
 				}
 			}
 			mset.setStreamAssignment(sa)
-			if err = mset.updateWithAdvisory(sa.Config, false); err != nil {
+			if err = mset.updateWithAdvisory(sa.Config, sa.Client, false); err != nil {
 				s.Warnf("JetStream cluster error updating stream %q for account %q: %v", sa.Config.Name, acc.Name, err)
 				if osa != nil {
 					// Process the raft group and make sure it's running if needed.
@@ -3571,13 +3591,11 @@ func (js *jetStream) processClusterDeleteStream(sa *streamAssignment, isMember,
 			}
 		}
 	}
-	accDir := filepath.Join(js.config.StoreDir, sa.Client.serviceAccount())
-	streamDir := filepath.Join(accDir, streamsDir)
-	os.RemoveAll(filepath.Join(streamDir, sa.Config.Name))
-
-	// no op if not empty
-	os.Remove(streamDir)
-	os.Remove(accDir)
+	accName := sa.Client.serviceAccount()
+	for _, streamDir := range js.streamsDirs(accName) {
+		os.RemoveAll(filepath.Join(streamDir, sa.Config.Name))
+	}
+	js.removeEmptyStreamsDirs(accName)
 
 	// Normally we want only the leader to respond here, but if we had no leader then all members will respond to make
 	// sure we get feedback to the user.
@@ -4516,6 +4534,25 @@ func (js *jetStream) applyConsumerEntries(o *consumer, ce *CommittedEntry, isLea
 					}
 				}
 				o.mu.Unlock()
+			case resetConsumerStateOp:
+				// These are handled in place in leaders.
+				if !isLeader {
+					state, err := decodeConsumerState(buf[1:])
+					if err != nil {
+						if mset, node := o.streamAndNode(); mset != nil && node != nil {
+							s := js.srv
+							s.Errorf("JetStream cluster could not decode consumer state reset for '%s > %s > %s' [%s]",
+								mset.account(), mset.name(), o, node.Group())
+						}
+						panic(err.Error())
+					}
+					o.mu.Lock()
+					err = o.store.Reset(state)
+					o.mu.Unlock()
+					if err != nil {
+						panic(err.Error())
+					}
+				}
 			default:
 				panic(fmt.Sprintf("JetStream Cluster Unknown group entry op type! %v", entryOp(buf[0])))
 			}
@@ -5348,6 +5385,7 @@ func tieredStreamAndReservationCount(asa map[string]*streamAssignment, tier stri
 					reservation += (int64(sa.Config.Replicas) * sa.Config.MaxBytes)
 				}
 			}
+			reservation += memoryHeadReservation(sa.Config, cfg)
 		}
 	} else {
 		numStreams = 0
@@ -5359,6 +5397,7 @@ func tieredStreamAndReservationCount(asa map[string]*streamAssignment, tier stri
 						reservation += (int64(sa.Config.Replicas) * sa.Config.MaxBytes)
 					}
 				}
+				reservation += memoryHeadReservation(sa.Config, cfg)
 			}
 		}
 	}
@@ -5438,6 +5477,10 @@ func (js *jetStream) jsClusteredStreamLimitsCheck(acc *Account, cfg *StreamConfi
 	if err := js.checkAccountLimits(selectedLimits, cfg, reservations); err != nil {
 		return NewJSStreamLimitsError(err, Unless(err))
 	}
+	_, reservations = tieredStreamAndReservationCount(asa, tier, memoryHeadConfig(cfg))
+	if err := js.checkMemoryHeadLimits(selectedLimits, cfg, nil, false, reservations); err != nil {
+		return NewJSStreamLimitsError(err, Unless(err))
+	}
 	return nil
 }
 
@@ -5509,7 +5552,7 @@ func (s *Server) jsClusteredStreamRequest(ci *ClientInfo, acc *Account, subject,
 	}
 
 	// Check for subject collisions here.
-	if cc.subjectsOverlap(acc.Name, cfg.Subjects, self) {
+	if cc.subjectsOverlap(acc.Name, cfg.ingestSubjects(), cfg.Shard, self) {
 		resp.Error = NewJSStreamSubjectOverlapError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
 		return
@@ -5617,7 +5660,7 @@ func (s *Server) sysRequest(v interface{}, subjFormat string, args ...interface{
 	return data, err
 }
 
-func (s *Server) jsClusteredStreamUpdateRequest(ci *ClientInfo, acc *Account, subject, reply string, rmsg []byte, cfg *StreamConfig, peerSet []string) {
+func (s *Server) jsClusteredStreamUpdateRequest(ci *ClientInfo, acc *Account, subject, reply string, rmsg []byte, cfg *StreamConfig, peerSet []string, pinUpdate bool) {
 	js, cc := s.getJetStreamCluster()
 	if js == nil || cc == nil {
 		return
@@ -5640,6 +5683,8 @@ func (s *Server) jsClusteredStreamUpdateRequest(ci *ClientInfo, acc *Account, su
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
 		return
 	}
+	cfg = cfg.withPinned(osa.Config, pinUpdate)
+
 	var newCfg *StreamConfig
 	if jsa := js.accounts[acc.Name]; jsa != nil {
 		js.mu.Unlock()
@@ -5665,7 +5710,7 @@ func (s *Server) jsClusteredStreamUpdateRequest(ci *ClientInfo, acc *Account, su
 	}
 
 	// Check for subject collisions here.
-	if cc.subjectsOverlap(acc.Name, cfg.Subjects, osa) {
+	if cc.subjectsOverlap(acc.Name, cfg.ingestSubjects(), cfg.Shard, osa) {
 		resp.Error = NewJSStreamSubjectOverlapError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
 		return
@@ -6039,7 +6084,7 @@ func (s *Server) allPeersOffline(rg *raftGroup) bool {
 
 // This will do a scatter and gather operation for all streams for this account. This is only called from metadata leader.
 // This will be running in a separate Go routine.
-func (s *Server) jsClusteredStreamListRequest(acc *Account, ci *ClientInfo, filter string, offset int, subject, reply string, rmsg []byte) {
+func (s *Server) jsClusteredStreamListRequest(acc *Account, ci *ClientInfo, filter string, offset, limit int, subject, reply string, rmsg []byte) {
 	defer s.grWG.Done()
 
 	js, cc := s.getJetStreamCluster()
@@ -6088,8 +6133,8 @@ func (s *Server) jsClusteredStreamListRequest(acc *Account, ci *ClientInfo, filt
 	if offset > 0 {
 		streams = streams[offset:]
 	}
-	if len(streams) > JSApiListLimit {
-		streams = streams[:JSApiListLimit]
+	if len(streams) > limit {
+		streams = streams[:limit]
 	}
 
 	var resp = JSApiStreamListResponse{
@@ -6100,7 +6145,8 @@ func (s *Server) jsClusteredStreamListRequest(acc *Account, ci *ClientInfo, filt
 	js.mu.RUnlock()
 
 	if len(streams) == 0 {
-		resp.Limit = JSApiListLimit
+		resp.Total = scnt
+		resp.Limit = limit
 		resp.Offset = offset
 		s.sendAPIResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(resp))
 		return
@@ -6192,7 +6238,7 @@ LOOP:
 	}
 
 	resp.Total = scnt
-	resp.Limit = JSApiListLimit
+	resp.Limit = limit
 	resp.Offset = offset
 	resp.Missing = missingNames
 	s.sendAPIResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(resp))
@@ -6200,7 +6246,7 @@ LOOP:
 
 // This will do a scatter and gather operation for all consumers for this stream and account.
 // This will be running in a separate Go routine.
-func (s *Server) jsClusteredConsumerListRequest(acc *Account, ci *ClientInfo, offset int, stream, subject, reply string, rmsg []byte) {
+func (s *Server) jsClusteredConsumerListRequest(acc *Account, ci *ClientInfo, filter string, orphaned bool, offset, limit int, stream, subject, reply string, rmsg []byte) {
 	defer s.grWG.Done()
 
 	js, cc := s.getJetStreamCluster()
@@ -6215,7 +6261,9 @@ func (s *Server) jsClusteredConsumerListRequest(acc *Account, ci *ClientInfo, of
 		if sa := sas[stream]; sa != nil {
 			// Copy over since we need to sort etc.
 			for _, ca := range sa.consumers {
-				consumers = append(consumers, ca)
+				if filter == _EMPTY_ || ca.Config == nil || consumerFilterMatches(ca.Config, filter) {
+					consumers = append(consumers, ca)
+				}
 			}
 		}
 	}
@@ -6226,15 +6274,18 @@ func (s *Server) jsClusteredConsumerListRequest(acc *Account, ci *ClientInfo, of
 		})
 	}
 
+	// Only the consumer leaders know if they are orphaned, so we page after asking all of them.
 	ocnt := len(consumers)
-	if offset > ocnt {
-		offset = ocnt
-	}
-	if offset > 0 {
-		consumers = consumers[offset:]
-	}
-	if len(consumers) > JSApiListLimit {
-		consumers = consumers[:JSApiListLimit]
+	if !orphaned {
+		if offset > ocnt {
+			offset = ocnt
+		}
+		if offset > 0 {
+			consumers = consumers[offset:]
+		}
+		if len(consumers) > limit {
+			consumers = consumers[:limit]
+		}
 	}
 
 	// Send out our requests here.
@@ -6246,7 +6297,8 @@ func (s *Server) jsClusteredConsumerListRequest(acc *Account, ci *ClientInfo, of
 	js.mu.RUnlock()
 
 	if len(consumers) == 0 {
-		resp.Limit = JSApiListLimit
+		resp.Total = ocnt
+		resp.Limit = limit
 		resp.Offset = offset
 		s.sendAPIResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(resp))
 		return
@@ -6333,8 +6385,26 @@ LOOP:
 		})
 	}
 
-	resp.Total = len(resp.Consumers)
-	resp.Limit = JSApiListLimit
+	if orphaned {
+		orphans := []*ConsumerInfo{}
+		for _, ci := range resp.Consumers {
+			if ci.Orphaned != nil {
+				orphans = append(orphans, ci)
+			}
+		}
+		ocnt = len(orphans)
+		if offset > ocnt {
+			offset = ocnt
+		}
+		orphans = orphans[offset:]
+		if len(orphans) > limit {
+			orphans = orphans[:limit]
+		}
+		resp.Consumers = orphans
+	}
+
+	resp.Total = ocnt
+	resp.Limit = limit
 	resp.Offset = offset
 	resp.Missing = missingNames
 	s.sendAPIResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(resp))
@@ -6521,7 +6591,7 @@ func (cc *jetStreamCluster) createGroupForConsumer(cfg *ConsumerConfig, sa *stre
 }
 
 // jsClusteredConsumerRequest is first point of entry to create a consumer with R > 1.
-func (s *Server) jsClusteredConsumerRequest(ci *ClientInfo, acc *Account, subject, reply string, rmsg []byte, stream string, cfg *ConsumerConfig) {
+func (s *Server) jsClusteredConsumerRequest(ci *ClientInfo, acc *Account, subject, reply string, rmsg []byte, stream string, cfg *ConsumerConfig, bind bool) {
 	js, cc := s.getJetStreamCluster()
 	if js == nil || cc == nil {
 		return
@@ -6550,6 +6620,12 @@ func (s *Server) jsClusteredConsumerRequest(ci *ClientInfo, acc *Account, subjec
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
 		return
 	}
+	// Members on other servers are picked per route, so the same key would not always go to the same member.
+	if cfg.DeliverGroupHashToken != 0 {
+		resp.Error = NewJSConsumerInvalidDeliverGroupHashError(errors.New("deliver group hash token is not supported in clustered mode"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
 
 	js.mu.Lock()
 	defer js.mu.Unlock()
@@ -6631,8 +6707,26 @@ func (s *Server) jsClusteredConsumerRequest(ci *ClientInfo, acc *Account, subjec
 		}
 	}
 
+	// When binding the consumer has to exist with the same config.
+	if bind {
+		var existing *ConsumerConfig
+		if ca != nil && !ca.deleted {
+			existing = ca.Config
+		}
+		if err := checkConsumerBind(cfg, existing); err != nil {
+			resp.Error = err
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
 	// If this is new consumer.
 	if ca == nil {
+		if cfg.OptStartConsumerSeq > 0 {
+			resp.Error = NewJSConsumerInvalidStartConsumerSeqError(errors.New("start consumer sequence requires an existing durable"))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+			return
+		}
 		rg := cc.createGroupForConsumer(cfg, sa)
 		if rg == nil {
 			resp.Error = NewJSInsufficientResourcesError()
@@ -6998,7 +7092,7 @@ func (mset *stream) checkAllowMsgCompress(peers []string) {
 const streamLagWarnThreshold = 10_000
 
 // processClusteredMsg will propose the inbound message to the underlying raft group.
-func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg []byte) error {
+func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg []byte, sourced bool) error {
 	// For possible error response.
 	var response []byte
 
@@ -7007,12 +7101,14 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 	name, stype, store := mset.cfg.Name, mset.cfg.Storage, mset.store
 	s, js, jsa, st, rf, tierName, outq, node := mset.srv, mset.js, mset.jsa, mset.cfg.Storage, mset.cfg.Replicas, mset.tier, mset.outq, mset.node
 	maxMsgSize, lseq, clfs := int(mset.cfg.MaxMsgSize), mset.lseq, mset.clfs
-	isLeader, isSealed := mset.isLeader(), mset.cfg.Sealed
+	isLeader, isSealed, ingestRate := mset.isLeader(), mset.cfg.Sealed, mset.cfg.MaxIngestRate
+	async := mset.cfg.Replication == AsyncReplication
+	failedErr := mset.failedError()
 	mset.mu.RUnlock()
 
 	// This should not happen but possible now that we allow scale up, and scale down where this could trigger.
 	if node == nil {
-		return mset.processJetStreamMsg(subject, reply, hdr, msg, 0, 0)
+		return mset.processJetStreamMsg(subject, reply, hdr, msg, 0, 0, sourced)
 	}
 
 	// Check that we are the leader. This can be false if we have scaled up from an R1 that had inbound queued messages.
@@ -7028,6 +7124,37 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 		return NewJSStreamSealedError()
 	}
 
+	// Bail here if we failed after repeated store errors.
+	if failedErr != nil {
+		var resp = JSPubAckResponse{PubAck: &PubAck{Stream: mset.name()}, Error: failedErr}
+		b, _ := json.Marshal(resp)
+		mset.outq.sendMsg(reply, b)
+		return failedErr
+	}
+
+	// Bail here if JetStream was gracefully disabled for the account.
+	if jsa.isReadOnly() {
+		var resp = JSPubAckResponse{PubAck: &PubAck{Stream: mset.name()}, Error: NewJSAccountReadOnlyError()}
+		b, _ := json.Marshal(resp)
+		mset.outq.sendMsg(reply, b)
+		return NewJSAccountReadOnlyError()
+	}
+
+	// Validate before we propose.
+	var err error
+	if hdr, err = mset.checkWriter(reply, hdr); err != nil {
+		return err
+	}
+	var mts int64
+	if !sourced {
+		if err := mset.checkSchema(subject, reply, hdr, msg); err != nil {
+			return err
+		}
+		if mts, err = mset.checkMsgTime(reply, hdr); err != nil {
+			return err
+		}
+	}
+
 	// Check here pre-emptively if we have exceeded this server limits.
 	if js.limitsExceeded(stype) {
 		s.resourcesExeededError()
@@ -7102,6 +7229,22 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 		return err
 	}
 
+	// Check our ingest rate here if we are rejecting, delayed acks are handled when applied.
+	if ingestRate != nil && !ingestRate.Delay && !sourced {
+		mset.mu.Lock()
+		throttled := mset.checkIngestRate(uint64(len(hdr)+len(msg))) > 0
+		mset.mu.Unlock()
+		if throttled {
+			if canRespond {
+				var resp = &JSPubAckResponse{PubAck: &PubAck{Stream: name}}
+				resp.Error = NewJSStreamIngestThrottledError()
+				response, _ = json.Marshal(resp)
+				outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, response, nil, 0))
+			}
+			return NewJSStreamIngestThrottledError()
+		}
+	}
+
 	// Some header checks can be checked pre proposal. Most can not.
 	if len(hdr) > 0 {
 		// For CAS operations, e.g. ExpectedLastSeqPerSubject, we can also check here and not have to go through.
@@ -7160,13 +7303,23 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 		// Re-capture
 		lseq, clfs = mset.lastSeqAndCLFS()
 		mset.clseq = lseq + clfs
+		// Another leader may have stored messages since.
+		mset.clts = 0
 	}
 
-	esm := encodeStreamMsgAllowCompress(subject, reply, hdr, msg, mset.clseq, time.Now().UnixNano(), mset.compressOK)
+	// With async replication we ack here, so nothing to respond to once applied.
+	ereply := reply
+	if async && canRespond {
+		ereply = _EMPTY_
+	}
+	ts := mset.nextClusteredMsgTimestamp(store, mts)
+	esm := encodeStreamMsgAllowCompress(subject, ereply, hdr, msg, mset.clseq, ts, mset.compressOK)
+	// The sequence this message should get, unless any before it fail to be stored.
+	eseq := mset.clseq + 1 - clfs
 	mset.clseq++
 
 	// Do proposal.
-	err := node.Propose(esm)
+	err = node.Propose(esm)
 	if err != nil && mset.clseq > 0 {
 		mset.clseq--
 	}
@@ -7187,6 +7340,13 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 			// If we errored out respond here.
 			outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, response, nil, 0))
 		}
+	} else if async && canRespond {
+		mset.mu.RLock()
+		response = append(mset.pubAck, strconv.FormatUint(eseq, 10)...)
+		mset.mu.RUnlock()
+		response = append(response, '}')
+		mset.trackPubAck(ts)
+		outq.sendMsg(reply, response)
 	}
 
 	if err != nil && isOutOfSpaceErr(err) {
@@ -7666,6 +7826,8 @@ func (mset *stream) processCatchupMsg(msg []byte) (uint64, error) {
 		}
 	} else if err := mset.store.StoreRawMsg(subj, hdr, msg, seq, ts); err != nil {
 		return 0, err
+	} else {
+		mset.hidx.add(seq, hdr)
 	}
 
 	// Update our lseq.
@@ -7876,6 +8038,9 @@ func (mset *stream) processClusterStreamInfoRequest(reply string) {
 		Cluster: js.clusterInfo(mset.raftGroup()),
 		Sources: mset.sourcesInfo(),
 		Mirror:  mset.mirrorInfo(),
+		PubAcks: mset.pubAckStats(),
+		Failed:  mset.failureInfo(),
+		Remote:  mset.remoteInfo(),
 	}
 
 	// Check for out of band catchups.
@@ -3510,3 +3510,847 @@ func TestJetStreamNoLeadersDuringLameDuck(t *testing.T) {
 		}
 	}
 }
+
+func TestJetStreamClusterStreamIngestRate(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, _ := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	addStream(t, nc, &StreamConfig{
+		Name:          "TEST",
+		Subjects:      []string{"foo"},
+		Storage:       FileStorage,
+		Replicas:      3,
+		MaxIngestRate: &IngestRate{Msgs: 5},
+	})
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+
+	var throttled int
+	for i := 0; i < 10; i++ {
+		rmsg, err := nc.Request("foo", []byte("OK"), time.Second)
+		require_NoError(t, err)
+		var resp JSPubAckResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		if resp.Error != nil {
+			require_True(t, resp.Error.ErrCode == uint16(JSStreamIngestThrottledErr))
+			throttled++
+		}
+	}
+	require_True(t, throttled == 5)
+
+	// Followers should agree on what was stored.
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			if state := mset.state(); state.Msgs != 5 {
+				return fmt.Errorf("expected 5 msgs, got %d", state.Msgs)
+			}
+		}
+		return nil
+	})
+}
+
+func TestJetStreamClusterShardedStream(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	request := func(subj string, req interface{}, resp interface{}) {
+		t.Helper()
+		var b []byte
+		if req != nil {
+			var err error
+			b, err = json.Marshal(req)
+			require_NoError(t, err)
+		}
+		rmsg, err := nc.Request(subj, b, 5*time.Second)
+		require_NoError(t, err)
+		require_NoError(t, json.Unmarshal(rmsg.Data, resp))
+	}
+
+	// Token needs to be a wildcard.
+	var cresp JSApiShardedStreamCreateResponse
+	request(fmt.Sprintf(JSApiShardedStreamCreateT, "ORDERS"), &JSApiShardedStreamCreateRequest{
+		Config: StreamConfig{Subjects: []string{"orders.*"}, Storage: MemoryStorage},
+		Shards: 3,
+		Token:  1,
+	}, &cresp)
+	require_True(t, cresp.Error != nil)
+
+	cresp = JSApiShardedStreamCreateResponse{}
+	request(fmt.Sprintf(JSApiShardedStreamCreateT, "ORDERS"), &JSApiShardedStreamCreateRequest{
+		Config: StreamConfig{Subjects: []string{"orders.*"}, Storage: MemoryStorage},
+		Shards: 3,
+		Token:  2,
+	}, &cresp)
+	if cresp.Error != nil {
+		t.Fatalf("Unexpected error: %v", cresp.Error)
+	}
+	require_True(t, len(cresp.Shards) == 3)
+
+	// A regular stream can still not overlap.
+	_, err := js.AddStream(&nats.StreamConfig{Name: "OTHER", Subjects: []string{"orders.>"}})
+	require_Error(t, err)
+
+	// Nor claim to be a shard to share the subjects.
+	for _, cfg := range []*StreamConfig{
+		{Name: "ROGUE", Shard: &StreamShard{Stream: "ORDERS", Index: 1, Count: 3, Token: 2}},
+		{Name: "ORDERS_5", Shard: &StreamShard{Stream: "ORDERS", Index: 5, Count: 8, Token: 2}},
+		{Name: "ORDERS_3", Shard: &StreamShard{Stream: "ORDERS", Index: 3, Count: 4, Token: 2}},
+	} {
+		cfg.Subjects, cfg.Storage = []string{"orders.*"}, MemoryStorage
+		var scresp JSApiStreamCreateResponse
+		request(fmt.Sprintf(JSApiStreamCreateT, cfg.Name), cfg, &scresp)
+		require_True(t, scresp.Error != nil)
+	}
+	var scresp JSApiStreamCreateResponse
+	request(fmt.Sprintf(JSApiStreamCreateT, "ORDERS_2"), &StreamConfig{
+		Name: "ORDERS_2", Subjects: []string{"orders.>"}, Storage: MemoryStorage,
+		Shard: &StreamShard{Stream: "ORDERS", Index: 2, Count: 3, Token: 2},
+	}, &scresp)
+	require_True(t, scresp.Error != nil)
+
+	// Each message should be stored once, by the shard that owns it.
+	counts := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		subj := fmt.Sprintf("orders.%d", i)
+		pa, err := js.Publish(subj, []byte("OK"))
+		require_NoError(t, err)
+		require_True(t, pa.Stream == shardStreamName("ORDERS", shardIndex(subj, 2, 3)))
+		counts[pa.Stream]++
+	}
+
+	var iresp JSApiShardedStreamInfoResponse
+	request(fmt.Sprintf(JSApiShardedStreamInfoT, "ORDERS"), nil, &iresp)
+	if iresp.Error != nil {
+		t.Fatalf("Unexpected error: %v", iresp.Error)
+	}
+	require_True(t, len(iresp.Shards) == 3)
+	require_True(t, iresp.State.Msgs == 30)
+	for _, si := range iresp.Shards {
+		require_True(t, si.State.Msgs == uint64(counts[si.Config.Name]))
+	}
+
+	// Consumers need to select a single shard.
+	var ccresp JSApiConsumerCreateResponse
+	request(fmt.Sprintf(JSApiShardedConsumerCreateT, "ORDERS"), &CreateConsumerRequest{
+		Stream: "ORDERS",
+		Config: ConsumerConfig{Durable: "d", AckPolicy: AckExplicit, FilterSubject: "orders.*"},
+	}, &ccresp)
+	require_True(t, ccresp.Error != nil && ccresp.Error.ErrCode == uint16(JSConsumerShardFilterErr))
+
+	ccresp = JSApiConsumerCreateResponse{}
+	request(fmt.Sprintf(JSApiShardedConsumerCreateT, "ORDERS"), &CreateConsumerRequest{
+		Stream: "ORDERS",
+		Config: ConsumerConfig{Durable: "d", AckPolicy: AckExplicit, FilterSubject: "orders.22"},
+	}, &ccresp)
+	if ccresp.Error != nil {
+		t.Fatalf("Unexpected error: %v", ccresp.Error)
+	}
+	require_True(t, ccresp.Stream == shardStreamName("ORDERS", shardIndex("orders.22", 2, 3)))
+	require_True(t, ccresp.NumPending == 1)
+
+	var dresp JSApiStreamDeleteResponse
+	request(fmt.Sprintf(JSApiShardedStreamDeleteT, "ORDERS"), nil, &dresp)
+	if dresp.Error != nil {
+		t.Fatalf("Unexpected error: %v", dresp.Error)
+	}
+	require_True(t, dresp.Success)
+
+	names := js.StreamNames()
+	var n int
+	for range names {
+		n++
+	}
+	require_True(t, n == 0)
+}
+
+func TestJetStreamClusterStreamConfigRollback(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3, MaxMsgs: 100})
+	require_NoError(t, err)
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3, MaxMsgs: 10})
+	require_NoError(t, err)
+
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamConfigHistoryT, "TEST"), nil, 5*time.Second)
+	require_NoError(t, err)
+	var hresp JSApiStreamConfigHistoryResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &hresp))
+	if hresp.Error != nil {
+		t.Fatalf("Unexpected error: %v", hresp.Error)
+	}
+	require_True(t, len(hresp.Revisions) == 2)
+	require_True(t, hresp.Revisions[1].Config.MaxMsgs == 10)
+
+	req, err := json.Marshal(&JSApiStreamConfigRollbackRequest{Revision: 1})
+	require_NoError(t, err)
+	rmsg, err = nc.Request(fmt.Sprintf(JSApiStreamConfigRollbackT, "TEST"), req, 5*time.Second)
+	require_NoError(t, err)
+	var uresp JSApiStreamUpdateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &uresp))
+	if uresp.Error != nil {
+		t.Fatalf("Unexpected error: %v", uresp.Error)
+	}
+	require_True(t, uresp.Config.MaxMsgs == 100)
+
+	// All replicas should have recorded the rollback.
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			revs := mset.configRevisions()
+			if len(revs) != 3 || revs[2].Config.MaxMsgs != 100 {
+				return fmt.Errorf("Unexpected revisions on %s: %d", s, len(revs))
+			}
+		}
+		return nil
+	})
+
+	// A restarted replica keeps its revisions.
+	sl := c.streamLeader(globalAccountName, "TEST")
+	sl.Shutdown()
+	sl = c.restartServer(sl)
+	c.waitOnStreamCurrent(sl, globalAccountName, "TEST")
+	mset, err := sl.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	revs := mset.configRevisions()
+	require_True(t, len(revs) == 3)
+	require_True(t, revs[2].Config.MaxMsgs == 100)
+}
+
+func TestJetStreamClusterStreamAsyncReplication(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	cfg := &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, Replicas: 3, Replication: AsyncReplication}
+	req, err := json.Marshal(cfg)
+	require_NoError(t, err)
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "TEST"), req, 5*time.Second)
+	require_NoError(t, err)
+	var cresp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &cresp))
+	if cresp.Error != nil {
+		t.Fatalf("Unexpected error: %v", cresp.Error)
+	}
+	require_True(t, cresp.Config.Replication == AsyncReplication)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+
+	for i := 1; i <= 10; i++ {
+		pa, err := js.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+		require_True(t, pa.Sequence == uint64(i))
+	}
+
+	// All replicas should catch up.
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			if state := mset.state(); state.Msgs != 10 {
+				return fmt.Errorf("expected 10 msgs, got %d", state.Msgs)
+			}
+		}
+		return nil
+	})
+
+	rmsg, err = nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, 5*time.Second)
+	require_NoError(t, err)
+	var iresp JSApiStreamInfoResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &iresp))
+	if iresp.Error != nil {
+		t.Fatalf("Unexpected error: %v", iresp.Error)
+	}
+	require_True(t, iresp.Config.Replication == AsyncReplication)
+	require_True(t, iresp.PubAcks != nil && iresp.PubAcks.Acks == 10)
+
+	// Can switch back to sync replication, acks are then sent once applied.
+	cfg.Replication = SyncReplication
+	req, err = json.Marshal(cfg)
+	require_NoError(t, err)
+	rmsg, err = nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, 5*time.Second)
+	require_NoError(t, err)
+	var uresp JSApiStreamUpdateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &uresp))
+	if uresp.Error != nil {
+		t.Fatalf("Unexpected error: %v", uresp.Error)
+	}
+	require_True(t, uresp.Config.Replication == SyncReplication)
+
+	pa, err := js.Publish("foo", []byte("ok"))
+	require_NoError(t, err)
+	require_True(t, pa.Sequence == 11)
+	mset, err := c.streamLeader(globalAccountName, "TEST").GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_True(t, mset.pubAckStats().Acks == 11)
+}
+
+func TestJetStreamClusterPagedListingsWithLimitAndFilter(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	for i := 0; i < 5; i++ {
+		_, err := js.AddStream(&nats.StreamConfig{Name: fmt.Sprintf("S-%d", i), Subjects: []string{fmt.Sprintf("s.%d", i)}, Replicas: 3})
+		require_NoError(t, err)
+	}
+	for _, filter := range []string{"s.0", "s.0", "s.0", _EMPTY_} {
+		_, err := js.AddConsumer("S-0", &nats.ConsumerConfig{FilterSubject: filter, AckPolicy: nats.AckExplicitPolicy, InactiveThreshold: time.Minute})
+		require_NoError(t, err)
+	}
+
+	request := func(subj string, req, resp interface{}) {
+		t.Helper()
+		b, _ := json.Marshal(req)
+		rmsg, err := nc.Request(subj, b, 5*time.Second)
+		require_NoError(t, err)
+		require_NoError(t, json.Unmarshal(rmsg.Data, resp))
+	}
+
+	var slist JSApiStreamListResponse
+	request(JSApiStreamList, &JSApiStreamListRequest{ApiPagedRequest: ApiPagedRequest{Offset: 1, Limit: 2}}, &slist)
+	require_True(t, slist.Total == 5 && slist.Limit == 2 && len(slist.Streams) == 2)
+	require_True(t, slist.Streams[0].Config.Name == "S-1")
+
+	var cnames JSApiConsumerNamesResponse
+	request(fmt.Sprintf(JSApiConsumersT, "S-0"), &JSApiConsumersRequest{Subject: "s.1"}, &cnames)
+	require_True(t, cnames.Total == 1 && len(cnames.Consumers) == 1)
+
+	// Total is all the consumers, not just the ones in this page.
+	var clist JSApiConsumerListResponse
+	request(fmt.Sprintf(JSApiConsumerListT, "S-0"), &JSApiConsumersRequest{ApiPagedRequest: ApiPagedRequest{Limit: 3}}, &clist)
+	require_True(t, clist.Total == 4 && clist.Limit == 3 && len(clist.Consumers) == 3)
+}
+
+func TestJetStreamClusterConsumerBind(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+
+	create := func(cfg ConsumerConfig, bind bool) *JSApiConsumerCreateResponse {
+		t.Helper()
+		req, _ := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: cfg, Bind: bind})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiConsumerCreateExT, "TEST", cfg.Durable, cfg.FilterSubject), req, 2*time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+
+	cfg := ConsumerConfig{Durable: "dur", AckPolicy: AckExplicit, FilterSubject: "foo", Replicas: 3}
+	resp := create(cfg, true)
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSConsumerNotFoundErr))
+
+	resp = create(cfg, false)
+	require_True(t, resp.Error == nil)
+
+	resp = create(cfg, true)
+	require_True(t, resp.Error == nil && resp.ConsumerInfo != nil)
+
+	cfg.Replicas = 1
+	resp = create(cfg, true)
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSConsumerBindConfigMismatchErr))
+	ci, err := js.ConsumerInfo("TEST", "dur")
+	require_NoError(t, err)
+	require_True(t, ci.Config.Replicas == 3)
+}
+
+func TestJetStreamClusterJszFleetRequest(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "dlc", AckPolicy: nats.AckExplicitPolicy, Replicas: 3})
+	require_NoError(t, err)
+	c.waitOnAllCurrent()
+
+	snc, err := nats.Connect(c.randomServer().ClientURL(), nats.UserInfo("admin", "s3cr3t!"))
+	require_NoError(t, err)
+	defer snc.Close()
+
+	getFleet := func(opts *JszEventOptions) *JszFleet {
+		t.Helper()
+		var req []byte
+		if opts != nil {
+			req, _ = json.Marshal(opts)
+		}
+		rmsg, err := snc.Request(serverJszFleetReqSubj, req, 5*time.Second)
+		require_NoError(t, err)
+		var resp struct {
+			Data  *JszFleet `json:"data"`
+			Error *ApiError `json:"error"`
+		}
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		require_True(t, resp.Error == nil && resp.Data != nil)
+		return resp.Data
+	}
+
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		f := getFleet(nil)
+		if f.Servers != 3 || f.Missing != 0 || len(f.ServerDetails) != 3 {
+			return fmt.Errorf("Expected responses from 3 servers, got %d, missing %d", f.Servers, f.Missing)
+		}
+		// Each replica is counted.
+		if f.Streams != 3 || f.Consumers != 3 || f.Messages != 30 {
+			return fmt.Errorf("Unexpected totals: %+v", f)
+		}
+		for i, r := range f.ServerDetails {
+			if r.Data == nil || r.Data.Disabled {
+				return fmt.Errorf("Expected JetStream info for %+v", r.Server)
+			}
+			if i > 0 && f.ServerDetails[i-1].Server.Name > r.Server.Name {
+				return fmt.Errorf("Expected details to be sorted by server name")
+			}
+		}
+		return nil
+	})
+
+	// Options are passed on to the servers.
+	f := getFleet(&JszEventOptions{
+		JSzOptions:         JSzOptions{Accounts: true, Streams: true},
+		EventFilterOptions: EventFilterOptions{Name: c.servers[0].Name()},
+	})
+	require_True(t, f.Servers == 1 && f.Missing == 0)
+	require_Equal(t, f.ServerDetails[0].Server.Name, c.servers[0].Name())
+	ad := f.ServerDetails[0].Data.AccountDetails
+	require_True(t, len(ad) == 1 && len(ad[0].Streams) == 1)
+}
+
+func TestJetStreamClusterConsumerTemplates(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	cfg := &StreamConfig{
+		Name:     "ORDERS",
+		Subjects: []string{"orders.>"},
+		Storage:  FileStorage,
+		Replicas: 3,
+		ConsumerTemplates: map[string]ConsumerConfig{
+			"worker": {Durable: "{{team}}", FilterSubject: "orders.{{region}}", AckPolicy: AckExplicit, Replicas: 3},
+		},
+	}
+	req, _ := json.Marshal(cfg)
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, cfg.Name), req, 5*time.Second)
+	require_NoError(t, err)
+	var scResp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &scResp))
+	require_True(t, scResp.Error == nil)
+
+	req, _ = json.Marshal(&JSApiConsumerTemplateCreateRequest{Params: map[string]string{"team": "billing", "region": "eu"}})
+	rmsg, err = nc.Request(fmt.Sprintf(JSApiConsumerTemplateCreateT, "ORDERS", "worker"), req, 5*time.Second)
+	require_NoError(t, err)
+	var resp JSApiConsumerCreateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Config.Durable == "billing" && resp.Config.FilterSubject == "orders.eu")
+
+	c.waitOnConsumerLeader(globalAccountName, "ORDERS", "billing")
+	ci, err := js.ConsumerInfo("ORDERS", "billing")
+	require_NoError(t, err)
+	require_True(t, ci.Config.Replicas == 3 && ci.Cluster != nil && len(ci.Cluster.Replicas) == 2)
+
+	rmsg, err = nc.Request(fmt.Sprintf(JSApiConsumerTemplateCreateT, "ORDERS", "worker"), req, 5*time.Second)
+	require_NoError(t, err)
+	resp = JSApiConsumerCreateResponse{}
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSConsumerNameExistErr))
+
+	rmsg, err = nc.Request(fmt.Sprintf(JSApiConsumerTemplateCreateT, "ORDERS", "missing"), req, 5*time.Second)
+	require_NoError(t, err)
+	resp = JSApiConsumerCreateResponse{}
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSConsumerTemplateNotFoundErr))
+}
+
+func TestJetStreamClusterMsgTimeClockSkew(t *testing.T) {
+	tmpl := strings.Replace(jsClusterTempl, "store_dir:", "clock_skew: {max: 1h}, store_dir:", 1)
+	c := createJetStreamClusterWithTemplate(t, tmpl, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+
+	created := time.Now().Add(-10 * time.Minute).Round(time.Millisecond)
+	for _, mt := range []time.Time{created, created.Add(-time.Minute)} {
+		m := nats.NewMsg("foo")
+		m.Header.Set(JSMsgTime, mt.Format(time.RFC3339Nano))
+		_, err = js.PublishMsg(m)
+		require_NoError(t, err)
+	}
+	c.waitOnStreamCurrent(c.streamLeader(globalAccountName, "TEST"), globalAccountName, "TEST")
+
+	// All replicas store the time of the publisher, which never goes back.
+	for _, s := range c.servers {
+		mset, err := s.GlobalAccount().lookupStream("TEST")
+		require_NoError(t, err)
+		checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+			for seq := uint64(1); seq <= 2; seq++ {
+				sm, err := mset.getMsg(seq)
+				if err != nil {
+					return err
+				}
+				if !sm.Time.Equal(created) {
+					return fmt.Errorf("expected msg %d on %s to have time %v, got %v", seq, s, created, sm.Time)
+				}
+			}
+			return nil
+		})
+	}
+}
+
+func TestJetStreamClusterAdminAuditTrail(t *testing.T) {
+	tmpl := strings.Replace(jsClusterAccountsTempl, "store_dir: '%s'}", "store_dir: '%s', audit: true}", 1)
+	c := createJetStreamClusterWithTemplate(t, tmpl, "R3S", 3)
+	defer c.shutdown()
+
+	c.waitOnStreamLeader(DEFAULT_SYSTEM_ACCOUNT, JSAdminAuditStream)
+
+	ncsys, jsys := jsClientConnect(t, c.randomServer(), nats.UserInfo("admin", "s3cr3t!"))
+	defer ncsys.Close()
+
+	si, err := jsys.StreamInfo(JSAdminAuditStream)
+	require_NoError(t, err)
+	require_True(t, si.Config.Replicas == 3)
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err = js.AddStream(&nats.StreamConfig{Name: "TEST", Replicas: 3})
+	require_NoError(t, err)
+
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		si, err := jsys.StreamInfo(JSAdminAuditStream)
+		if err != nil {
+			return err
+		}
+		if si.State.Msgs != 1 {
+			return fmt.Errorf("expected 1 entry, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+	m, err := jsys.GetMsg(JSAdminAuditStream, 1)
+	require_NoError(t, err)
+	require_True(t, m.Subject == fmt.Sprintf(JSAdminAuditT, "ONE"))
+	var entry JSAdminAudit
+	require_NoError(t, json.Unmarshal(m.Data, &entry))
+	require_True(t, entry.Subject == fmt.Sprintf(JSApiStreamCreateT, "TEST"))
+}
+
+func TestJetStreamClusterConsumerStartConsumerSeq(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+	require_NoError(t, err)
+	for i := 0; i < 20; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	sub, err := js.PullSubscribe("foo", "D", nats.AckExplicit())
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+	c.waitOnConsumerLeader(globalAccountName, "TEST", "D")
+
+	ci, err := js.ConsumerInfo("TEST", "D")
+	require_NoError(t, err)
+	b, _ := json.Marshal(ci.Config)
+	var cfg ConsumerConfig
+	require_NoError(t, json.Unmarshal(b, &cfg))
+
+	fetch := func(n int) []*nats.MsgMetadata {
+		t.Helper()
+		msgs, err := sub.Fetch(n, nats.MaxWait(2*time.Second))
+		require_NoError(t, err)
+		require_True(t, len(msgs) == n)
+		var mds []*nats.MsgMetadata
+		for _, m := range msgs {
+			md, err := m.Metadata()
+			require_NoError(t, err)
+			mds = append(mds, md)
+		}
+		return mds
+	}
+
+	// Ack 1 and 2 and leave 3, 4 and 5 pending.
+	for _, md := range fetch(2) {
+		_, err := nc.Request(fmt.Sprintf("$JS.ACK.TEST.D.1.%d.%d.0.0", md.Sequence.Stream, md.Sequence.Consumer), nil, time.Second)
+		require_NoError(t, err)
+	}
+	fetch(3)
+
+	// Rewind to our ack floor, which means all is delivered again.
+	cfg.OptStartConsumerSeq = 2
+	req, _ := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: cfg})
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", "D"), req, 2*time.Second)
+	require_NoError(t, err)
+	var resp JSApiConsumerCreateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	require_True(t, resp.Error == nil)
+
+	// All replicas have the same state once the move was replicated.
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.GlobalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			o := mset.lookupConsumer("D")
+			if o == nil {
+				return fmt.Errorf("consumer not found on %s", s)
+			}
+			state, err := o.store.State()
+			if err != nil {
+				return err
+			}
+			if state.Delivered.Stream != 1 || state.AckFloor.Stream != 1 || len(state.Pending) != 0 {
+				return fmt.Errorf("unexpected state on %s: %+v", s, state)
+			}
+		}
+		return nil
+	})
+
+	// So a new leader continues from there.
+	rmsg, err = nc.Request(fmt.Sprintf(JSApiConsumerLeaderStepDownT, "TEST", "D"), nil, time.Second)
+	require_NoError(t, err)
+	var sdResp JSApiConsumerLeaderStepDownResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &sdResp))
+	require_True(t, sdResp.Error == nil)
+	c.waitOnConsumerLeader(globalAccountName, "TEST", "D")
+
+	md := fetch(1)[0]
+	require_True(t, md.Sequence.Stream == 2)
+	require_True(t, md.Sequence.Consumer == 6)
+}
+
+func TestJetStreamClusterStreamAggregate(t *testing.T) {
+	tmpl := strings.Replace(jsClusterAccountsTempl, "store_dir:", "aggregate_account: ONE, store_dir:", 1)
+	tmpl = strings.Replace(tmpl, `TWO { users = [ { user: "two", pass: "p" } ]; jetstream: enabled }`,
+		`TWO { users = [ { user: "two", pass: "p" } ]; jetstream: enabled; aggregate: {subjects: "orders.>"} }`, 1)
+	c := createJetStreamClusterWithTemplate(t, tmpl, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer(), nats.UserInfo("one", "p"))
+	defer nc.Close()
+
+	cfg := &StreamConfig{Name: "AGG", Subjects: []string{"agg"}, Replicas: 3, Storage: FileStorage, Aggregate: &StreamAggregate{}}
+	req, err := json.Marshal(cfg)
+	require_NoError(t, err)
+	resp, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "AGG"), req, time.Second)
+	require_NoError(t, err)
+	var scResp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &scResp))
+	require_True(t, scResp.Error == nil)
+	c.waitOnStreamLeader("ONE", "AGG")
+
+	_, err = js.AddConsumer("AGG", &nats.ConsumerConfig{Durable: "ORDERS", FilterSubject: "TWO.orders.>"})
+	require_NoError(t, err)
+
+	checkCaptured := func(n uint64) {
+		t.Helper()
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			for _, s := range c.servers {
+				acc, err := s.LookupAccount("ONE")
+				if err != nil {
+					return err
+				}
+				mset, err := acc.lookupStream("AGG")
+				if err != nil {
+					return err
+				}
+				if state := mset.state(); state.Msgs != n {
+					return fmt.Errorf("expected %d messages on %s, got %d", n, s, state.Msgs)
+				}
+			}
+			return nil
+		})
+	}
+
+	// Only the leader captures, and the messages are replicated.
+	sl := c.streamLeader("ONE", "AGG")
+	s := c.randomNonStreamLeader("ONE", "AGG")
+	checkSubInterest(t, s, "TWO", "orders.1", time.Second)
+	nc2 := natsConnect(t, s.ClientURL(), nats.UserInfo("two", "p"))
+	defer nc2.Close()
+	natsPub(t, nc2, "orders.1", []byte("order"))
+	checkCaptured(1)
+
+	// The new leader captures after a leader change.
+	_, err = nc.Request(fmt.Sprintf(JSApiStreamLeaderStepDownT, "AGG"), nil, time.Second)
+	require_NoError(t, err)
+	c.waitOnStreamLeader("ONE", "AGG")
+	require_True(t, c.streamLeader("ONE", "AGG") != sl)
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			acc, err := s.LookupAccount("ONE")
+			if err != nil {
+				return err
+			}
+			mset, err := acc.lookupStream("AGG")
+			if err != nil {
+				return err
+			}
+			mset.mu.RLock()
+			capturing := mset.aggregate != nil
+			mset.mu.RUnlock()
+			if capturing != mset.isLeader() {
+				return fmt.Errorf("expected only the leader to capture on %s", s)
+			}
+		}
+		return nil
+	})
+	nc3 := natsConnect(t, c.streamLeader("ONE", "AGG").ClientURL(), nats.UserInfo("two", "p"))
+	defer nc3.Close()
+	natsPub(t, nc3, "orders.2", []byte("order"))
+	checkCaptured(2)
+
+	ci, err := js.ConsumerInfo("AGG", "ORDERS")
+	require_NoError(t, err)
+	require_True(t, ci.NumPending == 2)
+}
+
+func TestJetStreamClusterStreamPinnedMsgs(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	cfg := &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, Replicas: 3, MaxPinned: 3}
+	b, _ := json.Marshal(cfg)
+	_, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "TEST"), b, time.Second)
+	require_NoError(t, err)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+
+	for i := 0; i < 3; i++ {
+		_, err = js.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+	}
+
+	// Pin updates sent at the same time do not lose each other's changes.
+	var wg sync.WaitGroup
+	for seq := uint64(1); seq <= 3; seq++ {
+		wg.Add(1)
+		go func(seq uint64) {
+			defer wg.Done()
+			b, _ := json.Marshal(&JSApiMsgPinRequest{Seq: seq})
+			rmsg, err := nc.Request(fmt.Sprintf(JSApiMsgPinT, "TEST"), b, 5*time.Second)
+			require_NoError(t, err)
+			var resp JSApiStreamUpdateResponse
+			require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+			require_True(t, resp.Error == nil)
+		}(seq)
+	}
+	wg.Wait()
+
+	checkPinned := func(n int) {
+		t.Helper()
+		checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+			for _, s := range c.servers {
+				mset, err := s.GlobalAccount().lookupStream("TEST")
+				if err != nil {
+					return err
+				}
+				if pinned := mset.config().Pinned; len(pinned) != n {
+					return fmt.Errorf("expected %d pins on %s, got %v", n, s, pinned)
+				}
+			}
+			return nil
+		})
+	}
+	checkPinned(3)
+
+	// Regular updates keep the pins.
+	cfg.MaxMsgs = 10
+	b, _ = json.Marshal(cfg)
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), b, time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamUpdateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	require_True(t, resp.Error == nil)
+	checkPinned(3)
+
+	// Removed messages are unpinned.
+	require_NoError(t, js.DeleteMsg("TEST", 2))
+	checkPinned(2)
+	require_NoError(t, js.PurgeStream("TEST"))
+	checkPinned(0)
+}
+
+func TestJetStreamClusterConsumerDeliverGroupHashNotSupported(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"orders.*"}, Replicas: 3})
+	require_NoError(t, err)
+
+	req, _ := json.Marshal(&CreateConsumerRequest{
+		Stream: "TEST",
+		Config: ConsumerConfig{Durable: "dlc", DeliverSubject: "d", DeliverGroup: "q", DeliverGroupHashToken: 2, AckPolicy: AckExplicit},
+	})
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", "dlc"), req, time.Second)
+	require_NoError(t, err)
+	var resp JSApiConsumerCreateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSConsumerInvalidDeliverGroupHashErr))
+}
+
+func TestJetStreamClusterStreamStoreDirNotSupported(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, _ := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	req, _ := json.Marshal(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, Replicas: 3, StoreDir: "fast"})
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSStreamInvalidConfigF))
+}
@@ -5,6 +5,9 @@ package server
 import "strings"
 
 const (
+	// JSAccountReadOnlyErr jetstream is disabled for account, stored data is read only
+	JSAccountReadOnlyErr ErrorIdentifier = 10141
+
 	// JSAccountResourcesExceededErr resource limits exceeded for account
 	JSAccountResourcesExceededErr ErrorIdentifier = 10002
 
@@ -44,9 +47,15 @@ const (
 	// JSClusterUnSupportFeatureErr not currently supported in clustered mode
 	JSClusterUnSupportFeatureErr ErrorIdentifier = 10036
 
+	// JSConsumerAttachedErr consumer is attached to another client
+	JSConsumerAttachedErr ErrorIdentifier = 10158
+
 	// JSConsumerBadDurableNameErr durable name can not contain '.', '*', '>'
 	JSConsumerBadDurableNameErr ErrorIdentifier = 10103
 
+	// JSConsumerBindConfigMismatchErr consumer config does not match the existing consumer
+	JSConsumerBindConfigMismatchErr ErrorIdentifier = 10151
+
 	// JSConsumerConfigRequiredErr consumer config required
 	JSConsumerConfigRequiredErr ErrorIdentifier = 10078
 
@@ -101,15 +110,45 @@ const (
 	// JSConsumerHBRequiresPushErr consumer idle heartbeat requires a push based consumer
 	JSConsumerHBRequiresPushErr ErrorIdentifier = 10088
 
+	// JSConsumerInvalidDeliverCopiesErr {err}
+	JSConsumerInvalidDeliverCopiesErr ErrorIdentifier = 10146
+
+	// JSConsumerInvalidDeliverGroupHashErr {err}
+	JSConsumerInvalidDeliverGroupHashErr ErrorIdentifier = 10145
+
+	// JSConsumerInvalidDeliverQueueErr {err}
+	JSConsumerInvalidDeliverQueueErr ErrorIdentifier = 10144
+
 	// JSConsumerInvalidDeliverSubject invalid push consumer deliver subject
 	JSConsumerInvalidDeliverSubject ErrorIdentifier = 10112
 
+	// JSConsumerInvalidDeliverTransformErr {err}
+	JSConsumerInvalidDeliverTransformErr ErrorIdentifier = 10147
+
+	// JSConsumerInvalidExclusiveErr {err}
+	JSConsumerInvalidExclusiveErr ErrorIdentifier = 10156
+
+	// JSConsumerInvalidOrderedErr {err}
+	JSConsumerInvalidOrderedErr ErrorIdentifier = 10138
+
+	// JSConsumerInvalidPendingMemoryErr {err}
+	JSConsumerInvalidPendingMemoryErr ErrorIdentifier = 10148
+
 	// JSConsumerInvalidPolicyErrF Generic delivery policy error ({err})
 	JSConsumerInvalidPolicyErrF ErrorIdentifier = 10094
 
+	// JSConsumerInvalidReplaySpeedErr {err}
+	JSConsumerInvalidReplaySpeedErr ErrorIdentifier = 10143
+
 	// JSConsumerInvalidSamplingErrF failed to parse consumer sampling configuration: {err}
 	JSConsumerInvalidSamplingErrF ErrorIdentifier = 10095
 
+	// JSConsumerInvalidStartConsumerSeqErr {err}
+	JSConsumerInvalidStartConsumerSeqErr ErrorIdentifier = 10149
+
+	// JSConsumerInvalidWebhookErr {err}
+	JSConsumerInvalidWebhookErr ErrorIdentifier = 10136
+
 	// JSConsumerMaxDeliverBackoffErr max deliver is required to be > length of backoff values
 	JSConsumerMaxDeliverBackoffErr ErrorIdentifier = 10116
 
@@ -128,6 +167,12 @@ const (
 	// JSConsumerMaxRequestExpiresToSmall consumer max request expires needs to be >= 1ms
 	JSConsumerMaxRequestExpiresToSmall ErrorIdentifier = 10115
 
+	// JSConsumerMaxRequestMaxBytesExceededF consumer max request max bytes exceeds server limit of {limit}
+	JSConsumerMaxRequestMaxBytesExceededF ErrorIdentifier = 10155
+
+	// JSConsumerMaxRequestMaxBytesNegativeErr consumer max request max bytes needs to be >= 0
+	JSConsumerMaxRequestMaxBytesNegativeErr ErrorIdentifier = 10154
+
 	// JSConsumerMaxWaitingNegativeErr consumer max waiting needs to be positive
 	JSConsumerMaxWaitingNegativeErr ErrorIdentifier = 10087
 
@@ -140,6 +185,9 @@ const (
 	// JSConsumerNameTooLongErrF consumer name is too long, maximum allowed is {max}
 	JSConsumerNameTooLongErrF ErrorIdentifier = 10102
 
+	// JSConsumerNotExclusiveErr consumer is not exclusive
+	JSConsumerNotExclusiveErr ErrorIdentifier = 10157
+
 	// JSConsumerNotFoundErr consumer not found
 	JSConsumerNotFoundErr ErrorIdentifier = 10014
 
@@ -170,12 +218,21 @@ const (
 	// JSConsumerReplicasShouldMatchStream consumer config replicas must match interest retention stream's replicas
 	JSConsumerReplicasShouldMatchStream ErrorIdentifier = 10134
 
+	// JSConsumerShardFilterErr consumer filter subject must select a single shard
+	JSConsumerShardFilterErr ErrorIdentifier = 10140
+
 	// JSConsumerSmallHeartbeatErr consumer idle heartbeat needs to be >= 100ms
 	JSConsumerSmallHeartbeatErr ErrorIdentifier = 10083
 
 	// JSConsumerStoreFailedErrF error creating store for consumer: {err}
 	JSConsumerStoreFailedErrF ErrorIdentifier = 10104
 
+	// JSConsumerTemplateInvalidErrF {err}
+	JSConsumerTemplateInvalidErrF ErrorIdentifier = 10161
+
+	// JSConsumerTemplateNotFoundErr consumer template not found
+	JSConsumerTemplateNotFoundErr ErrorIdentifier = 10160
+
 	// JSConsumerWQConsumerNotDeliverAllErr consumer must be deliver all on workqueue stream
 	JSConsumerWQConsumerNotDeliverAllErr ErrorIdentifier = 10101
 
@@ -272,6 +329,15 @@ const (
 	// JSStreamAssignmentErrF Generic stream assignment error string ({err})
 	JSStreamAssignmentErrF ErrorIdentifier = 10048
 
+	// JSStreamBatchFailedErr batch failed: {err}
+	JSStreamBatchFailedErr ErrorIdentifier = 10137
+
+	// JSStreamChunkedMsgErrF invalid chunked message: {err}
+	JSStreamChunkedMsgErrF ErrorIdentifier = 10152
+
+	// JSStreamConfigRevisionNotFoundErr stream config revision not found
+	JSStreamConfigRevisionNotFoundErr ErrorIdentifier = 10142
+
 	// JSStreamCreateErrF Generic stream creation error string ({err})
 	JSStreamCreateErrF ErrorIdentifier = 10049
 
@@ -284,6 +350,9 @@ const (
 	// JSStreamExternalDelPrefixOverlapsErrF stream external delivery prefix {prefix} overlaps with stream subject {subject}
 	JSStreamExternalDelPrefixOverlapsErrF ErrorIdentifier = 10022
 
+	// JSStreamFailedErrF stream failed after repeated store errors: {err}
+	JSStreamFailedErrF ErrorIdentifier = 10150
+
 	// JSStreamGeneralErrorF General stream failure string ({err})
 	JSStreamGeneralErrorF ErrorIdentifier = 10051
 
@@ -293,6 +362,9 @@ const (
 	// JSStreamInfoMaxSubjectsErr subject details would exceed maximum allowed
 	JSStreamInfoMaxSubjectsErr ErrorIdentifier = 10117
 
+	// JSStreamIngestThrottledErr stream ingest rate exceeded
+	JSStreamIngestThrottledErr ErrorIdentifier = 10135
+
 	// JSStreamInvalidConfigF Stream configuration validation error string ({err})
 	JSStreamInvalidConfigF ErrorIdentifier = 10052
 
@@ -332,6 +404,15 @@ const (
 	// JSStreamMsgDeleteFailedF Generic message deletion failure error string ({err})
 	JSStreamMsgDeleteFailedF ErrorIdentifier = 10057
 
+	// JSStreamMsgInvalidErr message failed validation: {err}
+	JSStreamMsgInvalidErr ErrorIdentifier = 10139
+
+	// JSStreamMsgTimeInvalidErr message timestamp is invalid
+	JSStreamMsgTimeInvalidErr ErrorIdentifier = 10168
+
+	// JSStreamMsgTimeSkewedErrF message timestamp is skewed by {skew}
+	JSStreamMsgTimeSkewedErrF ErrorIdentifier = 10167
+
 	// JSStreamNameContainsPathSeparatorsErr Stream name can not contain path separators
 	JSStreamNameContainsPathSeparatorsErr ErrorIdentifier = 10128
 
@@ -341,18 +422,30 @@ const (
 	// JSStreamNameExistRestoreFailedErr stream name already in use, cannot restore
 	JSStreamNameExistRestoreFailedErr ErrorIdentifier = 10130
 
+	// JSStreamNoHeaderIndexErr stream has no header index
+	JSStreamNoHeaderIndexErr ErrorIdentifier = 10159
+
 	// JSStreamNotFoundErr stream not found
 	JSStreamNotFoundErr ErrorIdentifier = 10059
 
 	// JSStreamNotMatchErr expected stream does not match
 	JSStreamNotMatchErr ErrorIdentifier = 10060
 
+	// JSStreamNotSingleWriterErr stream is not single writer
+	JSStreamNotSingleWriterErr ErrorIdentifier = 10162
+
 	// JSStreamOfflineErr stream is offline
 	JSStreamOfflineErr ErrorIdentifier = 10118
 
+	// JSStreamPartitionsErrF stream partitions: {err}
+	JSStreamPartitionsErrF ErrorIdentifier = 10153
+
 	// JSStreamPurgeFailedF Generic stream purge failure error string ({err})
 	JSStreamPurgeFailedF ErrorIdentifier = 10110
 
+	// JSStreamRelocateErrF stream relocation failed: {err}
+	JSStreamRelocateErrF ErrorIdentifier = 10166
+
 	// JSStreamReplicasNotSupportedErr replicas > 1 not supported in non-clustered mode
 	JSStreamReplicasNotSupportedErr ErrorIdentifier = 10074
 
@@ -374,6 +467,12 @@ const (
 	// JSStreamSnapshotErrF snapshot failed: {err}
 	JSStreamSnapshotErrF ErrorIdentifier = 10064
 
+	// JSStreamStatsHistoryDisabledErr stream stats history is not enabled
+	JSStreamStatsHistoryDisabledErr ErrorIdentifier = 10169
+
+	// JSStreamStoreDirNotFoundErr store directory not found
+	JSStreamStoreDirNotFoundErr ErrorIdentifier = 10165
+
 	// JSStreamStoreFailedF Generic error when storing a message failed ({err})
 	JSStreamStoreFailedF ErrorIdentifier = 10077
 
@@ -392,6 +491,12 @@ const (
 	// JSStreamUpdateErrF Generic stream update error string ({err})
 	JSStreamUpdateErrF ErrorIdentifier = 10069
 
+	// JSStreamWriterActiveErr stream has an active writer
+	JSStreamWriterActiveErr ErrorIdentifier = 10163
+
+	// JSStreamWriterFencedErr writer fence missing or invalid
+	JSStreamWriterFencedErr ErrorIdentifier = 10164
+
 	// JSStreamWrongLastMsgIDErrF wrong last msg ID: {id}
 	JSStreamWrongLastMsgIDErrF ErrorIdentifier = 10070
 
@@ -407,6 +512,7 @@ const (
 
 var (
 	ApiErrors = map[ErrorIdentifier]*ApiError{
+		JSAccountReadOnlyErr:                       {Code: 503, ErrCode: 10141, Description: "jetstream is disabled for account, stored data is read only"},
 		JSAccountResourcesExceededErr:              {Code: 400, ErrCode: 10002, Description: "resource limits exceeded for account"},
 		JSBadRequestErr:                            {Code: 400, ErrCode: 10003, Description: "bad request"},
 		JSClusterIncompleteErr:                     {Code: 503, ErrCode: 10004, Description: "incomplete results"},
@@ -420,7 +526,9 @@ var (
 		JSClusterServerNotMemberErr:                {Code: 400, ErrCode: 10044, Description: "server is not a member of the cluster"},
 		JSClusterTagsErr:                           {Code: 400, ErrCode: 10011, Description: "tags placement not supported for operation"},
 		JSClusterUnSupportFeatureErr:               {Code: 503, ErrCode: 10036, Description: "not currently supported in clustered mode"},
+		JSConsumerAttachedErr:                      {Code: 400, ErrCode: 10158, Description: "consumer is attached to another client"},
 		JSConsumerBadDurableNameErr:                {Code: 400, ErrCode: 10103, Description: "durable name can not contain '.', '*', '>'"},
+		JSConsumerBindConfigMismatchErr:            {Code: 400, ErrCode: 10151, Description: "consumer config does not match the existing consumer"},
 		JSConsumerConfigRequiredErr:                {Code: 400, ErrCode: 10078, Description: "consumer config required"},
 		JSConsumerCreateDurableAndNameMismatch:     {Code: 400, ErrCode: 10132, Description: "Consumer Durable and Name have to be equal if both are provided"},
 		JSConsumerCreateErrF:                       {Code: 500, ErrCode: 10012, Description: "{err}"},
@@ -439,19 +547,32 @@ var (
 		JSConsumerFCRequiresPushErr:                {Code: 400, ErrCode: 10089, Description: "consumer flow control requires a push based consumer"},
 		JSConsumerFilterNotSubsetErr:               {Code: 400, ErrCode: 10093, Description: "consumer filter subject is not a valid subset of the interest subjects"},
 		JSConsumerHBRequiresPushErr:                {Code: 400, ErrCode: 10088, Description: "consumer idle heartbeat requires a push based consumer"},
+		JSConsumerInvalidDeliverCopiesErr:          {Code: 400, ErrCode: 10146, Description: "{err}"},
+		JSConsumerInvalidDeliverGroupHashErr:       {Code: 400, ErrCode: 10145, Description: "{err}"},
+		JSConsumerInvalidDeliverQueueErr:           {Code: 400, ErrCode: 10144, Description: "{err}"},
 		JSConsumerInvalidDeliverSubject:            {Code: 400, ErrCode: 10112, Description: "invalid push consumer deliver subject"},
+		JSConsumerInvalidDeliverTransformErr:       {Code: 400, ErrCode: 10147, Description: "{err}"},
+		JSConsumerInvalidExclusiveErr:              {Code: 400, ErrCode: 10156, Description: "{err}"},
+		JSConsumerInvalidOrderedErr:                {Code: 400, ErrCode: 10138, Description: "{err}"},
+		JSConsumerInvalidPendingMemoryErr:          {Code: 400, ErrCode: 10148, Description: "{err}"},
 		JSConsumerInvalidPolicyErrF:                {Code: 400, ErrCode: 10094, Description: "{err}"},
+		JSConsumerInvalidReplaySpeedErr:            {Code: 400, ErrCode: 10143, Description: "{err}"},
 		JSConsumerInvalidSamplingErrF:              {Code: 400, ErrCode: 10095, Description: "failed to parse consumer sampling configuration: {err}"},
+		JSConsumerInvalidStartConsumerSeqErr:       {Code: 400, ErrCode: 10149, Description: "{err}"},
+		JSConsumerInvalidWebhookErr:                {Code: 400, ErrCode: 10136, Description: "{err}"},
 		JSConsumerMaxDeliverBackoffErr:             {Code: 400, ErrCode: 10116, Description: "max deliver is required to be > length of backoff values"},
 		JSConsumerMaxPendingAckExcessErrF:          {Code: 400, ErrCode: 10121, Description: "consumer max ack pending exceeds system limit of {limit}"},
 		JSConsumerMaxPendingAckPolicyRequiredErr:   {Code: 400, ErrCode: 10082, Description: "consumer requires ack policy for max ack pending"},
 		JSConsumerMaxRequestBatchExceededF:         {Code: 400, ErrCode: 10125, Description: "consumer max request batch exceeds server limit of {limit}"},
 		JSConsumerMaxRequestBatchNegativeErr:       {Code: 400, ErrCode: 10114, Description: "consumer max request batch needs to be > 0"},
 		JSConsumerMaxRequestExpiresToSmall:         {Code: 400, ErrCode: 10115, Description: "consumer max request expires needs to be >= 1ms"},
+		JSConsumerMaxRequestMaxBytesExceededF:      {Code: 400, ErrCode: 10155, Description: "consumer max request max bytes exceeds server limit of {limit}"},
+		JSConsumerMaxRequestMaxBytesNegativeErr:    {Code: 400, ErrCode: 10154, Description: "consumer max request max bytes needs to be >= 0"},
 		JSConsumerMaxWaitingNegativeErr:            {Code: 400, ErrCode: 10087, Description: "consumer max waiting needs to be positive"},
 		JSConsumerNameContainsPathSeparatorsErr:    {Code: 400, ErrCode: 10127, Description: "Consumer name can not contain path separators"},
 		JSConsumerNameExistErr:                     {Code: 400, ErrCode: 10013, Description: "consumer name already in use"},
 		JSConsumerNameTooLongErrF:                  {Code: 400, ErrCode: 10102, Description: "consumer name is too long, maximum allowed is {max}"},
+		JSConsumerNotExclusiveErr:                  {Code: 400, ErrCode: 10157, Description: "consumer is not exclusive"},
 		JSConsumerNotFoundErr:                      {Code: 404, ErrCode: 10014, Description: "consumer not found"},
 		JSConsumerOfflineErr:                       {Code: 500, ErrCode: 10119, Description: "consumer is offline"},
 		JSConsumerOnMappedErr:                      {Code: 400, ErrCode: 10092, Description: "consumer direct on a mapped consumer"},
@@ -462,8 +583,11 @@ var (
 		JSConsumerReplacementWithDifferentNameErr:  {Code: 400, ErrCode: 10106, Description: "consumer replacement durable config not the same"},
 		JSConsumerReplicasExceedsStream:            {Code: 400, ErrCode: 10126, Description: "consumer config replica count exceeds parent stream"},
 		JSConsumerReplicasShouldMatchStream:        {Code: 400, ErrCode: 10134, Description: "consumer config replicas must match interest retention stream's replicas"},
+		JSConsumerShardFilterErr:                   {Code: 400, ErrCode: 10140, Description: "consumer filter subject must select a single shard"},
 		JSConsumerSmallHeartbeatErr:                {Code: 400, ErrCode: 10083, Description: "consumer idle heartbeat needs to be >= 100ms"},
 		JSConsumerStoreFailedErrF:                  {Code: 500, ErrCode: 10104, Description: "error creating store for consumer: {err}"},
+		JSConsumerTemplateInvalidErrF:              {Code: 400, ErrCode: 10161, Description: "{err}"},
+		JSConsumerTemplateNotFoundErr:              {Code: 404, ErrCode: 10160, Description: "consumer template not found"},
 		JSConsumerWQConsumerNotDeliverAllErr:       {Code: 400, ErrCode: 10101, Description: "consumer must be deliver all on workqueue stream"},
 		JSConsumerWQConsumerNotUniqueErr:           {Code: 400, ErrCode: 10100, Description: "filtered consumer not unique on workqueue stream"},
 		JSConsumerWQMultipleUnfilteredErr:          {Code: 400, ErrCode: 10099, Description: "multiple non-filtered consumers not allowed on workqueue stream"},
@@ -496,13 +620,18 @@ var (
 		JSSourceMaxMessageSizeTooBigErr:            {Code: 400, ErrCode: 10046, Description: "stream source must have max message size >= target"},
 		JSStorageResourcesExceededErr:              {Code: 500, ErrCode: 10047, Description: "insufficient storage resources available"},
 		JSStreamAssignmentErrF:                     {Code: 500, ErrCode: 10048, Description: "{err}"},
+		JSStreamBatchFailedErr:                     {Code: 400, ErrCode: 10137, Description: "batch failed: {err}"},
+		JSStreamChunkedMsgErrF:                     {Code: 400, ErrCode: 10152, Description: "invalid chunked message: {err}"},
+		JSStreamConfigRevisionNotFoundErr:          {Code: 404, ErrCode: 10142, Description: "stream config revision not found"},
 		JSStreamCreateErrF:                         {Code: 500, ErrCode: 10049, Description: "{err}"},
 		JSStreamDeleteErrF:                         {Code: 500, ErrCode: 10050, Description: "{err}"},
 		JSStreamExternalApiOverlapErrF:             {Code: 400, ErrCode: 10021, Description: "stream external api prefix {prefix} must not overlap with {subject}"},
 		JSStreamExternalDelPrefixOverlapsErrF:      {Code: 400, ErrCode: 10022, Description: "stream external delivery prefix {prefix} overlaps with stream subject {subject}"},
+		JSStreamFailedErrF:                         {Code: 503, ErrCode: 10150, Description: "stream failed after repeated store errors: {err}"},
 		JSStreamGeneralErrorF:                      {Code: 500, ErrCode: 10051, Description: "{err}"},
 		JSStreamHeaderExceedsMaximumErr:            {Code: 400, ErrCode: 10097, Description: "header size exceeds maximum allowed of 64k"},
 		JSStreamInfoMaxSubjectsErr:                 {Code: 500, ErrCode: 10117, Description: "subject details would exceed maximum allowed"},
+		JSStreamIngestThrottledErr:                 {Code: 429, ErrCode: 10135, Description: "stream ingest rate exceeded"},
 		JSStreamInvalidConfigF:                     {Code: 500, ErrCode: 10052, Description: "{err}"},
 		JSStreamInvalidErr:                         {Code: 500, ErrCode: 10096, Description: "stream not valid"},
 		JSStreamInvalidExternalDeliverySubjErrF:    {Code: 400, ErrCode: 10024, Description: "stream external delivery prefix {prefix} must not contain wildcards"},
@@ -516,13 +645,20 @@ var (
 		JSStreamMoveInProgressF:                    {Code: 400, ErrCode: 10124, Description: "stream move already in progress: {msg}"},
 		JSStreamMoveNotInProgress:                  {Code: 400, ErrCode: 10129, Description: "stream move not in progress"},
 		JSStreamMsgDeleteFailedF:                   {Code: 500, ErrCode: 10057, Description: "{err}"},
+		JSStreamMsgInvalidErr:                      {Code: 400, ErrCode: 10139, Description: "message failed validation: {err}"},
+		JSStreamMsgTimeInvalidErr:                  {Code: 400, ErrCode: 10168, Description: "message timestamp is invalid"},
+		JSStreamMsgTimeSkewedErrF:                  {Code: 400, ErrCode: 10167, Description: "message timestamp is skewed by {skew}"},
 		JSStreamNameContainsPathSeparatorsErr:      {Code: 400, ErrCode: 10128, Description: "Stream name can not contain path separators"},
 		JSStreamNameExistErr:                       {Code: 400, ErrCode: 10058, Description: "stream name already in use with a different configuration"},
 		JSStreamNameExistRestoreFailedErr:          {Code: 400, ErrCode: 10130, Description: "stream name already in use, cannot restore"},
+		JSStreamNoHeaderIndexErr:                   {Code: 400, ErrCode: 10159, Description: "stream has no header index"},
 		JSStreamNotFoundErr:                        {Code: 404, ErrCode: 10059, Description: "stream not found"},
 		JSStreamNotMatchErr:                        {Code: 400, ErrCode: 10060, Description: "expected stream does not match"},
+		JSStreamNotSingleWriterErr:                 {Code: 400, ErrCode: 10162, Description: "stream is not single writer"},
 		JSStreamOfflineErr:                         {Code: 500, ErrCode: 10118, Description: "stream is offline"},
+		JSStreamPartitionsErrF:                     {Code: 400, ErrCode: 10153, Description: "stream partitions: {err}"},
 		JSStreamPurgeFailedF:                       {Code: 500, ErrCode: 10110, Description: "{err}"},
+		JSStreamRelocateErrF:                       {Code: 400, ErrCode: 10166, Description: "stream relocation failed: {err}"},
 		JSStreamReplicasNotSupportedErr:            {Code: 500, ErrCode: 10074, Description: "replicas > 1 not supported in non-clustered mode"},
 		JSStreamReplicasNotUpdatableErr:            {Code: 400, ErrCode: 10061, Description: "Replicas configuration can not be updated"},
 		JSStreamRestoreErrF:                        {Code: 500, ErrCode: 10062, Description: "restore failed: {err}"},
@@ -530,12 +666,16 @@ var (
 		JSStreamSealedErr:                          {Code: 400, ErrCode: 10109, Description: "invalid operation on sealed stream"},
 		JSStreamSequenceNotMatchErr:                {Code: 503, ErrCode: 10063, Description: "expected stream sequence does not match"},
 		JSStreamSnapshotErrF:                       {Code: 500, ErrCode: 10064, Description: "snapshot failed: {err}"},
+		JSStreamStatsHistoryDisabledErr:            {Code: 400, ErrCode: 10169, Description: "stream stats history is not enabled"},
+		JSStreamStoreDirNotFoundErr:                {Code: 400, ErrCode: 10165, Description: "store directory not found"},
 		JSStreamStoreFailedF:                       {Code: 503, ErrCode: 10077, Description: "{err}"},
 		JSStreamSubjectOverlapErr:                  {Code: 400, ErrCode: 10065, Description: "subjects overlap with an existing stream"},
 		JSStreamTemplateCreateErrF:                 {Code: 500, ErrCode: 10066, Description: "{err}"},
 		JSStreamTemplateDeleteErrF:                 {Code: 500, ErrCode: 10067, Description: "{err}"},
 		JSStreamTemplateNotFoundErr:                {Code: 404, ErrCode: 10068, Description: "template not found"},
 		JSStreamUpdateErrF:                         {Code: 500, ErrCode: 10069, Description: "{err}"},
+		JSStreamWriterActiveErr:                    {Code: 400, ErrCode: 10163, Description: "stream has an active writer"},
+		JSStreamWriterFencedErr:                    {Code: 400, ErrCode: 10164, Description: "writer fence missing or invalid"},
 		JSStreamWrongLastMsgIDErrF:                 {Code: 400, ErrCode: 10070, Description: "wrong last msg ID: {id}"},
 		JSStreamWrongLastSequenceErrF:              {Code: 400, ErrCode: 10071, Description: "wrong last sequence: {seq}"},
 		JSTempStorageFailedErr:                     {Code: 500, ErrCode: 10072, Description: "JetStream unable to open temp storage for restore"},
@@ -565,6 +705,16 @@ var (
 	ErrReplicasNotSupported = ApiErrors[JSStreamReplicasNotSupportedErr]
 )
 
+// NewJSAccountReadOnlyError creates a new JSAccountReadOnlyErr error: "jetstream is disabled for account, stored data is read only"
+func NewJSAccountReadOnlyError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSAccountReadOnlyErr]
+}
+
 // NewJSAccountResourcesExceededError creates a new JSAccountResourcesExceededErr error: "resource limits exceeded for account"
 func NewJSAccountResourcesExceededError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -701,6 +851,16 @@ func NewJSClusterUnSupportFeatureError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSClusterUnSupportFeatureErr]
 }
 
+// NewJSConsumerAttachedError creates a new JSConsumerAttachedErr error: "consumer is attached to another client"
+func NewJSConsumerAttachedError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerAttachedErr]
+}
+
 // NewJSConsumerBadDurableNameError creates a new JSConsumerBadDurableNameErr error: "durable name can not contain '.', '*', '>'"
 func NewJSConsumerBadDurableNameError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -711,6 +871,16 @@ func NewJSConsumerBadDurableNameError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSConsumerBadDurableNameErr]
 }
 
+// NewJSConsumerBindConfigMismatchError creates a new JSConsumerBindConfigMismatchErr error: "consumer config does not match the existing consumer"
+func NewJSConsumerBindConfigMismatchError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerBindConfigMismatchErr]
+}
+
 // NewJSConsumerConfigRequiredError creates a new JSConsumerConfigRequiredErr error: "consumer config required"
 func NewJSConsumerConfigRequiredError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -903,6 +1073,54 @@ func NewJSConsumerHBRequiresPushError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSConsumerHBRequiresPushErr]
 }
 
+// NewJSConsumerInvalidDeliverCopiesError creates a new JSConsumerInvalidDeliverCopiesErr error: "{err}"
+func NewJSConsumerInvalidDeliverCopiesError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerInvalidDeliverCopiesErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSConsumerInvalidDeliverGroupHashError creates a new JSConsumerInvalidDeliverGroupHashErr error: "{err}"
+func NewJSConsumerInvalidDeliverGroupHashError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerInvalidDeliverGroupHashErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSConsumerInvalidDeliverQueueError creates a new JSConsumerInvalidDeliverQueueErr error: "{err}"
+func NewJSConsumerInvalidDeliverQueueError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerInvalidDeliverQueueErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerInvalidDeliverSubjectError creates a new JSConsumerInvalidDeliverSubject error: "invalid push consumer deliver subject"
 func NewJSConsumerInvalidDeliverSubjectError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -913,6 +1131,70 @@ func NewJSConsumerInvalidDeliverSubjectError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSConsumerInvalidDeliverSubject]
 }
 
+// NewJSConsumerInvalidDeliverTransformError creates a new JSConsumerInvalidDeliverTransformErr error: "{err}"
+func NewJSConsumerInvalidDeliverTransformError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerInvalidDeliverTransformErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSConsumerInvalidExclusiveError creates a new JSConsumerInvalidExclusiveErr error: "{err}"
+func NewJSConsumerInvalidExclusiveError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerInvalidExclusiveErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSConsumerInvalidOrderedError creates a new JSConsumerInvalidOrderedErr error: "{err}"
+func NewJSConsumerInvalidOrderedError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerInvalidOrderedErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSConsumerInvalidPendingMemoryError creates a new JSConsumerInvalidPendingMemoryErr error: "{err}"
+func NewJSConsumerInvalidPendingMemoryError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerInvalidPendingMemoryErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerInvalidPolicyError creates a new JSConsumerInvalidPolicyErrF error: "{err}"
 func NewJSConsumerInvalidPolicyError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -929,6 +1211,22 @@ func NewJSConsumerInvalidPolicyError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSConsumerInvalidReplaySpeedError creates a new JSConsumerInvalidReplaySpeedErr error: "{err}"
+func NewJSConsumerInvalidReplaySpeedError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerInvalidReplaySpeedErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerInvalidSamplingError creates a new JSConsumerInvalidSamplingErrF error: "failed to parse consumer sampling configuration: {err}"
 func NewJSConsumerInvalidSamplingError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -945,6 +1243,38 @@ func NewJSConsumerInvalidSamplingError(err error, opts ...ErrorOption) *ApiError
 	}
 }
 
+// NewJSConsumerInvalidStartConsumerSeqError creates a new JSConsumerInvalidStartConsumerSeqErr error: "{err}"
+func NewJSConsumerInvalidStartConsumerSeqError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerInvalidStartConsumerSeqErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSConsumerInvalidWebhookError creates a new JSConsumerInvalidWebhookErr error: "{err}"
+func NewJSConsumerInvalidWebhookError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerInvalidWebhookErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerMaxDeliverBackoffError creates a new JSConsumerMaxDeliverBackoffErr error: "max deliver is required to be > length of backoff values"
 func NewJSConsumerMaxDeliverBackoffError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1017,6 +1347,32 @@ func NewJSConsumerMaxRequestExpiresToSmallError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSConsumerMaxRequestExpiresToSmall]
 }
 
+// NewJSConsumerMaxRequestMaxBytesExceededError creates a new JSConsumerMaxRequestMaxBytesExceededF error: "consumer max request max bytes exceeds server limit of {limit}"
+func NewJSConsumerMaxRequestMaxBytesExceededError(limit interface{}, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerMaxRequestMaxBytesExceededF]
+	args := e.toReplacerArgs([]interface{}{"{limit}", limit})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSConsumerMaxRequestMaxBytesNegativeError creates a new JSConsumerMaxRequestMaxBytesNegativeErr error: "consumer max request max bytes needs to be >= 0"
+func NewJSConsumerMaxRequestMaxBytesNegativeError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerMaxRequestMaxBytesNegativeErr]
+}
+
 // NewJSConsumerMaxWaitingNegativeError creates a new JSConsumerMaxWaitingNegativeErr error: "consumer max waiting needs to be positive"
 func NewJSConsumerMaxWaitingNegativeError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1063,6 +1419,16 @@ func NewJSConsumerNameTooLongError(max interface{}, opts ...ErrorOption) *ApiErr
 	}
 }
 
+// NewJSConsumerNotExclusiveError creates a new JSConsumerNotExclusiveErr error: "consumer is not exclusive"
+func NewJSConsumerNotExclusiveError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerNotExclusiveErr]
+}
+
 // NewJSConsumerNotFoundError creates a new JSConsumerNotFoundErr error: "consumer not found"
 func NewJSConsumerNotFoundError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1163,6 +1529,16 @@ func NewJSConsumerReplicasShouldMatchStreamError(opts ...ErrorOption) *ApiError
 	return ApiErrors[JSConsumerReplicasShouldMatchStream]
 }
 
+// NewJSConsumerShardFilterError creates a new JSConsumerShardFilterErr error: "consumer filter subject must select a single shard"
+func NewJSConsumerShardFilterError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerShardFilterErr]
+}
+
 // NewJSConsumerSmallHeartbeatError creates a new JSConsumerSmallHeartbeatErr error: "consumer idle heartbeat needs to be >= 100ms"
 func NewJSConsumerSmallHeartbeatError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1189,6 +1565,32 @@ func NewJSConsumerStoreFailedError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSConsumerTemplateInvalidError creates a new JSConsumerTemplateInvalidErrF error: "{err}"
+func NewJSConsumerTemplateInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerTemplateInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSConsumerTemplateNotFoundError creates a new JSConsumerTemplateNotFoundErr error: "consumer template not found"
+func NewJSConsumerTemplateNotFoundError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerTemplateNotFoundErr]
+}
+
 // NewJSConsumerWQConsumerNotDeliverAllError creates a new JSConsumerWQConsumerNotDeliverAllErr error: "consumer must be deliver all on workqueue stream"
 func NewJSConsumerWQConsumerNotDeliverAllError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1545,6 +1947,48 @@ func NewJSStreamAssignmentError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamBatchFailedError creates a new JSStreamBatchFailedErr error: "batch failed: {err}"
+func NewJSStreamBatchFailedError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamBatchFailedErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamChunkedMsgError creates a new JSStreamChunkedMsgErrF error: "invalid chunked message: {err}"
+func NewJSStreamChunkedMsgError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamChunkedMsgErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamConfigRevisionNotFoundError creates a new JSStreamConfigRevisionNotFoundErr error: "stream config revision not found"
+func NewJSStreamConfigRevisionNotFoundError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamConfigRevisionNotFoundErr]
+}
+
 // NewJSStreamCreateError creates a new JSStreamCreateErrF error: "{err}"
 func NewJSStreamCreateError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1609,6 +2053,22 @@ func NewJSStreamExternalDelPrefixOverlapsError(prefix interface{}, subject inter
 	}
 }
 
+// NewJSStreamFailedError creates a new JSStreamFailedErrF error: "stream failed after repeated store errors: {err}"
+func NewJSStreamFailedError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamFailedErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamGeneralError creates a new JSStreamGeneralErrorF error: "{err}"
 func NewJSStreamGeneralError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1645,6 +2105,16 @@ func NewJSStreamInfoMaxSubjectsError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStreamInfoMaxSubjectsErr]
 }
 
+// NewJSStreamIngestThrottledError creates a new JSStreamIngestThrottledErr error: "stream ingest rate exceeded"
+func NewJSStreamIngestThrottledError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamIngestThrottledErr]
+}
+
 // NewJSStreamInvalidConfigError creates a new JSStreamInvalidConfigF error: "{err}"
 func NewJSStreamInvalidConfigError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1805,6 +2275,48 @@ func NewJSStreamMsgDeleteFailedError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamMsgInvalidError creates a new JSStreamMsgInvalidErr error: "message failed validation: {err}"
+func NewJSStreamMsgInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamMsgInvalidErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamMsgTimeInvalidError creates a new JSStreamMsgTimeInvalidErr error: "message timestamp is invalid"
+func NewJSStreamMsgTimeInvalidError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamMsgTimeInvalidErr]
+}
+
+// NewJSStreamMsgTimeSkewedError creates a new JSStreamMsgTimeSkewedErrF error: "message timestamp is skewed by {skew}"
+func NewJSStreamMsgTimeSkewedError(skew interface{}, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamMsgTimeSkewedErrF]
+	args := e.toReplacerArgs([]interface{}{"{skew}", skew})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamNameContainsPathSeparatorsError creates a new JSStreamNameContainsPathSeparatorsErr error: "Stream name can not contain path separators"
 func NewJSStreamNameContainsPathSeparatorsError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1835,6 +2347,16 @@ func NewJSStreamNameExistRestoreFailedError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStreamNameExistRestoreFailedErr]
 }
 
+// NewJSStreamNoHeaderIndexError creates a new JSStreamNoHeaderIndexErr error: "stream has no header index"
+func NewJSStreamNoHeaderIndexError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamNoHeaderIndexErr]
+}
+
 // NewJSStreamNotFoundError creates a new JSStreamNotFoundErr error: "stream not found"
 func NewJSStreamNotFoundError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1855,6 +2377,16 @@ func NewJSStreamNotMatchError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStreamNotMatchErr]
 }
 
+// NewJSStreamNotSingleWriterError creates a new JSStreamNotSingleWriterErr error: "stream is not single writer"
+func NewJSStreamNotSingleWriterError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamNotSingleWriterErr]
+}
+
 // NewJSStreamOfflineError creates a new JSStreamOfflineErr error: "stream is offline"
 func NewJSStreamOfflineError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1865,6 +2397,22 @@ func NewJSStreamOfflineError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStreamOfflineErr]
 }
 
+// NewJSStreamPartitionsError creates a new JSStreamPartitionsErrF error: "stream partitions: {err}"
+func NewJSStreamPartitionsError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamPartitionsErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamPurgeFailedError creates a new JSStreamPurgeFailedF error: "{err}"
 func NewJSStreamPurgeFailedError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1881,6 +2429,22 @@ func NewJSStreamPurgeFailedError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamRelocateError creates a new JSStreamRelocateErrF error: "stream relocation failed: {err}"
+func NewJSStreamRelocateError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamRelocateErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamReplicasNotSupportedError creates a new JSStreamReplicasNotSupportedErr error: "replicas > 1 not supported in non-clustered mode"
 func NewJSStreamReplicasNotSupportedError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1969,6 +2533,26 @@ func NewJSStreamSnapshotError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamStatsHistoryDisabledError creates a new JSStreamStatsHistoryDisabledErr error: "stream stats history is not enabled"
+func NewJSStreamStatsHistoryDisabledError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamStatsHistoryDisabledErr]
+}
+
+// NewJSStreamStoreDirNotFoundError creates a new JSStreamStoreDirNotFoundErr error: "store directory not found"
+func NewJSStreamStoreDirNotFoundError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamStoreDirNotFoundErr]
+}
+
 // NewJSStreamStoreFailedError creates a new JSStreamStoreFailedF error: "{err}"
 func NewJSStreamStoreFailedError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2053,6 +2637,26 @@ func NewJSStreamUpdateError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamWriterActiveError creates a new JSStreamWriterActiveErr error: "stream has an active writer"
+func NewJSStreamWriterActiveError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamWriterActiveErr]
+}
+
+// NewJSStreamWriterFencedError creates a new JSStreamWriterFencedErr error: "writer fence missing or invalid"
+func NewJSStreamWriterFencedError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamWriterFencedErr]
+}
+
 // NewJSStreamWrongLastMsgIDError creates a new JSStreamWrongLastMsgIDErrF error: "wrong last msg ID: {id}"
 func NewJSStreamWrongLastMsgIDError(id interface{}, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -49,6 +49,25 @@ type JSAPIAudit struct {
 
 const JSAPIAuditType = "io.nats.jetstream.advisory.v1.api_audit"
 
+// JSAdminAudit is an entry in the administrative audit trail kept in the system account.
+// Hash is the hex encoded SHA-256 of this entry serialized with an empty Hash.
+// PrevHash is the Hash of the previous entry sent by the same server.
+type JSAdminAudit struct {
+	TypedEvent
+	Server   string      `json:"server"`
+	Account  string      `json:"account"`
+	Client   *ClientInfo `json:"client"`
+	Subject  string      `json:"subject"`
+	Request  string      `json:"request,omitempty"`
+	Response string      `json:"response"`
+	Domain   string      `json:"domain,omitempty"`
+	Seq      uint64      `json:"seq"`
+	PrevHash string      `json:"prev_hash,omitempty"`
+	Hash     string      `json:"hash,omitempty"`
+}
+
+const JSAdminAuditType = "io.nats.jetstream.audit.v1.admin_action"
+
 // ActionAdvisoryType indicates which action against a stream, consumer or template triggered an advisory
 type ActionAdvisoryType string
 
@@ -91,20 +110,39 @@ type JSConsumerAckMetric struct {
 	Delay       int64  `json:"ack_time"`
 	Deliveries  uint64 `json:"deliveries"`
 	Domain      string `json:"domain,omitempty"`
+	TraceParent string `json:"traceparent,omitempty"`
 }
 
 // JSConsumerAckMetricType is the schema type for JSConsumerAckMetricType
 const JSConsumerAckMetricType = "io.nats.jetstream.metric.v1.consumer_ack"
 
+// JSConsumerDeliveryMetric is a metric with the delivery state of a consumer, published
+// periodically by its leader when configured for the server.
+type JSConsumerDeliveryMetric struct {
+	TypedEvent
+	Stream         string       `json:"stream"`
+	Consumer       string       `json:"consumer"`
+	Delivered      SequenceInfo `json:"delivered"`
+	AckFloor       SequenceInfo `json:"ack_floor"`
+	NumAckPending  int          `json:"num_ack_pending"`
+	NumRedelivered int          `json:"num_redelivered"`
+	NumPending     uint64       `json:"num_pending"`
+	Domain         string       `json:"domain,omitempty"`
+}
+
+// JSConsumerDeliveryMetricType is the schema type for JSConsumerDeliveryMetric
+const JSConsumerDeliveryMetricType = "io.nats.jetstream.metric.v1.consumer_delivery"
+
 // JSConsumerDeliveryExceededAdvisory is an advisory informing that a message hit
 // its MaxDeliver threshold and so might be a candidate for DLQ handling
 type JSConsumerDeliveryExceededAdvisory struct {
 	TypedEvent
-	Stream     string `json:"stream"`
-	Consumer   string `json:"consumer"`
-	StreamSeq  uint64 `json:"stream_seq"`
-	Deliveries uint64 `json:"deliveries"`
-	Domain     string `json:"domain,omitempty"`
+	Stream      string `json:"stream"`
+	Consumer    string `json:"consumer"`
+	StreamSeq   uint64 `json:"stream_seq"`
+	Deliveries  uint64 `json:"deliveries"`
+	Domain      string `json:"domain,omitempty"`
+	TraceParent string `json:"traceparent,omitempty"`
 }
 
 // JSConsumerDeliveryExceededAdvisoryType is the schema type for JSConsumerDeliveryExceededAdvisory
@@ -120,6 +158,7 @@ type JSConsumerDeliveryNakAdvisory struct {
 	StreamSeq   uint64 `json:"stream_seq"`
 	Deliveries  uint64 `json:"deliveries"`
 	Domain      string `json:"domain,omitempty"`
+	TraceParent string `json:"traceparent,omitempty"`
 }
 
 // JSConsumerDeliveryNakAdvisoryType is the schema type for JSConsumerDeliveryNakAdvisory
@@ -135,11 +174,123 @@ type JSConsumerDeliveryTerminatedAdvisory struct {
 	StreamSeq   uint64 `json:"stream_seq"`
 	Deliveries  uint64 `json:"deliveries"`
 	Domain      string `json:"domain,omitempty"`
+	TraceParent string `json:"traceparent,omitempty"`
 }
 
 // JSConsumerDeliveryTerminatedAdvisoryType is the schema type for JSConsumerDeliveryTerminatedAdvisory
 const JSConsumerDeliveryTerminatedAdvisoryType = "io.nats.jetstream.advisory.v1.terminated"
 
+// JSConsumerDeliveryDroppedAdvisory is an advisory informing that the oldest pending
+// message was dropped by the consumer to deliver newer ones at max ack pending
+type JSConsumerDeliveryDroppedAdvisory struct {
+	TypedEvent
+	Stream      string `json:"stream"`
+	Consumer    string `json:"consumer"`
+	ConsumerSeq uint64 `json:"consumer_seq"`
+	StreamSeq   uint64 `json:"stream_seq"`
+	Deliveries  uint64 `json:"deliveries"`
+	Domain      string `json:"domain,omitempty"`
+}
+
+// JSConsumerDeliveryDroppedAdvisoryType is the schema type for JSConsumerDeliveryDroppedAdvisory
+const JSConsumerDeliveryDroppedAdvisoryType = "io.nats.jetstream.advisory.v1.dropped"
+
+// JSConsumerPausedAdvisory is an advisory informing that delivery for a consumer
+// was paused by a client, e.g. because of errors processing messages
+type JSConsumerPausedAdvisory struct {
+	TypedEvent
+	Stream      string    `json:"stream"`
+	Consumer    string    `json:"consumer"`
+	ConsumerSeq uint64    `json:"consumer_seq"`
+	StreamSeq   uint64    `json:"stream_seq"`
+	PausedUntil time.Time `json:"paused_until"`
+	Domain      string    `json:"domain,omitempty"`
+}
+
+// JSConsumerPausedAdvisoryType is the schema type for JSConsumerPausedAdvisory
+const JSConsumerPausedAdvisoryType = "io.nats.jetstream.advisory.v1.consumer_paused"
+
+// JSConsumerDegradedAdvisory is an advisory informing that delivery for a push consumer
+// was paused or resumed because the client it delivers to is falling behind
+type JSConsumerDegradedAdvisory struct {
+	TypedEvent
+	Stream   string `json:"stream"`
+	Consumer string `json:"consumer"`
+	Degraded bool   `json:"degraded"`
+	Domain   string `json:"domain,omitempty"`
+}
+
+// JSConsumerDegradedAdvisoryType is the schema type for JSConsumerDegradedAdvisory
+const JSConsumerDegradedAdvisoryType = "io.nats.jetstream.advisory.v1.consumer_degraded"
+
+// JSStreamPartitionsAssignedAdvisory is an advisory informing that the partitions of a
+// WorkQueue stream were rebalanced over its workers
+type JSStreamPartitionsAssignedAdvisory struct {
+	TypedEvent
+	Stream      string              `json:"stream"`
+	Generation  uint64              `json:"generation"`
+	Reason      string              `json:"reason"`
+	Assignments map[string][]string `json:"assignments"`
+	Domain      string              `json:"domain,omitempty"`
+}
+
+// JSStreamPartitionsAssignedAdvisoryType is the schema type for JSStreamPartitionsAssignedAdvisory
+const JSStreamPartitionsAssignedAdvisoryType = "io.nats.jetstream.advisory.v1.stream_partitions_assigned"
+
+// JSConsumerActivityAdvisory is an advisory informing that a push consumer
+// gained or lost interest on its delivery subject
+type JSConsumerActivityAdvisory struct {
+	TypedEvent
+	Stream   string `json:"stream"`
+	Consumer string `json:"consumer"`
+	Active   bool   `json:"active"`
+	Domain   string `json:"domain,omitempty"`
+}
+
+// JSConsumerActivityAdvisoryType is the schema type for JSConsumerActivityAdvisory
+const JSConsumerActivityAdvisoryType = "io.nats.jetstream.advisory.v1.consumer_activity"
+
+// JSConsumerInactiveDeletedAdvisory is an advisory informing that a consumer
+// was deleted because it was inactive for longer than its inactive threshold
+type JSConsumerInactiveDeletedAdvisory struct {
+	TypedEvent
+	Stream            string        `json:"stream"`
+	Consumer          string        `json:"consumer"`
+	Durable           bool          `json:"durable"`
+	InactiveThreshold time.Duration `json:"inactive_threshold"`
+	Domain            string        `json:"domain,omitempty"`
+}
+
+// JSConsumerInactiveDeletedAdvisoryType is the schema type for JSConsumerInactiveDeletedAdvisory
+const JSConsumerInactiveDeletedAdvisoryType = "io.nats.jetstream.advisory.v1.consumer_inactive_deleted"
+
+// JSConsumerOrphanedAdvisory is an advisory informing that a durable pull consumer
+// had no pull requests for longer than the orphans threshold
+type JSConsumerOrphanedAdvisory struct {
+	TypedEvent
+	Stream   string              `json:"stream"`
+	Consumer string              `json:"consumer"`
+	Orphan   *ConsumerOrphanInfo `json:"orphan"`
+	Domain   string              `json:"domain,omitempty"`
+}
+
+// JSConsumerOrphanedAdvisoryType is the schema type for JSConsumerOrphanedAdvisory
+const JSConsumerOrphanedAdvisoryType = "io.nats.jetstream.advisory.v1.consumer_orphaned"
+
+// JSConsumerRedeliveryThresholdAdvisory is an advisory informing that a message
+// was redelivered as many times as the consumer's redelivery advisory threshold
+type JSConsumerRedeliveryThresholdAdvisory struct {
+	TypedEvent
+	Stream     string `json:"stream"`
+	Consumer   string `json:"consumer"`
+	StreamSeq  uint64 `json:"stream_seq"`
+	Deliveries uint64 `json:"deliveries"`
+	Domain     string `json:"domain,omitempty"`
+}
+
+// JSConsumerRedeliveryThresholdAdvisoryType is the schema type for JSConsumerRedeliveryThresholdAdvisory
+const JSConsumerRedeliveryThresholdAdvisoryType = "io.nats.jetstream.advisory.v1.redelivery_threshold"
+
 // JSSnapshotCreateAdvisory is an advisory sent after a snapshot is successfully started
 type JSSnapshotCreateAdvisory struct {
 	TypedEvent
@@ -270,3 +421,73 @@ type JSServerRemovedAdvisory struct {
 	Cluster  string `json:"cluster"`
 	Domain   string `json:"domain,omitempty"`
 }
+
+// JSStorageForecastAdvisoryType is sent when storage is forecasted to be full soon.
+const JSStorageForecastAdvisoryType = "io.nats.jetstream.advisory.v1.storage_forecast"
+
+// JSStorageForecastAdvisory indicates that at the current ingest rate a storage
+// limit for the server or an account will be reached within the configured threshold.
+type JSStorageForecastAdvisory struct {
+	TypedEvent
+	Server     string        `json:"server"`
+	ServerID   string        `json:"server_id"`
+	Account    string        `json:"account,omitempty"`
+	Storage    StorageType   `json:"storage"`
+	Used       uint64        `json:"used"`
+	Limit      uint64        `json:"limit"`
+	Rate       uint64        `json:"rate"`
+	TimeToFull time.Duration `json:"time_to_full"`
+	Domain     string        `json:"domain,omitempty"`
+}
+
+// JSStreamFailedAdvisoryType is sent when a stream stops accepting messages after repeated store errors.
+const JSStreamFailedAdvisoryType = "io.nats.jetstream.advisory.v1.stream_failed"
+
+// JSStreamFailedAdvisory indicates that a stream failed to store messages repeatedly,
+// e.g. since its disk is full, and will reject messages until it is re-opened.
+type JSStreamFailedAdvisory struct {
+	TypedEvent
+	Stream string `json:"stream"`
+	Error  string `json:"error"`
+	Errors int    `json:"errors"`
+	Domain string `json:"domain,omitempty"`
+}
+
+// JSStreamReopenedAdvisoryType is sent when a failed stream was re-opened.
+const JSStreamReopenedAdvisoryType = "io.nats.jetstream.advisory.v1.stream_reopened"
+
+// JSStreamReopenedAdvisory indicates that a failed stream accepts messages again.
+type JSStreamReopenedAdvisory struct {
+	TypedEvent
+	Stream string `json:"stream"`
+	Domain string `json:"domain,omitempty"`
+}
+
+// JSStreamAckPendingAdvisoryType is sent when the consumers of a stream reached or dropped below its ack pending limit.
+const JSStreamAckPendingAdvisoryType = "io.nats.jetstream.advisory.v1.stream_ack_pending"
+
+// JSStreamAckPendingAdvisory indicates that the consumers of a stream together reached its
+// ack pending limit and pause delivering new messages, or that they deliver again.
+type JSStreamAckPendingAdvisory struct {
+	TypedEvent
+	Stream  string `json:"stream"`
+	Pending int64  `json:"pending"`
+	Limit   int64  `json:"limit"`
+	Reached bool   `json:"reached"`
+	Domain  string `json:"domain,omitempty"`
+}
+
+// JSStreamMsgDeletedAdvisoryType is sent when messages were removed from a stream that keeps tombstones.
+const JSStreamMsgDeletedAdvisoryType = "io.nats.jetstream.advisory.v1.stream_msg_deleted"
+
+// JSStreamMsgDeletedAdvisory indicates that sequences were removed from a stream,
+// by the retention policy, a delete or a purge. Removals are batched, the removed
+// ranges are all between the first and last sequence.
+type JSStreamMsgDeletedAdvisory struct {
+	TypedEvent
+	Stream  string       `json:"stream"`
+	First   uint64       `json:"first_seq"`
+	Last    uint64       `json:"last_seq"`
+	Removed []*Tombstone `json:"removed"`
+	Domain  string       `json:"domain,omitempty"`
+}
@@ -0,0 +1,236 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Formats of a stream export.
+const (
+	// One JSON encoded StoredMsg per line.
+	JSExportFormatJSON = "json"
+	// Binary framing, see writeExportFrame.
+	JSExportFormatBinary = "binary"
+)
+
+// How many messages we export before flushing to the client.
+const jsExportFlushInterval = 256
+
+// jsExportRange is the range of messages to export, parsed from the query of the request.
+type jsExportRange struct {
+	startSeq  uint64
+	stopSeq   uint64
+	startTime time.Time
+	stopTime  time.Time
+}
+
+func decodeTime(w http.ResponseWriter, r *http.Request, param string) (time.Time, error) {
+	str := r.URL.Query().Get(param)
+	if str == "" {
+		return time.Time{}, nil
+	}
+	val, err := time.Parse(time.RFC3339Nano, str)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("Error decoding time for '%s': %v", param, err)))
+		return time.Time{}, err
+	}
+	return val, nil
+}
+
+// HandleJSExport streams the messages of a stream, e.g. GET /jsexport/ORDERS?start_seq=10&stop_seq=20.
+// The range is optional and can be given by sequence with start_seq and stop_seq, or by time with
+// start_time and stop_time in RFC3339 format. The format is "json" for newline delimited JSON, or
+// "binary". The request needs an API token of the account, allowed to get messages of the stream,
+// and is only accepted over HTTPS like API requests. Only streams stored on this server can be exported,
+// without the origin of the messages.
+func (s *Server) HandleJSExport(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.httpReqStats[JSExportPath]++
+	s.mu.Unlock()
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	acc, jt := s.authorizeJSAPIToken(w, r)
+	if acc == nil {
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, s.basePath(JSExportPath)), "/")
+	if !isValidName(name) {
+		http.Error(w, "invalid stream name", http.StatusNotFound)
+		return
+	}
+	if subject := fmt.Sprintf(JSApiMsgGetT, name); !jt.allowed(subject) {
+		s.Warnf("JetStream export over HTTP for account %q not allowed on %q", acc.Name, subject)
+		http.Error(w, "permissions violation", http.StatusForbidden)
+		return
+	}
+	if !s.JetStreamEnabled() || !acc.JetStreamEnabled() {
+		http.Error(w, "jetstream not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	var (
+		er  jsExportRange
+		err error
+	)
+	if er.startSeq, err = decodeUint64(w, r, "start_seq"); err != nil {
+		return
+	}
+	if er.stopSeq, err = decodeUint64(w, r, "stop_seq"); err != nil {
+		return
+	}
+	if er.startTime, err = decodeTime(w, r, "start_time"); err != nil {
+		return
+	}
+	if er.stopTime, err = decodeTime(w, r, "stop_time"); err != nil {
+		return
+	}
+	if er.startSeq > 0 && !er.startTime.IsZero() {
+		http.Error(w, "start_seq and start_time are exclusive", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	switch format {
+	case _EMPTY_:
+		format = JSExportFormatJSON
+	case JSExportFormatJSON, JSExportFormatBinary:
+	default:
+		http.Error(w, fmt.Sprintf("invalid format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	mset, err := acc.lookupStream(name)
+	if err != nil {
+		http.Error(w, "stream not found", http.StatusNotFound)
+		return
+	}
+
+	if format == JSExportFormatJSON {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	n, err := mset.exportMsgs(w, &er, format)
+	if err != nil {
+		s.Warnf("JetStream export of stream '%s > %s' failed after %d messages: %v", acc.Name, name, n, err)
+	}
+}
+
+// exportMsgs writes the messages in the range to w in the given format, and returns how many were written.
+// The store is read directly, so this can run for a long time without holding the stream lock.
+func (mset *stream) exportMsgs(w http.ResponseWriter, er *jsExportRange, format string) (int, error) {
+	store := mset.Store()
+	if store == nil {
+		return 0, ErrStoreClosed
+	}
+	seq := er.startSeq
+	if !er.startTime.IsZero() {
+		seq = store.GetSeqFromTime(er.startTime)
+	}
+	var stopTs int64
+	if !er.stopTime.IsZero() {
+		stopTs = er.stopTime.UnixNano()
+	}
+
+	bw := bufio.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+	flush := func() error {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	var (
+		smv StoreMsg
+		n   int
+		hdr [jsExportFrameHdrLen]byte
+	)
+	for {
+		if er.stopSeq > 0 && seq > er.stopSeq {
+			break
+		}
+		sm, _, err := store.LoadNextMsg(fwcs, true, seq, &smv)
+		if err == ErrStoreEOF {
+			break
+		} else if err != nil {
+			return n, err
+		}
+		if er.stopSeq > 0 && sm.seq > er.stopSeq || stopTs > 0 && sm.ts > stopTs {
+			break
+		}
+		sm.hdr = removeOriginHeader(sm.hdr)
+		if format == JSExportFormatJSON {
+			b, err := json.Marshal(&StoredMsg{
+				Subject:  sm.subj,
+				Sequence: sm.seq,
+				Header:   sm.hdr,
+				Data:     sm.msg,
+				Time:     time.Unix(0, sm.ts).UTC(),
+			})
+			if err != nil {
+				return n, err
+			}
+			bw.Write(b)
+			err = bw.WriteByte('\n')
+		} else {
+			err = writeExportFrame(bw, hdr[:], sm)
+		}
+		if err != nil {
+			return n, err
+		}
+		if n++; n%jsExportFlushInterval == 0 {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+		seq = sm.seq + 1
+	}
+	return n, flush()
+}
+
+// Length of the fixed part of a binary export frame.
+const jsExportFrameHdrLen = 8 + 8 + 2 + 4 + 4
+
+// writeExportFrame writes a message in the binary export format. All numbers are big endian.
+//
+//	sequence (8) | timestamp in unix nanoseconds (8) | subject length (2) | header length (4) |
+//	data length (4) | subject | header | data
+func writeExportFrame(bw *bufio.Writer, hdr []byte, sm *StoreMsg) error {
+	binary.BigEndian.PutUint64(hdr[0:], sm.seq)
+	binary.BigEndian.PutUint64(hdr[8:], uint64(sm.ts))
+	binary.BigEndian.PutUint16(hdr[16:], uint16(len(sm.subj)))
+	binary.BigEndian.PutUint32(hdr[18:], uint32(len(sm.hdr)))
+	binary.BigEndian.PutUint32(hdr[22:], uint32(len(sm.msg)))
+	bw.Write(hdr)
+	bw.WriteString(sm.subj)
+	bw.Write(sm.hdr)
+	_, err := bw.Write(sm.msg)
+	return err
+}
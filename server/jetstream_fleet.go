@@ -0,0 +1,201 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// How long we wait for all servers to respond to a fleet wide JSZ request.
+var jszFleetTimeout = 2 * time.Second
+
+// JszFleet is the response to a $SYS.REQ.SERVER.JSZ request, the JetStream information of
+// all servers that responded in time. Totals are summed over all servers, so replicated
+// streams and consumers are counted once per replica.
+type JszFleet struct {
+	Now time.Time `json:"now"`
+	// Number of servers that responded, and those we know about that did not.
+	Servers int `json:"servers"`
+	Missing int `json:"missing,omitempty"`
+	// Totals of the servers with JetStream enabled.
+	Memory         uint64            `json:"memory"`
+	Store          uint64            `json:"storage"`
+	ReservedMemory uint64            `json:"reserved_memory"`
+	ReservedStore  uint64            `json:"reserved_storage"`
+	HAAssets       int               `json:"ha_assets"`
+	API            JetStreamAPIStats `json:"api"`
+	Streams        int               `json:"streams"`
+	Consumers      int               `json:"consumers"`
+	Messages       uint64            `json:"messages"`
+	Bytes          uint64            `json:"bytes"`
+	// The responses of the individual servers, sorted by server name.
+	ServerDetails []*JszServer `json:"server_details"`
+}
+
+// JszServer is the response of a single server to the JSZ ping.
+type JszServer struct {
+	Server *ServerInfo `json:"server"`
+	Data   *JSInfo     `json:"data,omitempty"`
+	Error  *ApiError   `json:"error,omitempty"`
+}
+
+// add will account for the response of a single server.
+func (f *JszFleet) add(r *JszServer) {
+	f.Servers++
+	f.ServerDetails = append(f.ServerDetails, r)
+	ji := r.Data
+	if ji == nil || ji.Disabled {
+		return
+	}
+	f.Memory += ji.Memory
+	f.Store += ji.Store
+	f.ReservedMemory += ji.ReservedMemory
+	f.ReservedStore += ji.ReservedStore
+	f.HAAssets += ji.HAAssets
+	f.API.Total += ji.API.Total
+	f.API.Errors += ji.API.Errors
+	f.API.Inflight += ji.API.Inflight
+	f.Streams += ji.Streams
+	f.Consumers += ji.Consumers
+	f.Messages += ji.Messages
+	f.Bytes += ji.Bytes
+}
+
+// jszFleetReq is the handler for $SYS.REQ.SERVER.JSZ. Only one server in the fleet picks up a request.
+// It sends the JSZ ping with the same options to all servers, including itself, and responds with
+// the aggregated results. The options can select servers the same way as for the JSZ ping.
+func (s *Server) jszFleetReq(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if !s.EventsEnabled() || reply == _EMPTY_ {
+		return
+	}
+	_, msg := c.msgParts(rmsg)
+	var optz JszEventOptions
+	if len(msg) > 0 {
+		if err := json.Unmarshal(msg, &optz); err != nil {
+			s.sendInternalResponse(reply, &ServerAPIResponse{
+				Server: &ServerInfo{},
+				Error:  &ApiError{Code: http.StatusBadRequest, Description: err.Error()},
+			})
+			return
+		}
+	}
+	// Do not block the internal subscription while we wait for the responses.
+	go s.gatherJszFleet(reply, copyBytes(msg), &optz)
+}
+
+// When selecting servers we can not tell how many will respond, so we wait for the
+// timeout and do not report missing ones.
+func (s *Server) gatherJszFleet(reply string, msg []byte, optz *JszEventOptions) {
+	f := &optz.EventFilterOptions
+	filtered := f.Name != _EMPTY_ || f.Cluster != _EMPTY_ || f.Host != _EMPTY_ || len(f.Tags) > 0 || f.Domain != _EMPTY_
+
+	s.mu.Lock()
+	if s.sys == nil || s.sys.replies == nil {
+		s.mu.Unlock()
+		return
+	}
+	// We expect ourselves and all remote servers we know about.
+	expected := len(s.sys.servers) + 1
+	// Room for all responses, so none are dropped when they arrive faster than we add them.
+	rc := make(chan *JszServer, expected)
+	if filtered {
+		expected = -1
+	}
+	inbox := s.newRespInbox()
+	s.sys.replies[inbox] = func(sub *subscription, _ *client, _ *Account, subject, _ string, msg []byte) {
+		var r JszServer
+		if err := json.Unmarshal(msg, &r); err != nil {
+			s.Warnf("Error unmarshaling JSZ response: %v", err)
+			return
+		}
+		select {
+		case rc <- &r:
+		default:
+			s.Warnf("Failed placing JSZ response on internal channel")
+		}
+	}
+	// We would not hear our own response, so we add ours below.
+	s.sendInternalMsg(fmt.Sprintf(serverPingReqSubj, "JSZ"), inbox, nil, msg)
+	s.mu.Unlock()
+
+	// Cleanup after.
+	defer func() {
+		s.mu.Lock()
+		if s.sys != nil && s.sys.replies != nil {
+			delete(s.sys.replies, inbox)
+		}
+		s.mu.Unlock()
+	}()
+
+	fleet := &JszFleet{}
+	if !s.filterRequest(f) {
+		r := &JszServer{Server: s.jszServerInfo()}
+		var err error
+		if r.Data, err = s.Jsz(&optz.JSzOptions); err != nil {
+			r.Error = &ApiError{Code: http.StatusInternalServerError, Description: err.Error()}
+		}
+		fleet.add(r)
+	}
+	timeout := time.NewTimer(jszFleetTimeout)
+	defer timeout.Stop()
+
+LOOP:
+	for expected < 0 || fleet.Servers < expected {
+		select {
+		case <-s.quitCh:
+			return
+		case <-timeout.C:
+			break LOOP
+		case r := <-rc:
+			fleet.add(r)
+		}
+	}
+	if fleet.Servers < expected {
+		fleet.Missing = expected - fleet.Servers
+	}
+	sort.Slice(fleet.ServerDetails, func(i, j int) bool {
+		si, sj := fleet.ServerDetails[i].Server, fleet.ServerDetails[j].Server
+		if si == nil || sj == nil {
+			return sj != nil
+		}
+		return si.Name < sj.Name
+	})
+	fleet.Now = time.Now().UTC()
+	s.sendInternalResponse(reply, &ServerAPIResponse{Server: &ServerInfo{}, Data: fleet})
+}
+
+// Our own server info for our response, as the internal send loop would set it.
+func (s *Server) jszServerInfo() *ServerInfo {
+	s.mu.RLock()
+	si := &ServerInfo{
+		Name:      s.info.Name,
+		Host:      s.info.Host,
+		ID:        s.info.ID,
+		Cluster:   s.info.Cluster,
+		Domain:    s.info.Domain,
+		Version:   VERSION,
+		JetStream: s.info.JetStream,
+	}
+	if s.gateway.enabled {
+		si.Cluster = s.getGatewayName()
+	}
+	s.mu.RUnlock()
+	si.Tags = s.getOpts().Tags
+	si.Time = time.Now().UTC()
+	return si
+}
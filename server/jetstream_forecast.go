@@ -0,0 +1,264 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// How often we sample stream ingest rates to forecast storage usage.
+var forecastTick = 10 * time.Second
+
+// Weight of the latest sample in the ingest rate moving average.
+const forecastWeight = 0.3
+
+// Will sample and return the ingest rate for this stream in bytes/sec.
+// If the stream is at its own MaxBytes limit it will not grow anymore
+// so we report a rate of 0.
+func (mset *stream) sampleIngestRate(now time.Time) float64 {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+
+	if !mset.itime.IsZero() {
+		if elapsed := now.Sub(mset.itime).Seconds(); elapsed > 0 {
+			rate := float64(mset.ibytes-mset.ilast) / elapsed
+			mset.irate = forecastWeight*rate + (1-forecastWeight)*mset.irate
+		}
+	}
+	mset.ilast, mset.itime = mset.ibytes, now
+
+	if mset.cfg.MaxBytes > 0 && mset.store != nil {
+		var state StreamState
+		mset.store.FastState(&state)
+		if state.Bytes >= uint64(mset.cfg.MaxBytes) {
+			return 0
+		}
+	}
+	return mset.irate
+}
+
+// ingestRate returns the last sampled ingest rate in bytes/sec.
+func (mset *stream) ingestRate() uint64 {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	return uint64(mset.irate)
+}
+
+// timeToFull will estimate the time until used reaches limit at the given rate.
+// Returns false if there is no limit or no growth.
+func timeToFull(used, limit int64, rate float64) (time.Duration, bool) {
+	if limit <= 0 || rate <= 0 {
+		return 0, false
+	}
+	if used >= limit {
+		return 0, true
+	}
+	return time.Duration(float64(limit-used) / rate * float64(time.Second)), true
+}
+
+// Forecast state for one storage type.
+type storageForecast struct {
+	ttf     time.Duration
+	alerted bool
+}
+
+// update will record the new estimate and return true if we just crossed below the threshold.
+func (sf *storageForecast) update(ttf time.Duration, ok bool, threshold time.Duration) bool {
+	if !ok {
+		sf.ttf, sf.alerted = 0, false
+		return false
+	}
+	sf.ttf = ttf
+	if threshold <= 0 || ttf >= threshold {
+		sf.alerted = false
+		return false
+	}
+	if sf.alerted {
+		return false
+	}
+	sf.alerted = true
+	return true
+}
+
+// Runs in its own Go routine and periodically forecasts storage usage.
+func (js *jetStream) monitorStorageForecast() {
+	s := js.srv
+	defer s.grWG.Done()
+
+	t := time.NewTicker(forecastTick)
+	defer t.Stop()
+
+	js.mu.RLock()
+	qch := js.quitCh
+	js.mu.RUnlock()
+
+	for {
+		select {
+		case <-qch:
+			return
+		case <-s.quitCh:
+			return
+		case now := <-t.C:
+			if js.isEnabled() {
+				js.checkStorageForecast(now)
+			}
+		}
+	}
+}
+
+// checkStorageForecast samples all streams on this server and updates
+// the time to full estimates for the server and each account.
+// Account estimates are based on streams hosted by this server.
+func (js *jetStream) checkStorageForecast(now time.Time) {
+	s := js.srv
+	threshold := s.getOpts().JetStreamFcastAlert
+
+	js.mu.RLock()
+	accounts := make([]*jsAccount, 0, len(js.accounts))
+	for _, jsa := range js.accounts {
+		accounts = append(accounts, jsa)
+	}
+	maxMem, maxStore := js.config.MaxMemory, js.config.MaxStore
+	js.mu.RUnlock()
+
+	var srvMem, srvStore float64
+	for _, jsa := range accounts {
+		jsa.mu.RLock()
+		streams := make([]*stream, 0, len(jsa.streams))
+		for _, mset := range jsa.streams {
+			streams = append(streams, mset)
+		}
+		jsa.mu.RUnlock()
+
+		// Rates by tier, taking replicas into account.
+		memRates, storeRates := make(map[string]float64), make(map[string]float64)
+		for _, mset := range streams {
+			rate := mset.sampleIngestRate(now)
+			mset.mu.RLock()
+			tier, stype, replicas := mset.tier, mset.stype, mset.cfg.Replicas
+			mset.mu.RUnlock()
+			if stype == MemoryStorage {
+				srvMem += rate
+				memRates[tier] += rate * float64(replicas)
+			} else {
+				srvStore += rate
+				storeRates[tier] += rate * float64(replicas)
+			}
+		}
+		jsa.updateStorageForecast(memRates, storeRates, threshold)
+	}
+
+	memTTF, memOK := timeToFull(atomic.LoadInt64(&js.memUsed), maxMem, srvMem)
+	storeTTF, storeOK := timeToFull(atomic.LoadInt64(&js.storeUsed), maxStore, srvStore)
+
+	js.mu.Lock()
+	memAlert := js.memFcast.update(memTTF, memOK, threshold)
+	storeAlert := js.storeFcast.update(storeTTF, storeOK, threshold)
+	js.mu.Unlock()
+
+	if memAlert {
+		s.sendStorageForecastAdvisory(nil, MemoryStorage, atomic.LoadInt64(&js.memUsed), maxMem, srvMem, memTTF)
+	}
+	if storeAlert {
+		s.sendStorageForecastAdvisory(nil, FileStorage, atomic.LoadInt64(&js.storeUsed), maxStore, srvStore, storeTTF)
+	}
+}
+
+// updateStorageForecast will update the account estimates from the given rates.
+// We report the soonest of any tier.
+func (jsa *jsAccount) updateStorageForecast(memRates, storeRates map[string]float64, threshold time.Duration) {
+	type alert struct {
+		stype       StorageType
+		used, limit int64
+		rate        float64
+		ttf         time.Duration
+	}
+	var alerts []alert
+
+	jsa.usageMu.Lock()
+	var memBest, storeBest *alert
+	for tier, limits := range jsa.limits {
+		var used jsaUsage
+		if u := jsa.usage[tier]; u != nil {
+			used = u.total
+		}
+		if ttf, ok := timeToFull(used.mem, limits.MaxMemory, memRates[tier]); ok {
+			if memBest == nil || ttf < memBest.ttf {
+				memBest = &alert{MemoryStorage, used.mem, limits.MaxMemory, memRates[tier], ttf}
+			}
+		}
+		if ttf, ok := timeToFull(used.store, limits.MaxStore, storeRates[tier]); ok {
+			if storeBest == nil || ttf < storeBest.ttf {
+				storeBest = &alert{FileStorage, used.store, limits.MaxStore, storeRates[tier], ttf}
+			}
+		}
+	}
+	if memBest != nil {
+		if jsa.memFcast.update(memBest.ttf, true, threshold) {
+			alerts = append(alerts, *memBest)
+		}
+	} else {
+		jsa.memFcast.update(0, false, threshold)
+	}
+	if storeBest != nil {
+		if jsa.storeFcast.update(storeBest.ttf, true, threshold) {
+			alerts = append(alerts, *storeBest)
+		}
+	} else {
+		jsa.storeFcast.update(0, false, threshold)
+	}
+	jsa.usageMu.Unlock()
+
+	if len(alerts) == 0 {
+		return
+	}
+	jsa.mu.RLock()
+	acc, s := jsa.account, jsa.js.srv
+	jsa.mu.RUnlock()
+	for _, a := range alerts {
+		s.sendStorageForecastAdvisory(acc, a.stype, a.used, a.limit, a.rate, a.ttf)
+	}
+}
+
+// sendStorageForecastAdvisory sends the advisory to the account, or to the
+// system account for server level forecasts when acc is nil.
+func (s *Server) sendStorageForecastAdvisory(acc *Account, stype StorageType, used, limit int64, rate float64, ttf time.Duration) {
+	adv := &JSStorageForecastAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStorageForecastAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Server:     s.Name(),
+		ServerID:   s.ID(),
+		Storage:    stype,
+		Used:       uint64(used),
+		Limit:      uint64(limit),
+		Rate:       uint64(rate),
+		TimeToFull: ttf,
+		Domain:     s.getOpts().JetStreamDomain,
+	}
+	subj := JSAdvisoryServerStorageForecast
+	if acc != nil {
+		adv.Account = acc.Name
+		subj = JSAdvisoryAccountStorageForecast
+		s.Warnf("JetStream %s storage for account %q forecasted to be full in %v", stype, acc.Name, ttf)
+	} else {
+		s.Warnf("JetStream %s storage for server forecasted to be full in %v", stype, ttf)
+	}
+	s.publishAdvisory(acc, subj, adv)
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Format versions of the JetStream store directory.
+const (
+	// Stores written before we kept a format version are the same as this one.
+	jsStoreFormatV1 = 1
+	// JSStoreFormatVersion is the format version this server writes.
+	JSStoreFormatVersion = jsStoreFormatV1
+	// Oldest format version we can still read.
+	jsStoreFormatMinVersion = jsStoreFormatV1
+)
+
+// Directory in the store directory that holds the format file. Releases from before we kept a
+// format version take what is in the store directory for accounts, and remove it if they can.
+// They leave directories that are not empty alone, and never find an account by this name.
+const jsStoreFormatDir = ".format"
+
+// File in the format directory that holds the format version.
+const jsStoreFormatFile = "store.format"
+
+// Migrations from a format version to the next one, keyed by the version they migrate from.
+// A store is only migrated by an explicit request, so a server can be rolled back to the
+// previous release until all servers were upgraded.
+// A new format version needs to add its migration here.
+var jsStoreMigrations = map[int]func(js *jetStream) error{}
+
+// JSStoreFormat is what we keep in the format file of the store directory.
+type JSStoreFormat struct {
+	Version int       `json:"version"`
+	Server  string    `json:"server_version"`
+	Updated time.Time `json:"updated"`
+}
+
+// JSMigrateOptions are options passed to a JSMIGRATE request.
+type JSMigrateOptions struct {
+	// Only report the format versions, do not migrate.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// In the context of system events, JSMigrateEventOptions are options passed to a JSMIGRATE request.
+type JSMigrateEventOptions struct {
+	JSMigrateOptions
+	EventFilterOptions
+}
+
+// JSStoreFormatInfo is the response to a JSMIGRATE request.
+type JSStoreFormatInfo struct {
+	// Format version of the store before the request.
+	Previous int `json:"previous"`
+	// Format version of the store now.
+	Version  int  `json:"version"`
+	Migrated bool `json:"migrated"`
+}
+
+// checkStoreFormat is called on startup before we recover anything from the store directory.
+// A store without a format file was either just created, or written before we kept a version.
+// Both are the first format version. We refuse to start on a format we do not know, e.g. after
+// a downgrade past a migration.
+func (js *jetStream) checkStoreFormat() error {
+	s, storeDir := js.srv, js.config.StoreDir
+
+	version, err := readStoreFormat(storeDir)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		version = jsStoreFormatV1
+		if err := writeStoreFormat(storeDir, version); err != nil {
+			return fmt.Errorf("could not write store format: %v", err)
+		}
+	}
+
+	switch {
+	case version > JSStoreFormatVersion:
+		return fmt.Errorf("store format version %d is newer than the supported version %d", version, JSStoreFormatVersion)
+	case version < jsStoreFormatMinVersion:
+		return fmt.Errorf("store format version %d is no longer supported, migrate with a previous release first", version)
+	case version < JSStoreFormatVersion:
+		s.Warnf("JetStream store format version %d is older than %d, migrate once all servers are upgraded", version, JSStoreFormatVersion)
+	}
+
+	js.mu.Lock()
+	js.storeFormat = version
+	js.mu.Unlock()
+	return nil
+}
+
+// migrateStore will migrate the store directory to the current format version.
+func (js *jetStream) migrateStore(dryRun bool) (*JSStoreFormatInfo, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	info := &JSStoreFormatInfo{Previous: js.storeFormat, Version: js.storeFormat}
+	if dryRun || js.storeFormat == JSStoreFormatVersion {
+		return info, nil
+	}
+	for v := js.storeFormat; v < JSStoreFormatVersion; v++ {
+		migrate, ok := jsStoreMigrations[v]
+		if !ok {
+			return info, fmt.Errorf("no migration from store format version %d", v)
+		}
+		if err := migrate(js); err != nil {
+			return info, fmt.Errorf("migration from store format version %d failed: %v", v, err)
+		}
+	}
+	if err := writeStoreFormat(js.config.StoreDir, JSStoreFormatVersion); err != nil {
+		return info, err
+	}
+	js.storeFormat = JSStoreFormatVersion
+	info.Version, info.Migrated = JSStoreFormatVersion, true
+	js.srv.Noticef("JetStream store migrated from format version %d to %d", info.Previous, info.Version)
+	return info, nil
+}
+
+// Returns the format version of our store.
+func (js *jetStream) storeFormatVersion() int {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+	return js.storeFormat
+}
+
+// jsMigrateReq is the handler for a JSMIGRATE request.
+func (s *Server) jsMigrateReq(opts *JSMigrateOptions) (*JSStoreFormatInfo, error) {
+	js := s.getJetStream()
+	if js == nil {
+		return nil, errors.New("jetstream not enabled")
+	}
+	return js.migrateStore(opts.DryRun)
+}
+
+// Returns the format version from the format file, zero if we do not have one.
+func readStoreFormat(storeDir string) (int, error) {
+	buf, err := os.ReadFile(filepath.Join(storeDir, jsStoreFormatDir, jsStoreFormatFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("could not read store format: %v", err)
+	}
+	var sf JSStoreFormat
+	if err := json.Unmarshal(buf, &sf); err != nil || sf.Version <= 0 {
+		return 0, fmt.Errorf("store format file is corrupt")
+	}
+	return sf.Version, nil
+}
+
+// Writes the format file, replacing the old one only once the new one is complete.
+func writeStoreFormat(storeDir string, version int) error {
+	b, err := json.Marshal(&JSStoreFormat{Version: version, Server: VERSION, Updated: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(storeDir, jsStoreFormatDir)
+	if err := os.MkdirAll(dir, defaultDirPerms); err != nil {
+		return err
+	}
+	fn := filepath.Join(dir, jsStoreFormatFile)
+	tmp := fn + ".tmp"
+	if err := os.WriteFile(tmp, b, defaultFilePerms); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
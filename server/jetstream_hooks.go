@@ -0,0 +1,75 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+// JetStreamHooks allows applications embedding the server to be notified of
+// JetStream events without subscribing to advisories over a connection.
+// Any hook can be left nil.
+//
+// Hooks are called synchronously from within the server, so they should return
+// quickly and not block. Stream and consumer hooks are called on the server that
+// sends the corresponding advisory, while MsgStored and LimitExceeded are called
+// on every server that stores or rejects the message.
+type JetStreamHooks struct {
+	StreamCreated   func(account, stream string)
+	StreamDeleted   func(account, stream string)
+	ConsumerCreated func(account, stream, consumer string)
+	MsgStored       func(account, stream, subject string, seq uint64)
+	LimitExceeded   func(account, stream string, err error)
+}
+
+// SetJetStreamHooks will register the JetStream hooks for this server.
+// Passing nil will remove any registered hooks.
+func (s *Server) SetJetStreamHooks(hooks *JetStreamHooks) {
+	s.jsHooks.Store(hooks)
+}
+
+// Returns the registered hooks, or nil.
+func (s *Server) jetStreamHooks() *JetStreamHooks {
+	if s == nil {
+		return nil
+	}
+	hooks, _ := s.jsHooks.Load().(*JetStreamHooks)
+	return hooks
+}
+
+func (s *Server) hookStreamCreated(account, stream string) {
+	if hooks := s.jetStreamHooks(); hooks != nil && hooks.StreamCreated != nil {
+		hooks.StreamCreated(account, stream)
+	}
+}
+
+func (s *Server) hookStreamDeleted(account, stream string) {
+	if hooks := s.jetStreamHooks(); hooks != nil && hooks.StreamDeleted != nil {
+		hooks.StreamDeleted(account, stream)
+	}
+}
+
+func (s *Server) hookConsumerCreated(account, stream, consumer string) {
+	if hooks := s.jetStreamHooks(); hooks != nil && hooks.ConsumerCreated != nil {
+		hooks.ConsumerCreated(account, stream, consumer)
+	}
+}
+
+func (s *Server) hookMsgStored(account, stream, subject string, seq uint64) {
+	if hooks := s.jetStreamHooks(); hooks != nil && hooks.MsgStored != nil {
+		hooks.MsgStored(account, stream, subject, seq)
+	}
+}
+
+func (s *Server) hookLimitExceeded(account, stream string, err error) {
+	if hooks := s.jetStreamHooks(); hooks != nil && hooks.LimitExceeded != nil {
+		hooks.LimitExceeded(account, stream, err)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How long we wait for a response to a JetStream API request over HTTP.
+var jsHTTPRequestTimeout = 5 * time.Second
+
+// JSAPIToken is a token that can be used for JetStream API requests of its account over HTTP.
+// This allows e.g. CI/CD pipelines to manage streams and consumers without a NATS client.
+// Permissions are checked against the API subject, e.g. "$JS.API.STREAM.INFO.ORDERS",
+// the same way as publish permissions of a NATS connection. No permissions allow all API requests.
+type JSAPIToken struct {
+	Token       string             `json:"-"`
+	Permissions *SubjectPermission `json:"permissions,omitempty"`
+}
+
+// allowed returns if the token is allowed to make a request on the API subject.
+func (t *JSAPIToken) allowed(subject string) bool {
+	if t.Permissions == nil {
+		return true
+	}
+	allowed := len(t.Permissions.Allow) == 0
+	for _, allow := range t.Permissions.Allow {
+		if subjectIsSubsetMatch(subject, allow) {
+			allowed = true
+			break
+		}
+	}
+	for _, deny := range t.Permissions.Deny {
+		if subjectIsSubsetMatch(subject, deny) {
+			return false
+		}
+	}
+	return allowed
+}
+
+// Returns the account and token for the given token value.
+func (s *Server) lookupJSAPIToken(token string) (*Account, *JSAPIToken) {
+	var (
+		acc *Account
+		jt  *JSAPIToken
+	)
+	s.accounts.Range(func(k, v interface{}) bool {
+		a := v.(*Account)
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		for _, t := range a.jsTokens {
+			if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+				acc, jt = a, t
+				return false
+			}
+		}
+		return true
+	})
+	return acc, jt
+}
+
+// Returns the account and token for the bearer token of the request.
+// Will respond with an error and return nil if the token is missing or invalid.
+// Tokens are only accepted over HTTPS, unless plain HTTP is explicitly allowed.
+func (s *Server) authorizeJSAPIToken(w http.ResponseWriter, r *http.Request) (*Account, *JSAPIToken) {
+	if r.TLS == nil && !s.getOpts().JetStreamInsecureHTTPAPI {
+		http.Error(w, "https required", http.StatusForbidden)
+		return nil, nil
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == _EMPTY_ {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return nil, nil
+	}
+	acc, jt := s.lookupJSAPIToken(token)
+	if acc == nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return nil, nil
+	}
+	return acc, jt
+}
+
+// Returns the API subject for the path of a request, e.g. "/jsapi/STREAM/INFO/ORDERS"
+// is "$JS.API.STREAM.INFO.ORDERS".
+func jsAPISubjectFromPath(p string) (string, bool) {
+	p = strings.Trim(p, "/")
+	if p == _EMPTY_ {
+		return _EMPTY_, false
+	}
+	tokens := strings.Split(p, "/")
+	for _, t := range tokens {
+		if t == _EMPTY_ || strings.ContainsAny(t, ". \t*>") {
+			return _EMPTY_, false
+		}
+	}
+	return JSApiPrefix + "." + strings.Join(tokens, "."), true
+}
+
+// HandleJSAPI handles JetStream API requests over HTTP. The request needs an API token
+// of an account as bearer token, the body is the API request and the response is the API
+// response, e.g. POST /jsapi/STREAM/CREATE/ORDERS. API errors are part of the response.
+// Requests are only accepted over HTTPS, unless "insecure_http_api" is set for JetStream.
+func (s *Server) HandleJSAPI(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.httpReqStats[JSAPIPath]++
+	s.mu.Unlock()
+
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	acc, jt := s.authorizeJSAPIToken(w, r)
+	if acc == nil {
+		return
+	}
+	subject, ok := jsAPISubjectFromPath(strings.TrimPrefix(r.URL.Path, s.basePath(JSAPIPath)))
+	if !ok {
+		http.Error(w, "invalid API request", http.StatusNotFound)
+		return
+	}
+	if !jt.allowed(subject) {
+		s.Warnf("JetStream API request over HTTP for account %q not allowed on %q", acc.Name, subject)
+		http.Error(w, "permissions violation", http.StatusForbidden)
+		return
+	}
+	if !s.JetStreamEnabled() || !acc.JetStreamEnabled() {
+		http.Error(w, "jetstream not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(s.getOpts().MaxPayload)))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	resp, err := s.jsAccountRequest(acc, subject, nil, body, jsHTTPRequestTimeout)
+	if err == errReqTimeout {
+		http.Error(w, "request timed out", http.StatusGatewayTimeout)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Direct gets respond with the message itself, we only pass on JSON responses.
+	if !json.Valid(resp) {
+		http.Error(w, "invalid API response", http.StatusBadGateway)
+		return
+	}
+	ResponseHandler(w, r, resp)
+}
@@ -0,0 +1,216 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Most messages we accept in a single ingest request.
+const jsIngestMaxBatch = 1000
+
+// Largest body of an ingest request with JSON encoded messages.
+var jsIngestMaxBodySize int64 = 16 * 1024 * 1024
+
+// Nats- headers an ingested message can have, the others are reserved for the server.
+var jsIngestHeaders = map[string]struct{}{
+	JSMsgId:               {},
+	JSExpectedStream:      {},
+	JSExpectedLastSeq:     {},
+	JSExpectedLastSubjSeq: {},
+	JSExpectedLastMsgId:   {},
+	JSMsgRollup:           {},
+	JSMsgTime:             {},
+	JSWriterFence:         {},
+	JSChunkId:             {},
+	JSChunkSeq:            {},
+	JSChunkLast:           {},
+}
+
+// Returns if an ingested message can have the header.
+func jsIngestHeaderAllowed(key string) bool {
+	if len(key) < 5 || !strings.EqualFold(key[:5], "Nats-") {
+		return true
+	}
+	_, ok := jsIngestHeaders[key]
+	return ok
+}
+
+// JSIngestMsg is a message published over HTTP, the data is base64 encoded.
+type JSIngestMsg struct {
+	Subject string            `json:"subject"`
+	Header  map[string]string `json:"headers,omitempty"`
+	Data    []byte            `json:"data,omitempty"`
+}
+
+// HandleJSIngest publishes messages to a stream over HTTP and responds with their pub acks,
+// e.g. POST /jsingest/ORDERS?subject=orders.new with the message as body. Headers of the request
+// for publishing, e.g. Nats-Msg-Id, are headers of the message, other headers that start with "Nats-"
+// are reserved for the server and dropped, also from JSON encoded messages. With a JSON content type
+// the body is a JSIngestMsg, or an array of them that are published in order, and the response an
+// array of pub acks that stops at the first error. The request needs an API token of the account,
+// allowed to publish on the subjects of the messages, and is only accepted over HTTPS like API
+// requests. Subjects need to be stored by the stream.
+func (s *Server) HandleJSIngest(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.httpReqStats[JSIngestPath]++
+	s.mu.Unlock()
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	acc, jt := s.authorizeJSAPIToken(w, r)
+	if acc == nil {
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, s.basePath(JSIngestPath)), "/")
+	if !isValidName(name) {
+		http.Error(w, "invalid stream name", http.StatusNotFound)
+		return
+	}
+	if !s.JetStreamEnabled() || !acc.JetStreamEnabled() {
+		http.Error(w, "jetstream not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	cfg := s.jsIngestStreamConfig(acc, name)
+	if cfg == nil {
+		http.Error(w, "stream not found", http.StatusNotFound)
+		return
+	}
+
+	var (
+		msgs  []*JSIngestMsg
+		batch bool
+	)
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct == "application/json" {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, jsIngestMaxBodySize))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+			batch = true
+			err = json.Unmarshal(body, &msgs)
+		} else {
+			var m JSIngestMsg
+			err = json.Unmarshal(body, &m)
+			msgs = append(msgs, &m)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	} else {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(s.getOpts().MaxPayload)))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusRequestEntityTooLarge)
+			return
+		}
+		m := &JSIngestMsg{Subject: r.URL.Query().Get("subject"), Data: body}
+		for k, v := range r.Header {
+			if len(v) > 0 && strings.HasPrefix(k, "Nats-") && jsIngestHeaderAllowed(k) {
+				if m.Header == nil {
+					m.Header = make(map[string]string)
+				}
+				m.Header[k] = v[0]
+			}
+		}
+		msgs = append(msgs, m)
+	}
+	if len(msgs) == 0 || len(msgs) > jsIngestMaxBatch {
+		http.Error(w, fmt.Sprintf("requests need 1 to %d messages", jsIngestMaxBatch), http.StatusBadRequest)
+		return
+	}
+
+	subjects := cfg.ingestSubjects()
+	for i, m := range msgs {
+		if m == nil || !IsValidLiteralSubject(m.Subject) || !subjectMatchesAny(m.Subject, subjects) {
+			http.Error(w, fmt.Sprintf("message %d: subject not stored by stream %q", i, name), http.StatusBadRequest)
+			return
+		}
+		if !jt.allowed(m.Subject) {
+			s.Warnf("JetStream ingest over HTTP for account %q not allowed on %q", acc.Name, m.Subject)
+			http.Error(w, "permissions violation", http.StatusForbidden)
+			return
+		}
+		for k := range m.Header {
+			if !jsIngestHeaderAllowed(k) {
+				delete(m.Header, k)
+			}
+		}
+	}
+
+	acks := make([]json.RawMessage, 0, len(msgs))
+	for i, m := range msgs {
+		resp, err := s.jsAccountRequest(acc, m.Subject, m.Header, m.Data, jsHTTPRequestTimeout)
+		if err == errReqTimeout {
+			http.Error(w, fmt.Sprintf("request timed out after %d messages", i), http.StatusGatewayTimeout)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		acks = append(acks, resp)
+		var pa JSPubAckResponse
+		if json.Unmarshal(resp, &pa) != nil || pa.Error != nil {
+			break
+		}
+	}
+	if !batch {
+		ResponseHandler(w, r, acks[0])
+		return
+	}
+	b, _ := json.Marshal(acks)
+	ResponseHandler(w, r, b)
+}
+
+// Returns the config of a stream, which is not stored on this server when clustered, nil if not found.
+func (s *Server) jsIngestStreamConfig(acc *Account, name string) *StreamConfig {
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return nil
+		}
+		js.mu.RLock()
+		defer js.mu.RUnlock()
+		if sa := js.streamAssignment(acc.Name, name); sa != nil && sa.Config != nil {
+			cfg := *sa.Config
+			return &cfg
+		}
+		return nil
+	}
+	mset, err := acc.lookupStream(name)
+	if err != nil {
+		return nil
+	}
+	cfg := mset.config()
+	return &cfg
+}
+
+func subjectMatchesAny(subject string, filters []string) bool {
+	for _, filter := range filters {
+		if subjectIsSubsetMatch(subject, filter) {
+			return true
+		}
+	}
+	return false
+}
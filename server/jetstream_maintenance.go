@@ -0,0 +1,275 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"time"
+)
+
+// JSMaintenanceOpts configure the background maintenance of file based streams. Maintenance
+// compacts blocks with deleted messages, writes missing or stale block index files and drops
+// expired tombstones, within the windows of time and the IO budget configured here.
+type JSMaintenanceOpts struct {
+	// Windows of time during which maintenance runs, any time if empty.
+	Windows []ScheduleWindow
+	// Time zone of the windows, e.g. "Europe/Berlin", UTC if empty.
+	TimeZone string
+	// Max bytes per second maintenance reads and writes, unlimited if zero.
+	MaxIORate int64
+	// Time between maintenance runs.
+	Interval time.Duration
+}
+
+// Default time between maintenance runs.
+const defaultMaintenanceInterval = 10 * time.Minute
+
+func validateJetStreamMaintenance(o *Options) error {
+	mo := o.JetStreamMaintenance
+	if mo == nil {
+		return nil
+	}
+	if mo.Interval < 0 {
+		return errors.New("jetstream maintenance interval can not be negative")
+	}
+	if mo.MaxIORate < 0 {
+		return errors.New("jetstream maintenance max IO rate can not be negative")
+	}
+	if len(mo.Windows) > 0 {
+		if _, err := parseSchedule("jetstream maintenance", mo.Windows, mo.TimeZone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ioBudget limits the bytes per second of maintenance IO. Not safe for concurrent use.
+type ioBudget struct {
+	rate  float64
+	avail float64
+	last  time.Time
+}
+
+func newIOBudget(rate int64) *ioBudget {
+	return &ioBudget{rate: float64(rate), avail: float64(rate), last: time.Now()}
+}
+
+// spend will take n bytes from the budget, waiting for the budget to allow for them.
+// Returns false if we were asked to quit while waiting.
+func (b *ioBudget) spend(n uint64, qch, sqch chan struct{}) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	b.avail += now.Sub(b.last).Seconds() * b.rate
+	if b.avail > b.rate {
+		b.avail = b.rate
+	}
+	b.last = now
+	b.avail -= float64(n)
+	if b.avail >= 0 {
+		return true
+	}
+	t := time.NewTimer(time.Duration(-b.avail / b.rate * float64(time.Second)))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-qch:
+	case <-sqch:
+	}
+	return false
+}
+
+// maintenanceStats are the results of a maintenance run.
+type maintenanceStats struct {
+	compacted int
+	indexed   int
+	reclaimed uint64
+}
+
+// runMaintenance will periodically maintain the file based streams we store, while
+// within the maintenance windows.
+func (js *jetStream) runMaintenance() {
+	s := js.srv
+	defer s.grWG.Done()
+
+	mo := s.getOpts().JetStreamMaintenance
+	if mo == nil {
+		return
+	}
+	var sched *consumerSchedule
+	if len(mo.Windows) > 0 {
+		var err error
+		if sched, err = parseSchedule("jetstream maintenance", mo.Windows, mo.TimeZone); err != nil {
+			s.Warnf("JetStream maintenance disabled: %v", err)
+			return
+		}
+	}
+	interval := mo.Interval
+	if interval == 0 {
+		interval = defaultMaintenanceInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	js.mu.RLock()
+	qch := js.quitCh
+	js.mu.RUnlock()
+
+	// Stop once a window closes, a run picks up where it left off once the next one opens.
+	stop := func() bool {
+		return sched != nil && !sched.isOpen(time.Now())
+	}
+
+	for {
+		select {
+		case <-qch:
+			return
+		case <-s.quitCh:
+			return
+		case <-t.C:
+			if !js.isEnabled() || stop() {
+				continue
+			}
+			start := time.Now()
+			b := newIOBudget(mo.MaxIORate)
+			var ms maintenanceStats
+			for _, mset := range js.fileStreams() {
+				if stop() || !mset.maintain(b, &ms, stop, qch, s.quitCh) {
+					break
+				}
+			}
+			if ms.compacted > 0 || ms.indexed > 0 {
+				s.Debugf("JetStream maintenance compacted %d blocks, reclaiming %s, and wrote %d index files in %v",
+					ms.compacted, friendlyBytes(int64(ms.reclaimed)), ms.indexed, time.Since(start))
+			}
+		}
+	}
+}
+
+// fileStreams returns all file based streams we store.
+func (js *jetStream) fileStreams() []*stream {
+	js.mu.RLock()
+	accounts := make([]*jsAccount, 0, len(js.accounts))
+	for _, jsa := range js.accounts {
+		accounts = append(accounts, jsa)
+	}
+	js.mu.RUnlock()
+
+	var streams []*stream
+	for _, jsa := range accounts {
+		jsa.mu.RLock()
+		for _, mset := range jsa.streams {
+			if mset.config().Storage == FileStorage {
+				streams = append(streams, mset)
+			}
+		}
+		jsa.mu.RUnlock()
+	}
+	return streams
+}
+
+// maintain will drop our expired tombstones and maintain our file store.
+// Returns false if maintenance should not continue with other streams.
+func (mset *stream) maintain(b *ioBudget, ms *maintenanceStats, stop func() bool, qch, sqch chan struct{}) bool {
+	mset.mu.RLock()
+	store, tombs, closed := mset.store, mset.tombs, mset.closed
+	mset.mu.RUnlock()
+	if closed {
+		return true
+	}
+	if tombs != nil {
+		tombs.mu.Lock()
+		tombs.expire(time.Now())
+		tombs.mu.Unlock()
+	}
+	if fs, ok := store.(*fileStore); ok {
+		return fs.maintain(b, ms, stop, qch, sqch)
+	}
+	return true
+}
+
+// maintain will compact blocks that have less than half of their bytes in use, and write index
+// files that are missing or stale, so they do not have to be rebuilt on restart. The last block
+// is left alone since we write to it. The store is only locked while working on a single block,
+// not while waiting on the IO budget.
+// Returns false if we stopped before we were done.
+func (fs *fileStore) maintain(b *ioBudget, ms *maintenanceStats, stop func() bool, qch, sqch chan struct{}) bool {
+	fs.mu.RLock()
+	if fs.closed {
+		fs.mu.RUnlock()
+		return true
+	}
+	blks := append([]*msgBlock(nil), fs.blks...)
+	fs.mu.RUnlock()
+
+	for _, mb := range blks {
+		if stop() {
+			return false
+		}
+		fs.mu.RLock()
+		closed, isLast := fs.closed, mb == fs.lmb
+		fs.mu.RUnlock()
+		if closed {
+			return true
+		}
+		if isLast {
+			continue
+		}
+
+		mb.mu.RLock()
+		compact := !mb.closed && len(mb.dmap) > 0 && mb.bytes*2 < mb.rbytes
+		index := !mb.closed && mb.indexNeedsUpdateLocked()
+		// Compacting reads the block and writes what is in use.
+		cost := mb.rbytes + mb.bytes
+		mb.mu.RUnlock()
+
+		if compact {
+			if !b.spend(cost, qch, sqch) {
+				return false
+			}
+			// Same as when removing messages, compacting needs the store lock.
+			fs.mu.Lock()
+			mb.mu.Lock()
+			if rbytes := mb.rbytes; !fs.closed && !mb.closed && mb != fs.lmb && len(mb.dmap) > 0 {
+				mb.compact()
+				if mb.rbytes < rbytes {
+					ms.compacted++
+					ms.reclaimed += rbytes - mb.rbytes
+					// Compacting removed our index file.
+					index = true
+				}
+			}
+			mb.mu.Unlock()
+			fs.mu.Unlock()
+		}
+
+		if index {
+			if !b.spend(indexHdrSize, qch, sqch) {
+				return false
+			}
+			dios.acquire(ioBackground)
+			fs.mu.Lock()
+			mb.mu.Lock()
+			if !fs.closed && !mb.closed && mb.writeIndexInfoLocked() == nil {
+				ms.indexed++
+			}
+			mb.mu.Unlock()
+			fs.mu.Unlock()
+			dios.release(ioBackground)
+		}
+	}
+	return true
+}
@@ -0,0 +1,274 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// StreamShard is set on each of the streams that make up a sharded stream.
+// All shards listen on the same subjects and each one stores the messages
+// whose subject token at Token hashes to its Index.
+type StreamShard struct {
+	Stream string `json:"stream"`
+	Index  int    `json:"index"`
+	Count  int    `json:"count"`
+	Token  int    `json:"token"`
+}
+
+// ShardedStreamInfo shows the shards and aggregate state for a sharded stream.
+type ShardedStreamInfo struct {
+	Name   string             `json:"name"`
+	Shards []*StreamInfo      `json:"shards"`
+	State  ShardedStreamState `json:"state"`
+}
+
+// ShardedStreamState is the aggregate state of all shards.
+type ShardedStreamState struct {
+	Msgs      uint64 `json:"messages"`
+	Bytes     uint64 `json:"bytes"`
+	Consumers int    `json:"consumer_count"`
+}
+
+const (
+	// Maximum number of shards for a stream.
+	JSMaxShards = 64
+	// How long we wait for each shard to respond.
+	jsShardRequestTimeout = 4 * time.Second
+)
+
+// shardStreamName returns the name of the stream for the shard at index.
+func shardStreamName(name string, index int) string {
+	return fmt.Sprintf("%s_%d", name, index)
+}
+
+// shardIndex returns the shard for the subject.
+func shardIndex(subject string, token, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(tokenAt(subject, uint8(token))))
+	return int(h.Sum32() % uint32(count))
+}
+
+// owns returns true if this shard should store messages for subject.
+func (sh *StreamShard) owns(subject string) bool {
+	return shardIndex(subject, sh.Token, sh.Count) == sh.Index
+}
+
+// sharesSubjects returns true if both are different shards of the same sharded stream, split
+// the same way and with the same subjects. Only then can they share their subjects, so a stream
+// can not claim to be a shard to capture the messages of another one.
+func (sh *StreamShard) sharesSubjects(subjects []string, osh *StreamShard, osubjects []string) bool {
+	if sh == nil || osh == nil || sh.Stream != osh.Stream || sh.Index == osh.Index {
+		return false
+	}
+	if sh.Count != osh.Count || sh.Token != osh.Token || len(subjects) != len(osubjects) {
+		return false
+	}
+	for i, subj := range subjects {
+		if osubjects[i] != subj {
+			return false
+		}
+	}
+	return true
+}
+
+// checkStreamShard will make sure the shard config is valid for the stream.
+func checkStreamShard(cfg *StreamConfig) error {
+	sh := cfg.Shard
+	if !isValidName(sh.Stream) {
+		return errors.New("stream shard name is invalid")
+	}
+	if sh.Count < 1 || sh.Count > JSMaxShards {
+		return fmt.Errorf("stream shard count must be between 1 and %d", JSMaxShards)
+	}
+	if sh.Index < 0 || sh.Index >= sh.Count {
+		return errors.New("stream shard index is out of range")
+	}
+	if cfg.Name != shardStreamName(sh.Stream, sh.Index) {
+		return fmt.Errorf("stream shard name must be %q", shardStreamName(sh.Stream, sh.Index))
+	}
+	if cfg.Mirror != nil || len(cfg.Sources) > 0 {
+		return errors.New("stream shards can not be mirrors or have sources")
+	}
+	return checkShardToken(cfg.Subjects, sh.Token)
+}
+
+// checkShardToken will make sure the token is a single token wildcard in all subjects.
+func checkShardToken(subjects []string, token int) error {
+	if token < 1 || token > 255 {
+		return errors.New("stream shard token is out of range")
+	}
+	if len(subjects) == 0 {
+		return errors.New("sharded streams require subjects")
+	}
+	for _, subj := range subjects {
+		tts := tokenizeSubjectIntoSlice(nil, subj)
+		if len(tts) < token || tts[token-1] != pwcs {
+			return fmt.Errorf("stream shard token %d is not a single token wildcard in subject %q", token, subj)
+		}
+		for _, t := range tts[:token-1] {
+			if t == fwcs {
+				return fmt.Errorf("stream shard token %d is not a single token wildcard in subject %q", token, subj)
+			}
+		}
+	}
+	return nil
+}
+
+// Request info for a single shard from whichever server is its leader.
+func (s *Server) jsShardInfo(acc *Account, name string) (*StreamInfo, *ApiError) {
+	rmsg, err := s.jsAccountRequest(acc, fmt.Sprintf(JSApiStreamInfoT, name), nil, nil, jsShardRequestTimeout)
+	if err != nil {
+		return nil, NewJSStreamNotFoundError()
+	}
+	var resp JSApiStreamInfoResponse
+	if err := json.Unmarshal(rmsg, &resp); err != nil {
+		return nil, NewJSInvalidJSONError()
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.StreamInfo, nil
+}
+
+// Will look up the first shard to learn how the stream is sharded.
+func (s *Server) jsShardConfig(acc *Account, name string) (*StreamShard, *StreamInfo, *ApiError) {
+	si, apiErr := s.jsShardInfo(acc, shardStreamName(name, 0))
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	if si.Config.Shard == nil || si.Config.Shard.Stream != name {
+		return nil, nil, NewJSStreamNotFoundError()
+	}
+	return si.Config.Shard, si, nil
+}
+
+// jsShardedStreamInfo returns the info for all shards and the aggregate state.
+func (s *Server) jsShardedStreamInfo(acc *Account, name string) (*ShardedStreamInfo, *ApiError) {
+	sh, si, apiErr := s.jsShardConfig(acc, name)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	ssi := &ShardedStreamInfo{Name: name, Shards: []*StreamInfo{si}}
+	for i := 1; i < sh.Count; i++ {
+		si, apiErr := s.jsShardInfo(acc, shardStreamName(name, i))
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		ssi.Shards = append(ssi.Shards, si)
+	}
+	for _, si := range ssi.Shards {
+		ssi.State.Msgs += si.State.Msgs
+		ssi.State.Bytes += si.State.Bytes
+		ssi.State.Consumers += si.State.Consumers
+	}
+	return ssi, nil
+}
+
+// jsShardedStreamCreate will create each shard as a regular stream.
+// If any fail we will remove the ones we have created.
+func (s *Server) jsShardedStreamCreate(acc *Account, cfg *StreamConfig, shards, token int) (*ShardedStreamInfo, *ApiError) {
+	ssi := &ShardedStreamInfo{Name: cfg.Name}
+	for i := 0; i < shards; i++ {
+		scfg := *cfg
+		scfg.Name = shardStreamName(cfg.Name, i)
+		scfg.Shard = &StreamShard{Stream: cfg.Name, Index: i, Count: shards, Token: token}
+		req, _ := json.Marshal(scfg)
+
+		var resp JSApiStreamCreateResponse
+		rmsg, err := s.jsAccountRequest(acc, fmt.Sprintf(JSApiStreamCreateT, scfg.Name), nil, req, jsShardRequestTimeout)
+		if err == nil {
+			err = json.Unmarshal(rmsg, &resp)
+		}
+		if err != nil || resp.Error != nil {
+			for _, si := range ssi.Shards {
+				s.jsAccountRequest(acc, fmt.Sprintf(JSApiStreamDeleteT, si.Config.Name), nil, nil, jsShardRequestTimeout)
+			}
+			if resp.Error != nil {
+				return nil, resp.Error
+			}
+			return nil, NewJSStreamCreateError(err, Unless(err))
+		}
+		ssi.Shards = append(ssi.Shards, resp.StreamInfo)
+	}
+	return ssi, nil
+}
+
+// jsShardedStreamDelete will delete all shards.
+func (s *Server) jsShardedStreamDelete(acc *Account, name string) *ApiError {
+	sh, _, apiErr := s.jsShardConfig(acc, name)
+	if apiErr != nil {
+		return apiErr
+	}
+	for i := 0; i < sh.Count; i++ {
+		var resp JSApiStreamDeleteResponse
+		rmsg, err := s.jsAccountRequest(acc, fmt.Sprintf(JSApiStreamDeleteT, shardStreamName(name, i)), nil, nil, jsShardRequestTimeout)
+		if err == nil {
+			err = json.Unmarshal(rmsg, &resp)
+		}
+		if err != nil {
+			return NewJSStreamDeleteError(err, Unless(err))
+		}
+		// A missing shard is fine, we may be retrying a failed delete.
+		if resp.Error != nil && !IsNatsErr(resp.Error, JSStreamNotFoundErr) {
+			return resp.Error
+		}
+	}
+	return nil
+}
+
+// jsShardedConsumerCreate will create the consumer on the shard selected by the filter subject.
+func (s *Server) jsShardedConsumerCreate(acc *Account, name string, req *CreateConsumerRequest) (*ConsumerInfo, *ApiError) {
+	sh, _, apiErr := s.jsShardConfig(acc, name)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	filter := req.Config.FilterSubject
+	if numTokens(filter) < sh.Token {
+		return nil, NewJSConsumerShardFilterError()
+	}
+	tts := tokenizeSubjectIntoSlice(nil, filter)
+	for _, t := range tts[:sh.Token] {
+		if t == pwcs || t == fwcs {
+			return nil, NewJSConsumerShardFilterError()
+		}
+	}
+
+	shard := shardStreamName(name, shardIndex(filter, sh.Token, sh.Count))
+	req.Stream = shard
+	var subj string
+	if req.Config.Durable != _EMPTY_ {
+		subj = fmt.Sprintf(JSApiDurableCreateT, shard, req.Config.Durable)
+	} else {
+		subj = fmt.Sprintf(JSApiConsumerCreateT, shard)
+	}
+	b, _ := json.Marshal(req)
+
+	var resp JSApiConsumerCreateResponse
+	rmsg, err := s.jsAccountRequest(acc, subj, nil, b, jsShardRequestTimeout)
+	if err == nil {
+		err = json.Unmarshal(rmsg, &resp)
+	}
+	if err != nil {
+		return nil, NewJSConsumerCreateError(err, Unless(err))
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.ConsumerInfo, nil
+}
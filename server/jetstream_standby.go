@@ -0,0 +1,571 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A warm standby keeps a copy of the streams of a single JetStream server, the primary, for
+// disaster recovery without clustering. The standby connects to the primary as a client of its
+// system account and continuously ships the stream configs and messages, stored with the same
+// sequences and timestamps. Streams of a standby do not take messages until it is promoted with
+// a JSSTANDBY request, after which it runs as a regular server.
+// Messages are shipped one by one with JSSHIP requests, not as store blocks, so the stores of
+// the standby are laid out on their own. Consumers are not shipped, and messages removed from
+// the middle of a stream on the primary are only removed on the standby once they are before
+// the first sequence of the primary. A stream is only removed from the standby once it is
+// missing from jsStandbyDeleteAfter listings of the primary in a row.
+
+// JSStandbyOpts configure a server as the warm standby of a primary.
+type JSStandbyOpts struct {
+	// Servers to connect to, the primary.
+	URLs []string
+	// System account user of the primary, or a creds file.
+	User        string
+	Password    string
+	Credentials string
+	// How often to ship changes from the primary.
+	Interval time.Duration
+}
+
+const (
+	// Default time between shipping changes from the primary.
+	defaultStandbyInterval = time.Second
+	// How long we wait for the primary to respond.
+	standbyRequestTimeout = 5 * time.Second
+	// How many messages the primary ships per request.
+	jsShipMaxMsgs = 1000
+	// How many listings of the primary in a row a stream has to be missing from before we remove it.
+	jsStandbyDeleteAfter = 3
+)
+
+// File in the store directory that marks a promoted standby, so it does not go back to being
+// a standby on restart before its config was changed.
+const jsStandbyPromotedFile = "standby.promoted"
+
+// JSShipOptions are options passed to a JSSHIP request. Without a stream the primary
+// responds with all of its streams, otherwise with the messages of the stream from seq on.
+type JSShipOptions struct {
+	Account string `json:"account,omitempty"`
+	Stream  string `json:"stream,omitempty"`
+	Seq     uint64 `json:"seq,omitempty"`
+}
+
+// In the context of system events, JSShipEventOptions are options passed to a JSSHIP request.
+type JSShipEventOptions struct {
+	JSShipOptions
+	EventFilterOptions
+}
+
+// JSShipStream is a stream of the primary.
+type JSShipStream struct {
+	Account  string       `json:"account"`
+	Config   StreamConfig `json:"config"`
+	FirstSeq uint64       `json:"first_seq"`
+	LastSeq  uint64       `json:"last_seq"`
+}
+
+// JSShipInfo is the response to a JSSHIP request.
+type JSShipInfo struct {
+	Streams []*JSShipStream `json:"streams,omitempty"`
+	Msgs    []*StoredMsg    `json:"msgs,omitempty"`
+}
+
+// JSStandbyOptions are options passed to a JSSTANDBY request.
+type JSStandbyOptions struct {
+	// Stop shipping from the primary and start taking messages.
+	Promote bool `json:"promote,omitempty"`
+}
+
+// In the context of system events, JSStandbyEventOptions are options passed to a JSSTANDBY request.
+type JSStandbyEventOptions struct {
+	JSStandbyOptions
+	EventFilterOptions
+}
+
+// JSStandbyInfo is the response to a JSSTANDBY request.
+type JSStandbyInfo struct {
+	Standby   bool      `json:"standby"`
+	Promoted  bool      `json:"promoted,omitempty"`
+	Connected bool      `json:"connected,omitempty"`
+	Primary   string    `json:"primary,omitempty"`
+	Streams   int       `json:"streams,omitempty"`
+	LastSync  time.Time `json:"last_sync,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// validateJetStreamStandby will check the standby options.
+func validateJetStreamStandby(o *Options) error {
+	sb := o.JetStreamStandby
+	if sb == nil {
+		return nil
+	}
+	if len(sb.URLs) == 0 {
+		return errors.New("jetstream standby requires the urls of the primary")
+	}
+	if err := checkRemoteConnURLs(sb.URLs); err != nil {
+		return fmt.Errorf("jetstream standby %v", err)
+	}
+	if sb.Credentials != _EMPTY_ && sb.User != _EMPTY_ {
+		return errors.New("jetstream standby credentials can not be combined with user")
+	}
+	if o.Cluster.Port != 0 {
+		return errors.New("jetstream standby not supported in clustered mode")
+	}
+	return nil
+}
+
+// jsStandby ships the streams of the primary while we are a standby.
+type jsStandby struct {
+	mu       sync.Mutex
+	opts     JSStandbyOpts
+	rc       *remoteConn
+	qch      chan struct{}
+	done     chan struct{}
+	streams  int
+	lastSync time.Time
+	err      string
+	// Streams missing from the listings of the primary, with the number of listings in a row.
+	missing map[string]int
+}
+
+// isStandby returns if we are a standby that was not promoted yet.
+func (js *jetStream) isStandby() bool {
+	return atomic.LoadInt32(&js.standby) == 1
+}
+
+// setupStandby is called on startup before we recover our streams, so they do not take messages.
+func (js *jetStream) setupStandby() {
+	s := js.srv
+	opts := s.getOpts().JetStreamStandby
+	if opts == nil {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(js.config.StoreDir, jsStandbyPromotedFile)); err == nil {
+		s.Warnf("JetStream standby was promoted, remove the standby config")
+		return
+	}
+	js.mu.Lock()
+	js.sb = &jsStandby{opts: *opts, qch: make(chan struct{}), done: make(chan struct{})}
+	js.mu.Unlock()
+	atomic.StoreInt32(&js.standby, 1)
+	s.Noticef("  Standby of:      %s", strings.Join(opts.URLs, ", "))
+}
+
+// Runs in its own Go routine and ships from the primary until we are promoted.
+func (js *jetStream) runStandby() {
+	s := js.srv
+	defer s.grWG.Done()
+
+	js.mu.RLock()
+	sb, jsq := js.sb, js.quitCh
+	js.mu.RUnlock()
+	if sb == nil {
+		return
+	}
+	defer close(sb.done)
+
+	interval := sb.opts.Interval
+	if interval <= 0 {
+		interval = defaultStandbyInterval
+	}
+	rc := s.newRemoteConn(&remoteConnOpts{
+		name:          fmt.Sprintf("JetStream standby %s", s.Name()),
+		urls:          sb.opts.URLs,
+		credentials:   sb.opts.Credentials,
+		user:          sb.opts.User,
+		password:      sb.opts.Password,
+		reconnectWait: interval,
+		// Shipped messages are base64 encoded in the responses of the primary.
+		maxPayload: 2 * int(s.getOpts().MaxPayload),
+		errored: func(err error) {
+			sb.setErr(err)
+			s.RateLimitWarnf("JetStream standby connection to primary error: %v", err)
+		},
+	})
+	if rc == nil {
+		return
+	}
+	sb.mu.Lock()
+	sb.rc = rc
+	sb.mu.Unlock()
+	defer rc.close()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		// Errors connecting are reported by the connection.
+		if rc.isConnected() {
+			err := js.shipFromPrimary(sb, rc)
+			// Promoted while shipping.
+			if !js.isStandby() {
+				return
+			}
+			sb.setErr(err)
+			if err != nil {
+				s.RateLimitWarnf("JetStream standby could not ship from primary: %v", err)
+			}
+		}
+		select {
+		case <-t.C:
+		case <-sb.qch:
+			return
+		case <-jsq:
+			return
+		case <-s.quitCh:
+			return
+		}
+	}
+}
+
+func (sb *jsStandby) setErr(err error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if err != nil {
+		sb.err = err.Error()
+	} else {
+		sb.err = _EMPTY_
+	}
+}
+
+// shipRequest sends a JSSHIP request to the primary.
+func shipRequest(rc *remoteConn, opts *JSShipOptions) (*JSShipInfo, error) {
+	req, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := rc.serverInfo()
+	msg, err := rc.request(fmt.Sprintf(serverDirectReqSubj, id, "JSSHIP"), req, standbyRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	var info JSShipInfo
+	resp := ServerAPIResponse{Data: &info}
+	if err := json.Unmarshal(msg, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, errors.New(resp.Error.Description)
+	}
+	return &info, nil
+}
+
+// shipFromPrimary will bring our streams in line with those of the primary.
+func (js *jetStream) shipFromPrimary(sb *jsStandby, rc *remoteConn) error {
+	s := js.srv
+	info, err := shipRequest(rc, &JSShipOptions{})
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	shipped := make(map[string]map[string]struct{})
+	for _, ss := range info.Streams {
+		if js.isStandby() {
+			if err := js.shipStream(rc, ss); err != nil {
+				errs = append(errs, fmt.Sprintf("stream '%s > %s': %v", ss.Account, ss.Config.Name, err))
+			}
+		}
+		if shipped[ss.Account] == nil {
+			shipped[ss.Account] = make(map[string]struct{})
+		}
+		shipped[ss.Account][ss.Config.Name] = struct{}{}
+	}
+
+	// Remove the streams that were deleted on the primary. A single listing is not enough,
+	// the primary may still be recovering its accounts.
+	sb.mu.Lock()
+	prev := sb.missing
+	sb.mu.Unlock()
+	missing := make(map[string]int)
+	for _, mset := range js.allStreams() {
+		acc := mset.account()
+		if acc == nil || !js.isStandby() {
+			continue
+		}
+		if _, ok := shipped[acc.Name][mset.name()]; ok {
+			continue
+		}
+		key := fmt.Sprintf("%s > %s", acc.Name, mset.name())
+		if missing[key] = prev[key] + 1; missing[key] < jsStandbyDeleteAfter {
+			continue
+		}
+		delete(missing, key)
+		s.Noticef("JetStream standby removing stream '%s' deleted on primary", key)
+		mset.delete()
+	}
+
+	sb.mu.Lock()
+	sb.missing = missing
+	sb.streams, sb.lastSync = len(info.Streams), time.Now().UTC()
+	sb.mu.Unlock()
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Returns all streams of all accounts.
+func (js *jetStream) allStreams() []*stream {
+	js.mu.RLock()
+	accounts := make([]*jsAccount, 0, len(js.accounts))
+	for _, jsa := range js.accounts {
+		accounts = append(accounts, jsa)
+	}
+	js.mu.RUnlock()
+
+	var streams []*stream
+	for _, jsa := range accounts {
+		jsa.mu.RLock()
+		for _, mset := range jsa.streams {
+			streams = append(streams, mset)
+		}
+		jsa.mu.RUnlock()
+	}
+	return streams
+}
+
+// shipStream will create or update the stream and store the messages we do not have yet.
+func (js *jetStream) shipStream(rc *remoteConn, ss *JSShipStream) error {
+	acc, err := js.srv.LookupAccount(ss.Account)
+	if err != nil {
+		return err
+	}
+	// A sealed stream does not take messages, so we only seal once we have all of them.
+	cfg := ss.Config
+	cfg.Sealed = false
+
+	mset, err := acc.lookupStream(cfg.Name)
+	if err != nil {
+		if mset, err = acc.addStream(&cfg); err != nil {
+			return err
+		}
+	}
+
+	for lseq := mset.lastSeq(); lseq < ss.LastSeq; lseq = mset.lastSeq() {
+		info, err := shipRequest(rc, &JSShipOptions{Account: ss.Account, Stream: cfg.Name, Seq: lseq + 1})
+		if err != nil {
+			return err
+		}
+		if len(info.Msgs) == 0 {
+			break
+		}
+		if err := mset.storeShipped(ss.FirstSeq, info.Msgs); err != nil {
+			return err
+		}
+	}
+	mset.storeShipped(ss.FirstSeq, nil)
+
+	if mset.lastSeq() >= ss.LastSeq {
+		cfg.Sealed = ss.Config.Sealed
+	}
+	if ocfg := mset.config(); !reflect.DeepEqual(&ocfg, &cfg) {
+		return mset.updateWithAdvisory(&cfg, nil, false)
+	}
+	return nil
+}
+
+// storeShipped stores messages shipped from the primary with their sequence and timestamp.
+// Messages before first were removed on the primary, so we remove them as well.
+func (mset *stream) storeShipped(first uint64, msgs []*StoredMsg) error {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+	store := mset.store
+	if store == nil {
+		return ErrStoreClosed
+	}
+
+	var state StreamState
+	store.FastState(&state)
+	if state.Msgs == 0 && first > state.LastSeq+1 || state.Msgs > 0 && first > state.FirstSeq {
+		if _, err := store.Compact(first); err != nil {
+			return err
+		}
+		store.FastState(&state)
+		mset.lseq = state.LastSeq
+	}
+
+	for _, sm := range msgs {
+		if sm.Sequence <= mset.lseq {
+			continue
+		}
+		// Messages deleted on the primary.
+		for mset.lseq+1 < sm.Sequence {
+			mset.lseq = store.SkipMsg()
+		}
+		if err := store.StoreRawMsg(sm.Subject, sm.Header, sm.Data, sm.Sequence, sm.Time.UnixNano()); err != nil {
+			return err
+		}
+		mset.hidx.add(sm.Sequence, sm.Header)
+		mset.lseq = sm.Sequence
+	}
+	return nil
+}
+
+// promoteStandby will stop shipping from the primary and let our streams take messages.
+func (js *jetStream) promoteStandby() error {
+	s := js.srv
+	if !atomic.CompareAndSwapInt32(&js.standby, 1, 0) {
+		return nil
+	}
+	js.mu.RLock()
+	sb := js.sb
+	js.mu.RUnlock()
+	close(sb.qch)
+
+	// Wait for shipping to stop, our streams may be storing shipped messages.
+	// Closing the connection to the primary cancels a request in flight.
+	sb.mu.Lock()
+	if sb.rc != nil {
+		sb.rc.close()
+	}
+	sb.mu.Unlock()
+	select {
+	case <-sb.done:
+	case <-s.quitCh:
+		return ErrServerNotRunning
+	}
+
+	if err := os.WriteFile(filepath.Join(js.config.StoreDir, jsStandbyPromotedFile), []byte(time.Now().UTC().Format(time.RFC3339)), defaultFilePerms); err != nil {
+		s.Warnf("JetStream standby could not mark promotion: %v", err)
+	}
+
+	var errs []string
+	for _, mset := range js.allStreams() {
+		mset.mu.Lock()
+		if err := mset.subscribeToStream(); err != nil {
+			errs = append(errs, fmt.Sprintf("stream '%s': %v", mset.cfg.Name, err))
+		}
+		mset.mu.Unlock()
+	}
+	s.Noticef("JetStream standby promoted")
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// jsShipReq is the handler for a JSSHIP request, on the primary.
+func (s *Server) jsShipReq(opts *JSShipOptions) (*JSShipInfo, error) {
+	js := s.getJetStream()
+	if js == nil {
+		return nil, errors.New("jetstream not enabled")
+	}
+	if js.isStandby() {
+		return nil, errors.New("jetstream server is a standby")
+	}
+	// Until we recovered all streams our listing would be partial.
+	if !js.isStarted() {
+		return nil, errors.New("jetstream not started")
+	}
+	if s.JetStreamIsClustered() {
+		return nil, errors.New("jetstream standby not supported in clustered mode")
+	}
+
+	info := &JSShipInfo{}
+	if opts.Stream == _EMPTY_ {
+		for _, mset := range js.allStreams() {
+			acc := mset.account()
+			if acc == nil {
+				continue
+			}
+			var state StreamState
+			mset.store.FastState(&state)
+			info.Streams = append(info.Streams, &JSShipStream{
+				Account:  acc.Name,
+				Config:   mset.config(),
+				FirstSeq: state.FirstSeq,
+				LastSeq:  state.LastSeq,
+			})
+		}
+		return info, nil
+	}
+
+	acc, err := s.LookupAccount(opts.Account)
+	if err != nil {
+		return nil, err
+	}
+	mset, err := acc.lookupStream(opts.Stream)
+	if err != nil {
+		return nil, err
+	}
+	store := mset.Store()
+	maxBytes := s.getOpts().MaxPayload
+	var (
+		smv   StoreMsg
+		bytes int
+	)
+	for seq := opts.Seq; len(info.Msgs) < jsShipMaxMsgs && bytes < int(maxBytes); {
+		sm, _, err := store.LoadNextMsg(fwcs, true, seq, &smv)
+		if err == ErrStoreEOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		info.Msgs = append(info.Msgs, &StoredMsg{
+			Subject:  sm.subj,
+			Sequence: sm.seq,
+			Header:   copyBytes(sm.hdr),
+			Data:     copyBytes(sm.msg),
+			Time:     time.Unix(0, sm.ts).UTC(),
+		})
+		// Responses are JSON, with the header and data base64 encoded.
+		bytes += len(sm.subj) + base64.StdEncoding.EncodedLen(len(sm.hdr)) + base64.StdEncoding.EncodedLen(len(sm.msg)) + 128
+		seq = sm.seq + 1
+	}
+	return info, nil
+}
+
+// jsStandbyReq is the handler for a JSSTANDBY request, on the standby.
+func (s *Server) jsStandbyReq(opts *JSStandbyOptions) (*JSStandbyInfo, error) {
+	js := s.getJetStream()
+	if js == nil {
+		return nil, errors.New("jetstream not enabled")
+	}
+	js.mu.RLock()
+	sb := js.sb
+	js.mu.RUnlock()
+	if sb == nil {
+		return &JSStandbyInfo{}, nil
+	}
+
+	info := &JSStandbyInfo{Standby: js.isStandby()}
+	if opts.Promote && info.Standby {
+		if err := js.promoteStandby(); err != nil {
+			return nil, err
+		}
+		info.Standby, info.Promoted = false, true
+	}
+	sb.mu.Lock()
+	if sb.rc != nil && info.Standby {
+		if info.Connected = sb.rc.isConnected(); info.Connected {
+			_, info.Primary = sb.rc.serverInfo()
+		}
+	}
+	info.Streams, info.LastSync, info.Error = sb.streams, sb.lastSync, sb.err
+	sb.mu.Unlock()
+	return info, nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// JSStatsHistoryOpts configure keeping the stats history of the streams we lead.
+// The history is kept in memory, so memory used grows with the number of samples and streams.
+type JSStatsHistoryOpts struct {
+	// Time between samples, defaultStreamStatsInterval if zero.
+	Interval time.Duration
+	// Number of samples we keep per stream, defaultStreamStatsSamples if zero.
+	Samples int
+}
+
+const (
+	// Default time between stats samples of a stream.
+	defaultStreamStatsInterval = time.Minute
+	// Default number of stats samples we keep per stream, 24h at the default interval.
+	defaultStreamStatsSamples = 24 * 60
+	// Most stats samples we allow to keep per stream.
+	maxStreamStatsSamples = 7 * 24 * 60
+)
+
+func validateJetStreamStatsHistory(o *Options) error {
+	ho := o.JetStreamStatsHistory
+	if ho == nil {
+		return nil
+	}
+	if ho.Interval < 0 {
+		return errors.New("jetstream stats history interval can not be negative")
+	}
+	if ho.Samples < 0 || ho.Samples > maxStreamStatsSamples {
+		return fmt.Errorf("jetstream stats history samples must be between 0 and %d", maxStreamStatsSamples)
+	}
+	return nil
+}
+
+// statsHistoryOpts returns the interval and number of samples of the stream stats history.
+// The interval is zero if we do not keep a stats history.
+func (s *Server) statsHistoryOpts() (time.Duration, int) {
+	ho := s.getOpts().JetStreamStatsHistory
+	if ho == nil {
+		return 0, 0
+	}
+	interval, samples := ho.Interval, ho.Samples
+	if interval == 0 {
+		interval = defaultStreamStatsInterval
+	}
+	if samples == 0 {
+		samples = defaultStreamStatsSamples
+	}
+	return interval, samples
+}
+
+// StreamStatsSample is one point in the stats history of a stream.
+type StreamStatsSample struct {
+	Time     time.Time `json:"time"`
+	Msgs     uint64    `json:"messages"`
+	Bytes    uint64    `json:"bytes"`
+	MsgRate  float64   `json:"msgs_per_sec"`
+	ByteRate float64   `json:"bytes_per_sec"`
+	// Most messages any consumer still has pending.
+	ConsumerLag uint64 `json:"consumer_lag"`
+}
+
+// streamStatsHistory is a ring buffer of stats samples for a stream.
+// Kept in memory only, so starts over when the server restarts.
+type streamStatsHistory struct {
+	samples []StreamStatsSample
+	next    int
+	max     int
+	// Totals at the last sample to calculate rates.
+	lseq   uint64
+	ibytes uint64
+}
+
+// add will record the sample, overwriting the oldest one if we are full.
+func (h *streamStatsHistory) add(sample StreamStatsSample) {
+	if len(h.samples) < h.max {
+		h.samples = append(h.samples, sample)
+		return
+	}
+	h.samples[h.next] = sample
+	h.next = (h.next + 1) % h.max
+}
+
+// last returns the most recent sample, or nil if we have none.
+func (h *streamStatsHistory) last() *StreamStatsSample {
+	if len(h.samples) == 0 {
+		return nil
+	}
+	if h.next == 0 {
+		return &h.samples[len(h.samples)-1]
+	}
+	return &h.samples[h.next-1]
+}
+
+// since returns a copy of the samples taken after the given time, oldest first.
+func (h *streamStatsHistory) since(t time.Time) []*StreamStatsSample {
+	samples := make([]*StreamStatsSample, 0, len(h.samples))
+	for i := 0; i < len(h.samples); i++ {
+		sample := h.samples[(h.next+i)%len(h.samples)]
+		if sample.Time.After(t) {
+			samples = append(samples, &sample)
+		}
+	}
+	return samples
+}
+
+// Runs in its own Go routine and periodically samples the stats of all streams on this server.
+func (js *jetStream) monitorStreamStats() {
+	s := js.srv
+	defer s.grWG.Done()
+
+	interval, samples := s.statsHistoryOpts()
+	if interval == 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	js.mu.RLock()
+	qch := js.quitCh
+	js.mu.RUnlock()
+
+	for {
+		select {
+		case <-qch:
+			return
+		case <-s.quitCh:
+			return
+		case now := <-t.C:
+			if !js.isEnabled() {
+				continue
+			}
+			js.mu.RLock()
+			accounts := make([]*jsAccount, 0, len(js.accounts))
+			for _, jsa := range js.accounts {
+				accounts = append(accounts, jsa)
+			}
+			js.mu.RUnlock()
+
+			for _, jsa := range accounts {
+				jsa.mu.RLock()
+				streams := make([]*stream, 0, len(jsa.streams))
+				for _, mset := range jsa.streams {
+					streams = append(streams, mset)
+				}
+				jsa.mu.RUnlock()
+				for _, mset := range streams {
+					mset.sampleStats(now, samples)
+				}
+			}
+		}
+	}
+}
+
+// sampleStats will add a sample of our current stats to our history of at most max samples.
+func (mset *stream) sampleStats(now time.Time, max int) {
+	mset.mu.RLock()
+	store := mset.store
+	mset.mu.RUnlock()
+	if store == nil {
+		return
+	}
+
+	var state StreamState
+	store.FastState(&state)
+	sample := StreamStatsSample{
+		Time:        now.UTC(),
+		Msgs:        state.Msgs,
+		Bytes:       state.Bytes,
+		ConsumerLag: mset.maxConsumerLag(),
+	}
+
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+
+	if mset.shist == nil {
+		mset.shist = &streamStatsHistory{max: max}
+	}
+	h := mset.shist
+	if last := h.last(); last != nil {
+		if elapsed := now.Sub(last.Time).Seconds(); elapsed > 0 {
+			if state.LastSeq > h.lseq {
+				sample.MsgRate = float64(state.LastSeq-h.lseq) / elapsed
+			}
+			if mset.ibytes > h.ibytes {
+				sample.ByteRate = float64(mset.ibytes-h.ibytes) / elapsed
+			}
+		}
+	}
+	h.lseq, h.ibytes = state.LastSeq, mset.ibytes
+	h.add(sample)
+}
+
+// statsHistory returns our stats samples taken after the given time, oldest first.
+func (mset *stream) statsHistory(since time.Time) []*StreamStatsSample {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if mset.shist == nil {
+		return []*StreamStatsSample{}
+	}
+	return mset.shist.since(since)
+}
+
+// maxConsumerLag returns the most messages any of our consumers still has pending.
+func (mset *stream) maxConsumerLag() uint64 {
+	mset.mu.RLock()
+	store := mset.store
+	mset.mu.RUnlock()
+
+	var lag uint64
+	for _, o := range mset.getPublicConsumers() {
+		o.mu.RLock()
+		ostore, filter := o.store, o.cfg.FilterSubject
+		o.mu.RUnlock()
+		if ostore == nil {
+			continue
+		}
+		state, err := ostore.State()
+		if err != nil || state == nil {
+			continue
+		}
+		if pending, _ := store.NumPending(state.Delivered.Stream+1, filter, false); pending > lag {
+			lag = pending
+		}
+	}
+	return lag
+}
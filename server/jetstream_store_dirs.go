@@ -0,0 +1,325 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Name of the store directory configured with store_dir, when there are more.
+const primaryStoreDirName = "default"
+
+// Suffix of the directory a stream is copied to while it is relocated.
+const streamRelocateSuffix = ".relocating"
+
+// Returned for deletes and updates while a stream is relocated, since we would restart the
+// stream from the files and config we had when we stopped it.
+var errStreamRelocating = errors.New("stream is being relocated")
+
+func validateJetStreamStoreDirs(o *Options) error {
+	seen := make(map[string]string)
+	if o.StoreDir != _EMPTY_ {
+		seen[filepath.Clean(o.StoreDir)] = primaryStoreDirName
+	}
+	for name, dir := range o.JetStreamStoreDirs {
+		if !isValidName(name) || name == primaryStoreDirName {
+			return fmt.Errorf("jetstream store directory name %q is not valid", name)
+		}
+		if dir == _EMPTY_ {
+			return fmt.Errorf("jetstream store directory %q needs a path", name)
+		}
+		if other, ok := seen[filepath.Clean(dir)]; ok {
+			return fmt.Errorf("jetstream store directories %q and %q are the same", other, name)
+		}
+		seen[filepath.Clean(dir)] = name
+	}
+	return nil
+}
+
+// setupStoreDirs will create the store directories we have besides our primary one.
+func (js *jetStream) setupStoreDirs(dirs map[string]string) error {
+	if len(dirs) == 0 {
+		return nil
+	}
+	js.sdirs = make(map[string]string, len(dirs))
+	for name, dir := range dirs {
+		base := filepath.Join(dir, JetStreamStoreDir)
+		if err := os.MkdirAll(base, defaultDirPerms); err != nil {
+			return fmt.Errorf("could not create store directory %q - %v", name, err)
+		}
+		js.sdirs[name] = base
+	}
+	return nil
+}
+
+// storeDirNames returns the names of our store directories, our primary one first.
+func (js *jetStream) storeDirNames() []string {
+	names := make([]string, 0, len(js.sdirs))
+	for name := range js.sdirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{primaryStoreDirName}, names...)
+}
+
+// storeDir returns the directory of the store directory with the given name.
+func (js *jetStream) storeDir(name string) (string, bool) {
+	if name == primaryStoreDirName {
+		return js.config.StoreDir, true
+	}
+	dir, ok := js.sdirs[name]
+	return dir, ok
+}
+
+// streamsDirs returns the directories with the streams of an account, in all our store directories.
+func (js *jetStream) streamsDirs(accName string) []string {
+	var dirs []string
+	for _, name := range js.storeDirNames() {
+		base, _ := js.storeDir(name)
+		dirs = append(dirs, filepath.Join(base, accName, streamsDir))
+	}
+	return dirs
+}
+
+// streamStoreDir returns the directory for the files of a stream. Streams stay in the store
+// directory they are in, until relocated. New streams go to the store directory of their config,
+// or are spread across our store directories by the hash of their account and name.
+func (js *jetStream) streamStoreDir(accName string, cfg *StreamConfig) string {
+	for _, sdir := range js.streamsDirs(accName) {
+		dir := filepath.Join(sdir, cfg.Name)
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	name := cfg.StoreDir
+	if name == _EMPTY_ {
+		names := js.storeDirNames()
+		h := fnv.New32a()
+		h.Write([]byte(accName))
+		h.Write([]byte(cfg.Name))
+		name = names[h.Sum32()%uint32(len(names))]
+	}
+	base, ok := js.storeDir(name)
+	if !ok {
+		base = js.config.StoreDir
+	}
+	return filepath.Join(base, accName, streamsDir, cfg.Name)
+}
+
+// removeEmptyStreamsDirs will remove the directories of an account in our store directories if empty.
+func (js *jetStream) removeEmptyStreamsDirs(accName string) {
+	for _, sdir := range js.streamsDirs(accName) {
+		// no op if not empty
+		os.Remove(sdir)
+		os.Remove(filepath.Dir(sdir))
+	}
+}
+
+// fileStamp is used to detect files that changed since they were copied.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// copyDir will copy the files in a directory. With the stamps of a previous copy only files
+// that changed since are copied, and files that were removed since are removed from the copy.
+// Returns the stamps of the files copied.
+func copyDir(from, to string, prev map[string]fileStamp) (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+	err := filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(to, rel), defaultDirPerms)
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stamp := fileStamp{fi.Size(), fi.ModTime()}
+		stamps[rel] = stamp
+		if ps, ok := prev[rel]; ok && ps == stamp {
+			return nil
+		}
+		return copyFile(path, filepath.Join(to, rel))
+	})
+	if err != nil || prev == nil {
+		return stamps, err
+	}
+	for rel := range prev {
+		if _, ok := stamps[rel]; !ok {
+			os.Remove(filepath.Join(to, rel))
+		}
+	}
+	return stamps, nil
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, defaultFilePerms)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// moveDir will move a directory, copying it if it can not be renamed, e.g. across file systems.
+func moveDir(from, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+	if _, err := copyDir(from, to, nil); err != nil {
+		os.RemoveAll(to)
+		return err
+	}
+	return os.RemoveAll(from)
+}
+
+// relocate will start moving our files to another store directory.
+func (mset *stream) relocate(name string) *ApiError {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+
+	if mset.isClustered() {
+		return NewJSStreamRelocateError(errors.New("not supported for clustered streams"))
+	}
+	fstore, ok := mset.store.(*fileStore)
+	if !ok {
+		return NewJSStreamRelocateError(errors.New("stream is not file based"))
+	}
+	base, ok := mset.js.storeDir(name)
+	if !ok {
+		return NewJSStreamStoreDirNotFoundError()
+	}
+	if mset.relocating {
+		return NewJSStreamRelocateError(errors.New("stream is already being relocated"))
+	}
+	if mset.closed {
+		return NewJSStreamRelocateError(errors.New("stream is stopped"))
+	}
+	from := fstore.fcfg.StoreDir
+	to := filepath.Join(base, mset.acc.Name, streamsDir, mset.cfg.Name)
+	if filepath.Clean(from) == filepath.Clean(to) {
+		return NewJSStreamRelocateError(fmt.Errorf("stream is already in store directory %q", name))
+	}
+	mset.relocating = true
+	go mset.relocateTo(name, from, to)
+	return nil
+}
+
+// relocateTo will copy our files to the new directory while we keep running. Then we stop,
+// copy the files that changed in the meantime, switch to the new directory and start again.
+// If we fail before switching, we start again in our current directory.
+// Deletes and updates are refused until we are done.
+func (mset *stream) relocateTo(name, from, to string) {
+	mset.mu.RLock()
+	s, js, a, sname := mset.srv, mset.js, mset.acc, mset.cfg.Name
+	mset.mu.RUnlock()
+
+	staging := to + streamRelocateSuffix
+	fail := func(err error) {
+		os.RemoveAll(staging)
+		s.Warnf("JetStream failed to relocate stream '%s > %s': %v", a.Name, sname, err)
+	}
+
+	os.RemoveAll(staging)
+	var stamps map[string]fileStamp
+	err := os.MkdirAll(filepath.Dir(staging), defaultDirPerms)
+	if err == nil {
+		stamps, err = copyDir(from, staging, nil)
+	}
+	if err != nil {
+		fail(err)
+		mset.mu.Lock()
+		mset.relocating = false
+		mset.mu.Unlock()
+		return
+	}
+
+	// The stream may have been stopped otherwise while we copied, e.g. on shutdown,
+	// in which case we must not start it again.
+	mset.mu.RLock()
+	closed := mset.closed
+	mset.mu.RUnlock()
+	if closed {
+		fail(errors.New("stream was stopped"))
+		return
+	}
+
+	// While we are stopped our files do not change.
+	if err := mset.stop(false, false); err != nil {
+		fail(err)
+		return
+	}
+	// Start again with the config we had when we stopped, an update may have been in flight
+	// when we started.
+	mset.mu.RLock()
+	cfg, created := mset.cfg, mset.created
+	mset.mu.RUnlock()
+	if !mset.jsa.sys {
+		js.releaseStreamResources(&cfg)
+	}
+
+	if _, err = copyDir(from, staging, stamps); err == nil {
+		err = os.Rename(staging, to)
+	}
+	if err != nil {
+		fail(err)
+		a.restartStream(&cfg, created, from)
+		return
+	}
+	os.RemoveAll(from)
+	cfg.StoreDir = name
+	if a.restartStream(&cfg, created, to) {
+		s.Noticef("JetStream relocated stream '%s > %s' to store directory %q", a.Name, cfg.Name, name)
+	}
+}
+
+// restartStream will add a stream we stopped again, with its consumers, from its directory.
+func (a *Account) restartStream(cfg *StreamConfig, created time.Time, dir string) bool {
+	mset, err := a.addStream(cfg)
+	if err != nil {
+		a.mu.RLock()
+		s := a.srv
+		a.mu.RUnlock()
+		s.Warnf("JetStream failed to restart stream '%s > %s': %v", a.Name, cfg.Name, err)
+		return false
+	}
+	mset.setCreatedTime(created)
+	a.recoverConsumers(mset, filepath.Join(dir, consumerDir))
+	return true
+}
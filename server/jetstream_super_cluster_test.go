@@ -3281,6 +3281,66 @@ func TestJetStreamSuperClusterPeerEvacuationAndStreamReassignment(t *testing.T)
 	})
 }
 
+func TestJetStreamSuperClusterStreamMoveToTargetCluster(t *testing.T) {
+	sc := createJetStreamSuperCluster(t, 3, 3)
+	defer sc.shutdown()
+
+	c := sc.clusterForName("C1")
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:      "TEST",
+		Subjects:  []string{"foo"},
+		Replicas:  3,
+		Placement: &nats.Placement{Cluster: "C1"},
+	})
+	require_NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", nil)
+		require_NoError(t, err)
+	}
+
+	ncsys, err := nats.Connect(c.randomServer().ClientURL(), nats.UserInfo("admin", "s3cr3t!"))
+	require_NoError(t, err)
+	defer ncsys.Close()
+
+	moveReq, err := json.Marshal(&JSApiMetaServerStreamMoveRequest{TargetCluster: "C3"})
+	require_NoError(t, err)
+	rmsg, err := ncsys.Request(fmt.Sprintf(JSApiServerStreamMoveT, "$G", "TEST"), moveReq, 5*time.Second)
+	require_NoError(t, err)
+	var moveResp JSApiStreamUpdateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &moveResp))
+	require_True(t, moveResp.Error == nil)
+
+	checkFor(t, 30*time.Second, 250*time.Millisecond, func() error {
+		si, err := js.StreamInfo("TEST", nats.MaxWait(time.Second))
+		if err != nil {
+			return err
+		}
+		if si.Cluster.Name != "C3" {
+			return fmt.Errorf("stream expected in C3 but found in %s", si.Cluster.Name)
+		}
+		if si.Cluster.Leader == _EMPTY_ || len(si.Cluster.Replicas) != 2 {
+			return fmt.Errorf("move not complete")
+		}
+		if si.State.Msgs != 10 {
+			return fmt.Errorf("expected 10 msgs, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+
+	// Moving to an unknown cluster should fail.
+	moveReq, err = json.Marshal(&JSApiMetaServerStreamMoveRequest{TargetCluster: "C22"})
+	require_NoError(t, err)
+	rmsg, err = ncsys.Request(fmt.Sprintf(JSApiServerStreamMoveT, "$G", "TEST"), moveReq, 5*time.Second)
+	require_NoError(t, err)
+	moveResp = JSApiStreamUpdateResponse{}
+	require_NoError(t, json.Unmarshal(rmsg.Data, &moveResp))
+	require_True(t, moveResp.Error != nil)
+}
+
 func TestJetStreamSuperClusterMirrorInheritsAllowDirect(t *testing.T) {
 	sc := createJetStreamTaggedSuperCluster(t)
 	defer sc.shutdown()
@@ -17,16 +17,23 @@
 package server
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -41,6 +48,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/s2"
 	"github.com/nats-io/jwt/v2"
 	"github.com/nats-io/nats-server/v2/server/sysmem"
 	"github.com/nats-io/nats.go"
@@ -174,6 +182,72 @@ func TestJetStreamEnableAndDisableAccount(t *testing.T) {
 	}
 }
 
+func TestJetStreamServerDisableAndReEnable(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	sd := s.getOpts().StoreDir
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "dlc", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+
+	sacc := s.SystemAccount()
+	nsubs := sacc.sl.Count()
+
+	for i := 0; i < 2; i++ {
+		ojs := s.getJetStream()
+		require_NoError(t, s.DisableJetStream())
+		require_False(t, s.JetStreamEnabled())
+		require_True(t, s.getJetStream() == nil)
+		// Go routines of the old instance that grab the quit channel late still exit.
+		ojs.mu.RLock()
+		qch := ojs.quitCh
+		ojs.mu.RUnlock()
+		select {
+		case <-qch:
+		default:
+			t.Fatalf("Expected quit channel to be closed")
+		}
+		// Internal subscriptions are gone.
+		require_True(t, sacc.sl.Count() < nsubs)
+		_, err = js.AccountInfo(nats.MaxWait(250 * time.Millisecond))
+		require_Error(t, err)
+
+		// Re-enable with a new config.
+		maxMem := int64(64+i) * 1024 * 1024
+		require_NoError(t, s.EnableJetStream(&JetStreamConfig{StoreDir: sd, MaxMemory: maxMem, MaxStore: 1024 * 1024 * 1024}))
+		require_True(t, s.JetStreamEnabled())
+		require_True(t, s.JetStreamConfig().MaxMemory == maxMem)
+		require_True(t, sacc.sl.Count() == nsubs)
+
+		// State was flushed and recovered.
+		si, err := js.StreamInfo("TEST")
+		require_NoError(t, err)
+		require_True(t, si.State.Msgs == 10)
+		ci, err := js.ConsumerInfo("TEST", "dlc")
+		require_NoError(t, err)
+		require_True(t, ci.NumPending == 10)
+
+		// Only one response per request.
+		sub := natsSubSync(t, nc, nats.NewInbox())
+		require_NoError(t, nc.PublishRequest(JSApiAccountInfo, sub.Subject, nil))
+		natsNexMsg(t, sub, time.Second)
+		time.Sleep(50 * time.Millisecond)
+		n, _, err := sub.Pending()
+		require_NoError(t, err)
+		require_True(t, n == 0)
+		sub.Unsubscribe()
+	}
+}
+
 func TestJetStreamAddStream(t *testing.T) {
 	cases := []struct {
 		name    string
@@ -655,7 +729,7 @@ func TestJetStreamConsumerMaxDeliveries(t *testing.T) {
 
 func TestJetStreamNextReqFromMsg(t *testing.T) {
 	bef := time.Now()
-	expires, _, _, _, _, _, err := nextReqFromMsg([]byte(`{"expires":5000000000}`)) // nanoseconds
+	expires, _, _, _, _, _, _, err := nextReqFromMsg([]byte(`{"expires":5000000000}`)) // nanoseconds
 	require_NoError(t, err)
 	now := time.Now()
 	if expires.Before(bef.Add(5*time.Second)) || expires.After(now.Add(5*time.Second)) {
@@ -876,6 +950,45 @@ func TestJetStreamAddStreamMaxMsgSize(t *testing.T) {
 	}
 }
 
+func TestJetStreamStreamMaxMsgSizeUpdate(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		max_payload: 8MB
+		jetstream: {store_dir: %q}
+	`, t.TempDir())))
+	defer removeFile(t, conf)
+
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	msg := make([]byte, 2*1024*1024)
+	_, err = js.Publish("foo", msg)
+	require_NoError(t, err)
+
+	// Lower the limit below the server max payload and make sure it is enforced.
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, MaxMsgSize: 1024 * 1024})
+	require_NoError(t, err)
+
+	resp, err := nc.Request("foo", msg, time.Second)
+	require_NoError(t, err)
+	pa := getPubAckResponse(resp.Data)
+	require_True(t, pa != nil && pa.Error != nil)
+	require_True(t, pa.Error.ErrCode == uint16(JSStreamMessageExceedsMaximumErr))
+
+	_, err = js.Publish("foo", msg[:1024])
+	require_NoError(t, err)
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 2)
+}
+
 func TestJetStreamAddStreamCanonicalNames(t *testing.T) {
 	s := RunBasicJetStreamServer(t)
 	defer s.Shutdown()
@@ -962,6 +1075,52 @@ func TestJetStreamMaxConsumers(t *testing.T) {
 	}
 }
 
+// A work queue stream meant to have exactly N partitions can cap its consumers.
+func TestJetStreamMaxConsumersWorkQueuePartitions(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:         "WQ",
+		Subjects:     []string{"wq.>"},
+		Retention:    nats.WorkQueuePolicy,
+		MaxConsumers: 2,
+	})
+	require_NoError(t, err)
+
+	addPartition := func(name string) error {
+		_, err := js.AddConsumer("WQ", &nats.ConsumerConfig{
+			Durable:       name,
+			FilterSubject: "wq." + name,
+			AckPolicy:     nats.AckExplicitPolicy,
+		})
+		return err
+	}
+	require_NoError(t, addPartition("p1"))
+	require_NoError(t, addPartition("p2"))
+
+	err = addPartition("p3")
+	var apiErr *nats.APIError
+	require_True(t, errors.As(err, &apiErr))
+	require_True(t, apiErr.ErrorCode == nats.ErrorCode(JSMaximumConsumersLimitErr))
+
+	// Updating an existing partition is not another consumer.
+	_, err = js.UpdateConsumer("WQ", &nats.ConsumerConfig{
+		Durable:       "p2",
+		FilterSubject: "wq.p2",
+		AckPolicy:     nats.AckExplicitPolicy,
+		MaxDeliver:    5,
+	})
+	require_NoError(t, err)
+
+	// Replacing a partition frees up its slot.
+	require_NoError(t, js.DeleteConsumer("WQ", "p2"))
+	require_NoError(t, addPartition("p3"))
+}
+
 func TestJetStreamAddStreamOverlappingSubjects(t *testing.T) {
 	mconfig := &StreamConfig{
 		Name:     "ok",
@@ -9405,6 +9564,81 @@ func TestJetStreamPullConsumerMaxWaiting(t *testing.T) {
 	}
 }
 
+func TestJetStreamPullConsumerFairness(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{
+		Durable:    "dur",
+		AckPolicy:  nats.AckExplicitPolicy,
+		MaxWaiting: 3,
+	})
+	require_NoError(t, err)
+
+	rsubj := fmt.Sprintf(JSApiRequestNextT, "TEST", "dur")
+	pull := func(inbox string, batch int, expires time.Duration) {
+		t.Helper()
+		req, _ := json.Marshal(&JSApiConsumerGetNextRequest{Batch: batch, Expires: expires})
+		require_NoError(t, nc.PublishRequest(rsubj, inbox, req))
+		require_NoError(t, nc.Flush())
+	}
+
+	// Three workers queue a pull each, the first one with a short expiry.
+	var subs []*nats.Subscription
+	for i := 0; i < 3; i++ {
+		subs = append(subs, natsSubSync(t, nc, fmt.Sprintf("w.%d", i)))
+	}
+	pull("w.0", 2, 100*time.Millisecond)
+	pull("w.1", 2, 5*time.Second)
+	pull("w.2", 2, 5*time.Second)
+
+	ci, err := js.ConsumerInfo("TEST", "dur")
+	require_NoError(t, err)
+	require_True(t, ci.NumWaiting == 3)
+
+	// The queue is full.
+	m, err := nc.Request(rsubj, []byte(`{"batch":1,"expires":1000000000}`), time.Second)
+	require_NoError(t, err)
+	require_Equal(t, m.Header.Get("Status"), "409")
+
+	// Once the first one expired it is removed from the queue.
+	m = natsNexMsg(t, subs[0], time.Second)
+	require_Equal(t, m.Header.Get("Status"), "408")
+	checkFor(t, time.Second, 50*time.Millisecond, func() error {
+		ci, err := js.ConsumerInfo("TEST", "dur")
+		if err != nil {
+			return err
+		}
+		if ci.NumWaiting != 2 {
+			return fmt.Errorf("expected 2 waiting, got %d", ci.NumWaiting)
+		}
+		return nil
+	})
+
+	// Messages are handed out to the remaining requests in turn, not all to the last one.
+	for i := 0; i < 4; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+	for _, seqs := range [][]uint64{nil, {1, 3}, {2, 4}} {
+		sub := subs[0]
+		subs = subs[1:]
+		for _, seq := range seqs {
+			m := natsNexMsg(t, sub, time.Second)
+			sseq, _, _ := ackReplyInfo(m.Reply)
+			require_True(t, sseq == seq)
+		}
+		if m, err := sub.NextMsg(100 * time.Millisecond); err == nil {
+			t.Fatalf("Unexpected message on %q: %+v", sub.Subject, m)
+		}
+	}
+}
+
 ////////////////////////////////////////
 // Benchmark placeholders
 // TODO(dlc) - move
@@ -13772,26 +14006,96 @@ func TestJetStreamPullConsumerRequestMaximums(t *testing.T) {
 
 	rsubj := fmt.Sprintf(JSApiRequestNextT, "TEST", "dlc")
 
+	checkLimit := func(resp *nats.Msg, limit, value string) {
+		t.Helper()
+		if status := resp.Header.Get("Status"); status != "409" {
+			t.Fatalf("Expected a 409 status code, got %q", status)
+		}
+		require_Equal(t, resp.Header.Get(JSPullRequestLimit), limit)
+		require_Equal(t, resp.Header.Get(JSPullRequestLimitValue), value)
+	}
+
 	// Exceeds max batch size.
 	resp, err := nc.Request(rsubj, genReq(11, 0, 100*time.Millisecond), time.Second)
 	require_NoError(t, err)
-	if status := resp.Header.Get("Status"); status != "409" {
-		t.Fatalf("Expected a 409 status code, got %q", status)
-	}
+	checkLimit(resp, "max_batch", "10")
 
 	// Exceeds max expires.
 	resp, err = nc.Request(rsubj, genReq(1, 0, 10*time.Minute), time.Second)
 	require_NoError(t, err)
-	if status := resp.Header.Get("Status"); status != "409" {
-		t.Fatalf("Expected a 409 status code, got %q", status)
-	}
+	checkLimit(resp, "max_expires", "1s")
 
 	// Exceeds max bytes.
-	resp, err = nc.Request(rsubj, genReq(10, 10_000*2, 10*time.Minute), time.Second)
+	resp, err = nc.Request(rsubj, genReq(10, 10_000*2, 100*time.Millisecond), time.Second)
 	require_NoError(t, err)
-	if status := resp.Header.Get("Status"); status != "409" {
-		t.Fatalf("Expected a 409 status code, got %q", status)
+	checkLimit(resp, "max_bytes", "10000")
+}
+
+func TestJetStreamPullConsumerServerRequestMaxBytesLimit(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: %q
+			limits: {max_request_batch: 100, max_request_max_bytes: 1024}
+		}
+	`, t.TempDir())))
+
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	// Pull consumers get the server limit by default.
+	ci, err := js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "dflt", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	require_True(t, ci.Config.MaxRequestMaxBytes == 1024)
+	require_True(t, ci.Config.MaxRequestBatch == 100)
+
+	// Lower limits are allowed.
+	ci, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "lower", AckPolicy: nats.AckExplicitPolicy, MaxRequestMaxBytes: 512})
+	require_NoError(t, err)
+	require_True(t, ci.Config.MaxRequestMaxBytes == 512)
+
+	// Higher or negative ones are not.
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "higher", AckPolicy: nats.AckExplicitPolicy, MaxRequestMaxBytes: 2048})
+	require_Error(t, err, NewJSConsumerMaxRequestMaxBytesExceededError(1024))
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "negative", AckPolicy: nats.AckExplicitPolicy, MaxRequestMaxBytes: -1})
+	require_Error(t, err, NewJSConsumerMaxRequestMaxBytesNegativeError())
+
+	// Push consumers are not affected.
+	ci, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "push", DeliverSubject: "bar", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	require_True(t, ci.Config.MaxRequestMaxBytes == 0)
+
+	// Requests over the default limit are rejected.
+	req, err := json.Marshal(&JSApiConsumerGetNextRequest{Batch: 1, MaxBytes: 4096, Expires: 100 * time.Millisecond})
+	require_NoError(t, err)
+	resp, err := nc.Request(fmt.Sprintf(JSApiRequestNextT, "TEST", "dflt"), req, time.Second)
+	require_NoError(t, err)
+	require_Equal(t, resp.Header.Get("Status"), "409")
+	require_Equal(t, resp.Header.Get(JSPullRequestLimit), "max_bytes")
+	require_Equal(t, resp.Header.Get(JSPullRequestLimitValue), "1024")
+
+	// Requests without max bytes get the limit.
+	for i := 0; i < 5; i++ {
+		_, err = js.Publish("foo", make([]byte, 400))
+		require_NoError(t, err)
+	}
+	req, err = json.Marshal(&JSApiConsumerGetNextRequest{Batch: 5, Expires: time.Second})
+	require_NoError(t, err)
+	sub := natsSubSync(t, nc, nats.NewInbox())
+	require_NoError(t, nc.PublishRequest(fmt.Sprintf(JSApiRequestNextT, "TEST", "dflt"), sub.Subject, req))
+	for i := 0; i < 2; i++ {
+		m := natsNexMsg(t, sub, time.Second)
+		require_True(t, len(m.Data) == 400)
 	}
+	m := natsNexMsg(t, sub, time.Second)
+	require_Equal(t, m.Header.Get("Status"), "409")
+	require_Equal(t, m.Header.Get("Description"), "Message Size Exceeds MaxBytes")
 }
 
 func TestJetStreamEphemeralPullConsumers(t *testing.T) {
@@ -16724,7 +17028,7 @@ func TestJetStreamDisabledHealthz(t *testing.T) {
 
 	s.DisableJetStream()
 
-	hs := s.healthz(&HealthzOptions{JSEnabledOnly: true})
+	hs := s.healthz(&HealthzOptions{})
 	if hs.Status == "unavailable" && hs.Error == NewJSNotEnabledError().Error() {
 		return
 	}
@@ -19784,3 +20088,6617 @@ func TestJetStreamConsumerAckFloorWithExpired(t *testing.T) {
 	require_True(t, ci.NumPending == 0)
 	require_True(t, ci.NumRedelivered == 0)
 }
+
+func TestJetStreamStorageForecast(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {max_mem_store: 64MB, max_file_store: 64MB, store_dir: %q, storage_forecast_alert: 1h}
+		accounts: {
+			A: { jetstream: {max_mem: 1MB, max_file: 1MB}, users: [ {user: a, password: pwd} ] }
+		}
+	`, t.TempDir())))
+	defer removeFile(t, conf)
+
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	require_True(t, opts.JetStreamFcastAlert == time.Hour)
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("a", "pwd"))
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	sub, err := nc.SubscribeSync(JSAdvisoryAccountStorageForecast)
+	require_NoError(t, err)
+	require_NoError(t, nc.Flush())
+
+	// Drive the forecasts directly so we control the elapsed time.
+	sjs := s.getJetStream()
+	now := time.Now()
+	sjs.checkStorageForecast(now)
+
+	msg := bytes.Repeat([]byte("Z"), 1024)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", msg)
+		require_NoError(t, err)
+	}
+	sjs.checkStorageForecast(now.Add(time.Second))
+
+	am, err := sub.NextMsg(time.Second)
+	require_NoError(t, err)
+	var adv JSStorageForecastAdvisory
+	require_NoError(t, json.Unmarshal(am.Data, &adv))
+	require_True(t, adv.Type == JSStorageForecastAdvisoryType)
+	require_True(t, adv.Account == "A")
+	require_True(t, adv.Storage == FileStorage)
+	require_True(t, adv.Limit == 1024*1024)
+	require_True(t, adv.Rate > 0)
+	require_True(t, adv.TimeToFull > 0 && adv.TimeToFull < time.Hour)
+
+	// Should only alert once while below the threshold.
+	sjs.checkStorageForecast(now.Add(2 * time.Second))
+	_, err = sub.NextMsg(250 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	jsz, err := s.Jsz(&JSzOptions{Accounts: true, Streams: true})
+	require_NoError(t, err)
+	require_True(t, len(jsz.AccountDetails) == 1)
+	ad := jsz.AccountDetails[0]
+	require_True(t, ad.StoreTimeToFull > 0)
+	require_True(t, ad.MemoryTimeToFull == 0)
+	require_True(t, len(ad.Streams) == 1)
+	require_True(t, ad.Streams[0].IngestRate > 0)
+	require_True(t, jsz.StoreTimeToFull > 0)
+}
+
+func TestJetStreamStreamIngestRate(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, _ := jsClientConnect(t, s)
+	defer nc.Close()
+
+	// Mirrors can not be throttled.
+	_, apiErr := addStreamWithError(t, nc, &StreamConfig{
+		Name:          "M",
+		Mirror:        &StreamSource{Name: "TEST"},
+		MaxIngestRate: &IngestRate{Msgs: 1},
+		Storage:       MemoryStorage,
+	})
+	require_True(t, apiErr != nil)
+
+	addStream(t, nc, &StreamConfig{
+		Name:          "TEST",
+		Subjects:      []string{"foo"},
+		MaxIngestRate: &IngestRate{Msgs: 5},
+		Storage:       MemoryStorage,
+	})
+
+	// Publishers can not pass as a source of the stream.
+	m := nats.NewMsg("foo")
+	m.Header.Set(JSStreamSource, "ORIGIN 1 > >")
+	m.Data = []byte("OK")
+
+	var throttled int
+	for i := 0; i < 10; i++ {
+		rmsg, err := nc.RequestMsg(m, time.Second)
+		require_NoError(t, err)
+		var resp JSPubAckResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		if resp.Error != nil {
+			require_True(t, resp.Error.ErrCode == uint16(JSStreamIngestThrottledErr))
+			throttled++
+		}
+	}
+	require_True(t, throttled == 5)
+
+	// Now switch to delaying acks.
+	addStream(t, nc, &StreamConfig{
+		Name:          "DELAY",
+		Subjects:      []string{"bar"},
+		MaxIngestRate: &IngestRate{Msgs: 2, Delay: true},
+		Storage:       MemoryStorage,
+	})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		rmsg, err := nc.Request("bar", []byte("OK"), 2*time.Second)
+		require_NoError(t, err)
+		var resp JSPubAckResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		require_True(t, resp.Error == nil)
+	}
+	// The third should have been delayed until the window ended.
+	require_True(t, time.Since(start) >= 500*time.Millisecond)
+
+	mset, err := s.GlobalAccount().lookupStream("DELAY")
+	require_NoError(t, err)
+	require_True(t, mset.state().Msgs == 3)
+}
+
+func TestJetStreamConsumerBindToken(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	o, err := mset.addConsumer(&ConsumerConfig{
+		Durable:   "d",
+		AckPolicy: AckExplicit,
+		BindToken: "s3cr3t",
+	})
+	require_NoError(t, err)
+	defer o.delete()
+
+	// Without the token we should be rejected.
+	m, err := nc.Request(o.requestNextMsgSubject(), nil, time.Second)
+	require_NoError(t, err)
+	require_True(t, m.Header.Get("Status") == "403")
+
+	// Only the hash of the token is kept and returned.
+	hash := o.info().Config.BindToken
+	require_True(t, hash != _EMPTY_ && !strings.Contains(hash, "s3cr3t"))
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiConsumerInfoT, "TEST", "d"), nil, time.Second)
+	require_NoError(t, err)
+	require_True(t, strings.Contains(string(rmsg.Data), hash))
+	require_False(t, strings.Contains(string(rmsg.Data), "s3cr3t"))
+
+	// Same for a bad token, or the hash.
+	req := nats.NewMsg(o.requestNextMsgSubject())
+	for _, bad := range []string{"bad", hash} {
+		req.Header.Set(JSConsumerToken, bad)
+		m, err = nc.RequestMsg(req, time.Second)
+		require_NoError(t, err)
+		require_True(t, m.Header.Get("Status") == "403")
+	}
+
+	// Creating the consumer again with the same token is fine.
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "d", AckPolicy: AckExplicit, BindToken: "s3cr3t"})
+	require_NoError(t, err)
+
+	req.Header.Set(JSConsumerToken, "s3cr3t")
+	m, err = nc.RequestMsg(req, time.Second)
+	require_NoError(t, err)
+	require_True(t, string(m.Data) == "OK")
+
+	// Acks without the token should be ignored.
+	require_NoError(t, m.Ack())
+	require_NoError(t, nc.Flush())
+	time.Sleep(100 * time.Millisecond)
+	require_True(t, o.info().NumAckPending == 1)
+
+	ack := nats.NewMsg(m.Reply)
+	ack.Header.Set(JSConsumerToken, "s3cr3t")
+	require_NoError(t, nc.PublishMsg(ack))
+	checkFor(t, time.Second, 50*time.Millisecond, func() error {
+		if n := o.info().NumAckPending; n != 0 {
+			return fmt.Errorf("expected no acks pending, got %d", n)
+		}
+		return nil
+	})
+}
+
+func TestJetStreamAdminAuditTrail(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q, audit: true}
+		accounts: {
+			A: { jetstream: enabled, users: [ {user: a, password: pwd} ] }
+			$SYS: { users: [ {user: admin, password: s3cr3t!} ] }
+		}
+	`, t.TempDir())))
+	defer removeFile(t, conf)
+
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	// Returns the entries in the audit stream once it holds the expected number.
+	getEntries := func(expected int) []*JSAdminAudit {
+		t.Helper()
+		ncsys, jsys := jsClientConnect(t, s, nats.UserInfo("admin", "s3cr3t!"))
+		defer ncsys.Close()
+		checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+			si, err := jsys.StreamInfo(JSAdminAuditStream)
+			if err != nil {
+				return err
+			}
+			if si.State.Msgs != uint64(expected) {
+				return fmt.Errorf("expected %d entries, got %d", expected, si.State.Msgs)
+			}
+			return nil
+		})
+		var entries []*JSAdminAudit
+		for seq := uint64(1); seq <= uint64(expected); seq++ {
+			m, err := jsys.GetMsg(JSAdminAuditStream, seq)
+			require_NoError(t, err)
+			require_True(t, m.Subject == fmt.Sprintf(JSAdminAuditT, "A"))
+			var entry JSAdminAudit
+			require_NoError(t, json.Unmarshal(m.Data, &entry))
+			entries = append(entries, &entry)
+		}
+		return entries
+	}
+	getEntries(0)
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("a", "pwd"))
+	defer nc.Close()
+
+	// Stream names matching read only API tokens do not hide administrative actions.
+	_, err := js.AddStream(&nats.StreamConfig{Name: "LIST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	// Read only requests should not be part of the audit trail.
+	_, err = js.StreamInfo("LIST")
+	require_NoError(t, err)
+	require_NoError(t, js.DeleteStream("LIST"))
+	_, err = js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"bar"}})
+	require_NoError(t, err)
+	nc.Close()
+	getEntries(3)
+
+	// The chain continues after a restart.
+	s.Shutdown()
+	s, _ = RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js = jsClientConnect(t, s, nats.UserInfo("a", "pwd"))
+	defer nc.Close()
+	require_NoError(t, js.DeleteStream("TEST"))
+
+	entries := getEntries(4)
+	require_True(t, entries[0].Subject == fmt.Sprintf(JSApiStreamCreateT, "LIST"))
+	require_True(t, entries[1].Subject == fmt.Sprintf(JSApiStreamDeleteT, "LIST"))
+	require_True(t, entries[2].Subject == fmt.Sprintf(JSApiStreamCreateT, "TEST"))
+	require_True(t, entries[3].Subject == fmt.Sprintf(JSApiStreamDeleteT, "TEST"))
+	require_True(t, entries[0].Client != nil && entries[0].Client.User == "a")
+
+	// Verify the hash chain.
+	var prev string
+	for i, entry := range entries {
+		require_True(t, entry.Seq == uint64(i+1))
+		require_True(t, entry.PrevHash == prev)
+		hash := entry.Hash
+		entry.Hash = _EMPTY_
+		b, err := json.Marshal(entry)
+		require_NoError(t, err)
+		h := sha256.Sum256(b)
+		require_True(t, hex.EncodeToString(h[:]) == hash)
+		prev = hash
+	}
+}
+
+func TestJetStreamMsgGetStartTime(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo", "bar"}, AllowDirect: true})
+	require_NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+		_, err = js.Publish("bar", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	getMsg := func(req *JSApiMsgGetRequest) *JSApiMsgGetResponse {
+		t.Helper()
+		b, _ := json.Marshal(req)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiMsgGetT, "TEST"), b, time.Second)
+		require_NoError(t, err)
+		var resp JSApiMsgGetResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+
+	resp := getMsg(&JSApiMsgGetRequest{StartTime: &start})
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Message.Sequence == 4)
+
+	resp = getMsg(&JSApiMsgGetRequest{StartTime: &start, NextFor: "bar"})
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Message.Sequence == 5)
+
+	// Can not be combined with a sequence.
+	resp = getMsg(&JSApiMsgGetRequest{StartTime: &start, Seq: 1})
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSBadRequestErr))
+
+	future := time.Now().Add(time.Hour)
+	resp = getMsg(&JSApiMsgGetRequest{StartTime: &future})
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSNoMessageFoundErr))
+
+	// Direct get as well.
+	b, _ := json.Marshal(&JSApiMsgGetRequest{StartTime: &start})
+	rmsg, err := nc.Request(fmt.Sprintf(JSDirectMsgGetT, "TEST"), b, time.Second)
+	require_NoError(t, err)
+	require_True(t, rmsg.Header.Get(JSSequence) == "4")
+}
+
+func TestJetStreamConsumerPauseAck(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	asub, err := nc.SubscribeSync(JSAdvisoryConsumerPausedPre + ".TEST.dlc")
+	require_NoError(t, err)
+	require_NoError(t, nc.Flush())
+
+	sub, err := js.PullSubscribe("foo", "dlc", nats.AckWait(time.Minute))
+	require_NoError(t, err)
+
+	msgs, err := sub.Fetch(1)
+	require_NoError(t, err)
+	require_NoError(t, msgs[0].Respond([]byte("+PAUSE 500ms")))
+	start := time.Now()
+
+	am, err := asub.NextMsg(time.Second)
+	require_NoError(t, err)
+	var adv JSConsumerPausedAdvisory
+	require_NoError(t, json.Unmarshal(am.Data, &adv))
+	require_True(t, adv.Type == JSConsumerPausedAdvisoryType)
+	require_True(t, adv.StreamSeq == 1)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	o := mset.lookupConsumer("dlc")
+	require_True(t, o != nil)
+	require_True(t, o.info().PausedUntil != nil)
+
+	// Nothing should be delivered while paused.
+	_, err = sub.Fetch(1, nats.MaxWait(250*time.Millisecond))
+	require_Error(t, err, nats.ErrTimeout)
+
+	// Once resumed the paused message should be redelivered.
+	msgs, err = sub.Fetch(1, nats.MaxWait(2*time.Second))
+	require_NoError(t, err)
+	require_True(t, time.Since(start) >= 500*time.Millisecond)
+	meta, err := msgs[0].Metadata()
+	require_NoError(t, err)
+	require_True(t, meta.Sequence.Stream == 1)
+	require_True(t, meta.NumDelivered == 2)
+	require_True(t, o.info().PausedUntil == nil)
+}
+
+func TestJetStreamInternalPublish(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	pa, err := s.JetStreamPublish(globalAccountName, "foo", map[string]string{"X-Test": "ok"}, []byte("HELLO"), time.Second)
+	require_NoError(t, err)
+	require_True(t, pa.Stream == "TEST")
+	require_True(t, pa.Sequence == 1)
+
+	m, err := js.GetMsg("TEST", 1)
+	require_NoError(t, err)
+	require_True(t, string(m.Data) == "HELLO")
+	require_True(t, m.Header.Get("X-Test") == "ok")
+
+	// Dedupe applies as usual.
+	hdr := map[string]string{JSMsgId: "1"}
+	_, err = s.JetStreamPublish(globalAccountName, "foo", hdr, []byte("HELLO"), time.Second)
+	require_NoError(t, err)
+	pa, err = s.JetStreamPublish(globalAccountName, "foo", hdr, []byte("HELLO"), time.Second)
+	require_NoError(t, err)
+	require_True(t, pa.Duplicate)
+
+	// Errors from the stream are returned.
+	_, err = s.JetStreamPublish(globalAccountName, "foo", map[string]string{JSExpectedLastSeq: "22"}, []byte("HELLO"), time.Second)
+	require_Error(t, err, NewJSStreamWrongLastSequenceError(2))
+
+	// No stream for this subject.
+	_, err = s.JetStreamPublish(globalAccountName, "bar", nil, []byte("HELLO"), time.Second)
+	require_Error(t, err, NewJSStreamNotFoundError())
+
+	_, err = s.JetStreamPublish("NOPE", "foo", nil, []byte("HELLO"), time.Second)
+	require_Error(t, err, ErrMissingAccount)
+}
+
+func TestJetStreamHooks(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	var mu sync.Mutex
+	var events []string
+	add := func(format string, args ...interface{}) {
+		mu.Lock()
+		events = append(events, fmt.Sprintf(format, args...))
+		mu.Unlock()
+	}
+	s.SetJetStreamHooks(&JetStreamHooks{
+		StreamCreated:   func(acc, stream string) { add("created %s > %s", acc, stream) },
+		StreamDeleted:   func(acc, stream string) { add("deleted %s > %s", acc, stream) },
+		ConsumerCreated: func(acc, stream, consumer string) { add("consumer %s > %s > %s", acc, stream, consumer) },
+		MsgStored:       func(acc, stream, subject string, seq uint64) { add("stored %s > %s %s %d", acc, stream, subject, seq) },
+		LimitExceeded:   func(acc, stream string, err error) { add("limit %s > %s: %v", acc, stream, err) },
+	})
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:     "TEST",
+		Subjects: []string{"foo"},
+		MaxMsgs:  1,
+		Discard:  nats.DiscardNew,
+	})
+	require_NoError(t, err)
+
+	_, err = js.Publish("foo", []byte("HELLO"))
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("HELLO"))
+	require_Error(t, err)
+
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "dlc", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+
+	require_NoError(t, js.DeleteStream("TEST"))
+
+	expected := []string{
+		"created $G > TEST",
+		"stored $G > TEST foo 1",
+		"limit $G > TEST: maximum messages exceeded",
+		"consumer $G > TEST > dlc",
+		"deleted $G > TEST",
+	}
+	checkFor(t, time.Second, 15*time.Millisecond, func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !reflect.DeepEqual(events, expected) {
+			return fmt.Errorf("Expected events %q, got %q", expected, events)
+		}
+		return nil
+	})
+
+	// Removing the hooks stops notifications.
+	s.SetJetStreamHooks(nil)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	mu.Lock()
+	defer mu.Unlock()
+	require_True(t, len(events) == len(expected))
+}
+
+func TestJetStreamConsumerWebhook(t *testing.T) {
+	type post struct {
+		subject, seq, delivered, foo string
+		body                         string
+	}
+	posts := make(chan post, 10)
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		posts <- post{r.Header.Get(JSWebhookSubject), r.Header.Get(JSWebhookStreamSeq), r.Header.Get(JSWebhookDelivered), r.Header.Get("Foo"), string(body)}
+		switch {
+		case r.Header.Get(JSWebhookSubject) == "bar":
+			w.WriteHeader(http.StatusBadRequest)
+		case atomic.AddInt32(&calls, 1) == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer ts.Close()
+	whURL := ts.URL + "/hooks/c"
+
+	// Local targets are refused by default.
+	for _, u := range []string{whURL, "http://localhost/hooks", "http://169.254.169.254/latest", "http://[::1]:8080/", "http://[::ffff:169.254.169.254]/"} {
+		require_Error(t, checkWebhookTarget(u, nil))
+		require_Error(t, checkWebhookTarget(u, &JSWebhookOpts{Allow: []string{u}}))
+		require_Error(t, checkWebhookTarget(u, &JSWebhookOpts{AllowPrivate: true}))
+	}
+	// As are private ones.
+	for _, u := range []string{"http://10.0.0.1/hooks", "http://192.168.1.1/", "http://172.16.0.1/", "http://100.64.0.1/", "http://[fd00::1]/"} {
+		require_Error(t, checkWebhookTarget(u, nil))
+		require_Error(t, checkWebhookTarget(u, &JSWebhookOpts{AllowLocal: true}))
+		require_NoError(t, checkWebhookTarget(u, &JSWebhookOpts{AllowPrivate: true}))
+	}
+	require_NoError(t, checkWebhookTarget("https://hooks.example.com/c", nil))
+	// Also when names resolve to them.
+	require_Error(t, webhookDialControl(nil)("tcp", "127.0.0.1:8080", nil))
+	require_Error(t, webhookDialControl(nil)("tcp", "10.1.2.3:443", nil))
+	require_Error(t, webhookDialControl(&JSWebhookOpts{AllowPrivate: true})("tcp", "169.254.169.254:80", nil))
+	require_NoError(t, webhookDialControl(&JSWebhookOpts{AllowLocal: true})("tcp", "127.0.0.1:8080", nil))
+	require_NoError(t, webhookDialControl(nil)("tcp", "93.184.216.34:443", nil))
+
+	opts := DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	opts.JetStreamWebhooks = &JSWebhookOpts{Allow: []string{ts.URL + "/hooks"}, AllowLocal: true}
+	s := RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo", "bar"}})
+	require_NoError(t, err)
+
+	// Check config errors.
+	req := func(cfg *ConsumerConfig) *ApiError {
+		t.Helper()
+		data, _ := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: *cfg})
+		resp, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", cfg.Durable), data, time.Second)
+		require_NoError(t, err)
+		var ccResp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &ccResp))
+		return ccResp.Error
+	}
+	for _, cfg := range []*ConsumerConfig{
+		{Durable: "C", Webhook: whURL, AckPolicy: AckExplicit},
+		{Durable: "C", Webhook: whURL, AckPolicy: AckNone, DeliverSubject: "d"},
+		{Durable: "C", Webhook: "ftp://localhost", AckPolicy: AckExplicit, DeliverSubject: "d"},
+		{Durable: "C", Webhook: whURL, AckPolicy: AckExplicit, DeliverSubject: "d", FlowControl: true, Heartbeat: time.Second},
+		// Not in the allowed urls.
+		{Durable: "C", Webhook: ts.URL + "/other", AckPolicy: AckExplicit, DeliverSubject: "d"},
+		{Durable: "C", Webhook: "https://hooks.example.com/hooks", AckPolicy: AckExplicit, DeliverSubject: "d"},
+	} {
+		apiErr := req(cfg)
+		require_True(t, apiErr != nil)
+		require_True(t, apiErr.ErrCode == uint16(JSConsumerInvalidWebhookErr))
+	}
+
+	apiErr := req(&ConsumerConfig{
+		Durable:        "C",
+		Webhook:        whURL,
+		DeliverSubject: "d",
+		AckPolicy:      AckExplicit,
+		BackOff:        []time.Duration{50 * time.Millisecond},
+		MaxDeliver:     5,
+	})
+	require_True(t, apiErr == nil)
+
+	m := nats.NewMsg("foo")
+	m.Header.Set("Foo", "Bar")
+	m.Data = []byte("HELLO")
+	_, err = js.PublishMsg(m)
+	require_NoError(t, err)
+
+	getPost := func() post {
+		t.Helper()
+		select {
+		case p := <-posts:
+			return p
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Did not receive webhook request")
+		}
+		return post{}
+	}
+	// First will fail and be redelivered.
+	p := getPost()
+	require_True(t, p.subject == "foo" && p.seq == "1" && p.delivered == "1" && p.foo == "Bar" && p.body == "HELLO")
+	p = getPost()
+	require_True(t, p.subject == "foo" && p.seq == "1" && p.delivered == "2")
+
+	// A 4xx terminates.
+	_, err = js.Publish("bar", []byte("HELLO"))
+	require_NoError(t, err)
+	p = getPost()
+	require_True(t, p.subject == "bar" && p.seq == "2")
+
+	checkFor(t, 2*time.Second, 15*time.Millisecond, func() error {
+		ci, err := js.ConsumerInfo("TEST", "C")
+		if err != nil {
+			return err
+		}
+		if ci.AckFloor.Stream != 2 || ci.NumAckPending != 0 {
+			return fmt.Errorf("Unexpected consumer info: %+v", ci)
+		}
+		return nil
+	})
+	select {
+	case p := <-posts:
+		t.Fatalf("Unexpected webhook request: %+v", p)
+	case <-time.After(250 * time.Millisecond):
+	}
+}
+
+func TestJetStreamBulkLoad(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo.*"}})
+	require_NoError(t, err)
+
+	dir := t.TempDir()
+	jfile := filepath.Join(dir, "msgs.json")
+	require_NoError(t, os.WriteFile(jfile, []byte(`{"subject":"foo.1","data":"SEVMTE8="}
+
+{"subject":"foo.2","headers":{"Nats-Msg-Id":"22","X-Test":"ok"},"data":"V09STEQ="}
+{"subject":"foo.2","headers":{"Nats-Msg-Id":"22"},"data":"V09STEQ="}
+`), 0644))
+
+	n, err := s.JetStreamBulkLoad(globalAccountName, "TEST", jfile, BulkLoadJSON)
+	require_NoError(t, err)
+	require_True(t, n == 2)
+
+	m, err := js.GetMsg("TEST", 2)
+	require_NoError(t, err)
+	require_True(t, m.Subject == "foo.2" && string(m.Data) == "WORLD")
+	require_True(t, m.Header.Get("X-Test") == "ok")
+
+	// Loading again will skip the duplicate.
+	n, err = s.JetStreamBulkLoad(globalAccountName, "TEST", jfile, BulkLoadJSON)
+	require_NoError(t, err)
+	require_True(t, n == 1)
+
+	var buf bytes.Buffer
+	addRecord := func(parts ...string) {
+		for _, p := range parts {
+			var lb [4]byte
+			binary.BigEndian.PutUint32(lb[:], uint32(len(p)))
+			buf.Write(lb[:])
+			buf.WriteString(p)
+		}
+	}
+	addRecord("foo.3", _EMPTY_, "BINARY")
+	addRecord("foo.3", "NATS/1.0\r\nX-Test: bin\r\n\r\n", "BINARY")
+	addRecord("bar", _EMPTY_, "BAD")
+	bfile := filepath.Join(dir, "msgs.bin")
+	require_NoError(t, os.WriteFile(bfile, buf.Bytes(), 0644))
+
+	n, err = s.JetStreamBulkLoad(globalAccountName, "TEST", bfile, BulkLoadBinary)
+	require_Error(t, err)
+	require_True(t, strings.Contains(err.Error(), "record 3"))
+	require_True(t, n == 2)
+
+	m, err = js.GetMsg("TEST", 5)
+	require_NoError(t, err)
+	require_True(t, m.Subject == "foo.3" && string(m.Data) == "BINARY")
+	require_True(t, m.Header.Get("X-Test") == "bin")
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 5)
+
+	// Truncated records are an error.
+	require_NoError(t, os.WriteFile(bfile, buf.Bytes()[:10], 0644))
+	_, err = s.JetStreamBulkLoad(globalAccountName, "TEST", bfile, BulkLoadBinary)
+	require_Error(t, err)
+
+	_, err = s.JetStreamBulkLoad(globalAccountName, "NOPE", jfile, BulkLoadJSON)
+	require_Error(t, err, NewJSStreamNotFoundError())
+}
+
+func TestJetStreamBulkLoadRequest(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q}
+		accounts: {
+			A: {jetstream: enabled, users: [{user: a, password: a}]}
+			$SYS: {users: [{user: admin, password: s3cr3t!}]}
+		}
+	`, t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("a", "a"))
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo.*"}})
+	require_NoError(t, err)
+
+	jfile := filepath.Join(t.TempDir(), "msgs.json")
+	require_NoError(t, os.WriteFile(jfile, []byte(`{"subject":"foo.1","data":"SEVMTE8="}
+{"subject":"foo.2","data":"V09STEQ="}
+{"subject":"bar","data":"QkFE"}
+`), 0644))
+
+	ncsys := natsConnect(t, s.ClientURL(), nats.UserInfo("admin", "s3cr3t!"))
+	defer ncsys.Close()
+
+	bulkLoad := func(stream string, req *JSApiStreamBulkLoadRequest) (*JSApiStreamBulkLoadResponse, error) {
+		t.Helper()
+		b, _ := json.Marshal(req)
+		rmsg, err := ncsys.Request(fmt.Sprintf(JSApiServerStreamBulkLoadT, "A", stream), b, time.Second)
+		if err != nil {
+			return nil, err
+		}
+		var resp JSApiStreamBulkLoadResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp, nil
+	}
+
+	resp, err := bulkLoad("TEST", &JSApiStreamBulkLoadRequest{Path: jfile, Format: BulkLoadJSON})
+	require_NoError(t, err)
+	require_True(t, resp.Error != nil)
+	require_True(t, strings.Contains(resp.Error.Description, "record 3"))
+	require_True(t, resp.Stored == 2)
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 2)
+
+	// Needs a file.
+	resp, err = bulkLoad("TEST", &JSApiStreamBulkLoadRequest{})
+	require_NoError(t, err)
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSInvalidJSONErr))
+
+	// Servers without the stream do not respond.
+	_, err = bulkLoad("NOPE", &JSApiStreamBulkLoadRequest{Path: jfile})
+	require_Error(t, err, nats.ErrTimeout)
+
+	// Only works from the system account.
+	b, _ := json.Marshal(&JSApiStreamBulkLoadRequest{Path: jfile})
+	_, err = nc.Request(fmt.Sprintf(JSApiServerStreamBulkLoadT, "A", "TEST"), b, 250*time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+}
+
+func TestJetStreamStreamBatch(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.*"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "OUTBOX", Subjects: []string{"outbox.*"}})
+	require_NoError(t, err)
+
+	batch := func(req *JSApiStreamBatchRequest) *JSApiStreamBatchResponse {
+		t.Helper()
+		data, _ := json.Marshal(req)
+		rmsg, err := nc.Request(JSApiStreamBatch, data, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamBatchResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+
+	resp := batch(&JSApiStreamBatchRequest{ID: "T1", Msgs: []*JSApiBatchMsg{
+		{Subject: "orders.new", Data: []byte("ORDER")},
+		{Subject: "outbox.orders", Header: []byte("NATS/1.0\r\nX-Test: ok\r\n\r\n"), Data: []byte("EVENT")},
+		{Subject: "orders.new", Data: []byte("ORDER")},
+	}})
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.ID == "T1")
+	require_True(t, len(resp.Acks) == 3)
+	require_True(t, resp.Acks[0].Stream == "ORDERS" && resp.Acks[0].Sequence == 1)
+	require_True(t, resp.Acks[1].Stream == "OUTBOX" && resp.Acks[1].Sequence == 1)
+	require_True(t, resp.Acks[2].Stream == "ORDERS" && resp.Acks[2].Sequence == 2)
+
+	m, err := js.GetMsg("OUTBOX", 1)
+	require_NoError(t, err)
+	require_True(t, m.Header.Get(JSBatchId) == "T1")
+	require_True(t, m.Header.Get("X-Test") == "ok")
+
+	// The second message will be rejected, so the first should be removed.
+	resp = batch(&JSApiStreamBatchRequest{ID: "T2", Msgs: []*JSApiBatchMsg{
+		{Subject: "orders.new", Data: []byte("ORDER")},
+		{Subject: "outbox.orders", Header: []byte("NATS/1.0\r\nNats-Expected-Last-Sequence: 22\r\n\r\n"), Data: []byte("EVENT")},
+	}})
+	require_True(t, resp.Error != nil)
+	require_True(t, resp.Error.ErrCode == uint16(JSStreamBatchFailedErr))
+
+	si, err := js.StreamInfo("ORDERS")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 2)
+	si, err = js.StreamInfo("OUTBOX")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 1)
+
+	// Nothing is stored if a subject has no stream.
+	resp = batch(&JSApiStreamBatchRequest{ID: "T3", Msgs: []*JSApiBatchMsg{
+		{Subject: "orders.new", Data: []byte("ORDER")},
+		{Subject: "nope", Data: []byte("EVENT")},
+	}})
+	require_True(t, resp.Error != nil)
+	require_True(t, resp.Error.ErrCode == uint16(JSStreamBatchFailedErr))
+	si, err = js.StreamInfo("ORDERS")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 2)
+
+	// Requires a batch ID.
+	resp = batch(&JSApiStreamBatchRequest{Msgs: []*JSApiBatchMsg{{Subject: "orders.new"}}})
+	require_True(t, resp.Error != nil)
+	require_True(t, resp.Error.ErrCode == uint16(JSBadRequestErr))
+}
+
+func TestJetStreamConsumerOrderedReset(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	create := func(cfg *ConsumerConfig) *JSApiConsumerCreateResponse {
+		t.Helper()
+		data, _ := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: *cfg})
+		subj := fmt.Sprintf(JSApiConsumerCreateT, "TEST")
+		if cfg.Durable != _EMPTY_ {
+			subj = fmt.Sprintf(JSApiDurableCreateT, "TEST", cfg.Durable)
+		}
+		resp, err := nc.Request(subj, data, time.Second)
+		require_NoError(t, err)
+		var ccResp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &ccResp))
+		return &ccResp
+	}
+
+	// Check config errors.
+	for _, cfg := range []*ConsumerConfig{
+		{Ordered: true},
+		{Ordered: true, DeliverSubject: "d", AckPolicy: AckExplicit},
+		{Ordered: true, DeliverSubject: "d", Durable: "dlc"},
+	} {
+		resp := create(cfg)
+		require_True(t, resp.Error != nil)
+		require_True(t, resp.Error.ErrCode == uint16(JSConsumerInvalidOrderedErr))
+	}
+
+	sub, err := nc.SubscribeSync("d")
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+
+	resp := create(&ConsumerConfig{Ordered: true, DeliverSubject: "d", Heartbeat: 100 * time.Millisecond})
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Config.FlowControl)
+
+	for i := 0; i < 5; i++ {
+		_, err = js.Publish("foo", []byte("HELLO"))
+		require_NoError(t, err)
+	}
+
+	// Returns the next consumer sequence, responding to flow control if asked.
+	next := func(respond bool) uint64 {
+		t.Helper()
+		for {
+			m, err := sub.NextMsg(2 * time.Second)
+			require_NoError(t, err)
+			if len(m.Data) == 0 && m.Header.Get("Status") == "100" {
+				if m.Reply != _EMPTY_ && respond {
+					m.Respond(nil)
+				}
+				continue
+			}
+			_, dseq, _, _, _ := replyInfo(m.Reply)
+			return dseq
+		}
+	}
+	for i := uint64(1); i <= 5; i++ {
+		require_True(t, next(true) == i)
+	}
+
+	// Wait for the heartbeat based flow control to confirm what we received.
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	o := mset.lookupConsumer(resp.Name)
+	require_True(t, o != nil)
+	checkFor(t, 2*time.Second, 25*time.Millisecond, func() error {
+		// Keep answering flow control while we wait.
+		if m, err := sub.NextMsg(50 * time.Millisecond); err == nil && m.Reply != _EMPTY_ {
+			m.Respond(nil)
+		}
+		o.mu.RLock()
+		defer o.mu.RUnlock()
+		if o.ordDseq != 5 {
+			return fmt.Errorf("Expected confirmed sequence 5, got %d", o.ordDseq)
+		}
+		return nil
+	})
+
+	// Now receive more but do not respond to flow control. We should be rewound
+	// and see the same consumer sequences again.
+	for i := 0; i < 3; i++ {
+		_, err = js.Publish("foo", []byte("HELLO"))
+		require_NoError(t, err)
+	}
+	for i := uint64(6); i <= 8; i++ {
+		require_True(t, next(false) == i)
+	}
+	require_True(t, next(false) == 6)
+}
+
+func TestJetStreamAccountEncryptionKey(t *testing.T) {
+	tmpl := `
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: '%s'}
+		accounts: {
+			A: { jetstream: {key: %q}, users: [ {user: a, password: pwd} ] }
+			B: { jetstream: enabled, users: [ {user: b, password: pwd} ] }
+		}
+	`
+	storeDir := t.TempDir()
+	conf := createConfFile(t, []byte(fmt.Sprintf(tmpl, storeDir, "s3cr3t!!")))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	msg := []byte("ENCRYPTED PAYLOAD!!")
+	for _, user := range []string{"a", "b"} {
+		nc, js := jsClientConnect(t, s, nats.UserInfo(user, "pwd"))
+		_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+		require_NoError(t, err)
+		for i := 0; i < 10; i++ {
+			_, err = js.Publish("foo", msg)
+			require_NoError(t, err)
+		}
+		nc.Close()
+	}
+
+	blk := func(acc string) []byte {
+		t.Helper()
+		sdir := filepath.Join(storeDir, JetStreamStoreDir, acc, streamsDir, "TEST")
+		_, err := os.Stat(filepath.Join(sdir, JetStreamMetaFileKey))
+		require_True(t, (err == nil) == (acc == "A"))
+		data, err := os.ReadFile(filepath.Join(sdir, msgDir, "1.blk"))
+		require_NoError(t, err)
+		return data
+	}
+	// Only account A should be encrypted.
+	require_False(t, bytes.Contains(blk("A"), msg))
+	require_True(t, bytes.Contains(blk("B"), msg))
+
+	checkMsgs := func(user string, expected uint64) {
+		t.Helper()
+		nc, js := jsClientConnect(t, s, nats.UserInfo(user, "pwd"))
+		defer nc.Close()
+		si, err := js.StreamInfo("TEST")
+		if expected == 0 {
+			require_Error(t, err)
+			return
+		}
+		require_NoError(t, err)
+		require_True(t, si.State.Msgs == expected)
+	}
+
+	// Restart and make sure we recover.
+	s.Shutdown()
+	s, _ = RunServerWithConfig(conf)
+	checkMsgs("a", 10)
+	checkMsgs("b", 10)
+
+	// The key can not be changed on reload, we keep using the old one.
+	reloadUpdateConfig(t, s, conf, fmt.Sprintf(tmpl, storeDir, "other"))
+	acc, err := s.LookupAccount("A")
+	require_NoError(t, err)
+	acc.mu.RLock()
+	key := acc.jsKey
+	acc.mu.RUnlock()
+	require_Equal(t, key, "s3cr3t!!")
+	checkMsgs("a", 10)
+
+	// With a different account key we can not recover the stream.
+	s.Shutdown()
+	conf = createConfFile(t, []byte(fmt.Sprintf(tmpl, storeDir, "other")))
+	s, _ = RunServerWithConfig(conf)
+	defer s.Shutdown()
+	checkMsgs("a", 0)
+	checkMsgs("b", 10)
+}
+
+func TestJetStreamStreamSchema(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	s.RegisterStreamValidator("no-secrets", func(stream, subject string, hdr, msg []byte) error {
+		if bytes.Contains(msg, []byte("secret")) {
+			return errors.New("payload contains a secret")
+		}
+		return nil
+	})
+
+	addStream := func(cfg *StreamConfig) *ApiError {
+		t.Helper()
+		req, err := json.Marshal(cfg)
+		require_NoError(t, err)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, cfg.Name), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return resp.Error
+	}
+
+	schema := json.RawMessage(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title": "Order",
+		"type": "object",
+		"required": ["id", "kind"],
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"kind": {"enum": ["a", "b"]},
+			"tags": {"type": "array", "items": {"type": "string", "maxLength": 3}}
+		}
+	}`)
+
+	// Bad configs.
+	cfg := &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: MemoryStorage, Schema: &StreamSchema{}}
+	require_True(t, addStream(cfg) != nil)
+	cfg.Schema = &StreamSchema{JSON: json.RawMessage(`{"type": "bogus"}`)}
+	require_True(t, addStream(cfg) != nil)
+	// Keywords we do not support, also nested.
+	cfg.Schema = &StreamSchema{JSON: json.RawMessage(`{"type": "string", "pattern": "^a"}`)}
+	require_True(t, addStream(cfg) != nil)
+	cfg.Schema = &StreamSchema{JSON: json.RawMessage(`{"properties": {"id": {"exclusiveMinimum": 0}}}`)}
+	require_True(t, addStream(cfg) != nil)
+	cfg.Schema = &StreamSchema{JSON: schema, InvalidSubject: "foo"}
+	require_True(t, addStream(cfg) != nil)
+
+	cfg.Schema = &StreamSchema{JSON: schema, Validator: "no-secrets"}
+	if apiErr := addStream(cfg); apiErr != nil {
+		t.Fatalf("Unexpected error: %v", apiErr)
+	}
+
+	_, err := js.Publish("foo", []byte(`{"id": 1, "kind": "a", "tags": ["x", "yz"]}`))
+	require_NoError(t, err)
+
+	for _, bad := range []string{
+		`not json`,
+		`{"id": 1}`,
+		`{"id": 0, "kind": "a"}`,
+		`{"id": 1.5, "kind": "a"}`,
+		`{"id": 1, "kind": "c"}`,
+		`{"id": 1, "kind": "a", "tags": ["long"]}`,
+		`{"id": 1, "kind": "a", "note": "secret"}`,
+	} {
+		_, err = js.Publish("foo", []byte(bad))
+		require_Error(t, err)
+		if !strings.Contains(err.Error(), "message failed validation") {
+			t.Fatalf("Unexpected error for %q: %v", bad, err)
+		}
+		// Also when passing as a sourced message.
+		m := nats.NewMsg("foo")
+		m.Header.Set(JSStreamSource, "ORIGIN 1 > >")
+		m.Data = []byte(bad)
+		_, err = js.PublishMsg(m)
+		require_Error(t, err)
+		if !strings.Contains(err.Error(), "message failed validation") {
+			t.Fatalf("Unexpected error for %q: %v", bad, err)
+		}
+	}
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 1)
+
+	// Now route invalid messages to another stream.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "INVALID", Subjects: []string{"invalid"}, Storage: nats.MemoryStorage})
+	require_NoError(t, err)
+
+	cfg.Schema.InvalidSubject = "invalid"
+	req, err := json.Marshal(cfg)
+	require_NoError(t, err)
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamUpdateT, cfg.Name), req, time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamUpdateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error)
+	}
+
+	pa, err := js.Publish("foo", []byte(`{"id": 1}`))
+	require_NoError(t, err)
+	require_True(t, pa.Stream == "INVALID")
+
+	m, err := js.GetMsg("INVALID", pa.Sequence)
+	require_NoError(t, err)
+	require_True(t, m.Header.Get(JSInvalidStream) == "TEST")
+	require_True(t, m.Header.Get(JSInvalidSubject) == "foo")
+	require_True(t, strings.Contains(m.Header.Get(JSInvalidReason), "missing required property"))
+	require_True(t, string(m.Data) == `{"id": 1}`)
+
+	si, err = js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 1)
+}
+
+func TestJetStreamConsumerLagMetrics(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	ari := consumerAckRateInterval
+	consumerAckRateInterval = 100 * time.Millisecond
+	defer func() { consumerAckRateInterval = ari }()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	sub, err := js.PullSubscribe("foo", "dlc", nats.AckExplicit())
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	o := mset.lookupConsumer("dlc")
+	require_True(t, o != nil)
+
+	// Take the first sample.
+	ci := o.info()
+	require_True(t, ci.Lag == 10)
+	require_True(t, ci.OldestPending == 0)
+	require_True(t, ci.AckRate == 0)
+
+	msgs, err := sub.Fetch(4)
+	require_NoError(t, err)
+	require_True(t, len(msgs) == 4)
+	for _, m := range msgs[:2] {
+		require_NoError(t, m.AckSync())
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	ci = o.info()
+	require_True(t, ci.Lag == 6)
+	require_True(t, ci.NumAckPending == 2)
+	require_True(t, ci.OldestPending >= 150*time.Millisecond)
+	require_True(t, ci.AckRate > 0)
+
+	// Make sure these show up in /jsz as well.
+	jsz, err := s.Jsz(&JSzOptions{Accounts: true, Streams: true, Consumer: true})
+	require_NoError(t, err)
+	require_True(t, len(jsz.AccountDetails) == 1)
+	require_True(t, len(jsz.AccountDetails[0].Streams) == 1)
+	cd := jsz.AccountDetails[0].Streams[0].Consumer
+	require_True(t, len(cd) == 1)
+	require_True(t, cd[0].Lag == 6)
+	require_True(t, cd[0].OldestPending > 0)
+}
+
+func TestJetStreamConsumerAckLatency(t *testing.T) {
+	var h ackLatencyHistogram
+	require_True(t, h.info() == nil)
+	for i := 0; i < 90; i++ {
+		h.record(500 * time.Microsecond)
+	}
+	for i := 0; i < 9; i++ {
+		h.record(3 * time.Millisecond)
+	}
+	h.record(time.Hour)
+	h.record(24 * time.Hour)
+	li := h.info()
+	require_True(t, li.Count == 101)
+	require_True(t, li.P50 == time.Millisecond)
+	require_True(t, li.P95 == 4*time.Millisecond)
+	require_True(t, li.P99 == ackLatencyMin<<(ackLatencyBuckets-1))
+
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 4; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	for _, ap := range []nats.SubOpt{nats.AckExplicit(), nats.AckAll()} {
+		sub, err := js.PullSubscribe("foo", "dlc", ap)
+		require_NoError(t, err)
+
+		mset, err := s.GlobalAccount().lookupStream("TEST")
+		require_NoError(t, err)
+		o := mset.lookupConsumer("dlc")
+		require_True(t, o != nil)
+		require_True(t, o.info().AckLatency == nil)
+
+		msgs, err := sub.Fetch(4)
+		require_NoError(t, err)
+		require_True(t, len(msgs) == 4)
+		time.Sleep(20 * time.Millisecond)
+		require_NoError(t, msgs[3].AckSync())
+
+		// Acking all acks the ones before as well.
+		expected := uint64(1)
+		if o.config().AckPolicy == AckAll {
+			expected = 4
+		}
+		li := o.info().AckLatency
+		require_True(t, li != nil)
+		require_True(t, li.Count == expected)
+		require_True(t, li.P50 >= 16*time.Millisecond && li.P99 <= time.Second)
+
+		// Shows up in /jsz as well.
+		jsz, err := s.Jsz(&JSzOptions{Accounts: true, Streams: true, Consumer: true})
+		require_NoError(t, err)
+		cd := jsz.AccountDetails[0].Streams[0].Consumer
+		require_True(t, len(cd) == 1 && cd[0].AckLatency != nil)
+		require_True(t, cd[0].AckLatency.Count == expected)
+
+		// Deletes the consumer as well.
+		require_NoError(t, sub.Unsubscribe())
+	}
+}
+
+func TestJetStreamConsumerAckAllSharedFloor(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 6; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{
+		Durable:   "dlc",
+		AckPolicy: nats.AckAllPolicy,
+		AckWait:   250 * time.Millisecond,
+	})
+	require_NoError(t, err)
+
+	// Two clients consuming from the same consumer.
+	nc2, js2 := jsClientConnect(t, s)
+	defer nc2.Close()
+	subA, err := js.PullSubscribe("foo", "dlc", nats.Bind("TEST", "dlc"))
+	require_NoError(t, err)
+	subB, err := js2.PullSubscribe("foo", "dlc", nats.Bind("TEST", "dlc"))
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	o := mset.lookupConsumer("dlc")
+	require_True(t, o != nil)
+
+	msgsA, err := subA.Fetch(2)
+	require_NoError(t, err)
+	require_True(t, len(msgsA) == 2)
+	msgsB, err := subB.Fetch(2)
+	require_NoError(t, err)
+	require_True(t, len(msgsB) == 2)
+
+	// An ack from any client advances the shared floor.
+	require_NoError(t, msgsB[1].AckSync())
+	ci := o.info()
+	require_True(t, ci.AckFloor.Stream == 4 && ci.AckFloor.Consumer == 4)
+	require_True(t, ci.NumAckPending == 0)
+	require_True(t, *ci.AckFloorStats == ConsumerAckFloorStats{Advances: 1, Acked: 4})
+
+	// A late ack below the floor does not move it back.
+	require_NoError(t, msgsA[1].AckSync())
+	ci = o.info()
+	require_True(t, ci.AckFloor.Stream == 4 && ci.AckFloor.Consumer == 4)
+	require_True(t, *ci.AckFloorStats == ConsumerAckFloorStats{Advances: 1, Acked: 4, Stale: 1})
+
+	// Get 5 redelivered after 6 was delivered, so delivery sequences are out of stream order.
+	msgsA, err = subA.Fetch(2)
+	require_NoError(t, err)
+	require_True(t, len(msgsA) == 2)
+	time.Sleep(300 * time.Millisecond)
+	msgsB, err = subB.Fetch(1)
+	require_NoError(t, err)
+	require_True(t, len(msgsB) == 1)
+	meta, err := msgsB[0].Metadata()
+	require_NoError(t, err)
+	require_True(t, meta.Sequence.Stream == 5 && meta.Sequence.Consumer == 7)
+
+	require_NoError(t, msgsB[0].AckSync())
+	ci = o.info()
+	require_True(t, ci.AckFloor.Stream == 5 && ci.AckFloor.Consumer == 7)
+
+	// Acking 6 with its older delivery sequence still advances the floor.
+	require_NoError(t, msgsA[1].AckSync())
+	ci = o.info()
+	require_True(t, ci.AckFloor.Stream == 6 && ci.AckFloor.Consumer == 7)
+	require_True(t, ci.NumAckPending == 0 && ci.NumRedelivered == 0)
+	require_True(t, *ci.AckFloorStats == ConsumerAckFloorStats{Advances: 3, Acked: 6, Stale: 1})
+
+	// The store agrees.
+	state, err := o.store.State()
+	require_NoError(t, err)
+	require_True(t, state.AckFloor.Stream == 6 && state.AckFloor.Consumer == 7)
+	require_True(t, len(state.Pending) == 0)
+}
+
+func TestJetStreamAccountDisableGraceful(t *testing.T) {
+	tmpl := `
+		listen: 127.0.0.1:-1
+		jetstream: {max_mem_store: 64MB, max_file_store: 64MB, store_dir: %q, disable_retention: 1h}
+		accounts: {
+			A: { %s users: [ {user: a, password: pwd} ] }
+		}
+	`
+	storeDir := t.TempDir()
+	conf := createConfFile(t, []byte(fmt.Sprintf(tmpl, storeDir, "jetstream: enabled,")))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("a", "pwd"))
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	sub, err := js.PullSubscribe("foo", "dlc")
+	require_NoError(t, err)
+
+	// Now remove JetStream from the account.
+	reloadUpdateConfig(t, s, conf, fmt.Sprintf(tmpl, storeDir, _EMPTY_))
+
+	acc, err := s.LookupAccount("A")
+	require_NoError(t, err)
+	require_True(t, acc.jetStreamReadOnly())
+
+	isReadOnlyErr := func(err error) {
+		t.Helper()
+		require_Error(t, err)
+		if !strings.Contains(err.Error(), "read only") {
+			t.Fatalf("Expected read only error, got %v", err)
+		}
+	}
+	_, err = js.Publish("foo", []byte("OK"))
+	isReadOnlyErr(err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "d2"})
+	isReadOnlyErr(err)
+	isReadOnlyErr(js.PurgeStream("TEST"))
+	isReadOnlyErr(js.DeleteStream("TEST"))
+
+	// Reads are fine.
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 1)
+	msgs, err := sub.Fetch(1)
+	require_NoError(t, err)
+	require_True(t, len(msgs) == 1)
+	require_NoError(t, msgs[0].AckSync())
+
+	// Enabling again will restore.
+	reloadUpdateConfig(t, s, conf, fmt.Sprintf(tmpl, storeDir, "jetstream: enabled,"))
+	require_False(t, acc.jetStreamReadOnly())
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+
+	// Once the retention expires we are disabled.
+	require_NoError(t, acc.DisableJetStreamGraceful(100*time.Millisecond))
+	require_True(t, acc.jetStreamReadOnly())
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		if acc.JetStreamEnabled() {
+			return fmt.Errorf("still enabled")
+		}
+		return nil
+	})
+	_, err = js.StreamInfo("TEST")
+	require_Error(t, err)
+}
+
+func TestJetStreamMirrorPullBarrier(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "M", Mirror: &nats.StreamSource{Name: "TEST"}})
+	require_NoError(t, err)
+
+	_, err = js.Publish("foo", []byte("1"))
+	require_NoError(t, err)
+	checkFor(t, time.Second, 15*time.Millisecond, func() error {
+		si, err := js.StreamInfo("M")
+		if err != nil {
+			return err
+		}
+		if si.State.Msgs != 1 {
+			return fmt.Errorf("Expected 1 msg, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+
+	_, err = js.AddConsumer("M", &nats.ConsumerConfig{Durable: "dlc", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+
+	// A no wait request for a sequence we do not have yet should not get anything.
+	req := JSApiConsumerGetNextRequest{Batch: 1, NoWait: true, Barrier: 2}
+	reqb, _ := json.Marshal(req)
+	msg, err := nc.Request("$JS.API.CONSUMER.MSG.NEXT.M.dlc", reqb, time.Second)
+	require_NoError(t, err)
+	if v := msg.Header.Get("Status"); v != "404" {
+		t.Fatalf("Expected 404, got: %q", v)
+	}
+
+	// Same with one that expires.
+	req = JSApiConsumerGetNextRequest{Batch: 1, Expires: 100 * time.Millisecond, Barrier: 2}
+	reqb, _ = json.Marshal(req)
+	msg, err = nc.Request("$JS.API.CONSUMER.MSG.NEXT.M.dlc", reqb, time.Second)
+	require_NoError(t, err)
+	if v := msg.Header.Get("Status"); v != "408" {
+		t.Fatalf("Expected 408, got: %q", v)
+	}
+
+	// Now wait for our write to show up in the mirror.
+	req = JSApiConsumerGetNextRequest{Batch: 1, Expires: 2 * time.Second, Barrier: 2}
+	reqb, _ = json.Marshal(req)
+	sub := natsSubSync(t, nc, nats.NewInbox())
+	require_NoError(t, nc.PublishRequest("$JS.API.CONSUMER.MSG.NEXT.M.dlc", sub.Subject, reqb))
+	_, err = sub.NextMsg(250 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	// The waiting request does not hold up those without a barrier.
+	msg, err = nc.Request("$JS.API.CONSUMER.MSG.NEXT.M.dlc", nil, time.Second)
+	require_NoError(t, err)
+	require_True(t, string(msg.Data) == "1")
+	_, err = sub.NextMsg(100 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	pa, err := js.Publish("foo", []byte("2"))
+	require_NoError(t, err)
+	require_True(t, pa.Sequence == 2)
+
+	msg = natsNexMsg(t, sub, time.Second)
+	require_True(t, string(msg.Data) == "2")
+	meta, err := msg.Metadata()
+	require_NoError(t, err)
+	require_True(t, meta.Sequence.Stream == 2)
+}
+
+func TestJetStreamStreamConfigRollback(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	request := func(subj string, req interface{}, resp interface{}) {
+		t.Helper()
+		var b []byte
+		if req != nil {
+			var err error
+			b, err = json.Marshal(req)
+			require_NoError(t, err)
+		}
+		rmsg, err := nc.Request(subj, b, time.Second)
+		require_NoError(t, err)
+		require_NoError(t, json.Unmarshal(rmsg.Data, resp))
+	}
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, MaxMsgs: 100})
+	require_NoError(t, err)
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, MaxMsgs: 10})
+	require_NoError(t, err)
+	// Same config again should not add a revision.
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, MaxMsgs: 10})
+	require_NoError(t, err)
+
+	var hresp JSApiStreamConfigHistoryResponse
+	request(fmt.Sprintf(JSApiStreamConfigHistoryT, "TEST"), nil, &hresp)
+	if hresp.Error != nil {
+		t.Fatalf("Unexpected error: %v", hresp.Error)
+	}
+	require_True(t, len(hresp.Revisions) == 2)
+	require_True(t, hresp.Revisions[0].Revision == 1)
+	require_True(t, hresp.Revisions[0].Config.MaxMsgs == 100)
+	require_True(t, hresp.Revisions[1].Revision == 2)
+	require_True(t, hresp.Revisions[1].Config.MaxMsgs == 10)
+	require_True(t, hresp.Revisions[1].Client != nil)
+
+	// Unknown revision.
+	var uresp JSApiStreamUpdateResponse
+	request(fmt.Sprintf(JSApiStreamConfigRollbackT, "TEST"), &JSApiStreamConfigRollbackRequest{Revision: 22}, &uresp)
+	require_True(t, uresp.Error != nil && uresp.Error.ErrCode == uint16(JSStreamConfigRevisionNotFoundErr))
+
+	uresp = JSApiStreamUpdateResponse{}
+	request(fmt.Sprintf(JSApiStreamConfigRollbackT, "TEST"), &JSApiStreamConfigRollbackRequest{Revision: 1}, &uresp)
+	if uresp.Error != nil {
+		t.Fatalf("Unexpected error: %v", uresp.Error)
+	}
+	require_True(t, uresp.Config.MaxMsgs == 100)
+
+	// The rollback is a revision of its own.
+	hresp = JSApiStreamConfigHistoryResponse{}
+	request(fmt.Sprintf(JSApiStreamConfigHistoryT, "TEST"), nil, &hresp)
+	require_True(t, len(hresp.Revisions) == 3)
+	require_True(t, hresp.Revisions[2].Revision == 3)
+	require_True(t, hresp.Revisions[2].Config.MaxMsgs == 100)
+
+	// We only keep so many revisions.
+	for i := 0; i < maxStreamConfigRevisions; i++ {
+		_, err = js.UpdateStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, MaxMsgs: int64(i + 1)})
+		require_NoError(t, err)
+	}
+	hresp = JSApiStreamConfigHistoryResponse{}
+	request(fmt.Sprintf(JSApiStreamConfigHistoryT, "TEST"), nil, &hresp)
+	require_True(t, len(hresp.Revisions) == maxStreamConfigRevisions)
+	require_True(t, hresp.Revisions[0].Revision == 4)
+
+	// The revisions survive a restart, without adding one.
+	nc.Close()
+	sd := s.JetStreamConfig().StoreDir
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	revs := mset.configRevisions()
+	require_True(t, len(revs) == maxStreamConfigRevisions)
+	require_True(t, revs[0].Revision == 4)
+	require_True(t, revs[len(revs)-1].Config.MaxMsgs == maxStreamConfigRevisions)
+	require_True(t, revs[len(revs)-1].Client != nil)
+}
+
+func TestJetStreamConsumerReplaySpeed(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	mset, err := s.GlobalAccount().addStream(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	defer mset.delete()
+
+	nc, _ := jsClientConnect(t, s)
+	defer nc.Close()
+
+	// Speed only makes sense with original timing.
+	_, err = mset.addConsumer(&ConsumerConfig{DeliverSubject: "d", ReplaySpeed: 2})
+	require_Error(t, err, NewJSConsumerInvalidReplaySpeedError(errors.New("replay speed requires replay policy original")))
+	_, err = mset.addConsumer(&ConsumerConfig{DeliverSubject: "d", ReplayPolicy: ReplayOriginal, ReplaySpeed: -1})
+	require_Error(t, err, NewJSConsumerInvalidReplaySpeedError(errors.New("replay speed can not be negative")))
+
+	// Store messages 200ms apart.
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+
+	sub := natsSubSync(t, nc, nats.NewInbox())
+	o, err := mset.addConsumer(&ConsumerConfig{DeliverSubject: sub.Subject, ReplayPolicy: ReplayOriginal, ReplaySpeed: 4})
+	require_NoError(t, err)
+	defer o.delete()
+
+	natsNexMsg(t, sub, time.Second)
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		natsNexMsg(t, sub, time.Second)
+		// At 4x we expect 50ms gaps instead of 200ms.
+		if gap := time.Since(start); gap < 30*time.Millisecond || gap > 150*time.Millisecond {
+			t.Fatalf("Expected a gap of around 50ms, got %v", gap)
+		}
+	}
+}
+
+func TestJetStreamConsumerDeliverQueue(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	// Needs to be a push consumer.
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "pull", AckPolicy: AckExplicit, DeliverQueue: &DeliverQueueConfig{}})
+	require_Error(t, err, NewJSConsumerInvalidDeliverQueueError(errors.New("consumer deliver queue requires a deliver subject")))
+
+	for i := 0; i < 10; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+
+	sub := natsSubSync(t, nc, nats.NewInbox())
+	o, err := mset.addConsumer(&ConsumerConfig{
+		Durable:        "dlc",
+		DeliverSubject: sub.Subject,
+		AckPolicy:      AckNone,
+		DeliverQueue:   &DeliverQueueConfig{MaxMsgs: 100, FlushSize: 3},
+	})
+	require_NoError(t, err)
+	defer o.delete()
+
+	for i := 0; i < 10; i++ {
+		natsNexMsg(t, sub, time.Second)
+	}
+	checkFor(t, time.Second, 15*time.Millisecond, func() error {
+		dqi := o.info().DeliverQueue
+		if dqi == nil || dqi.Delivered != 10 {
+			return fmt.Errorf("Expected 10 delivered, got %+v", dqi)
+		}
+		if dqi.Pending != 0 || dqi.PendingBytes != 0 {
+			return fmt.Errorf("Expected nothing pending, got %+v", dqi)
+		}
+		return nil
+	})
+
+	// Can not be changed.
+	_, err = js.UpdateConsumer("TEST", &nats.ConsumerConfig{Durable: "dlc", DeliverSubject: sub.Subject, AckPolicy: nats.AckNonePolicy})
+	require_Error(t, err)
+}
+
+func TestJetStreamConsumerDeliverQueueLimits(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	// No delivery loop is running here so the queue only fills up.
+	dq := newDeliverQueue(s, "drop", &DeliverQueueConfig{MaxMsgs: 2, Policy: DeliverQueueDrop})
+	for i := 0; i < 5; i++ {
+		dq.send(newJSPubMsg("foo", "foo", _EMPTY_, nil, []byte("OK"), nil, uint64(i+1)))
+	}
+	require_False(t, dq.shouldPark())
+	dqi := dq.info()
+	require_True(t, dqi.Pending == 2)
+	require_True(t, dqi.Dropped == 3)
+
+	dq = newDeliverQueue(s, "park", &DeliverQueueConfig{MaxBytes: 1, Policy: DeliverQueuePark})
+	require_False(t, dq.shouldPark())
+	require_True(t, dq.send(newJSPubMsg("foo", "foo", _EMPTY_, nil, []byte("OK"), nil, 1)))
+	require_True(t, dq.shouldPark())
+	require_True(t, dq.shouldPark())
+	// Parking counts once until we have room again.
+	require_True(t, dq.info().Parked == 1)
+
+	var cfg DeliverQueueConfig
+	require_NoError(t, json.Unmarshal([]byte(`{"max_msgs":10,"policy":"drop"}`), &cfg))
+	require_True(t, cfg.Policy == DeliverQueueDrop)
+	require_Error(t, json.Unmarshal([]byte(`{"policy":"block"}`), &cfg))
+}
+
+func TestJetStreamConsumerDeliverGroupHash(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"orders.*"}})
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	_, err = mset.addConsumer(&ConsumerConfig{DeliverSubject: "d", DeliverGroupHashToken: 2})
+	require_Error(t, err, NewJSConsumerInvalidDeliverGroupHashError(errors.New("deliver group hash token requires a deliver group")))
+
+	// Members of the deliver group.
+	var subs []*nats.Subscription
+	for i := 0; i < 3; i++ {
+		sub, err := nc.QueueSubscribeSync("d", "g")
+		require_NoError(t, err)
+		subs = append(subs, sub)
+	}
+	require_NoError(t, nc.Flush())
+
+	o, err := mset.addConsumer(&ConsumerConfig{
+		Durable:               "dlc",
+		DeliverSubject:        "d",
+		DeliverGroup:          "g",
+		DeliverGroupHashToken: 2,
+		AckPolicy:             AckNone,
+	})
+	require_NoError(t, err)
+	defer o.delete()
+
+	for n := 0; n < 5; n++ {
+		for i := 0; i < 20; i++ {
+			sendStreamMsg(t, nc, fmt.Sprintf("orders.%d", i), "OK")
+		}
+	}
+
+	// Every key needs to land on a single member.
+	owners := make(map[string]int)
+	used := make(map[int]struct{})
+	received := 0
+	for received < 100 {
+		got := false
+		for i, sub := range subs {
+			m, err := sub.NextMsg(10 * time.Millisecond)
+			if err != nil {
+				continue
+			}
+			got = true
+			received++
+			if owner, ok := owners[m.Subject]; ok && owner != i {
+				t.Fatalf("Expected %q to be delivered to member %d, got %d", m.Subject, owner, i)
+			}
+			owners[m.Subject] = i
+			used[i] = struct{}{}
+		}
+		if !got && received < 100 {
+			t.Fatalf("Only received %d messages", received)
+		}
+	}
+	// With 20 keys we expect them to be spread out.
+	require_True(t, len(used) > 1)
+}
+
+func TestJetStreamConsumerActivityAdvisories(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	asub := natsSubSync(t, nc, "$JS.EVENT.ADVISORY.CONSUMER.*.TEST.*")
+	require_NoError(t, nc.Flush())
+
+	nextAdvisory := func(subj string) []byte {
+		t.Helper()
+		m := natsNexMsg(t, asub, time.Second)
+		require_Equal(t, m.Subject, subj)
+		return m.Data
+	}
+
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{
+		Name:              "dlc",
+		DeliverSubject:    "d",
+		AckPolicy:         nats.AckNonePolicy,
+		InactiveThreshold: 250 * time.Millisecond,
+	})
+	require_NoError(t, err)
+	nextAdvisory(JSAdvisoryConsumerCreatedPre + ".TEST.dlc")
+
+	sub := natsSubSync(t, nc, "d")
+	require_NoError(t, nc.Flush())
+	var aadv JSConsumerActivityAdvisory
+	require_NoError(t, json.Unmarshal(nextAdvisory(JSAdvisoryConsumerActivePre+".TEST.dlc"), &aadv))
+	require_True(t, aadv.Type == JSConsumerActivityAdvisoryType)
+	require_True(t, aadv.Active)
+
+	require_NoError(t, sub.Unsubscribe())
+	require_NoError(t, nc.Flush())
+	aadv = JSConsumerActivityAdvisory{}
+	require_NoError(t, json.Unmarshal(nextAdvisory(JSAdvisoryConsumerInactivePre+".TEST.dlc"), &aadv))
+	require_False(t, aadv.Active)
+
+	// Now we should get deleted for being inactive.
+	var dadv JSConsumerInactiveDeletedAdvisory
+	require_NoError(t, json.Unmarshal(nextAdvisory(JSAdvisoryConsumerInactiveDeletedPre+".TEST.dlc"), &dadv))
+	require_True(t, dadv.Type == JSConsumerInactiveDeletedAdvisoryType)
+	require_True(t, dadv.InactiveThreshold == 250*time.Millisecond)
+	require_False(t, dadv.Durable)
+	nextAdvisory(JSAdvisoryConsumerDeletedPre + ".TEST.dlc")
+}
+
+func TestJetStreamConsumerRedeliveryThresholdAdvisory(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+
+	asub := natsSubSync(t, nc, JSAdvisoryConsumerRedeliveryThresholdPre+".TEST.dlc")
+	require_NoError(t, nc.Flush())
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	_, err = mset.addConsumer(&ConsumerConfig{
+		Durable:                     "dlc",
+		AckPolicy:                   AckExplicit,
+		AckWait:                     50 * time.Millisecond,
+		RedeliveryAdvisoryThreshold: 2,
+	})
+	require_NoError(t, err)
+
+	sub, err := js.PullSubscribe("foo", "dlc", nats.Bind("TEST", "dlc"))
+	require_NoError(t, err)
+
+	// First delivery and one redelivery should not trigger.
+	for i := 0; i < 2; i++ {
+		_, err = sub.Fetch(1)
+		require_NoError(t, err)
+	}
+	_, err = asub.NextMsg(100 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	// Second redelivery should.
+	_, err = sub.Fetch(1)
+	require_NoError(t, err)
+	m := natsNexMsg(t, asub, time.Second)
+	var adv JSConsumerRedeliveryThresholdAdvisory
+	require_NoError(t, json.Unmarshal(m.Data, &adv))
+	require_True(t, adv.Type == JSConsumerRedeliveryThresholdAdvisoryType)
+	require_True(t, adv.StreamSeq == 1)
+	require_True(t, adv.Deliveries == 3)
+
+	// Only once.
+	_, err = sub.Fetch(1)
+	require_NoError(t, err)
+	_, err = asub.NextMsg(100 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+}
+
+func TestJetStreamStreamPinnedMsgs(t *testing.T) {
+	for _, st := range []StorageType{MemoryStorage, FileStorage} {
+		t.Run(st.String(), func(t *testing.T) {
+			s := RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+
+			nc, js := jsClientConnect(t, s)
+			defer nc.Close()
+
+			mset, err := s.GlobalAccount().addStream(&StreamConfig{
+				Name:      "TEST",
+				Subjects:  []string{"foo"},
+				Storage:   st,
+				MaxMsgs:   3,
+				MaxPinned: 1,
+			})
+			require_NoError(t, err)
+
+			pin := func(seq uint64, unpin bool) *JSApiStreamUpdateResponse {
+				t.Helper()
+				b, _ := json.Marshal(&JSApiMsgPinRequest{Seq: seq, Unpin: unpin})
+				rmsg, err := nc.Request(fmt.Sprintf(JSApiMsgPinT, "TEST"), b, time.Second)
+				require_NoError(t, err)
+				var resp JSApiStreamUpdateResponse
+				require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+				return &resp
+			}
+
+			_, err = js.Publish("foo", []byte("genesis"))
+			require_NoError(t, err)
+
+			// Unknown message can not be pinned.
+			resp := pin(22, false)
+			require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSNoMessageFoundErr))
+
+			resp = pin(1, false)
+			if resp.Error != nil {
+				t.Fatalf("Unexpected error: %v", resp.Error)
+			}
+			require_True(t, len(resp.Config.Pinned) == 1 && resp.Config.Pinned[0] == 1)
+
+			// Regular updates keep the pins, and can not change them.
+			update := func(pinned []uint64) *JSApiStreamUpdateResponse {
+				t.Helper()
+				cfg := mset.config()
+				cfg.Pinned = pinned
+				b, _ := json.Marshal(&cfg)
+				rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), b, time.Second)
+				require_NoError(t, err)
+				var resp JSApiStreamUpdateResponse
+				require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+				require_True(t, resp.Error == nil)
+				return &resp
+			}
+			resp = update(nil)
+			require_True(t, len(resp.Config.Pinned) == 1 && resp.Config.Pinned[0] == 1)
+			resp = update([]uint64{22})
+			require_True(t, len(resp.Config.Pinned) == 1 && resp.Config.Pinned[0] == 1)
+
+			for i := 0; i < 10; i++ {
+				_, err = js.Publish("foo", []byte("ok"))
+				require_NoError(t, err)
+			}
+			state := mset.state()
+			require_True(t, state.Msgs == 3)
+			require_True(t, state.FirstSeq == 1)
+			_, err = mset.getMsg(1)
+			require_NoError(t, err)
+			_, err = mset.getMsg(10)
+			require_NoError(t, err)
+
+			// Over the pinned limit.
+			resp = pin(11, false)
+			require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSStreamInvalidConfigF))
+
+			// Once unpinned it is subject to the limits again.
+			resp = pin(1, true)
+			if resp.Error != nil {
+				t.Fatalf("Unexpected error: %v", resp.Error)
+			}
+			require_True(t, len(resp.Config.Pinned) == 0)
+			_, err = js.Publish("foo", []byte("ok"))
+			require_NoError(t, err)
+			state = mset.state()
+			require_True(t, state.Msgs == 3)
+			require_True(t, state.FirstSeq == 10)
+
+			// Removed messages are unpinned.
+			resp = pin(12, false)
+			require_True(t, resp.Error == nil)
+			require_NoError(t, js.DeleteMsg("TEST", 12))
+			checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+				if pinned := mset.config().Pinned; len(pinned) > 0 {
+					return fmt.Errorf("still pinned: %v", pinned)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestJetStreamStreamStatsHistory(t *testing.T) {
+	historyRequest := func(t *testing.T, nc *nats.Conn, since time.Time) *JSApiStreamStatsHistoryResponse {
+		t.Helper()
+		var req []byte
+		if !since.IsZero() {
+			req, _ = json.Marshal(&JSApiStreamStatsHistoryRequest{Since: since})
+		}
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamStatsHistoryT, "TEST"), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamStatsHistoryResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+
+	// Not kept unless configured.
+	s := RunBasicJetStreamServer(t)
+	nc, js := jsClientConnect(t, s)
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	resp := historyRequest(t, nc, time.Time{})
+	require_True(t, resp.Error != nil)
+	require_True(t, resp.Error.ErrCode == uint16(JSStreamStatsHistoryDisabledErr))
+	nc.Close()
+	s.Shutdown()
+
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: %q
+			stats_history: {interval: "1h", samples: 5}
+		}
+	`, t.TempDir())))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	ho := opts.JetStreamStatsHistory
+	require_True(t, ho != nil && ho.Interval == time.Hour && ho.Samples == 5)
+
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err = js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo", "bar"}})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "dlc", FilterSubject: "foo", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	history := func(since time.Time) *JSApiStreamStatsHistoryResponse {
+		t.Helper()
+		resp := historyRequest(t, nc, since)
+		if resp.Error != nil {
+			t.Fatalf("Unexpected error: %v", resp.Error)
+		}
+		return resp
+	}
+
+	resp = history(time.Time{})
+	require_True(t, resp.Interval == time.Hour)
+	require_True(t, len(resp.Samples) == 0)
+
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+	}
+	now := time.Now()
+	mset.sampleStats(now, ho.Samples)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("bar", []byte("ok"))
+		require_NoError(t, err)
+	}
+	mset.sampleStats(now.Add(2*time.Second), ho.Samples)
+
+	resp = history(time.Time{})
+	require_True(t, len(resp.Samples) == 2)
+	first, second := resp.Samples[0], resp.Samples[1]
+	require_True(t, first.Msgs == 10)
+	require_True(t, first.ConsumerLag == 10)
+	require_True(t, second.Msgs == 20)
+	require_True(t, second.MsgRate == 5)
+	require_True(t, second.ByteRate > 0)
+	// Only messages on foo are pending for the consumer.
+	require_True(t, second.ConsumerLag == 10)
+
+	resp = history(now.Add(time.Second))
+	require_True(t, len(resp.Samples) == 1)
+	require_True(t, resp.Samples[0].Msgs == 20)
+
+	// Make sure we only keep so many and in order.
+	for i := 0; i < 10; i++ {
+		mset.sampleStats(now.Add(time.Duration(i+3)*time.Second), ho.Samples)
+	}
+	resp = history(time.Time{})
+	require_True(t, len(resp.Samples) == ho.Samples)
+	for i, sample := range resp.Samples {
+		require_True(t, sample.Time.Equal(now.Add(time.Duration(i+8)*time.Second)))
+	}
+
+	// Make sure we check the configured limits.
+	o := DefaultOptions()
+	o.JetStreamStatsHistory = &JSStatsHistoryOpts{Samples: maxStreamStatsSamples + 1}
+	require_True(t, validateJetStreamStatsHistory(o) != nil)
+	o.JetStreamStatsHistory = &JSStatsHistoryOpts{Interval: -time.Second}
+	require_True(t, validateJetStreamStatsHistory(o) != nil)
+}
+
+func TestJetStreamConsumerReattach(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = js.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+	}
+
+	inbox := nats.NewInbox()
+	sub, err := nc.SubscribeSync(inbox)
+	require_NoError(t, err)
+	ci, err := js.AddConsumer("TEST", &nats.ConsumerConfig{
+		DeliverSubject:    inbox,
+		AckPolicy:         nats.AckExplicitPolicy,
+		InactiveThreshold: 5 * time.Second,
+	})
+	require_NoError(t, err)
+
+	// Ack the first 2, then go away.
+	for i := 0; i < 5; i++ {
+		m, err := sub.NextMsg(time.Second)
+		require_NoError(t, err)
+		if i < 2 {
+			m.AckSync()
+		}
+	}
+	require_NoError(t, sub.Unsubscribe())
+
+	reattach := func(name, deliver string) *JSApiConsumerCreateResponse {
+		t.Helper()
+		req, _ := json.Marshal(&JSApiConsumerReattachRequest{DeliverSubject: deliver})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiConsumerReattachT, "TEST", name), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+
+	resp := reattach("NOT-THERE", nats.NewInbox())
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSConsumerNotFoundErr))
+	resp = reattach(ci.Name, _EMPTY_)
+	require_True(t, resp.Error != nil)
+
+	inbox = nats.NewInbox()
+	sub, err = nc.SubscribeSync(inbox)
+	require_NoError(t, err)
+	resp = reattach(ci.Name, inbox)
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error)
+	}
+	require_True(t, resp.Name == ci.Name)
+	require_True(t, resp.Config.DeliverSubject == inbox)
+
+	// The unacked ones are redelivered to us.
+	for i := 3; i <= 5; i++ {
+		m, err := sub.NextMsg(time.Second)
+		require_NoError(t, err)
+		meta, err := m.Metadata()
+		require_NoError(t, err)
+		require_True(t, meta.Sequence.Stream == uint64(i))
+		m.AckSync()
+	}
+	_, err = js.Publish("foo", []byte("ok"))
+	require_NoError(t, err)
+	m, err := sub.NextMsg(time.Second)
+	require_NoError(t, err)
+	meta, err := m.Metadata()
+	require_NoError(t, err)
+	require_True(t, meta.Sequence.Stream == 6)
+}
+
+func TestJetStreamConsumerDeliverCopies(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "pull", AckPolicy: AckExplicit, DeliverCopies: []string{"tap"}})
+	require_Error(t, err, NewJSConsumerInvalidDeliverCopiesError(errors.New("consumer deliver copies require a deliver subject")))
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "dlc", DeliverSubject: "d", AckPolicy: AckExplicit, DeliverCopies: []string{"foo"}})
+	require_Error(t, err, NewJSConsumerInvalidDeliverCopiesError(errors.New(`consumer deliver copy subject "foo" forms a cycle`)))
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "dlc", DeliverSubject: "d", AckPolicy: AckExplicit, DeliverCopies: []string{"tap", "tap"}})
+	require_Error(t, err, NewJSConsumerInvalidDeliverCopiesError(errors.New(`consumer deliver copy subject "tap" is a duplicate`)))
+
+	sub := natsSubSync(t, nc, nats.NewInbox())
+	tap1 := natsSubSync(t, nc, "tap.1")
+	tap2 := natsSubSync(t, nc, "tap.2")
+	o, err := mset.addConsumer(&ConsumerConfig{
+		Durable:        "dlc",
+		DeliverSubject: sub.Subject,
+		AckPolicy:      AckExplicit,
+		DeliverCopies:  []string{"tap.1", "tap.2"},
+	})
+	require_NoError(t, err)
+	defer o.delete()
+
+	for i := 0; i < 3; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+	for i := 1; i <= 3; i++ {
+		m := natsNexMsg(t, sub, time.Second)
+		m.AckSync()
+		for _, tap := range []*nats.Subscription{tap1, tap2} {
+			m = natsNexMsg(t, tap, time.Second)
+			require_True(t, m.Subject == "foo")
+			require_True(t, m.Reply == _EMPTY_)
+			require_True(t, string(m.Data) == "OK")
+			require_True(t, m.Header.Get(JSStream) == "TEST")
+			require_True(t, m.Header.Get(JSSequence) == strconv.Itoa(i))
+		}
+	}
+
+	// Copies are not tracked for acks.
+	state := o.info()
+	require_True(t, state.NumAckPending == 0)
+	require_True(t, state.AckFloor.Stream == 3)
+}
+
+func TestJetStreamConsumerDeliverTransform(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "dlc", AckPolicy: AckExplicit, HeadersOnly: true, DeliverTransform: &DeliverTransformConfig{Truncate: 10}})
+	require_Error(t, err, NewJSConsumerInvalidDeliverTransformError(errors.New("consumer deliver transform can not be used with headers only")))
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "dlc", AckPolicy: AckExplicit, DeliverTransform: &DeliverTransformConfig{RedactFields: []string{"a..b"}}})
+	require_Error(t, err, NewJSConsumerInvalidDeliverTransformError(errors.New("consumer deliver transform redact field is invalid")))
+
+	sendStreamMsg(t, nc, "foo", `{"name":"<derek&co>","ssn":"123-45-6789","card":{"number":"4111","exp":"01/30"},"n":1.50}`)
+	sendStreamMsg(t, nc, "foo", "not json")
+	sendStreamMsg(t, nc, "foo", "0123456789")
+
+	sub := natsSubSync(t, nc, nats.NewInbox())
+	o, err := mset.addConsumer(&ConsumerConfig{
+		Durable:          "dlc",
+		DeliverSubject:   sub.Subject,
+		AckPolicy:        AckNone,
+		DeliverTransform: &DeliverTransformConfig{RedactFields: []string{"ssn", "card.number", "missing.field"}},
+	})
+	require_NoError(t, err)
+	defer o.delete()
+
+	m := natsNexMsg(t, sub, time.Second)
+	require_Equal(t, string(m.Data), `{"card":{"exp":"01/30"},"n":1.50,"name":"<derek&co>"}`)
+	// Not JSON, so we can not tell what is in there.
+	m = natsNexMsg(t, sub, time.Second)
+	require_True(t, len(m.Data) == 0)
+	m = natsNexMsg(t, sub, time.Second)
+	require_True(t, len(m.Data) == 0)
+
+	sub = natsSubSync(t, nc, nats.NewInbox())
+	o, err = mset.addConsumer(&ConsumerConfig{
+		Durable:          "truncate",
+		DeliverSubject:   sub.Subject,
+		AckPolicy:        AckNone,
+		DeliverTransform: &DeliverTransformConfig{Truncate: 8},
+	})
+	require_NoError(t, err)
+	defer o.delete()
+
+	m = natsNexMsg(t, sub, time.Second)
+	require_Equal(t, string(m.Data), `{"name":`)
+	require_Equal(t, m.Header.Get(JSMsgSize), "89")
+	m = natsNexMsg(t, sub, time.Second)
+	require_Equal(t, string(m.Data), "not json")
+	require_Equal(t, m.Header.Get(JSMsgSize), _EMPTY_)
+	m = natsNexMsg(t, sub, time.Second)
+	require_Equal(t, string(m.Data), "01234567")
+	require_Equal(t, m.Header.Get(JSMsgSize), "10")
+
+	// The stored messages are not changed.
+	sm, err := mset.getMsg(3)
+	require_NoError(t, err)
+	require_Equal(t, string(sm.Data), "0123456789")
+}
+
+func TestJetStreamPagedListingsWithLimitAndFilter(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	for i := 0; i < 10; i++ {
+		_, err := js.AddStream(&nats.StreamConfig{Name: fmt.Sprintf("S-%d", i), Subjects: []string{fmt.Sprintf("s.%d", i)}})
+		require_NoError(t, err)
+	}
+	for i := 0; i < 10; i++ {
+		_, err := js.AddConsumer("S-0", &nats.ConsumerConfig{Durable: fmt.Sprintf("C-%d", i), FilterSubject: "s.0", AckPolicy: nats.AckExplicitPolicy})
+		require_NoError(t, err)
+	}
+	_, err := js.AddStream(&nats.StreamConfig{Name: "T", Subjects: []string{"t.>"}})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("T", &nats.ConsumerConfig{Durable: "A", FilterSubject: "t.a", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("T", &nats.ConsumerConfig{Durable: "B", FilterSubject: "t.b", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("T", &nats.ConsumerConfig{Durable: "ALL", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+
+	request := func(subj string, req, resp interface{}) {
+		t.Helper()
+		b, _ := json.Marshal(req)
+		rmsg, err := nc.Request(subj, b, time.Second)
+		require_NoError(t, err)
+		require_NoError(t, json.Unmarshal(rmsg.Data, resp))
+	}
+
+	var snames JSApiStreamNamesResponse
+	request(JSApiStreams, &JSApiStreamNamesRequest{ApiPagedRequest: ApiPagedRequest{Offset: 2, Limit: 3}, Subject: "s.*"}, &snames)
+	require_True(t, snames.Total == 10 && snames.Offset == 2 && snames.Limit == 3)
+	require_True(t, len(snames.Streams) == 3 && snames.Streams[0] == "S-2")
+
+	var slist JSApiStreamListResponse
+	request(JSApiStreamList, &JSApiStreamListRequest{ApiPagedRequest: ApiPagedRequest{Offset: 9, Limit: 5}, Subject: "s.*"}, &slist)
+	require_True(t, slist.Total == 10 && slist.Limit == 5 && len(slist.Streams) == 1)
+
+	// Limits above the API limit are capped.
+	request(JSApiStreamList, &JSApiStreamListRequest{ApiPagedRequest: ApiPagedRequest{Limit: 100000}}, &slist)
+	require_True(t, slist.Total == 11 && slist.Limit == JSApiListLimit && len(slist.Streams) == 11)
+
+	var cnames JSApiConsumerNamesResponse
+	request(fmt.Sprintf(JSApiConsumersT, "S-0"), &JSApiConsumersRequest{ApiPagedRequest: ApiPagedRequest{Offset: 8, Limit: 5}}, &cnames)
+	require_True(t, cnames.Total == 10 && cnames.Limit == 5 && len(cnames.Consumers) == 2)
+	require_True(t, cnames.Consumers[0] == "C-8")
+
+	request(fmt.Sprintf(JSApiConsumersT, "T"), &JSApiConsumersRequest{Subject: "t.a"}, &cnames)
+	require_True(t, cnames.Total == 2 && len(cnames.Consumers) == 2)
+	require_True(t, cnames.Consumers[0] == "A" && cnames.Consumers[1] == "ALL")
+
+	var clist JSApiConsumerListResponse
+	request(fmt.Sprintf(JSApiConsumerListT, "T"), &JSApiConsumersRequest{ApiPagedRequest: ApiPagedRequest{Limit: 1}, Subject: "t.>"}, &clist)
+	require_True(t, clist.Total == 3 && clist.Limit == 1 && len(clist.Consumers) == 1)
+	require_True(t, clist.Consumers[0].Name == "A")
+}
+
+func TestJetStreamRecoverManyStreamsInParallel(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	const numStreams = 50
+	for i := 0; i < numStreams; i++ {
+		_, err := js.AddStream(&nats.StreamConfig{
+			Name:      fmt.Sprintf("S-%d", i),
+			Subjects:  []string{fmt.Sprintf("s.%d", i)},
+			Retention: nats.InterestPolicy,
+		})
+		require_NoError(t, err)
+		_, err = js.AddConsumer(fmt.Sprintf("S-%d", i), &nats.ConsumerConfig{Durable: "dlc", AckPolicy: nats.AckExplicitPolicy})
+		require_NoError(t, err)
+		for j := 0; j <= i; j++ {
+			_, err = js.Publish(fmt.Sprintf("s.%d", i), []byte("ok"))
+			require_NoError(t, err)
+		}
+	}
+	nc.Close()
+
+	sd := s.JetStreamConfig().StoreDir
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+
+	for i := 0; i < numStreams; i++ {
+		si, err := js.StreamInfo(fmt.Sprintf("S-%d", i))
+		require_NoError(t, err)
+		require_True(t, si.State.Msgs == uint64(i+1))
+		require_True(t, si.State.Consumers == 1)
+		ci, err := js.ConsumerInfo(fmt.Sprintf("S-%d", i), "dlc")
+		require_NoError(t, err)
+		require_True(t, ci.NumPending == uint64(i+1))
+	}
+}
+
+func TestJetStreamAccountTemplate(t *testing.T) {
+	tmpl := `
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: %q
+			account_template: {accounts: [%q], limits: {max_mem: 1MB, max_file: 8MB, max_streams: 2}}
+		}
+		accounts: {
+			TA: {users: [{user: ta, password: pwd}]}
+			OTHER: {users: [{user: other, password: pwd}]}
+			ENABLED: {users: [{user: enabled, password: pwd}], jetstream: {max_streams: 5}}
+		}
+	`
+	storeDir := t.TempDir()
+	conf := createConfFile(t, []byte(fmt.Sprintf(tmpl, storeDir, "T*")))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	require_True(t, opts.JetStreamAccTemplate != nil)
+	require_Equal(t, strings.Join(opts.JetStreamAccTemplate.Accounts, ","), "T*")
+
+	checkLimits := func(name string, maxStreams int) {
+		t.Helper()
+		acc, err := s.lookupAccount(name)
+		require_NoError(t, err)
+		if maxStreams == 0 {
+			require_False(t, acc.JetStreamEnabled())
+			return
+		}
+		require_True(t, acc.JetStreamEnabled())
+		limits := acc.JetStreamUsage().Limits
+		require_True(t, limits.MaxStreams == maxStreams)
+	}
+	checkLimits("TA", 2)
+	checkLimits("OTHER", 0)
+	// Accounts that enable JetStream themselves keep their limits.
+	checkLimits("ENABLED", 5)
+
+	// Accounts registered later are enabled as well.
+	_, err := s.RegisterAccount("TB")
+	require_NoError(t, err)
+	checkLimits("TB", 2)
+	_, err = s.RegisterAccount("NEW")
+	require_NoError(t, err)
+	checkLimits("NEW", 0)
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("ta", "pwd"))
+	defer nc.Close()
+	for i := 0; i < 2; i++ {
+		_, err = js.AddStream(&nats.StreamConfig{Name: fmt.Sprintf("S%d", i), Storage: nats.MemoryStorage})
+		require_NoError(t, err)
+	}
+	_, err = js.AddStream(&nats.StreamConfig{Name: "S2", Storage: nats.MemoryStorage})
+	require_Error(t, err)
+
+	// Existing accounts are re-evaluated when the template changes.
+	changeCurrentConfigContentWithNewContent(t, conf, []byte(fmt.Sprintf(tmpl, storeDir, "O*")))
+	require_NoError(t, s.Reload())
+	checkLimits("TA", 0)
+	checkLimits("OTHER", 2)
+	checkLimits("ENABLED", 5)
+
+	// Without patterns the template applies to all accounts but the global one.
+	tt := &JSAccountTemplate{}
+	require_True(t, tt.matches("TC"))
+	require_False(t, tt.matches(globalAccountName))
+}
+
+func TestJetStreamSyncAlwaysPubAcks(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {max_mem_store: 64MB, max_file_store: 64MB, store_dir: %q, sync_always: true, sync_max_delay: 5ms}
+	`, t.TempDir())))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	require_True(t, opts.JetStreamSyncAlways)
+	require_True(t, opts.JetStreamSyncMaxDelay == 5*time.Millisecond)
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	// Many async publishers should all get their acks.
+	for i := 0; i < 1000; i++ {
+		_, err := js.PublishAsync("foo", []byte("ok"))
+		require_NoError(t, err)
+	}
+	select {
+	case <-js.PublishAsyncComplete():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive all pub acks")
+	}
+
+	pa, err := js.Publish("foo", []byte("ok"))
+	require_NoError(t, err)
+	require_True(t, pa.Sequence == 1001)
+
+	// Duplicates are acked as well.
+	_, err = js.Publish("foo", []byte("ok"), nats.MsgId("dup"))
+	require_NoError(t, err)
+	pa, err = js.Publish("foo", []byte("ok"), nats.MsgId("dup"))
+	require_NoError(t, err)
+	require_True(t, pa.Duplicate && pa.Sequence == 1002)
+
+	// Acks delayed by the ingest rate are delayed after the sync.
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	sub := natsSubSync(t, nc, nats.NewInbox())
+	natsFlush(t, nc)
+	start := time.Now()
+	sendPubAck(mset.outq, mset.store, sub.Subject, []byte("ack"), 50*time.Millisecond)
+	natsNexMsg(t, sub, time.Second)
+	require_True(t, time.Since(start) >= 55*time.Millisecond)
+}
+
+func TestJetStreamConsumerAckReplyAllocs(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	mset, err := s.GlobalAccount().addStream(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	o, err := mset.addConsumer(&ConsumerConfig{Durable: "dlc", AckPolicy: AckExplicit})
+	require_NoError(t, err)
+	defer o.delete()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ts := time.Now().UnixNano()
+	expected := fmt.Sprintf("$JS.ACK.TEST.dlc.%d.%d.%d.%d.%d", 2, 22, 11, ts, 100)
+	require_Equal(t, o.ackReply(22, 11, 2, ts, 100), expected)
+
+	// Only the returned string should be allocated.
+	if n := testing.AllocsPerRun(100, func() { o.ackReply(22, 11, 2, ts, 100) }); n > 1 {
+		t.Fatalf("Expected at most 1 allocation, got %v", n)
+	}
+	// Pending records are recycled once acked.
+	if n := testing.AllocsPerRun(100, func() {
+		o.trackPending(1, 1)
+		p := o.pending[1]
+		delete(o.pending, 1)
+		pendingPool.Put(p)
+	}); n > 0 {
+		t.Fatalf("Expected no allocations, got %v", n)
+	}
+}
+
+func TestJetStreamConsumerMaxPendingMemory(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "dlc", AckPolicy: AckNone, MaxPendingMemory: 1024})
+	require_Error(t, err, NewJSConsumerInvalidPendingMemoryError(errors.New("consumer max pending memory requires an ack policy")))
+
+	for i := 0; i < 20; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+
+	sub := natsSubSync(t, nc, nats.NewInbox())
+	o, err := mset.addConsumer(&ConsumerConfig{
+		Durable:          "dlc",
+		DeliverSubject:   sub.Subject,
+		AckPolicy:        AckExplicit,
+		MaxPendingMemory: 10 * pendingEntryMem,
+	})
+	require_NoError(t, err)
+	defer o.delete()
+
+	var msgs []*nats.Msg
+	for i := 0; i < 10; i++ {
+		msgs = append(msgs, natsNexMsg(t, sub, time.Second))
+	}
+	if _, err := sub.NextMsg(250 * time.Millisecond); err != nats.ErrTimeout {
+		t.Fatalf("Expected no more messages, got %v", err)
+	}
+	info := o.info()
+	require_True(t, info.PendingMemoryExceeded)
+	require_True(t, info.PendingMemory == 10*pendingEntryMem)
+	require_True(t, atomic.LoadInt64(&mset.jsa.pmem) == 10*pendingEntryMem)
+
+	// Acking will allow new deliveries.
+	for _, m := range msgs[:5] {
+		m.AckSync()
+	}
+	for i := 0; i < 5; i++ {
+		natsNexMsg(t, sub, time.Second)
+	}
+
+	// Removing the consumer will release its pending memory from the account.
+	o.delete()
+	require_True(t, atomic.LoadInt64(&mset.jsa.pmem) == 0)
+}
+
+func TestJetStreamAccountMaxPendingMemory(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {max_mem_store: 64MB, max_file_store: 64MB, store_dir: %q}
+		accounts: {
+			A: { jetstream: { max_pending_memory: %d }, users: [ {user: a, password: pwd} ] }
+		}
+	`, t.TempDir(), 10*pendingEntryMem)))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("a", "pwd"))
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 20; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	// The two consumers share the account limit.
+	sub1, err := js.SubscribeSync("foo", nats.Durable("C1"), nats.ManualAck(), nats.MaxAckPending(6))
+	require_NoError(t, err)
+	for i := 0; i < 6; i++ {
+		_, err = sub1.NextMsg(time.Second)
+		require_NoError(t, err)
+	}
+	sub2, err := js.SubscribeSync("foo", nats.Durable("C2"), nats.ManualAck())
+	require_NoError(t, err)
+	for i := 0; i < 4; i++ {
+		_, err = sub2.NextMsg(time.Second)
+		require_NoError(t, err)
+	}
+	if _, err := sub2.NextMsg(250 * time.Millisecond); err != nats.ErrTimeout {
+		t.Fatalf("Expected no more messages, got %v", err)
+	}
+	ci, err := sub2.ConsumerInfo()
+	require_NoError(t, err)
+	require_True(t, ci.NumAckPending == 4)
+}
+
+func TestJetStreamMirrorAndSourceUpstreamReset(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "O", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "M", Mirror: &nats.StreamSource{Name: "O"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "S", Sources: []*nats.StreamSource{{Name: "O"}}})
+	require_NoError(t, err)
+
+	sendBatch := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			_, err := js.Publish("foo", []byte("OK"))
+			require_NoError(t, err)
+		}
+	}
+	checkState := func(stream string, msgs, lseq uint64) {
+		t.Helper()
+		checkFor(t, 20*time.Second, 250*time.Millisecond, func() error {
+			si, err := js.StreamInfo(stream)
+			if err != nil {
+				return err
+			}
+			if si.State.Msgs != msgs || si.State.LastSeq != lseq {
+				return fmt.Errorf("Expected %d msgs and last seq of %d for %q, got %+v", msgs, lseq, stream, si.State)
+			}
+			return nil
+		})
+	}
+
+	sendBatch(10)
+	checkState("M", 10, 10)
+	checkState("S", 10, 10)
+
+	// Tokens for the upstream stream should be persisted.
+	mset, err := s.GlobalAccount().lookupStream("M")
+	require_NoError(t, err)
+	sdir := filepath.Join(s.JetStreamConfig().StoreDir, globalAccountName, streamsDir, "M")
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		_, err := os.Stat(filepath.Join(sdir, streamResumeFile))
+		return err
+	})
+	mset.mu.RLock()
+	tok := mset.rtoks["O"]
+	mset.mu.RUnlock()
+	require_True(t, tok != nil)
+
+	// Now reset the upstream stream.
+	require_NoError(t, js.DeleteStream("O"))
+	_, err = js.AddStream(&nats.StreamConfig{Name: "O", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	sendBatch(3)
+
+	// The mirror should start over to keep sequences aligned, the source just picks up the new messages.
+	checkState("M", 3, 3)
+	checkState("S", 13, 13)
+
+	mset.mu.RLock()
+	ntok := mset.rtoks["O"]
+	mset.mu.RUnlock()
+	require_True(t, ntok != nil)
+	require_True(t, !ntok.Created.Equal(tok.Created))
+
+	// Make sure we keep going with the new upstream stream.
+	sendBatch(2)
+	checkState("M", 5, 5)
+	checkState("S", 15, 15)
+
+	// Tokens should be part of a snapshot so they survive a restore.
+	sr, err := mset.store.Snapshot(5*time.Second, false, false)
+	require_NoError(t, err)
+	var rtoks map[string]*StreamResumeToken
+	tr := tar.NewReader(s2.NewReader(sr.Reader))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require_NoError(t, err)
+		if hdr.Name == streamResumeFile {
+			b, err := io.ReadAll(tr)
+			require_NoError(t, err)
+			require_NoError(t, json.Unmarshal(b, &rtoks))
+		}
+	}
+	require_True(t, rtoks["O"] != nil)
+	require_True(t, rtoks["O"].Created.Equal(ntok.Created))
+
+	// A corrupt file should not prevent us from loading.
+	require_NoError(t, os.WriteFile(filepath.Join(sdir, streamResumeFile), []byte("{bad"), defaultFilePerms))
+	mset.mu.Lock()
+	mset.rtoks = nil
+	mset.loadResumeTokens()
+	require_True(t, mset.rtoks != nil && len(mset.rtoks) == 0)
+	mset.mu.Unlock()
+}
+
+func TestJetStreamStreamFilterCheck(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:      "WQ",
+		Subjects:  []string{"orders.*", "events.>"},
+		Retention: nats.WorkQueuePolicy,
+	})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("WQ", &nats.ConsumerConfig{Durable: "NEW", FilterSubject: "orders.new", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+
+	check := func(stream, filter string) *JSApiStreamFilterCheckResponse {
+		t.Helper()
+		req, _ := json.Marshal(&JSApiStreamFilterCheckRequest{Filter: filter})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamFilterCheckT, stream), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamFilterCheckResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+
+	for _, test := range []struct {
+		filter   string
+		valid    bool
+		subjects []string
+		overlaps []string
+	}{
+		{"orders.old", true, []string{"orders.*"}, nil},
+		{"orders.*", false, []string{"orders.*"}, []string{"NEW"}},
+		{"events.eu.>", true, []string{"events.>"}, nil},
+		{">", false, []string{"orders.*", "events.>"}, []string{"NEW"}},
+		{"*.new", false, []string{}, []string{"NEW"}},
+		{"foo", false, []string{}, nil},
+		{"orders..bad", false, []string{}, nil},
+		{_EMPTY_, false, []string{"orders.*", "events.>"}, []string{"NEW"}},
+	} {
+		resp := check("WQ", test.filter)
+		if resp.Error != nil {
+			t.Fatalf("Unexpected error for %q: %v", test.filter, resp.Error)
+		}
+		require_Equal(t, resp.Filter, test.filter)
+		if resp.Valid != test.valid {
+			t.Fatalf("Expected valid to be %v for %q, got %v", test.valid, test.filter, resp.Valid)
+		}
+		if !reflect.DeepEqual(resp.Subjects, test.subjects) {
+			t.Fatalf("Expected subjects %q for %q, got %q", test.subjects, test.filter, resp.Subjects)
+		}
+		if !reflect.DeepEqual(resp.Overlaps, test.overlaps) {
+			t.Fatalf("Expected overlaps %q for %q, got %q", test.overlaps, test.filter, resp.Overlaps)
+		}
+	}
+
+	// Partitions only matter for WorkQueue streams.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "LIMITS", Subjects: []string{"foo.>"}})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("LIMITS", &nats.ConsumerConfig{Durable: "ALL", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	resp := check("LIMITS", "foo.bar")
+	require_True(t, resp.Valid)
+	require_True(t, len(resp.Overlaps) == 0)
+
+	// Unknown stream.
+	resp = check("NOPE", "foo")
+	require_True(t, resp.Error != nil)
+	require_True(t, resp.Error.ErrCode == uint16(JSStreamNotFoundErr))
+}
+
+func TestJetStreamConsumerStartConsumerSeq(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 20; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+
+	sub, err := js.PullSubscribe("foo", "D", nats.AckExplicit())
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+
+	ci, err := js.ConsumerInfo("TEST", "D")
+	require_NoError(t, err)
+	cfg := ci.Config
+
+	move := func(name string, dseq uint64) *ApiError {
+		t.Helper()
+		b, _ := json.Marshal(&cfg)
+		var ccfg ConsumerConfig
+		require_NoError(t, json.Unmarshal(b, &ccfg))
+		ccfg.Durable, ccfg.Name = name, name
+		ccfg.OptStartConsumerSeq = dseq
+		req, _ := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: ccfg})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", name), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return resp.Error
+	}
+	fetch := func(n int) []*nats.MsgMetadata {
+		t.Helper()
+		msgs, err := sub.Fetch(n, nats.MaxWait(time.Second))
+		require_NoError(t, err)
+		require_True(t, len(msgs) == n)
+		var mds []*nats.MsgMetadata
+		for _, m := range msgs {
+			md, err := m.Metadata()
+			require_NoError(t, err)
+			mds = append(mds, md)
+		}
+		return mds
+	}
+	ack := func(n int) {
+		t.Helper()
+		for _, md := range fetch(n) {
+			_, err := nc.Request(fmt.Sprintf("$JS.ACK.TEST.D.1.%d.%d.0.0", md.Sequence.Stream, md.Sequence.Consumer), nil, time.Second)
+			require_NoError(t, err)
+		}
+	}
+
+	// Ack 1 and 2 and leave 3, 4 and 5 pending.
+	ack(2)
+	fetch(3)
+
+	// Rewind to the message delivered as 4, leaving 3 pending.
+	require_True(t, move("D", 4) == nil)
+	md := fetch(1)[0]
+	require_True(t, md.Sequence.Stream == 4)
+	require_True(t, md.Sequence.Consumer == 6)
+	ci, err = js.ConsumerInfo("TEST", "D")
+	require_NoError(t, err)
+	require_True(t, ci.NumAckPending == 2)
+
+	// Rewind to our ack floor, which means all is delivered again.
+	require_True(t, move("D", 2) == nil)
+	md = fetch(1)[0]
+	require_True(t, md.Sequence.Stream == 2)
+	require_True(t, md.Sequence.Consumer == 7)
+
+	// Can not map one we no longer track.
+	if apiErr := move("D", 1); apiErr == nil || apiErr.ErrCode != uint16(JSConsumerInvalidStartConsumerSeqErr) {
+		t.Fatalf("Expected invalid start consumer sequence error, got %+v", apiErr)
+	}
+
+	// Advance which skips messages, next delivery has the requested consumer sequence.
+	require_True(t, move("D", 10) == nil)
+	md = fetch(1)[0]
+	require_True(t, md.Sequence.Stream == 5)
+	require_True(t, md.Sequence.Consumer == 10)
+
+	// Can not skip past the end of the stream.
+	if apiErr := move("D", 100); apiErr == nil || apiErr.ErrCode != uint16(JSConsumerInvalidStartConsumerSeqErr) {
+		t.Fatalf("Expected invalid start consumer sequence error, got %+v", apiErr)
+	}
+
+	// Needs to be an existing durable.
+	if apiErr := move("NEW", 2); apiErr == nil || apiErr.ErrCode != uint16(JSConsumerInvalidStartConsumerSeqErr) {
+		t.Fatalf("Expected invalid start consumer sequence error, got %+v", apiErr)
+	}
+}
+
+func TestJetStreamStreamShadow(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {max_mem_store: 64MB, max_file_store: 64MB, store_dir: %q}
+		accounts: {
+			JS: {
+				jetstream: enabled
+				users: [ {user: js, password: pwd} ]
+				exports [ { stream: "shadow.>" } ]
+			},
+			STAGING: {
+				users: [ {user: stg, password: pwd} ]
+				imports [ { stream: { subject: "shadow.>", account: JS } } ]
+			},
+		}
+	`, t.TempDir())))
+
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("js", "pwd"))
+	defer nc.Close()
+
+	addStream := func(cfg *StreamConfig) *ApiError {
+		t.Helper()
+		req, _ := json.Marshal(cfg)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, cfg.Name), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return resp.Error
+	}
+	setSample := func(stream string, sample int) *ApiError {
+		t.Helper()
+		req, _ := json.Marshal(&JSApiStreamShadowSampleRequest{Sample: sample})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamShadowSampleT, stream), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamUpdateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return resp.Error
+	}
+	publish := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			_, err := js.Publish("orders.new", []byte("OK"))
+			require_NoError(t, err)
+		}
+	}
+
+	// Bad configs.
+	for _, sh := range []*StreamShadow{
+		{Subject: "orders.copy", Sample: 100},
+		{Subject: "shadow.*", Sample: 100},
+		{Subject: "shadow.orders", Sample: 101},
+		{Subject: "shadow.orders", Sample: -1},
+		{Subject: "other", Account: "STAGING", Sample: 100},
+		{Subject: "shadow.orders", Account: "NOPE", Sample: 100},
+	} {
+		apiErr := addStream(&StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}, Storage: FileStorage, Shadow: sh})
+		if apiErr == nil || apiErr.ErrCode != uint16(JSStreamInvalidConfigF) {
+			t.Fatalf("Expected invalid config error for %+v, got %v", sh, apiErr)
+		}
+	}
+
+	apiErr := addStream(&StreamConfig{
+		Name:     "ORDERS",
+		Subjects: []string{"orders.>"},
+		Storage:  FileStorage,
+		Shadow:   &StreamShadow{Subject: "shadow.orders", Account: "STAGING", Sample: 100},
+	})
+	require_True(t, apiErr == nil)
+
+	snc := natsConnect(t, s.ClientURL(), nats.UserInfo("stg", "pwd"))
+	defer snc.Close()
+	sub := natsSubSync(t, snc, "shadow.orders")
+	require_NoError(t, snc.Flush())
+
+	// All messages are forwarded.
+	publish(10)
+	for i := 1; i <= 10; i++ {
+		m := natsNexMsg(t, sub, time.Second)
+		require_Equal(t, m.Header.Get(JSStream), "ORDERS")
+		require_Equal(t, m.Header.Get(JSSubject), "orders.new")
+		require_Equal(t, m.Header.Get(JSSequence), strconv.Itoa(i))
+		require_Equal(t, string(m.Data), "OK")
+	}
+
+	// Pause forwarding at runtime.
+	require_True(t, setSample("ORDERS", 0) == nil)
+	publish(10)
+	if _, err := sub.NextMsg(250 * time.Millisecond); err == nil {
+		t.Fatalf("Expected no shadowed messages while paused")
+	}
+
+	// Sample half of them.
+	require_True(t, setSample("ORDERS", 50) == nil)
+	si, err := js.StreamInfo("ORDERS")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 20)
+	publish(400)
+	var received int
+	for {
+		if _, err := sub.NextMsg(250 * time.Millisecond); err != nil {
+			break
+		}
+		received++
+	}
+	if received < 100 || received > 300 {
+		t.Fatalf("Expected about half of the messages to be shadowed, got %d", received)
+	}
+
+	// Needs a shadow to change the sample of.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "PLAIN", Subjects: []string{"plain"}})
+	require_NoError(t, err)
+	if apiErr := setSample("PLAIN", 10); apiErr == nil || apiErr.ErrCode != uint16(JSStreamInvalidConfigF) {
+		t.Fatalf("Expected invalid config error, got %v", apiErr)
+	}
+}
+
+func TestJetStreamStreamOrigin(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s, nats.Name("pub-app"))
+	defer nc.Close()
+
+	rp := &RePublish{Source: "foo", Destination: "rp.foo"}
+	rpSub := natsSubSync(t, nc, "rp.foo")
+	req, _ := json.Marshal(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, Origin: true, AllowDirect: true, RePublish: rp})
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var scResp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &scResp))
+	require_True(t, scResp.Error == nil)
+
+	start := time.Now().UTC()
+	// A publisher can not forge its origin.
+	m := nats.NewMsg("foo")
+	m.Header.Set(JSOrigin, `{"acc":"FAKE"}`)
+	m.Header.Set("X-App", "1")
+	m.Data = []byte("OK")
+	_, err = js.PublishMsg(m)
+	require_NoError(t, err)
+
+	addConsumer := func(cfg *ConsumerConfig) *nats.Subscription {
+		t.Helper()
+		sub := natsSubSync(t, nc, cfg.DeliverSubject)
+		req, _ := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: *cfg})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", cfg.Durable), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		return sub
+	}
+
+	// Not delivered unless asked for.
+	sub := addConsumer(&ConsumerConfig{Durable: "PLAIN", DeliverSubject: "d.plain", AckPolicy: AckNone})
+	msg := natsNexMsg(t, sub, time.Second)
+	require_Equal(t, msg.Header.Get(JSOrigin), _EMPTY_)
+	require_Equal(t, msg.Header.Get("X-App"), "1")
+	require_Equal(t, string(msg.Data), "OK")
+
+	sub = addConsumer(&ConsumerConfig{Durable: "ORIGIN", DeliverSubject: "d.origin", AckPolicy: AckNone, OriginHeaders: true})
+	msg = natsNexMsg(t, sub, time.Second)
+	require_Equal(t, msg.Header.Get("X-App"), "1")
+	require_Equal(t, string(msg.Data), "OK")
+	require_True(t, len(msg.Header.Values(JSOrigin)) == 1)
+
+	var mo MsgOrigin
+	require_NoError(t, json.Unmarshal([]byte(msg.Header.Get(JSOrigin)), &mo))
+	require_Equal(t, mo.Account, globalAccountName)
+	require_Equal(t, mo.Name, "pub-app")
+	require_True(t, mo.ID > 0)
+	// The IP hash is salted.
+	require_Equal(t, mo.IPHash, getHashSize(s.originSalt+globalAccountName+"127.0.0.1", originIPHashLen))
+	require_True(t, mo.IPHash != getHashSize("127.0.0.1", originIPHashLen))
+	require_True(t, !mo.Received.Before(start) && mo.Received.Before(time.Now()))
+
+	// Nor returned by gets unless asked for.
+	hasOrigin := func(hdr []byte) bool { return len(getHeader(JSOrigin, hdr)) > 0 }
+	msgGet := func(req *JSApiMsgGetRequest) []byte {
+		t.Helper()
+		b, _ := json.Marshal(req)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiMsgGetT, "TEST"), b, time.Second)
+		require_NoError(t, err)
+		var resp JSApiMsgGetResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		require_True(t, len(getHeader("X-App", resp.Message.Header)) > 0)
+		return resp.Message.Header
+	}
+	require_False(t, hasOrigin(msgGet(&JSApiMsgGetRequest{Seq: 1})))
+	require_True(t, hasOrigin(msgGet(&JSApiMsgGetRequest{Seq: 1, Origin: true})))
+
+	directGet := func(req *JSApiMsgGetRequest) string {
+		t.Helper()
+		b, _ := json.Marshal(req)
+		rmsg, err := nc.Request(fmt.Sprintf(JSDirectMsgGetT, "TEST"), b, time.Second)
+		require_NoError(t, err)
+		require_Equal(t, rmsg.Header.Get("X-App"), "1")
+		return rmsg.Header.Get(JSOrigin)
+	}
+	require_Equal(t, directGet(&JSApiMsgGetRequest{Seq: 1}), _EMPTY_)
+	require_True(t, directGet(&JSApiMsgGetRequest{Seq: 1, Origin: true}) != _EMPTY_)
+
+	// Republished and mirrored messages do not carry it either.
+	msg = natsNexMsg(t, rpSub, time.Second)
+	require_Equal(t, msg.Header.Get("X-App"), "1")
+	require_Equal(t, msg.Header.Get(JSOrigin), _EMPTY_)
+
+	_, err = js.AddStream(&nats.StreamConfig{Name: "M", Mirror: &nats.StreamSource{Name: "TEST"}})
+	require_NoError(t, err)
+	mset, err := s.GlobalAccount().lookupStream("M")
+	require_NoError(t, err)
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		if state := mset.state(); state.Msgs != 1 {
+			return fmt.Errorf("expected 1 message, got %d", state.Msgs)
+		}
+		return nil
+	})
+	sm, err := mset.getMsg(1)
+	require_NoError(t, err)
+	require_True(t, len(getHeader("X-App", sm.Header)) > 0)
+	require_False(t, hasOrigin(sm.Header))
+
+	// Turning it off again does not record it anymore.
+	req, _ = json.Marshal(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, AllowDirect: true, RePublish: rp})
+	rmsg, err = nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var suResp JSApiStreamUpdateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &suResp))
+	require_True(t, suResp.Error == nil)
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	msg = natsNexMsg(t, sub, time.Second)
+	require_Equal(t, msg.Header.Get(JSOrigin), _EMPTY_)
+}
+
+func TestJetStreamConsumerBind(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	create := func(cfg ConsumerConfig, bind bool) *JSApiConsumerCreateResponse {
+		t.Helper()
+		req, _ := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: cfg, Bind: bind})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", cfg.Durable), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+
+	// Binding does not create the consumer.
+	cfg := ConsumerConfig{Durable: "dur", AckPolicy: AckExplicit, FilterSubject: "foo"}
+	resp := create(cfg, true)
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSConsumerNotFoundErr))
+	_, err = js.ConsumerInfo("TEST", "dur")
+	require_Error(t, err, nats.ErrConsumerNotFound)
+
+	resp = create(cfg, false)
+	require_True(t, resp.Error == nil)
+
+	// Same config, defaults do not need to be set.
+	resp = create(cfg, true)
+	require_True(t, resp.Error == nil && resp.ConsumerInfo != nil)
+	require_Equal(t, resp.ConsumerInfo.Name, "dur")
+
+	// A different config is not applied as an update.
+	cfg.MaxDeliver = 5
+	resp = create(cfg, true)
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSConsumerBindConfigMismatchErr))
+	ci, err := js.ConsumerInfo("TEST", "dur")
+	require_NoError(t, err)
+	require_True(t, ci.Config.MaxDeliver == -1)
+}
+
+func TestJetStreamConsumerRedeliveryOrder(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	addConsumer := func(cfg *ConsumerConfig) *ApiError {
+		t.Helper()
+		req, _ := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: *cfg})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", cfg.Durable), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		if resp.Error == nil {
+			require_True(t, resp.Config.RedeliveryOrder == cfg.RedeliveryOrder)
+		}
+		return resp.Error
+	}
+
+	apiErr := addConsumer(&ConsumerConfig{Durable: "NOACK", DeliverSubject: "d.noack", AckPolicy: AckNone, RedeliveryOrder: RedeliveryStrict})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSConsumerInvalidPolicyErrF))
+
+	expect := func(sub *nats.Subscription, seq, dc uint64) *nats.Msg {
+		t.Helper()
+		m := natsNexMsg(t, sub, 2*time.Second)
+		meta, err := m.Metadata()
+		require_NoError(t, err)
+		if meta.Sequence.Stream != seq || meta.NumDelivered != dc {
+			t.Fatalf("Expected stream seq %d delivered %d times, got %d and %d", seq, dc, meta.Sequence.Stream, meta.NumDelivered)
+		}
+		return m
+	}
+
+	for i, ro := range []RedeliveryOrder{RedeliveryInterleaved, RedeliveryStrict} {
+		t.Run(ro.String(), func(t *testing.T) {
+			base := uint64(i * 2)
+			name, dsubj := strings.ToUpper(ro.String()), "d."+ro.String()
+			sub := natsSubSync(t, nc, dsubj)
+			defer sub.Unsubscribe()
+			require_True(t, addConsumer(&ConsumerConfig{
+				Durable:         name,
+				DeliverSubject:  dsubj,
+				DeliverPolicy:   DeliverNew,
+				AckPolicy:       AckExplicit,
+				AckWait:         250 * time.Millisecond,
+				RedeliveryOrder: ro,
+			}) == nil)
+			defer js.DeleteConsumer("TEST", name)
+
+			_, err := js.Publish("foo", []byte("OK"))
+			require_NoError(t, err)
+			expect(sub, base+1, 1)
+			// Not acked, so will be redelivered.
+			m := expect(sub, base+1, 2)
+
+			_, err = js.Publish("foo", []byte("OK"))
+			require_NoError(t, err)
+			if ro == RedeliveryInterleaved {
+				m2 := expect(sub, base+2, 1)
+				m.AckSync()
+				m2.AckSync()
+				return
+			}
+			// Strict will keep redelivering the first until it is acked.
+			m = expect(sub, base+1, 3)
+			m.AckSync()
+			expect(sub, base+2, 1).AckSync()
+		})
+	}
+
+	// Strict also holds back new messages once a pending one is past its ack wait,
+	// before our pending timer queued it for redelivery.
+	sub := natsSubSync(t, nc, "d.expired")
+	require_True(t, addConsumer(&ConsumerConfig{
+		Durable:         "EXPIRED",
+		DeliverSubject:  "d.expired",
+		DeliverPolicy:   DeliverNew,
+		AckPolicy:       AckExplicit,
+		AckWait:         time.Second,
+		RedeliveryOrder: RedeliveryStrict,
+	}) == nil)
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	expect(sub, 5, 1)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	o := mset.lookupConsumer("EXPIRED")
+	require_True(t, o != nil)
+	o.mu.Lock()
+	o.pending[5].Timestamp -= int64(2 * time.Second)
+	o.mu.Unlock()
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	_, err = sub.NextMsg(250 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	expect(sub, 5, 2).AckSync()
+	expect(sub, 6, 1).AckSync()
+}
+
+func TestJetStreamConsumerMaxAckPendingDropOld(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Retention: nats.InterestPolicy})
+	require_NoError(t, err)
+
+	addConsumer := func(cfg *ConsumerConfig) *ApiError {
+		t.Helper()
+		req, _ := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: *cfg})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", cfg.Durable), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		if resp.Error == nil {
+			require_True(t, resp.Config.MaxAckPendingPolicy == cfg.MaxAckPendingPolicy)
+		}
+		return resp.Error
+	}
+
+	// Only for push consumers with acks.
+	apiErr := addConsumer(&ConsumerConfig{Durable: "PULL", AckPolicy: AckExplicit, MaxAckPending: 2, MaxAckPendingPolicy: MaxAckPendingDropOld})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSConsumerInvalidPolicyErrF))
+	apiErr = addConsumer(&ConsumerConfig{Durable: "NOACK", DeliverSubject: "d.noack", AckPolicy: AckNone, MaxAckPendingPolicy: MaxAckPendingDropOld})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSConsumerInvalidPolicyErrF))
+
+	asub := natsSubSync(t, nc, JSAdvisoryConsumerMsgDroppedPre+".TEST.DROP")
+	sub := natsSubSync(t, nc, "d.drop")
+	require_True(t, addConsumer(&ConsumerConfig{
+		Durable:             "DROP",
+		DeliverSubject:      "d.drop",
+		AckPolicy:           AckExplicit,
+		AckWait:             time.Minute,
+		MaxAckPending:       2,
+		MaxAckPendingPolicy: MaxAckPendingDropOld,
+	}) == nil)
+
+	for i := 0; i < 5; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	// All are delivered, the oldest pending ones were dropped for the newest.
+	var last *nats.Msg
+	for seq := uint64(1); seq <= 5; seq++ {
+		last = natsNexMsg(t, sub, time.Second)
+		meta, err := last.Metadata()
+		require_NoError(t, err)
+		require_True(t, meta.Sequence.Stream == seq)
+	}
+	for seq := uint64(1); seq <= 3; seq++ {
+		var e JSConsumerDeliveryDroppedAdvisory
+		require_NoError(t, json.Unmarshal(natsNexMsg(t, asub, time.Second).Data, &e))
+		require_True(t, e.Type == JSConsumerDeliveryDroppedAdvisoryType)
+		require_True(t, e.StreamSeq == seq && e.ConsumerSeq == seq && e.Deliveries == 1)
+	}
+
+	ci, err := js.ConsumerInfo("TEST", "DROP")
+	require_NoError(t, err)
+	require_True(t, ci.NumAckPending == 2)
+	require_True(t, ci.AckFloor.Stream == 3 && ci.AckFloor.Consumer == 3)
+
+	// Dropped messages are removed with interest retention.
+	checkFor(t, time.Second, 50*time.Millisecond, func() error {
+		si, err := js.StreamInfo("TEST")
+		require_NoError(t, err)
+		if si.State.Msgs != 2 {
+			return fmt.Errorf("expected 2 msgs, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+
+	// Acking the newest out of order still drops the oldest pending one next.
+	last.AckSync()
+	for i := 0; i < 2; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	for seq := uint64(6); seq <= 7; seq++ {
+		meta, err := natsNexMsg(t, sub, time.Second).Metadata()
+		require_NoError(t, err)
+		require_True(t, meta.Sequence.Stream == seq)
+	}
+	var e JSConsumerDeliveryDroppedAdvisory
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, asub, time.Second).Data, &e))
+	require_True(t, e.StreamSeq == 4)
+	ci, err = js.ConsumerInfo("TEST", "DROP")
+	require_NoError(t, err)
+	require_True(t, ci.NumAckPending == 2)
+}
+
+func TestJetStreamConsumerDegradedOnSlowClient(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	// The client we deliver to.
+	dnc := natsConnect(t, s.ClientURL())
+	defer dnc.Close()
+	sub := natsSubSync(t, dnc, "d")
+	natsFlush(t, dnc)
+
+	asub := natsSubSync(t, nc, JSAdvisoryConsumerDegradedPre+".TEST.C")
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", DeliverSubject: "d", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	o := mset.lookupConsumer("C")
+	require_True(t, o != nil)
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	natsNexMsg(t, sub, time.Second)
+
+	cid, err := dnc.GetClientID()
+	require_NoError(t, err)
+	c := s.getClient(cid)
+	require_True(t, c != nil)
+	setPending := func(pb int64) {
+		c.mu.Lock()
+		c.out.pb = pb
+		c.mu.Unlock()
+	}
+	checkDegraded := func(degraded bool) {
+		t.Helper()
+		var e JSConsumerDegradedAdvisory
+		require_NoError(t, json.Unmarshal(natsNexMsg(t, asub, time.Second).Data, &e))
+		require_True(t, e.Type == JSConsumerDegradedAdvisoryType)
+		require_True(t, e.Stream == "TEST" && e.Consumer == "C" && e.Degraded == degraded)
+		require_True(t, o.info().Degraded == degraded)
+	}
+
+	// Once the client is half way to its max pending we stop delivering.
+	c.mu.Lock()
+	mp := c.out.mp
+	c.mu.Unlock()
+	setPending(mp/2 + 1)
+
+	// Clients are only checked once per interval.
+	time.Sleep(2 * slowDeliveryCheckInterval)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	checkDegraded(true)
+	_, err = sub.NextMsg(250 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+	df := o.info().DeliveryFailures
+	require_True(t, df != nil && df.Count == 1)
+	require_Equal(t, df.LastError, deliveryFailedSlowConsumer)
+
+	// Not enough drained yet.
+	setPending(mp/4 + 1)
+	_, err = sub.NextMsg(250 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+
+	// Resumes once the client has drained.
+	setPending(0)
+	checkDegraded(false)
+	m := natsNexMsg(t, sub, time.Second)
+	meta, err := m.Metadata()
+	require_NoError(t, err)
+	require_True(t, meta.Sequence.Stream == 2)
+}
+
+func TestJetStreamConsumerDeliveryFailures(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	dnc := natsConnect(t, s.ClientURL())
+	defer dnc.Close()
+	sub := natsSubSync(t, dnc, "d")
+	natsFlush(t, dnc)
+
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", DeliverSubject: "d", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	o := mset.lookupConsumer("C")
+	require_True(t, o != nil)
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	natsNexMsg(t, sub, time.Second)
+	require_True(t, o.info().DeliveryFailures == nil)
+
+	// Losing interest is recorded.
+	require_NoError(t, sub.Unsubscribe())
+	natsFlush(t, dnc)
+	checkFor(t, time.Second, 25*time.Millisecond, func() error {
+		if df := o.info().DeliveryFailures; df == nil || df.LastError != deliveryFailedNoInterest {
+			return fmt.Errorf("no interest not recorded: %+v", df)
+		}
+		return nil
+	})
+	df := o.info().DeliveryFailures
+	require_True(t, df.Count == 1 && !df.First.IsZero() && df.Last.Equal(df.First))
+
+	// Subscribers that do not take a delivery, e.g. since denied by their permissions.
+	sub = natsSubSync(t, dnc, "d")
+	natsFlush(t, dnc)
+	checkFor(t, time.Second, 25*time.Millisecond, func() error {
+		if !o.isActive() {
+			return fmt.Errorf("consumer not active")
+		}
+		return nil
+	})
+	o.didNotDeliver(1)
+	df = o.info().DeliveryFailures
+	require_True(t, df.Count == 2 && df.Last.After(df.First))
+	require_Equal(t, df.LastError, deliveryFailedNotAccepted)
+}
+
+func TestJetStreamStreamFailedAfterStoreErrors(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	fsub := natsSubSync(t, nc, JSAdvisoryStreamFailedPre+".TEST")
+	rsub := natsSubSync(t, nc, JSAdvisoryStreamReopenedPre+".TEST")
+	require_NoError(t, nc.Flush())
+
+	storeErr := errors.New("no space left on device")
+	// Errors need to be in a row.
+	for i := 0; i < streamStoreErrLimit-1; i++ {
+		mset.storeFailed(storeErr)
+	}
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	for i := 0; i < streamStoreErrLimit-1; i++ {
+		mset.storeFailed(storeErr)
+	}
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+
+	for i := 0; i < streamStoreErrLimit; i++ {
+		mset.storeFailed(storeErr)
+	}
+	_, err = js.Publish("foo", []byte("OK"))
+	var apiErr *nats.APIError
+	require_True(t, errors.As(err, &apiErr))
+	require_True(t, apiErr.ErrorCode == nats.ErrorCode(JSStreamFailedErrF))
+
+	var fadv JSStreamFailedAdvisory
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, fsub, time.Second).Data, &fadv))
+	require_Equal(t, fadv.Stream, "TEST")
+	require_Equal(t, fadv.Error, storeErr.Error())
+	require_True(t, fadv.Errors == streamStoreErrLimit)
+
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+	require_NoError(t, err)
+	var iresp JSApiStreamInfoResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &iresp))
+	require_True(t, iresp.Failed != nil)
+	require_Equal(t, iresp.Failed.Error, storeErr.Error())
+	require_True(t, iresp.State.Msgs == 2)
+
+	rmsg, err = nc.Request(fmt.Sprintf(JSApiStreamReopenT, "TEST"), nil, time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamReopenResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	if resp.Error != nil || !resp.Success {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+
+	var radv JSStreamReopenedAdvisory
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, rsub, time.Second).Data, &radv))
+	require_Equal(t, radv.Stream, "TEST")
+
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 3)
+	require_True(t, mset.failureInfo() == nil)
+}
+
+func TestJetStreamStoreFormat(t *testing.T) {
+	storeDir := t.TempDir()
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q}
+		accounts: {
+			JS: { jetstream: enabled, users: [ {user: js, password: pwd} ] }
+			$SYS: { users: [ {user: admin, password: pwd} ] }
+		}
+	`, storeDir)))
+
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	// A new store gets the current version.
+	jsDir := filepath.Join(storeDir, JetStreamStoreDir)
+	version, err := readStoreFormat(jsDir)
+	require_NoError(t, err)
+	require_True(t, version == JSStoreFormatVersion)
+	jsi, err := s.Jsz(nil)
+	require_NoError(t, err)
+	require_True(t, jsi.StoreFormat == JSStoreFormatVersion)
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("js", "pwd"))
+	defer nc.Close()
+	_, err = js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("OK"))
+	require_NoError(t, err)
+	nc.Close()
+
+	// A store written before we kept a version is still read, and has the first version.
+	s.Shutdown()
+	require_NoError(t, os.RemoveAll(filepath.Join(jsDir, jsStoreFormatDir)))
+	s, _ = RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js = jsClientConnect(t, s, nats.UserInfo("js", "pwd"))
+	defer nc.Close()
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 1)
+	version, err = readStoreFormat(jsDir)
+	require_NoError(t, err)
+	require_True(t, version == jsStoreFormatV1)
+
+	// The format file is kept where releases from before we kept a version do not remove it.
+	fi, err := os.Stat(filepath.Join(jsDir, jsStoreFormatDir))
+	require_NoError(t, err)
+	require_True(t, fi.IsDir())
+	require_Error(t, os.Remove(filepath.Join(jsDir, jsStoreFormatDir)))
+	// And is not taken for an account.
+	hs := s.healthz(&HealthzOptions{})
+	require_True(t, hs.Error == _EMPTY_)
+
+	migrate := func(dryRun bool) *JSStoreFormatInfo {
+		t.Helper()
+		ncs := natsConnect(t, s.ClientURL(), nats.UserInfo("admin", "pwd"))
+		defer ncs.Close()
+		req, _ := json.Marshal(&JSMigrateEventOptions{JSMigrateOptions: JSMigrateOptions{DryRun: dryRun}})
+		rmsg, err := ncs.Request(fmt.Sprintf(serverDirectReqSubj, s.ID(), "JSMIGRATE"), req, time.Second)
+		require_NoError(t, err)
+		var resp struct {
+			Data  *JSStoreFormatInfo `json:"data"`
+			Error *ApiError          `json:"error"`
+		}
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		if resp.Error != nil {
+			t.Fatalf("Unexpected error: %+v", resp.Error)
+		}
+		return resp.Data
+	}
+
+	// Nothing to migrate while we are on the current version.
+	info := migrate(true)
+	require_True(t, info.Previous == JSStoreFormatVersion && info.Version == JSStoreFormatVersion && !info.Migrated)
+	info = migrate(false)
+	require_True(t, info.Previous == JSStoreFormatVersion && !info.Migrated)
+
+	si, err = js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 1)
+
+	// A store with a newer format is not read.
+	dir := t.TempDir()
+	require_NoError(t, writeStoreFormat(dir, JSStoreFormatVersion+1))
+	njs := &jetStream{srv: s, config: JetStreamConfig{StoreDir: dir}}
+	require_Error(t, njs.checkStoreFormat())
+}
+
+func TestJetStreamStreamTombstones(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	// Negative retention is not allowed.
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, MaxMsgs: 5})
+	require_NoError(t, err)
+	cfg := StreamConfig{Name: "TEST", Subjects: []string{"foo"}, MaxMsgs: 5, Storage: FileStorage, Tombstones: -1}
+	req, _ := json.Marshal(&cfg)
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var uresp JSApiStreamUpdateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &uresp))
+	require_True(t, uresp.Error != nil)
+
+	tombstones := func(start, end uint64) *JSApiStreamTombstonesResponse {
+		t.Helper()
+		req, _ := json.Marshal(&JSApiStreamTombstonesRequest{StartSeq: start, EndSeq: end})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamTombstonesT, "TEST"), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamTombstonesResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		if resp.Error != nil {
+			t.Fatalf("Unexpected error: %+v", resp.Error)
+		}
+		return &resp
+	}
+
+	// Removals are not recorded while disabled.
+	for i := 0; i < 6; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+	require_True(t, len(tombstones(0, 0).Tombstones) == 0)
+
+	cfg.Tombstones = time.Minute
+	req, _ = json.Marshal(&cfg)
+	rmsg, err = nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	uresp = JSApiStreamUpdateResponse{}
+	require_NoError(t, json.Unmarshal(rmsg.Data, &uresp))
+	require_True(t, uresp.Error == nil)
+
+	asub := natsSubSync(t, nc, JSAdvisoryStreamMsgDeletedPre+".TEST")
+	require_NoError(t, nc.Flush())
+
+	// Removals by retention from the front are coalesced.
+	for i := 0; i < 3; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+	// An explicit delete.
+	require_NoError(t, js.DeleteMsg("TEST", 7))
+
+	// Sent as a single advisory.
+	var adv JSStreamMsgDeletedAdvisory
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, asub, 2*time.Second).Data, &adv))
+	require_Equal(t, adv.Stream, "TEST")
+	require_True(t, adv.First == 2 && adv.Last == 7)
+	require_True(t, len(adv.Removed) == 2)
+	require_True(t, adv.Removed[0].First == 2 && adv.Removed[0].Last == 4)
+	require_True(t, adv.Removed[1].First == 7 && adv.Removed[1].Last == 7)
+
+	resp := tombstones(0, 0)
+	require_True(t, resp.Retention == time.Minute)
+	require_True(t, len(resp.Tombstones) == 2)
+	require_True(t, resp.Tombstones[0].First == 2 && resp.Tombstones[0].Last == 4)
+	require_True(t, resp.Tombstones[1].First == 7 && resp.Tombstones[1].Last == 7)
+
+	// Only those overlapping with the range.
+	resp = tombstones(5, 0)
+	require_True(t, len(resp.Tombstones) == 1 && resp.Tombstones[0].First == 7)
+	resp = tombstones(0, 3)
+	require_True(t, len(resp.Tombstones) == 1 && resp.Tombstones[0].First == 2)
+
+	// Purges from the front are recorded as a single range.
+	require_NoError(t, js.PurgeStream("TEST", &nats.StreamPurgeRequest{Sequence: 9}))
+	adv = JSStreamMsgDeletedAdvisory{}
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, asub, 2*time.Second).Data, &adv))
+	require_True(t, adv.First == 5 && adv.Last == 8)
+	resp = tombstones(8, 8)
+	require_True(t, len(resp.Tombstones) == 1 && resp.Tombstones[0].First == 5)
+
+	// Filtered purges record what they removed.
+	cfg.Subjects, cfg.MaxMsgs = []string{"foo", "bar"}, 100
+	req, _ = json.Marshal(&cfg)
+	_, err = nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	for _, subj := range []string{"bar", "foo", "bar"} {
+		sendStreamMsg(t, nc, subj, "OK")
+	}
+	require_NoError(t, js.PurgeStream("TEST", &nats.StreamPurgeRequest{Subject: "bar"}))
+	resp = tombstones(10, 0)
+	require_True(t, len(resp.Tombstones) == 2)
+	require_True(t, resp.Tombstones[0].First == 10 && resp.Tombstones[0].Last == 10)
+	require_True(t, resp.Tombstones[1].First == 12 && resp.Tombstones[1].Last == 12)
+
+	// Mirrors record what their upstream removed.
+	mcfg := StreamConfig{Name: "M", Mirror: &StreamSource{Name: "TEST"}, Storage: FileStorage, Tombstones: time.Minute}
+	req, _ = json.Marshal(&mcfg)
+	_, err = nc.Request(fmt.Sprintf(JSApiStreamCreateT, "M"), req, time.Second)
+	require_NoError(t, err)
+	mirror, err := s.GlobalAccount().lookupStream("M")
+	require_NoError(t, err)
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		if ts := mirror.tombstones(10, 10); len(ts) != 1 {
+			return fmt.Errorf("expected a tombstone for 10, got %v", ts)
+		}
+		return nil
+	})
+
+	// Tombstones survive a restart.
+	nc.Close()
+	sd := s.JetStreamConfig().StoreDir
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	ts := mset.tombstones(0, 0)
+	require_True(t, len(ts) == 5)
+	require_True(t, ts[4].First == 12)
+
+	// Expired tombstones are dropped.
+	mset.tombs.setRetention(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	require_True(t, len(mset.tombstones(0, 0)) == 0)
+}
+
+func TestJetStreamStreamChunkedMessages(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		max_payload: 1KB
+		jetstream: {max_mem_store: 64MB, max_file_store: 64MB, store_dir: %q}
+	`, t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	cfg := StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, AllowChunked: true, MaxMsgSize: 4096}
+	req, _ := json.Marshal(&cfg)
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var ccresp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &ccresp))
+	require_True(t, ccresp.Error == nil)
+
+	sendChunk := func(id string, seq int, last bool, data []byte) *JSPubAckResponse {
+		t.Helper()
+		m := nats.NewMsg("foo")
+		m.Header.Set("X-Test", "OK")
+		m.Header.Set(JSChunkId, id)
+		m.Header.Set(JSChunkSeq, strconv.Itoa(seq))
+		if last {
+			m.Header.Set(JSChunkLast, "true")
+		}
+		m.Data = data
+		rmsg, err := nc.RequestMsg(m, time.Second)
+		require_NoError(t, err)
+		var resp JSPubAckResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+
+	// Three chunks make a message larger than max_payload.
+	chunk := bytes.Repeat([]byte("Z"), 900)
+	for i := 1; i <= 2; i++ {
+		resp := sendChunk("A", i, false, chunk)
+		require_True(t, resp.Error == nil)
+		require_True(t, resp.Chunk == i && resp.Sequence == 0)
+	}
+	resp := sendChunk("A", 3, true, chunk)
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Sequence == 1 && resp.Chunk == 0)
+
+	sm, err := js.GetMsg("TEST", 1)
+	require_NoError(t, err)
+	require_True(t, bytes.Equal(sm.Data, bytes.Repeat(chunk, 3)))
+	require_Equal(t, sm.Header.Get("X-Test"), "OK")
+	require_Equal(t, sm.Header.Get(JSChunkId), _EMPTY_)
+	require_Equal(t, sm.Header.Get(JSChunkSeq), _EMPTY_)
+
+	// Out of order chunks drop the message.
+	require_True(t, sendChunk("B", 1, false, chunk).Error == nil)
+	resp = sendChunk("B", 3, true, chunk)
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSStreamChunkedMsgErrF))
+	resp = sendChunk("B", 2, true, chunk)
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSStreamChunkedMsgErrF))
+
+	// The reassembled message is limited by the max message size of the stream.
+	for i := 1; i <= 4; i++ {
+		resp = sendChunk("C", i, false, chunk)
+		require_True(t, resp.Error == nil)
+	}
+	resp = sendChunk("C", 5, true, chunk)
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSStreamMessageExceedsMaximumErr))
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 1)
+
+	// Memory held by incomplete messages counts against the account, and what the server allows.
+	jsa := s.getJetStream().lookupAccount(s.GlobalAccount())
+	require_True(t, atomic.LoadInt64(&jsa.cmem) == 0)
+	require_True(t, sendChunk("E", 1, false, chunk).Error == nil)
+	require_True(t, atomic.LoadInt64(&jsa.cmem) > int64(len(chunk)))
+
+	omax := chunkedMsgMaxServerMem
+	chunkedMsgMaxServerMem = int64(len(chunk))
+	resp = sendChunk("E", 2, false, chunk)
+	chunkedMsgMaxServerMem = omax
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSStreamChunkedMsgErrF))
+	require_True(t, atomic.LoadInt64(&jsa.cmem) == 0)
+
+	require_True(t, sendChunk("F", 1, false, chunk).Error == nil)
+	require_True(t, atomic.LoadInt64(&jsa.cmem) > 0)
+
+	// Accounts without memory storage can still send chunked messages to file streams.
+	require_NoError(t, s.GlobalAccount().UpdateJetStreamLimits(map[string]JetStreamAccountLimits{
+		_EMPTY_: {MaxMemory: 0, MaxStore: -1, MaxStreams: -1, MaxConsumers: -1},
+	}))
+	require_True(t, sendChunk("G", 1, false, chunk).Error == nil)
+
+	// Streams that do not allow chunked messages store the chunks as is.
+	cfg.AllowChunked = false
+	req, _ = json.Marshal(&cfg)
+	rmsg, err = nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var uresp JSApiStreamUpdateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &uresp))
+	require_True(t, uresp.Error == nil)
+
+	require_True(t, atomic.LoadInt64(&jsa.cmem) == 0)
+
+	resp = sendChunk("D", 1, false, chunk)
+	require_True(t, resp.Error == nil && resp.Sequence == 2)
+	sm, err = js.GetMsg("TEST", 2)
+	require_NoError(t, err)
+	require_Equal(t, sm.Header.Get(JSChunkId), "D")
+}
+
+func TestJetStreamStreamSubjectAliases(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"orders.v2.>"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "OTHER", Subjects: []string{"other"}})
+	require_NoError(t, err)
+
+	update := func(aliases ...*SubjectAlias) *ApiError {
+		t.Helper()
+		cfg := StreamConfig{Name: "TEST", Subjects: []string{"orders.v2.>"}, Storage: FileStorage, SubjectAliases: aliases}
+		req, _ := json.Marshal(&cfg)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamUpdateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return resp.Error
+	}
+
+	// Aliases can not overlap with our subjects or those of other streams.
+	require_True(t, update(&SubjectAlias{Subject: "orders.v2.new"}) != nil)
+	require_True(t, update(&SubjectAlias{Subject: "other"}) != nil)
+	require_True(t, update(&SubjectAlias{Subject: "legacy"}, &SubjectAlias{Subject: "legacy"}) != nil)
+	require_True(t, update(&SubjectAlias{Subject: "orders.v1.*", Destination: "orders.v2.$2"}) != nil)
+	// Destinations have to be within our subjects.
+	require_True(t, update(&SubjectAlias{Subject: "orders.v1.*", Destination: "orders.v3.$1"}) != nil)
+	require_True(t, update(&SubjectAlias{Subject: "orders.v1.*", Destination: "$1"}) != nil)
+	require_True(t, update(&SubjectAlias{Subject: "orders.v1.*.*", Destination: "orders.v2.{{split(1,-)}}.$2"}) != nil)
+
+	require_True(t, update(
+		&SubjectAlias{Subject: "orders.v1.*", Destination: "orders.v2.$1"},
+		&SubjectAlias{Subject: "legacy"},
+	) == nil)
+
+	_, err = js.Publish("orders.v1.new", []byte("OK"))
+	require_NoError(t, err)
+	_, err = js.Publish("legacy", []byte("OK"))
+	require_NoError(t, err)
+	_, err = js.Publish("orders.v2.new", []byte("OK"))
+	require_NoError(t, err)
+
+	for seq, subj := range []string{"orders.v2.new", "legacy", "orders.v2.new"} {
+		sm, err := js.GetMsg("TEST", uint64(seq+1))
+		require_NoError(t, err)
+		require_Equal(t, sm.Subject, subj)
+	}
+
+	// Consumers can filter on aliases stored as published, but not on translated ones.
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "dlc", FilterSubject: "legacy", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "v1", FilterSubject: "orders.v1.*", AckPolicy: nats.AckExplicitPolicy})
+	require_Error(t, err)
+
+	// No other stream can take the subject of an alias.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "LEGACY", Subjects: []string{"legacy"}})
+	require_Error(t, err)
+
+	// Removing an alias stops ingesting from it.
+	require_True(t, update(&SubjectAlias{Subject: "orders.v1.*"}) == nil)
+	_, err = js.Publish("legacy", []byte("OK"))
+	require_Error(t, err, nats.ErrNoStreamResponse)
+	// The subject is no longer translated.
+	_, err = js.Publish("orders.v1.new", []byte("OK"))
+	require_NoError(t, err)
+	sm, err := js.GetLastMsg("TEST", "orders.v1.new")
+	require_NoError(t, err)
+	require_True(t, sm.Sequence == 4)
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 4)
+}
+
+func TestJetStreamStreamCanary(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.*"}})
+	require_NoError(t, err)
+
+	addOrUpdate := func(api string, sc *StreamCanary) *ApiError {
+		t.Helper()
+		cfg := StreamConfig{Name: "CANARY", Subjects: []string{"canary.>"}, Storage: FileStorage, Canary: sc}
+		req, _ := json.Marshal(&cfg)
+		rmsg, err := nc.Request(fmt.Sprintf(api, "CANARY"), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return resp.Error
+	}
+
+	require_True(t, addOrUpdate(JSApiStreamCreateT, &StreamCanary{Subjects: []string{"canary.foo"}, Weight: 100}) != nil)
+	require_True(t, addOrUpdate(JSApiStreamCreateT, &StreamCanary{Subjects: []string{"orders.new"}, Weight: 101}) != nil)
+	require_True(t, addOrUpdate(JSApiStreamCreateT, &StreamCanary{Subjects: []string{"orders.new", "orders.new"}, Weight: 100}) != nil)
+	// Only literal subjects can be captured.
+	require_True(t, addOrUpdate(JSApiStreamCreateT, &StreamCanary{Subjects: []string{"orders.*"}, Weight: 100}) != nil)
+	require_True(t, addOrUpdate(JSApiStreamCreateT, &StreamCanary{Subjects: []string{">"}, Weight: 100}) != nil)
+	require_True(t, addOrUpdate(JSApiStreamCreateT, &StreamCanary{Subjects: []string{"orders.new"}, Weight: 100, Destination: "canary.*"}) != nil)
+	// The subjects of the canary may overlap with other streams.
+	require_True(t, addOrUpdate(JSApiStreamCreateT, &StreamCanary{Subjects: []string{"orders.new"}, Weight: 100, Destination: "canary.new"}) == nil)
+
+	publish := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			pa, err := js.Publish("orders.new", []byte("OK"))
+			require_NoError(t, err)
+			// Acknowledged by the stream that stores the subject.
+			require_Equal(t, pa.Stream, "ORDERS")
+		}
+	}
+	msgs := func() uint64 {
+		t.Helper()
+		si, err := js.StreamInfo("CANARY")
+		require_NoError(t, err)
+		return si.State.Msgs
+	}
+
+	publish(10)
+	require_True(t, msgs() == 10)
+	sm, err := js.GetMsg("CANARY", 1)
+	require_NoError(t, err)
+	require_Equal(t, sm.Subject, "canary.new")
+
+	// Consumers can filter on the subjects captured messages are stored with.
+	_, err = js.AddConsumer("CANARY", &nats.ConsumerConfig{Durable: "dlc", FilterSubject: "canary.new", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+
+	// The weight can be changed at runtime.
+	require_True(t, addOrUpdate(JSApiStreamUpdateT, &StreamCanary{Subjects: []string{"orders.new"}, Weight: 0, Destination: "canary.new"}) == nil)
+	publish(10)
+	require_True(t, msgs() == 10)
+
+	require_True(t, addOrUpdate(JSApiStreamUpdateT, &StreamCanary{Subjects: []string{"orders.new"}, Weight: 50, Destination: "canary.new"}) == nil)
+	publish(200)
+	if n := msgs() - 10; n == 0 || n == 200 {
+		t.Fatalf("Expected some messages to be captured, got %d", n)
+	}
+
+	// Removing the canary stops capturing.
+	require_True(t, addOrUpdate(JSApiStreamUpdateT, nil) == nil)
+	n := msgs()
+	publish(10)
+	require_True(t, msgs() == n)
+
+	si, err := js.StreamInfo("ORDERS")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 230)
+}
+
+func TestJetStreamStreamPartitionRebalance(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"p.*"}, Retention: nats.WorkQueuePolicy})
+	require_NoError(t, err)
+	for _, p := range []string{"A", "B", "C", "D"} {
+		_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: p, FilterSubject: "p." + p, AckPolicy: nats.AckExplicitPolicy})
+		require_NoError(t, err)
+	}
+
+	request := func(api string, req *JSApiStreamPartitionRequest) *JSApiStreamPartitionResponse {
+		t.Helper()
+		b, _ := json.Marshal(req)
+		rmsg, err := nc.Request(fmt.Sprintf(api, "TEST"), b, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamPartitionResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+	heartbeat := func(worker string, ttl time.Duration) []string {
+		t.Helper()
+		resp := request(JSApiStreamPartitionHeartbeatT, &JSApiStreamPartitionRequest{Worker: worker, TTL: ttl})
+		require_True(t, resp.Error == nil)
+		return resp.Partitions
+	}
+	asub := natsSubSync(t, nc, JSAdvisoryStreamPartitionsPre+".TEST")
+	expectAdvisory := func(reason string) map[string][]string {
+		t.Helper()
+		var e JSStreamPartitionsAssignedAdvisory
+		require_NoError(t, json.Unmarshal(natsNexMsg(t, asub, 2*time.Second).Data, &e))
+		require_Equal(t, e.Reason, reason)
+		return e.Assignments
+	}
+
+	require_True(t, request(JSApiStreamPartitionHeartbeatT, &JSApiStreamPartitionRequest{}).Error != nil)
+
+	require_Equal(t, strings.Join(heartbeat("w1", time.Minute), ","), "A,B,C,D")
+	expectAdvisory(PartitionRebalanceJoin)
+
+	// The new worker takes half, the first one keeps the others.
+	require_Equal(t, strings.Join(heartbeat("w2", time.Minute), ","), "C,D")
+	as := expectAdvisory(PartitionRebalanceJoin)
+	require_Equal(t, strings.Join(as["w1"], ","), "A,B")
+	require_Equal(t, strings.Join(heartbeat("w1", time.Minute), ","), "A,B")
+
+	// Workers are bound to the connection that registered them.
+	nc2 := natsConnect(t, s.ClientURL())
+	defer nc2.Close()
+	for _, api := range []string{JSApiStreamPartitionHeartbeatT, JSApiStreamPartitionLeaveT} {
+		b, _ := json.Marshal(&JSApiStreamPartitionRequest{Worker: "w1", TTL: time.Minute})
+		rmsg, err := nc2.Request(fmt.Sprintf(api, "TEST"), b, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamPartitionResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSStreamPartitionsErrF))
+	}
+	require_Equal(t, strings.Join(heartbeat("w1", time.Minute), ","), "A,B")
+
+	// A worker that does not heartbeat in time is lost.
+	require_True(t, len(heartbeat("w3", 250*time.Millisecond)) == 1)
+	expectAdvisory(PartitionRebalanceJoin)
+	as = expectAdvisory(PartitionRebalanceLost)
+	require_True(t, len(as) == 2 && len(as["w1"])+len(as["w2"]) == 4)
+
+	// Consumers that are added are picked up.
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "E", FilterSubject: "p.E", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	heartbeat("w2", time.Minute)
+	expectAdvisory(PartitionRebalanceConsumers)
+
+	// A worker that leaves gives up its partitions right away.
+	resp := request(JSApiStreamPartitionLeaveT, &JSApiStreamPartitionRequest{Worker: "w2"})
+	require_True(t, resp.Error == nil)
+	expectAdvisory(PartitionRebalanceLeave)
+	resp = request(JSApiStreamPartitionInfoT, &JSApiStreamPartitionRequest{})
+	require_True(t, resp.Error == nil && resp.Generation == 6)
+	require_True(t, len(resp.Assignments) == 1)
+	require_Equal(t, strings.Join(resp.Assignments["w1"], ","), "A,B,C,D,E")
+
+	// Only for WorkQueue streams.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "LIMITS", Subjects: []string{"l"}})
+	require_NoError(t, err)
+	b, _ := json.Marshal(&JSApiStreamPartitionRequest{Worker: "w1"})
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamPartitionHeartbeatT, "LIMITS"), b, time.Second)
+	require_NoError(t, err)
+	var lresp JSApiStreamPartitionResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &lresp))
+	require_True(t, lresp.Error != nil && lresp.Error.ErrCode == uint16(JSStreamPartitionsErrF))
+}
+
+func TestJetStreamStreamRetentionPreview(t *testing.T) {
+	for _, st := range []nats.StorageType{nats.FileStorage, nats.MemoryStorage} {
+		t.Run(st.String(), func(t *testing.T) {
+			s := RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+
+			nc, js := jsClientConnect(t, s)
+			defer nc.Close()
+
+			_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: st, MaxMsgs: 100})
+			require_NoError(t, err)
+			for i := 0; i < 5; i++ {
+				_, err = js.Publish("foo", bytes.Repeat([]byte("Z"), 100))
+				require_NoError(t, err)
+			}
+			time.Sleep(250 * time.Millisecond)
+			for i := 0; i < 5; i++ {
+				_, err = js.Publish("foo", bytes.Repeat([]byte("Z"), 100))
+				require_NoError(t, err)
+			}
+			si, err := js.StreamInfo("TEST")
+			require_NoError(t, err)
+			msgSize := si.State.Bytes / si.State.Msgs
+
+			preview := func(req *JSApiStreamRetentionPreviewRequest) *JSApiStreamRetentionPreviewResponse {
+				t.Helper()
+				b, _ := json.Marshal(req)
+				rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamRetentionPreviewT, "TEST"), b, time.Second)
+				require_NoError(t, err)
+				var resp JSApiStreamRetentionPreviewResponse
+				require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+				require_True(t, resp.Error == nil)
+				return &resp
+			}
+
+			// Current limits remove nothing.
+			resp := preview(&JSApiStreamRetentionPreviewRequest{})
+			require_True(t, resp.MaxMsgs == 100 && resp.MaxBytes == -1 && resp.MaxAge == 0)
+			require_True(t, resp.Msgs == 0 && resp.Bytes == 0 && resp.FirstSeq == 1)
+
+			resp = preview(&JSApiStreamRetentionPreviewRequest{MaxMsgs: 4})
+			require_True(t, resp.Msgs == 6 && resp.Bytes == 6*msgSize && resp.FirstSeq == 7)
+
+			resp = preview(&JSApiStreamRetentionPreviewRequest{MaxBytes: int64(3 * msgSize)})
+			require_True(t, resp.Msgs == 7 && resp.Bytes == 7*msgSize && resp.FirstSeq == 8)
+
+			resp = preview(&JSApiStreamRetentionPreviewRequest{MaxAge: 200 * time.Millisecond})
+			require_True(t, resp.Msgs == 5 && resp.Bytes == 5*msgSize && resp.FirstSeq == 6)
+
+			// The most restrictive limit wins.
+			resp = preview(&JSApiStreamRetentionPreviewRequest{MaxAge: 200 * time.Millisecond, MaxMsgs: 2})
+			require_True(t, resp.Msgs == 8 && resp.FirstSeq == 9)
+
+			// Removing the limit.
+			resp = preview(&JSApiStreamRetentionPreviewRequest{MaxMsgs: -1, MaxBytes: int64(msgSize)})
+			require_True(t, resp.MaxMsgs == -1 && resp.Msgs == 9 && resp.FirstSeq == 10)
+
+			// Matches what an update does.
+			resp = preview(&JSApiStreamRetentionPreviewRequest{MaxMsgs: 3})
+			_, err = js.UpdateStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: st, MaxMsgs: 3})
+			require_NoError(t, err)
+			si, err = js.StreamInfo("TEST")
+			require_NoError(t, err)
+			require_True(t, si.State.Msgs == 10-resp.Msgs && si.State.Bytes == 10*msgSize-resp.Bytes && si.State.FirstSeq == resp.FirstSeq)
+
+			rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamRetentionPreviewT, "MISSING"), nil, time.Second)
+			require_NoError(t, err)
+			var resp2 JSApiStreamRetentionPreviewResponse
+			require_NoError(t, json.Unmarshal(rmsg.Data, &resp2))
+			require_True(t, resp2.Error != nil && resp2.Error.ErrCode == uint16(JSStreamNotFoundErr))
+		})
+	}
+}
+
+func TestJetStreamStandby(t *testing.T) {
+	tmpl := `
+		listen: 127.0.0.1:-1
+		server_name: %s
+		jetstream: {store_dir: %q, %s}
+		accounts: {
+			JS: { jetstream: enabled, users: [ {user: js, password: pwd} ] }
+			$SYS: { users: [ {user: sys, password: pwd} ] }
+		}
+	`
+	conf := createConfFile(t, []byte(fmt.Sprintf(tmpl, "P", t.TempDir(), _EMPTY_)))
+	p, _ := RunServerWithConfig(conf)
+	defer p.Shutdown()
+
+	nc, js := jsClientConnect(t, p, nats.UserInfo("js", "pwd"))
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "EVENTS", Subjects: []string{"events"}, Storage: nats.MemoryStorage, MaxMsgs: 5})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "TEMP", Subjects: []string{"temp"}})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish(fmt.Sprintf("orders.%d", i), []byte("ORDER"))
+		require_NoError(t, err)
+		_, err = js.Publish("events", []byte("EVENT"))
+		require_NoError(t, err)
+	}
+	// An interior delete on the primary.
+	require_NoError(t, js.DeleteMsg("ORDERS", 5))
+
+	standby := fmt.Sprintf(`standby: {urls: [%q], user: sys, password: pwd, interval: "100ms"}`, p.ClientURL())
+	conf = createConfFile(t, []byte(fmt.Sprintf(tmpl, "S", t.TempDir(), standby)))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	ncs, jss := jsClientConnect(t, s, nats.UserInfo("js", "pwd"))
+	defer ncs.Close()
+
+	checkShipped := func() {
+		t.Helper()
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			for _, name := range []string{"ORDERS", "EVENTS"} {
+				psi, err := js.StreamInfo(name)
+				require_NoError(t, err)
+				si, err := jss.StreamInfo(name)
+				if err != nil {
+					return err
+				}
+				if si.State.FirstSeq != psi.State.FirstSeq || si.State.LastSeq != psi.State.LastSeq {
+					return fmt.Errorf("stream %q state %+v does not match %+v", name, si.State, psi.State)
+				}
+				if !reflect.DeepEqual(si.Config, psi.Config) {
+					return fmt.Errorf("stream %q config %+v does not match %+v", name, si.Config, psi.Config)
+				}
+			}
+			return nil
+		})
+	}
+	checkShipped()
+
+	m, err := jss.GetMsg("ORDERS", 3)
+	require_NoError(t, err)
+	require_Equal(t, m.Subject, "orders.2")
+	require_Equal(t, string(m.Data), "ORDER")
+	pm, err := js.GetMsg("ORDERS", 3)
+	require_NoError(t, err)
+	require_True(t, m.Time.Equal(pm.Time))
+	_, err = jss.GetMsg("ORDERS", 5)
+	require_Error(t, err)
+
+	// A primary that is still recovering does not respond with a partial listing.
+	pjs := p.getJetStream()
+	pjs.mu.Lock()
+	started := pjs.started
+	pjs.started = time.Time{}
+	pjs.mu.Unlock()
+	_, err = p.jsShipReq(&JSShipOptions{})
+	require_Error(t, err, errors.New("jetstream not started"))
+	pjs.mu.Lock()
+	pjs.started = started
+	pjs.mu.Unlock()
+
+	// Keeps shipping, including removals and new config.
+	for i := 0; i < 3; i++ {
+		_, err = js.Publish("orders.new", []byte("ORDER"))
+		require_NoError(t, err)
+		_, err = js.Publish("events", []byte("EVENT"))
+		require_NoError(t, err)
+	}
+	_, err = js.UpdateStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>", "returns.>"}})
+	require_NoError(t, err)
+	require_NoError(t, js.DeleteStream("TEMP"))
+	checkShipped()
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		if _, err := jss.StreamInfo("TEMP"); err != nats.ErrStreamNotFound {
+			return fmt.Errorf("expected stream to be removed, got %v", err)
+		}
+		return nil
+	})
+
+	// A standby does not take messages.
+	_, err = jss.Publish("orders.standby", []byte("ORDER"))
+	require_Error(t, err, nats.ErrNoStreamResponse)
+
+	sysc := natsConnect(t, s.ClientURL(), nats.UserInfo("sys", "pwd"))
+	defer sysc.Close()
+	standbyReq := func(opts *JSStandbyOptions) *JSStandbyInfo {
+		t.Helper()
+		req, _ := json.Marshal(opts)
+		rmsg, err := sysc.Request(fmt.Sprintf(serverDirectReqSubj, s.ID(), "JSSTANDBY"), req, time.Second)
+		require_NoError(t, err)
+		var info JSStandbyInfo
+		resp := ServerAPIResponse{Data: &info}
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		return &info
+	}
+	info := standbyReq(&JSStandbyOptions{})
+	require_True(t, info.Standby && info.Connected && info.Primary == "P" && info.Streams == 2)
+
+	// Once promoted we take messages, and no longer ship.
+	info = standbyReq(&JSStandbyOptions{Promote: true})
+	require_True(t, info.Promoted && !info.Standby)
+	pa, err := jss.Publish("returns.1", []byte("RETURN"))
+	require_NoError(t, err)
+	require_True(t, pa.Sequence == 14)
+	_, err = js.Publish("orders.new", []byte("ORDER"))
+	require_NoError(t, err)
+	time.Sleep(250 * time.Millisecond)
+	si, err := jss.StreamInfo("ORDERS")
+	require_NoError(t, err)
+	require_True(t, si.State.LastSeq == 14)
+
+	// Stays promoted when restarted with the standby config.
+	sd := s.JetStreamConfig().StoreDir
+	s.Shutdown()
+	s.WaitForShutdown()
+	conf = createConfFile(t, []byte(fmt.Sprintf(tmpl, "S", filepath.Dir(sd), standby)))
+	s, _ = RunServerWithConfig(conf)
+	defer s.Shutdown()
+	ncs, jss = jsClientConnect(t, s, nats.UserInfo("js", "pwd"))
+	defer ncs.Close()
+	_, err = jss.Publish("returns.2", []byte("RETURN"))
+	require_NoError(t, err)
+}
+
+func TestJetStreamTraceContextPropagation(t *testing.T) {
+	for _, test := range []struct {
+		tp    string
+		valid bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-abcd", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-abcd", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7-01", false},
+		{"bad", false},
+	} {
+		require_True(t, isValidTraceParent([]byte(test.tp)) == test.valid)
+	}
+
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "dlc", AckPolicy: nats.AckExplicitPolicy, MaxDeliver: 2})
+	require_NoError(t, err)
+
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	m := nats.NewMsg("foo")
+	m.Header[JSTraceParent] = []string{tp}
+	m.Header[JSTraceState] = []string{"congo=t61rcWkgMzE"}
+	m.Data = []byte("traced")
+	_, err = js.PublishMsg(m)
+	require_NoError(t, err)
+	// Not traced, advisories about it have no trace context.
+	_, err = js.Publish("foo", []byte("plain"))
+	require_NoError(t, err)
+
+	nak, err := nc.SubscribeSync(JSAdvisoryConsumerMsgNakPre + ".TEST.dlc")
+	require_NoError(t, err)
+	maxd, err := nc.SubscribeSync(JSAdvisoryConsumerMaxDeliveryExceedPre + ".TEST.dlc")
+	require_NoError(t, err)
+	require_NoError(t, nc.Flush())
+
+	sub, err := js.PullSubscribe("foo", "dlc")
+	require_NoError(t, err)
+
+	// The trace context is delivered with the message, and carried by the advisories about it.
+	for i := 0; i < 2; i++ {
+		msgs, err := sub.Fetch(2, nats.MaxWait(2*time.Second))
+		require_NoError(t, err)
+		require_True(t, len(msgs) == 2)
+		require_Equal(t, msgs[0].Header.Get(JSTraceParent), tp)
+		require_Equal(t, msgs[1].Header.Get(JSTraceParent), _EMPTY_)
+		for _, msg := range msgs {
+			require_NoError(t, msg.Nak())
+		}
+		for j, etp := range []string{tp, _EMPTY_} {
+			am, err := nak.NextMsg(time.Second)
+			require_NoError(t, err)
+			require_Equal(t, am.Header.Get(JSTraceParent), etp)
+			var adv JSConsumerDeliveryNakAdvisory
+			require_NoError(t, json.Unmarshal(am.Data, &adv))
+			require_True(t, adv.StreamSeq == uint64(j+1))
+			require_Equal(t, adv.TraceParent, etp)
+			if etp != _EMPTY_ {
+				require_Equal(t, am.Header.Get(JSTraceState), "congo=t61rcWkgMzE")
+			}
+		}
+	}
+
+	// Max deliveries is checked on the next attempt to deliver.
+	_, err = sub.Fetch(1, nats.MaxWait(250*time.Millisecond))
+	require_Error(t, err, nats.ErrTimeout)
+
+	am, err := maxd.NextMsg(2 * time.Second)
+	require_NoError(t, err)
+	var adv JSConsumerDeliveryExceededAdvisory
+	require_NoError(t, json.Unmarshal(am.Data, &adv))
+	require_True(t, adv.StreamSeq == 1)
+	require_Equal(t, adv.TraceParent, tp)
+	require_Equal(t, am.Header.Get(JSTraceParent), tp)
+}
+
+func TestJetStreamStreamEvictionSubject(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("evicted")
+	require_NoError(t, err)
+	require_NoError(t, nc.Flush())
+
+	// Evictions are batched, so keep what was received but not checked yet.
+	var evs []StreamEviction
+	checkEviction := func(stream string, seq uint64, subj string, reason RetentionReason) {
+		t.Helper()
+		if len(evs) == 0 {
+			m, err := sub.NextMsg(2 * time.Second)
+			require_NoError(t, err)
+			var batch StreamEvictions
+			require_NoError(t, json.Unmarshal(m.Data, &batch))
+			require_Equal(t, batch.Stream, stream)
+			require_True(t, len(batch.Evictions) > 0)
+			evs = batch.Evictions
+		}
+		ev := evs[0]
+		evs = evs[1:]
+		require_True(t, ev.Sequence == seq)
+		require_Equal(t, ev.Subject, subj)
+		require_True(t, ev.Size > 0)
+		require_Equal(t, string(ev.Reason), string(reason))
+	}
+
+	acc := s.GlobalAccount()
+	for _, st := range []StorageType{FileStorage, MemoryStorage} {
+		t.Run(st.String(), func(t *testing.T) {
+			mset, err := acc.addStream(&StreamConfig{
+				Name:            "LIMITS",
+				Subjects:        []string{"foo.*"},
+				Storage:         st,
+				MaxMsgs:         3,
+				MaxMsgsPer:      1,
+				EvictionSubject: "evicted",
+			})
+			require_NoError(t, err)
+			defer mset.delete()
+
+			for _, subj := range []string{"foo.a", "foo.b", "foo.a", "foo.c", "foo.d"} {
+				_, err = js.Publish(subj, []byte("ok"))
+				require_NoError(t, err)
+			}
+			checkEviction("LIMITS", 1, "foo.a", RetentionMaxMsgsPer)
+			checkEviction("LIMITS", 2, "foo.b", RetentionMaxMsgs)
+
+			// Explicit deletes are not evictions.
+			require_NoError(t, js.DeleteMsg("LIMITS", 3))
+			_, err = sub.NextMsg(100 * time.Millisecond)
+			require_Error(t, err, nats.ErrTimeout)
+
+			// Max age.
+			cfg := mset.config()
+			cfg.MaxAge, cfg.Duplicates = 100*time.Millisecond, 100*time.Millisecond
+			require_NoError(t, mset.update(&cfg))
+			checkEviction("LIMITS", 4, "foo.c", RetentionMaxAge)
+			checkEviction("LIMITS", 5, "foo.d", RetentionMaxAge)
+		})
+	}
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:      "WQ",
+		Subjects:  []string{"bar"},
+		Retention: nats.WorkQueuePolicy,
+	})
+	require_NoError(t, err)
+	// Can be enabled with an update.
+	mset, err := acc.lookupStream("WQ")
+	require_NoError(t, err)
+	cfg := mset.config()
+	cfg.EvictionSubject = "evicted"
+	require_NoError(t, mset.update(&cfg))
+
+	_, err = js.Publish("bar", []byte("work"))
+	require_NoError(t, err)
+	psub, err := js.PullSubscribe("bar", "worker")
+	require_NoError(t, err)
+	msgs, err := psub.Fetch(1)
+	require_NoError(t, err)
+	require_NoError(t, msgs[0].AckSync())
+	checkEviction("WQ", 1, "bar", RetentionWorkQueue)
+
+	// Deleting the only consumer of an interest stream evicts what it had not acked.
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:      "IN",
+		Subjects:  []string{"baz"},
+		Retention: nats.InterestPolicy,
+	})
+	require_NoError(t, err)
+	mset, err = acc.lookupStream("IN")
+	require_NoError(t, err)
+	cfg = mset.config()
+	cfg.EvictionSubject = "evicted"
+	require_NoError(t, mset.update(&cfg))
+	_, err = js.AddConsumer("IN", &nats.ConsumerConfig{Durable: "C", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = js.Publish("baz", []byte("ok"))
+		require_NoError(t, err)
+	}
+	require_NoError(t, js.DeleteConsumer("IN", "C"))
+	for seq := uint64(1); seq <= 3; seq++ {
+		checkEviction("IN", seq, "baz", RetentionInterest)
+	}
+	require_True(t, len(evs) == 0)
+
+	// Invalid eviction subjects.
+	for _, subj := range []string{"evicted.*", "bar", "foo bar"} {
+		_, err = acc.addStream(&StreamConfig{Name: "BAD", Subjects: []string{"bar.>", "bar"}, EvictionSubject: subj})
+		require_Error(t, err)
+	}
+}
+
+func TestJetStreamConsumerExclusiveAttach(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+	nc2, _ := jsClientConnect(t, s)
+	defer nc2.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	// Needs to be a durable pull consumer.
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "push", DeliverSubject: "bar", AckPolicy: AckExplicit, Exclusive: true})
+	require_Error(t, err, NewJSConsumerInvalidExclusiveError(errors.New("exclusive consumers need to be pull consumers")))
+	_, err = mset.addConsumer(&ConsumerConfig{AckPolicy: AckExplicit, Exclusive: true})
+	require_Error(t, err, NewJSConsumerInvalidExclusiveError(errors.New("exclusive consumers need to be durable")))
+
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "dlc", AckPolicy: AckExplicit, AckWait: 250 * time.Millisecond, Exclusive: true})
+	require_NoError(t, err)
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "shared", AckPolicy: AckExplicit})
+	require_NoError(t, err)
+
+	attach := func(nc *nats.Conn, consumer, fence string, takeover bool) *JSApiConsumerAttachResponse {
+		t.Helper()
+		req, err := json.Marshal(&JSApiConsumerAttachRequest{Fence: fence, Takeover: takeover})
+		require_NoError(t, err)
+		m, err := nc.Request(fmt.Sprintf(JSApiConsumerAttachT, "TEST", consumer), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerAttachResponse
+		require_NoError(t, json.Unmarshal(m.Data, &resp))
+		return &resp
+	}
+	pull := func(nc *nats.Conn, fence string, expires time.Duration) *nats.Msg {
+		t.Helper()
+		req, err := json.Marshal(&JSApiConsumerGetNextRequest{Batch: 1, Expires: expires})
+		require_NoError(t, err)
+		m := nats.NewMsg(fmt.Sprintf(JSApiRequestNextT, "TEST", "dlc"))
+		if fence != _EMPTY_ {
+			m.Header.Set(JSConsumerFence, fence)
+		}
+		m.Data = req
+		resp, err := nc.RequestMsg(m, 2*time.Second)
+		require_NoError(t, err)
+		return resp
+	}
+	ack := func(nc *nats.Conn, m *nats.Msg, fence string) {
+		t.Helper()
+		am := nats.NewMsg(m.Reply)
+		am.Header.Set(JSConsumerFence, fence)
+		require_NoError(t, nc.PublishMsg(am))
+		require_NoError(t, nc.Flush())
+	}
+	numAckPending := func() int {
+		t.Helper()
+		// Acks are processed async.
+		time.Sleep(50 * time.Millisecond)
+		ci, err := js.ConsumerInfo("TEST", "dlc")
+		require_NoError(t, err)
+		return ci.NumAckPending
+	}
+
+	resp := attach(nc, "shared", _EMPTY_, false)
+	require_Error(t, resp.ToError(), NewJSConsumerNotExclusiveError())
+
+	// Nothing is delivered without being attached.
+	_, err = js.Publish("foo", []byte("1"))
+	require_NoError(t, err)
+	m := pull(nc, _EMPTY_, 250*time.Millisecond)
+	require_Equal(t, m.Header.Get("Status"), "409")
+	require_Equal(t, m.Header.Get("Description"), "Consumer Fenced")
+
+	resp = attach(nc, "dlc", _EMPTY_, false)
+	require_True(t, resp.Error == nil && resp.Fence != _EMPTY_)
+	fence := resp.Fence
+	// Attaching again with the fencing token is fine, another client can not attach.
+	resp = attach(nc, "dlc", fence, false)
+	require_Equal(t, resp.Fence, fence)
+	resp = attach(nc2, "dlc", _EMPTY_, false)
+	require_Error(t, resp.ToError(), NewJSConsumerAttachedError())
+
+	m = pull(nc, fence, 250*time.Millisecond)
+	require_Equal(t, string(m.Data), "1")
+	ack(nc, m, fence)
+	require_True(t, numAckPending() == 0)
+
+	// Deliver one more to the first client, then have it wait for the next one.
+	_, err = js.Publish("foo", []byte("2"))
+	require_NoError(t, err)
+	m = pull(nc, fence, 250*time.Millisecond)
+	require_Equal(t, string(m.Data), "2")
+
+	req, err := json.Marshal(&JSApiConsumerGetNextRequest{Batch: 1, Expires: 5 * time.Second})
+	require_NoError(t, err)
+	waiting, err := nc.SubscribeSync(nats.NewInbox())
+	require_NoError(t, err)
+	wm := nats.NewMsg(fmt.Sprintf(JSApiRequestNextT, "TEST", "dlc"))
+	wm.Reply, wm.Data = waiting.Subject, req
+	wm.Header.Set(JSConsumerFence, fence)
+	require_NoError(t, nc.PublishMsg(wm))
+	require_NoError(t, nc.Flush())
+
+	// The second client takes over, the first is fenced off.
+	resp = attach(nc2, "dlc", _EMPTY_, true)
+	require_True(t, resp.Error == nil && resp.Fence != _EMPTY_ && resp.Fence != fence)
+	fence2 := resp.Fence
+
+	sm, err := waiting.NextMsg(time.Second)
+	require_NoError(t, err)
+	require_Equal(t, sm.Header.Get("Status"), "409")
+	require_Equal(t, sm.Header.Get("Description"), "Consumer Fenced")
+
+	// Its ack is dropped, so the message is redelivered to the second client.
+	ack(nc, m, fence)
+	require_True(t, numAckPending() == 1)
+	m2 := pull(nc2, fence2, time.Second)
+	require_Equal(t, string(m2.Data), "2")
+	ack(nc2, m2, fence2)
+	require_True(t, numAckPending() == 0)
+
+	m = pull(nc, fence, 250*time.Millisecond)
+	require_Equal(t, m.Header.Get("Status"), "409")
+
+	// Another client can attach once the attached one is idle.
+	o := mset.lookupConsumer("dlc")
+	o.mu.Lock()
+	o.attached.last = time.Now().Add(-consumerAttachIdleThreshold)
+	o.mu.Unlock()
+	resp = attach(nc, "dlc", _EMPTY_, false)
+	require_True(t, resp.Error == nil && resp.Fence != fence2)
+}
+
+func TestJetStreamConsumerRedeliveryJitter(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	addConsumer := func(cfg *ConsumerConfig) *ApiError {
+		t.Helper()
+		req, _ := json.Marshal(&CreateConsumerRequest{Stream: "TEST", Config: *cfg})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", cfg.Durable), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		if resp.Error == nil {
+			require_True(t, resp.Config.RedeliveryJitter == cfg.RedeliveryJitter)
+		}
+		return resp.Error
+	}
+
+	apiErr := addConsumer(&ConsumerConfig{Durable: "NEG", AckPolicy: AckExplicit, RedeliveryJitter: -time.Second})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSConsumerInvalidPolicyErrF))
+	apiErr = addConsumer(&ConsumerConfig{Durable: "NOACK", DeliverSubject: "d.noack", AckPolicy: AckNone, RedeliveryJitter: time.Second})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSConsumerInvalidPolicyErrF))
+
+	const (
+		numMsgs = 100
+		ackWait = 250 * time.Millisecond
+		jitter  = time.Second
+	)
+	sub := natsSubSync(t, nc, "d.jitter")
+	defer sub.Unsubscribe()
+	require_True(t, addConsumer(&ConsumerConfig{
+		Durable:          "JITTER",
+		DeliverSubject:   "d.jitter",
+		AckPolicy:        AckExplicit,
+		AckWait:          ackWait,
+		MaxDeliver:       2,
+		RedeliveryJitter: jitter,
+	}) == nil)
+
+	start := time.Now()
+	for i := 0; i < numMsgs; i++ {
+		js.PublishAsync("foo", []byte("OK"))
+	}
+	select {
+	case <-js.PublishAsyncComplete():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive completion signal")
+	}
+
+	var first, last time.Time
+	for i := 0; i < 2*numMsgs; i++ {
+		m := natsNexMsg(t, sub, 3*time.Second)
+		meta, err := m.Metadata()
+		require_NoError(t, err)
+		if meta.NumDelivered == 1 {
+			continue
+		}
+		now := time.Now()
+		if first.IsZero() {
+			first = now
+		}
+		last = now
+	}
+	// Redeliveries are never early, and spread over the jitter window instead of all at once.
+	require_True(t, first.Sub(start) >= ackWait)
+	if spread := last.Sub(first); spread < jitter/2 {
+		t.Fatalf("Expected redeliveries to be spread over the jitter window, got %v", spread)
+	}
+	require_True(t, last.Sub(start) < ackWait+jitter+time.Second)
+
+	// Jitter is stable for a delivery attempt and stays within the window.
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	o := mset.lookupConsumer("JITTER")
+	require_True(t, o != nil)
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for seq := uint64(1); seq <= numMsgs; seq++ {
+		j := o.redeliveryJitter(seq, 1)
+		require_True(t, j >= 0 && j < int64(jitter))
+		require_True(t, j == o.redeliveryJitter(seq, 1))
+	}
+}
+
+func TestJetStreamStreamMemoryHead(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	addStream := func(cfg *StreamConfig) (*StreamConfig, *ApiError) {
+		t.Helper()
+		req, _ := json.Marshal(cfg)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, cfg.Name), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return &resp.Config, nil
+	}
+
+	_, apiErr := addStream(&StreamConfig{Name: "MEM", Subjects: []string{"mem"}, Storage: MemoryStorage, MemoryHeadBytes: 1024})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSStreamInvalidConfigF))
+	_, apiErr = addStream(&StreamConfig{Name: "NEG", Subjects: []string{"neg"}, Storage: FileStorage, MemoryHeadBytes: -1})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSStreamInvalidConfigF))
+	_, apiErr = addStream(&StreamConfig{Name: "BIG", Subjects: []string{"big"}, Storage: FileStorage, MemoryHeadBytes: maxMemoryHeadBytes + 1})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSStreamInvalidConfigF))
+
+	cfg, apiErr := addStream(&StreamConfig{Name: "TEST", Subjects: []string{"foo.*"}, Storage: FileStorage, MemoryHeadBytes: 4096})
+	require_True(t, apiErr == nil)
+	require_True(t, cfg.MemoryHeadBytes == 4096)
+
+	// Consumers see the same stream whether messages are in memory or only in the files.
+	msg := bytes.Repeat([]byte("Z"), 128)
+	for i := 0; i < 200; i++ {
+		_, err := js.Publish(fmt.Sprintf("foo.%d", i%2), msg)
+		require_NoError(t, err)
+	}
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	fs := mset.store.(*fileStore)
+	msgs, hbytes := fs.head.size()
+	require_True(t, msgs > 0 && msgs < 200 && hbytes <= 4096)
+
+	sub, err := js.PullSubscribe("foo.1", "dlc")
+	require_NoError(t, err)
+	var received int
+	for received < 100 {
+		fetched, err := sub.Fetch(25, nats.MaxWait(2*time.Second))
+		require_NoError(t, err)
+		for _, m := range fetched {
+			meta, err := m.Metadata()
+			require_NoError(t, err)
+			require_True(t, meta.Sequence.Stream == uint64(2*received+2))
+			require_True(t, bytes.Equal(m.Data, msg))
+			require_NoError(t, m.AckSync())
+			received++
+		}
+	}
+
+	// Can be changed and disabled with an update.
+	cfg.MemoryHeadBytes = 0
+	req, _ := json.Marshal(cfg)
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamUpdateResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	require_True(t, resp.Error == nil)
+	msgs, _ = fs.head.size()
+	require_True(t, msgs == 0)
+	m, err := js.GetMsg("TEST", 200)
+	require_NoError(t, err)
+	require_True(t, m.Subject == "foo.1")
+
+	// The memory head is reserved against the memory limits of the account and the server.
+	memReserved := func() int64 {
+		sjs := s.getJetStream()
+		sjs.mu.RLock()
+		defer sjs.mu.RUnlock()
+		return sjs.memReserved
+	}
+	require_True(t, memReserved() == 0)
+	require_NoError(t, s.GlobalAccount().UpdateJetStreamLimits(map[string]JetStreamAccountLimits{
+		_EMPTY_: {MaxMemory: 8192, MaxStore: -1},
+	}))
+	updateHead := func(head int64) *ApiError {
+		t.Helper()
+		cfg.MemoryHeadBytes = head
+		req, _ := json.Marshal(cfg)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamUpdateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return resp.Error
+	}
+	require_True(t, updateHead(4096) == nil)
+	require_True(t, memReserved() == 4096)
+	apiErr = updateHead(16 * 1024)
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSMemoryResourcesExceededErr))
+	_, apiErr = addStream(&StreamConfig{Name: "OTHER", Subjects: []string{"other"}, Storage: FileStorage, MemoryHeadBytes: 8192})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSMemoryResourcesExceededErr))
+	_, apiErr = addStream(&StreamConfig{Name: "MEM", Subjects: []string{"mem"}, Storage: MemoryStorage, MaxBytes: 8192})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSMemoryResourcesExceededErr))
+
+	require_NoError(t, js.DeleteStream("TEST"))
+	require_True(t, memReserved() == 0)
+}
+
+func TestJetStreamStreamHeaderIndex(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	addStream := func(cfg *StreamConfig) *ApiError {
+		t.Helper()
+		req, _ := json.Marshal(cfg)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, cfg.Name), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return resp.Error
+	}
+	apiErr := addStream(&StreamConfig{Name: "BAD", Subjects: []string{"bad"}, Storage: FileStorage, HeaderIndex: "Order Id"})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSStreamInvalidConfigF))
+	require_True(t, addStream(&StreamConfig{Name: "NOIDX", Subjects: []string{"noidx"}, Storage: FileStorage}) == nil)
+	require_True(t, addStream(&StreamConfig{Name: "TEST", Subjects: []string{"orders.*"}, Storage: FileStorage, HeaderIndex: "Order-Id"}) == nil)
+
+	lookup := func(stream string, req *JSApiMsgLookupRequest) *JSApiMsgLookupResponse {
+		t.Helper()
+		b, _ := json.Marshal(req)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiMsgLookupT, stream), b, time.Second)
+		require_NoError(t, err)
+		var resp JSApiMsgLookupResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+	expectSeqs := func(resp *JSApiMsgLookupResponse, seqs ...uint64) {
+		t.Helper()
+		if resp.Error != nil {
+			t.Fatalf("Unexpected error: %+v", resp.Error)
+		}
+		got := make([]uint64, 0, len(resp.Messages))
+		for _, sm := range resp.Messages {
+			got = append(got, sm.Sequence)
+		}
+		if !reflect.DeepEqual(got, seqs) {
+			t.Fatalf("Expected sequences %v, got %v", seqs, got)
+		}
+	}
+
+	// Orders 0 to 4, each with a created and shipped event, and some messages without the header.
+	for i := 0; i < 10; i++ {
+		m := nats.NewMsg(fmt.Sprintf("orders.%d", i%2))
+		m.Header.Set("Order-Id", fmt.Sprintf("order-%d", i%5))
+		m.Data = []byte(fmt.Sprintf("event-%d", i))
+		_, err := js.PublishMsg(m)
+		require_NoError(t, err)
+		_, err = js.Publish("orders.x", []byte("no order"))
+		require_NoError(t, err)
+	}
+
+	resp := lookup("TEST", &JSApiMsgLookupRequest{Value: "order-2"})
+	expectSeqs(resp, 5, 15)
+	require_True(t, string(resp.Messages[0].Data) == "event-2")
+	require_True(t, string(resp.Messages[1].Data) == "event-7")
+	require_True(t, resp.Messages[0].Subject == "orders.0" && !resp.More)
+
+	// Paging with limit and start sequence.
+	resp = lookup("TEST", &JSApiMsgLookupRequest{Value: "order-2", Limit: 1})
+	expectSeqs(resp, 5)
+	require_True(t, resp.More)
+	expectSeqs(lookup("TEST", &JSApiMsgLookupRequest{Value: "order-2", Seq: 6}), 15)
+
+	// Removed messages are not returned.
+	require_NoError(t, js.DeleteMsg("TEST", 5))
+	expectSeqs(lookup("TEST", &JSApiMsgLookupRequest{Value: "order-2"}), 15)
+
+	// Errors.
+	resp = lookup("TEST", &JSApiMsgLookupRequest{Value: "order-99"})
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSNoMessageFoundErr))
+	resp = lookup("TEST", &JSApiMsgLookupRequest{})
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSBadRequestErr))
+	resp = lookup("NOIDX", &JSApiMsgLookupRequest{Value: "order-2"})
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSStreamNoHeaderIndexErr))
+
+	// The index is rebuilt when the server restarts.
+	u, _ := url.Parse(s.ClientURL())
+	port, _ := strconv.Atoi(u.Port())
+	sd := s.JetStreamConfig().StoreDir
+	nc.Close()
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(port, sd)
+	defer s.Shutdown()
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+	expectSeqs(lookup("TEST", &JSApiMsgLookupRequest{Value: "order-2"}), 15)
+	expectSeqs(lookup("TEST", &JSApiMsgLookupRequest{Value: "order-4"}), 9, 19)
+
+	// Purging drops the messages from the index.
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	indexed := func() int {
+		mset.hidx.mu.RLock()
+		defer mset.hidx.mu.RUnlock()
+		return len(mset.hidx.vals)
+	}
+	require_True(t, indexed() == 9)
+	require_NoError(t, js.PurgeStream("TEST", &nats.StreamPurgeRequest{Subject: "orders.1"}))
+	require_True(t, indexed() == 4)
+	expectSeqs(lookup("TEST", &JSApiMsgLookupRequest{Value: "order-4"}), 9)
+	require_NoError(t, js.PurgeStream("TEST"))
+	require_True(t, indexed() == 0)
+	resp = lookup("TEST", &JSApiMsgLookupRequest{Value: "order-4"})
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSNoMessageFoundErr))
+
+	// Only the most recent messages are kept in the index.
+	mset.hidx.mu.Lock()
+	mset.hidx.max = 2
+	mset.hidx.mu.Unlock()
+	for i := 0; i < 3; i++ {
+		m := nats.NewMsg("orders.0")
+		m.Header.Set("Order-Id", "order-1")
+		_, err := js.PublishMsg(m)
+		require_NoError(t, err)
+	}
+	require_True(t, indexed() == 2)
+	expectSeqs(lookup("TEST", &JSApiMsgLookupRequest{Value: "order-1"}), 22, 23)
+
+	// Changing the key rebuilds the index.
+	cfg := mset.config()
+	cfg.HeaderIndex = "Nats-Msg-Id"
+	require_NoError(t, mset.update(&cfg))
+	require_True(t, indexed() == 0)
+	cfg.HeaderIndex = "Order-Id"
+	require_NoError(t, mset.update(&cfg))
+	require_True(t, indexed() == 2)
+	expectSeqs(lookup("TEST", &JSApiMsgLookupRequest{Value: "order-1"}), 22, 23)
+}
+
+func TestJetStreamBillingWebhook(t *testing.T) {
+	const secret = "s3cr3t"
+	var fail atomic.Bool
+	reports := make(chan *JSBillingReport, 100)
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(r.Header.Get(JSBillingTimestamp) + "."))
+		mac.Write(body)
+		if r.Header.Get(JSBillingSignature) != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var report JSBillingReport
+		if err := json.Unmarshal(body, &report); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reports <- &report
+	}))
+	defer ts.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require_NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600))
+
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		server_name: S
+		jetstream: {
+			store_dir: %q
+			billing_webhook: {url: %q, secret: %q, interval: "100ms", ca_file: %q}
+		}
+		accounts: {
+			A: { jetstream: enabled, users: [ {user: a, password: pwd} ] }
+			B: { jetstream: enabled, users: [ {user: b, password: pwd} ] }
+		}
+	`, t.TempDir(), ts.URL, secret, caFile)))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("a", "pwd"))
+	defer nc.Close()
+
+	// Reports are signed and made while the endpoint fails are included in the next one.
+	fail.Store(true)
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("hello"))
+		require_NoError(t, err)
+	}
+	sub, err := js.PullSubscribe("foo", "dlc")
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(10)
+	require_NoError(t, err)
+	require_True(t, len(msgs) == 10)
+	time.Sleep(250 * time.Millisecond)
+	fail.Store(false)
+
+	var delivered, api uint64
+	var start time.Time
+	checkFor(t, 5*time.Second, 50*time.Millisecond, func() error {
+		select {
+		case report := <-reports:
+			require_True(t, report.Server == "S" && report.ServerID == s.ID())
+			require_True(t, len(report.Accounts) == 2)
+			require_True(t, report.Accounts[0].Account == "A" && report.Accounts[1].Account == "B")
+			if start.IsZero() {
+				start = report.Start
+			} else {
+				require_True(t, !report.Start.Before(start))
+			}
+			a := report.Accounts[0]
+			delivered += a.Delivered
+			api += a.API
+			if a.Store > 0 && delivered == 10 && api > 0 {
+				return nil
+			}
+			return fmt.Errorf("usage not reported yet")
+		default:
+			return fmt.Errorf("no report yet")
+		}
+	})
+	// All usage was reported in the first accepted report, so it was not lost.
+	select {
+	case report := <-reports:
+		require_True(t, report.Accounts[0].Delivered == 0)
+	case <-time.After(time.Second):
+		t.Fatalf("Expected another report")
+	}
+
+	// Options are checked.
+	for _, bo := range []*JSBillingOpts{
+		{URL: "http://example.com", Secret: secret},
+		{URL: "https://example.com"},
+		{URL: "https://example.com", Secret: secret, Interval: -time.Second},
+		{URL: "https://example.com", Secret: secret, CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+	} {
+		opts := DefaultTestOptions
+		opts.JetStreamBilling = bo
+		require_True(t, validateJetStreamBilling(&opts) != nil)
+	}
+}
+
+func TestJetStreamConsumerTemplates(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	addStream := func(cfg *StreamConfig) *ApiError {
+		t.Helper()
+		req, _ := json.Marshal(cfg)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamCreateT, cfg.Name), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return resp.Error
+	}
+	apiErr := addStream(&StreamConfig{
+		Name:              "BAD",
+		Subjects:          []string{"bad.>"},
+		Storage:           MemoryStorage,
+		ConsumerTemplates: map[string]ConsumerConfig{"worker": {Durable: "{{team"}},
+	})
+	require_True(t, apiErr != nil && apiErr.ErrCode == uint16(JSStreamInvalidConfigF))
+	apiErr = addStream(&StreamConfig{
+		Name:     "ORDERS",
+		Subjects: []string{"orders.>"},
+		Storage:  MemoryStorage,
+		ConsumerTemplates: map[string]ConsumerConfig{
+			"worker": {
+				Durable:       "{{team}}-worker",
+				Description:   "Orders of {{region}} for {{team}}",
+				FilterSubject: "orders.{{region}}",
+				AckPolicy:     AckExplicit,
+				MaxAckPending: 10,
+			},
+		},
+	})
+	require_True(t, apiErr == nil)
+
+	create := func(template string, params map[string]string) *JSApiConsumerCreateResponse {
+		t.Helper()
+		req, _ := json.Marshal(&JSApiConsumerTemplateCreateRequest{Params: params})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiConsumerTemplateCreateT, "ORDERS", template), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+
+	resp := create("worker", map[string]string{"team": "billing", "region": "eu"})
+	require_True(t, resp.Error == nil)
+	require_True(t, resp.Config.Durable == "billing-worker")
+	require_True(t, resp.Config.FilterSubject == "orders.eu")
+	require_True(t, resp.Config.Description == "Orders of eu for billing")
+	require_True(t, resp.Config.AckPolicy == AckExplicit && resp.Config.MaxAckPending == 10)
+
+	_, err := js.Publish("orders.eu", []byte("ORDER"))
+	require_NoError(t, err)
+	_, err = js.Publish("orders.us", []byte("ORDER"))
+	require_NoError(t, err)
+	ci, err := js.ConsumerInfo("ORDERS", "billing-worker")
+	require_NoError(t, err)
+	require_True(t, ci.NumPending == 1)
+
+	// Creating again does not touch the existing consumer.
+	resp = create("worker", map[string]string{"team": "billing", "region": "eu"})
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSConsumerNameExistErr))
+
+	for _, params := range []map[string]string{
+		{"team": "billing"},
+		{"team": "billing", "region": "eu", "other": "x"},
+		{"team": "billing", "region": "*"},
+		{"team": "billing", "region": "eu.>"},
+		{"team": "", "region": "eu"},
+	} {
+		resp = create("worker", params)
+		require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSConsumerTemplateInvalidErrF))
+	}
+	resp = create("missing", map[string]string{"team": "billing"})
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSConsumerTemplateNotFoundErr))
+}
+
+func TestJetStreamConsumerOrphans(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: %q
+			orphans: {threshold: "250ms", auto_delete: true, grace: "750ms"}
+		}
+	`, t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	asub, err := nc.SubscribeSync(JSAdvisoryConsumerOrphanedPre + ".>")
+	require_NoError(t, err)
+
+	for _, name := range []string{"ORPHAN", "ACTIVE"} {
+		_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: name, AckPolicy: nats.AckExplicitPolicy})
+		require_NoError(t, err)
+	}
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "PUSH", DeliverSubject: "d", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+
+	// A pull request that is waiting keeps a consumer active.
+	inbox := nats.NewInbox()
+	rsub, err := nc.SubscribeSync(inbox)
+	require_NoError(t, err)
+	defer rsub.Unsubscribe()
+	req, _ := json.Marshal(&JSApiConsumerGetNextRequest{Batch: 1, Expires: 10 * time.Second})
+	require_NoError(t, nc.PublishRequest(fmt.Sprintf(JSApiRequestNextT, "TEST", "ACTIVE"), inbox, req))
+
+	msg, err := asub.NextMsg(2 * time.Second)
+	require_NoError(t, err)
+	var adv JSConsumerOrphanedAdvisory
+	require_NoError(t, json.Unmarshal(msg.Data, &adv))
+	require_Equal(t, adv.Type, JSConsumerOrphanedAdvisoryType)
+	require_Equal(t, adv.Consumer, "ORPHAN")
+	require_True(t, adv.Orphan != nil && adv.Orphan.DeleteAt != nil)
+
+	require_True(t, adv.Orphan.DeleteAt.Equal(adv.Orphan.Since.Add(750*time.Millisecond)))
+
+	// Report orphans through the consumer list.
+	resp, err := nc.Request(fmt.Sprintf(JSApiConsumerListT, "TEST"), []byte(`{"orphaned":true}`), time.Second)
+	require_NoError(t, err)
+	var lresp JSApiConsumerListResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &lresp))
+	require_True(t, lresp.Error == nil)
+	require_True(t, lresp.Total == 1 && len(lresp.Consumers) == 1)
+	require_Equal(t, lresp.Consumers[0].Name, "ORPHAN")
+	require_True(t, lresp.Consumers[0].Orphaned != nil)
+
+	// Orphans are deleted after the grace period.
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		if _, err := js.ConsumerInfo("TEST", "ORPHAN"); err != nats.ErrConsumerNotFound {
+			return fmt.Errorf("orphan not deleted yet: %v", err)
+		}
+		return nil
+	})
+	for _, name := range []string{"ACTIVE", "PUSH"} {
+		_, err = js.ConsumerInfo("TEST", name)
+		require_NoError(t, err)
+	}
+	_, err = asub.NextMsg(100 * time.Millisecond)
+	require_Error(t, err, nats.ErrTimeout)
+}
+
+func TestJetStreamStreamAggregate(t *testing.T) {
+	tmpl := `
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q, aggregate_account: AGG}
+		accounts: {
+			AGG: {
+				jetstream: enabled
+				users: [ {user: agg, password: pwd} ]
+			}
+			A: {
+				jetstream: enabled
+				users: [ {user: a, password: pwd} ]
+				aggregate: {subjects: ["orders.>"], advisories: true}
+			}
+			B: {
+				users: [ {user: b, password: pwd} ]
+				aggregate: {subjects: "events.*"}
+			}
+			C: { users: [ {user: c, password: pwd} ] }
+			SYS: { users: [ {user: sys, password: pwd} ] }
+			%s
+		}
+		system_account: SYS
+	`
+	storeDir := t.TempDir()
+	conf := createConfFile(t, []byte(fmt.Sprintf(tmpl, storeDir, _EMPTY_)))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	// JetStream can still not be enabled on the system account.
+	snc := natsConnect(t, s.ClientURL(), nats.UserInfo("sys", "pwd"))
+	defer snc.Close()
+	sacc, err := s.LookupAccount("SYS")
+	require_NoError(t, err)
+	require_False(t, sacc.JetStreamEnabled())
+	require_Error(t, sacc.EnableJetStream(nil))
+
+	gnc, gjs := jsClientConnect(t, s, nats.UserInfo("agg", "pwd"))
+	defer gnc.Close()
+
+	acfg := &StreamConfig{Name: "AUDIT", Subjects: []string{"audit"}, Storage: FileStorage, Aggregate: &StreamAggregate{}}
+	req, err := json.Marshal(acfg)
+	require_NoError(t, err)
+	resp, err := gnc.Request(fmt.Sprintf(JSApiStreamCreateT, "AUDIT"), req, time.Second)
+	require_NoError(t, err)
+	var scResp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &scResp))
+	require_True(t, scResp.Error == nil)
+
+	acc, err := s.LookupAccount("AGG")
+	require_NoError(t, err)
+	mset, err := acc.lookupStream("AUDIT")
+	require_NoError(t, err)
+
+	// Consumers can filter on the captured subjects.
+	_, err = gjs.AddConsumer("AUDIT", &nats.ConsumerConfig{Durable: "ORDERS", FilterSubject: "A.orders.>"})
+	require_NoError(t, err)
+
+	aacc, err := s.LookupAccount("A")
+	require_NoError(t, err)
+	_, err = aacc.addStream(&StreamConfig{Name: "AGG", Storage: FileStorage, Aggregate: &StreamAggregate{}})
+	require_Error(t, err)
+
+	nca, jsa := jsClientConnect(t, s, nats.UserInfo("a", "pwd"))
+	defer nca.Close()
+	ncb := natsConnect(t, s.ClientURL(), nats.UserInfo("b", "pwd"))
+	defer ncb.Close()
+	ncc := natsConnect(t, s.ClientURL(), nats.UserInfo("c", "pwd"))
+	defer ncc.Close()
+
+	natsPub(t, nca, "orders.1", []byte("order"))
+	natsPub(t, nca, "other", []byte("other"))
+	natsPub(t, ncb, "events.1", []byte("event"))
+	natsPub(t, ncb, "events.1.2", []byte("event"))
+	natsPub(t, ncc, "orders.1", []byte("order"))
+	_, err = jsa.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+	require_NoError(t, err)
+
+	expected := []string{"A.orders.1", "B.events.1", "A." + JSAdvisoryStreamCreatedPre + ".ORDERS", "A." + JSAuditAdvisory}
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		if state := mset.state(); state.Msgs != uint64(len(expected)) {
+			return fmt.Errorf("expected %d messages, got %d", len(expected), state.Msgs)
+		}
+		return nil
+	})
+	seen := make(map[string]bool)
+	for seq := uint64(1); seq <= uint64(len(expected)); seq++ {
+		sm, err := mset.getMsg(seq)
+		require_NoError(t, err)
+		seen[sm.Subject] = true
+	}
+	for _, subj := range expected {
+		require_True(t, seen[subj])
+	}
+
+	// Accounts registered later are captured as well.
+	require_NoError(t, os.WriteFile(conf, []byte(fmt.Sprintf(tmpl, storeDir, `
+			D: {
+				users: [ {user: d, password: pwd} ]
+				aggregate: {subjects: "late"}
+			}`)), 0666))
+	require_NoError(t, s.Reload())
+	ncd := natsConnect(t, s.ClientURL(), nats.UserInfo("d", "pwd"))
+	defer ncd.Close()
+	natsPub(t, ncd, "late", []byte("late"))
+	expected = append(expected, "D.late")
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		if state := mset.state(); state.Msgs != uint64(len(expected)) {
+			return fmt.Errorf("expected %d messages, got %d", len(expected), state.Msgs)
+		}
+		return nil
+	})
+	sm, err := mset.getMsg(uint64(len(expected)))
+	require_NoError(t, err)
+	require_Equal(t, sm.Subject, "D.late")
+
+	// Only capture from selected accounts and subjects, never from the system account.
+	acfg.Aggregate = &StreamAggregate{Accounts: []string{"SYS"}}
+	req, err = json.Marshal(acfg)
+	require_NoError(t, err)
+	resp, err = gnc.Request(fmt.Sprintf(JSApiStreamUpdateT, "AUDIT"), req, time.Second)
+	require_NoError(t, err)
+	var suResp JSApiStreamUpdateResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &suResp))
+	require_True(t, suResp.Error != nil)
+	acfg.Aggregate = &StreamAggregate{Accounts: []string{"B"}, Subjects: []string{"events.2"}}
+	req, err = json.Marshal(acfg)
+	require_NoError(t, err)
+	resp, err = gnc.Request(fmt.Sprintf(JSApiStreamUpdateT, "AUDIT"), req, time.Second)
+	require_NoError(t, err)
+	suResp = JSApiStreamUpdateResponse{}
+	require_NoError(t, json.Unmarshal(resp.Data, &suResp))
+	require_True(t, suResp.Error == nil)
+	natsPub(t, nca, "orders.2", []byte("order"))
+	natsPub(t, ncb, "events.2", []byte("event"))
+	natsPub(t, ncb, "events.3", []byte("event"))
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		if state := mset.state(); state.Msgs != uint64(len(expected)+1) {
+			return fmt.Errorf("expected %d messages, got %d", len(expected)+1, state.Msgs)
+		}
+		return nil
+	})
+	sm, err = mset.getMsg(uint64(len(expected) + 1))
+	require_NoError(t, err)
+	require_Equal(t, sm.Subject, "B.events.2")
+
+	// Consumers can only filter on the subjects still captured.
+	_, err = gjs.AddConsumer("AUDIT", &nats.ConsumerConfig{Durable: "EVENTS", FilterSubject: "B.events.2"})
+	require_NoError(t, err)
+	_, err = gjs.AddConsumer("AUDIT", &nats.ConsumerConfig{Durable: "OTHER", FilterSubject: "A.orders.>"})
+	require_Error(t, err)
+}
+
+func TestJetStreamConsumerSample(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 200; i++ {
+		_, err = js.Publish("foo", []byte("hello"))
+		require_NoError(t, err)
+	}
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	for _, cfg := range []*ConsumerConfig{
+		{Durable: "BOTH", AckPolicy: AckExplicit, SampleEvery: 10, SamplePercent: 10},
+		{Durable: "PCT", AckPolicy: AckExplicit, SamplePercent: 150},
+	} {
+		_, err = mset.addConsumer(cfg)
+		require_Error(t, err)
+	}
+
+	fetchSeqs := func(durable string) []uint64 {
+		t.Helper()
+		sub, err := js.PullSubscribe("foo", durable, nats.Bind("TEST", durable))
+		require_NoError(t, err)
+		defer sub.Unsubscribe()
+		var seqs []uint64
+		for {
+			msgs, err := sub.Fetch(100, nats.MaxWait(250*time.Millisecond))
+			if err == nats.ErrTimeout {
+				return seqs
+			}
+			require_NoError(t, err)
+			for _, m := range msgs {
+				meta, err := m.Metadata()
+				require_NoError(t, err)
+				seqs = append(seqs, meta.Sequence.Stream)
+				m.AckSync()
+			}
+		}
+	}
+
+	// Every Nth message of the stream.
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "EVERY", AckPolicy: AckExplicit, SampleEvery: 20})
+	require_NoError(t, err)
+	ci, err := js.ConsumerInfo("TEST", "EVERY")
+	require_NoError(t, err)
+	require_True(t, ci.NumPending == 10)
+	seqs := fetchSeqs("EVERY")
+	require_True(t, len(seqs) == 10)
+	for i, seq := range seqs {
+		require_True(t, seq == uint64(i+1)*20)
+	}
+	ci, err = js.ConsumerInfo("TEST", "EVERY")
+	require_NoError(t, err)
+	require_True(t, ci.NumPending == 0)
+	require_True(t, ci.AckFloor.Stream == 200)
+
+	// New messages only count when sampled.
+	for i := 0; i < 40; i++ {
+		_, err = js.Publish("foo", []byte("hello"))
+		require_NoError(t, err)
+	}
+	checkFor(t, time.Second, 50*time.Millisecond, func() error {
+		if ci, err = js.ConsumerInfo("TEST", "EVERY"); err != nil {
+			return err
+		} else if ci.NumPending != 2 {
+			return fmt.Errorf("expected 2 pending, got %d", ci.NumPending)
+		}
+		return nil
+	})
+	require_True(t, len(fetchSeqs("EVERY")) == 2)
+
+	// A percentage, the same messages for every consumer.
+	var last []uint64
+	for _, durable := range []string{"PCT1", "PCT2"} {
+		_, err = mset.addConsumer(&ConsumerConfig{Durable: durable, AckPolicy: AckExplicit, SamplePercent: 25})
+		require_NoError(t, err)
+		seqs = fetchSeqs(durable)
+		require_True(t, len(seqs) > 25 && len(seqs) < 75)
+		if last != nil {
+			require_True(t, reflect.DeepEqual(seqs, last))
+		}
+		last = seqs
+	}
+
+	// Not on work queues, messages not sampled would stay forever.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "WQ", Subjects: []string{"wq"}, Retention: nats.WorkQueuePolicy})
+	require_NoError(t, err)
+	mset, err = s.GlobalAccount().lookupStream("WQ")
+	require_NoError(t, err)
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "WQ", AckPolicy: AckExplicit, SampleEvery: 2})
+	require_Error(t, err)
+
+	// Nor on interest streams.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "IN", Subjects: []string{"in"}, Retention: nats.InterestPolicy})
+	require_NoError(t, err)
+	mset, err = s.GlobalAccount().lookupStream("IN")
+	require_NoError(t, err)
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "IN", AckPolicy: AckExplicit, SamplePercent: 10})
+	require_Error(t, err)
+}
+
+func TestJetStreamConsumerDeliverySchedule(t *testing.T) {
+	// Weekdays after hours, and the weekend.
+	sched, err := newConsumerSchedule(&ConsumerSchedule{
+		Windows: []ScheduleWindow{
+			{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "20:00", End: "06:00"},
+			{Days: []string{"sat", "sun"}, Start: "00:00", End: "24:00"},
+		},
+		TimeZone: "UTC",
+	})
+	require_NoError(t, err)
+	at := func(s string) time.Time {
+		t.Helper()
+		tm, err := time.Parse(time.RFC3339, s)
+		require_NoError(t, err)
+		return tm
+	}
+	// 2023-05-01 is a Monday.
+	for _, test := range []struct {
+		now  string
+		open bool
+		next string
+	}{
+		{"2023-05-01T05:59:00Z", false, "2023-05-01T20:00:00Z"},
+		{"2023-05-01T12:00:00Z", false, "2023-05-01T20:00:00Z"},
+		{"2023-05-01T21:00:00Z", true, _EMPTY_},
+		{"2023-05-02T05:59:00Z", true, _EMPTY_},
+		{"2023-05-02T06:00:00Z", false, "2023-05-02T20:00:00Z"},
+		{"2023-05-06T12:00:00Z", true, _EMPTY_},
+		{"2023-05-08T03:00:00Z", false, "2023-05-08T20:00:00Z"},
+	} {
+		now := at(test.now)
+		require_True(t, sched.isOpen(now) == test.open)
+		if !test.open {
+			require_True(t, sched.nextOpen(now).Equal(at(test.next)))
+		}
+	}
+
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err = js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+
+	for _, cs := range []*ConsumerSchedule{
+		{},
+		{Windows: []ScheduleWindow{{Start: "02:00", End: "02:00"}}},
+		{Windows: []ScheduleWindow{{Start: "2:00", End: "04:00"}}},
+		{Windows: []ScheduleWindow{{Days: []string{"someday"}, Start: "02:00", End: "04:00"}}},
+		{Windows: []ScheduleWindow{{Start: "02:00", End: "04:00"}}, TimeZone: "Nowhere/Special"},
+	} {
+		_, err = mset.addConsumer(&ConsumerConfig{Durable: "BAD", AckPolicy: AckExplicit, DeliverySchedule: cs})
+		require_Error(t, err)
+	}
+
+	// A window that starts in two hours from now.
+	hm := func(d time.Duration) string { return time.Now().UTC().Add(d).Format("15:04") }
+	cfg := &ConsumerConfig{
+		Durable:          "DLC",
+		AckPolicy:        AckExplicit,
+		DeliverySchedule: &ConsumerSchedule{Windows: []ScheduleWindow{{Start: hm(2 * time.Hour), End: hm(3 * time.Hour)}}},
+	}
+	_, err = mset.addConsumer(cfg)
+	require_NoError(t, err)
+
+	_, err = js.Publish("foo", []byte("hello"))
+	require_NoError(t, err)
+
+	sub, err := js.PullSubscribe("foo", "DLC", nats.Bind("TEST", "DLC"))
+	require_NoError(t, err)
+	_, err = sub.Fetch(1, nats.MaxWait(250*time.Millisecond))
+	require_Error(t, err, nats.ErrTimeout)
+
+	ci, err := js.ConsumerInfo("TEST", "DLC")
+	require_NoError(t, err)
+	require_True(t, ci.NumPending == 1)
+
+	// Paused until the window opens.
+	resp, err := nc.Request(fmt.Sprintf(JSApiConsumerInfoT, "TEST", "DLC"), nil, time.Second)
+	require_NoError(t, err)
+	var ciResp JSApiConsumerInfoResponse
+	require_NoError(t, json.Unmarshal(resp.Data, &ciResp))
+	require_True(t, ciResp.ConsumerInfo != nil && ciResp.PausedUntil != nil)
+	require_True(t, time.Until(*ciResp.PausedUntil) > time.Hour)
+
+	// Open the window now, which resumes delivery.
+	ncfg := *cfg
+	ncfg.DeliverySchedule = &ConsumerSchedule{Windows: []ScheduleWindow{{Start: hm(-time.Hour), End: hm(time.Hour)}}}
+	o := mset.lookupConsumer("DLC")
+	require_True(t, o != nil)
+	require_NoError(t, o.updateConfig(&ncfg))
+	msgs, err := sub.Fetch(1, nats.MaxWait(time.Second))
+	require_NoError(t, err)
+	require_True(t, len(msgs) == 1)
+}
+
+func TestJetStreamConsumerMetadataHeaders(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	m := nats.NewMsg("foo")
+	m.Header.Set(JSSequence, "99")
+	m.Header.Set("X-Custom", "ok")
+	m.Data = []byte("hello")
+	_, err = js.PublishMsg(m)
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("world"))
+	require_NoError(t, err)
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "PUSH", DeliverSubject: "d", AckPolicy: AckExplicit, MetadataHeaders: true})
+	require_Error(t, err)
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "DLC", AckPolicy: AckExplicit, MetadataHeaders: true})
+	require_NoError(t, err)
+
+	sub, err := js.PullSubscribe("foo", "DLC", nats.Bind("TEST", "DLC"))
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(1)
+	require_NoError(t, err)
+	require_True(t, len(msgs) == 1)
+	msg := msgs[0]
+	require_Equal(t, string(msg.Data), "hello")
+	require_Equal(t, msg.Header.Get("X-Custom"), "ok")
+	require_True(t, len(msg.Header.Values(JSSequence)) == 1)
+	require_Equal(t, msg.Header.Get(JSStream), "TEST")
+	require_Equal(t, msg.Header.Get(JSConsumerName), "DLC")
+	require_Equal(t, msg.Header.Get(JSSequence), "1")
+	require_Equal(t, msg.Header.Get(JSConsumerSequence), "1")
+	require_Equal(t, msg.Header.Get(JSNumDelivered), "1")
+	require_Equal(t, msg.Header.Get(JSNumPending), "1")
+	meta, err := msg.Metadata()
+	require_NoError(t, err)
+	ts, err := time.Parse(time.RFC3339Nano, msg.Header.Get(JSTimeStamp))
+	require_NoError(t, err)
+	require_True(t, ts.Equal(meta.Timestamp))
+
+	// Redeliveries carry their delivery count. Wait for the nak to be processed before we pull again.
+	_, err = nc.Request(msg.Reply, []byte("-NAK"), time.Second)
+	require_NoError(t, err)
+	msgs, err = sub.Fetch(1)
+	require_NoError(t, err)
+	msg = msgs[0]
+	require_Equal(t, msg.Header.Get(JSSequence), "1")
+	require_Equal(t, msg.Header.Get(JSConsumerSequence), "2")
+	require_Equal(t, msg.Header.Get(JSNumDelivered), "2")
+	require_NoError(t, msg.AckSync())
+
+	msgs, err = sub.Fetch(1)
+	require_NoError(t, err)
+	msg = msgs[0]
+	require_Equal(t, string(msg.Data), "world")
+	require_Equal(t, msg.Header.Get(JSSequence), "2")
+	require_Equal(t, msg.Header.Get(JSNumPending), "0")
+}
+
+func TestJetStreamStreamSingleWriter(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+	nc2, _ := jsClientConnect(t, s)
+	defer nc2.Close()
+
+	acc := s.GlobalAccount()
+	_, err := acc.addStream(&StreamConfig{Name: "BAD", Subjects: []string{"bad"}, Storage: MemoryStorage, WriterLease: time.Second})
+	require_Error(t, err, NewJSStreamInvalidConfigError(errors.New("writer lease requires single writer")))
+
+	mset, err := acc.addStream(&StreamConfig{
+		Name:         "TEST",
+		Subjects:     []string{"foo"},
+		Storage:      MemoryStorage,
+		SingleWriter: true,
+		WriterLease:  250 * time.Millisecond,
+	})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "OTHER", Subjects: []string{"bar"}})
+	require_NoError(t, err)
+
+	writer := func(nc *nats.Conn, stream string, req *JSApiStreamWriterRequest) *JSApiStreamWriterResponse {
+		t.Helper()
+		b, err := json.Marshal(req)
+		require_NoError(t, err)
+		m, err := nc.Request(fmt.Sprintf(JSApiStreamWriterT, stream), b, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamWriterResponse
+		require_NoError(t, json.Unmarshal(m.Data, &resp))
+		return &resp
+	}
+	publish := func(nc *nats.Conn, fence, data string) *JSPubAckResponse {
+		t.Helper()
+		m := nats.NewMsg("foo")
+		if fence != _EMPTY_ {
+			m.Header.Set(JSWriterFence, fence)
+		}
+		m.Data = []byte(data)
+		rm, err := nc.RequestMsg(m, time.Second)
+		require_NoError(t, err)
+		var resp JSPubAckResponse
+		require_NoError(t, json.Unmarshal(rm.Data, &resp))
+		return &resp
+	}
+
+	resp := writer(nc, "OTHER", &JSApiStreamWriterRequest{})
+	require_Error(t, resp.ToError(), NewJSStreamNotSingleWriterError())
+
+	// Nothing is stored without holding the lease.
+	pa := publish(nc, _EMPTY_, "0")
+	require_Error(t, pa.ToError(), NewJSStreamWriterFencedError())
+
+	resp = writer(nc, "TEST", &JSApiStreamWriterRequest{})
+	require_True(t, resp.Error == nil && resp.Fence != _EMPTY_ && resp.Lease == 250*time.Millisecond)
+	fence := resp.Fence
+	// Acquiring again with the fencing token is fine, another client can not acquire.
+	resp = writer(nc, "TEST", &JSApiStreamWriterRequest{Fence: fence})
+	require_Equal(t, resp.Fence, fence)
+	resp = writer(nc2, "TEST", &JSApiStreamWriterRequest{})
+	require_Error(t, resp.ToError(), NewJSStreamWriterActiveError())
+
+	pa = publish(nc, fence, "1")
+	require_True(t, pa.Error == nil && pa.Sequence == 1)
+	pa = publish(nc2, "bad", "x")
+	require_Error(t, pa.ToError(), NewJSStreamWriterFencedError())
+
+	// The fencing token is not stored.
+	sm, err := mset.getMsg(1)
+	require_NoError(t, err)
+	require_True(t, len(sm.Header) == 0)
+	require_Equal(t, string(sm.Data), "1")
+
+	// The second client takes over, the first is fenced off.
+	resp = writer(nc2, "TEST", &JSApiStreamWriterRequest{Takeover: true})
+	require_True(t, resp.Error == nil && resp.Fence != fence)
+	fence2 := resp.Fence
+	pa = publish(nc, fence, "2")
+	require_Error(t, pa.ToError(), NewJSStreamWriterFencedError())
+	pa = publish(nc2, fence2, "2")
+	require_True(t, pa.Error == nil && pa.Sequence == 2)
+
+	// Once the writer is idle for longer than the lease another client can acquire it.
+	time.Sleep(300 * time.Millisecond)
+	resp = writer(nc, "TEST", &JSApiStreamWriterRequest{})
+	require_True(t, resp.Error == nil && resp.Fence != fence2)
+	fence = resp.Fence
+
+	// Only the writer can release the lease.
+	resp = writer(nc2, "TEST", &JSApiStreamWriterRequest{Fence: fence2, Release: true})
+	require_Error(t, resp.ToError(), NewJSStreamWriterFencedError())
+	resp = writer(nc, "TEST", &JSApiStreamWriterRequest{Fence: fence, Release: true})
+	require_True(t, resp.Error == nil)
+	resp = writer(nc2, "TEST", &JSApiStreamWriterRequest{})
+	require_True(t, resp.Error == nil && resp.Fence != fence)
+
+	// Turning off single writer accepts publishes from anyone.
+	cfg := mset.config()
+	cfg.SingleWriter, cfg.WriterLease = false, 0
+	require_NoError(t, mset.update(&cfg))
+	pa = publish(nc, _EMPTY_, "3")
+	require_True(t, pa.Error == nil && pa.Sequence == 3)
+}
+
+func TestJetStreamMaintenance(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: %q
+			maintenance: {
+				interval: "100ms"
+				max_io_rate: "1M"
+				time_zone: "UTC"
+				windows: [{days: ["mon", "tue", "wed", "thu", "fri", "sat", "sun"], start: "00:00", end: "24:00"}]
+			}
+		}
+	`, t.TempDir())))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	mo := opts.JetStreamMaintenance
+	require_True(t, mo != nil && mo.Interval == 100*time.Millisecond && mo.MaxIORate == 1024*1024)
+	require_True(t, len(mo.Windows) == 1 && len(mo.Windows[0].Days) == 7)
+	require_Equal(t, mo.Windows[0].End, "24:00")
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	// Small blocks so we have more than one.
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, MaxBytes: 64 * 1024})
+	require_NoError(t, err)
+	msg := bytes.Repeat([]byte("Z"), 1024)
+	for i := 0; i < 50; i++ {
+		_, err = js.Publish("foo", msg)
+		require_NoError(t, err)
+	}
+
+	mset, err := s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	fs := mset.store.(*fileStore)
+	fs.mu.RLock()
+	mb := fs.blks[0]
+	nblks := len(fs.blks)
+	fs.mu.RUnlock()
+	require_True(t, nblks > 1)
+
+	mb.mu.RLock()
+	rbytes, last := mb.rbytes, mb.last.seq
+	mb.mu.RUnlock()
+
+	// Delete most of the first block, leaving its first and last message.
+	for seq := uint64(2); seq < last; seq++ {
+		require_NoError(t, js.DeleteMsg("TEST", seq))
+	}
+
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		mb.mu.RLock()
+		defer mb.mu.RUnlock()
+		if mb.rbytes >= rbytes/2 {
+			return fmt.Errorf("block not compacted yet, %d of %d bytes", mb.rbytes, rbytes)
+		}
+		if mb.indexNeedsUpdateLocked() {
+			return fmt.Errorf("index not written yet")
+		}
+		return nil
+	})
+
+	// Messages are still there.
+	for _, seq := range []uint64{1, last, last + 1} {
+		_, err = js.GetMsg("TEST", seq)
+		require_NoError(t, err)
+	}
+	_, err = js.GetMsg("TEST", 2)
+	require_Error(t, err)
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, si.State.Msgs == 50-(last-2))
+
+	// The IO budget makes us wait.
+	b := newIOBudget(1000)
+	start := time.Now()
+	require_True(t, b.spend(1500, nil, nil))
+	require_True(t, time.Since(start) >= 400*time.Millisecond)
+
+	o := DefaultOptions()
+	o.JetStreamMaintenance = &JSMaintenanceOpts{Windows: []ScheduleWindow{{Start: "25:00", End: "04:00"}}}
+	require_Error(t, validateJetStreamMaintenance(o), errors.New(`jetstream maintenance start "25:00" is invalid`))
+	o.JetStreamMaintenance = &JSMaintenanceOpts{MaxIORate: -1}
+	require_True(t, validateJetStreamMaintenance(o) != nil)
+}
+
+func TestJetStreamStreamMaxAckPendingTotal(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, _ := jsClientConnect(t, s)
+	defer nc.Close()
+
+	acc := s.GlobalAccount()
+	_, err := acc.addStream(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}, MaxAckPendingTotal: -1})
+	require_Error(t, err, NewJSStreamInvalidConfigError(errors.New("max ack pending total can not be negative")))
+
+	mset, err := acc.addStream(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}, MaxAckPendingTotal: 10})
+	require_NoError(t, err)
+
+	advisories := natsSubSync(t, nc, JSAdvisoryStreamAckPendingPre+".TEST")
+	nc.Flush()
+
+	for i := 0; i < 20; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+
+	// The two consumers share the stream limit.
+	sub1 := natsSubSync(t, nc, nats.NewInbox())
+	o1, err := mset.addConsumer(&ConsumerConfig{Durable: "C1", DeliverSubject: sub1.Subject, AckPolicy: AckExplicit, MaxAckPending: 6})
+	require_NoError(t, err)
+	var msgs []*nats.Msg
+	for i := 0; i < 6; i++ {
+		msgs = append(msgs, natsNexMsg(t, sub1, time.Second))
+	}
+	sub2 := natsSubSync(t, nc, nats.NewInbox())
+	o2, err := mset.addConsumer(&ConsumerConfig{Durable: "C2", DeliverSubject: sub2.Subject, AckPolicy: AckExplicit})
+	require_NoError(t, err)
+	for i := 0; i < 4; i++ {
+		natsNexMsg(t, sub2, time.Second)
+	}
+	if _, err := sub2.NextMsg(250 * time.Millisecond); err != nats.ErrTimeout {
+		t.Fatalf("Expected no more messages, got %v", err)
+	}
+	require_True(t, atomic.LoadInt64(&mset.apend) == 10)
+
+	var adv JSStreamAckPendingAdvisory
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, advisories, time.Second).Data, &adv))
+	require_Equal(t, adv.Type, JSStreamAckPendingAdvisoryType)
+	require_True(t, adv.Reached)
+	require_True(t, adv.Pending == 10 && adv.Limit == 10)
+
+	// Acks allow the consumers to deliver again, up to the limit.
+	for _, m := range msgs[:3] {
+		m.AckSync()
+	}
+	adv = JSStreamAckPendingAdvisory{}
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, advisories, time.Second).Data, &adv))
+	require_False(t, adv.Reached)
+	checkFor(t, time.Second, 50*time.Millisecond, func() error {
+		n1, _, _ := sub1.Pending()
+		n2, _, _ := sub2.Pending()
+		if n1+n2 != 3 {
+			return fmt.Errorf("expected 3 more deliveries, got %d", n1+n2)
+		}
+		return nil
+	})
+	time.Sleep(100 * time.Millisecond)
+	require_True(t, atomic.LoadInt64(&mset.apend) == 10)
+
+	// Removing the consumers will release their ack pending from the stream.
+	o1.delete()
+	o2.delete()
+	require_True(t, atomic.LoadInt64(&mset.apend) == 0)
+}
+
+func TestJetStreamConsumerDeliveryMetrics(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: %q
+			consumer_metrics: {subject: "metrics.delivery", interval: "100ms"}
+		}
+	`, t.TempDir())))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	mo := opts.JetStreamMetrics
+	require_True(t, mo != nil && mo.Interval == 100*time.Millisecond)
+	require_Equal(t, mo.Subject, "metrics.delivery")
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = js.Publish("foo", []byte("OK"))
+		require_NoError(t, err)
+	}
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(4)
+	require_NoError(t, err)
+	for _, m := range msgs[:2] {
+		require_NoError(t, m.AckSync())
+	}
+
+	metrics := natsSubSync(t, nc, "metrics.delivery.TEST.C")
+	var m JSConsumerDeliveryMetric
+	require_NoError(t, json.Unmarshal(natsNexMsg(t, metrics, time.Second).Data, &m))
+	require_Equal(t, m.Type, JSConsumerDeliveryMetricType)
+	require_Equal(t, m.Stream, "TEST")
+	require_Equal(t, m.Consumer, "C")
+	require_True(t, m.Delivered.Consumer == 4 && m.Delivered.Stream == 4)
+	require_True(t, m.AckFloor.Consumer == 2 && m.AckFloor.Stream == 2)
+	require_True(t, m.NumAckPending == 2)
+	require_True(t, m.NumPending == 6)
+
+	// Published periodically.
+	natsNexMsg(t, metrics, time.Second)
+
+	// Invalid subjects are rejected.
+	o := opts.Clone()
+	o.JetStreamMetrics = &JSConsumerMetricsOpts{Subject: "metrics.*"}
+	require_Error(t, validateJetStreamConsumerMetrics(o))
+}
+
+func TestJetStreamStreamStoreDirs(t *testing.T) {
+	sd, fast := t.TempDir(), t.TempDir()
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q, store_dirs: {fast: %q}}
+	`, sd, fast)))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+	require_Equal(t, opts.JetStreamStoreDirs["fast"], fast)
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	acc := s.GlobalAccount()
+	_, err := acc.addStream(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}, StoreDir: "nope"})
+	require_Error(t, err, NewJSStreamStoreDirNotFoundError())
+	_, err = acc.addStream(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: MemoryStorage, StoreDir: "fast"})
+	require_Error(t, err, NewJSStreamInvalidConfigError(errors.New("store directory requires file storage")))
+
+	mset, err := acc.addStream(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}, StoreDir: "fast"})
+	require_NoError(t, err)
+	fastDir := filepath.Join(fast, JetStreamStoreDir, acc.Name, streamsDir, "TEST")
+	primaryDir := filepath.Join(sd, JetStreamStoreDir, acc.Name, streamsDir, "TEST")
+	require_Equal(t, mset.store.(*fileStore).fcfg.StoreDir, fastDir)
+
+	cfg := mset.config()
+	cfg.StoreDir = primaryStoreDirName
+	require_Error(t, mset.update(&cfg), NewJSStreamInvalidConfigError(errors.New("stream configuration update can not change store directory")))
+	// Updates that do not set it keep it.
+	cfg.StoreDir = _EMPTY_
+	require_NoError(t, mset.update(&cfg))
+	require_Equal(t, mset.config().StoreDir, "fast")
+
+	for i := 0; i < 100; i++ {
+		sendStreamMsg(t, nc, "foo", "OK")
+	}
+	_, err = mset.addConsumer(&ConsumerConfig{Durable: "C", AckPolicy: AckExplicit})
+	require_NoError(t, err)
+	sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(10)
+	require_NoError(t, err)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+
+	relocate := func(dir string) *JSApiStreamRelocateResponse {
+		t.Helper()
+		req, _ := json.Marshal(&JSApiStreamRelocateRequest{StoreDir: dir})
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamRelocateT, "TEST"), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamRelocateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+	resp := relocate("nope")
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSStreamStoreDirNotFoundErr))
+	resp = relocate("fast")
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSStreamRelocateErrF))
+
+	resp = relocate(primaryStoreDirName)
+	require_True(t, resp.Error == nil && resp.Relocating)
+	checkFor(t, 5*time.Second, 50*time.Millisecond, func() error {
+		mset, err := acc.lookupStream("TEST")
+		if err != nil {
+			return err
+		}
+		if sd := mset.config().StoreDir; sd != primaryStoreDirName {
+			return fmt.Errorf("expected stream to be relocated, store dir is %q", sd)
+		}
+		return nil
+	})
+	_, err = os.Stat(fastDir)
+	require_True(t, os.IsNotExist(err))
+
+	// Messages and consumers are there after the relocation.
+	mset, err = acc.lookupStream("TEST")
+	require_NoError(t, err)
+	require_Equal(t, mset.store.(*fileStore).fcfg.StoreDir, primaryDir)
+	require_True(t, mset.state().Msgs == 100)
+	o := mset.lookupConsumer("C")
+	require_True(t, o != nil)
+	require_True(t, o.info().AckFloor.Stream == 10)
+	sendStreamMsg(t, nc, "foo", "OK")
+	require_True(t, mset.state().Msgs == 101)
+
+	// Deletes and updates are refused while the stream is relocated, since it would be
+	// restarted from the files and config it had before.
+	mset.mu.Lock()
+	mset.relocating = true
+	mset.mu.Unlock()
+	cfg = mset.config()
+	cfg.MaxMsgs = 10
+	require_Error(t, mset.update(&cfg), errStreamRelocating)
+	require_Error(t, mset.delete(), errStreamRelocating)
+	mset.mu.Lock()
+	mset.relocating = false
+	mset.mu.Unlock()
+
+	// Streams in other store directories are recovered on restart.
+	_, err = acc.addStream(&StreamConfig{Name: "FAST", Subjects: []string{"bar"}, StoreDir: "fast"})
+	require_NoError(t, err)
+	sendStreamMsg(t, nc, "bar", "OK")
+	nc.Close()
+	s.Shutdown()
+	s, _ = RunServerWithConfig(conf)
+	defer s.Shutdown()
+	mset, err = s.GlobalAccount().lookupStream("FAST")
+	require_NoError(t, err)
+	require_True(t, mset.state().Msgs == 1)
+	require_Equal(t, mset.store.(*fileStore).fcfg.StoreDir, filepath.Join(fast, JetStreamStoreDir, acc.Name, streamsDir, "FAST"))
+	mset, err = s.GlobalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_True(t, mset.state().Msgs == 101)
+}
+
+func TestJetStreamMsgTimeClockSkew(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: %q
+			clock_skew: {max: "1h", action: reject}
+		}
+	`, t.TempDir())))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	co := opts.JetStreamClockSkew
+	require_True(t, co != nil && co.MaxSkew == time.Hour && co.Reject)
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	publish := func(mt time.Time) (*nats.PubAck, error) {
+		m := nats.NewMsg("foo")
+		if !mt.IsZero() {
+			m.Header.Set(JSMsgTime, mt.Format(time.RFC3339Nano))
+		}
+		return js.PublishMsg(m)
+	}
+	msgTime := func(seq uint64) time.Time {
+		t.Helper()
+		m, err := js.GetMsg("TEST", seq)
+		require_NoError(t, err)
+		return m.Time
+	}
+
+	// Stored with the time of the publisher.
+	created := time.Now().Add(-10 * time.Minute).Round(time.Millisecond)
+	pa, err := publish(created)
+	require_NoError(t, err)
+	require_True(t, msgTime(pa.Sequence).Equal(created))
+
+	// Timestamps never go back.
+	pa, err = publish(created.Add(-time.Minute))
+	require_NoError(t, err)
+	require_True(t, msgTime(pa.Sequence).Equal(created))
+
+	// Skewed and invalid timestamps are rejected.
+	_, err = publish(time.Now().Add(2 * time.Hour))
+	require_Error(t, err)
+	require_True(t, strings.Contains(err.Error(), "message timestamp is skewed"))
+	// Also when passing as a sourced message.
+	m := nats.NewMsg("foo")
+	m.Header.Set(JSStreamSource, "ORIGIN 1 > >")
+	m.Header.Set(JSMsgTime, time.Now().Add(2*time.Hour).Format(time.RFC3339Nano))
+	_, err = js.PublishMsg(m)
+	require_Error(t, err)
+	require_True(t, strings.Contains(err.Error(), "message timestamp is skewed"))
+	m = nats.NewMsg("foo")
+	m.Header.Set(JSMsgTime, "yesterday")
+	_, err = js.PublishMsg(m)
+	require_Error(t, err)
+	require_True(t, strings.Contains(err.Error(), "message timestamp is invalid"))
+
+	// Or stored with our time when adjusting.
+	s.optsMu.Lock()
+	s.opts.JetStreamClockSkew.Reject = false
+	s.optsMu.Unlock()
+	start := time.Now()
+	pa, err = publish(start.Add(-2 * time.Hour))
+	require_NoError(t, err)
+	require_True(t, pa.Sequence == 3)
+	require_False(t, msgTime(pa.Sequence).Before(start))
+
+	// Start times select messages by the time of the publisher.
+	sub, err := js.SubscribeSync("foo", nats.StartTime(created.Add(time.Minute)))
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+	m, err = sub.NextMsg(time.Second)
+	require_NoError(t, err)
+	meta, err := m.Metadata()
+	require_NoError(t, err)
+	require_True(t, meta.Sequence.Stream == 3)
+
+	// Publishers can not set timestamps unless configured.
+	s.optsMu.Lock()
+	s.opts.JetStreamClockSkew = nil
+	s.optsMu.Unlock()
+	start = time.Now()
+	pa, err = publish(start.Add(-time.Minute))
+	require_NoError(t, err)
+	require_False(t, msgTime(pa.Sequence).Before(start))
+
+	// Invalid limits are rejected.
+	o := opts.Clone()
+	o.JetStreamClockSkew = &JSClockSkewOpts{MaxSkew: -time.Second}
+	require_Error(t, validateJetStreamClockSkew(o))
+}
+
+func TestJetStreamStreamRemote(t *testing.T) {
+	ro := DefaultTestOptions
+	ro.Port = -1
+	ro.Username, ro.Password = "ext", "pwd"
+	remote := RunServer(&ro)
+	defer remote.Shutdown()
+
+	rnc, err := nats.Connect(remote.ClientURL(), nats.UserInfo("ext", "pwd"))
+	require_NoError(t, err)
+	defer rnc.Close()
+
+	// Credentials are kept in the server config, streams refer to remotes by name.
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: %q
+			stream_remotes: {
+				allow: ["nats://127.0.0.1:%d"]
+				remotes: {
+					EXT: { urls: [%q], user: ext, password: pwd, accounts: [%q] }
+					BAD: { urls: [%q], user: ext, password: bad }
+					OTHER: { urls: [%q], user: ext, password: pwd, accounts: ["A"] }
+				}
+			}
+		}
+	`, t.TempDir(), ro.Port, remote.ClientURL(), globalAccountName, remote.ClientURL(), remote.ClientURL())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	create := func(op string, rm *StreamRemote) (*StreamInfo, *ApiError) {
+		t.Helper()
+		cfg := StreamConfig{Name: "TEST", Subjects: []string{"local"}, Storage: FileStorage, Remote: rm}
+		req, _ := json.Marshal(&cfg)
+		rmsg, err := nc.Request(fmt.Sprintf(op, "TEST"), req, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return resp.StreamInfo, resp.Error
+	}
+
+	// Invalid configs.
+	for _, rm := range []*StreamRemote{
+		{Subjects: []string{"events.>"}},
+		{URLs: []string{"http://127.0.0.1:4222"}, Subjects: []string{"events.>"}},
+		{Name: "EXT"},
+		{Name: "EXT", Subjects: []string{"events.*.>.bad"}},
+		{Name: "EXT", URLs: []string{remote.ClientURL()}, Subjects: []string{"events.>"}},
+		{Name: "NOPE", Subjects: []string{"events.>"}},
+		{Name: "OTHER", Subjects: []string{"events.>"}},
+		{URLs: []string{"nats://127.0.0.1:1"}, Subjects: []string{"events.>"}},
+	} {
+		_, apiErr := create(JSApiStreamCreateT, rm)
+		require_True(t, apiErr != nil)
+	}
+
+	// Allowed urls can be used without credentials.
+	_, apiErr := create(JSApiStreamCreateT, &StreamRemote{URLs: []string{remote.ClientURL()}, Subjects: []string{"events.>"}})
+	require_True(t, apiErr == nil)
+	require_NoError(t, js.DeleteStream("TEST"))
+
+	nsubs := remote.NumSubscriptions()
+	rm := &StreamRemote{Name: "EXT", Subjects: []string{"events.>"}}
+	si, apiErr := create(JSApiStreamCreateT, rm)
+	require_True(t, apiErr == nil)
+	// The config does not hold credentials.
+	b, err := json.Marshal(si.Config)
+	require_NoError(t, err)
+	require_True(t, !bytes.Contains(b, []byte("pwd")))
+
+	checkFor(t, 2*time.Second, 15*time.Millisecond, func() error {
+		if nz := remote.NumSubscriptions(); nz != nsubs+1 {
+			return fmt.Errorf("Expected remote subscription, got %d", nz)
+		}
+		return nil
+	})
+
+	for i := 0; i < 5; i++ {
+		m := nats.NewMsg(fmt.Sprintf("events.%d", i))
+		m.Header.Set("Nats-Msg-Id", strconv.Itoa(i%3))
+		m.Header.Set("Nats-Rollup", "all")
+		m.Header.Set("Id", strconv.Itoa(i))
+		m.Data = []byte("OK")
+		require_NoError(t, rnc.PublishMsg(m))
+	}
+	require_NoError(t, rnc.Publish("other", []byte("NO")))
+	require_NoError(t, rnc.Flush())
+
+	// JetStream headers from the remote are dropped, so no dedupe or rollups.
+	checkFor(t, 2*time.Second, 15*time.Millisecond, func() error {
+		si, err := js.StreamInfo("TEST")
+		require_NoError(t, err)
+		if si.State.Msgs != 5 {
+			return fmt.Errorf("Expected 5 msgs, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+	sm, err := js.GetMsg("TEST", 2)
+	require_NoError(t, err)
+	require_Equal(t, sm.Subject, "events.1")
+	require_Equal(t, sm.Header.Get("Id"), "1")
+	require_Equal(t, sm.Header.Get("Nats-Msg-Id"), _EMPTY_)
+	require_Equal(t, sm.Header.Get("Nats-Rollup"), _EMPTY_)
+
+	// Local subjects still work.
+	_, err = js.Publish("local", []byte("OK"))
+	require_NoError(t, err)
+
+	var resp JSApiStreamInfoResponse
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+	require_NoError(t, err)
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	ri := resp.StreamInfo.Remote
+	require_True(t, ri != nil && ri.Connected && ri.Received == 5 && ri.Error == _EMPTY_)
+
+	// Removing the remote disconnects.
+	si, apiErr = create(JSApiStreamUpdateT, nil)
+	require_True(t, apiErr == nil)
+	require_True(t, si.Remote == nil)
+	checkFor(t, 2*time.Second, 15*time.Millisecond, func() error {
+		if nz := remote.NumSubscriptions(); nz != nsubs {
+			return fmt.Errorf("Expected no remote subscriptions, got %d", nz)
+		}
+		return nil
+	})
+	require_NoError(t, rnc.Publish("events.9", []byte("OK")))
+	require_NoError(t, rnc.Flush())
+	time.Sleep(50 * time.Millisecond)
+	nsi, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_True(t, nsi.State.Msgs == 6)
+
+	// Bad credentials show up in the info.
+	rm.Name = "BAD"
+	_, apiErr = create(JSApiStreamUpdateT, rm)
+	require_True(t, apiErr == nil)
+	checkFor(t, 2*time.Second, 15*time.Millisecond, func() error {
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamInfoResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		if ri := resp.StreamInfo.Remote; ri == nil || ri.Connected || ri.Error == _EMPTY_ {
+			return fmt.Errorf("Expected remote error, got %+v", ri)
+		}
+		return nil
+	})
+}
+
+func TestJetStreamStreamRemoteTLS(t *testing.T) {
+	remote, _ := RunServerWithConfig(createConfFile(t, []byte(`
+		listen: 127.0.0.1:-1
+		tls {
+			cert_file: "../test/configs/certs/server-cert.pem"
+			key_file: "../test/configs/certs/server-key.pem"
+			ca_file: "../test/configs/certs/ca.pem"
+			verify: true
+		}
+	`)))
+	defer remote.Shutdown()
+
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {
+			store_dir: %q
+			stream_remotes: {
+				remotes: {
+					EXT: {
+						urls: [%q]
+						tls {
+							cert_file: "../test/configs/certs/client-cert.pem"
+							key_file: "../test/configs/certs/client-key.pem"
+							ca_file: "../test/configs/certs/ca.pem"
+						}
+					}
+				}
+			}
+		}
+	`, t.TempDir(), strings.Replace(remote.ClientURL(), "nats://", "tls://", 1))))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"local"}})
+	require_NoError(t, err)
+	cfg := StreamConfig{Name: "TEST", Subjects: []string{"local"}, Storage: FileStorage,
+		Remote: &StreamRemote{Name: "EXT", Subjects: []string{"events.>"}}}
+	req, _ := json.Marshal(&cfg)
+	_, err = nc.Request(fmt.Sprintf(JSApiStreamUpdateT, "TEST"), req, time.Second)
+	require_NoError(t, err)
+
+	checkFor(t, 2*time.Second, 15*time.Millisecond, func() error {
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamInfoResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		if ri := resp.StreamInfo.Remote; ri == nil || !ri.Connected {
+			return fmt.Errorf("Expected remote to be connected, got %+v", ri)
+		}
+		return nil
+	})
+}
+
+func TestJetStreamOfflineStoreInspection(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo.*"}})
+	require_NoError(t, err)
+	for i := 1; i <= 20; i++ {
+		m := nats.NewMsg(fmt.Sprintf("foo.%d", i))
+		m.Header.Set("Num", strconv.Itoa(i))
+		m.Data = []byte(fmt.Sprintf("MSG-%d", i))
+		_, err = js.PublishMsg(m)
+		require_NoError(t, err)
+	}
+	require_NoError(t, js.DeleteMsg("TEST", 5))
+	sub, err := js.PullSubscribe("foo.*", "dlc")
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(3)
+	require_NoError(t, err)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+
+	sd := s.JetStreamConfig().StoreDir
+	sd = sd[:len(sd)-len(JetStreamStoreDir)]
+	nc.Close()
+	s.Shutdown()
+
+	dir := filepath.Join(sd, JetStreamStoreDir, globalAccountName, streamsDir, "TEST")
+	si, err := NewStoreInspector(dir)
+	require_NoError(t, err)
+	require_Equal(t, si.Config().Name, "TEST")
+
+	// Consumers are read with their state.
+	ics, err := si.Consumers()
+	require_NoError(t, err)
+	require_True(t, len(ics) == 1)
+	ic := ics[0]
+	require_True(t, ic.Name == "dlc" && ic.Config != nil && ic.State != nil)
+	require_True(t, ic.State.AckFloor.Stream == 3)
+
+	// Dump a range, skipping the deleted message.
+	var seqs []uint64
+	err = si.Dump(4, 7, func(im *InspectedMsg) error {
+		require_Equal(t, im.Subject, fmt.Sprintf("foo.%d", im.Sequence))
+		require_Equal(t, string(im.Data), fmt.Sprintf("MSG-%d", im.Sequence))
+		require_Equal(t, string(getHeader("Num", im.Header)), strconv.Itoa(int(im.Sequence)))
+		seqs = append(seqs, im.Sequence)
+		return nil
+	})
+	require_NoError(t, err)
+	require_True(t, reflect.DeepEqual(seqs, []uint64{4, 6, 7}))
+
+	ibs, err := si.Verify()
+	require_NoError(t, err)
+	require_True(t, len(ibs) == 1)
+	require_True(t, ibs[0].Corrupt == 0 && ibs[0].Error == _EMPTY_)
+
+	// Corrupt a message and check verify catches it, without changing the files.
+	blk := filepath.Join(dir, msgDir, fmt.Sprintf(blkScan, 1))
+	buf, err := os.ReadFile(blk)
+	require_NoError(t, err)
+	idx := bytes.Index(buf, []byte("MSG-10"))
+	require_True(t, idx > 0)
+	buf[idx] = 'X'
+	require_NoError(t, os.WriteFile(blk, buf, defaultFilePerms))
+
+	ibs, err = si.Verify()
+	require_NoError(t, err)
+	require_True(t, ibs[0].Corrupt == 1)
+	nbuf, err := os.ReadFile(blk)
+	require_NoError(t, err)
+	require_True(t, bytes.Equal(buf, nbuf))
+
+	var n int
+	require_NoError(t, si.Dump(0, 0, func(im *InspectedMsg) error { n++; return nil }))
+	require_True(t, n == 18)
+}
+
+func TestJetStreamAccountInfoCapabilities(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		max_payload: 512KB
+		jetstream: {
+			store_dir: %q
+			limits: {max_ack_pending: 1000, max_request_batch: 250, max_request_max_bytes: 4096}
+		}
+		accounts: {
+			JS: { jetstream: enabled, users: [ {user: js, password: pwd} ] }
+			NOJS: { users: [ {user: nojs, password: pwd} ] }
+		}
+	`, t.TempDir())))
+
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	accountInfo := func(user string) *JSApiAccountInfoResponse {
+		t.Helper()
+		nc := natsConnect(t, s.ClientURL(), nats.UserInfo(user, "pwd"))
+		defer nc.Close()
+		rmsg, err := nc.Request(JSApiAccountInfo, nil, time.Second)
+		require_NoError(t, err)
+		var resp JSApiAccountInfoResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		return &resp
+	}
+
+	resp := accountInfo("js")
+	require_True(t, resp.Error == nil && resp.JetStreamAccountStats != nil)
+	caps := resp.Capabilities
+	require_True(t, caps != nil)
+	require_True(t, caps.APILevel == JSApiLevel)
+	require_Equal(t, caps.Version, VERSION)
+	require_True(t, !caps.Clustered)
+	require_True(t, caps.Limits.MaxPayload == 512*1024)
+	require_True(t, caps.Limits.MaxAckPending == 1000)
+	require_True(t, caps.Limits.MaxRequestBatch == 250)
+	require_True(t, caps.Limits.MaxRequestMaxBytes == 4096)
+	require_True(t, sort.StringsAreSorted(caps.Features))
+	var found bool
+	for _, f := range caps.Features {
+		found = found || f == "stream_shadow"
+	}
+	require_True(t, found)
+
+	// Available to detect features even if the account can not use JetStream.
+	resp = accountInfo("nojs")
+	require_True(t, resp.Error != nil && resp.Error.ErrCode == uint16(JSNotEnabledForAccountErr))
+	require_True(t, resp.Capabilities != nil && resp.Capabilities.APILevel == JSApiLevel)
+}
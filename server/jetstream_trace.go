@@ -0,0 +1,161 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+)
+
+// Headers of the W3C trace context, see https://www.w3.org/TR/trace-context.
+// Messages are stored and delivered with their headers, so a trace context published with a
+// message flows through JetStream as is. Advisories and metrics about a message carry the
+// trace context of that message, so they can be tied to the trace that produced it.
+const (
+	JSTraceParent = "traceparent"
+	JSTraceState  = "tracestate"
+)
+
+// jsTraceContext is the W3C trace context of a stored message.
+type jsTraceContext struct {
+	parent string
+	state  string
+}
+
+// isValidTraceParent returns if the value is a valid W3C traceparent, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+// Later versions may append fields, which we allow as the spec requires.
+func isValidTraceParent(v []byte) bool {
+	const (
+		verLen   = 2
+		traceLen = 32
+		spanLen  = 16
+		flagLen  = 2
+		tpLen    = verLen + 1 + traceLen + 1 + spanLen + 1 + flagLen
+	)
+	if len(v) < tpLen {
+		return false
+	}
+	ver, trace, span, flags := v[:2], v[3:35], v[36:52], v[53:55]
+	if v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return false
+	}
+	if !isLowerHex(ver) || !isLowerHex(trace) || !isLowerHex(span) || !isLowerHex(flags) {
+		return false
+	}
+	// Version ff is invalid, version 00 has no additional fields.
+	switch string(ver) {
+	case "ff":
+		return false
+	case "00":
+		if len(v) != tpLen {
+			return false
+		}
+	default:
+		if len(v) > tpLen && v[tpLen] != '-' {
+			return false
+		}
+	}
+	// All zero trace and span ids are invalid.
+	return bytes.Count(trace, []byte{'0'}) != traceLen && bytes.Count(span, []byte{'0'}) != spanLen
+}
+
+func isLowerHex(b []byte) bool {
+	for _, c := range b {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// traceContextFromHdr returns the trace context of a message, nil if it has none or an invalid one.
+// Header names are case insensitive, but we only look at the lower case form of the spec and the
+// canonical form used by most clients.
+func traceContextFromHdr(hdr []byte) *jsTraceContext {
+	if len(hdr) == 0 {
+		return nil
+	}
+	tp := getHeader(JSTraceParent, hdr)
+	if tp == nil {
+		tp = getHeader(trcCtx, hdr)
+	}
+	if !isValidTraceParent(tp) {
+		return nil
+	}
+	ts := getHeader(JSTraceState, hdr)
+	if ts == nil {
+		ts = getHeader(trcCtxSt, hdr)
+	}
+	return &jsTraceContext{parent: string(tp), state: string(ts)}
+}
+
+// traceParent returns the traceparent of this trace context, empty if there is none.
+func (tc *jsTraceContext) traceParent() string {
+	if tc == nil {
+		return _EMPTY_
+	}
+	return tc.parent
+}
+
+// header returns the message header to propagate this trace context.
+func (tc *jsTraceContext) header() []byte {
+	hdr := genHeader(nil, JSTraceParent, tc.parent)
+	if tc.state != _EMPTY_ {
+		hdr = genHeader(hdr, JSTraceState, tc.state)
+	}
+	return hdr
+}
+
+// hasAdvisoryInterest returns true if there may be anyone listening on the advisory subject.
+func (o *consumer) hasAdvisoryInterest(subj string) bool {
+	if o.acc == nil {
+		return false
+	}
+	if sl := o.acc.sl; sl != nil {
+		if r := sl.Match(subj); len(r.psubs)+len(r.qsubs) > 0 {
+			return true
+		}
+	}
+	return o.srv.gateway.enabled && o.srv.hasGatewayInterest(o.acc.Name, subj)
+}
+
+// traceContext returns the trace context of the stored message for an advisory on subj,
+// nil if it has none or no one is listening for the advisory.
+// Lock should not be held, since we may need to load the message.
+func (o *consumer) traceContext(subj string, sseq uint64) *jsTraceContext {
+	if !o.hasAdvisoryInterest(subj) {
+		return nil
+	}
+	o.mu.RLock()
+	mset := o.mset
+	o.mu.RUnlock()
+	if mset == nil || mset.store == nil {
+		return nil
+	}
+	var smv StoreMsg
+	sm, err := mset.store.LoadMsg(sseq, &smv)
+	if err != nil || sm == nil {
+		return nil
+	}
+	return traceContextFromHdr(sm.hdr)
+}
+
+// sendTracedAdvisory sends an advisory about a message, with the trace context of the message if present.
+func (o *consumer) sendTracedAdvisory(subj string, msg []byte, tc *jsTraceContext) {
+	if tc == nil {
+		o.sendAdvisory(subj, msg)
+		return
+	}
+	o.advq.send(newJSPubMsg(subj, _EMPTY_, _EMPTY_, tc.header(), msg, nil, 0))
+}
@@ -16,7 +16,6 @@ package server
 import (
 	"fmt"
 	"math/rand"
-	"sort"
 	"sync"
 	"time"
 )
@@ -30,6 +29,7 @@ type memStore struct {
 	fss         map[string]*SimpleState
 	maxp        int64
 	scb         StorageUpdateHandler
+	rcb         RetentionUpdateHandler
 	ageChk      *time.Timer
 	consumers   int
 	receivedAny bool
@@ -218,7 +218,7 @@ func (ms *memStore) StoreRawMsg(subj string, hdr, msg []byte, seq uint64, ts int
 // Store stores a message.
 func (ms *memStore) StoreMsg(subj string, hdr, msg []byte) (uint64, int64, error) {
 	ms.mu.Lock()
-	seq, ts := ms.state.LastSeq+1, time.Now().UnixNano()
+	seq, ts := ms.state.LastSeq+1, nextMsgTimestamp(time.Now().UnixNano(), ms.state.LastTime)
 	err := ms.storeRawMsg(subj, hdr, msg, seq, ts)
 	cb := ms.scb
 	ms.mu.Unlock()
@@ -259,9 +259,15 @@ func (ms *memStore) RegisterStorageUpdates(cb StorageUpdateHandler) {
 	ms.mu.Unlock()
 }
 
+// RegisterRetentionUpdates registers a callback for messages removed to honor our limits.
+func (ms *memStore) RegisterRetentionUpdates(cb RetentionUpdateHandler) {
+	ms.mu.Lock()
+	ms.rcb = cb
+	ms.mu.Unlock()
+}
+
 // GetSeqFromTime looks for the first sequence number that has the message
 // with >= timestamp.
-// FIXME(dlc) - inefficient.
 func (ms *memStore) GetSeqFromTime(t time.Time) uint64 {
 	ts := t.UnixNano()
 	ms.mu.RLock()
@@ -279,10 +285,27 @@ func (ms *memStore) GetSeqFromTime(t time.Time) uint64 {
 	if ts > last {
 		return ms.state.LastSeq + 1
 	}
-	index := sort.Search(len(ms.msgs), func(i int) bool {
-		return ms.msgs[uint64(i)+ms.state.FirstSeq].ts >= ts
-	})
-	return uint64(index) + ms.state.FirstSeq
+	// Binary search since timestamps are always increasing, for the first sequence whose next
+	// message is at or after ts. The last message is, so hi always qualifies. Interior deletes are
+	// skipped by looking at the next message, but only up to hi, since past it is known to qualify.
+	lo, hi := ms.state.FirstSeq, ms.state.LastSeq
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		seq := mid
+		for seq < hi && ms.msgs[seq] == nil {
+			seq++
+		}
+		if seq == hi || ms.msgs[seq].ts >= ts {
+			hi = mid
+		} else {
+			lo = seq + 1
+		}
+	}
+	// Make sure we return a message that exists.
+	for lo < ms.state.LastSeq && ms.msgs[lo] == nil {
+		lo++
+	}
+	return lo
 }
 
 // FilteredState will return the SimpleState associated with the filtered subject and a proposed starting sequence.
@@ -508,7 +531,7 @@ func (ms *memStore) enforcePerSubjectLimit(ss *SimpleState) {
 		return
 	}
 	for nmsgs := ss.Msgs; nmsgs > uint64(ms.maxp); nmsgs = ss.Msgs {
-		if !ms.removeMsg(ss.First, false) {
+		if !ms.removeMsgViaLimits(ss.First, RetentionMaxMsgsPer) {
 			break
 		}
 	}
@@ -521,7 +544,9 @@ func (ms *memStore) enforceMsgLimit() {
 		return
 	}
 	for nmsgs := ms.state.Msgs; nmsgs > uint64(ms.cfg.MaxMsgs); nmsgs = ms.state.Msgs {
-		ms.deleteFirstMsgOrPanic()
+		if !ms.deleteFirstUnpinnedMsg(RetentionMaxMsgs) {
+			return
+		}
 	}
 }
 
@@ -532,7 +557,9 @@ func (ms *memStore) enforceBytesLimit() {
 		return
 	}
 	for bs := ms.state.Bytes; bs > uint64(ms.cfg.MaxBytes); bs = ms.state.Bytes {
-		ms.deleteFirstMsgOrPanic()
+		if !ms.deleteFirstUnpinnedMsg(RetentionMaxBytes) {
+			return
+		}
 	}
 }
 
@@ -569,8 +596,8 @@ func (ms *memStore) expireMsgs() {
 	now := time.Now().UnixNano()
 	minAge := now - int64(ms.cfg.MaxAge)
 	for {
-		if sm, ok := ms.msgs[ms.state.FirstSeq]; ok && sm.ts <= minAge {
-			ms.deleteFirstMsgOrPanic()
+		if sm := ms.firstUnpinnedMsg(); sm != nil && sm.ts <= minAge {
+			ms.removeMsgViaLimits(sm.seq, RetentionMaxAge)
 			// Recalculate in case we are expiring a bunch.
 			now = time.Now().UnixNano()
 			minAge = now - int64(ms.cfg.MaxAge)
@@ -801,14 +828,39 @@ func (ms *memStore) Truncate(seq uint64) error {
 	return nil
 }
 
-func (ms *memStore) deleteFirstMsgOrPanic() {
-	if !ms.deleteFirstMsg() {
+func (ms *memStore) deleteFirstMsgOrPanic(reason RetentionReason) {
+	if !ms.deleteFirstMsg(reason) {
 		panic("jetstream memstore has inconsistent state, can't find first seq msg")
 	}
 }
 
-func (ms *memStore) deleteFirstMsg() bool {
-	return ms.removeMsg(ms.state.FirstSeq, false)
+func (ms *memStore) deleteFirstMsg(reason RetentionReason) bool {
+	return ms.removeMsgViaLimits(ms.state.FirstSeq, reason)
+}
+
+// Returns the first message that is not pinned, if any.
+// Lock should be held.
+func (ms *memStore) firstUnpinnedMsg() *StoreMsg {
+	for seq := ms.state.FirstSeq; seq <= ms.state.LastSeq; seq++ {
+		if sm, ok := ms.msgs[seq]; ok && !ms.cfg.isPinned(seq) {
+			return sm
+		}
+	}
+	return nil
+}
+
+// Removes the first message that is not pinned due to limits.
+// Returns false if only pinned messages are left.
+// Lock should be held.
+func (ms *memStore) deleteFirstUnpinnedMsg(reason RetentionReason) bool {
+	if len(ms.cfg.Pinned) == 0 {
+		ms.deleteFirstMsgOrPanic(reason)
+		return true
+	}
+	if sm := ms.firstUnpinnedMsg(); sm != nil {
+		return ms.removeMsgViaLimits(sm.seq, reason)
+	}
+	return false
 }
 
 // LoadMsg will lookup the message by sequence number and return it if found.
@@ -998,9 +1050,21 @@ func (ms *memStore) removeSeqPerSubject(subj string, seq uint64) {
 	}
 }
 
+// Removes the message referenced by seq to honor our limits.
+// Lock should be held.
+func (ms *memStore) removeMsgViaLimits(seq uint64, reason RetentionReason) bool {
+	return ms.removeMsgWithReason(seq, false, reason)
+}
+
 // Removes the message referenced by seq.
 // Lock should he held.
 func (ms *memStore) removeMsg(seq uint64, secure bool) bool {
+	return ms.removeMsgWithReason(seq, secure, _EMPTY_)
+}
+
+// Removes the message referenced by seq, with the reason if removed via limits.
+// Lock should be held.
+func (ms *memStore) removeMsgWithReason(seq uint64, secure bool, reason RetentionReason) bool {
 	var ss uint64
 	sm, ok := ms.msgs[seq]
 	if !ok {
@@ -1029,11 +1093,17 @@ func (ms *memStore) removeMsg(seq uint64, secure bool) bool {
 	// Remove any per subject tracking.
 	ms.removeSeqPerSubject(sm.subj, seq)
 
-	if ms.scb != nil {
+	if ms.scb != nil || (reason != _EMPTY_ && ms.rcb != nil) {
+		scb, rcb := ms.scb, ms.rcb
 		// We do not want to hold any locks here.
 		ms.mu.Unlock()
-		delta := int64(ss)
-		ms.scb(-1, -delta, seq, sm.subj)
+		if scb != nil {
+			delta := int64(ss)
+			scb(-1, -delta, seq, sm.subj)
+		}
+		if reason != _EMPTY_ && rcb != nil {
+			rcb(seq, sm.subj, ss, reason)
+		}
 		ms.mu.Lock()
 	}
 
@@ -1169,6 +1239,15 @@ func (ms *memStore) Snapshot(_ time.Duration, _, _ bool) (*SnapshotResult, error
 }
 
 func (o *consumerMemStore) Update(state *ConsumerState) error {
+	return o.update(state, false)
+}
+
+// Reset will replace our state, also when it goes back, e.g. when a durable was moved.
+func (o *consumerMemStore) Reset(state *ConsumerState) error {
+	return o.update(state, true)
+}
+
+func (o *consumerMemStore) update(state *ConsumerState, reset bool) error {
 	// Sanity checks.
 	if state.AckFloor.Consumer > state.Delivered.Consumer {
 		return fmt.Errorf("bad ack floor for consumer")
@@ -1202,7 +1281,7 @@ func (o *consumerMemStore) Update(state *ConsumerState) error {
 	o.mu.Lock()
 
 	// Check to see if this is an outdated update.
-	if state.Delivered.Consumer < o.state.Delivered.Consumer {
+	if !reset && state.Delivered.Consumer < o.state.Delivered.Consumer {
 		o.mu.Unlock()
 		return fmt.Errorf("old update ignored")
 	}
@@ -1293,15 +1372,17 @@ func (o *consumerMemStore) UpdateAcks(dseq, sseq uint64) error {
 		return ErrStoreMsgNotFound
 	}
 
-	// On restarts the old leader may get a replay from the raft logs that are old.
-	if dseq <= o.state.AckFloor.Consumer {
-		return nil
-	}
-
 	// Check for AckAll here.
+	// The stream sequence decides if the floor advances, see advanceAckAllFloor.
 	if o.cfg.AckPolicy == AckAll {
+		// On restarts the old leader may get a replay from the raft logs that are old.
+		if sseq <= o.state.AckFloor.Stream {
+			return nil
+		}
 		sgap := sseq - o.state.AckFloor.Stream
-		o.state.AckFloor.Consumer = dseq
+		if dseq > o.state.AckFloor.Consumer {
+			o.state.AckFloor.Consumer = dseq
+		}
 		o.state.AckFloor.Stream = sseq
 		for seq := sseq; seq > sseq-sgap; seq-- {
 			delete(o.state.Pending, seq)
@@ -1314,6 +1395,11 @@ func (o *consumerMemStore) UpdateAcks(dseq, sseq uint64) error {
 
 	// AckExplicit
 
+	// On restarts the old leader may get a replay from the raft logs that are old.
+	if dseq <= o.state.AckFloor.Consumer {
+		return nil
+	}
+
 	// First delete from our pending state.
 	if p, ok := o.state.Pending[sseq]; ok {
 		delete(o.state.Pending, sseq)
@@ -176,6 +176,29 @@ func TestMemStoreAgeLimit(t *testing.T) {
 	checkExpired(t)
 }
 
+func TestMemStoreAgeLimitPinned(t *testing.T) {
+	maxAge := 10 * time.Millisecond
+	ms, err := newMemStore(&StreamConfig{Storage: MemoryStorage, MaxAge: maxAge, MaxPinned: 2, Pinned: []uint64{1, 5}})
+	if err != nil {
+		t.Fatalf("Unexpected error creating store: %v", err)
+	}
+	subj, msg := "foo", []byte("Hello World")
+	for i := 0; i < 10; i++ {
+		ms.StoreMsg(subj, nil, msg)
+	}
+	checkFor(t, time.Second, maxAge, func() error {
+		if state := ms.State(); state.Msgs != 2 {
+			return fmt.Errorf("Expected 2 msgs, got %d", state.Msgs)
+		}
+		return nil
+	})
+	for _, seq := range []uint64{1, 5} {
+		if _, err := ms.LoadMsg(seq, nil); err != nil {
+			t.Fatalf("Expected pinned msg %d to be present: %v", seq, err)
+		}
+	}
+}
+
 func TestMemStoreTimeStamps(t *testing.T) {
 	ms, err := newMemStore(&StreamConfig{Storage: MemoryStorage})
 	if err != nil {
@@ -721,3 +744,49 @@ func TestMemStoreNumPending(t *testing.T) {
 		}
 	}
 }
+
+func TestMemStoreGetSeqFromTimeWithInteriorDeletes(t *testing.T) {
+	ms, err := newMemStore(&StreamConfig{Storage: MemoryStorage})
+	require_NoError(t, err)
+	defer ms.Stop()
+
+	start := time.Now()
+	for i := 1; i <= 10; i++ {
+		ts := start.Add(time.Duration(i) * time.Second).UnixNano()
+		require_NoError(t, ms.StoreRawMsg("foo", nil, []byte("ok"), uint64(i), ts))
+	}
+	for seq := uint64(4); seq <= 6; seq++ {
+		_, err := ms.RemoveMsg(seq)
+		require_NoError(t, err)
+	}
+
+	require_True(t, ms.GetSeqFromTime(start) == 1)
+	require_True(t, ms.GetSeqFromTime(start.Add(2*time.Second)) == 2)
+	require_True(t, ms.GetSeqFromTime(start.Add(2500*time.Millisecond)) == 3)
+	require_True(t, ms.GetSeqFromTime(start.Add(3500*time.Millisecond)) == 7)
+	require_True(t, ms.GetSeqFromTime(start.Add(4500*time.Millisecond)) == 7)
+	require_True(t, ms.GetSeqFromTime(start.Add(8*time.Second)) == 8)
+	require_True(t, ms.GetSeqFromTime(start.Add(time.Minute)) == 11)
+
+	// Compare with a linear scan, with large and small gaps.
+	for i := 11; i <= 1000; i++ {
+		ts := start.Add(time.Duration(i) * time.Second).UnixNano()
+		require_NoError(t, ms.StoreRawMsg("foo", nil, []byte("ok"), uint64(i), ts))
+	}
+	for seq := uint64(20); seq <= 900; seq++ {
+		if seq%97 != 0 {
+			ms.RemoveMsg(seq)
+		}
+	}
+	for i := 0; i <= 1001; i++ {
+		at := start.Add(time.Duration(i)*time.Second + 500*time.Millisecond)
+		expected := uint64(1001)
+		for seq := uint64(1); seq <= 1000; seq++ {
+			if sm, err := ms.LoadMsg(seq, nil); err == nil && sm.ts >= at.UnixNano() {
+				expected = seq
+				break
+			}
+		}
+		require_True(t, ms.GetSeqFromTime(at) == expected)
+	}
+}
@@ -2650,6 +2650,7 @@ type StreamDetail struct {
 	Sources            []*StreamSourceInfo `json:"sources,omitempty"`
 	RaftGroup          string              `json:"stream_raft_group,omitempty"`
 	ConsumerRaftGroups []*RaftGroupDetail  `json:"consumer_raft_groups,omitempty"`
+	IngestRate         uint64              `json:"ingest_rate,omitempty"`
 }
 
 // RaftGroupDetail shows information details about the Raft group.
@@ -2680,12 +2681,10 @@ type JSInfo struct {
 	Now      time.Time       `json:"now"`
 	Disabled bool            `json:"disabled,omitempty"`
 	Config   JetStreamConfig `json:"config,omitempty"`
+	// Format version of the store directory.
+	StoreFormat int `json:"store_format,omitempty"`
 	JetStreamStats
-	Streams   int              `json:"streams"`
-	Consumers int              `json:"consumers"`
-	Messages  uint64           `json:"messages"`
-	Bytes     uint64           `json:"bytes"`
-	Meta      *MetaClusterInfo `json:"meta_cluster,omitempty"`
+	Meta *MetaClusterInfo `json:"meta_cluster,omitempty"`
 
 	// aggregate raft info
 	AccountDetails []*AccountDetail `json:"account_details,omitempty"`
@@ -2718,6 +2717,8 @@ func (s *Server) accountDetail(jsa *jsAccount, optStreams, optConsumers, optCfg,
 		detail.JetStreamStats.ReservedMemory = uint64(reserved.MaxMemory)
 		detail.JetStreamStats.ReservedStore = uint64(reserved.MaxStore)
 	}
+	detail.JetStreamStats.MemoryTimeToFull = jsa.memFcast.ttf
+	detail.JetStreamStats.StoreTimeToFull = jsa.storeFcast.ttf
 
 	jsa.usageMu.RUnlock()
 	var streams []*stream
@@ -2738,13 +2739,14 @@ func (s *Server) accountDetail(jsa *jsAccount, optStreams, optConsumers, optCfg,
 				cfg = &c
 			}
 			sdet := StreamDetail{
-				Name:    stream.name(),
-				Created: stream.createdTime(),
-				State:   stream.state(),
-				Cluster: ci,
-				Config:  cfg,
-				Mirror:  stream.mirrorInfo(),
-				Sources: stream.sourcesInfo(),
+				Name:       stream.name(),
+				Created:    stream.createdTime(),
+				State:      stream.state(),
+				Cluster:    ci,
+				Config:     cfg,
+				Mirror:     stream.mirrorInfo(),
+				Sources:    stream.sourcesInfo(),
+				IngestRate: stream.ingestRate(),
 			}
 			if optRaft && rgroup != nil {
 				sdet.RaftGroup = rgroup.Name
@@ -2870,25 +2872,13 @@ func (s *Server) Jsz(opts *JSzOptions) (*JSInfo, error) {
 	}
 
 	jsi.JetStreamStats = *js.usageStats()
+	jsi.StoreFormat = js.storeFormatVersion()
 
 	filterIdx := -1
 	for i, jsa := range accounts {
 		if jsa.acc().GetName() == opts.Account {
 			filterIdx = i
 		}
-		jsa.mu.RLock()
-		streams := make([]*stream, 0, len(jsa.streams))
-		for _, stream := range jsa.streams {
-			streams = append(streams, stream)
-		}
-		jsa.mu.RUnlock()
-		jsi.Streams += len(streams)
-		for _, stream := range streams {
-			streamState := stream.state()
-			jsi.Messages += streamState.Msgs
-			jsi.Bytes += streamState.Bytes
-			jsi.Consumers += streamState.Consumers
-		}
 	}
 
 	// filter logic
@@ -3079,6 +3069,10 @@ func (s *Server) healthz(opts *HealthzOptions) *HealthStatus {
 		// Whip through account folders and pull each stream name.
 		fis, _ := os.ReadDir(sdir)
 		for _, fi := range fis {
+			// Skip files and the store format.
+			if !fi.IsDir() || fi.Name() == jsStoreFormatDir {
+				continue
+			}
 			acc, err := s.LookupAccount(fi.Name())
 			if err != nil {
 				health.Status = na
@@ -16,6 +16,7 @@ package server
 import (
 	"bytes"
 	"crypto/tls"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -28,6 +29,7 @@ import (
 	"reflect"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -3941,7 +3943,7 @@ func TestMonitorAccountz(t *testing.T) {
 	body = string(readBody(t, fmt.Sprintf("http://127.0.0.1:%d%s?acc=$SYS", s.MonitorAddr().Port, AccountzPath)))
 	require_Contains(t, body, `"account_detail": {`)
 	require_Contains(t, body, `"account_name": "$SYS",`)
-	require_Contains(t, body, `"subscriptions": 40,`)
+	require_Contains(t, body, `"subscriptions": 50,`)
 	require_Contains(t, body, `"is_system": true,`)
 	require_Contains(t, body, `"system_account": "$SYS"`)
 
@@ -4503,6 +4505,62 @@ func TestMonitorReloadTLSConfig(t *testing.T) {
 	}
 }
 
+func TestMonitorHTTPTLSClientCertAuth(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		listen: "127.0.0.1:-1"
+		https: "127.0.0.1:-1"
+		http_tls {
+			cert_file: '../test/configs/certs/server-cert.pem'
+			key_file: '../test/configs/certs/server-key.pem'
+			ca_file: '../test/configs/certs/ca.pem'
+			verify: true
+		}
+	`))
+	s, opts := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	// Client connections should not require TLS.
+	if opts.TLSConfig != nil {
+		t.Fatalf("Expected no client TLS config")
+	}
+
+	url := fmt.Sprintf("https://127.0.0.1:%d/varz", s.MonitorAddr().Port)
+	get := func(tc *TLSConfigOpts) error {
+		tlsConfig, err := GenTLSConfig(tc)
+		if err != nil {
+			t.Fatalf("Error generating TLS config: %v", err)
+		}
+		tlsConfig.RootCAs = tlsConfig.ClientCAs
+		tlsConfig.ClientCAs = nil
+		if tc.CertFile == _EMPTY_ {
+			tlsConfig.Certificates = nil
+		}
+		hc := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: 2 * time.Second}
+		resp, err := hc.Get(url)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status: %v", resp.StatusCode)
+		}
+		return nil
+	}
+
+	// Without a client certificate we should fail.
+	if err := get(&TLSConfigOpts{CaFile: "../test/configs/certs/ca.pem"}); err == nil {
+		t.Fatal("Expected error without a client certificate")
+	}
+	// With one we should succeed.
+	if err := get(&TLSConfigOpts{
+		CertFile: "../test/configs/certs/client-cert.pem",
+		KeyFile:  "../test/configs/certs/client-key.pem",
+		CaFile:   "../test/configs/certs/ca.pem",
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
 func TestMonitorMQTT(t *testing.T) {
 	o := DefaultOptions()
 	o.HTTPHost = "127.0.0.1"
@@ -4600,3 +4658,446 @@ func TestMonitorWebsocket(t *testing.T) {
 		}
 	}
 }
+
+func TestMonitorVarzAndStatszJetStreamTotals(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		http: 127.0.0.1:-1
+		jetstream: {store_dir: %q}
+		accounts: {
+			JS: { jetstream: enabled, users: [ {user: js, password: pwd} ] }
+			$SYS: { users: [ {user: admin, password: pwd} ] }
+		}
+	`, t.TempDir())))
+
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("js", "pwd"))
+	defer nc.Close()
+
+	for _, name := range []string{"A", "B"} {
+		_, err := js.AddStream(&nats.StreamConfig{Name: name, Subjects: []string{strings.ToLower(name)}})
+		require_NoError(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		_, err := js.Publish("a", []byte("OK"))
+		require_NoError(t, err)
+	}
+	_, err := js.AddConsumer("A", &nats.ConsumerConfig{Durable: "dur", AckPolicy: nats.AckExplicitPolicy})
+	require_NoError(t, err)
+	// Generates an API error.
+	_, err = js.StreamInfo("C")
+	require_Error(t, err)
+
+	si, err := js.StreamInfo("A")
+	require_NoError(t, err)
+
+	check := func(stats *JetStreamStats) {
+		t.Helper()
+		require_True(t, stats != nil)
+		require_True(t, stats.Streams == 2)
+		require_True(t, stats.Consumers == 1)
+		require_True(t, stats.Messages == 3)
+		require_True(t, stats.Bytes == si.State.Bytes)
+		require_True(t, stats.API.Total > 0)
+		require_True(t, stats.API.Errors > 0)
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/", s.MonitorAddr().Port)
+	for mode := 0; mode < 2; mode++ {
+		check(pollVarz(t, s, mode, url+"varz", nil).JetStream.Stats)
+	}
+
+	ncs := natsConnect(t, s.ClientURL(), nats.UserInfo("admin", "pwd"))
+	defer ncs.Close()
+	rmsg, err := ncs.Request(fmt.Sprintf("$SYS.REQ.SERVER.%s.STATSZ", s.ID()), nil, time.Second)
+	require_NoError(t, err)
+	var ssm ServerStatsMsg
+	require_NoError(t, json.Unmarshal(rmsg.Data, &ssm))
+	require_True(t, ssm.Stats.JetStream != nil)
+	check(ssm.Stats.JetStream.Stats)
+}
+
+func TestMonitorJetStreamAPIOverHTTP(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		http: 127.0.0.1:-1
+		jetstream: {store_dir: %q, insecure_http_api: true}
+		accounts: {
+			JS: {
+				jetstream: {
+					api_tokens: [
+						"s3cr3t"
+						{token: "readonly", permissions: {allow: ["$JS.API.STREAM.INFO.*", "$JS.API.INFO"]}}
+					]
+				}
+				users: [ {user: js, password: pwd} ]
+			}
+			OTHER: { jetstream: enabled, users: [ {user: other, password: pwd} ] }
+		}
+	`, t.TempDir())))
+
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s/", s.MonitorAddr().Port, JSAPIPath)
+	request := func(token, path string, body []byte, expected int) []byte {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, url+path, bytes.NewReader(body))
+		require_NoError(t, err)
+		if token != _EMPTY_ {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require_NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require_NoError(t, err)
+		if resp.StatusCode != expected {
+			t.Fatalf("Expected status %d, got %d: %s", expected, resp.StatusCode, b)
+		}
+		return b
+	}
+
+	cfg, _ := json.Marshal(&StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}, Storage: FileStorage})
+	var scResp JSApiStreamCreateResponse
+	require_NoError(t, json.Unmarshal(request("s3cr3t", "STREAM/CREATE/ORDERS", cfg, http.StatusOK), &scResp))
+	require_True(t, scResp.Error == nil)
+	require_Equal(t, scResp.Config.Name, "ORDERS")
+
+	// The stream was created in the account of the token.
+	nc, js := jsClientConnect(t, s, nats.UserInfo("js", "pwd"))
+	defer nc.Close()
+	_, err := js.StreamInfo("ORDERS")
+	require_NoError(t, err)
+	nco, jso := jsClientConnect(t, s, nats.UserInfo("other", "pwd"))
+	defer nco.Close()
+	_, err = jso.StreamInfo("ORDERS")
+	require_Error(t, err, nats.ErrStreamNotFound)
+
+	// Restricted by the permissions of the token.
+	var siResp JSApiStreamInfoResponse
+	require_NoError(t, json.Unmarshal(request("readonly", "STREAM/INFO/ORDERS", nil, http.StatusOK), &siResp))
+	require_True(t, siResp.Error == nil)
+	require_Equal(t, siResp.Config.Name, "ORDERS")
+	request("readonly", "STREAM/DELETE/ORDERS", nil, http.StatusForbidden)
+
+	// API errors are part of the response.
+	require_NoError(t, json.Unmarshal(request("s3cr3t", "STREAM/INFO/MISSING", nil, http.StatusOK), &siResp))
+	require_True(t, siResp.Error != nil && siResp.Error.ErrCode == uint16(JSStreamNotFoundErr))
+
+	request(_EMPTY_, "INFO", nil, http.StatusUnauthorized)
+	request("wrong", "INFO", nil, http.StatusUnauthorized)
+	request("s3cr3t", "STREAM/INFO/*", nil, http.StatusNotFound)
+	request("s3cr3t", "STREAM/INFO/A.B", nil, http.StatusNotFound)
+
+	var delResp JSApiStreamDeleteResponse
+	require_NoError(t, json.Unmarshal(request("s3cr3t", "STREAM/DELETE/ORDERS", nil, http.StatusOK), &delResp))
+	require_True(t, delResp.Success)
+
+	// Tokens need to be unique.
+	o := DefaultOptions()
+	a, b := NewAccount("A"), NewAccount("B")
+	a.jsTokens = []*JSAPIToken{{Token: "t"}}
+	b.jsTokens = []*JSAPIToken{{Token: "t"}}
+	o.Accounts = []*Account{a, b}
+	require_Error(t, validateJetStreamOptions(o))
+}
+
+func TestMonitorJetStreamAPIOverHTTPRequiresTLS(t *testing.T) {
+	tmpl := `
+		listen: 127.0.0.1:-1
+		%s
+		jetstream: {store_dir: %q}
+		accounts: {
+			JS: {
+				jetstream: { api_tokens: ["s3cr3t"] }
+				users: [ {user: js, password: pwd} ]
+			}
+		}
+	`
+	request := func(hc *http.Client, url string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require_NoError(t, err)
+		req.Header.Set("Authorization", "Bearer s3cr3t")
+		resp, err := hc.Do(req)
+		require_NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require_NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+
+	// Tokens are not accepted over plain HTTP.
+	conf := createConfFile(t, []byte(fmt.Sprintf(tmpl, "http: 127.0.0.1:-1", t.TempDir())))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+	status, body := request(http.DefaultClient, fmt.Sprintf("http://127.0.0.1:%d%s/INFO", s.MonitorAddr().Port, JSAPIPath))
+	require_True(t, status == http.StatusForbidden)
+	require_Contains(t, body, "https required")
+	status, body = request(http.DefaultClient, fmt.Sprintf("http://127.0.0.1:%d%s/ORDERS", s.MonitorAddr().Port, JSExportPath))
+	require_True(t, status == http.StatusForbidden)
+	require_Contains(t, body, "https required")
+	resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d%s/ORDERS?subject=orders.1", s.MonitorAddr().Port, JSIngestPath), "text/plain", nil)
+	require_NoError(t, err)
+	resp.Body.Close()
+	require_True(t, resp.StatusCode == http.StatusForbidden)
+
+	// But are over HTTPS.
+	conf = createConfFile(t, []byte(fmt.Sprintf(tmpl, `
+		https: 127.0.0.1:-1
+		http_tls {
+			cert_file: '../test/configs/certs/server-cert.pem'
+			key_file: '../test/configs/certs/server-key.pem'
+		}`, t.TempDir())))
+	ss, _ := RunServerWithConfig(conf)
+	defer ss.Shutdown()
+	hc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}, Timeout: 2 * time.Second}
+	status, body = request(hc, fmt.Sprintf("https://127.0.0.1:%d%s/INFO", ss.MonitorAddr().Port, JSAPIPath))
+	require_True(t, status == http.StatusOK)
+	var aiResp JSApiAccountInfoResponse
+	require_NoError(t, json.Unmarshal([]byte(body), &aiResp))
+	require_True(t, aiResp.Error == nil)
+
+	nc, js := jsClientConnect(t, ss, nats.UserInfo("js", "pwd"))
+	defer nc.Close()
+	_, err = js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+	require_NoError(t, err)
+	_, err = js.Publish("orders.1", []byte("order-1"))
+	require_NoError(t, err)
+	status, body = request(hc, fmt.Sprintf("https://127.0.0.1:%d%s/ORDERS", ss.MonitorAddr().Port, JSExportPath))
+	require_True(t, status == http.StatusOK)
+	require_Contains(t, body, "orders.1")
+}
+
+func TestMonitorJetStreamExportOverHTTP(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		http: 127.0.0.1:-1
+		jetstream: {store_dir: %q, insecure_http_api: true}
+		accounts: {
+			JS: {
+				jetstream: {
+					api_tokens: [
+						"s3cr3t"
+						{token: "other", permissions: {allow: ["$JS.API.STREAM.MSG.GET.OTHER"]}}
+					]
+				}
+				users: [ {user: js, password: pwd} ]
+			}
+		}
+	`, t.TempDir())))
+
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("js", "pwd"))
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+	require_NoError(t, err)
+	for i := 1; i <= 10; i++ {
+		m := nats.NewMsg(fmt.Sprintf("orders.%d", i))
+		m.Header.Set("X-Order", strconv.Itoa(i))
+		m.Data = []byte(fmt.Sprintf("order-%d", i))
+		_, err = js.PublishMsg(m)
+		require_NoError(t, err)
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s/", s.MonitorAddr().Port, JSExportPath)
+	export := func(token, path string, expected int) []byte {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, url+path, nil)
+		require_NoError(t, err)
+		if token != _EMPTY_ {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require_NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require_NoError(t, err)
+		if resp.StatusCode != expected {
+			t.Fatalf("Expected status %d, got %d: %s", expected, resp.StatusCode, b)
+		}
+		return b
+	}
+	decodeJSON := func(b []byte) []*StoredMsg {
+		t.Helper()
+		var msgs []*StoredMsg
+		for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			var sm StoredMsg
+			require_NoError(t, json.Unmarshal(line, &sm))
+			msgs = append(msgs, &sm)
+		}
+		return msgs
+	}
+
+	msgs := decodeJSON(export("s3cr3t", "ORDERS", http.StatusOK))
+	require_Len(t, len(msgs), 10)
+	for i, sm := range msgs {
+		require_True(t, sm.Sequence == uint64(i+1))
+		require_Equal(t, sm.Subject, fmt.Sprintf("orders.%d", i+1))
+		require_Equal(t, string(sm.Data), fmt.Sprintf("order-%d", i+1))
+		require_Equal(t, string(getHeader("X-Order", sm.Header)), strconv.Itoa(i+1))
+	}
+
+	// By sequence.
+	msgs = decodeJSON(export("s3cr3t", "ORDERS?start_seq=3&stop_seq=5", http.StatusOK))
+	require_Len(t, len(msgs), 3)
+	require_True(t, msgs[0].Sequence == 3 && msgs[2].Sequence == 5)
+
+	// By time.
+	start := msgs[0].Time.Format(time.RFC3339Nano)
+	stop := msgs[2].Time.Format(time.RFC3339Nano)
+	msgs = decodeJSON(export("s3cr3t", fmt.Sprintf("ORDERS?start_time=%s&stop_time=%s", start, stop), http.StatusOK))
+	require_True(t, len(msgs) >= 3)
+	require_True(t, msgs[0].Sequence <= 3 && msgs[len(msgs)-1].Sequence >= 5)
+
+	// Binary framing.
+	b := export("s3cr3t", "ORDERS?start_seq=9&format=binary", http.StatusOK)
+	for seq := uint64(9); seq <= 10; seq++ {
+		require_True(t, len(b) >= jsExportFrameHdrLen)
+		require_True(t, binary.BigEndian.Uint64(b) == seq)
+		sl := int(binary.BigEndian.Uint16(b[16:]))
+		hl := int(binary.BigEndian.Uint32(b[18:]))
+		dl := int(binary.BigEndian.Uint32(b[22:]))
+		b = b[jsExportFrameHdrLen:]
+		require_Equal(t, string(b[:sl]), fmt.Sprintf("orders.%d", seq))
+		require_Equal(t, string(getHeader("X-Order", b[sl:sl+hl])), strconv.Itoa(int(seq)))
+		require_Equal(t, string(b[sl+hl:sl+hl+dl]), fmt.Sprintf("order-%d", seq))
+		b = b[sl+hl+dl:]
+	}
+	require_Len(t, len(b), 0)
+
+	export(_EMPTY_, "ORDERS", http.StatusUnauthorized)
+	export("other", "ORDERS", http.StatusForbidden)
+	export("s3cr3t", "MISSING", http.StatusNotFound)
+	export("s3cr3t", "ORDERS?format=xml", http.StatusBadRequest)
+	export("s3cr3t", "ORDERS?start_seq=x", http.StatusBadRequest)
+	export("s3cr3t", "ORDERS?start_seq=1&start_time="+start, http.StatusBadRequest)
+}
+
+func TestMonitorJetStreamIngestOverHTTP(t *testing.T) {
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		http: 127.0.0.1:-1
+		jetstream: {store_dir: %q, insecure_http_api: true}
+		accounts: {
+			JS: {
+				jetstream: {
+					api_tokens: [
+						"s3cr3t"
+						{token: "eu", permissions: {allow: ["orders.eu.>"]}}
+					]
+				}
+				users: [ {user: js, password: pwd} ]
+			}
+		}
+	`, t.TempDir())))
+
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s, nats.UserInfo("js", "pwd"))
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+	require_NoError(t, err)
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s/", s.MonitorAddr().Port, JSIngestPath)
+	ingest := func(token, path, contentType string, hdr map[string]string, body []byte, expected int) []byte {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, url+path, bytes.NewReader(body))
+		require_NoError(t, err)
+		if token != _EMPTY_ {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if contentType != _EMPTY_ {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require_NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require_NoError(t, err)
+		if resp.StatusCode != expected {
+			t.Fatalf("Expected status %d, got %d: %s", expected, resp.StatusCode, b)
+		}
+		return b
+	}
+
+	// Single message as the body, headers starting with Nats- are passed on, unless reserved.
+	hdr := map[string]string{"Nats-Msg-Id": "1", "X-Other": "x", JSStreamSource: "forged", JSOrigin: "forged"}
+	b := ingest("s3cr3t", "ORDERS?subject=orders.us.1", "text/plain", hdr, []byte("order-1"), http.StatusOK)
+	var pa JSPubAckResponse
+	require_NoError(t, json.Unmarshal(b, &pa))
+	require_True(t, pa.Error == nil && pa.Sequence == 1)
+	require_Equal(t, pa.Stream, "ORDERS")
+
+	m, err := js.GetMsg("ORDERS", 1)
+	require_NoError(t, err)
+	require_Equal(t, m.Subject, "orders.us.1")
+	require_Equal(t, string(m.Data), "order-1")
+	require_Equal(t, m.Header.Get("Nats-Msg-Id"), "1")
+	require_Equal(t, m.Header.Get("X-Other"), _EMPTY_)
+	require_Equal(t, m.Header.Get(JSStreamSource), _EMPTY_)
+	require_Equal(t, m.Header.Get(JSOrigin), _EMPTY_)
+
+	// Duplicates are detected as usual.
+	b = ingest("s3cr3t", "ORDERS?subject=orders.us.1", _EMPTY_, map[string]string{"Nats-Msg-Id": "1"}, []byte("order-1"), http.StatusOK)
+	require_NoError(t, json.Unmarshal(b, &pa))
+	require_True(t, pa.Duplicate && pa.Sequence == 1)
+
+	// A batch of JSON encoded messages, acked in order.
+	batch, err := json.Marshal([]*JSIngestMsg{
+		{Subject: "orders.eu.2", Data: []byte("order-2")},
+		{Subject: "orders.eu.3", Header: map[string]string{"X-Order": "3", ClientInfoHdr: "{}", "nats-stream-source": "forged"}, Data: []byte("order-3")},
+	})
+	require_NoError(t, err)
+	b = ingest("eu", "ORDERS", "application/json", nil, batch, http.StatusOK)
+	var acks []*JSPubAckResponse
+	require_NoError(t, json.Unmarshal(b, &acks))
+	require_Len(t, len(acks), 2)
+	require_True(t, acks[0].Sequence == 2 && acks[1].Sequence == 3)
+	m, err = js.GetMsg("ORDERS", 3)
+	require_NoError(t, err)
+	require_Equal(t, m.Header.Get("X-Order"), "3")
+	require_Equal(t, m.Header.Get(ClientInfoHdr), _EMPTY_)
+	require_True(t, m.Header.Values("nats-stream-source") == nil && m.Header.Get(JSStreamSource) == _EMPTY_)
+
+	// A batch stops at the first error.
+	batch, err = json.Marshal([]*JSIngestMsg{
+		{Subject: "orders.eu.4", Data: []byte("order-4")},
+		{Subject: "orders.eu.5", Header: map[string]string{JSExpectedLastSeq: "1"}, Data: []byte("order-5")},
+		{Subject: "orders.eu.6", Data: []byte("order-6")},
+	})
+	require_NoError(t, err)
+	b = ingest("s3cr3t", "ORDERS", "application/json", nil, batch, http.StatusOK)
+	acks = nil
+	require_NoError(t, json.Unmarshal(b, &acks))
+	require_Len(t, len(acks), 2)
+	require_True(t, acks[0].Error == nil && acks[0].Sequence == 4)
+	require_True(t, acks[1].Error != nil)
+
+	single, err := json.Marshal(&JSIngestMsg{Subject: "orders.us.7", Data: []byte("order-7")})
+	require_NoError(t, err)
+	b = ingest("s3cr3t", "ORDERS", "application/json", nil, single, http.StatusOK)
+	require_NoError(t, json.Unmarshal(b, &pa))
+	require_True(t, pa.Error == nil && pa.Sequence == 5)
+
+	ingest(_EMPTY_, "ORDERS?subject=orders.us.8", _EMPTY_, nil, nil, http.StatusUnauthorized)
+	ingest("eu", "ORDERS?subject=orders.us.8", _EMPTY_, nil, nil, http.StatusForbidden)
+	ingest("s3cr3t", "MISSING?subject=orders.us.8", _EMPTY_, nil, nil, http.StatusNotFound)
+	ingest("s3cr3t", "ORDERS?subject=other", _EMPTY_, nil, nil, http.StatusBadRequest)
+	ingest("s3cr3t", "ORDERS", "application/json", nil, []byte("[]"), http.StatusBadRequest)
+	ingest("s3cr3t", "ORDERS", "application/json", nil, []byte("{"), http.StatusBadRequest)
+}
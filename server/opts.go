@@ -196,94 +196,117 @@ type RemoteLeafOpts struct {
 }
 
 type JSLimitOpts struct {
-	MaxRequestBatch int
-	MaxAckPending   int
-	MaxHAAssets     int
-	Duplicates      time.Duration
+	MaxRequestBatch    int
+	MaxRequestMaxBytes int
+	MaxAckPending      int
+	MaxHAAssets        int
+	Duplicates         time.Duration
 }
 
 // Options block for nats-server.
 // NOTE: This structure is no longer used for monitoring endpoints
 // and json tags are deprecated and may be removed in the future.
 type Options struct {
-	ConfigFile            string        `json:"-"`
-	ServerName            string        `json:"server_name"`
-	Host                  string        `json:"addr"`
-	Port                  int           `json:"port"`
-	DontListen            bool          `json:"dont_listen"`
-	ClientAdvertise       string        `json:"-"`
-	Trace                 bool          `json:"-"`
-	Debug                 bool          `json:"-"`
-	TraceVerbose          bool          `json:"-"`
-	NoLog                 bool          `json:"-"`
-	NoSigs                bool          `json:"-"`
-	NoSublistCache        bool          `json:"-"`
-	NoHeaderSupport       bool          `json:"-"`
-	DisableShortFirstPing bool          `json:"-"`
-	Logtime               bool          `json:"-"`
-	MaxConn               int           `json:"max_connections"`
-	MaxSubs               int           `json:"max_subscriptions,omitempty"`
-	MaxSubTokens          uint8         `json:"-"`
-	Nkeys                 []*NkeyUser   `json:"-"`
-	Users                 []*User       `json:"-"`
-	Accounts              []*Account    `json:"-"`
-	NoAuthUser            string        `json:"-"`
-	SystemAccount         string        `json:"-"`
-	NoSystemAccount       bool          `json:"-"`
-	Username              string        `json:"-"`
-	Password              string        `json:"-"`
-	Authorization         string        `json:"-"`
-	PingInterval          time.Duration `json:"ping_interval"`
-	MaxPingsOut           int           `json:"ping_max"`
-	HTTPHost              string        `json:"http_host"`
-	HTTPPort              int           `json:"http_port"`
-	HTTPBasePath          string        `json:"http_base_path"`
-	HTTPSPort             int           `json:"https_port"`
-	AuthTimeout           float64       `json:"auth_timeout"`
-	MaxControlLine        int32         `json:"max_control_line"`
-	MaxPayload            int32         `json:"max_payload"`
-	MaxPending            int64         `json:"max_pending"`
-	Cluster               ClusterOpts   `json:"cluster,omitempty"`
-	Gateway               GatewayOpts   `json:"gateway,omitempty"`
-	LeafNode              LeafNodeOpts  `json:"leaf,omitempty"`
-	JetStream             bool          `json:"jetstream"`
-	JetStreamMaxMemory    int64         `json:"-"`
-	JetStreamMaxStore     int64         `json:"-"`
-	JetStreamDomain       string        `json:"-"`
-	JetStreamExtHint      string        `json:"-"`
-	JetStreamKey          string        `json:"-"`
-	JetStreamCipher       StoreCipher   `json:"-"`
-	JetStreamUniqueTag    string
-	JetStreamLimits       JSLimitOpts
-	JetStreamMaxCatchup   int64
-	StoreDir              string            `json:"-"`
-	JsAccDefaultDomain    map[string]string `json:"-"` // account to domain name mapping
-	Websocket             WebsocketOpts     `json:"-"`
-	MQTT                  MQTTOpts          `json:"-"`
-	ProfPort              int               `json:"-"`
-	PidFile               string            `json:"-"`
-	PortsFileDir          string            `json:"-"`
-	LogFile               string            `json:"-"`
-	LogSizeLimit          int64             `json:"-"`
-	Syslog                bool              `json:"-"`
-	RemoteSyslog          string            `json:"-"`
-	Routes                []*url.URL        `json:"-"`
-	RoutesStr             string            `json:"-"`
-	TLSTimeout            float64           `json:"tls_timeout"`
-	TLS                   bool              `json:"-"`
-	TLSVerify             bool              `json:"-"`
-	TLSMap                bool              `json:"-"`
-	TLSCert               string            `json:"-"`
-	TLSKey                string            `json:"-"`
-	TLSCaCert             string            `json:"-"`
-	TLSConfig             *tls.Config       `json:"-"`
-	TLSPinnedCerts        PinnedCertSet     `json:"-"`
-	TLSRateLimit          int64             `json:"-"`
-	AllowNonTLS           bool              `json:"-"`
-	WriteDeadline         time.Duration     `json:"-"`
-	MaxClosedClients      int               `json:"-"`
-	LameDuckDuration      time.Duration     `json:"-"`
-	LameDuckGracePeriod   time.Duration     `json:"-"`
+	ConfigFile                string        `json:"-"`
+	ServerName                string        `json:"server_name"`
+	Host                      string        `json:"addr"`
+	Port                      int           `json:"port"`
+	DontListen                bool          `json:"dont_listen"`
+	ClientAdvertise           string        `json:"-"`
+	Trace                     bool          `json:"-"`
+	Debug                     bool          `json:"-"`
+	TraceVerbose              bool          `json:"-"`
+	NoLog                     bool          `json:"-"`
+	NoSigs                    bool          `json:"-"`
+	NoSublistCache            bool          `json:"-"`
+	NoHeaderSupport           bool          `json:"-"`
+	DisableShortFirstPing     bool          `json:"-"`
+	Logtime                   bool          `json:"-"`
+	MaxConn                   int           `json:"max_connections"`
+	MaxSubs                   int           `json:"max_subscriptions,omitempty"`
+	MaxSubTokens              uint8         `json:"-"`
+	Nkeys                     []*NkeyUser   `json:"-"`
+	Users                     []*User       `json:"-"`
+	Accounts                  []*Account    `json:"-"`
+	NoAuthUser                string        `json:"-"`
+	SystemAccount             string        `json:"-"`
+	NoSystemAccount           bool          `json:"-"`
+	Username                  string        `json:"-"`
+	Password                  string        `json:"-"`
+	Authorization             string        `json:"-"`
+	PingInterval              time.Duration `json:"ping_interval"`
+	MaxPingsOut               int           `json:"ping_max"`
+	HTTPHost                  string        `json:"http_host"`
+	HTTPPort                  int           `json:"http_port"`
+	HTTPBasePath              string        `json:"http_base_path"`
+	HTTPSPort                 int           `json:"https_port"`
+	HTTPTLSConfig             *tls.Config   `json:"-"`
+	AuthTimeout               float64       `json:"auth_timeout"`
+	MaxControlLine            int32         `json:"max_control_line"`
+	MaxPayload                int32         `json:"max_payload"`
+	MaxPending                int64         `json:"max_pending"`
+	Cluster                   ClusterOpts   `json:"cluster,omitempty"`
+	Gateway                   GatewayOpts   `json:"gateway,omitempty"`
+	LeafNode                  LeafNodeOpts  `json:"leaf,omitempty"`
+	JetStream                 bool          `json:"jetstream"`
+	JetStreamMaxMemory        int64         `json:"-"`
+	JetStreamMaxStore         int64         `json:"-"`
+	JetStreamDomain           string        `json:"-"`
+	JetStreamExtHint          string        `json:"-"`
+	JetStreamKey              string        `json:"-"`
+	JetStreamCipher           StoreCipher   `json:"-"`
+	JetStreamUniqueTag        string
+	JetStreamLimits           JSLimitOpts
+	JetStreamMaxCatchup       int64
+	JetStreamFcastAlert       time.Duration
+	JetStreamAudit            bool
+	JetStreamAggregateAccount string
+	JetStreamInsecureHTTPAPI  bool
+	JetStreamDisRetention     time.Duration
+	JetStreamSyncAlways       bool
+	JetStreamSyncMaxDelay     time.Duration
+	JetStreamIOWeight         int
+	JetStreamPreallocate      bool
+	JetStreamDropPageCache    bool
+	JetStreamAccTemplate      *JSAccountTemplate
+	JetStreamStandby          *JSStandbyOpts
+	JetStreamBilling          *JSBillingOpts
+	JetStreamOrphans          *JSOrphanOpts
+	JetStreamMaintenance      *JSMaintenanceOpts
+	JetStreamMetrics          *JSConsumerMetricsOpts
+	JetStreamStatsHistory     *JSStatsHistoryOpts
+	JetStreamStoreDirs        map[string]string
+	JetStreamClockSkew        *JSClockSkewOpts
+	JetStreamWebhooks         *JSWebhookOpts
+	JetStreamRemotes          *JSStreamRemoteOpts
+	StoreDir                  string            `json:"-"`
+	JsAccDefaultDomain        map[string]string `json:"-"` // account to domain name mapping
+	Websocket                 WebsocketOpts     `json:"-"`
+	MQTT                      MQTTOpts          `json:"-"`
+	ProfPort                  int               `json:"-"`
+	PidFile                   string            `json:"-"`
+	PortsFileDir              string            `json:"-"`
+	LogFile                   string            `json:"-"`
+	LogSizeLimit              int64             `json:"-"`
+	Syslog                    bool              `json:"-"`
+	RemoteSyslog              string            `json:"-"`
+	Routes                    []*url.URL        `json:"-"`
+	RoutesStr                 string            `json:"-"`
+	TLSTimeout                float64           `json:"tls_timeout"`
+	TLS                       bool              `json:"-"`
+	TLSVerify                 bool              `json:"-"`
+	TLSMap                    bool              `json:"-"`
+	TLSCert                   string            `json:"-"`
+	TLSKey                    string            `json:"-"`
+	TLSCaCert                 string            `json:"-"`
+	TLSConfig                 *tls.Config       `json:"-"`
+	TLSPinnedCerts            PinnedCertSet     `json:"-"`
+	TLSRateLimit              int64             `json:"-"`
+	AllowNonTLS               bool              `json:"-"`
+	WriteDeadline             time.Duration     `json:"-"`
+	MaxClosedClients          int               `json:"-"`
+	LameDuckDuration          time.Duration     `json:"-"`
+	LameDuckGracePeriod       time.Duration     `json:"-"`
 
 	// MaxTracedMsgLen is the maximum printable length for traced messages.
 	MaxTracedMsgLen int `json:"-"`
@@ -888,6 +911,17 @@ func (o *Options) processConfigFileLine(k string, v interface{}, errors *[]error
 		o.HTTPSPort = int(v.(int64))
 	case "http_base_path":
 		o.HTTPBasePath = v.(string)
+	case "http_tls", "https_tls":
+		tc, err := parseTLS(tk, true)
+		if err != nil {
+			*errors = append(*errors, err)
+			return
+		}
+		if o.HTTPTLSConfig, err = GenTLSConfig(tc); err != nil {
+			err := &configErr{tk, err.Error()}
+			*errors = append(*errors, err)
+			return
+		}
 	case "cluster":
 		err := parseCluster(tk, o, errors, warnings)
 		if err != nil {
@@ -1710,7 +1744,7 @@ func parseGateway(v interface{}, o *Options, errors *[]error, warnings *[]error)
 	return nil
 }
 
-var dynamicJSAccountLimits = JetStreamAccountLimits{-1, -1, -1, -1, -1, -1, -1, false}
+var dynamicJSAccountLimits = JetStreamAccountLimits{-1, -1, -1, -1, -1, -1, -1, false, 0}
 var defaultJSAccountTiers = map[string]JetStreamAccountLimits{_EMPTY_: dynamicJSAccountLimits}
 
 // Parses jetstream account limits for an account. Simple setup with boolen is allowed, and we will
@@ -1736,7 +1770,7 @@ func parseJetStreamForAccount(v interface{}, acc *Account, errors *[]error, warn
 			return &configErr{tk, fmt.Sprintf("Expected 'enabled' or 'disabled' for string value, got '%s'", vv)}
 		}
 	case map[string]interface{}:
-		jsLimits := JetStreamAccountLimits{-1, -1, -1, -1, -1, -1, -1, false}
+		jsLimits := JetStreamAccountLimits{-1, -1, -1, -1, -1, -1, -1, false, 0}
 		for mk, mv := range vv {
 			tk, mv = unwrapValue(mv, &lt)
 			switch strings.ToLower(mk) {
@@ -1788,6 +1822,24 @@ func parseJetStreamForAccount(v interface{}, acc *Account, errors *[]error, warn
 					return &configErr{tk, fmt.Sprintf("Expected a parseable size for %q, got %v", mk, mv)}
 				}
 				jsLimits.MaxAckPending = int(vv)
+			case "max_pending_memory", "max_pending_mem":
+				vv, ok := mv.(int64)
+				if !ok {
+					return &configErr{tk, fmt.Sprintf("Expected a parseable size for %q, got %v", mk, mv)}
+				}
+				jsLimits.MaxPendingMemory = vv
+			case "key", "ek", "encryption_key":
+				vv, ok := mv.(string)
+				if !ok {
+					return &configErr{tk, fmt.Sprintf("Expected a string for %q, got %v", mk, mv)}
+				}
+				acc.jsKey = vv
+			case "api_tokens", "tokens":
+				tokens, err := parseJSAPITokens(tk, errors, warnings)
+				if err != nil {
+					return err
+				}
+				acc.jsTokens = tokens
 			default:
 				if !tk.IsUsedVariable() {
 					err := &unknownConfigFieldErr{
@@ -1808,6 +1860,109 @@ func parseJetStreamForAccount(v interface{}, acc *Account, errors *[]error, warn
 	return nil
 }
 
+// Parses the opt-in of an account to have its messages captured by aggregate streams of the system account.
+func parseAccountAggregate(v interface{}, acc *Account, errors *[]error, warnings *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define the aggregate opt-in, got %T", v)}
+	}
+	aa := &AccountAggregate{}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "subjects":
+			subjects, err := parseStringArray("aggregate subjects", tk, &lt, mv, errors, warnings)
+			if err != nil {
+				return err
+			}
+			for _, subj := range subjects {
+				if !IsValidSubject(subj) {
+					return &configErr{tk, fmt.Sprintf("Invalid aggregate subject %q", subj)}
+				}
+			}
+			aa.Subjects = subjects
+		case "advisories":
+			vv, ok := mv.(bool)
+			if !ok {
+				return &configErr{tk, fmt.Sprintf("Expected a parseable bool for %q, got %v", mk, mv)}
+			}
+			aa.Advisories = vv
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+		}
+	}
+	acc.aggregate = aa
+	return nil
+}
+
+// Parses the JetStream API tokens of an account. Each one is either a token or a map
+// with the token and optional permissions for the API subjects.
+func parseJSAPITokens(v interface{}, errors *[]error, warnings *[]error) ([]*JSAPIToken, error) {
+	var lt token
+	defer convertPanicToErrorList(&lt, errors)
+
+	tk, v := unwrapValue(v, &lt)
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, &configErr{tk, fmt.Sprintf("Expected API tokens to be an array, got %T", v)}
+	}
+	var tokens []*JSAPIToken
+	for _, e := range arr {
+		tk, e := unwrapValue(e, &lt)
+		jt := &JSAPIToken{}
+		switch ev := e.(type) {
+		case string:
+			jt.Token = ev
+		case map[string]interface{}:
+			for mk, mv := range ev {
+				tk, mv := unwrapValue(mv, &lt)
+				switch strings.ToLower(mk) {
+				case "token":
+					tv, ok := mv.(string)
+					if !ok {
+						return nil, &configErr{tk, fmt.Sprintf("Expected a string for %q, got %v", mk, mv)}
+					}
+					jt.Token = tv
+				case "permissions", "perms":
+					perms, err := parseVariablePermissions(mv, errors, warnings)
+					if err != nil {
+						return nil, err
+					}
+					jt.Permissions = perms
+				default:
+					if !tk.IsUsedVariable() {
+						err := &unknownConfigFieldErr{
+							field: mk,
+							configErr: configErr{
+								token: tk,
+							},
+						}
+						*errors = append(*errors, err)
+					}
+				}
+			}
+		default:
+			return nil, &configErr{tk, fmt.Sprintf("Expected API token to be a string or map, got %T", e)}
+		}
+		if jt.Token == _EMPTY_ {
+			return nil, &configErr{tk, "API token can not be empty"}
+		}
+		tokens = append(tokens, jt)
+	}
+	return tokens, nil
+}
+
 // takes in a storage size as either an int or a string and returns an int64 value based on the input.
 func getStorageSize(v interface{}) (int64, error) {
 	_, ok := v.(int64)
@@ -1862,6 +2017,8 @@ func parseJetStreamLimits(v interface{}, opts *Options, errors *[]error, warning
 			lim.MaxHAAssets = int(mv.(int64))
 		case "max_request_batch":
 			lim.MaxRequestBatch = int(mv.(int64))
+		case "max_request_max_bytes":
+			lim.MaxRequestMaxBytes = int(mv.(int64))
 		case "duplicate_window":
 			var err error
 			lim.Duplicates, err = time.ParseDuration(mv.(string))
@@ -1885,6 +2042,525 @@ func parseJetStreamLimits(v interface{}, opts *Options, errors *[]error, warning
 	return nil
 }
 
+// Parses the template to enable JetStream for accounts, with optional account name patterns
+// and the limits, which are defined like those of an account.
+func parseJetStreamAccountTemplate(v interface{}, opts *Options, errors *[]error, warnings *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define the JetStream account template, got %T", v)}
+	}
+	t := &JSAccountTemplate{Limits: defaultJSAccountTiers}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "accounts":
+			var patterns []string
+			switch pv := mv.(type) {
+			case string:
+				patterns = append(patterns, pv)
+			case []interface{}:
+				for _, e := range pv {
+					etk, e := unwrapValue(e, &lt)
+					p, ok := e.(string)
+					if !ok {
+						return &configErr{etk, fmt.Sprintf("Expected account patterns to be strings, got %T", e)}
+					}
+					patterns = append(patterns, p)
+				}
+			default:
+				return &configErr{tk, fmt.Sprintf("Expected account patterns to be a string or array, got %T", mv)}
+			}
+			for _, p := range patterns {
+				if _, err := path.Match(p, _EMPTY_); err != nil {
+					return &configErr{tk, fmt.Sprintf("Invalid account pattern %q: %v", p, err)}
+				}
+			}
+			t.Accounts = patterns
+		case "limits":
+			acc := NewAccount(_EMPTY_)
+			if err := parseJetStreamForAccount(tk, acc, errors, warnings); err != nil {
+				return err
+			}
+			if len(acc.jsLimits) == 0 {
+				return &configErr{tk, "JetStream account template can not disable JetStream"}
+			}
+			t.Limits = acc.jsLimits
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+		}
+	}
+	opts.JetStreamAccTemplate = t
+	return nil
+}
+
+// Parse the primary a standby ships the streams from.
+func parseJetStreamStandby(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define the JetStream standby, got %T", v)}
+	}
+	sb := &JSStandbyOpts{}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "url", "urls":
+			switch uv := mv.(type) {
+			case string:
+				sb.URLs = append(sb.URLs, uv)
+			case []interface{}:
+				for _, e := range uv {
+					etk, e := unwrapValue(e, &lt)
+					u, ok := e.(string)
+					if !ok {
+						return &configErr{etk, fmt.Sprintf("Expected standby urls to be strings, got %T", e)}
+					}
+					sb.URLs = append(sb.URLs, u)
+				}
+			default:
+				return &configErr{tk, fmt.Sprintf("Expected standby urls to be a string or array, got %T", mv)}
+			}
+		case "user", "username":
+			sb.User = mv.(string)
+		case "pass", "password":
+			sb.Password = mv.(string)
+		case "credentials", "creds":
+			sb.Credentials = mv.(string)
+		case "interval":
+			sb.Interval = parseDuration("interval", tk, mv, errors, nil)
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+		}
+	}
+	opts.JetStreamStandby = sb
+	return nil
+}
+
+// Parse the webhook we post the JetStream usage of accounts to.
+func parseJetStreamBilling(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define the JetStream billing webhook, got %T", v)}
+	}
+	bo := &JSBillingOpts{}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "url":
+			bo.URL = mv.(string)
+		case "secret":
+			bo.Secret = mv.(string)
+		case "interval":
+			bo.Interval = parseDuration("interval", tk, mv, errors, nil)
+		case "ca_file":
+			bo.CAFile = mv.(string)
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+		}
+	}
+	opts.JetStreamBilling = bo
+	return nil
+}
+
+// Parse detection of orphaned durable pull consumers.
+func parseJetStreamOrphans(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define JetStream orphans, got %T", v)}
+	}
+	oo := &JSOrphanOpts{}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "threshold":
+			oo.Threshold = parseDuration("threshold", tk, mv, errors, nil)
+		case "auto_delete":
+			oo.AutoDelete = mv.(bool)
+		case "grace":
+			oo.Grace = parseDuration("grace", tk, mv, errors, nil)
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+		}
+	}
+	opts.JetStreamOrphans = oo
+	return nil
+}
+
+// Parse the background maintenance of file based streams.
+func parseJetStreamMaintenance(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define JetStream maintenance, got %T", v)}
+	}
+	mo := &JSMaintenanceOpts{}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "interval":
+			mo.Interval = parseDuration("interval", tk, mv, errors, nil)
+		case "max_io_rate":
+			r, err := getStorageSize(mv)
+			if err != nil {
+				return &configErr{tk, fmt.Sprintf("max_io_rate %s", err)}
+			}
+			mo.MaxIORate = r
+		case "time_zone":
+			mo.TimeZone = mv.(string)
+		case "windows":
+			wl, ok := mv.([]interface{})
+			if !ok {
+				return &configErr{tk, fmt.Sprintf("Expected an array of maintenance windows, got %T", mv)}
+			}
+			for _, w := range wl {
+				wtk, w := unwrapValue(w, &lt)
+				wm, ok := w.(map[string]interface{})
+				if !ok {
+					return &configErr{wtk, fmt.Sprintf("Expected a map to define a maintenance window, got %T", w)}
+				}
+				var sw ScheduleWindow
+				for wk, wv := range wm {
+					wtk, wv = unwrapValue(wv, &lt)
+					switch strings.ToLower(wk) {
+					case "days":
+						days, ok := wv.([]interface{})
+						if !ok {
+							return &configErr{wtk, fmt.Sprintf("Expected an array of days, got %T", wv)}
+						}
+						for _, d := range days {
+							_, d = unwrapValue(d, &lt)
+							sw.Days = append(sw.Days, d.(string))
+						}
+					case "start":
+						sw.Start = wv.(string)
+					case "end":
+						sw.End = wv.(string)
+					default:
+						if !wtk.IsUsedVariable() {
+							err := &unknownConfigFieldErr{
+								field: wk,
+								configErr: configErr{
+									token: wtk,
+								},
+							}
+							*errors = append(*errors, err)
+						}
+					}
+				}
+				mo.Windows = append(mo.Windows, sw)
+			}
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+		}
+	}
+	opts.JetStreamMaintenance = mo
+	return nil
+}
+
+// Parse publishing the delivery metrics of consumers.
+func parseJetStreamConsumerMetrics(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define JetStream consumer metrics, got %T", v)}
+	}
+	mo := &JSConsumerMetricsOpts{}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "subject":
+			mo.Subject = mv.(string)
+		case "interval":
+			mo.Interval = parseDuration("interval", tk, mv, errors, nil)
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+		}
+	}
+	opts.JetStreamMetrics = mo
+	return nil
+}
+
+// Parse keeping the stats history of streams.
+func parseJetStreamStatsHistory(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define JetStream stats history, got %T", v)}
+	}
+	ho := &JSStatsHistoryOpts{}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "interval":
+			ho.Interval = parseDuration("interval", tk, mv, errors, nil)
+		case "samples":
+			ho.Samples = int(mv.(int64))
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+		}
+	}
+	opts.JetStreamStatsHistory = ho
+	return nil
+}
+
+// Parse using the timestamps publishers set on messages.
+func parseJetStreamClockSkew(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define JetStream clock skew, got %T", v)}
+	}
+	co := &JSClockSkewOpts{}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "max", "max_skew":
+			co.MaxSkew = parseDuration("max_skew", tk, mv, errors, nil)
+		case "action":
+			switch action := strings.ToLower(mv.(string)); action {
+			case "reject":
+				co.Reject = true
+			case "adjust":
+				co.Reject = false
+			default:
+				*errors = append(*errors, &configErr{tk, fmt.Sprintf("Unknown JetStream clock skew action %q, expected reject or adjust", action)})
+			}
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+		}
+	}
+	opts.JetStreamClockSkew = co
+	return nil
+}
+
+// Parse the targets consumer webhooks are allowed to post to.
+func parseJetStreamWebhooks(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define JetStream webhooks, got %T", v)}
+	}
+	wo := &JSWebhookOpts{}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "allow":
+			switch av := mv.(type) {
+			case string:
+				wo.Allow = append(wo.Allow, av)
+			case []interface{}:
+				for _, e := range av {
+					etk, e := unwrapValue(e, &lt)
+					u, ok := e.(string)
+					if !ok {
+						return &configErr{etk, fmt.Sprintf("Expected allowed webhook urls to be strings, got %T", e)}
+					}
+					wo.Allow = append(wo.Allow, u)
+				}
+			default:
+				return &configErr{tk, fmt.Sprintf("Expected allowed webhook urls to be a string or array, got %T", mv)}
+			}
+		case "allow_local":
+			wo.AllowLocal = mv.(bool)
+		case "allow_private":
+			wo.AllowPrivate = mv.(bool)
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+		}
+	}
+	opts.JetStreamWebhooks = wo
+	return nil
+}
+
+// Parse the remotes streams can ingest messages from.
+func parseJetStreamRemotes(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define JetStream stream remotes, got %T", v)}
+	}
+	ro := &JSStreamRemoteOpts{}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "allow":
+			urls, err := parseStringArray("allowed stream remote urls", tk, &lt, mv, errors, nil)
+			if err != nil {
+				return err
+			}
+			ro.Allow = append(ro.Allow, urls...)
+		case "remotes":
+			rv, ok := mv.(map[string]interface{})
+			if !ok {
+				return &configErr{tk, fmt.Sprintf("Expected a map of stream remotes, got %T", mv)}
+			}
+			ro.Remotes = make(map[string]*JSRemoteOpts, len(rv))
+			for name, r := range rv {
+				rtk, r := unwrapValue(r, &lt)
+				rm, ok := r.(map[string]interface{})
+				if !ok {
+					return &configErr{rtk, fmt.Sprintf("Expected a map to define stream remote %q, got %T", name, r)}
+				}
+				remote := &JSRemoteOpts{}
+				for rk, rv := range rm {
+					rtk, rv = unwrapValue(rv, &lt)
+					switch strings.ToLower(rk) {
+					case "url", "urls":
+						urls, err := parseStringArray("stream remote urls", rtk, &lt, rv, errors, nil)
+						if err != nil {
+							return err
+						}
+						remote.URLs = append(remote.URLs, urls...)
+					case "credentials", "creds":
+						remote.Credentials = rv.(string)
+					case "user", "username":
+						remote.User = rv.(string)
+					case "pass", "password":
+						remote.Password = rv.(string)
+					case "token":
+						remote.Token = rv.(string)
+					case "tls":
+						tc, err := parseTLS(rtk, true)
+						if err != nil {
+							*errors = append(*errors, err)
+							continue
+						}
+						if _, err := GenTLSConfig(tc); err != nil {
+							*errors = append(*errors, &configErr{rtk, err.Error()})
+							continue
+						}
+						remote.TLS = tc
+					case "accounts":
+						accs, err := parseStringArray("stream remote accounts", rtk, &lt, rv, errors, nil)
+						if err != nil {
+							return err
+						}
+						remote.Accounts = append(remote.Accounts, accs...)
+					default:
+						if !rtk.IsUsedVariable() {
+							err := &unknownConfigFieldErr{
+								field: rk,
+								configErr: configErr{
+									token: rtk,
+								},
+							}
+							*errors = append(*errors, err)
+						}
+					}
+				}
+				ro.Remotes[name] = remote
+			}
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+			}
+		}
+	}
+	opts.JetStreamRemotes = ro
+	return nil
+}
+
 // Parse enablement of jetstream for a server.
 func parseJetStream(v interface{}, opts *Options, errors *[]error, warnings *[]error) error {
 	var lt token
@@ -1915,6 +2591,20 @@ func parseJetStream(v interface{}, opts *Options, errors *[]error, warnings *[]e
 					return &configErr{tk, "Duplicate 'store_dir' configuration"}
 				}
 				opts.StoreDir = mv.(string)
+			case "store_dirs":
+				dirs, ok := mv.(map[string]interface{})
+				if !ok {
+					return &configErr{tk, fmt.Sprintf("Expected a map of named store directories, got %T", mv)}
+				}
+				opts.JetStreamStoreDirs = make(map[string]string, len(dirs))
+				for name, dir := range dirs {
+					dtk, dir := unwrapValue(dir, &lt)
+					sdir, ok := dir.(string)
+					if !ok {
+						return &configErr{dtk, fmt.Sprintf("Expected a path for store directory %q, got %T", name, dir)}
+					}
+					opts.JetStreamStoreDirs[name] = sdir
+				}
 			case "max_memory_store", "max_mem_store", "max_mem":
 				s, err := getStorageSize(mv)
 				if err != nil {
@@ -1958,6 +2648,66 @@ func parseJetStream(v interface{}, opts *Options, errors *[]error, warnings *[]e
 					return &configErr{tk, fmt.Sprintf("%s %s", strings.ToLower(mk), err)}
 				}
 				opts.JetStreamMaxCatchup = s
+			case "storage_forecast_alert":
+				opts.JetStreamFcastAlert = parseDuration(mk, tk, mv, errors, warnings)
+			case "audit":
+				opts.JetStreamAudit = mv.(bool)
+			case "aggregate_account":
+				opts.JetStreamAggregateAccount = mv.(string)
+			case "insecure_http_api":
+				opts.JetStreamInsecureHTTPAPI = mv.(bool)
+			case "disable_retention":
+				opts.JetStreamDisRetention = parseDuration(mk, tk, mv, errors, warnings)
+			case "sync_always":
+				opts.JetStreamSyncAlways = mv.(bool)
+			case "sync_max_delay":
+				opts.JetStreamSyncMaxDelay = parseDuration(mk, tk, mv, errors, warnings)
+			case "io_weight":
+				opts.JetStreamIOWeight = int(mv.(int64))
+			case "preallocate":
+				opts.JetStreamPreallocate = mv.(bool)
+			case "drop_page_cache":
+				opts.JetStreamDropPageCache = mv.(bool)
+			case "account_template":
+				if err := parseJetStreamAccountTemplate(tk, opts, errors, warnings); err != nil {
+					return err
+				}
+			case "standby":
+				if err := parseJetStreamStandby(tk, opts, errors); err != nil {
+					return err
+				}
+			case "billing_webhook":
+				if err := parseJetStreamBilling(tk, opts, errors); err != nil {
+					return err
+				}
+			case "orphans":
+				if err := parseJetStreamOrphans(tk, opts, errors); err != nil {
+					return err
+				}
+			case "maintenance":
+				if err := parseJetStreamMaintenance(tk, opts, errors); err != nil {
+					return err
+				}
+			case "consumer_metrics":
+				if err := parseJetStreamConsumerMetrics(tk, opts, errors); err != nil {
+					return err
+				}
+			case "stats_history":
+				if err := parseJetStreamStatsHistory(tk, opts, errors); err != nil {
+					return err
+				}
+			case "clock_skew":
+				if err := parseJetStreamClockSkew(tk, opts, errors); err != nil {
+					return err
+				}
+			case "webhooks":
+				if err := parseJetStreamWebhooks(tk, opts, errors); err != nil {
+					return err
+				}
+			case "stream_remotes":
+				if err := parseJetStreamRemotes(tk, opts, errors); err != nil {
+					return err
+				}
 			default:
 				if !tk.IsUsedVariable() {
 					err := &unknownConfigFieldErr{
@@ -2700,6 +3450,11 @@ func parseAccounts(v interface{}, opts *Options, errors *[]error, warnings *[]er
 						*errors = append(*errors, err)
 						continue
 					}
+				case "aggregate":
+					if err := parseAccountAggregate(tk, acc, errors, warnings); err != nil {
+						*errors = append(*errors, err)
+						continue
+					}
 				case "users":
 					var err error
 					usersTk = tk
@@ -46,6 +46,7 @@ type pubArg struct {
 	szb     []byte
 	hdb     []byte
 	queues  [][]byte
+	qkey    []byte // Optional key to consistently select queue subscribers.
 	size    int
 	hdr     int
 	psi     []*serviceImport
@@ -3472,9 +3472,9 @@ func (n *raft) fileWriter() {
 			n.RLock()
 			copy(buf[0:], n.wtv)
 			n.RUnlock()
-			<-dios
+			dios.acquire(ioBackground)
 			err := os.WriteFile(tvf, buf[:], 0640)
-			dios <- struct{}{}
+			dios.release(ioBackground)
 			if err != nil && !isClosed() {
 				n.setWriteErr(err)
 				n.warn("Error writing term and vote file for %q: %v", n.group, err)
@@ -3483,9 +3483,9 @@ func (n *raft) fileWriter() {
 			n.RLock()
 			buf := copyBytes(n.wps)
 			n.RUnlock()
-			<-dios
+			dios.acquire(ioBackground)
 			err := os.WriteFile(psf, buf, 0640)
-			dios <- struct{}{}
+			dios.release(ioBackground)
 			if err != nil && !isClosed() {
 				n.setWriteErr(err)
 				n.warn("Error writing peer state file for %q: %v", n.group, err)
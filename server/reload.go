@@ -233,6 +233,22 @@ func (t *tlsTimeoutOption) Apply(server *Server) {
 	server.Noticef("Reloaded: tls timeout = %v", t.newValue)
 }
 
+// httpTLSOption implements the option interface for the `http_tls` setting.
+type httpTLSOption struct {
+	noopOption
+	newValue *tls.Config
+}
+
+// Apply is a no-op because the monitoring TLS config is picked up on each
+// new connection after options are applied.
+func (h *httpTLSOption) Apply(server *Server) {
+	message := "disabled"
+	if h.newValue != nil {
+		message = "enabled"
+	}
+	server.Noticef("Reloaded: http_tls = %s", message)
+}
+
 // tlsPinnedCertOption implements the option interface for the tls `pinned_certs` setting.
 type tlsPinnedCertOption struct {
 	noopOption
@@ -608,6 +624,18 @@ func (jso jetStreamOption) IsStatszChange() bool {
 	return true
 }
 
+// jetStreamAccTemplateOption implements the option interface for the JetStream
+// `account_template` setting.
+type jetStreamAccTemplateOption struct {
+	noopOption
+}
+
+// Apply the template to the accounts we have now.
+func (a *jetStreamAccTemplateOption) Apply(s *Server) {
+	s.reloadJetStreamAccountTemplate()
+	s.Noticef("Reloaded: JetStream account template")
+}
+
 type ocspOption struct {
 	noopOption
 	newValue *OCSPConfig
@@ -945,9 +973,26 @@ func imposeOrder(value interface{}) error {
 		})
 	case WebsocketOpts:
 		sort.Strings(value.AllowedOrigins)
+	case *JSAccountTemplate:
+		if value != nil {
+			sort.Strings(value.Accounts)
+		}
+	case *JSStandbyOpts:
+		if value != nil {
+			sort.Strings(value.URLs)
+		}
+	case *JSWebhookOpts:
+		if value != nil {
+			sort.Strings(value.Allow)
+		}
+	case *JSStreamRemoteOpts:
+		if value != nil {
+			sort.Strings(value.Allow)
+		}
 	case string, bool, uint8, int, int32, int64, time.Duration, float64, nil, LeafNodeOpts, ClusterOpts, *tls.Config, PinnedCertSet,
 		*URLAccResolver, *MemAccResolver, *DirAccResolver, *CacheDirAccResolver, Authentication, MQTTOpts, jwt.TagList,
-		*OCSPConfig, map[string]string, JSLimitOpts, StoreCipher:
+		*OCSPConfig, map[string]string, JSLimitOpts, StoreCipher, *JSBillingOpts, *JSOrphanOpts, *JSMaintenanceOpts,
+		*JSConsumerMetricsOpts, *JSStatsHistoryOpts, *JSClockSkewOpts:
 		// explicitly skipped types
 	default:
 		// this will fail during unit tests
@@ -1024,6 +1069,8 @@ func (s *Server) diffOptions(newOpts *Options) ([]option, error) {
 			diffOpts = append(diffOpts, &remoteSyslogOption{newValue: newValue.(string)})
 		case "tlsconfig":
 			diffOpts = append(diffOpts, &tlsOption{newValue: newValue.(*tls.Config)})
+		case "httptlsconfig":
+			diffOpts = append(diffOpts, &httpTLSOption{newValue: newValue.(*tls.Config)})
 		case "tlstimeout":
 			diffOpts = append(diffOpts, &tlsTimeoutOption{newValue: newValue.(float64)})
 		case "tlspinnedcerts":
@@ -1210,6 +1257,8 @@ func (s *Server) diffOptions(newOpts *Options) ([]option, error) {
 				return nil, fmt.Errorf("config reload not supported for %s: old=%v, new=%v",
 					field.Name, oldValue, newValue)
 			}
+		case "jetstreamacctemplate":
+			diffOpts = append(diffOpts, &jetStreamAccTemplateOption{})
 		case "jetstream":
 			new := newValue.(bool)
 			old := oldValue.(bool)
@@ -1619,6 +1668,12 @@ func (s *Server) reloadAuthorization() {
 				newAcc.ic, newAcc.isid = acc.ic, acc.isid
 				// Transfer any JetStream state.
 				newAcc.js = acc.js
+				// Our assets are encrypted with the key they were created with, see jsAccountKey.
+				if acc.js != nil && newAcc.jsKey != acc.jsKey {
+					s.Warnf("JetStream encryption key of account %q can not be changed on reload, "+
+						"streams need to be restored from a backup to be encrypted with a new key", newAcc.Name)
+					newAcc.jsKey = acc.jsKey
+				}
 				// Also transfer any internal accounting on different client types. We copy over all clients
 				// so need to copy this as well for proper accounting going forward.
 				newAcc.nrclients = acc.nrclients
@@ -1781,6 +1836,7 @@ func (s *Server) reloadAuthorization() {
 		if err := s.enableJetStreamAccounts(); err != nil {
 			s.Errorf(err.Error())
 		}
+		s.captureAggregateAccounts()
 	}
 }
 
@@ -487,6 +487,59 @@ func TestConfigReloadDisableTLS(t *testing.T) {
 	nc.Close()
 }
 
+func TestConfigReloadMonitoringTLS(t *testing.T) {
+	template := `
+		listen: "127.0.0.1:-1"
+		https: "127.0.0.1:-1"
+		http_tls {
+			cert_file: '../test/configs/certs/server-cert.pem'
+			key_file: '../test/configs/certs/server-key.pem'
+			ca_file: '../test/configs/certs/ca.pem'
+			verify: %t
+		}
+	`
+	s, _, conf := runReloadServerWithContent(t, []byte(fmt.Sprintf(template, true)))
+	defer s.Shutdown()
+
+	url := fmt.Sprintf("https://127.0.0.1:%d/varz", s.MonitorAddr().Port)
+	get := func() error {
+		tlsConfig, err := GenTLSConfig(&TLSConfigOpts{CaFile: "../test/configs/certs/ca.pem"})
+		if err != nil {
+			t.Fatalf("Error generating TLS config: %v", err)
+		}
+		tlsConfig.RootCAs, tlsConfig.ClientCAs = tlsConfig.ClientCAs, nil
+		hc := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: 2 * time.Second}
+		resp, err := hc.Get(url)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	// Client certificates are required.
+	if err := get(); err == nil {
+		t.Fatal("Expected error without a client certificate")
+	}
+	// Not any more after the reload.
+	reloadUpdateConfig(t, s, conf, fmt.Sprintf(template, false))
+	if err := get(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Removing all TLS config should fail the handshake but not the server.
+	reloadUpdateConfig(t, s, conf, `
+		listen: "127.0.0.1:-1"
+		https: "127.0.0.1:-1"
+	`)
+	if err := get(); err == nil {
+		t.Fatal("Expected error without a TLS config")
+	}
+	if _, err := s.Varz(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
 // Ensure Reload supports single user authentication config changes. Test this
 // by starting a server with authentication enabled, connect to it to verify,
 // reload config using a different username/password, ensure reconnect fails,
@@ -0,0 +1,560 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nkeys"
+	"github.com/nats-io/nuid"
+)
+
+// A remoteConn is a client connection from this server to another NATS deployment, used
+// where a leafnode is not an option, e.g. for stream remotes and a standby. It subscribes
+// to a fixed set of subjects, can send requests, and reconnects until it is closed.
+type remoteConn struct {
+	mu      sync.Mutex
+	srv     *Server
+	opts    remoteConnOpts
+	nc      net.Conn
+	url     string
+	info    Info
+	qch     chan struct{}
+	closed  bool
+	rprefix string
+	rsub    bool
+	rseq    uint64
+	resps   map[string]chan *remoteMsg
+	// Limits for what the remote sends us.
+	maxLine    int
+	maxPayload int
+}
+
+// remoteConnOpts configure a remoteConn.
+type remoteConnOpts struct {
+	// Name of the connection on the remote.
+	name string
+	urls []string
+	// Optional creds file, or user and password, or token.
+	credentials string
+	user        string
+	password    string
+	token       string
+	// How long to wait before connecting again.
+	reconnectWait time.Duration
+	// Subjects to subscribe to, messages are passed to the handler from the read loop.
+	subjects []string
+	handler  func(subject, reply string, hdr, msg []byte)
+	// Largest message we accept from the remote, defaults to our max payload.
+	maxPayload int
+	// Optional TLS config, requires TLS when set.
+	tlsConfig *tls.Config
+	// Called once (re)connected, and with connect, read and protocol errors.
+	connected func()
+	errored   func(err error)
+}
+
+// remoteMsg is a message received from the remote.
+type remoteMsg struct {
+	hdr []byte
+	msg []byte
+}
+
+const (
+	// Timeout for dialing and the handshake with the remote.
+	remoteConnTimeout = 2 * time.Second
+	// Timeout for writes to the remote.
+	remoteConnWriteTimeout = 2 * time.Second
+	// Default port of urls without one.
+	remoteConnDefaultPort = "4222"
+)
+
+var (
+	errRemoteNotConnected = errors.New("not connected to remote")
+	errRemoteNoResponders = errors.New("no responders available for request")
+	errRemoteTimeout      = errors.New("timeout waiting for response from remote")
+	errRemoteLineTooLong  = errors.New("protocol line from remote exceeds maximum")
+	errRemoteMaxPayload   = errors.New("message from remote exceeds maximum payload")
+)
+
+// checkRemoteConnURLs checks that the urls can be used for a remoteConn.
+func checkRemoteConnURLs(urls []string) error {
+	for _, u := range urls {
+		if _, err := parseRemoteConnURL(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRemoteConnURL parses a url, defaulting to the nats scheme and default client port.
+func parseRemoteConnURL(u string) (*url.URL, error) {
+	if !strings.Contains(u, "://") {
+		u = "nats://" + u
+	}
+	pu, err := url.Parse(u)
+	if err != nil || pu.Host == _EMPTY_ {
+		return nil, fmt.Errorf("url %q is invalid", u)
+	}
+	switch strings.ToLower(pu.Scheme) {
+	case "nats", "tls":
+	default:
+		return nil, fmt.Errorf("url %q has an unsupported scheme", u)
+	}
+	if pu.Port() == _EMPTY_ {
+		pu.Host = net.JoinHostPort(pu.Hostname(), remoteConnDefaultPort)
+	}
+	return pu, nil
+}
+
+// newRemoteConn returns a remoteConn that connects in its own Go routine,
+// or nil if the server is shutting down.
+func (s *Server) newRemoteConn(opts *remoteConnOpts) *remoteConn {
+	rc := &remoteConn{
+		srv:     s,
+		opts:    *opts,
+		qch:     make(chan struct{}),
+		rprefix: fmt.Sprintf("_INBOX.%s.", nuid.Next()),
+		resps:   make(map[string]chan *remoteMsg),
+	}
+	sopts := s.getOpts()
+	rc.maxLine, rc.maxPayload = int(sopts.MaxControlLine), int(sopts.MaxPayload)
+	if opts.maxPayload > 0 {
+		rc.maxPayload = opts.maxPayload
+	}
+	if !s.startGoRoutine(rc.run) {
+		return nil
+	}
+	return rc
+}
+
+// run connects and reads from the remote until closed.
+func (rc *remoteConn) run() {
+	s := rc.srv
+	defer s.grWG.Done()
+
+	for {
+		nc, br, err := rc.connect()
+		if err == nil {
+			if cb := rc.opts.connected; cb != nil {
+				cb()
+			}
+			err = rc.readLoop(br)
+			rc.mu.Lock()
+			rc.nc, rc.url, rc.rsub = nil, _EMPTY_, false
+			rc.mu.Unlock()
+			nc.Close()
+		}
+		if rc.isClosed() {
+			return
+		}
+		if cb := rc.opts.errored; cb != nil && err != nil {
+			cb(err)
+		}
+		select {
+		case <-rc.qch:
+			return
+		case <-s.quitCh:
+			return
+		case <-time.After(rc.opts.reconnectWait):
+		}
+	}
+}
+
+// connect tries the urls in order, returning the first connection that completes the handshake.
+func (rc *remoteConn) connect() (net.Conn, *bufio.Reader, error) {
+	var err error
+	for _, u := range rc.opts.urls {
+		var pu *url.URL
+		if pu, err = parseRemoteConnURL(u); err != nil {
+			continue
+		}
+		var (
+			nc   net.Conn
+			br   *bufio.Reader
+			info *Info
+		)
+		if nc, br, info, err = rc.handshake(pu); err != nil {
+			continue
+		}
+		rc.mu.Lock()
+		if rc.closed {
+			rc.mu.Unlock()
+			nc.Close()
+			return nil, nil, ErrConnectionClosed
+		}
+		rc.nc, rc.url, rc.info = nc, pu.Redacted(), *info
+		rc.mu.Unlock()
+		return nc, br, nil
+	}
+	return nil, nil, err
+}
+
+// handshake dials the url and exchanges the INFO, CONNECT and PING/PONG protocols.
+// Subscriptions are sent before the PING, so they are in place once we have the PONG.
+func (rc *remoteConn) handshake(pu *url.URL) (net.Conn, *bufio.Reader, *Info, error) {
+	nc, err := net.DialTimeout("tcp", pu.Host, remoteConnTimeout)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	nc.SetDeadline(time.Now().Add(remoteConnTimeout))
+	br := bufio.NewReader(nc)
+	fail := func(err error) (net.Conn, *bufio.Reader, *Info, error) {
+		nc.Close()
+		return nil, nil, nil, err
+	}
+
+	line, err := rc.readLine(br)
+	if err != nil {
+		return fail(err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fail(fmt.Errorf("unexpected protocol from %s: %q", pu.Redacted(), strings.TrimSpace(line)))
+	}
+	var info Info
+	if err := json.Unmarshal([]byte(line[5:]), &info); err != nil {
+		return fail(err)
+	}
+
+	tlsRequired := strings.EqualFold(pu.Scheme, "tls") || info.TLSRequired || rc.opts.tlsConfig != nil
+	if tlsRequired {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if rc.opts.tlsConfig != nil {
+			tlsConfig = rc.opts.tlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == _EMPTY_ {
+			tlsConfig.ServerName = pu.Hostname()
+		}
+		tc := tls.Client(nc, tlsConfig)
+		if err := tc.Handshake(); err != nil {
+			return fail(err)
+		}
+		nc, br = tc, bufio.NewReader(tc)
+	}
+
+	cinfo := ClientOpts{
+		Echo:         true,
+		TLSRequired:  tlsRequired,
+		Name:         rc.opts.name,
+		Lang:         "go",
+		Version:      VERSION,
+		Protocol:     ClientProtoInfo,
+		Headers:      true,
+		NoResponders: true,
+	}
+	if err := rc.setAuth(&cinfo, pu, info.Nonce); err != nil {
+		return fail(err)
+	}
+	b, err := json.Marshal(&cinfo)
+	if err != nil {
+		return fail(err)
+	}
+	var proto bytes.Buffer
+	fmt.Fprintf(&proto, "CONNECT %s\r\n", b)
+	for i, subj := range rc.opts.subjects {
+		fmt.Fprintf(&proto, "SUB %s %d\r\n", subj, i+1)
+	}
+	proto.WriteString(pingProto)
+	if _, err := nc.Write(proto.Bytes()); err != nil {
+		return fail(err)
+	}
+
+	for {
+		line, err := rc.readLine(br)
+		if err != nil {
+			return fail(err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			nc.SetDeadline(time.Time{})
+			return nc, br, &info, nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fail(remoteProtoErr(line))
+		}
+	}
+}
+
+// setAuth sets the credentials of the CONNECT, from our options or the url.
+func (rc *remoteConn) setAuth(cinfo *ClientOpts, pu *url.URL, nonce string) error {
+	o := &rc.opts
+	switch {
+	case o.credentials != _EMPTY_:
+		contents, err := os.ReadFile(o.credentials)
+		if err != nil {
+			return err
+		}
+		defer wipeSlice(contents)
+		items := credsRe.FindAllSubmatch(contents, -1)
+		if len(items) < 2 {
+			return fmt.Errorf("credentials file %q malformed", o.credentials)
+		}
+		kp, err := nkeys.FromSeed(items[1][1])
+		if err != nil {
+			return fmt.Errorf("credentials file %q has malformed seed", o.credentials)
+		}
+		defer kp.Wipe()
+		sigraw, err := kp.Sign([]byte(nonce))
+		if err != nil {
+			return err
+		}
+		cinfo.JWT = string(items[0][1])
+		cinfo.Sig = base64.RawURLEncoding.EncodeToString(sigraw)
+	case o.user != _EMPTY_:
+		cinfo.Username, cinfo.Password = o.user, o.password
+	case o.token != _EMPTY_:
+		cinfo.Token = o.token
+	case pu.User != nil:
+		if pass, ok := pu.User.Password(); ok {
+			cinfo.Username, cinfo.Password = pu.User.Username(), pass
+		} else {
+			cinfo.Token = pu.User.Username()
+		}
+	}
+	return nil
+}
+
+// remoteProtoErr returns the error of a -ERR protocol line.
+func remoteProtoErr(line string) error {
+	return errors.New(strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+}
+
+// readLine reads a protocol line from the remote. Only INFO, which lists the urls of
+// the remote cluster, can be longer than our max control line.
+func (rc *remoteConn) readLine(br *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		frag, err := br.ReadSlice('\n')
+		if len(line)+len(frag) > rc.maxPayload {
+			return _EMPTY_, errRemoteLineTooLong
+		}
+		line = append(line, frag...)
+		if err == bufio.ErrBufferFull {
+			continue
+		} else if err != nil {
+			return _EMPTY_, err
+		}
+		if len(line) > rc.maxLine && !bytes.HasPrefix(line, []byte("INFO ")) {
+			return _EMPTY_, errRemoteLineTooLong
+		}
+		return string(line), nil
+	}
+}
+
+// readLoop processes the protocols from the remote until the connection fails.
+func (rc *remoteConn) readLoop(br *bufio.Reader) error {
+	for {
+		line, err := rc.readLine(br)
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		op, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(op) {
+		case "MSG", "HMSG":
+			if err := rc.processMsg(br, op, strings.Fields(args)); err != nil {
+				return err
+			}
+		case "PING":
+			if err := rc.write(pongProto); err != nil {
+				return err
+			}
+		case "-ERR":
+			// Errors like permission violations do not close the connection.
+			if cb := rc.opts.errored; cb != nil {
+				cb(remoteProtoErr(line))
+			}
+		case "PONG", "+OK", "INFO":
+		default:
+			return fmt.Errorf("unknown protocol from remote: %q", line)
+		}
+	}
+}
+
+// processMsg reads the payload of a MSG or HMSG and passes it on.
+// MSG <subject> <sid> [reply] <size>, HMSG <subject> <sid> [reply] <hdr size> <total size>
+func (rc *remoteConn) processMsg(br *bufio.Reader, op string, args []string) error {
+	nargs, hsize := 3, 0
+	if op == "HMSG" {
+		nargs = 4
+	}
+	if len(args) != nargs && len(args) != nargs+1 {
+		return fmt.Errorf("invalid %s protocol from remote: %q", op, args)
+	}
+	subj, sid, reply := args[0], args[1], _EMPTY_
+	if len(args) == nargs+1 {
+		reply = args[2]
+	}
+	size, err := strconv.Atoi(args[len(args)-1])
+	if err != nil || size < 0 {
+		return fmt.Errorf("invalid %s size from remote: %q", op, args)
+	}
+	if size > rc.maxPayload {
+		return errRemoteMaxPayload
+	}
+	if op == "HMSG" {
+		if hsize, err = strconv.Atoi(args[len(args)-2]); err != nil || hsize < 0 || hsize > size {
+			return fmt.Errorf("invalid %s header size from remote: %q", op, args)
+		}
+	}
+	buf := make([]byte, size+len(_CRLF_))
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return err
+	}
+	hdr, msg := buf[:hsize:hsize], buf[hsize:size]
+	if hsize == 0 {
+		hdr = nil
+	}
+
+	// Responses to our requests.
+	if sid == strconv.Itoa(len(rc.opts.subjects)+1) && strings.HasPrefix(subj, rc.rprefix) {
+		rc.mu.Lock()
+		ch := rc.resps[subj[len(rc.rprefix):]]
+		rc.mu.Unlock()
+		if ch != nil {
+			select {
+			case ch <- &remoteMsg{hdr: hdr, msg: msg}:
+			default:
+			}
+		}
+		return nil
+	}
+	if cb := rc.opts.handler; cb != nil {
+		cb(subj, reply, hdr, msg)
+	}
+	return nil
+}
+
+// write sends a protocol to the remote.
+func (rc *remoteConn) write(proto string) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.writeLocked([]byte(proto))
+}
+
+// Lock should be held.
+func (rc *remoteConn) writeLocked(b []byte) error {
+	if rc.nc == nil {
+		return errRemoteNotConnected
+	}
+	rc.nc.SetWriteDeadline(time.Now().Add(remoteConnWriteTimeout))
+	_, err := rc.nc.Write(b)
+	return err
+}
+
+// request sends a request to the remote and waits for the response.
+func (rc *remoteConn) request(subj string, data []byte, timeout time.Duration) ([]byte, error) {
+	rc.mu.Lock()
+	if rc.nc == nil {
+		rc.mu.Unlock()
+		return nil, errRemoteNotConnected
+	}
+	var proto bytes.Buffer
+	// Responses for all our requests go to a single subscription, created on first use.
+	if !rc.rsub {
+		fmt.Fprintf(&proto, "SUB %s* %d\r\n", rc.rprefix, len(rc.opts.subjects)+1)
+	}
+	rc.rseq++
+	token := strconv.FormatUint(rc.rseq, 10)
+	fmt.Fprintf(&proto, "PUB %s %s%s %d\r\n", subj, rc.rprefix, token, len(data))
+	proto.Write(data)
+	proto.WriteString(_CRLF_)
+	ch := make(chan *remoteMsg, 1)
+	rc.resps[token] = ch
+	err := rc.writeLocked(proto.Bytes())
+	if err == nil {
+		rc.rsub = true
+	}
+	rc.mu.Unlock()
+
+	defer func() {
+		rc.mu.Lock()
+		delete(rc.resps, token)
+		rc.mu.Unlock()
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case m := <-ch:
+		if len(m.msg) == 0 && bytes.HasPrefix(m.hdr, []byte("NATS/1.0 503")) {
+			return nil, errRemoteNoResponders
+		}
+		return m.msg, nil
+	case <-t.C:
+		return nil, errRemoteTimeout
+	case <-rc.qch:
+		return nil, ErrConnectionClosed
+	}
+}
+
+// isConnected returns if we are connected to the remote.
+func (rc *remoteConn) isConnected() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.nc != nil
+}
+
+// connectedURL returns the redacted url we are connected to, if any.
+func (rc *remoteConn) connectedURL() string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.url
+}
+
+// serverInfo returns the id and name of the remote server we are, or were last, connected to.
+func (rc *remoteConn) serverInfo() (string, string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.info.ID, rc.info.Name
+}
+
+func (rc *remoteConn) isClosed() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.closed
+}
+
+// close will close the connection and stop reconnecting.
+// This does not wait for the read loop, which may be calling the handler.
+func (rc *remoteConn) close() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.closed {
+		return
+	}
+	rc.closed = true
+	close(rc.qch)
+	if rc.nc != nil {
+		rc.nc.Close()
+	}
+	rc.nc, rc.url = nil, _EMPTY_
+}
@@ -0,0 +1,228 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestRemoteConn(t *testing.T) {
+	ro := DefaultTestOptions
+	ro.Port = -1
+	ro.Username, ro.Password = "ext", "pwd"
+	remote := RunServer(&ro)
+	defer remote.Shutdown()
+	// Restart on the same port.
+	ro.Port = remote.Addr().(*net.TCPAddr).Port
+
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	for _, u := range []string{"http://127.0.0.1:4222", "ws://127.0.0.1:4222", "nats://"} {
+		require_Error(t, checkRemoteConnURLs([]string{u}))
+	}
+	require_NoError(t, checkRemoteConnURLs([]string{"127.0.0.1", "tls://127.0.0.1:4443"}))
+
+	var (
+		mu   sync.Mutex
+		msgs []string
+		errs []error
+	)
+	connected := make(chan struct{}, 10)
+	opts := &remoteConnOpts{
+		name:          "test",
+		urls:          []string{"nats://127.0.0.1:1", remote.ClientURL()},
+		user:          "ext",
+		password:      "pwd",
+		reconnectWait: 50 * time.Millisecond,
+		subjects:      []string{"foo.*"},
+		handler: func(subject, reply string, hdr, msg []byte) {
+			mu.Lock()
+			msgs = append(msgs, fmt.Sprintf("%s:%s:%s", subject, getHeader("X", hdr), msg))
+			mu.Unlock()
+		},
+		connected: func() { connected <- struct{}{} },
+		errored: func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		},
+	}
+	rc := s.newRemoteConn(opts)
+	defer rc.close()
+
+	waitConnected := func() {
+		t.Helper()
+		select {
+		case <-connected:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Did not connect")
+		}
+	}
+	waitConnected()
+	require_True(t, rc.isConnected() && rc.connectedURL() == remote.ClientURL())
+	id, name := rc.serverInfo()
+	require_True(t, id == remote.ID() && name == remote.Name())
+
+	nc := natsConnect(t, remote.ClientURL(), nats.UserInfo("ext", "pwd"))
+	defer nc.Close()
+
+	// Subscriptions are in place once connected, with headers.
+	m := nats.NewMsg("foo.1")
+	m.Header.Set("X", "Y")
+	m.Data = []byte("1")
+	require_NoError(t, nc.PublishMsg(m))
+	require_NoError(t, nc.Publish("foo.2", []byte("2")))
+	require_NoError(t, nc.Publish("bar", []byte("3")))
+	require_NoError(t, nc.Flush())
+	checkFor(t, time.Second, 15*time.Millisecond, func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(msgs) != 2 {
+			return fmt.Errorf("Expected 2 msgs, got %v", msgs)
+		}
+		return nil
+	})
+	mu.Lock()
+	require_Equal(t, strings.Join(msgs, ","), "foo.1:Y:1,foo.2::2")
+	mu.Unlock()
+
+	// Requests.
+	natsSub(t, nc, "svc", func(m *nats.Msg) { m.Respond(append([]byte("re:"), m.Data...)) })
+	require_NoError(t, nc.Flush())
+	for i := 0; i < 3; i++ {
+		resp, err := rc.request("svc", []byte("req"), time.Second)
+		require_NoError(t, err)
+		require_Equal(t, string(resp), "re:req")
+	}
+	_, err := rc.request("nope", nil, time.Second)
+	require_Error(t, err, errRemoteNoResponders)
+
+	// Reconnects once the remote is back.
+	remote.Shutdown()
+	checkFor(t, time.Second, 15*time.Millisecond, func() error {
+		if rc.isConnected() {
+			return fmt.Errorf("Still connected")
+		}
+		return nil
+	})
+	_, err = rc.request("svc", nil, time.Second)
+	require_Error(t, err, errRemoteNotConnected)
+	remote = RunServer(&ro)
+	defer remote.Shutdown()
+	waitConnected()
+
+	nc = natsConnect(t, remote.ClientURL(), nats.UserInfo("ext", "pwd"))
+	defer nc.Close()
+	natsSub(t, nc, "svc", func(m *nats.Msg) { m.Respond([]byte("back")) })
+	require_NoError(t, nc.Flush())
+	resp, err := rc.request("svc", nil, time.Second)
+	require_NoError(t, err)
+	require_Equal(t, string(resp), "back")
+
+	// Closing cancels and stops reconnecting.
+	rc.close()
+	require_False(t, rc.isConnected())
+	_, err = rc.request("svc", nil, time.Second)
+	require_Error(t, err, errRemoteNotConnected)
+
+	// Authorization errors are reported.
+	opts.password = "bad"
+	rc = s.newRemoteConn(opts)
+	defer rc.close()
+	checkFor(t, 2*time.Second, 15*time.Millisecond, func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, err := range errs {
+			if strings.Contains(err.Error(), "Authorization Violation") {
+				return nil
+			}
+		}
+		return fmt.Errorf("Expected authorization error, got %v", errs)
+	})
+	require_False(t, rc.isConnected())
+
+	// Creds files sign the nonce of the remote.
+	ts, _ := runTrustedServer(t)
+	defer ts.Shutdown()
+	_, akp := createAccount(ts)
+	rc = s.newRemoteConn(&remoteConnOpts{
+		urls:          []string{ts.ClientURL()},
+		credentials:   newUser(t, akp),
+		reconnectWait: 50 * time.Millisecond,
+		connected:     func() { connected <- struct{}{} },
+	})
+	defer rc.close()
+	waitConnected()
+	require_True(t, rc.isConnected())
+}
+
+func TestRemoteConnLimits(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	for _, proto := range []string{
+		fmt.Sprintf("MSG foo 1 %d\r\n", MAX_PAYLOAD_SIZE+1),
+		fmt.Sprintf("+OK %s\r\n", strings.Repeat("X", MAX_CONTROL_LINE_SIZE)),
+	} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require_NoError(t, err)
+		defer l.Close()
+		go func(proto string) {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			c.Write([]byte("INFO {}\r\n"))
+			// Skip the CONNECT, SUB and PING.
+			buf := make([]byte, 4096)
+			c.Read(buf)
+			c.Write([]byte("PONG\r\n" + proto))
+			// A remote that does not stop sending.
+			for {
+				if _, err := c.Write(make([]byte, 64*1024)); err != nil {
+					return
+				}
+			}
+		}(proto)
+
+		errCh := make(chan error, 1)
+		rc := s.newRemoteConn(&remoteConnOpts{
+			urls:          []string{l.Addr().String()},
+			reconnectWait: time.Hour,
+			subjects:      []string{"foo"},
+			errored: func(err error) {
+				select {
+				case errCh <- err:
+				default:
+				}
+			},
+		})
+		defer rc.close()
+		select {
+		case err := <-errCh:
+			require_True(t, err == errRemoteMaxPayload || err == errRemoteLineTooLong)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected an error for %q", proto[:10])
+		}
+	}
+}
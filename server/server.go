@@ -238,6 +238,9 @@ type Server struct {
 	// For eventIDs
 	eventIds *nuid.NUID
 
+	// Salt for the hashes of publisher IPs in the origin of messages.
+	originSalt string
+
 	// Websocket structure
 	websocket srvWebsocket
 
@@ -291,6 +294,12 @@ type Server struct {
 
 	// Queue to process JS API requests that come from routes (or gateways)
 	jsAPIRoutedReqs *ipQueue[*jsAPIRoutedReq]
+
+	// JetStream hooks registered by embedding applications.
+	jsHooks atomic.Value
+
+	// Stream validators registered by embedding applications.
+	validators sync.Map
 }
 
 // For tracking JS nodes.
@@ -387,6 +396,7 @@ func NewServer(opts *Options) (*Server, error) {
 		gwLeafSubs:         NewSublistWithCache(),
 		httpBasePath:       httpBasePath,
 		eventIds:           nuid.New(),
+		originSalt:         nuid.Next(),
 		routesToSelf:       make(map[string]struct{}),
 		httpReqStats:       make(map[string]uint64), // Used to track HTTP requests
 		rateLimitLoggingCh: make(chan time.Duration, 1),
@@ -1159,12 +1169,21 @@ func (s *Server) LookupOrRegisterAccount(name string) (account *Account, isNew b
 // or this call will fail.
 func (s *Server) RegisterAccount(name string) (*Account, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	if _, ok := s.accounts.Load(name); ok {
+		s.mu.Unlock()
 		return nil, ErrAccountExists
 	}
 	acc := NewAccount(name)
 	s.registerAccountNoLock(acc)
+	configJS := s.js != nil && acc.jetStreamConfigured()
+	s.mu.Unlock()
+
+	// Accounts the JetStream account template applies to are enabled right away.
+	if configJS {
+		if err := s.configJetStream(acc); err != nil {
+			s.Errorf("Error configuring jetstream for account [%s]: %v", acc.traceLabel(), err)
+		}
+	}
 	return acc, nil
 }
 
@@ -1391,6 +1410,11 @@ func (s *Server) registerAccountNoLock(acc *Account) *Account {
 	acc.srv = s
 	acc.updated = time.Now().UTC()
 	accName := acc.Name
+	if len(acc.jsLimits) == 0 {
+		if limits := s.jsAccountTemplateLimits(accName); limits != nil {
+			acc.jsLimits, acc.jsTemplate = limits, true
+		}
+	}
 	jsEnabled := len(acc.jsLimits) > 0
 	acc.mu.Unlock()
 
@@ -1417,6 +1441,7 @@ func (s *Server) registerAccountNoLock(acc *Account) *Account {
 	// Can not have server lock here.
 	s.mu.Unlock()
 	s.registerSystemImports(acc)
+	s.captureAggregateAccount(acc)
 	// Starting 2.9.0, we are phasing out the optimistic mode, so change
 	// the account to interest-only mode (except if instructed not to do
 	// it in some tests).
@@ -2279,7 +2304,7 @@ func (s *Server) StartMonitoring() error {
 	if opts.HTTPPort != 0 {
 		err = s.startMonitoring(false)
 	} else if opts.HTTPSPort != 0 {
-		if opts.TLSConfig == nil {
+		if opts.TLSConfig == nil && opts.HTTPTLSConfig == nil {
 			return fmt.Errorf("TLS cert and key required for HTTPS")
 		}
 		err = s.startMonitoring(true)
@@ -2302,6 +2327,9 @@ const (
 	JszPath          = "/jsz"
 	HealthzPath      = "/healthz"
 	IPQueuesPath     = "/ipqueuesz"
+	JSAPIPath        = "/jsapi"
+	JSExportPath     = "/jsexport"
+	JSIngestPath     = "/jsingest"
 )
 
 func (s *Server) basePath(p string) string {
@@ -2335,6 +2363,15 @@ func (cl *captureHTTPServerLog) Write(p []byte) (int, error) {
 // the same TLS configuration.
 func (s *Server) getMonitoringTLSConfig(_ *tls.ClientHelloInfo) (*tls.Config, error) {
 	opts := s.getOpts()
+	// A dedicated monitoring TLS config is used as is, which allows
+	// client certificates to be required and verified.
+	if opts.HTTPTLSConfig != nil {
+		return opts.HTTPTLSConfig.Clone(), nil
+	}
+	// Both can have been removed on a reload.
+	if opts.TLSConfig == nil {
+		return nil, errors.New("no TLS config for monitoring")
+	}
 	tc := opts.TLSConfig.Clone()
 	tc.ClientAuth = tls.NoClientCert
 	return tc, nil
@@ -2361,9 +2398,8 @@ func (s *Server) startMonitoring(secure bool) error {
 			port = 0
 		}
 		hp = net.JoinHostPort(opts.HTTPHost, strconv.Itoa(port))
-		config := opts.TLSConfig.Clone()
+		config, _ := s.getMonitoringTLSConfig(nil)
 		config.GetConfigForClient = s.getMonitoringTLSConfig
-		config.ClientAuth = tls.NoClientCert
 		httpListener, err = tls.Listen("tcp", hp, config)
 
 	} else {
@@ -2412,6 +2448,12 @@ func (s *Server) startMonitoring(secure bool) error {
 	mux.HandleFunc(s.basePath(HealthzPath), s.HandleHealthz)
 	// IPQueuesz
 	mux.HandleFunc(s.basePath(IPQueuesPath), s.HandleIPQueuesz)
+	// JetStream API
+	mux.HandleFunc(s.basePath(JSAPIPath)+"/", s.HandleJSAPI)
+	// Stream export
+	mux.HandleFunc(s.basePath(JSExportPath)+"/", s.HandleJSExport)
+	// Stream ingest
+	mux.HandleFunc(s.basePath(JSIngestPath)+"/", s.HandleJSIngest)
 
 	// Do not set a WriteTimeout because it could cause cURL/browser
 	// to return empty response or unable to display page if the
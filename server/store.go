@@ -79,6 +79,24 @@ type StoreMsg struct {
 // For the cases where its a single message we will also supply sequence number and subject.
 type StorageUpdateHandler func(msgs, bytes int64, seq uint64, subj string)
 
+// RetentionReason is why a message was removed by the retention of a stream.
+type RetentionReason string
+
+const (
+	// Removed by the store to honor the limits of the stream.
+	RetentionMaxMsgs    RetentionReason = "max_msgs"
+	RetentionMaxBytes   RetentionReason = "max_bytes"
+	RetentionMaxAge     RetentionReason = "max_age"
+	RetentionMaxMsgsPer RetentionReason = "max_msgs_per_subject"
+	// Removed by the stream once consumed, see RetentionPolicy.
+	RetentionInterest  RetentionReason = "interest"
+	RetentionWorkQueue RetentionReason = "workqueue"
+)
+
+// Used to call back into the upper layers for each message removed to honor the limits of the store.
+// Called without holding any store locks.
+type RetentionUpdateHandler func(seq uint64, subj string, size uint64, reason RetentionReason)
+
 type StreamStore interface {
 	StoreMsg(subject string, hdr, msg []byte) (uint64, int64, error)
 	StoreRawMsg(subject string, hdr, msg []byte, seq uint64, ts int64) error
@@ -101,6 +119,7 @@ type StreamStore interface {
 	FastState(*StreamState)
 	Type() StorageType
 	RegisterStorageUpdates(StorageUpdateHandler)
+	RegisterRetentionUpdates(RetentionUpdateHandler)
 	UpdateConfig(cfg *StreamConfig) error
 	Delete() error
 	Stop() error
@@ -178,6 +197,7 @@ type ConsumerStore interface {
 	UpdateAcks(dseq, sseq uint64) error
 	UpdateConfig(cfg *ConsumerConfig) error
 	Update(*ConsumerState) error
+	Reset(*ConsumerState) error
 	State() (*ConsumerState, error)
 	BorrowState() (*ConsumerState, error)
 	EncodedState() ([]byte, error)
@@ -540,12 +560,24 @@ func (smo *StoreMsg) copy(sm *StoreMsg) {
 	if sm.buf != nil {
 		sm.buf = sm.buf[:0]
 	}
+	sm.reserve(len(smo.buf))
 	sm.buf = append(sm.buf, smo.buf...)
 	// We set cap on header in case someone wants to expand it.
 	sm.hdr, sm.msg = sm.buf[:len(smo.hdr):len(smo.hdr)], sm.buf[len(smo.hdr):]
 	sm.subj, sm.seq, sm.ts = smo.subj, smo.seq, smo.ts
 }
 
+// Make sure our buffer can take n more bytes plus a trailing CR_LF without growing.
+// When delivered the CR_LF is appended to our buffer, so this avoids copying the
+// whole message again into a new buffer on replays.
+func (sm *StoreMsg) reserve(n int) {
+	if need := len(sm.buf) + n + LEN_CR_LF; need > cap(sm.buf) {
+		buf := make([]byte, len(sm.buf), need)
+		copy(buf, sm.buf)
+		sm.buf = buf
+	}
+}
+
 // Clear all fields except underlying buffer but reset that if present to [:0].
 func (sm *StoreMsg) clear() {
 	if sm == nil {
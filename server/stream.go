@@ -26,9 +26,11 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/klauspost/compress/s2"
@@ -69,6 +71,83 @@ type StreamConfig struct {
 	// Allow KV like semantics to also discard new on a per subject basis
 	DiscardNewPer bool `json:"discard_new_per_subject,omitempty"`
 
+	// Optional limit on the rate messages are accepted from publishers.
+	MaxIngestRate *IngestRate `json:"max_ingest_rate,omitempty"`
+
+	// Optional validation of messages published to the stream.
+	Schema *StreamSchema `json:"schema,omitempty"`
+
+	// Optional forwarding of a sample of ingested messages, e.g. to a staging environment.
+	Shadow *StreamShadow `json:"shadow,omitempty"`
+
+	// Record the origin of each message, i.e. the publishing account and client and when it was received.
+	// Consumers need to opt in to receive it.
+	Origin bool `json:"origin,omitempty"`
+
+	// How long to keep tombstones of removed messages, zero disables them.
+	// While enabled the stream leader also sends an advisory for each removal.
+	Tombstones time.Duration `json:"tombstones,omitempty"`
+
+	// Allow messages to be published in ordered chunks that are reassembled before they are stored,
+	// so messages can be larger than max_payload. See JSChunkId.
+	AllowChunked bool `json:"allow_chunked,omitempty"`
+
+	// Additional subjects to ingest messages from, optionally stored with a translated subject.
+	SubjectAliases []*SubjectAlias `json:"subject_aliases,omitempty"`
+
+	// Ingest messages from another NATS deployment over a client connection.
+	Remote *StreamRemote `json:"remote,omitempty"`
+
+	// Capture a percentage of the messages published to subjects stored by other streams.
+	Canary *StreamCanary `json:"canary,omitempty"`
+
+	// Treat all disk IO of this stream as background IO, so it does not add to the tail latency of
+	// other streams, e.g. for archives or bulk loads. Only applies to file storage.
+	LowIOPriority bool `json:"low_io_priority,omitempty"`
+
+	// Set if this stream is one shard of a sharded stream.
+	Shard *StreamShard `json:"shard,omitempty"`
+
+	// Pinned sequences are exempt from removal by MaxMsgs, MaxBytes and MaxAge.
+	// Zero MaxPinned means messages can not be pinned.
+	MaxPinned int      `json:"max_pinned,omitempty"`
+	Pinned    []uint64 `json:"pinned,omitempty"`
+
+	// Replication determines if publishers are acked once a quorum of replicas
+	// have the message, or by the leader as soon as the message is proposed.
+	Replication ReplicationMode `json:"replication,omitempty"`
+
+	// Subject the stream leader publishes StreamEvictions to with the messages removed by the retention
+	// of the stream, i.e. by its limits or once consumed under interest or work queue retention.
+	EvictionSubject string `json:"eviction_subject,omitempty"`
+
+	// Keep the most recent messages of a file based stream, up to this many bytes, in memory as well,
+	// so real-time consumers are served from memory. Older messages are only read from the files.
+	MemoryHeadBytes int64 `json:"memory_head_bytes,omitempty"`
+
+	// Index messages by the value of this header, e.g. an order id, so they can be looked up
+	// by that value without replaying the stream.
+	HeaderIndex string `json:"header_index,omitempty"`
+
+	// Named consumer configs consumers can be created from, with placeholders for e.g. their names and subjects.
+	ConsumerTemplates map[string]ConsumerConfig `json:"consumer_templates,omitempty"`
+
+	// Capture messages of the accounts that opted in, only for streams of the system account.
+	Aggregate *StreamAggregate `json:"aggregate,omitempty"`
+
+	// Only accept publishes from the client holding the writer lease, acquired with JSApiStreamWriter.
+	// The lease can be taken over by another client once the writer was idle for WriterLease.
+	SingleWriter bool          `json:"single_writer,omitempty"`
+	WriterLease  time.Duration `json:"writer_lease,omitempty"`
+
+	// Name of the store directory of the server for the files of the stream, spread across
+	// store directories if empty. Can only be changed by relocating the stream.
+	StoreDir string `json:"store_dir,omitempty"`
+
+	// Limit of unacknowledged messages of all consumers together. Once reached consumers pause
+	// delivering new messages, so many stalled consumers can not use up the memory of a server.
+	MaxAckPendingTotal int `json:"max_ack_pending_total,omitempty"`
+
 	// Optional qualifiers. These can not be modified after set to true.
 
 	// Sealed will seal a stream so no messages can get out or in.
@@ -82,6 +161,163 @@ type StreamConfig struct {
 	AllowRollup bool `json:"allow_rollup_hdrs"`
 }
 
+// isPinned returns true if the sequence is exempt from limits based removal.
+func (cfg *StreamConfig) isPinned(seq uint64) bool {
+	for _, pseq := range cfg.Pinned {
+		if pseq == seq {
+			return true
+		}
+	}
+	return false
+}
+
+// withPinned returns the config to update a stream with, given its current config. Pins are
+// not part of regular updates, they are only changed by pin updates that change nothing else.
+func (cfg *StreamConfig) withPinned(cur *StreamConfig, pinUpdate bool) *StreamConfig {
+	if pinUpdate {
+		ncfg := *cur
+		ncfg.Pinned = cfg.Pinned
+		return &ncfg
+	}
+	ncfg := *cfg
+	ncfg.Pinned = cur.Pinned
+	return &ncfg
+}
+
+// Returns the pinned sequences. Does not grab the stream lock since called from store updates.
+func (mset *stream) pins() []uint64 {
+	pinned, _ := mset.pinned.Load().([]uint64)
+	return pinned
+}
+
+func (mset *stream) hasPins() bool {
+	return len(mset.pins()) > 0
+}
+
+func (mset *stream) isPinnedSeq(seq uint64) bool {
+	for _, pseq := range mset.pins() {
+		if pseq == seq {
+			return true
+		}
+	}
+	return false
+}
+
+// pinnedConfig returns the config with the pins after applying the request. Pins of messages
+// that have been removed, e.g. by a delete or purge, are dropped along the way.
+// Callers should hold pinMu so concurrent pin updates do not lose each other's changes.
+func (mset *stream) pinnedConfig(req *JSApiMsgPinRequest) (*StreamConfig, *ApiError) {
+	cfg := mset.config()
+	pinned := make([]uint64, 0, len(cfg.Pinned)+1)
+	var smv StoreMsg
+	for _, seq := range cfg.Pinned {
+		if seq == req.Seq {
+			continue
+		}
+		if _, err := mset.store.LoadMsg(seq, &smv); err != nil {
+			continue
+		}
+		pinned = append(pinned, seq)
+	}
+	if !req.Unpin {
+		if _, err := mset.store.LoadMsg(req.Seq, &smv); err != nil {
+			return nil, NewJSNoMessageFoundError()
+		}
+		pinned = append(pinned, req.Seq)
+	}
+	if len(pinned) > 0 {
+		cfg.Pinned = pinned
+	} else {
+		cfg.Pinned = nil
+	}
+	return &cfg, nil
+}
+
+// checkPrunePins will kick off removing the pins of removed messages, unless already running.
+func (mset *stream) checkPrunePins() {
+	if atomic.CompareAndSwapInt32(&mset.pruning, 0, 1) {
+		go mset.prunePins()
+	}
+}
+
+// prunePins removes the pins of messages that are no longer in the stream.
+// Only the leader does this, it applies the result as a pin update.
+func (mset *stream) prunePins() {
+	defer atomic.StoreInt32(&mset.pruning, 0)
+
+	if !mset.isLeader() {
+		return
+	}
+	mset.pinMu.Lock()
+	defer mset.pinMu.Unlock()
+
+	cfg, _ := mset.pinnedConfig(&JSApiMsgPinRequest{Unpin: true})
+	if len(cfg.Pinned) == len(mset.pins()) {
+		return
+	}
+	mset.mu.RLock()
+	s, acc := mset.srv, mset.acc
+	mset.mu.RUnlock()
+	if resp := s.jsStreamPinUpdate(&ClientInfo{Account: acc.Name}, acc, mset, cfg); resp.Error != nil {
+		s.Warnf("JetStream error removing pins of removed messages from '%s > %s': %v", acc.Name, cfg.Name, resp.Error)
+	}
+}
+
+// IngestRate is for limiting the rate messages are accepted into a stream.
+// Messages over the rate are rejected unless Delay is set, in which case
+// they are stored but the ack is held until the rate allows.
+type IngestRate struct {
+	Msgs  uint64 `json:"msgs_per_sec,omitempty"`
+	Bytes uint64 `json:"bytes_per_sec,omitempty"`
+	Delay bool   `json:"delay_ack,omitempty"`
+}
+
+// ReplicationMode determines when a replicated stream acks publishers.
+type ReplicationMode int
+
+const (
+	// SyncReplication acks once a quorum of replicas have stored the message.
+	SyncReplication ReplicationMode = iota
+	// AsyncReplication acks as soon as the leader has proposed the message. This is faster,
+	// but the message can be lost if the leader fails before it is replicated, and the ack
+	// can not report errors detected when the message is stored, e.g. duplicates.
+	AsyncReplication
+)
+
+func (rm ReplicationMode) String() string {
+	switch rm {
+	case SyncReplication:
+		return "Sync"
+	case AsyncReplication:
+		return "Async"
+	default:
+		return "Unknown Replication Mode"
+	}
+}
+
+func (rm ReplicationMode) MarshalJSON() ([]byte, error) {
+	switch rm {
+	case SyncReplication:
+		return json.Marshal("sync")
+	case AsyncReplication:
+		return json.Marshal("async")
+	default:
+		return nil, fmt.Errorf("can not marshal %v", rm)
+	}
+}
+
+func (rm *ReplicationMode) UnmarshalJSON(data []byte) error {
+	switch strings.ToLower(string(data)) {
+	case jsonString("sync"):
+		*rm = SyncReplication
+	case jsonString("async"):
+		*rm = AsyncReplication
+	default:
+		return fmt.Errorf("can not unmarshal %q", data)
+	}
+	return nil
+}
+
 // RePublish is for republishing messages once committed to a stream.
 type RePublish struct {
 	Source      string `json:"src,omitempty"`
@@ -111,6 +347,8 @@ type PubAck struct {
 	Sequence  uint64 `json:"seq"`
 	Domain    string `json:"domain,omitempty"`
 	Duplicate bool   `json:"duplicate,omitempty"`
+	// Set when a chunk of a chunked message was received, the message is stored with the last chunk.
+	Chunk int `json:"chunk,omitempty"`
 }
 
 // StreamInfo shows config and current state for this stream.
@@ -123,6 +361,18 @@ type StreamInfo struct {
 	Mirror     *StreamSourceInfo   `json:"mirror,omitempty"`
 	Sources    []*StreamSourceInfo `json:"sources,omitempty"`
 	Alternates []StreamAlternate   `json:"alternates,omitempty"`
+	PubAcks    *PubAckStats        `json:"pub_acks,omitempty"`
+	// Set if the stream rejects messages after repeated store errors.
+	Failed *StreamFailure `json:"failed,omitempty"`
+	// Connection to the remote the stream ingests from, if any.
+	Remote *StreamRemoteInfo `json:"remote,omitempty"`
+}
+
+// PubAckStats has the number of publishers acked by this stream leader and the
+// average time between a message being proposed, or received when not clustered, and its ack.
+type PubAckStats struct {
+	Acks       uint64        `json:"acks"`
+	AvgLatency time.Duration `json:"avg_latency"`
 }
 
 type StreamAlternate struct {
@@ -218,12 +468,24 @@ type stream struct {
 	// Sources
 	sources map[string]*sourceInfo
 
+	// Resume tokens of the upstream streams for our mirror and sources.
+	rtoks map[string]*StreamResumeToken
+
 	// Indicates we have direct consumers.
 	directs int
 
 	// For republishing.
 	tr *transform
 
+	// For validating published messages.
+	schema *streamSchema
+
+	// If we are a shard of a sharded stream. Can not be updated.
+	shard *StreamShard
+
+	// Prior and current config revisions, oldest first.
+	revs []*StreamConfigRevision
+
 	// For processing consumers without main stream lock.
 	clsMu sync.RWMutex
 	cList []*consumer
@@ -245,6 +507,17 @@ type stream struct {
 	clMu       sync.Mutex
 	clseq      uint64
 	clfs       uint64
+	clts       int64  // last timestamp proposed while leader.
+	packs      uint64 // atomic, pub acks sent while leader.
+	packLat    int64  // atomic, total latency in ns of those pub acks.
+	apend      int64  // atomic, ack pending of all our consumers.
+	apmax      int64  // atomic, limit of the ack pending of all our consumers.
+	apx        int32  // atomic, set while our consumers are at the ack pending limit.
+	origin     int32  // atomic, set if we record the origin of messages.
+	swriter    int32  // atomic, set if we only accept publishes from our writer.
+	pinned     atomic.Value
+	pruning    int32 // atomic, set while we remove the pins of removed messages.
+	pinMu      sync.Mutex
 	leader     string
 	lqsent     time.Time
 	catchups   map[string]uint64
@@ -252,6 +525,48 @@ type stream struct {
 	compressOK bool
 	inMonitor  bool
 
+	// Ingest tracking for storage forecasts.
+	ibytes uint64
+	ilast  uint64
+	itime  time.Time
+	irate  float64
+
+	// Stats history.
+	shist *streamStatsHistory
+
+	// Ingest rate limiting window.
+	irmsgs  uint64
+	irbytes uint64
+	irend   time.Time
+
+	// Consecutive store errors, and if we stopped accepting messages because of them.
+	serrs  int
+	failed *StreamFailure
+
+	// Tombstones of removed messages.
+	tombs *streamTombstones
+	// Notifications of messages removed by retention.
+	evicts *streamEvictions
+	// Index of messages by the value of a header.
+	hidx *streamHeaderIndex
+
+	// Chunked messages that are not complete yet.
+	chunks *streamChunks
+
+	// Client connection to the remote we ingest from, only on the leader.
+	remote *streamRemote
+	// Current weight of our canary, only on the leader.
+	canary *streamCanary
+	// Internal clients in the accounts we capture from, only on the leader of an aggregate stream.
+	aggregate *streamAggregate
+	// Client holding the writer lease, only on the leader of a single writer stream.
+	writer *streamWriter
+
+	// Set while our files are copied to another store directory.
+	relocating bool
+	// Workers and assignments of our partitions, only on the leader of a WorkQueue stream.
+	partitions *streamPartitions
+
 	// Direct get subscription.
 	directSub *subscription
 	lastBySub *subscription
@@ -299,6 +614,7 @@ const (
 	JSMsgRollup           = "Nats-Rollup"
 	JSMsgSize             = "Nats-Msg-Size"
 	JSResponseType        = "Nats-Response-Type"
+	JSBatchId             = "Nats-Batch-Id"
 )
 
 // Headers for republished messages and direct gets.
@@ -397,9 +713,10 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 	jsa.usageMu.RLock()
 	selected, tier, hasTier := jsa.selectLimits(&cfg)
 	jsa.usageMu.RUnlock()
-	reserved := int64(0)
+	reserved, memReserved := int64(0), int64(0)
 	if !isClustered {
 		reserved = jsa.tieredReservation(tier, &cfg)
+		memReserved = jsa.tieredReservation(tier, memoryHeadConfig(&cfg))
 	}
 	jsa.mu.Unlock()
 
@@ -409,11 +726,16 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 	js.mu.RLock()
 	if isClustered {
 		_, reserved = tieredStreamAndReservationCount(js.cluster.streams[a.Name], tier, &cfg)
+		_, memReserved = tieredStreamAndReservationCount(js.cluster.streams[a.Name], tier, memoryHeadConfig(&cfg))
 	}
 	if err := js.checkAllLimits(&selected, &cfg, reserved, 0); err != nil {
 		js.mu.RUnlock()
 		return nil, err
 	}
+	if err := js.checkMemoryHeadLimits(&selected, &cfg, nil, true, memReserved); err != nil {
+		js.mu.RUnlock()
+		return nil, err
+	}
 	js.mu.RUnlock()
 	jsa.mu.Lock()
 	// Check for template ownership if present.
@@ -433,7 +755,7 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 
 	// Check for overlapping subjects with other streams.
 	// These are not allowed for now.
-	if jsa.subjectsOverlap(cfg.Subjects, nil) {
+	if jsa.subjectsOverlap(cfg.ingestSubjects(), cfg.Shard, nil) {
 		jsa.mu.Unlock()
 		return nil, NewJSStreamSubjectOverlapError()
 	}
@@ -488,7 +810,27 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 		// Assign our transform for republishing.
 		mset.tr = tr
 	}
-	storeDir := filepath.Join(jsa.storeDir, streamsDir, cfg.Name)
+	if cfg.Shard != nil {
+		shard := *cfg.Shard
+		mset.shard = &shard
+	}
+	mset.setOrigin(cfg.Origin)
+	mset.setSingleWriter(cfg.SingleWriter)
+	mset.pinned.Store(cfg.Pinned)
+	mset.setAckPendingLimit(cfg.MaxAckPendingTotal)
+	mset.tombs = newStreamTombstones(cfg.Name, s.getOpts().JetStreamDomain, cfg.Tombstones)
+	mset.evicts = newStreamEvictions(cfg.Name, cfg.EvictionSubject)
+	mset.hidx = newStreamHeaderIndex(_EMPTY_)
+	mset.chunks = newStreamChunks(jsa, &cfg)
+	if cfg.Schema != nil {
+		ss, err := newStreamSchema(cfg.Schema)
+		if err != nil {
+			jsa.mu.Unlock()
+			return nil, NewJSStreamInvalidConfigError(err)
+		}
+		mset.schema = ss
+	}
+	storeDir := js.streamStoreDir(a.Name, &cfg)
 	jsa.mu.Unlock()
 
 	// Bind to the user account.
@@ -509,11 +851,33 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 	fsCfg.StoreDir = storeDir
 	fsCfg.AsyncFlush = false
 	fsCfg.SyncInterval = 2 * time.Minute
+	opts := s.getOpts()
+	if opts.JetStreamSyncAlways {
+		fsCfg.SyncAlways, fsCfg.SyncMaxDelay = true, opts.JetStreamSyncMaxDelay
+	}
+	fsCfg.Preallocate, fsCfg.DropPageCache = opts.JetStreamPreallocate, opts.JetStreamDropPageCache
 
 	if err := mset.setupStore(fsCfg); err != nil {
 		mset.stop(true, false)
 		return nil, NewJSStreamStoreFailedError(err)
 	}
+	if cfg.HeaderIndex != _EMPTY_ {
+		mset.hidx.rebuild(mset.hidx.setKey(cfg.HeaderIndex), mset.store)
+	}
+
+	// Our config as created is our first revision, unless we are recovering our revisions.
+	var ci *ClientInfo
+	if sa != nil {
+		ci = sa.Client
+	}
+	mset.mu.Lock()
+	mset.loadConfigRevisions(&cfg, ci)
+	mset.mu.Unlock()
+
+	// Tombstones of file based streams survive restarts.
+	if fs, ok := mset.store.(*fileStore); ok {
+		mset.tombs.load(filepath.Join(fs.fcfg.StoreDir, streamTombstonesFile))
+	}
 
 	// Create our pubAck template here. Better than json marshal each time on success.
 	if domain := s.getOpts().JetStreamDomain; domain != _EMPTY_ {
@@ -546,8 +910,10 @@ func (a *Account) addStreamWithAssignment(config *StreamConfig, fsConfig *FileSt
 	// Setup our internal send go routine.
 	mset.setupSendCapabilities()
 
-	// Reserve resources if MaxBytes present.
-	mset.js.reserveStreamResources(&mset.cfg)
+	// Reserve resources if MaxBytes present, unless we are the audit trail of the system account.
+	if !mset.jsa.sys {
+		mset.js.reserveStreamResources(&mset.cfg)
+	}
 
 	// Call directly to set leader if not in clustered mode.
 	// This can be called though before we actually setup clustering, so check both.
@@ -659,10 +1025,12 @@ func (mset *stream) setLeader(isLeader bool) error {
 		// Make sure we are listening for sync requests.
 		// TODO(dlc) - Original design was that all in sync members of the group would do DQ.
 		mset.startClusterSubs()
-		// Setup subscriptions
-		if err := mset.subscribeToStream(); err != nil {
-			mset.mu.Unlock()
-			return err
+		// Setup subscriptions, unless we are a standby that was not promoted yet.
+		if js := mset.js; js == nil || !js.isStandby() {
+			if err := mset.subscribeToStream(); err != nil {
+				mset.mu.Unlock()
+				return err
+			}
 		}
 	} else {
 		// Stop responding to sync requests.
@@ -671,6 +1039,8 @@ func (mset *stream) setLeader(isLeader bool) error {
 		mset.unsubscribeToStream(false)
 		// Clear catchup state
 		mset.clearAllCatchupPeers()
+		// Writers acquire the lease from the new leader.
+		mset.writer = nil
 	}
 	// Track group leader.
 	if mset.isClustered() {
@@ -678,6 +1048,12 @@ func (mset *stream) setLeader(isLeader bool) error {
 	} else {
 		mset.leader = _EMPTY_
 	}
+	mset.tombs.setLeader(isLeader, mset.outq)
+	mset.evicts.setLeader(isLeader, mset.outq)
+	if !isLeader {
+		// Only the leader receives chunks, so anything pending will never complete.
+		mset.chunks.stop()
+	}
 	mset.mu.Unlock()
 	return nil
 }
@@ -841,11 +1217,13 @@ func (mset *stream) sendCreateAdvisory() {
 	template := mset.cfg.Template
 	outq := mset.outq
 	srv := mset.srv
+	accName := mset.acc.Name
 	mset.mu.RUnlock()
 
 	if outq == nil {
 		return
 	}
+	srv.hookStreamCreated(accName, name)
 
 	// finally send an event that this stream was created
 	m := JSStreamActionAdvisory{
@@ -934,12 +1312,16 @@ func (mset *stream) setCreatedTime(created time.Time) {
 // subjectsOverlap to see if these subjects overlap with existing subjects.
 // Use only for non-clustered JetStream
 // RLock minimum should be held.
-func (jsa *jsAccount) subjectsOverlap(subjects []string, self *stream) bool {
+func (jsa *jsAccount) subjectsOverlap(subjects []string, shard *StreamShard, self *stream) bool {
 	for _, mset := range jsa.streams {
 		if self != nil && mset == self {
 			continue
 		}
-		for _, subj := range mset.cfg.Subjects {
+		// Shards of the same stream share their subjects.
+		if shard.sharesSubjects(subjects, mset.shard, mset.cfg.ingestSubjects()) {
+			continue
+		}
+		for _, subj := range mset.cfg.ingestSubjects() {
 			for _, tsubj := range subjects {
 				if SubjectsCollide(tsubj, subj) {
 					return true
@@ -1013,6 +1395,9 @@ func (s *Server) checkStreamCfg(config *StreamConfig, acc *Account) (StreamConfi
 	if cfg.MaxAge > 0 && cfg.MaxAge < 100*time.Millisecond {
 		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("max age needs to be >= 100ms"))
 	}
+	if cfg.Tombstones < 0 {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("tombstones retention can not be negative"))
+	}
 	if cfg.Duplicates < 0 {
 		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("duplicates window can not be negative"))
 	}
@@ -1032,6 +1417,17 @@ func (s *Server) checkStreamCfg(config *StreamConfig, acc *Account) (StreamConfi
 		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("roll-ups require the purge permission"))
 	}
 
+	if cfg.MaxPinned < 0 {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("max pinned can not be negative"))
+	}
+	if len(cfg.Pinned) > cfg.MaxPinned {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("pinned messages can not exceed max pinned of %d", cfg.MaxPinned))
+	}
+
+	if cfg.Replication != SyncReplication && cfg.Replication != AsyncReplication {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("replication mode is invalid"))
+	}
+
 	// Check for new discard new per subject, we require the discard policy to also be new.
 	if cfg.DiscardNewPer {
 		if cfg.Discard != DiscardNew {
@@ -1096,6 +1492,9 @@ func (s *Server) checkStreamCfg(config *StreamConfig, acc *Account) (StreamConfi
 		if len(cfg.Sources) > 0 {
 			return StreamConfig{}, NewJSMirrorWithSourcesError()
 		}
+		if cfg.MaxIngestRate != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("stream mirrors can not have an ingest rate"))
+		}
 		// We do not require other stream to exist anymore, but if we can see it check payloads.
 		exists, maxMsgSize, subs := hasStream(cfg.Mirror.Name)
 		if len(subs) > 0 {
@@ -1283,6 +1682,98 @@ func (s *Server) checkStreamCfg(config *StreamConfig, acc *Account) (StreamConfi
 		}
 	}
 
+	if len(cfg.SubjectAliases) > 0 {
+		if err := checkSubjectAliases(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	if cfg.Shard != nil {
+		if err := checkStreamShard(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	if cfg.Schema != nil {
+		if err := checkStreamSchema(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	if cfg.Shadow != nil {
+		if err := checkStreamShadow(s, &cfg, acc); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	if cfg.Remote != nil {
+		if err := checkStreamRemote(s, &cfg, acc); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	if cfg.Canary != nil {
+		if err := checkStreamCanary(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	if cfg.EvictionSubject != _EMPTY_ {
+		if err := checkStreamEvictionSubject(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	if cfg.MemoryHeadBytes != 0 {
+		if err := checkStreamMemoryHead(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	if cfg.HeaderIndex != _EMPTY_ {
+		if err := checkStreamHeaderIndex(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	if len(cfg.ConsumerTemplates) > 0 {
+		if err := checkConsumerTemplates(&cfg); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	}
+
+	if cfg.Aggregate != nil {
+		if err := checkStreamAggregate(s, &cfg, acc); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+		}
+	} else if acc == s.SystemAccount() && (cfg.Name != JSAdminAuditStream || !s.getOpts().JetStreamAudit) {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(
+			fmt.Errorf("only the audit stream is allowed in the system account"))
+	}
+
+	if err := checkStreamSingleWriter(&cfg); err != nil {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+	}
+
+	if err := checkStreamAckPendingTotal(&cfg); err != nil {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+	}
+
+	if cfg.StoreDir != _EMPTY_ {
+		if cfg.Storage != FileStorage {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("store directory requires file storage"))
+		}
+		if js := s.getJetStream(); js != nil {
+			// Store directories are configured per server, so are not consistent across peers.
+			if js.isClustered() {
+				return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("store directory not supported for clustered streams"))
+			}
+			if _, ok := js.storeDir(cfg.StoreDir); !ok {
+				return StreamConfig{}, NewJSStreamStoreDirNotFoundError()
+			}
+		}
+	}
+
 	// If we have a republish directive check if we can create a transform here.
 	if cfg.RePublish != nil {
 		// Check to make sure source is a valid subset of the subjects we have.
@@ -1326,6 +1817,91 @@ func (mset *stream) config() StreamConfig {
 	return mset.cfg
 }
 
+// Maximum number of config revisions we keep for a stream.
+const maxStreamConfigRevisions = 32
+
+// File in the stream directory where we keep the config revisions.
+const streamRevisionsFile = "revisions.inf"
+
+// StreamConfigRevision is a configuration a stream had, with when and by whom it was set.
+type StreamConfigRevision struct {
+	Revision uint64       `json:"revision"`
+	Config   StreamConfig `json:"config"`
+	Time     time.Time    `json:"time"`
+	Client   *ClientInfo  `json:"client,omitempty"`
+}
+
+// Records a new config revision, dropping the oldest ones past our maximum.
+// Lock should be held.
+func (mset *stream) addConfigRevisionLocked(cfg *StreamConfig, ci *ClientInfo) {
+	var rev uint64 = 1
+	if n := len(mset.revs); n > 0 {
+		rev = mset.revs[n-1].Revision + 1
+	}
+	mset.revs = append(mset.revs, &StreamConfigRevision{Revision: rev, Config: *cfg, Time: time.Now().UTC(), Client: ci})
+	if len(mset.revs) > maxStreamConfigRevisions {
+		mset.revs = append(mset.revs[:0], mset.revs[len(mset.revs)-maxStreamConfigRevisions:]...)
+	}
+	mset.storeConfigRevisions()
+}
+
+// Will load our config revisions, and add our config as a new revision unless it is the last one.
+// For file based streams the revisions survive restarts. In clustered mode every replica records
+// the updates as they are applied, so any of them can take over as leader.
+// Lock should be held.
+func (mset *stream) loadConfigRevisions(cfg *StreamConfig, ci *ClientInfo) {
+	if fs, ok := mset.store.(*fileStore); ok {
+		if b, err := os.ReadFile(filepath.Join(fs.fcfg.StoreDir, streamRevisionsFile)); err == nil {
+			if err := json.Unmarshal(b, &mset.revs); err != nil {
+				mset.srv.Warnf("Error loading config revisions for '%s > %s': %v", mset.acc.Name, cfg.Name, err)
+				mset.revs = nil
+			}
+		}
+	}
+	if n := len(mset.revs); n > 0 {
+		last, _ := json.Marshal(&mset.revs[n-1].Config)
+		cur, _ := json.Marshal(cfg)
+		if bytes.Equal(last, cur) {
+			return
+		}
+	}
+	mset.addConfigRevisionLocked(cfg, ci)
+}
+
+// Will persist our config revisions for file based streams.
+// Lock should be held.
+func (mset *stream) storeConfigRevisions() {
+	fs, ok := mset.store.(*fileStore)
+	if !ok {
+		return
+	}
+	b, _ := json.Marshal(mset.revs)
+	if err := os.WriteFile(filepath.Join(fs.fcfg.StoreDir, streamRevisionsFile), b, defaultFilePerms); err != nil {
+		mset.srv.Warnf("Error storing config revisions for '%s > %s': %v", mset.acc.Name, mset.cfg.Name, err)
+	}
+}
+
+// Returns a copy of the config revisions we have, oldest first.
+func (mset *stream) configRevisions() []*StreamConfigRevision {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	revs := make([]*StreamConfigRevision, len(mset.revs))
+	copy(revs, mset.revs)
+	return revs
+}
+
+// Returns the config revision requested, or nil if we no longer have it.
+func (mset *stream) configRevision(rev uint64) *StreamConfigRevision {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	for _, r := range mset.revs {
+		if r.Revision == rev {
+			return r
+		}
+	}
+	return nil
+}
+
 func (mset *stream) fileStoreConfig() (FileStoreConfig, error) {
 	mset.mu.Lock()
 	defer mset.mu.Unlock()
@@ -1386,6 +1962,20 @@ func (jsa *jsAccount) configUpdateCheck(old, new *StreamConfig, s *Server) (*Str
 	if !reflect.DeepEqual(cfg.RePublish, old.RePublish) {
 		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not change RePublish"))
 	}
+	// Moving files is up to relocating the stream, keep the store directory if not given.
+	if cfg.StoreDir == _EMPTY_ {
+		cfg.StoreDir = old.StoreDir
+	}
+	if cfg.StoreDir != old.StoreDir {
+		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not change store directory"))
+	}
+	// Shards need to stay consistent with each other.
+	if !reflect.DeepEqual(cfg.Shard, old.Shard) {
+		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not change shard"))
+	}
+	if cfg.Shard != nil && !reflect.DeepEqual(cfg.Subjects, old.Subjects) {
+		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not change subjects of a shard"))
+	}
 
 	// Check on new discard new per subject.
 	if cfg.DiscardNewPer {
@@ -1443,9 +2033,10 @@ func (jsa *jsAccount) configUpdateCheck(old, new *StreamConfig, s *Server) (*Str
 		selected, tier, hasTier = jsa.selectLimits(old)
 	}
 	jsa.usageMu.RUnlock()
-	reserved := int64(0)
+	reserved, memReserved := int64(0), int64(0)
 	if !isClustered {
 		reserved = jsa.tieredReservation(tier, &cfg)
+		memReserved = jsa.tieredReservation(tier, memoryHeadConfig(&cfg))
 	}
 	jsa.mu.RUnlock()
 	if !hasTier {
@@ -1455,12 +2046,16 @@ func (jsa *jsAccount) configUpdateCheck(old, new *StreamConfig, s *Server) (*Str
 	defer js.mu.RUnlock()
 	if isClustered {
 		_, reserved = tieredStreamAndReservationCount(js.cluster.streams[acc.Name], tier, &cfg)
+		_, memReserved = tieredStreamAndReservationCount(js.cluster.streams[acc.Name], tier, memoryHeadConfig(&cfg))
 	}
 	// reservation does not account for this stream, hence add the old value
 	reserved += int64(old.Replicas) * old.MaxBytes
 	if err := js.checkAllLimits(&selected, &cfg, reserved, maxBytesOffset); err != nil {
 		return nil, err
 	}
+	if err := js.checkMemoryHeadLimits(&selected, &cfg, old, true, memReserved); err != nil {
+		return nil, err
+	}
 	// Restore the user configured MaxBytes.
 	cfg.MaxBytes = newMaxBytes
 	return &cfg, nil
@@ -1468,11 +2063,12 @@ func (jsa *jsAccount) configUpdateCheck(old, new *StreamConfig, s *Server) (*Str
 
 // Update will allow certain configuration properties of an existing stream to be updated.
 func (mset *stream) update(config *StreamConfig) error {
-	return mset.updateWithAdvisory(config, true)
+	return mset.updateWithAdvisory(config, nil, true)
 }
 
 // Update will allow certain configuration properties of an existing stream to be updated.
-func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool) error {
+// The client info, if present, is recorded with the new config revision.
+func (mset *stream) updateWithAdvisory(config *StreamConfig, ci *ClientInfo, sendAdvisory bool) error {
 	_, jsa, err := mset.acc.checkForJetStream()
 	if err != nil {
 		return err
@@ -1481,22 +2077,28 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool)
 	mset.mu.RLock()
 	ocfg := mset.cfg
 	s := mset.srv
+	relocating := mset.relocating
 	mset.mu.RUnlock()
 
+	if relocating {
+		return errStreamRelocating
+	}
+
 	cfg, err := mset.jsa.configUpdateCheck(&ocfg, config, s)
 	if err != nil {
 		return NewJSStreamInvalidConfigError(err, Unless(err))
 	}
 
 	jsa.mu.RLock()
-	if jsa.subjectsOverlap(cfg.Subjects, mset) {
+	if jsa.subjectsOverlap(cfg.ingestSubjects(), cfg.Shard, mset) {
 		jsa.mu.RUnlock()
 		return NewJSStreamSubjectOverlapError()
 	}
 	jsa.mu.RUnlock()
 
 	mset.mu.Lock()
-	if mset.isLeader() {
+	// Subscriptions are only changed if we have them, i.e. not on a standby.
+	if mset.isLeader() && mset.active {
 		// Now check for subject interest differences.
 		current := make(map[string]struct{}, len(ocfg.Subjects))
 		for _, s := range ocfg.Subjects {
@@ -1522,6 +2124,24 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool)
 				return err
 			}
 		}
+		// Same for our subject aliases.
+		if err := mset.updateSubjectAliases(ocfg.SubjectAliases, cfg.SubjectAliases); err != nil {
+			mset.mu.Unlock()
+			return err
+		}
+		// Reconnect if our remote changed.
+		mset.updateRemote(ocfg.Remote, cfg.Remote)
+		// And capture again if our aggregate changed.
+		mset.updateAggregate(ocfg.Aggregate, cfg.Aggregate)
+		// Drop the writer lease if we are not single writer anymore.
+		if !cfg.SingleWriter {
+			mset.writer = nil
+		}
+		// Same for our canary, a new weight applies right away.
+		if err := mset.updateCanary(ocfg.Canary, cfg.Canary); err != nil {
+			mset.mu.Unlock()
+			return err
+		}
 
 		// Check for the Duplicates
 		if cfg.Duplicates != ocfg.Duplicates && mset.ddtmr != nil {
@@ -1607,16 +2227,43 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool)
 		// a subsequent update to an existing tier will then move from existing past tier to existing new tier
 	}
 
+	// Update our schema, this has been checked already.
+	mset.schema, _ = newStreamSchema(cfg.Schema)
+	mset.setOrigin(cfg.Origin)
+	mset.setSingleWriter(cfg.SingleWriter)
+	mset.pinned.Store(cfg.Pinned)
+	if len(cfg.Pinned) > 0 {
+		// Make sure the pins are of messages we have.
+		mset.checkPrunePins()
+	}
+	mset.setAckPendingLimit(cfg.MaxAckPendingTotal)
+	mset.tombs.setRetention(cfg.Tombstones)
+	mset.evicts.setSubject(cfg.EvictionSubject)
+	mset.chunks.configure(cfg)
+	var hidxGen uint64
+	if cfg.HeaderIndex != ocfg.HeaderIndex {
+		hidxGen = mset.hidx.setKey(cfg.HeaderIndex)
+	}
+
 	// Now update config and store's version of our config.
 	mset.cfg = *cfg
+	if !reflect.DeepEqual(*cfg, ocfg) {
+		mset.addConfigRevisionLocked(cfg, ci)
+	}
 
 	// If we are the leader never suppress update advisory, simply send.
 	if mset.isLeader() && sendAdvisory {
 		mset.sendUpdateAdvisoryLocked()
 	}
+	store := mset.store
 	mset.mu.Unlock()
 
-	if js != nil {
+	// Index what we have outside of our lock, this scans the store.
+	if hidxGen > 0 && cfg.HeaderIndex != _EMPTY_ {
+		mset.hidx.rebuild(hidxGen, store)
+	}
+
+	if js != nil && !mset.jsa.sys {
 		maxBytesDiff := cfg.MaxBytes - ocfg.MaxBytes
 		if maxBytesDiff > 0 {
 			// Reserve the difference
@@ -1631,6 +2278,12 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool)
 				Storage:  ocfg.Storage,
 			})
 		}
+		// Same for the memory head.
+		if headDiff := cfg.MemoryHeadBytes - ocfg.MemoryHeadBytes; headDiff > 0 {
+			js.reserveStreamResources(&StreamConfig{MemoryHeadBytes: headDiff})
+		} else if headDiff < 0 {
+			js.releaseStreamResources(&StreamConfig{MemoryHeadBytes: -headDiff})
+		}
 	}
 
 	mset.store.UpdateConfig(cfg)
@@ -1652,6 +2305,18 @@ func (mset *stream) purge(preq *JSApiStreamPurgeRequest) (purged uint64, err err
 	store := mset.store
 	mset.mu.RUnlock()
 
+	// Unfiltered purges remove a range from the front, so we can record it as a tombstone.
+	// The file store reports filtered purges as a whole, so we need to find what they removed.
+	var ofseq uint64
+	var fseqs []uint64
+	if preq == nil || preq.Subject == _EMPTY_ {
+		var state StreamState
+		store.FastState(&state)
+		ofseq = state.FirstSeq
+	} else if _, ok := store.(*fileStore); ok && (mset.tombs.enabled() || mset.hidx.enabled()) {
+		fseqs = mset.filteredSeqs(preq.Subject)
+	}
+
 	if preq != nil {
 		purged, err = mset.store.PurgeEx(preq.Subject, preq.Sequence, preq.Keep)
 	} else {
@@ -1665,6 +2330,11 @@ func (mset *stream) purge(preq *JSApiStreamPurgeRequest) (purged uint64, err err
 	var state StreamState
 	store.FastState(&state)
 	fseq, lseq := state.FirstSeq, state.LastSeq
+	if ofseq > 0 && purged > 0 && fseq > ofseq {
+		mset.recordRemoved(ofseq, fseq-1)
+	} else if len(fseqs) > 0 && purged > 0 {
+		mset.recordRemovedSeqs(fseqs)
+	}
 
 	// Check for filtered purge.
 	if preq != nil && preq.Subject != _EMPTY_ {
@@ -2069,7 +2739,7 @@ func (mset *stream) processInboundMirrorMsg(m *inMsg) bool {
 			err = node.Propose(encodeStreamMsg(m.subj, _EMPTY_, m.hdr, m.msg, sseq-1, ts))
 		}
 	} else {
-		err = mset.processJetStreamMsg(m.subj, _EMPTY_, m.hdr, m.msg, sseq-1, ts)
+		err = mset.processJetStreamMsg(m.subj, _EMPTY_, m.hdr, m.msg, sseq-1, ts, false)
 	}
 	if err != nil {
 		if strings.Contains(err.Error(), "no space left") {
@@ -2155,6 +2825,10 @@ func (mset *stream) skipMsgs(start, end uint64) {
 	if node != nil && len(entries) > 0 {
 		node.ProposeDirect(entries)
 	}
+	// Our upstream removed these, replicas record them when they apply the skips.
+	if node == nil {
+		mset.recordRemoved(start, end)
+	}
 }
 
 // This will schedule a call to setupMirrorConsumer, taking into account the last
@@ -2366,6 +3040,14 @@ func (mset *stream) setupMirrorConsumer() error {
 				mirror.err = ccr.Error
 				// Let's retry as soon as possible, but we are gated by sourceConsumerRetryThreshold
 				retry = true
+			} else if mset.checkResumeToken(mirror, ccr.ConsumerInfo.Resume) {
+				// Upstream stream was reset, so we need to start over from the beginning.
+				mset.srv.Warnf("JetStream upstream stream '%s' for mirror '%s > %s' was reset, mirroring again from the start",
+					mirror.name, mset.acc.Name, mset.cfg.Name)
+				mirror.cname = ccr.ConsumerInfo.Name
+				mset.cancelSourceInfo(mirror)
+				mset.resetMirror()
+				retry = true
 			} else {
 
 				// When an upstream stream expires messages or in general has messages that we want
@@ -2666,6 +3348,15 @@ func (mset *stream) setSourceConsumer(iname string, seq uint64, startTime time.T
 					si.err = ccr.Error
 					// Let's retry as soon as possible, but we are gated by sourceConsumerRetryThreshold
 					retry = true
+				} else if mset.checkResumeToken(si, ccr.ConsumerInfo.Resume) {
+					// Upstream stream was reset, so we need to start over from the beginning.
+					mset.srv.Warnf("JetStream upstream stream '%s' for source '%s > %s' was reset, sourcing again from the start",
+						si.name, mset.acc.Name, mset.cfg.Name)
+					si.cname = ccr.ConsumerInfo.Name
+					mset.cancelSourceInfo(si)
+					si.sseq, si.dseq, si.start = 0, 0, time.Time{}
+					seq, startTime = 1, time.Time{}
+					retry = true
 				} else {
 					if si.sseq != ccr.ConsumerInfo.Delivered.Stream {
 						si.sseq = ccr.ConsumerInfo.Delivered.Stream + 1
@@ -2863,9 +3554,9 @@ func (mset *stream) processInboundSourceMsg(si *sourceInfo, m *inMsg) bool {
 	var err error
 	// If we are clustered we need to propose this message to the underlying raft group.
 	if node != nil {
-		err = mset.processClusteredInboundMsg(m.subj, _EMPTY_, hdr, msg)
+		err = mset.processClusteredInboundMsg(m.subj, _EMPTY_, hdr, msg, true)
 	} else {
-		err = mset.processJetStreamMsg(m.subj, _EMPTY_, hdr, msg, 0, 0)
+		err = mset.processJetStreamMsg(m.subj, _EMPTY_, hdr, msg, 0, 0, true)
 	}
 
 	if err != nil {
@@ -3091,6 +3782,14 @@ func (mset *stream) subscribeToStream() error {
 			return err
 		}
 	}
+	for _, sa := range mset.cfg.SubjectAliases {
+		if err := mset.subscribeToAlias(sa); err != nil {
+			return err
+		}
+	}
+	if err := mset.subscribeToCanary(mset.cfg.Canary); err != nil {
+		return err
+	}
 	// Check if we need to setup mirroring.
 	if mset.cfg.Mirror != nil {
 		if err := mset.setupMirrorConsumer(); err != nil {
@@ -3101,6 +3800,10 @@ func (mset *stream) subscribeToStream() error {
 			return err
 		}
 	}
+	// Connect to our remote if we have one.
+	mset.startRemote(mset.cfg.Remote)
+	// Capture from other accounts if we are an aggregate.
+	mset.startAggregate(mset.cfg.Aggregate)
 	// Check for direct get access.
 	// We spin up followers for clustered streams in monitorStream().
 	if mset.cfg.AllowDirect {
@@ -3202,6 +3905,10 @@ func (mset *stream) unsubscribeToStream(stopping bool) error {
 	for _, subject := range mset.cfg.Subjects {
 		mset.unsubscribeInternal(subject)
 	}
+	for _, sa := range mset.cfg.SubjectAliases {
+		mset.unsubscribeInternal(sa.Subject)
+	}
+	mset.unsubscribeToCanary(mset.cfg.Canary)
 	if mset.mirror != nil {
 		mset.cancelSourceInfo(mset.mirror)
 		mset.mirror = nil
@@ -3210,6 +3917,8 @@ func (mset *stream) unsubscribeToStream(stopping bool) error {
 	if len(mset.sources) > 0 {
 		mset.stopSourceConsumers()
 	}
+	mset.stopRemote()
+	mset.stopAggregate()
 
 	// In case we had a direct get subscriptions.
 	if stopping {
@@ -3313,7 +4022,7 @@ func (mset *stream) setupStore(fsCfg *FileStoreConfig) error {
 		mset.store = ms
 	case FileStorage:
 		s := mset.srv
-		prf := s.jsKeyGen(mset.acc.Name)
+		prf := s.jsAccKeyGen(mset.acc.Name, mset.acc.Name)
 		if prf != nil {
 			// We are encrypted here, fill in correct cipher selection.
 			fsCfg.Cipher = s.getOpts().JetStreamCipher
@@ -3330,6 +4039,7 @@ func (mset *stream) setupStore(fsCfg *FileStoreConfig) error {
 	mset.mu.Unlock()
 
 	mset.store.RegisterStorageUpdates(mset.storeUpdates)
+	mset.store.RegisterRetentionUpdates(mset.evicts.notify)
 
 	return nil
 }
@@ -3339,6 +4049,9 @@ func (mset *stream) setupStore(fsCfg *FileStoreConfig) error {
 // for removals.
 // Lock should not be held.
 func (mset *stream) storeUpdates(md, bd int64, seq uint64, subj string) {
+	if md == -1 && seq > 0 {
+		mset.evicts.removed(seq, subj, uint64(-bd))
+	}
 	// If we have a single negative update then we will process our consumers for stream pending.
 	// Purge and Store handled separately inside individual calls.
 	if md == -1 && seq > 0 && subj != _EMPTY_ {
@@ -3349,6 +4062,10 @@ func (mset *stream) storeUpdates(md, bd int64, seq uint64, subj string) {
 			o.decStreamPending(seq, subj)
 		}
 		mset.clsMu.RUnlock()
+		mset.recordRemoved(seq, seq)
+		if mset.isPinnedSeq(seq) {
+			mset.checkPrunePins()
+		}
 	} else if md < 0 {
 		// Batch decrements we need to force consumers to re-calculate num pending.
 		mset.clsMu.RLock()
@@ -3356,6 +4073,15 @@ func (mset *stream) storeUpdates(md, bd int64, seq uint64, subj string) {
 			o.streamNumPendingLocked()
 		}
 		mset.clsMu.RUnlock()
+		if mset.hasPins() {
+			mset.checkPrunePins()
+		}
+		// Drop what is before our first sequence now from the header index.
+		if mset.hidx.enabled() {
+			var state StreamState
+			mset.store.FastState(&state)
+			mset.hidx.removeBefore(state.FirstSeq)
+		}
 	}
 
 	if mset.jsa != nil {
@@ -3547,7 +4273,7 @@ func (mset *stream) processDirectGetRequest(_ *subscription, c *client, _ *Accou
 		return
 	}
 	// Check if nothing set.
-	if req.Seq == 0 && req.LastFor == _EMPTY_ && req.NextFor == _EMPTY_ {
+	if req.Seq == 0 && req.LastFor == _EMPTY_ && req.NextFor == _EMPTY_ && req.StartTime == nil {
 		hdr := []byte("NATS/1.0 408 Empty Request\r\n\r\n")
 		mset.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
 		return
@@ -3563,6 +4289,11 @@ func (mset *stream) processDirectGetRequest(_ *subscription, c *client, _ *Accou
 		mset.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
 		return
 	}
+	if req.StartTime != nil && (req.Seq > 0 || req.LastFor != _EMPTY_) {
+		hdr := []byte("NATS/1.0 408 Bad Request\r\n\r\n")
+		mset.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+		return
+	}
 
 	inlineOk := c.kind != ROUTER && c.kind != GATEWAY && c.kind != LEAF
 	if !inlineOk {
@@ -3638,7 +4369,9 @@ func (mset *stream) getDirectRequest(req *JSApiMsgGetRequest, reply string) {
 	store, name := mset.store, mset.cfg.Name
 	mset.mu.RUnlock()
 
-	if req.Seq > 0 && req.NextFor == _EMPTY_ {
+	if req.StartTime != nil {
+		sm, err = loadMsgFromTime(store, *req.StartTime, req.NextFor, &svp)
+	} else if req.Seq > 0 && req.NextFor == _EMPTY_ {
 		sm, err = store.LoadMsg(req.Seq, &svp)
 	} else if req.NextFor != _EMPTY_ {
 		sm, _, err = store.LoadNextMsg(req.NextFor, subjectHasWildcard(req.NextFor), req.Seq, &svp)
@@ -3652,6 +4385,9 @@ func (mset *stream) getDirectRequest(req *JSApiMsgGetRequest, reply string) {
 	}
 
 	hdr := sm.hdr
+	if !req.Origin {
+		hdr = removeOriginHeader(hdr)
+	}
 	ts := time.Unix(0, sm.ts).UTC()
 
 	if len(hdr) == 0 {
@@ -3668,9 +4404,24 @@ func (mset *stream) getDirectRequest(req *JSApiMsgGetRequest, reply string) {
 }
 
 // processInboundJetStreamMsg handles processing messages bound for a stream.
-func (mset *stream) processInboundJetStreamMsg(_ *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+func (mset *stream) processInboundJetStreamMsg(_ *subscription, c *client, acc *Account, subject, reply string, rmsg []byte) {
+	// If we are a shard only process the messages that hash to us.
+	if mset.shard != nil && !mset.shard.owns(subject) {
+		return
+	}
+
 	hdr, msg := c.msgParts(rmsg)
 
+	// Hold chunks of a chunked message until we have all of them.
+	var ok bool
+	if hdr, msg, ok = mset.processChunk(reply, hdr, msg); !ok {
+		return
+	}
+
+	if mset.recordsOrigin() {
+		hdr = addOriginHeader(hdr, newMsgOrigin(c, acc))
+	}
+
 	// If we are not receiving directly from a client we should move this to another Go routine.
 	// Make sure to grab no stream or js locks.
 	if c.kind != CLIENT {
@@ -3681,9 +4432,9 @@ func (mset *stream) processInboundJetStreamMsg(_ *subscription, c *client, _ *Ac
 	// This is directly from a client so process inline.
 	// If we are clustered we need to propose this message to the underlying raft group.
 	if mset.IsClustered() {
-		mset.processClusteredInboundMsg(subject, reply, hdr, msg)
+		mset.processClusteredInboundMsg(subject, reply, hdr, msg, false)
 	} else {
-		mset.processJetStreamMsg(subject, reply, hdr, msg, 0, 0)
+		mset.processJetStreamMsg(subject, reply, hdr, msg, 0, 0, false)
 	}
 }
 
@@ -3693,7 +4444,40 @@ var (
 )
 
 // processJetStreamMsg is where we try to actually process the stream msg.
-func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte, lseq uint64, ts int64) error {
+// sendPubAck will send the pub ack after the given delay, e.g. when over our ingest rate.
+// With sync always the ack is only sent once the message is synced to disk, and the delay starts then.
+func sendPubAck(outq *jsOutQ, store StreamStore, reply string, response []byte, delay time.Duration) {
+	send := func() { outq.sendMsg(reply, response) }
+	if delay > 0 {
+		send = func() { time.AfterFunc(delay, func() { outq.sendMsg(reply, response) }) }
+	}
+	if fs, ok := store.(*fileStore); ok && fs.fcfg.SyncAlways {
+		fs.afterSync(send)
+		return
+	}
+	send()
+}
+
+func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte, lseq uint64, ts int64, sourced bool) error {
+	// The timestamp set by the publisher, if we use it.
+	var mts int64
+	// Validate messages from publishers. If clustered the leader has already checked before proposing.
+	if lseq == 0 && ts == 0 {
+		var err error
+		if hdr, err = mset.checkWriter(reply, hdr); err != nil {
+			return err
+		}
+		// Messages from our sources were validated by the stream they were stored in.
+		if !sourced {
+			if err := mset.checkSchema(subject, reply, hdr, msg); err != nil {
+				return err
+			}
+			if mts, err = mset.checkMsgTime(reply, hdr); err != nil {
+				return err
+			}
+		}
+	}
+
 	mset.mu.Lock()
 	c, s, store := mset.client, mset.srv, mset.store
 	if mset.closed || c == nil {
@@ -3714,6 +4498,7 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 	// Snapshot if we are the leader and if we can respond.
 	isLeader, isSealed := mset.isLeader(), mset.cfg.Sealed
 	canRespond := doAck && len(reply) > 0 && isLeader
+	shadow := mset.cfg.Shadow
 
 	var resp = &JSPubAckResponse{}
 
@@ -3730,6 +4515,34 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		return ApiErrors[JSStreamSealedErr]
 	}
 
+	// Bail here if we failed after repeated store errors.
+	// If clustered the leader has already checked before proposing.
+	if lseq == 0 && ts == 0 && mset.failed != nil {
+		apiErr, outq := mset.failedError(), mset.outq
+		mset.mu.Unlock()
+		if canRespond && outq != nil {
+			resp.PubAck = &PubAck{Stream: name}
+			resp.Error = apiErr
+			b, _ := json.Marshal(resp)
+			outq.sendMsg(reply, b)
+		}
+		return apiErr
+	}
+
+	// Bail here if JetStream was gracefully disabled for the account, we only retain the data.
+	// If clustered the leader has already checked before proposing.
+	if lseq == 0 && ts == 0 && jsa.isReadOnly() {
+		outq := mset.outq
+		mset.mu.Unlock()
+		if canRespond && outq != nil {
+			resp.PubAck = &PubAck{Stream: name}
+			resp.Error = NewJSAccountReadOnlyError()
+			b, _ := json.Marshal(resp)
+			outq.sendMsg(reply, b)
+		}
+		return NewJSAccountReadOnlyError()
+	}
+
 	var buf [256]byte
 	pubAck := append(buf[:0], mset.pubAck...)
 
@@ -3805,7 +4618,8 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 				if canRespond {
 					response := append(pubAck, strconv.FormatUint(dde.seq, 10)...)
 					response = append(response, ",\"duplicate\": true}"...)
-					outq.sendMsg(reply, response)
+					// The original may not be synced yet.
+					sendPubAck(outq, store, reply, response, 0)
 				}
 				return errMsgIdDuplicate
 			}
@@ -3924,11 +4738,33 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		return ErrMaxPayload
 	}
 
+	// Check our ingest rate. If clustered the leader has already checked before proposing,
+	// unless we delay acks which is done here by the leader when responding.
+	var ackDelay time.Duration
+	if ir := mset.cfg.MaxIngestRate; ir != nil && !sourced {
+		if ir.Delay && canRespond {
+			ackDelay = mset.checkIngestRate(uint64(len(hdr) + len(msg)))
+		} else if !ir.Delay && lseq == 0 && ts == 0 {
+			if mset.checkIngestRate(uint64(len(hdr)+len(msg))) > 0 {
+				mset.clfs++
+				mset.mu.Unlock()
+				if canRespond {
+					resp.PubAck = &PubAck{Stream: name}
+					resp.Error = NewJSStreamIngestThrottledError()
+					response, _ = json.Marshal(resp)
+					mset.outq.sendMsg(reply, response)
+				}
+				return NewJSStreamIngestThrottledError()
+			}
+		}
+	}
+
 	// Check to see if we have exceeded our limits.
 	if js.limitsExceeded(stype) {
 		s.resourcesExeededError()
 		mset.clfs++
 		mset.mu.Unlock()
+		s.hookLimitExceeded(accName, name, NewJSInsufficientResourcesError())
 		if canRespond {
 			resp.PubAck = &PubAck{Stream: name}
 			resp.Error = NewJSInsufficientResourcesError()
@@ -4013,7 +4849,12 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 	}
 
 	// Store actual msg.
-	if lseq == 0 && ts == 0 {
+	if lseq == 0 && ts == 0 && mts > 0 {
+		var state StreamState
+		store.FastState(&state)
+		seq, ts = state.LastSeq+1, nextMsgTimestamp(mts, state.LastTime)
+		err = store.StoreRawMsg(subject, hdr, msg, seq, ts)
+	} else if lseq == 0 && ts == 0 {
 		seq, ts, err = store.StoreMsg(subject, hdr, msg)
 	} else {
 		// Make sure to take into account any message assignments that we had to skip (clfs).
@@ -4040,9 +4881,13 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		switch err {
 		case ErrMaxMsgs, ErrMaxBytes, ErrMaxMsgsPerSubject, ErrMsgTooLarge:
 			s.Debugf("JetStream failed to store a msg on stream '%s > %s': %v", accName, name, err)
+			s.hookLimitExceeded(accName, name, err)
 		case ErrStoreClosed:
 		default:
 			s.Errorf("JetStream failed to store a msg on stream '%s > %s': %v", accName, name, err)
+			if !isClusterResetErr(err) {
+				mset.storeFailed(err)
+			}
 		}
 
 		if canRespond {
@@ -4054,6 +4899,10 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		return err
 	}
 
+	// Stored fine, so reset our count of store errors in a row.
+	mset.serrs = 0
+	mset.hidx.add(seq, hdr)
+
 	if exceeded, apiErr := jsa.limitsExceeded(stype, tierName); exceeded {
 		s.RateLimitWarnf("JetStream resource limits exceeded for account: %q", accName)
 		if canRespond {
@@ -4073,6 +4922,10 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		mset.lmsgId = olmsgId
 		mset.mu.Unlock()
 		store.RemoveMsg(seq)
+		if apiErr == nil {
+			apiErr = NewJSAccountResourcesExceededError()
+		}
+		s.hookLimitExceeded(accName, name, apiErr)
 		return nil
 	}
 
@@ -4081,8 +4934,16 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		mset.storeMsgIdLocked(&ddentry{msgId, seq, ts})
 	}
 
+	// Track what we have ingested for storage forecasts.
+	if stype == MemoryStorage {
+		mset.ibytes += memStoreMsgSize(subject, hdr, msg)
+	} else {
+		mset.ibytes += fileStoreMsgSize(subject, hdr, msg)
+	}
+
 	// If here we succeeded in storing the message.
 	mset.mu.Unlock()
+	s.hookMsgStored(accName, name, subject, seq)
 
 	// No errors, this is the normal path.
 	if rollupSub {
@@ -4091,9 +4952,15 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 		mset.purge(&JSApiStreamPurgeRequest{Keep: 1})
 	}
 
+	// Forward a sample to our shadow.
+	if shadow != nil && isLeader {
+		mset.shadowMsg(shadow, name, subject, hdr, msg, seq)
+	}
+
 	// Check for republish.
 	if republish {
 		var rpMsg []byte
+		hdr = removeOriginHeader(hdr)
 		if len(hdr) == 0 {
 			const ht = "NATS/1.0\r\nNats-Stream: %s\r\nNats-Subject: %s\r\nNats-Sequence: %d\r\nNats-Last-Sequence: %d\r\n\r\n"
 			const htho = "NATS/1.0\r\nNats-Stream: %s\r\nNats-Subject: %s\r\nNats-Sequence: %d\r\nNats-Last-Sequence: %d\r\nNats-Msg-Size: %d\r\n\r\n"
@@ -4122,7 +4989,8 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 	if canRespond {
 		response = append(pubAck, strconv.FormatUint(seq, 10)...)
 		response = append(response, '}')
-		mset.outq.sendMsg(reply, response)
+		mset.trackPubAck(ts)
+		sendPubAck(mset.outq, store, reply, response, ackDelay)
 	}
 
 	// Signal consumers for new messages.
@@ -4137,6 +5005,48 @@ func (mset *stream) processJetStreamMsg(subject, reply string, hdr, msg []byte,
 	return nil
 }
 
+// Records the latency of a pub ack for a message received or proposed at ts.
+func (mset *stream) trackPubAck(ts int64) {
+	atomic.AddUint64(&mset.packs, 1)
+	atomic.AddInt64(&mset.packLat, time.Now().UnixNano()-ts)
+}
+
+// Returns the pub ack stats, nil if we have not acked any publishers.
+func (mset *stream) pubAckStats() *PubAckStats {
+	acks := atomic.LoadUint64(&mset.packs)
+	if acks == 0 {
+		return nil
+	}
+	return &PubAckStats{Acks: acks, AvgLatency: time.Duration(atomic.LoadInt64(&mset.packLat) / int64(acks))}
+}
+
+// Will check and account for a message of the given size against our ingest rate.
+// Returns how long until the current window ends if the message is over the rate.
+// When rejecting messages over the rate they are not counted.
+// Lock should be held.
+func (mset *stream) checkIngestRate(size uint64) time.Duration {
+	ir := mset.cfg.MaxIngestRate
+	if ir == nil {
+		return 0
+	}
+	now := time.Now()
+	if now.After(mset.irend) {
+		mset.irmsgs, mset.irbytes = 0, 0
+		mset.irend = now.Add(time.Second)
+	}
+	// Always allow at least one message per window so large messages are not rejected forever.
+	over := mset.irmsgs > 0 && ((ir.Msgs > 0 && mset.irmsgs+1 > ir.Msgs) || (ir.Bytes > 0 && mset.irbytes+size > ir.Bytes))
+	if over && !ir.Delay {
+		return mset.irend.Sub(now)
+	}
+	mset.irmsgs++
+	mset.irbytes += size
+	if over {
+		return mset.irend.Sub(now)
+	}
+	return 0
+}
+
 // Used to signal inbound message to registered consumers.
 type cMsg struct {
 	seq  uint64
@@ -4372,6 +5282,9 @@ func (mset *stream) internalLoop() {
 				c.pa.size = len(pm.msg) + len(pm.hdr)
 				c.pa.szb = []byte(strconv.Itoa(c.pa.size))
 				c.pa.reply = []byte(pm.reply)
+				if pm.o != nil {
+					c.pa.qkey = pm.o.deliverGroupKey(pm.subj)
+				}
 
 				// If we have an underlying buf that is the wire contents for hdr + msg, else construct on the fly.
 				var msg []byte
@@ -4402,7 +5315,7 @@ func (mset *stream) internalLoop() {
 				msg = append(msg, _CRLF_...)
 
 				didDeliver, _ := c.processInboundClientMsg(msg)
-				c.pa.szb, c.pa.subject, c.pa.deliver = nil, nil, nil
+				c.pa.szb, c.pa.subject, c.pa.deliver, c.pa.qkey = nil, nil, nil, nil
 
 				// Check to see if this is a delivery for a consumer and
 				// we failed to deliver the message. If so alert the consumer.
@@ -4421,9 +5334,9 @@ func (mset *stream) internalLoop() {
 			for _, im := range ims {
 				// If we are clustered we need to propose this message to the underlying raft group.
 				if isClustered {
-					mset.processClusteredInboundMsg(im.subj, im.rply, im.hdr, im.msg)
+					mset.processClusteredInboundMsg(im.subj, im.rply, im.hdr, im.msg, false)
 				} else {
-					mset.processJetStreamMsg(im.subj, im.rply, im.hdr, im.msg, 0, 0)
+					mset.processJetStreamMsg(im.subj, im.rply, im.hdr, im.msg, 0, 0, false)
 				}
 			}
 			msgs.recycle(&ims)
@@ -4466,6 +5379,12 @@ func (mset *stream) delete() error {
 	if mset == nil {
 		return nil
 	}
+	mset.mu.RLock()
+	relocating := mset.relocating
+	mset.mu.RUnlock()
+	if relocating {
+		return errStreamRelocating
+	}
 	return mset.stop(true, true)
 }
 
@@ -4488,6 +5407,9 @@ func (mset *stream) stop(deleteFlag, advisory bool) error {
 	// Clean up consumers.
 	mset.mu.Lock()
 	mset.closed = true
+	mset.chunks.stop()
+	mset.tombs.stop(!deleteFlag)
+	mset.evicts.stop()
 	var obs []*consumer
 	for _, o := range mset.consumers {
 		obs = append(obs, o)
@@ -4588,6 +5510,10 @@ func (mset *stream) stop(deleteFlag, advisory bool) error {
 	// Clustered cleanup.
 	mset.mu.Unlock()
 
+	if deleteFlag && advisory {
+		mset.srv.hookStreamDeleted(accName, mset.cfg.Name)
+	}
+
 	// Check if the stream assignment has the group node specified.
 	// We need this cleared for if the stream gets reassigned here.
 	if sa != nil {
@@ -4612,13 +5538,12 @@ func (mset *stream) stop(deleteFlag, advisory bool) error {
 		if err := store.Delete(); err != nil {
 			return err
 		}
-		js.releaseStreamResources(&mset.cfg)
+		if !jsa.sys {
+			js.releaseStreamResources(&mset.cfg)
+		}
 
 		// cleanup directories after the stream
-		accDir := filepath.Join(js.config.StoreDir, accName)
-		// no op if not empty
-		os.Remove(filepath.Join(accDir, streamsDir))
-		os.Remove(accDir)
+		js.removeEmptyStreamsDirs(accName)
 	} else if err := store.Stop(); err != nil {
 		return err
 	}
@@ -4668,6 +5593,29 @@ func (mset *stream) getPublicConsumers() []*consumer {
 	return obs
 }
 
+// Returns the public consumers whose filter subject overlaps with the given filter.
+func (mset *stream) filteredConsumers(filter string) []*consumer {
+	obs := mset.getPublicConsumers()
+	if filter == _EMPTY_ {
+		return obs
+	}
+	fobs := obs[:0]
+	for _, o := range obs {
+		o.mu.RLock()
+		match := consumerFilterMatches(&o.cfg, filter)
+		o.mu.RUnlock()
+		if match {
+			fobs = append(fobs, o)
+		}
+	}
+	return fobs
+}
+
+// Returns true if the consumer could receive messages on subjects matching filter.
+func consumerFilterMatches(cfg *ConsumerConfig, filter string) bool {
+	return cfg.FilterSubject == _EMPTY_ || SubjectsCollide(cfg.FilterSubject, filter)
+}
+
 func (mset *stream) isInterestRetention() bool {
 	mset.mu.RLock()
 	defer mset.mu.RUnlock()
@@ -4839,16 +5787,46 @@ func (mset *stream) Store() StreamStore {
 // Determines if the new proposed partition is unique amongst all consumers.
 // Lock should be held.
 func (mset *stream) partitionUnique(partition string) bool {
-	for _, o := range mset.consumers {
-		if o.cfg.FilterSubject == _EMPTY_ {
-			return false
-		}
-		if subjectIsSubsetMatch(partition, o.cfg.FilterSubject) ||
+	return len(mset.partitionOverlaps(partition)) == 0
+}
+
+// Returns the names of the consumers whose partitions overlap with the proposed partition.
+// An empty partition overlaps with all consumers.
+// Lock should be held.
+func (mset *stream) partitionOverlaps(partition string) []string {
+	var names []string
+	for name, o := range mset.consumers {
+		if partition == _EMPTY_ || o.cfg.FilterSubject == _EMPTY_ ||
+			subjectIsSubsetMatch(partition, o.cfg.FilterSubject) ||
 			subjectIsSubsetMatch(o.cfg.FilterSubject, partition) {
-			return false
+			names = append(names, name)
 		}
 	}
-	return true
+	return names
+}
+
+// checkFilter returns the stream subjects, including those from our sources and mirror, that the
+// proposed consumer filter matches. If we are a WorkQueue stream, also returns the consumers whose
+// partitions overlap with it. An empty filter matches all subjects.
+func (mset *stream) checkFilter(filter string) (subjects []string, hasExt bool, overlaps []string) {
+	mset.mu.RLock()
+	cfg, acc := mset.cfg, mset.acc
+	if cfg.Retention == WorkQueuePolicy {
+		overlaps = mset.partitionOverlaps(filter)
+		sort.Strings(overlaps)
+	}
+	mset.mu.RUnlock()
+
+	all, hasExt := gatherSourceMirrorSubjects(copyStrings(cfg.Subjects), &cfg, acc)
+	if filter == _EMPTY_ {
+		subjects = all
+	} else {
+		subjects = filteredSubjectMatches(filter, all)
+	}
+	if subjects == nil {
+		subjects = []string{}
+	}
+	return subjects, hasExt, overlaps
 }
 
 // Lock should be held.
@@ -5023,13 +6001,16 @@ func (mset *stream) ackMsg(o *consumer, seq uint64) {
 	}
 
 	var shouldRemove bool
+	var reason RetentionReason
 	switch mset.cfg.Retention {
 	case WorkQueuePolicy:
 		// Normally we just remove a message when its ack'd here but if we have direct consumers
 		// from sources and/or mirrors we need to make sure they have delivered the msg.
 		shouldRemove = mset.directs <= 0 || mset.noInterest(seq, o)
+		reason = RetentionWorkQueue
 	case InterestPolicy:
 		shouldRemove = mset.noInterest(seq, o)
+		reason = RetentionInterest
 	}
 	mset.mu.Unlock()
 
@@ -5039,10 +6020,22 @@ func (mset *stream) ackMsg(o *consumer, seq uint64) {
 	}
 
 	// If we are here we should attempt to remove.
-	if _, err := mset.store.RemoveMsg(seq); err == ErrStoreEOF {
+	mset.removeMsgViaRetention(seq, reason, o)
+}
+
+// removeMsgViaRetention removes a message consumed under interest or work queue retention.
+// The eviction is reported from our store updates once the store has removed it.
+// Lock should not be held.
+func (mset *stream) removeMsgViaRetention(seq uint64, reason RetentionReason, o *consumer) {
+	marked := mset.evicts.mark(seq, reason)
+	removed, err := mset.store.RemoveMsg(seq)
+	if err == ErrStoreEOF && o != nil {
 		// This should not happen, but being pedantic.
 		mset.registerPreAckLock(o, seq)
 	}
+	if marked && !removed {
+		mset.evicts.unmark(seq)
+	}
 }
 
 // Snapshot creates a snapshot for the stream and possibly consumers.
@@ -5153,17 +6146,17 @@ func (a *Account) RestoreStream(ncfg *StreamConfig, r io.Reader) (*stream, error
 		return nil, NewJSStreamNameExistRestoreFailedError()
 	}
 	// Move into the correct place here.
-	ndir := filepath.Join(jsa.storeDir, streamsDir, cfg.Name)
+	ndir := jsa.js.streamStoreDir(a.Name, &cfg)
 	// Remove old one if for some reason it is still here.
 	if _, err := os.Stat(ndir); err == nil {
 		os.RemoveAll(ndir)
 	}
 	// Make sure our destination streams directory exists.
-	if err := os.MkdirAll(filepath.Join(jsa.storeDir, streamsDir), defaultDirPerms); err != nil {
+	if err := os.MkdirAll(filepath.Dir(ndir), defaultDirPerms); err != nil {
 		return nil, err
 	}
-	// Move into new location.
-	if err := os.Rename(sdir, ndir); err != nil {
+	// Move into new location, which can be in another file system.
+	if err := moveDir(sdir, ndir); err != nil {
 		return nil, err
 	}
 
@@ -5295,3 +6288,111 @@ func (mset *stream) clearMonitorRunning() {
 	defer mset.mu.Unlock()
 	mset.inMonitor = false
 }
+
+// storeBatch will store the messages of the batch, on a best effort basis. This is not
+// atomic: streams are resolved up front, and if storing any message fails the messages
+// already stored for this batch are removed again. Consumers may observe
+// those messages before they are removed, and messages that can not be removed
+// are reported in the error.
+// Only supported for non-clustered streams.
+func (a *Account) storeBatch(id string, msgs []*JSApiBatchMsg) ([]*PubAck, *ApiError) {
+	streams := a.streams()
+	msets := make([]*stream, len(msgs))
+	for i, m := range msgs {
+		if !IsValidLiteralSubject(m.Subject) {
+			return nil, NewJSStreamBatchFailedError(fmt.Errorf("message %d has invalid subject %q", i, m.Subject))
+		}
+		if len(m.Header) > 0 && (!bytes.HasPrefix(m.Header, []byte(hdrLine[:len(hdrLine)-LEN_CR_LF])) || !bytes.HasSuffix(m.Header, []byte(_CRLF_+_CRLF_))) {
+			return nil, NewJSStreamBatchFailedError(fmt.Errorf("message %d has invalid header", i))
+		}
+		for _, mset := range streams {
+			if mset.subjectMatches(m.Subject) {
+				msets[i] = mset
+				break
+			}
+		}
+		mset := msets[i]
+		if mset == nil {
+			return nil, NewJSStreamBatchFailedError(fmt.Errorf("no stream matches subject %q", m.Subject))
+		}
+		if mset.isClustered() {
+			return nil, NewJSClusterUnSupportFeatureError()
+		}
+	}
+
+	type batchEntry struct {
+		mset *stream
+		seq  uint64
+	}
+	var stored []batchEntry
+	fail := func(err error) ([]*PubAck, *ApiError) {
+		var kept []string
+		for i := len(stored) - 1; i >= 0; i-- {
+			e := stored[i]
+			if removed, rerr := e.mset.removeMsg(e.seq); !removed || rerr != nil {
+				kept = append(kept, fmt.Sprintf("%s:%d", e.mset.name(), e.seq))
+			}
+		}
+		if len(kept) > 0 {
+			err = fmt.Errorf("%v, messages not removed: %s", err, strings.Join(kept, ", "))
+		}
+		return nil, NewJSStreamBatchFailedError(err)
+	}
+
+	acks := make([]*PubAck, 0, len(msgs))
+	last := make(map[*stream]uint64)
+	for i, m := range msgs {
+		mset := msets[i]
+		start, ok := last[mset]
+		if !ok {
+			start = mset.lastSeq()
+		}
+		hdr := genHeader(removeHeaderIfPresent(copyBytes(m.Header), JSBatchId), JSBatchId, id)
+		if err := mset.processJetStreamMsg(m.Subject, _EMPTY_, hdr, m.Data, 0, 0, false); err != nil {
+			return fail(fmt.Errorf("message %d: %v", i, err))
+		}
+		// Other publishers may have stored messages since, so find ours.
+		seq := mset.findBatchMsg(start, m.Subject, id)
+		if seq == 0 {
+			return fail(fmt.Errorf("message %d was not stored", i))
+		}
+		last[mset] = seq
+		stored = append(stored, batchEntry{mset, seq})
+		acks = append(acks, &PubAck{Stream: mset.name(), Sequence: seq, Domain: mset.srv.getOpts().JetStreamDomain})
+	}
+	return acks, nil
+}
+
+// Returns true if the subject is one of ours.
+func (mset *stream) subjectMatches(subject string) bool {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if mset.cfg.Mirror != nil {
+		return false
+	}
+	if len(mset.cfg.Subjects) == 0 {
+		return subject == mset.cfg.Name
+	}
+	for _, subj := range mset.cfg.Subjects {
+		if subjectIsSubsetMatch(subject, subj) {
+			return true
+		}
+	}
+	return false
+}
+
+// findBatchMsg will find the first message after start for the given subject and batch.
+// Only messages on the subject are loaded, using the subject index of the store.
+func (mset *stream) findBatchMsg(start uint64, subject, id string) uint64 {
+	var smv StoreMsg
+	for seq := start + 1; ; {
+		sm, _, err := mset.store.LoadNextMsg(subject, false, seq, &smv)
+		if err != nil {
+			return 0
+		}
+		if string(getHeader(JSBatchId, sm.hdr)) == id {
+			return sm.seq
+		}
+		seq = sm.seq + 1
+	}
+}
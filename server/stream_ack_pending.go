@@ -0,0 +1,146 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// checkStreamAckPendingTotal will make sure the ack pending limit of a stream is valid.
+func checkStreamAckPendingTotal(cfg *StreamConfig) error {
+	if cfg.MaxAckPendingTotal < 0 {
+		return errors.New("max ack pending total can not be negative")
+	}
+	return nil
+}
+
+// setAckPendingLimit will set the limit of unacknowledged messages of all our consumers.
+// If raised or removed, consumers we paused can deliver again.
+func (mset *stream) setAckPendingLimit(limit int) {
+	atomic.StoreInt64(&mset.apmax, int64(limit))
+	mset.checkAckPendingReleased()
+}
+
+// ackPendingLimit returns the limit of unacknowledged messages of all our consumers, zero if unlimited.
+// Does not grab the stream lock since called from the delivery path.
+func (mset *stream) ackPendingLimit() int64 {
+	return atomic.LoadInt64(&mset.apmax)
+}
+
+// checkAckPendingReached will check if our consumers reached our ack pending limit.
+// Sends an advisory when first reached.
+func (mset *stream) checkAckPendingReached() bool {
+	limit, pending := mset.ackPendingLimit(), atomic.LoadInt64(&mset.apend)
+	if limit <= 0 || pending < limit {
+		return false
+	}
+	if atomic.CompareAndSwapInt32(&mset.apx, 0, 1) {
+		// Can be called with a consumer's lock held.
+		go mset.sendAckPendingAdvisory(true, pending, limit)
+	}
+	return true
+}
+
+// checkAckPendingReleased will check if our consumers dropped below our ack pending limit
+// after reaching it, in which case we signal them to deliver again and send an advisory.
+func (mset *stream) checkAckPendingReleased() {
+	if atomic.LoadInt32(&mset.apx) == 0 {
+		return
+	}
+	limit, pending := mset.ackPendingLimit(), atomic.LoadInt64(&mset.apend)
+	if limit > 0 && pending >= limit {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&mset.apx, 1, 0) {
+		// Can be called with a consumer's lock held.
+		go func() {
+			mset.sendAckPendingAdvisory(false, pending, limit)
+			for _, o := range mset.getConsumers() {
+				o.signalNewMessages()
+			}
+		}()
+	}
+}
+
+func (mset *stream) sendAckPendingAdvisory(reached bool, pending, limit int64) {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if mset.outq == nil || mset.closed {
+		return
+	}
+	m := JSStreamAckPendingAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamAckPendingAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:  mset.cfg.Name,
+		Pending: pending,
+		Limit:   limit,
+		Reached: reached,
+		Domain:  mset.srv.getOpts().JetStreamDomain,
+	}
+	if j, err := json.Marshal(m); err == nil {
+		mset.outq.sendMsg(JSAdvisoryStreamAckPendingPre+"."+mset.cfg.Name, j)
+	}
+}
+
+// updateStreamAckPending will update our stream's total with our current ack pending.
+// Lock should be held.
+func (o *consumer) updateStreamAckPending() {
+	mset := o.mset
+	if mset == nil {
+		return
+	}
+	if np := len(o.pending); np != o.sapend {
+		atomic.AddInt64(&mset.apend, int64(np-o.sapend))
+		if np < o.sapend {
+			defer mset.checkAckPendingReleased()
+		}
+		o.sapend = np
+	}
+}
+
+// releaseStreamAckPending will remove our ack pending from our stream's total.
+// Lock should be held.
+func (o *consumer) releaseStreamAckPending() {
+	if o.sapend != 0 && o.mset != nil {
+		atomic.AddInt64(&o.mset.apend, int64(-o.sapend))
+		o.mset.checkAckPendingReleased()
+	}
+	o.sapend = 0
+}
+
+// tracksStreamAckPending returns true if our stream limits the ack pending of its consumers,
+// or we still have ack pending added to its total.
+// Lock should be held.
+func (o *consumer) tracksStreamAckPending() bool {
+	return o.sapend != 0 || o.mset != nil && o.mset.ackPendingLimit() > 0
+}
+
+// streamAckPendingExceeded returns true if all consumers of our stream together reached
+// its ack pending limit, in which case we should not deliver new messages.
+// Lock should be held.
+func (o *consumer) streamAckPendingExceeded() bool {
+	if o.mset == nil || o.cfg.AckPolicy == AckNone {
+		return false
+	}
+	o.updateStreamAckPending()
+	return o.mset.checkAckPendingReached()
+}
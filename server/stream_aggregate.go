@@ -0,0 +1,268 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// AccountAggregate is the opt-in of an account to have its messages captured by the aggregate
+// streams of the aggregate account, e.g. for a central audit log of a hosted deployment.
+type AccountAggregate struct {
+	// Subjects of the account that can be captured.
+	Subjects []string
+	// Whether the JetStream advisories of the account can be captured.
+	Advisories bool
+}
+
+// subjects returns all subjects that can be captured.
+func (aa *AccountAggregate) subjects() []string {
+	subjects := append([]string(nil), aa.Subjects...)
+	if aa.Advisories {
+		subjects = append(subjects, JSAdvisoryPrefix+".>")
+	}
+	return subjects
+}
+
+// StreamAggregate captures the messages of the accounts that opted in, only for streams of the
+// aggregate account configured for the server. Messages are stored with their subject prefixed
+// by the name of the account.
+type StreamAggregate struct {
+	// Accounts to capture from, all accounts that opted in if empty.
+	Accounts []string `json:"accounts,omitempty"`
+	// Only capture opted in subjects that match one of these, all of them if empty.
+	Subjects []string `json:"subjects,omitempty"`
+}
+
+func validateJetStreamAggregates(o *Options) error {
+	name := o.JetStreamAggregateAccount
+	if name == _EMPTY_ {
+		return nil
+	}
+	sacc := DEFAULT_SYSTEM_ACCOUNT
+	if o.SystemAccount != _EMPTY_ {
+		sacc = o.SystemAccount
+	}
+	if name == sacc {
+		return fmt.Errorf("jetstream aggregate account can not be the system account %q", name)
+	}
+	if len(o.TrustedOperators) > 0 {
+		return nil
+	}
+	for _, acc := range o.Accounts {
+		if acc.GetName() == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("jetstream aggregate account %q does not exist", name)
+}
+
+// storedSubjects returns the subjects captured messages are stored with.
+func (sa *StreamAggregate) storedSubjects() []string {
+	// Captured account names are not known upfront, and may contain separators.
+	if len(sa.Accounts) == 0 {
+		return []string{pwcs + tsep + fwcs}
+	}
+	subjects := sa.Subjects
+	if len(subjects) == 0 {
+		subjects = []string{fwcs}
+	}
+	var stored []string
+	for _, name := range sa.Accounts {
+		for _, subj := range subjects {
+			stored = append(stored, name+tsep+subj)
+		}
+	}
+	return stored
+}
+
+// Check the aggregate config for a stream.
+func checkStreamAggregate(s *Server, cfg *StreamConfig, acc *Account) error {
+	if name := s.getOpts().JetStreamAggregateAccount; name == _EMPTY_ || acc.Name != name {
+		return errors.New("aggregate streams are only allowed in the aggregate account")
+	}
+	if cfg.Mirror != nil {
+		return errors.New("stream aggregate not allowed on mirror")
+	}
+	for _, name := range cfg.Aggregate.Accounts {
+		if !IsValidLiteralSubject(name) || !isValidName(name) {
+			return fmt.Errorf("stream aggregate account %q is invalid", name)
+		}
+		if name == acc.Name {
+			return errors.New("stream aggregate can not capture from its own account")
+		}
+		if sacc := s.SystemAccount(); sacc != nil && name == sacc.Name {
+			return errors.New("stream aggregate can not capture from the system account")
+		}
+	}
+	for _, subj := range cfg.Aggregate.Subjects {
+		if !IsValidSubject(subj) {
+			return fmt.Errorf("stream aggregate subject %q is invalid", subj)
+		}
+	}
+	return nil
+}
+
+// streamAggregate holds the internal clients of a stream leader in the accounts it captures from.
+type streamAggregate struct {
+	cfg     StreamAggregate
+	clients map[string]*client
+}
+
+// startAggregate will subscribe to the opted in subjects of all accounts we capture from.
+// Lock should be held.
+func (mset *stream) startAggregate(cfg *StreamAggregate) {
+	if cfg == nil || mset.aggregate != nil {
+		return
+	}
+	s := mset.srv
+	mset.aggregate = &streamAggregate{cfg: *cfg, clients: make(map[string]*client)}
+
+	var accounts []*Account
+	s.accounts.Range(func(k, v interface{}) bool {
+		accounts = append(accounts, v.(*Account))
+		return true
+	})
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+	for _, acc := range accounts {
+		mset.captureAccount(acc)
+	}
+}
+
+// captureAccount will subscribe to the opted in subjects of the account, if we capture from it.
+// Lock should be held.
+func (mset *stream) captureAccount(acc *Account) {
+	ag, s := mset.aggregate, mset.srv
+	if ag == nil || acc == mset.acc || acc == s.SystemAccount() || ag.clients[acc.Name] != nil {
+		return
+	}
+	if len(ag.cfg.Accounts) > 0 && !aggregatesAccount(ag.cfg.Accounts, acc.Name) {
+		return
+	}
+	subjects := acc.aggregateSubjects()
+	if subjects == nil {
+		return
+	}
+	c := s.createInternalJetStreamClient()
+	c.registerWithAccount(acc)
+	ag.clients[acc.Name] = c
+	prefix := acc.Name + tsep
+	for i, subj := range subjects {
+		cb := func(_ *subscription, pc *client, pacc *Account, subject, _ string, rmsg []byte) {
+			mset.processAggregateMsg(ag, prefix, pc, pacc, subject, rmsg)
+		}
+		if _, err := c.processSub([]byte(subj), nil, []byte(strconv.Itoa(i+1)), cb, false); err != nil {
+			s.Warnf("JetStream stream '%s > %s' could not capture %q from account %q: %v",
+				mset.acc.Name, mset.cfg.Name, subj, acc.Name, err)
+		}
+	}
+}
+
+// captureAggregateAccount will have the aggregate streams we lead capture from an account
+// registered after they started.
+func (s *Server) captureAggregateAccount(acc *Account) {
+	name := s.getOpts().JetStreamAggregateAccount
+	if name == _EMPTY_ || acc.Name == name || acc.aggregateSubjects() == nil || s.getJetStream() == nil {
+		return
+	}
+	v, ok := s.accounts.Load(name)
+	if !ok {
+		return
+	}
+	for _, mset := range v.(*Account).streams() {
+		mset.mu.Lock()
+		mset.captureAccount(acc)
+		mset.mu.Unlock()
+	}
+}
+
+// captureAggregateAccounts will have the aggregate streams we lead capture from all accounts
+// they did not capture from yet, e.g. after accounts were added with a reload.
+func (s *Server) captureAggregateAccounts() {
+	s.accounts.Range(func(_, v interface{}) bool {
+		s.captureAggregateAccount(v.(*Account))
+		return true
+	})
+}
+
+// stopAggregate will stop capturing from other accounts.
+// Lock should be held.
+func (mset *stream) stopAggregate() {
+	if ag := mset.aggregate; ag != nil {
+		mset.aggregate = nil
+		for _, c := range ag.clients {
+			c.closeConnection(ClientClosed)
+		}
+	}
+}
+
+// updateAggregate will capture again if the aggregate config changed.
+// Lock should be held.
+func (mset *stream) updateAggregate(old, new *StreamAggregate) {
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+	mset.stopAggregate()
+	mset.startAggregate(new)
+}
+
+// processAggregateMsg will store a message captured from another account.
+func (mset *stream) processAggregateMsg(ag *streamAggregate, prefix string, c *client, acc *Account, subject string, rmsg []byte) {
+	mset.mu.RLock()
+	current := mset.aggregate == ag
+	mset.mu.RUnlock()
+	if !current {
+		return
+	}
+	if len(ag.cfg.Subjects) > 0 {
+		var match bool
+		for _, filter := range ag.cfg.Subjects {
+			if subjectIsSubsetMatch(subject, filter) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return
+		}
+	}
+	hdr, msg := c.msgParts(rmsg)
+	if mset.recordsOrigin() {
+		hdr = addOriginHeader(hdr, newMsgOrigin(c, acc))
+	}
+	mset.queueInboundMsg(prefix+subject, _EMPTY_, hdr, msg)
+}
+
+func aggregatesAccount(accounts []string, name string) bool {
+	for _, a := range accounts {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregateSubjects returns the subjects we opted in to have captured, nil if we did not.
+func (a *Account) aggregateSubjects() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.aggregate == nil {
+		return nil
+	}
+	return a.aggregate.subjects()
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SubjectAlias is an additional subject a stream ingests messages from, next to its subjects.
+// This allows producers to move to a new subject naming scheme gradually. Aliases can be
+// added and removed with a stream update.
+type SubjectAlias struct {
+	Subject string `json:"subject"`
+	// Optional transform of the subject messages are stored with, e.g. "orders.$1" for "legacy.orders.*".
+	// It has to fall within the subjects of the stream. Without it messages are stored with the
+	// subject they were published to.
+	Destination string `json:"dest,omitempty"`
+}
+
+// ingestSubjects returns all subjects the stream ingests messages from, its subjects and aliases.
+func (cfg *StreamConfig) ingestSubjects() []string {
+	if len(cfg.SubjectAliases) == 0 {
+		return cfg.Subjects
+	}
+	subjects := make([]string, 0, len(cfg.Subjects)+len(cfg.SubjectAliases))
+	subjects = append(subjects, cfg.Subjects...)
+	for _, sa := range cfg.SubjectAliases {
+		subjects = append(subjects, sa.Subject)
+	}
+	return subjects
+}
+
+// aliasStoredSubjects returns the subjects of aliases messages are stored with as published,
+// those without a destination. Translated aliases are stored with one of our subjects.
+func (cfg *StreamConfig) aliasStoredSubjects() []string {
+	var subjects []string
+	for _, sa := range cfg.SubjectAliases {
+		if sa.Destination == _EMPTY_ {
+			subjects = append(subjects, sa.Subject)
+		}
+	}
+	return subjects
+}
+
+// aliasDestPattern returns a subject that matches all subjects the transform of an alias
+// can produce, or an error if a mapping function can produce more than one token.
+func aliasDestPattern(tr *transform) (string, error) {
+	if len(tr.dtokmftypes) == 0 {
+		return tr.dest, nil
+	}
+	tokens := make([]string, 0, len(tr.dtoks))
+	for i, mfType := range tr.dtokmftypes {
+		switch mfType {
+		case NoTransform:
+			tokens = append(tokens, tr.dtoks[i])
+		case Wildcard, Partition:
+			tokens = append(tokens, pwcs)
+		default:
+			return _EMPTY_, fmt.Errorf("mapping function %q not supported", tr.dtoks[i])
+		}
+	}
+	return strings.Join(tokens, tsep), nil
+}
+
+// checkSubjectAliases will check the subject aliases of a stream config.
+func checkSubjectAliases(cfg *StreamConfig) error {
+	if cfg.Mirror != nil {
+		return errors.New("subject aliases not allowed on mirror")
+	}
+	for i, sa := range cfg.SubjectAliases {
+		if sa == nil || !IsValidSubject(sa.Subject) {
+			return errors.New("subject alias has an invalid subject")
+		}
+		if subjectIsSubsetMatch(sa.Subject, "$JS.API.>") {
+			return errors.New("subject alias overlaps with jetstream api")
+		}
+		// We would store the same message twice.
+		for _, subj := range cfg.Subjects {
+			if SubjectsCollide(sa.Subject, subj) {
+				return fmt.Errorf("subject alias %q overlaps with subject %q", sa.Subject, subj)
+			}
+		}
+		for _, osa := range cfg.SubjectAliases[:i] {
+			if SubjectsCollide(sa.Subject, osa.Subject) {
+				return fmt.Errorf("subject alias %q overlaps with %q", sa.Subject, osa.Subject)
+			}
+		}
+		if sa.Destination != _EMPTY_ {
+			tr, err := newTransform(sa.Subject, sa.Destination)
+			if err != nil {
+				return fmt.Errorf("subject alias %q has an invalid destination: %v", sa.Subject, err)
+			}
+			dest, err := aliasDestPattern(tr)
+			if err != nil {
+				return fmt.Errorf("subject alias %q has an invalid destination: %v", sa.Subject, err)
+			}
+			// Messages are stored with the destination, so it has to be one of our subjects.
+			var ok bool
+			for _, subj := range cfg.Subjects {
+				if subjectIsSubsetMatch(dest, subj) {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				return fmt.Errorf("subject alias %q destination %q is not within the stream subjects", sa.Subject, sa.Destination)
+			}
+		}
+	}
+	return nil
+}
+
+// subscribeToAlias will subscribe to the subject of the alias, translating the subject if needed.
+// Lock should be held.
+func (mset *stream) subscribeToAlias(sa *SubjectAlias) error {
+	cb := mset.processInboundJetStreamMsg
+	if sa.Destination != _EMPTY_ {
+		tr, err := newTransform(sa.Subject, sa.Destination)
+		if err != nil {
+			return err
+		}
+		cb = func(sub *subscription, c *client, acc *Account, subject, reply string, rmsg []byte) {
+			if tsubj, err := tr.Match(subject); err == nil {
+				subject = tsubj
+			}
+			mset.processInboundJetStreamMsg(sub, c, acc, subject, reply, rmsg)
+		}
+	}
+	_, err := mset.subscribeInternal(sa.Subject, cb)
+	return err
+}
+
+// updateSubjectAliases will change our alias subscriptions to the new aliases.
+// Lock should be held.
+func (mset *stream) updateSubjectAliases(old, new []*SubjectAlias) error {
+	current := make(map[SubjectAlias]struct{}, len(old))
+	for _, sa := range old {
+		current[*sa] = struct{}{}
+	}
+	keep := make(map[SubjectAlias]struct{}, len(new))
+	for _, sa := range new {
+		if _, ok := current[*sa]; ok {
+			keep[*sa] = struct{}{}
+		}
+	}
+	// Unsubscribe first, the new one may use the same subject with a different destination.
+	for sa := range current {
+		if _, ok := keep[sa]; !ok {
+			if err := mset.unsubscribeInternal(sa.Subject); err != nil {
+				return err
+			}
+		}
+	}
+	for _, sa := range new {
+		if _, ok := keep[*sa]; !ok {
+			if err := mset.subscribeToAlias(sa); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
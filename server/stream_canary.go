@@ -0,0 +1,141 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync/atomic"
+)
+
+// StreamCanary captures a percentage of the messages published to subjects, next to the
+// stream that stores them, e.g. to test a new processing pipeline with live traffic.
+// Captured messages are not acknowledged to the publisher and the subjects may overlap
+// with other streams. Subjects need to be literal so a canary can not capture traffic
+// beyond the subjects it was set up for. The weight can be changed with a stream update.
+type StreamCanary struct {
+	Subjects []string `json:"subjects"`
+	// Percentage of the messages to capture, from 0 to 100.
+	Weight uint8 `json:"weight"`
+	// Optional literal subject captured messages are stored with, e.g. "canary.orders".
+	Destination string `json:"dest,omitempty"`
+}
+
+// storedSubjects returns the subjects captured messages are stored with.
+func (sc *StreamCanary) storedSubjects() []string {
+	if sc.Destination == _EMPTY_ {
+		return sc.Subjects
+	}
+	return []string{sc.Destination}
+}
+
+// checkStreamCanary will check the canary config of a stream.
+func checkStreamCanary(cfg *StreamConfig) error {
+	sc := cfg.Canary
+	if cfg.Mirror != nil {
+		return errors.New("stream canary not allowed on mirror")
+	}
+	if len(sc.Subjects) == 0 {
+		return errors.New("stream canary requires subjects")
+	}
+	if sc.Weight > 100 {
+		return errors.New("stream canary weight must be a percentage")
+	}
+	if sc.Destination != _EMPTY_ && !IsValidLiteralSubject(sc.Destination) {
+		return fmt.Errorf("stream canary destination %q must be a literal subject", sc.Destination)
+	}
+	ingest := cfg.ingestSubjects()
+	for i, subj := range sc.Subjects {
+		if !IsValidLiteralSubject(subj) {
+			return fmt.Errorf("stream canary subject %q must be a literal subject", subj)
+		}
+		if subjectIsSubsetMatch(subj, "$JS.API.>") {
+			return errors.New("stream canary subjects overlap with jetstream api")
+		}
+		// We would store the same message twice.
+		for _, isubj := range ingest {
+			if subjectIsSubsetMatch(subj, isubj) {
+				return fmt.Errorf("stream canary subject %q overlaps with %q", subj, isubj)
+			}
+		}
+		for _, osubj := range sc.Subjects[:i] {
+			if subj == osubj {
+				return fmt.Errorf("stream canary subject %q is duplicated", subj)
+			}
+		}
+	}
+	return nil
+}
+
+// streamCanary holds the current weight of our canary, so it can change without resubscribing.
+type streamCanary struct {
+	weight int32
+}
+
+// subscribeToCanary will subscribe to the canary subjects.
+// Lock should be held.
+func (mset *stream) subscribeToCanary(sc *StreamCanary) error {
+	if sc == nil {
+		return nil
+	}
+	canary, dest := &streamCanary{weight: int32(sc.Weight)}, sc.Destination
+	for _, subj := range sc.Subjects {
+		cb := func(sub *subscription, c *client, acc *Account, subject, _ string, rmsg []byte) {
+			if w := atomic.LoadInt32(&canary.weight); w < 100 && rand.Int31n(100) >= w {
+				return
+			}
+			if dest != _EMPTY_ {
+				subject = dest
+			}
+			// No reply, the publisher is acknowledged by the stream that stores the subject.
+			mset.processInboundJetStreamMsg(sub, c, acc, subject, _EMPTY_, rmsg)
+		}
+		if _, err := mset.subscribeInternal(subj, cb); err != nil {
+			return err
+		}
+	}
+	mset.canary = canary
+	return nil
+}
+
+// unsubscribeToCanary will remove the subscriptions for the canary subjects.
+// Lock should be held.
+func (mset *stream) unsubscribeToCanary(sc *StreamCanary) error {
+	mset.canary = nil
+	if sc == nil {
+		return nil
+	}
+	for _, subj := range sc.Subjects {
+		if err := mset.unsubscribeInternal(subj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateCanary will change the weight of our canary, or resubscribe if the subjects changed.
+// Lock should be held.
+func (mset *stream) updateCanary(old, new *StreamCanary) error {
+	if old != nil && new != nil && mset.canary != nil &&
+		reflect.DeepEqual(old.Subjects, new.Subjects) && old.Destination == new.Destination {
+		atomic.StoreInt32(&mset.canary.weight, int32(new.Weight))
+		return nil
+	}
+	if err := mset.unsubscribeToCanary(old); err != nil {
+		return err
+	}
+	return mset.subscribeToCanary(new)
+}
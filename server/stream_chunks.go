@@ -0,0 +1,289 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Headers to publish a message in ordered chunks to a stream that allows chunked messages.
+// The chunks of a message share an id and are numbered from 1, the last one is marked.
+// The headers of the first chunk are the headers of the reassembled message.
+const (
+	JSChunkId   = "Nats-Chunk-Id"
+	JSChunkSeq  = "Nats-Chunk-Seq"
+	JSChunkLast = "Nats-Chunk-Last"
+)
+
+// Max size of a reassembled message if the stream has no max message size.
+const chunkedMsgMaxSizeDefault = 8 * 1024 * 1024
+
+// Most incomplete chunked messages we keep per stream.
+const chunkedMsgMaxPending = 8
+
+// Most memory incomplete chunked messages of all streams can hold on this server.
+var chunkedMsgMaxServerMem = int64(256 * 1024 * 1024)
+
+// How long we keep an incomplete chunked message after its last chunk.
+var chunkedMsgTimeout = time.Minute
+
+var (
+	errChunkOutOfOrder = errors.New("chunk out of order")
+	errChunkTooMany    = errors.New("too many incomplete chunked messages")
+	errChunkNoMemory   = errors.New("insufficient memory for chunked message")
+)
+
+// chunkedMsg is a message we are reassembling.
+type chunkedMsg struct {
+	hdr  []byte
+	msg  []byte
+	seq  int
+	last time.Time
+}
+
+// streamChunks holds the chunked messages of a stream that are not complete yet.
+// Only the leader receives messages from publishers, so this is kept in memory.
+// The memory they hold counts against the memory limits of the account.
+type streamChunks struct {
+	mu      sync.Mutex
+	jsa     *jsAccount
+	enabled bool
+	maxSize int
+	held    int64
+	pending map[string]*chunkedMsg
+}
+
+func newStreamChunks(jsa *jsAccount, cfg *StreamConfig) *streamChunks {
+	sc := &streamChunks{jsa: jsa}
+	sc.configure(cfg)
+	return sc
+}
+
+// configure will set if chunked messages are allowed and how large they can get.
+func (sc *streamChunks) configure(cfg *StreamConfig) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.enabled, sc.maxSize = cfg.AllowChunked, int(cfg.MaxMsgSize)
+	if sc.maxSize <= 0 {
+		sc.maxSize = chunkedMsgMaxSizeDefault
+	}
+	if !sc.enabled {
+		sc.reset()
+	}
+}
+
+// reset drops all incomplete chunked messages.
+// Lock should be held.
+func (sc *streamChunks) reset() {
+	sc.pending = nil
+	sc.release(sc.held)
+}
+
+// stop will drop all incomplete chunked messages, e.g. when the stream stops.
+func (sc *streamChunks) stop() {
+	if sc == nil {
+		return
+	}
+	sc.mu.Lock()
+	sc.reset()
+	sc.mu.Unlock()
+}
+
+// drop will drop an incomplete chunked message.
+// Lock should be held.
+func (sc *streamChunks) drop(id string) {
+	if cm := sc.pending[id]; cm != nil {
+		delete(sc.pending, id)
+		sc.release(int64(len(cm.hdr) + len(cm.msg)))
+	}
+}
+
+// Lock should be held.
+func (sc *streamChunks) reserve(tier string, n int64) bool {
+	if sc.jsa != nil && !sc.jsa.reserveChunkMem(tier, n) {
+		return false
+	}
+	sc.held += n
+	return true
+}
+
+// Lock should be held.
+func (sc *streamChunks) release(n int64) {
+	if n == 0 {
+		return
+	}
+	sc.held -= n
+	if sc.jsa != nil {
+		sc.jsa.releaseChunkMem(n)
+	}
+}
+
+// reserveChunkMem will account for memory held by incomplete chunked messages, unless that
+// would exceed the memory limits of the account or what this server allows in total.
+func (jsa *jsAccount) reserveChunkMem(tier string, n int64) bool {
+	js := jsa.js
+	if atomic.AddInt64(&js.chunkMem, n) > chunkedMsgMaxServerMem {
+		atomic.AddInt64(&js.chunkMem, -n)
+		return false
+	}
+	cmem := atomic.AddInt64(&jsa.cmem, n)
+	if jsa.sys {
+		return true
+	}
+	jsa.usageMu.RLock()
+	limits, ok := jsa.limits[tier]
+	var used int64
+	if inUse := jsa.usage[tier]; inUse != nil {
+		used = inUse.total.mem
+	}
+	jsa.usageMu.RUnlock()
+	// A max memory of zero only disallows memory storage, our total for the server still applies.
+	if !ok || limits.MaxMemory > 0 && used+cmem > limits.MaxMemory {
+		jsa.releaseChunkMem(n)
+		return false
+	}
+	return true
+}
+
+func (jsa *jsAccount) releaseChunkMem(n int64) {
+	atomic.AddInt64(&jsa.cmem, -n)
+	atomic.AddInt64(&jsa.js.chunkMem, -n)
+}
+
+// add will add a chunk. When the message is complete it is returned, otherwise
+// returns the number of the chunk.
+func (sc *streamChunks) add(id, tier string, hdr, msg []byte) (*chunkedMsg, int, error) {
+	seq, err := strconv.Atoi(string(getHeader(JSChunkSeq, hdr)))
+	if err != nil || seq < 1 {
+		return nil, 0, errors.New("invalid chunk sequence")
+	}
+	last := string(getHeader(JSChunkLast, hdr)) == "true"
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	now := time.Now()
+	for cid, cm := range sc.pending {
+		if now.Sub(cm.last) > chunkedMsgTimeout {
+			sc.drop(cid)
+		}
+	}
+
+	cm := sc.pending[id]
+	if seq == 1 {
+		if cm == nil && len(sc.pending) >= chunkedMsgMaxPending {
+			return nil, seq, errChunkTooMany
+		}
+		sc.drop(id)
+		// The first chunk has the headers of the message.
+		cm = &chunkedMsg{hdr: stripChunkHeaders(hdr)}
+		if !sc.reserve(tier, int64(len(cm.hdr))) {
+			return nil, seq, errChunkNoMemory
+		}
+		if sc.pending == nil {
+			sc.pending = make(map[string]*chunkedMsg)
+		}
+		sc.pending[id] = cm
+	} else if cm == nil || seq != cm.seq+1 {
+		sc.drop(id)
+		return nil, seq, errChunkOutOfOrder
+	}
+	if len(cm.hdr)+len(cm.msg)+len(msg) > sc.maxSize {
+		sc.drop(id)
+		return nil, seq, ErrMaxPayload
+	}
+	if !sc.reserve(tier, int64(len(msg))) {
+		sc.drop(id)
+		return nil, seq, errChunkNoMemory
+	}
+	cm.msg = append(cm.msg, msg...)
+	cm.seq, cm.last = seq, now
+
+	if !last {
+		return nil, seq, nil
+	}
+	// Once complete the message is accounted for like any other.
+	sc.drop(id)
+	return cm, seq, nil
+}
+
+// Returns a copy of the headers without our chunk headers.
+func stripChunkHeaders(hdr []byte) []byte {
+	hdr = copyBytes(hdr)
+	for _, key := range []string{JSChunkId, JSChunkSeq, JSChunkLast} {
+		if hdr = removeHeaderIfPresent(hdr, key); hdr == nil {
+			break
+		}
+	}
+	return hdr
+}
+
+// processChunk is called for inbound messages before they are processed. Chunks of a
+// message are held until the last one arrived, then the reassembled message is returned.
+// Returns false if there is nothing to process yet.
+func (mset *stream) processChunk(reply string, hdr, msg []byte) ([]byte, []byte, bool) {
+	if len(hdr) == 0 || mset.chunks == nil {
+		return hdr, msg, true
+	}
+	id := getHeader(JSChunkId, hdr)
+	if len(id) == 0 {
+		return hdr, msg, true
+	}
+	mset.chunks.mu.Lock()
+	enabled := mset.chunks.enabled
+	mset.chunks.mu.Unlock()
+	// Streams that do not allow chunked messages store them as is.
+	if !enabled {
+		return hdr, msg, true
+	}
+	mset.mu.RLock()
+	tier := mset.tier
+	mset.mu.RUnlock()
+
+	cm, seq, err := mset.chunks.add(string(id), tier, hdr, msg)
+	if err != nil {
+		var apiErr *ApiError
+		if err == ErrMaxPayload {
+			apiErr = NewJSStreamMessageExceedsMaximumError()
+		} else {
+			apiErr = NewJSStreamChunkedMsgError(err)
+		}
+		mset.sendChunkResponse(reply, seq, apiErr)
+		return nil, nil, false
+	}
+	if cm == nil {
+		mset.sendChunkResponse(reply, seq, nil)
+		return nil, nil, false
+	}
+	// The pub ack of the stored message goes to the last chunk.
+	return cm.hdr, cm.msg, true
+}
+
+// Acks a chunk, or responds with the error that made us drop the chunked message.
+func (mset *stream) sendChunkResponse(reply string, seq int, apiErr *ApiError) {
+	mset.mu.RLock()
+	outq, name, noAck := mset.outq, mset.cfg.Name, mset.cfg.NoAck
+	mset.mu.RUnlock()
+	if reply == _EMPTY_ || noAck || outq == nil {
+		return
+	}
+	resp := &JSPubAckResponse{PubAck: &PubAck{Stream: name, Chunk: seq}, Error: apiErr}
+	b, _ := json.Marshal(resp)
+	outq.sendMsg(reply, b)
+}
@@ -0,0 +1,204 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Evictions within this window are sent in a single notification.
+const evictionBatchWindow = 100 * time.Millisecond
+
+// Most evictions we send in a single notification.
+const evictionBatchMax = 1000
+
+// StreamEvictions is published to the eviction subject of a stream with the
+// messages removed by the retention of the stream, in the order they were removed.
+type StreamEvictions struct {
+	Stream    string           `json:"stream"`
+	Evictions []StreamEviction `json:"evictions"`
+}
+
+// StreamEviction is a single message removed by the retention of a stream.
+type StreamEviction struct {
+	Sequence uint64          `json:"seq"`
+	Subject  string          `json:"subject"`
+	Size     uint64          `json:"size"`
+	Reason   RetentionReason `json:"reason"`
+}
+
+// streamEvictions publishes the evictions of a stream. It has its own lock since
+// evictions are reported by the store while the stream lock may be held.
+// Removals done by the stream for its retention policy are marked before removing,
+// and reported from the store removal callback like the ones done by the store for its limits.
+type streamEvictions struct {
+	mu      sync.Mutex
+	stream  string
+	subj    string
+	leader  bool
+	outq    *jsOutQ
+	marked  map[uint64]RetentionReason
+	pend    []StreamEviction
+	timer   *time.Timer
+	stopped bool
+}
+
+func newStreamEvictions(stream, subj string) *streamEvictions {
+	return &streamEvictions{stream: stream, subj: subj}
+}
+
+// setSubject will set the subject we publish to, empty disables notifications.
+func (se *streamEvictions) setSubject(subj string) {
+	se.mu.Lock()
+	se.subj = subj
+	if subj == _EMPTY_ {
+		se.marked, se.pend = nil, nil
+	}
+	se.mu.Unlock()
+}
+
+// setLeader will set if we publish evictions, only the leader does.
+func (se *streamEvictions) setLeader(isLeader bool, outq *jsOutQ) {
+	se.mu.Lock()
+	se.leader, se.outq = isLeader, outq
+	if !isLeader {
+		se.marked, se.pend = nil, nil
+	}
+	se.mu.Unlock()
+}
+
+// stop will stop publishing, dropping what is pending.
+func (se *streamEvictions) stop() {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	se.stopped = true
+	if se.timer != nil {
+		se.timer.Stop()
+		se.timer = nil
+	}
+	se.marked, se.pend = nil, nil
+}
+
+// Lock should be held.
+func (se *streamEvictions) enabledLocked() bool {
+	return se.leader && !se.stopped && se.subj != _EMPTY_ && se.outq != nil
+}
+
+// mark will mark the sequence as removed for the given reason, which is reported once the
+// store removes it. Returns false if we do not publish evictions.
+func (se *streamEvictions) mark(seq uint64, reason RetentionReason) bool {
+	if se == nil {
+		return false
+	}
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	if !se.enabledLocked() {
+		return false
+	}
+	if se.marked == nil {
+		se.marked = make(map[uint64]RetentionReason)
+	}
+	se.marked[seq] = reason
+	return true
+}
+
+// unmark will clear the mark on a sequence the store did not remove.
+func (se *streamEvictions) unmark(seq uint64) {
+	se.mu.Lock()
+	delete(se.marked, seq)
+	se.mu.Unlock()
+}
+
+// removed is called from the store removal callback, and publishes the eviction if the
+// sequence was marked.
+func (se *streamEvictions) removed(seq uint64, subj string, size uint64) {
+	if se == nil {
+		return
+	}
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	reason, ok := se.marked[seq]
+	if !ok {
+		return
+	}
+	delete(se.marked, seq)
+	se.queue(seq, subj, size, reason)
+}
+
+// notify publishes the eviction of a message. Registered with the store for removals via limits.
+func (se *streamEvictions) notify(seq uint64, subj string, size uint64, reason RetentionReason) {
+	if se == nil {
+		return
+	}
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	se.queue(seq, subj, size, reason)
+}
+
+// Lock should be held.
+func (se *streamEvictions) queue(seq uint64, subj string, size uint64, reason RetentionReason) {
+	if !se.enabledLocked() {
+		return
+	}
+	se.pend = append(se.pend, StreamEviction{Sequence: seq, Subject: subj, Size: size, Reason: reason})
+	if len(se.pend) >= evictionBatchMax {
+		se.send()
+	} else if se.timer == nil {
+		se.timer = time.AfterFunc(evictionBatchWindow, se.flush)
+	}
+}
+
+// flush will publish what was evicted since the last flush.
+func (se *streamEvictions) flush() {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	if se.timer == nil {
+		// Stopped.
+		return
+	}
+	se.timer = nil
+	se.send()
+}
+
+// Lock should be held.
+func (se *streamEvictions) send() {
+	if len(se.pend) == 0 {
+		return
+	}
+	if se.enabledLocked() {
+		ev := StreamEvictions{Stream: se.stream, Evictions: se.pend}
+		if j, err := json.Marshal(ev); err == nil {
+			se.outq.sendMsg(se.subj, j)
+		}
+	}
+	se.pend = nil
+}
+
+// checkStreamEvictionSubject checks the eviction subject of the stream config.
+func checkStreamEvictionSubject(cfg *StreamConfig) error {
+	subj := cfg.EvictionSubject
+	if !IsValidLiteralSubject(subj) {
+		return fmt.Errorf("stream eviction subject %q is invalid", subj)
+	}
+	// Evictions would be stored and evict messages themselves.
+	for _, isubj := range cfg.ingestSubjects() {
+		if SubjectsCollide(subj, isubj) {
+			return fmt.Errorf("stream eviction subject %q overlaps with %q", subj, isubj)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// Number of consecutive store errors after which a stream stops accepting messages.
+const streamStoreErrLimit = 5
+
+// File we write to check that the store directory of a failed stream is writable again.
+const streamReopenProbeFile = "reopen.probe"
+
+// StreamFailure describes why a stream stopped accepting messages.
+// It stays failed until re-opened through the API, e.g. after the disk was fixed.
+type StreamFailure struct {
+	Error  string    `json:"error"`
+	Errors int       `json:"errors"`
+	Since  time.Time `json:"since"`
+}
+
+// Returns the error publishers get while we are failed.
+// Lock should be held.
+func (mset *stream) failedError() *ApiError {
+	if mset.failed == nil {
+		return nil
+	}
+	return NewJSStreamFailedError(errors.New(mset.failed.Error))
+}
+
+// failureInfo returns a copy of our failure, if any, for stream info.
+func (mset *stream) failureInfo() *StreamFailure {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if mset.failed == nil {
+		return nil
+	}
+	sf := *mset.failed
+	return &sf
+}
+
+// storeFailed is called when storing a message failed with an error other than a limit.
+// Once we hit too many of them in a row we stop accepting messages.
+func (mset *stream) storeFailed(err error) {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+	mset.serrs++
+	if mset.failed != nil || mset.serrs < streamStoreErrLimit {
+		return
+	}
+	mset.failed = &StreamFailure{Error: err.Error(), Errors: mset.serrs, Since: time.Now().UTC()}
+	mset.srv.Errorf("JetStream stream '%s > %s' failed after %d store errors, rejecting messages until re-opened: %v",
+		mset.acc.Name, mset.cfg.Name, mset.serrs, err)
+	mset.sendFailedAdvisoryLocked()
+}
+
+// reopen will let a failed stream accept messages again.
+// For file based streams we first make sure we can write to the store directory again.
+func (mset *stream) reopen() error {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+	if mset.failed == nil {
+		return nil
+	}
+	if fs, ok := mset.store.(*fileStore); ok {
+		probe := filepath.Join(fs.fcfg.StoreDir, streamReopenProbeFile)
+		if err := os.WriteFile(probe, []byte(mset.cfg.Name), defaultFilePerms); err != nil {
+			return err
+		}
+		os.Remove(probe)
+	}
+	mset.failed, mset.serrs = nil, 0
+	mset.srv.Noticef("JetStream stream '%s > %s' re-opened", mset.acc.Name, mset.cfg.Name)
+	mset.sendReopenedAdvisoryLocked()
+	return nil
+}
+
+// Lock should be held.
+func (mset *stream) sendFailedAdvisoryLocked() {
+	if mset.outq == nil {
+		return
+	}
+	m := JSStreamFailedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamFailedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream: mset.cfg.Name,
+		Error:  mset.failed.Error,
+		Errors: mset.failed.Errors,
+		Domain: mset.srv.getOpts().JetStreamDomain,
+	}
+	if j, err := json.Marshal(m); err == nil {
+		mset.outq.sendMsg(JSAdvisoryStreamFailedPre+"."+mset.cfg.Name, j)
+	}
+}
+
+// Lock should be held.
+func (mset *stream) sendReopenedAdvisoryLocked() {
+	if mset.outq == nil {
+		return
+	}
+	m := JSStreamReopenedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamReopenedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream: mset.cfg.Name,
+		Domain: mset.srv.getOpts().JetStreamDomain,
+	}
+	if j, err := json.Marshal(m); err == nil {
+		mset.outq.sendMsg(JSAdvisoryStreamReopenedPre+"."+mset.cfg.Name, j)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Most messages returned for a single header index lookup.
+const JSApiMsgLookupMaxMsgs = 256
+
+// Most messages we index per stream. Past this the oldest ones are dropped from the index,
+// so only the most recent messages can be looked up.
+const streamHeaderIndexMax = 1_000_000
+
+// streamHeaderIndex indexes the messages of a stream by the value of a header, so messages
+// can be looked up by e.g. an order id without replaying the stream. It has its own lock since
+// removals are reported by the store while the stream lock may be held.
+// Kept in memory only, it is rebuilt from the store when the stream is loaded. Removals the index
+// missed are detected and dropped on lookup, so it never returns a message that is gone.
+type streamHeaderIndex struct {
+	mu    sync.RWMutex
+	key   string
+	gen   uint64
+	seqs  map[string][]uint64
+	vals  map[uint64]string
+	order []uint64
+	max   int
+}
+
+func newStreamHeaderIndex(key string) *streamHeaderIndex {
+	return &streamHeaderIndex{key: key, seqs: make(map[string][]uint64), vals: make(map[uint64]string), max: streamHeaderIndexMax}
+}
+
+// checkStreamHeaderIndex checks the header index of the stream config.
+func checkStreamHeaderIndex(cfg *StreamConfig) error {
+	key := cfg.HeaderIndex
+	if strings.ContainsAny(key, ": \t\r\n") {
+		return fmt.Errorf("stream header index %q is not a valid header name", key)
+	}
+	return nil
+}
+
+// enabled returns if we index messages.
+func (hi *streamHeaderIndex) enabled() bool {
+	if hi == nil {
+		return false
+	}
+	hi.mu.RLock()
+	defer hi.mu.RUnlock()
+	return hi.key != _EMPTY_
+}
+
+// add will index a message just stored.
+func (hi *streamHeaderIndex) add(seq uint64, hdr []byte) {
+	if hi == nil || len(hdr) == 0 {
+		return
+	}
+	hi.mu.Lock()
+	defer hi.mu.Unlock()
+	hi.addLocked(seq, hdr)
+}
+
+// Lock should be held.
+func (hi *streamHeaderIndex) addLocked(seq uint64, hdr []byte) {
+	if hi.key == _EMPTY_ {
+		return
+	}
+	if _, ok := hi.vals[seq]; ok {
+		return
+	}
+	v := getHeader(hi.key, hdr)
+	if len(v) == 0 {
+		return
+	}
+	val := string(v)
+	// Messages are added in order, except while we rebuild.
+	seqs := hi.seqs[val]
+	if n := len(seqs); n == 0 || seqs[n-1] < seq {
+		seqs = append(seqs, seq)
+	} else {
+		i := sort.Search(n, func(i int) bool { return seqs[i] >= seq })
+		seqs = append(seqs, 0)
+		copy(seqs[i+1:], seqs[i:])
+		seqs[i] = seq
+	}
+	hi.seqs[val] = seqs
+	hi.vals[seq] = val
+	hi.order = append(hi.order, seq)
+
+	// Drop the oldest once we are at our limit.
+	for len(hi.vals) > hi.max && len(hi.order) > 0 {
+		hi.removeLocked(hi.order[0])
+		hi.order = hi.order[1:]
+	}
+	// Drop what was removed from the front of our order once it is mostly that.
+	if len(hi.order) > 2*len(hi.vals)+64 {
+		order := make([]uint64, 0, len(hi.vals))
+		for _, seq := range hi.order {
+			if _, ok := hi.vals[seq]; ok {
+				order = append(order, seq)
+			}
+		}
+		hi.order = order
+	}
+}
+
+// remove will drop a message from the index.
+func (hi *streamHeaderIndex) remove(seq uint64) {
+	if hi == nil {
+		return
+	}
+	hi.mu.Lock()
+	defer hi.mu.Unlock()
+	hi.removeLocked(seq)
+}
+
+// Lock should be held.
+func (hi *streamHeaderIndex) removeLocked(seq uint64) {
+	val, ok := hi.vals[seq]
+	if !ok {
+		return
+	}
+	delete(hi.vals, seq)
+	seqs := hi.seqs[val]
+	if i := sort.Search(len(seqs), func(i int) bool { return seqs[i] >= seq }); i < len(seqs) && seqs[i] == seq {
+		seqs = append(seqs[:i], seqs[i+1:]...)
+	}
+	if len(seqs) == 0 {
+		delete(hi.seqs, val)
+	} else {
+		hi.seqs[val] = seqs
+	}
+}
+
+// removeRange will drop all messages from first to last from the index.
+func (hi *streamHeaderIndex) removeRange(first, last uint64) {
+	if hi == nil {
+		return
+	}
+	hi.mu.Lock()
+	defer hi.mu.Unlock()
+	if last-first < uint64(len(hi.vals)) {
+		for seq := first; seq <= last; seq++ {
+			hi.removeLocked(seq)
+		}
+		return
+	}
+	for seq := range hi.vals {
+		if seq >= first && seq <= last {
+			hi.removeLocked(seq)
+		}
+	}
+}
+
+// removeBefore will drop all messages before the sequence from the index,
+// for when we do not know what a batch removal removed.
+func (hi *streamHeaderIndex) removeBefore(seq uint64) {
+	if hi == nil || seq <= 1 {
+		return
+	}
+	hi.removeRange(0, seq-1)
+}
+
+// lookup returns the sequences of the messages with the header value, at or after start.
+func (hi *streamHeaderIndex) lookup(val string, start uint64) []uint64 {
+	hi.mu.RLock()
+	defer hi.mu.RUnlock()
+	seqs := hi.seqs[val]
+	i := sort.Search(len(seqs), func(i int) bool { return seqs[i] >= start })
+	return append([]uint64(nil), seqs[i:]...)
+}
+
+// setKey will set the header key and drop what we indexed, empty disables the index.
+// Messages stored from now on are indexed, the ones already stored once we rebuild.
+// Returns the generation to rebuild.
+func (hi *streamHeaderIndex) setKey(key string) uint64 {
+	if hi == nil {
+		return 0
+	}
+	hi.mu.Lock()
+	defer hi.mu.Unlock()
+	hi.key, hi.seqs, hi.vals, hi.order = key, make(map[string][]uint64), make(map[uint64]string), nil
+	hi.gen++
+	return hi.gen
+}
+
+// rebuild will index the messages in the store, unless the key changed again since setKey.
+// Should not be called with the stream lock held, the store is scanned without any lock so
+// removals during the scan may be missed.
+func (hi *streamHeaderIndex) rebuild(gen uint64, store StreamStore) {
+	if hi == nil || store == nil {
+		return
+	}
+	var smv StoreMsg
+	for seq := uint64(0); ; seq++ {
+		sm, nseq, err := store.LoadNextMsg(fwcs, true, seq, &smv)
+		if err != nil || sm == nil {
+			return
+		}
+		hi.mu.Lock()
+		if hi.gen != gen || hi.key == _EMPTY_ {
+			hi.mu.Unlock()
+			return
+		}
+		hi.addLocked(nseq, sm.hdr)
+		hi.mu.Unlock()
+		seq = nseq
+	}
+}
+
+// lookupByHeader returns the messages with the value for our header index, at or after start,
+// up to limit. Also returns if there are more.
+func (mset *stream) lookupByHeader(val string, start uint64, limit int) ([]*StoredMsg, bool, *ApiError) {
+	hi := mset.hidx
+	if !hi.enabled() {
+		return nil, false, NewJSStreamNoHeaderIndexError()
+	}
+	hi.mu.RLock()
+	key := hi.key
+	hi.mu.RUnlock()
+
+	mset.mu.RLock()
+	store := mset.store
+	mset.mu.RUnlock()
+	if store == nil {
+		return nil, false, NewJSStreamNotFoundError()
+	}
+
+	if limit <= 0 || limit > JSApiMsgLookupMaxMsgs {
+		limit = JSApiMsgLookupMaxMsgs
+	}
+	var msgs []*StoredMsg
+	var smv StoreMsg
+	for _, seq := range hi.lookup(val, start) {
+		sm, err := store.LoadMsg(seq, &smv)
+		// Drop what the index missed, removed or replaced messages.
+		if err != nil || sm == nil || string(getHeader(key, sm.hdr)) != val {
+			hi.remove(seq)
+			continue
+		}
+		if len(msgs) == limit {
+			return msgs, true, nil
+		}
+		msgs = append(msgs, &StoredMsg{
+			Subject:  sm.subj,
+			Sequence: sm.seq,
+			Header:   copyBytes(removeOriginHeader(sm.hdr)),
+			Data:     copyBytes(sm.msg),
+			Time:     time.Unix(0, sm.ts).UTC(),
+		})
+	}
+	return msgs, false, nil
+}
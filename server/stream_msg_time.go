@@ -0,0 +1,126 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Header with the time a publisher created a message, in RFC 3339 format.
+// Only used as the timestamp of the message if configured, see JSClockSkewOpts.
+const JSMsgTime = "Nats-Msg-Time"
+
+// JSClockSkewOpts configure storing messages with the timestamps their publishers set, so MaxAge
+// and start times relate to when messages were created. Timestamps that differ from our clock by
+// more than MaxSkew are rejected, or replaced with our own time.
+type JSClockSkewOpts struct {
+	// Maximum difference with our clock, defaultMaxClockSkew if zero.
+	MaxSkew time.Duration
+	// Reject messages with skewed timestamps instead of storing them with our time.
+	Reject bool
+}
+
+// Default maximum difference of timestamps set by publishers with our clock.
+const defaultMaxClockSkew = time.Minute
+
+func validateJetStreamClockSkew(o *Options) error {
+	if co := o.JetStreamClockSkew; co != nil && co.MaxSkew < 0 {
+		return errors.New("jetstream max clock skew can not be negative")
+	}
+	return nil
+}
+
+// nextMsgTimestamp returns the timestamp to store a new message with, given the time of our last one.
+// Timestamps never go back, even if our clock does, so lookups by time stay consistent.
+func nextMsgTimestamp(ts int64, last time.Time) int64 {
+	if !last.IsZero() {
+		if lts := last.UnixNano(); ts < lts {
+			return lts
+		}
+	}
+	return ts
+}
+
+// nextClusteredMsgTimestamp returns the timestamp for a message we propose, given the
+// timestamp set by its publisher if any.
+// Lock (clMu) should be held.
+func (mset *stream) nextClusteredMsgTimestamp(store StreamStore, mts int64) int64 {
+	ts := mts
+	if ts == 0 {
+		ts = time.Now().UnixNano()
+	}
+	if mset.clts == 0 && store != nil {
+		var state StreamState
+		store.FastState(&state)
+		if !state.LastTime.IsZero() {
+			mset.clts = state.LastTime.UnixNano()
+		}
+	}
+	if ts < mset.clts {
+		ts = mset.clts
+	}
+	mset.clts = ts
+	return ts
+}
+
+// checkMsgTime will check the timestamp a publisher set on a message, if configured to use them.
+// Returns the timestamp to store the message with, zero to use our own.
+// Rejected publishes are answered here.
+func (mset *stream) checkMsgTime(reply string, hdr []byte) (int64, error) {
+	if len(hdr) == 0 {
+		return 0, nil
+	}
+	v := getHeader(JSMsgTime, hdr)
+	if v == nil {
+		return 0, nil
+	}
+	co := mset.srv.getOpts().JetStreamClockSkew
+	if co == nil {
+		return 0, nil
+	}
+
+	var apiErr *ApiError
+	if t, err := time.Parse(time.RFC3339Nano, string(v)); err != nil {
+		apiErr = NewJSStreamMsgTimeInvalidError()
+	} else {
+		maxSkew := co.MaxSkew
+		if maxSkew == 0 {
+			maxSkew = defaultMaxClockSkew
+		}
+		skew := time.Since(t)
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew <= maxSkew {
+			return t.UnixNano(), nil
+		}
+		if !co.Reject {
+			return 0, nil
+		}
+		apiErr = NewJSStreamMsgTimeSkewedError(skew.Round(time.Millisecond))
+	}
+
+	mset.mu.RLock()
+	name, noAck, outq := mset.cfg.Name, mset.cfg.NoAck, mset.outq
+	mset.mu.RUnlock()
+
+	if !noAck && len(reply) > 0 && outq != nil {
+		resp := &JSPubAckResponse{PubAck: &PubAck{Stream: name}, Error: apiErr}
+		b, _ := json.Marshal(resp)
+		outq.sendMsg(reply, b)
+	}
+	return 0, apiErr
+}
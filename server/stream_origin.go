@@ -0,0 +1,108 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+// JSOrigin is the header the origin of a message is stored under for streams
+// that record it. The value is a JSON encoded MsgOrigin.
+const JSOrigin = "Nats-Origin"
+
+// Length of the hash of the remote IP of the publisher.
+const originIPHashLen = 12
+
+// MsgOrigin describes where a stored message came from, e.g. for forensic debugging.
+// Client details are only known when the publisher is connected to the stream leader,
+// otherwise only the account and time of receipt are recorded. The IP hash is salted
+// per server and account, so it only correlates publishers of an account on the server
+// since it started. The origin is not returned to readers unless they ask for it.
+type MsgOrigin struct {
+	Account  string    `json:"acc,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	ID       uint64    `json:"id,omitempty"`
+	IPHash   string    `json:"ip_hash,omitempty"`
+	Received time.Time `json:"received"`
+}
+
+// Returns the origin of a message received by us from the given client.
+func newMsgOrigin(c *client, acc *Account) *MsgOrigin {
+	mo := &MsgOrigin{Received: time.Now().UTC()}
+	switch c.kind {
+	case CLIENT, LEAF:
+		c.mu.Lock()
+		mo.Account, mo.Name, mo.ID = accForClient(c), c.opts.Name, c.cid
+		if c.host != _EMPTY_ && c.srv != nil {
+			mo.IPHash = getHashSize(c.srv.originSalt+mo.Account+c.host, originIPHashLen)
+		}
+		c.mu.Unlock()
+	default:
+		if acc != nil {
+			mo.Account = acc.Name
+		}
+	}
+	return mo
+}
+
+// addOriginHeader will record the origin in the header of a message. Any origin
+// set by the publisher is replaced.
+func addOriginHeader(hdr []byte, mo *MsgOrigin) []byte {
+	b, _ := json.Marshal(mo)
+	// Removal is done in place, so make sure we do not touch the inbound buffer.
+	if len(hdr) > 0 {
+		hdr = removeHeaderIfPresent(copyBytes(hdr), JSOrigin)
+	}
+	return genHeader(hdr, JSOrigin, string(b))
+}
+
+// removeOriginHeader returns the header without the origin of the message, for
+// readers that did not ask for it. The header is only copied if it changes.
+func removeOriginHeader(hdr []byte) []byte {
+	if len(getHeader(JSOrigin, hdr)) == 0 {
+		return hdr
+	}
+	return removeHeaderIfPresent(copyBytes(hdr), JSOrigin)
+}
+
+// stripOriginHeader removes the origin of a message before it is delivered to
+// a consumer that did not ask for it.
+func stripOriginHeader(pmsg *jsPubMsg) {
+	if len(getHeader(JSOrigin, pmsg.hdr)) == 0 {
+		return
+	}
+	hdr := removeOriginHeader(pmsg.hdr)
+	// The underlying buf is what gets sent, so replace it.
+	buf := make([]byte, 0, len(hdr)+len(pmsg.msg))
+	buf = append(buf, hdr...)
+	buf = append(buf, pmsg.msg...)
+	pmsg.buf, pmsg.hdr, pmsg.msg = buf, buf[:len(hdr)], buf[len(hdr):]
+}
+
+// Set if we should record the origin of inbound messages.
+func (mset *stream) setOrigin(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&mset.origin, v)
+}
+
+// Returns true if we record the origin of inbound messages.
+// Does not grab the stream lock since called from the inbound path.
+func (mset *stream) recordsOrigin() bool {
+	return atomic.LoadInt32(&mset.origin) == 1
+}
@@ -0,0 +1,345 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// The filtered consumers of a WorkQueue stream partition its subjects. Workers register with
+// the stream leader and heartbeat, and the leader assigns the partitions to the workers.
+// When workers join, leave or are lost, or consumers are added or removed, the partitions
+// are rebalanced and an advisory with the new assignments is sent. Assignments are sticky,
+// a partition only moves when needed to balance the workers.
+// A worker is bound to the client connection that registered it, so another client can not
+// heartbeat for it or make it leave. A worker that reconnects can register again once its
+// previous registration left or was lost.
+// The state is kept in memory on the stream leader, workers register again with a new leader.
+
+const (
+	// Default time after which a worker that did not heartbeat is considered lost.
+	defaultPartitionWorkerTTL = 10 * time.Second
+	// Shortest time allowed for workers to heartbeat.
+	minPartitionWorkerTTL = 250 * time.Millisecond
+)
+
+// Reasons for a partition rebalance.
+const (
+	PartitionRebalanceJoin      = "join"
+	PartitionRebalanceLeave     = "leave"
+	PartitionRebalanceLost      = "lost"
+	PartitionRebalanceConsumers = "consumers"
+)
+
+var (
+	errPartitionsNotWorkQueue = errors.New("partitions require a workqueue stream")
+	errPartitionWorkerBound   = errors.New("worker is registered by another connection")
+)
+
+// streamPartitions holds the workers and assignments of the partitions of a stream.
+type streamPartitions struct {
+	mu       sync.Mutex
+	mset     *stream
+	workers  map[string]*partitionWorker
+	assigned map[string]string // consumer -> worker
+	gen      uint64
+	tmr      *time.Timer
+}
+
+type partitionWorker struct {
+	conn string
+	ttl  time.Duration
+	last time.Time
+}
+
+// partitionConn identifies the client connection a worker is bound to.
+func (ci *ClientInfo) partitionConn() string {
+	return fmt.Sprintf("%s:%d", ci.Server, ci.ID)
+}
+
+// partitionGroup returns the partitions of the stream, creating them if needed.
+func (mset *stream) partitionGroup() (*streamPartitions, error) {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+	if mset.cfg.Retention != WorkQueuePolicy {
+		return nil, errPartitionsNotWorkQueue
+	}
+	if mset.partitions == nil {
+		mset.partitions = &streamPartitions{
+			mset:     mset,
+			workers:  make(map[string]*partitionWorker),
+			assigned: make(map[string]string),
+		}
+	}
+	return mset.partitions, nil
+}
+
+// partitionConsumers returns the names of the consumers that partition the stream.
+func (mset *stream) partitionConsumers() []string {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	var names []string
+	for name, o := range mset.consumers {
+		if o.cfg.FilterSubject != _EMPTY_ {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// heartbeat registers the worker or keeps it alive, and returns its partitions.
+func (sp *streamPartitions) heartbeat(worker, conn string, ttl time.Duration) (uint64, []string, error) {
+	if ttl <= 0 {
+		ttl = defaultPartitionWorkerTTL
+	} else if ttl < minPartitionWorkerTTL {
+		ttl = minPartitionWorkerTTL
+	}
+	consumers := sp.mset.partitionConsumers()
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	w, ok := sp.workers[worker]
+	if ok && w.conn != conn {
+		return 0, nil, errPartitionWorkerBound
+	}
+	if !ok {
+		w = &partitionWorker{conn: conn}
+		sp.workers[worker] = w
+	}
+	w.ttl, w.last = ttl, time.Now()
+	if !ok {
+		sp.rebalance(consumers, PartitionRebalanceJoin)
+	} else if sp.consumersChanged(consumers) {
+		sp.rebalance(consumers, PartitionRebalanceConsumers)
+	}
+	sp.resetTimer()
+	return sp.gen, sp.partitionsOf(worker), nil
+}
+
+// leave removes the worker, e.g. when it shuts down, so its partitions are reassigned right away.
+func (sp *streamPartitions) leave(worker, conn string) (uint64, error) {
+	consumers := sp.mset.partitionConsumers()
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if w, ok := sp.workers[worker]; ok {
+		if w.conn != conn {
+			return 0, errPartitionWorkerBound
+		}
+		delete(sp.workers, worker)
+		sp.rebalance(consumers, PartitionRebalanceLeave)
+	}
+	return sp.gen, nil
+}
+
+// assignments returns the partitions of all workers.
+func (sp *streamPartitions) assignments() (uint64, map[string][]string) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.gen, sp.assignmentsLocked()
+}
+
+// Lock should be held.
+func (sp *streamPartitions) assignmentsLocked() map[string][]string {
+	as := make(map[string][]string, len(sp.workers))
+	for worker := range sp.workers {
+		as[worker] = sp.partitionsOf(worker)
+	}
+	return as
+}
+
+// Lock should be held.
+func (sp *streamPartitions) partitionsOf(worker string) []string {
+	partitions := []string{}
+	for consumer, w := range sp.assigned {
+		if w == worker {
+			partitions = append(partitions, consumer)
+		}
+	}
+	sort.Strings(partitions)
+	return partitions
+}
+
+// Lock should be held.
+func (sp *streamPartitions) consumersChanged(consumers []string) bool {
+	if len(consumers) != len(sp.assigned) {
+		return true
+	}
+	for _, consumer := range consumers {
+		if _, ok := sp.assigned[consumer]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rebalance assigns the consumers to the current workers, moving as few partitions as possible.
+// Lock should be held.
+func (sp *streamPartitions) rebalance(consumers []string, reason string) {
+	current := sp.assigned
+	sp.assigned = make(map[string]string, len(consumers))
+	sp.gen++
+	defer sp.sendAdvisory(reason)
+
+	if len(sp.workers) == 0 {
+		return
+	}
+
+	// Keep the current assignments of workers that are still around.
+	counts := make(map[string]int, len(sp.workers))
+	var free []string
+	for _, consumer := range consumers {
+		if w, ok := current[consumer]; ok && sp.workers[w] != nil {
+			sp.assigned[consumer] = w
+			counts[w]++
+		} else {
+			free = append(free, consumer)
+		}
+	}
+
+	// Workers with the most partitions keep the extra ones.
+	workers := make([]string, 0, len(sp.workers))
+	for w := range sp.workers {
+		workers = append(workers, w)
+	}
+	sort.Slice(workers, func(i, j int) bool {
+		if counts[workers[i]] != counts[workers[j]] {
+			return counts[workers[i]] > counts[workers[j]]
+		}
+		return workers[i] < workers[j]
+	})
+	target := make(map[string]int, len(workers))
+	q, r := len(consumers)/len(workers), len(consumers)%len(workers)
+	for i, w := range workers {
+		target[w] = q
+		if i < r {
+			target[w]++
+		}
+	}
+
+	// Release what is above the target, highest names first to be predictable.
+	for i := len(consumers) - 1; i >= 0; i-- {
+		consumer := consumers[i]
+		if w, ok := sp.assigned[consumer]; ok && counts[w] > target[w] {
+			delete(sp.assigned, consumer)
+			counts[w]--
+			free = append(free, consumer)
+		}
+	}
+	sort.Strings(free)
+
+	// Assign what is free to the workers below their target.
+	for _, w := range workers {
+		for counts[w] < target[w] && len(free) > 0 {
+			sp.assigned[free[0]] = w
+			free = free[1:]
+			counts[w]++
+		}
+	}
+}
+
+// Lock should be held.
+func (sp *streamPartitions) sendAdvisory(reason string) {
+	mset := sp.mset
+	mset.mu.RLock()
+	name, outq := mset.cfg.Name, mset.outq
+	mset.mu.RUnlock()
+	if outq == nil {
+		return
+	}
+
+	m := JSStreamPartitionsAssignedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamPartitionsAssignedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:      name,
+		Generation:  sp.gen,
+		Reason:      reason,
+		Assignments: sp.assignmentsLocked(),
+		Domain:      mset.srv.getOpts().JetStreamDomain,
+	}
+	if j, err := json.Marshal(m); err == nil {
+		outq.sendMsg(JSAdvisoryStreamPartitionsPre+"."+name, j)
+	}
+}
+
+// resetTimer will check for lost workers once the first one is due.
+// Lock should be held.
+func (sp *streamPartitions) resetTimer() {
+	var next time.Duration
+	now := time.Now()
+	for _, w := range sp.workers {
+		if d := w.last.Add(w.ttl).Sub(now); next == 0 || d < next {
+			next = d
+		}
+	}
+	if len(sp.workers) == 0 {
+		if sp.tmr != nil {
+			sp.tmr.Stop()
+		}
+		return
+	}
+	if next <= 0 {
+		next = time.Millisecond
+	}
+	if sp.tmr == nil {
+		sp.tmr = time.AfterFunc(next, sp.checkWorkers)
+	} else {
+		sp.tmr.Reset(next)
+	}
+}
+
+// checkWorkers will remove the workers that did not heartbeat in time, and rebalance.
+// Consumers that were added or removed since the last rebalance are picked up here as well.
+func (sp *streamPartitions) checkWorkers() {
+	mset := sp.mset
+	mset.mu.RLock()
+	stale := mset.closed || !mset.isLeader()
+	mset.mu.RUnlock()
+	if stale {
+		mset.mu.Lock()
+		if mset.partitions == sp {
+			mset.partitions = nil
+		}
+		mset.mu.Unlock()
+		return
+	}
+	consumers := mset.partitionConsumers()
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	now, lost := time.Now(), false
+	for name, w := range sp.workers {
+		if now.Sub(w.last) >= w.ttl {
+			delete(sp.workers, name)
+			lost = true
+		}
+	}
+	if lost {
+		sp.rebalance(consumers, PartitionRebalanceLost)
+	} else if sp.consumersChanged(consumers) {
+		sp.rebalance(consumers, PartitionRebalanceConsumers)
+	}
+	sp.resetTimer()
+}
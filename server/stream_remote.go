@@ -0,0 +1,326 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StreamRemote ingests messages from another NATS deployment, e.g. one we do not control
+// and can not connect to with a leafnode. The stream leader maintains a client connection
+// to the remote servers and stores the messages published to the remote subjects.
+// Delivery is at most once, messages published while we are not connected are lost.
+// Remotes are either configured on the server by name, with the credentials to connect
+// with, or given by urls the server allows to connect to without credentials.
+type StreamRemote struct {
+	// Name of a remote configured on the server, see JSStreamRemoteOpts.
+	Name string `json:"name,omitempty"`
+	// Servers to connect to without credentials, e.g. "tls://demo.nats.io:4443".
+	URLs []string `json:"urls,omitempty"`
+	// Subjects to subscribe to on the remote, messages are stored with the remote subject.
+	Subjects []string `json:"subjects"`
+}
+
+// JSStreamRemoteOpts configure the remotes streams can ingest messages from.
+// Without them streams can not have remotes.
+type JSStreamRemoteOpts struct {
+	// Remotes streams can refer to by name.
+	Remotes map[string]*JSRemoteOpts
+	// Servers streams can connect to without credentials, matching scheme and host.
+	Allow []string
+}
+
+// JSRemoteOpts is a remote configured on the server.
+type JSRemoteOpts struct {
+	// Servers to connect to.
+	URLs []string
+	// Optional creds file, or user and password, or token.
+	Credentials string
+	User        string
+	Password    string
+	Token       string
+	// Optional TLS, e.g. the CA of the remote servers and a client certificate.
+	TLS *TLSConfigOpts
+	// Accounts whose streams can use this remote, any if empty.
+	Accounts []string
+}
+
+// How long to wait before trying to connect to the remote again.
+const streamRemoteRetryWait = 2 * time.Second
+
+// StreamRemoteInfo shows the state of the connection to the remote, only on the stream leader.
+type StreamRemoteInfo struct {
+	Connected bool   `json:"connected"`
+	URL       string `json:"url,omitempty"`
+	Received  uint64 `json:"received"`
+	Error     string `json:"error,omitempty"`
+}
+
+func validateJetStreamRemotes(o *Options) error {
+	ro := o.JetStreamRemotes
+	if ro == nil {
+		return nil
+	}
+	for name, r := range ro.Remotes {
+		if !isValidName(name) {
+			return fmt.Errorf("jetstream stream remote name %q is not valid", name)
+		}
+		if r == nil || len(r.URLs) == 0 {
+			return fmt.Errorf("jetstream stream remote %q requires urls", name)
+		}
+		if err := checkRemoteConnURLs(r.URLs); err != nil {
+			return fmt.Errorf("jetstream stream remote %q: %v", name, err)
+		}
+		if r.Credentials != _EMPTY_ && (r.User != _EMPTY_ || r.Token != _EMPTY_) {
+			return fmt.Errorf("jetstream stream remote %q credentials can not be combined with user or token", name)
+		}
+		if r.User != _EMPTY_ && r.Token != _EMPTY_ {
+			return fmt.Errorf("jetstream stream remote %q user can not be combined with token", name)
+		}
+	}
+	if err := checkRemoteConnURLs(ro.Allow); err != nil {
+		return fmt.Errorf("jetstream stream remotes allowed %v", err)
+	}
+	return nil
+}
+
+// Check the remote config for a stream.
+func checkStreamRemote(s *Server, cfg *StreamConfig, acc *Account) error {
+	rm := cfg.Remote
+	if cfg.Mirror != nil {
+		return errors.New("stream remote not allowed on mirror")
+	}
+	if rm.Name == _EMPTY_ && len(rm.URLs) == 0 {
+		return errors.New("stream remote requires a name or urls")
+	}
+	if rm.Name != _EMPTY_ && len(rm.URLs) > 0 {
+		return errors.New("stream remote name can not be combined with urls")
+	}
+	if err := checkRemoteConnURLs(rm.URLs); err != nil {
+		return fmt.Errorf("stream remote %v", err)
+	}
+	if len(rm.Subjects) == 0 {
+		return errors.New("stream remote requires subjects")
+	}
+	for _, subj := range rm.Subjects {
+		if !IsValidSubject(subj) {
+			return fmt.Errorf("stream remote subject %q is invalid", subj)
+		}
+	}
+	// The server config may have changed since the stream was created, we will
+	// report that once we try to connect.
+	if js := s.getJetStream(); js != nil && js.isMetaRecovering() {
+		return nil
+	}
+	var accName string
+	if acc != nil {
+		accName = acc.Name
+	}
+	_, err := resolveStreamRemote(s.getOpts().JetStreamRemotes, rm, accName)
+	return err
+}
+
+// resolveStreamRemote returns the remote of a stream as configured on the server,
+// or an error if the server does not allow it for the account.
+func resolveStreamRemote(ro *JSStreamRemoteOpts, rm *StreamRemote, accName string) (*JSRemoteOpts, error) {
+	if ro == nil {
+		return nil, errors.New("stream remotes are not enabled on the server")
+	}
+	if rm.Name != _EMPTY_ {
+		r := ro.Remotes[rm.Name]
+		if r == nil {
+			return nil, fmt.Errorf("stream remote %q is not configured on the server", rm.Name)
+		}
+		if len(r.Accounts) > 0 {
+			var allowed bool
+			for _, a := range r.Accounts {
+				if a == accName {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return nil, fmt.Errorf("stream remote %q is not allowed for account %q", rm.Name, accName)
+			}
+		}
+		return r, nil
+	}
+	for _, u := range rm.URLs {
+		if !isAllowedStreamRemoteURL(ro.Allow, u) {
+			return nil, fmt.Errorf("stream remote url %q is not allowed by the server", u)
+		}
+	}
+	return &JSRemoteOpts{URLs: rm.URLs}, nil
+}
+
+// isAllowedStreamRemoteURL returns true if the url matches the scheme and host of an allowed url.
+func isAllowedStreamRemoteURL(allow []string, u string) bool {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	for _, a := range allow {
+		au, err := url.Parse(a)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(pu.Scheme, au.Scheme) && strings.EqualFold(pu.Host, au.Host) && pu.User == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// streamRemote is the connection to the remote of a stream leader.
+type streamRemote struct {
+	mu       sync.Mutex
+	cfg      StreamRemote
+	rc       *remoteConn
+	err      string
+	received uint64
+}
+
+// startRemote will connect to the remote, the connection is made in a separate go routine.
+// Lock should be held.
+func (mset *stream) startRemote(cfg *StreamRemote) {
+	if cfg == nil || mset.remote != nil {
+		return
+	}
+	r := &streamRemote{cfg: *cfg}
+	mset.remote = r
+	s, accName, name := mset.srv, mset.acc.Name, mset.cfg.Name
+
+	// The server config could have changed since the stream was created.
+	ro, err := resolveStreamRemote(s.getOpts().JetStreamRemotes, &r.cfg, accName)
+	if err != nil {
+		r.setErr(err)
+		s.Warnf("JetStream stream '%s > %s' can not connect to remote: %v", accName, name, err)
+		return
+	}
+	var tlsConfig *tls.Config
+	if ro.TLS != nil {
+		if tlsConfig, err = GenTLSConfig(ro.TLS); err != nil {
+			r.setErr(err)
+			s.Warnf("JetStream stream '%s > %s' can not connect to remote: %v", accName, name, err)
+			return
+		}
+		// We are the client, the CA is used to verify the remote servers.
+		tlsConfig.RootCAs = tlsConfig.ClientCAs
+	}
+	r.rc = s.newRemoteConn(&remoteConnOpts{
+		name:          fmt.Sprintf("JetStream remote for '%s > %s'", accName, name),
+		urls:          ro.URLs,
+		credentials:   ro.Credentials,
+		user:          ro.User,
+		password:      ro.Password,
+		token:         ro.Token,
+		tlsConfig:     tlsConfig,
+		reconnectWait: streamRemoteRetryWait,
+		subjects:      r.cfg.Subjects,
+		handler: func(subject, _ string, hdr, msg []byte) {
+			mset.processRemoteMsg(r, subject, hdr, msg)
+		},
+		connected: func() { r.setErr(nil) },
+		errored: func(err error) {
+			r.setErr(err)
+			s.RateLimitWarnf("JetStream stream '%s > %s' remote error: %v", accName, name, err)
+		},
+	})
+}
+
+// stopRemote will close our connection to the remote.
+// Lock should be held.
+func (mset *stream) stopRemote() {
+	if r := mset.remote; r != nil {
+		mset.remote = nil
+		if r.rc != nil {
+			r.rc.close()
+		}
+	}
+}
+
+// updateRemote will reconnect if the remote config changed.
+// Lock should be held.
+func (mset *stream) updateRemote(old, new *StreamRemote) {
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+	mset.stopRemote()
+	mset.startRemote(new)
+}
+
+func (r *streamRemote) setErr(err error) {
+	r.mu.Lock()
+	if err != nil {
+		r.err = err.Error()
+	} else {
+		r.err = _EMPTY_
+	}
+	r.mu.Unlock()
+}
+
+func (r *streamRemote) info() *StreamRemoteInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ri := &StreamRemoteInfo{Received: atomic.LoadUint64(&r.received), Error: r.err}
+	if r.rc != nil {
+		ri.URL = r.rc.connectedURL()
+		ri.Connected = ri.URL != _EMPTY_
+	}
+	return ri
+}
+
+// remoteInfo returns the state of our remote, nil if we have none or are not the leader.
+func (mset *stream) remoteInfo() *StreamRemoteInfo {
+	mset.mu.RLock()
+	r := mset.remote
+	mset.mu.RUnlock()
+	if r == nil {
+		return nil
+	}
+	return r.info()
+}
+
+// processRemoteMsg will store a message received from the remote.
+func (mset *stream) processRemoteMsg(r *streamRemote, subject string, hdr, msg []byte) {
+	mset.mu.RLock()
+	node, current := mset.node, mset.remote == r
+	mset.mu.RUnlock()
+	if !current {
+		return
+	}
+	atomic.AddUint64(&r.received, 1)
+
+	// The remote is not trusted with our JetStream headers, e.g. rollups, expectations or message ids.
+	hdr = removeHeadersWithPrefix(hdr, "Nats-")
+	var err error
+	// If we are clustered we need to propose this message to the underlying raft group.
+	if node != nil {
+		err = mset.processClusteredInboundMsg(subject, _EMPTY_, hdr, msg, false)
+	} else {
+		err = mset.processJetStreamMsg(subject, _EMPTY_, hdr, msg, 0, 0, false)
+	}
+	if err != nil {
+		mset.srv.RateLimitWarnf("Error processing inbound remote message for '%s' > '%s': %v",
+			mset.accName(), mset.name(), err)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StreamResumeToken identifies an upstream stream to mirrors and sources.
+// It is returned with the info of their direct consumers and lets them
+// detect when the upstream stream was reset since they last resumed from it.
+type StreamResumeToken struct {
+	Created  time.Time `json:"created"`
+	FirstSeq uint64    `json:"first_seq"`
+}
+
+// File in the stream directory where we keep the resume tokens of our upstream streams.
+const streamResumeFile = "resume.inf"
+
+// isReset returns true if nt does not describe the same upstream stream as t.
+// Either the stream was recreated, or its first sequence went backwards which
+// can only happen if it was restored or otherwise reset.
+func (t *StreamResumeToken) isReset(nt *StreamResumeToken) bool {
+	if t == nil || nt == nil {
+		return false
+	}
+	return !t.Created.Equal(nt.Created) || nt.FirstSeq < t.FirstSeq
+}
+
+// resumeToken returns the token for our stream that is handed to mirrors and sources.
+func (mset *stream) resumeToken() *StreamResumeToken {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if mset.store == nil {
+		return nil
+	}
+	var state StreamState
+	mset.store.FastState(&state)
+	return &StreamResumeToken{Created: mset.created, FirstSeq: state.FirstSeq}
+}
+
+// Key we keep the resume token for the sourceInfo under.
+// Mirrors do not have an index name.
+func (si *sourceInfo) resumeKey() string {
+	if si.iname != _EMPTY_ {
+		return si.iname
+	}
+	return si.name
+}
+
+// Will load our resume tokens if needed. For file based streams they survive restarts.
+// Lock should be held.
+func (mset *stream) loadResumeTokens() {
+	if mset.rtoks != nil {
+		return
+	}
+	mset.rtoks = make(map[string]*StreamResumeToken)
+	if fs, ok := mset.store.(*fileStore); ok {
+		if b, err := os.ReadFile(filepath.Join(fs.fcfg.StoreDir, streamResumeFile)); err == nil {
+			// A corrupt file means we can not detect upstream resets until we have new tokens.
+			if err := json.Unmarshal(b, &mset.rtoks); err != nil {
+				mset.srv.Warnf("Error loading resume tokens for '%s > %s': %v", mset.acc.Name, mset.cfg.Name, err)
+				mset.rtoks = make(map[string]*StreamResumeToken)
+			}
+		}
+	}
+}
+
+// Will persist our resume tokens for file based streams.
+// Lock should be held.
+func (mset *stream) storeResumeTokens() {
+	fs, ok := mset.store.(*fileStore)
+	if !ok {
+		return
+	}
+	b, _ := json.Marshal(mset.rtoks)
+	if err := os.WriteFile(filepath.Join(fs.fcfg.StoreDir, streamResumeFile), b, defaultFilePerms); err != nil {
+		mset.srv.Warnf("Error storing resume tokens for '%s > %s': %v", mset.acc.Name, mset.cfg.Name, err)
+	}
+}
+
+// checkResumeToken is called with the token of the upstream stream when a direct consumer for
+// the mirror or source has been created. Returns true if the upstream stream was reset.
+// Unless we need to reset our own state first, nt becomes our token for the upstream stream.
+// Lock should be held.
+func (mset *stream) checkResumeToken(si *sourceInfo, nt *StreamResumeToken) bool {
+	// Upstream server does not know about resume tokens.
+	if nt == nil {
+		return false
+	}
+	mset.loadResumeTokens()
+	key := si.resumeKey()
+	reset := mset.rtoks[key].isReset(nt)
+	if reset && si == mset.mirror {
+		var state StreamState
+		mset.store.FastState(&state)
+		// We hold on to the old token until our own messages are gone, so that
+		// we keep detecting the reset if we retry before that has happened.
+		if state.Msgs > 0 || state.LastSeq > 0 {
+			return true
+		}
+		// Nothing to do.
+		reset = false
+	}
+	mset.rtoks[key] = nt
+	mset.storeResumeTokens()
+	return reset
+}
+
+// resetMirror will remove all of our messages since our upstream stream was reset
+// and we need to mirror it again from the start to keep the sequences aligned.
+// Lock should be held.
+func (mset *stream) resetMirror() {
+	if node := mset.node; node != nil {
+		var state StreamState
+		mset.store.FastState(&state)
+		node.Propose(encodeStreamPurge(&streamPurge{Stream: mset.cfg.Name, LastSeq: state.LastSeq, Reset: true}))
+		return
+	}
+	mset.resetStore()
+}
+
+// resetStore will remove all messages and set our sequences back to zero.
+// Lock should be held.
+func (mset *stream) resetStore() {
+	if mset.store == nil {
+		return
+	}
+	if err := mset.store.Truncate(0); err != nil {
+		mset.srv.Warnf("Error resetting '%s > %s': %v", mset.acc.Name, mset.cfg.Name, err)
+		return
+	}
+	mset.lseq, mset.clfs = 0, 0
+	if mset.mirror != nil {
+		mset.mirror.sseq, mset.mirror.dseq = 0, 0
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+)
+
+// previewLimits returns the limits to preview, the current ones of the stream for those not in the request.
+func (mset *stream) previewLimits(req *JSApiStreamRetentionPreviewRequest) (maxAge time.Duration, maxMsgs, maxBytes int64) {
+	mset.mu.RLock()
+	maxAge, maxMsgs, maxBytes = mset.cfg.MaxAge, mset.cfg.MaxMsgs, mset.cfg.MaxBytes
+	mset.mu.RUnlock()
+
+	if req.MaxAge < 0 {
+		maxAge = 0
+	} else if req.MaxAge > 0 {
+		maxAge = req.MaxAge
+	}
+	if req.MaxMsgs < 0 {
+		maxMsgs = -1
+	} else if req.MaxMsgs > 0 {
+		maxMsgs = req.MaxMsgs
+	}
+	if req.MaxBytes < 0 {
+		maxBytes = -1
+	} else if req.MaxBytes > 0 {
+		maxBytes = req.MaxBytes
+	}
+	return maxAge, maxMsgs, maxBytes
+}
+
+// previewRetention returns how many messages and bytes the limits would remove from the stream,
+// and what the first sequence would be. Limits always remove the oldest messages first, so we
+// walk the stream from the start until a message would be kept under all limits.
+func (mset *stream) previewRetention(maxAge time.Duration, maxMsgs, maxBytes int64) (msgs, bytes, firstSeq uint64, err error) {
+	store := mset.Store()
+	if store == nil {
+		return 0, 0, 0, ErrStoreClosed
+	}
+	var state StreamState
+	store.FastState(&state)
+	firstSeq = state.FirstSeq
+
+	var minTs int64
+	if maxAge > 0 {
+		minTs = time.Now().Add(-maxAge).UnixNano()
+	}
+	msgSize := memStoreMsgSize
+	if store.Type() == FileStorage {
+		msgSize = fileStoreMsgSize
+	}
+
+	remaining, rbytes := state.Msgs, state.Bytes
+	var smv StoreMsg
+	for seq := state.FirstSeq; remaining > 0; {
+		sm, _, err := store.LoadNextMsg(fwcs, true, seq, &smv)
+		if err == ErrStoreEOF {
+			break
+		} else if err != nil {
+			return 0, 0, 0, err
+		}
+		firstSeq = sm.seq
+		if !(maxMsgs > 0 && remaining > uint64(maxMsgs) ||
+			maxBytes > 0 && rbytes > uint64(maxBytes) ||
+			minTs > 0 && sm.ts < minTs) {
+			break
+		}
+		sz := msgSize(sm.subj, sm.hdr, sm.msg)
+		msgs++
+		bytes += sz
+		remaining--
+		if sz > rbytes {
+			rbytes = 0
+		} else {
+			rbytes -= sz
+		}
+		seq = sm.seq + 1
+		firstSeq = seq
+	}
+	return msgs, bytes, firstSeq, nil
+}
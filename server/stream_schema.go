@@ -0,0 +1,358 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// StreamSchema is for validating messages published to a stream.
+// Messages failing validation are rejected, or if InvalidSubject is set,
+// published to that subject instead, e.g. to be stored in another stream.
+type StreamSchema struct {
+	// JSON schema the payloads need to conform to. Only a subset of JSON Schema is
+	// supported: type, properties, required, additionalProperties, items, enum,
+	// minimum, maximum, minLength, maxLength, minItems and maxItems. Other keywords
+	// are rejected, except for annotations such as title and description.
+	JSON json.RawMessage `json:"json_schema,omitempty"`
+	// Name of a validator registered with RegisterStreamValidator.
+	Validator      string `json:"validator,omitempty"`
+	InvalidSubject string `json:"invalid_subject,omitempty"`
+}
+
+// StreamValidator is a pluggable validator for messages published to a stream.
+// Returning an error will mark the message as invalid. Validators are called
+// synchronously on the stream leader for each published message.
+type StreamValidator func(stream, subject string, hdr, msg []byte) error
+
+// Headers added to messages routed to the invalid subject.
+const (
+	JSInvalidStream  = "Nats-Invalid-Stream"
+	JSInvalidSubject = "Nats-Invalid-Subject"
+	JSInvalidReason  = "Nats-Invalid-Reason"
+)
+
+// RegisterStreamValidator will register a validator that streams can refer to
+// by name in their schema. Passing a nil validator will remove it.
+func (s *Server) RegisterStreamValidator(name string, v StreamValidator) {
+	if v == nil {
+		s.validators.Delete(name)
+	} else {
+		s.validators.Store(name, v)
+	}
+}
+
+// Returns the named validator, or nil.
+func (s *Server) streamValidator(name string) StreamValidator {
+	v, _ := s.validators.Load(name)
+	sv, _ := v.(StreamValidator)
+	return sv
+}
+
+// checkStreamSchema will make sure the schema config is valid for the stream.
+func checkStreamSchema(cfg *StreamConfig) error {
+	sc := cfg.Schema
+	if cfg.Mirror != nil {
+		return errors.New("stream mirrors can not have a schema")
+	}
+	if len(sc.JSON) == 0 && sc.Validator == _EMPTY_ {
+		return errors.New("stream schema requires a json schema or a validator")
+	}
+	if len(sc.JSON) > 0 {
+		if _, err := compileJSONSchema(sc.JSON); err != nil {
+			return fmt.Errorf("stream schema is invalid: %v", err)
+		}
+	}
+	if sc.InvalidSubject != _EMPTY_ {
+		if !IsValidLiteralSubject(sc.InvalidSubject) {
+			return errors.New("stream schema invalid subject must be a valid literal subject")
+		}
+		for _, subj := range cfg.Subjects {
+			if SubjectsCollide(sc.InvalidSubject, subj) {
+				return errors.New("stream schema invalid subject forms a cycle")
+			}
+		}
+	}
+	return nil
+}
+
+// Compiled form of the stream schema.
+type streamSchema struct {
+	json      *jsonSchema
+	validator string
+	isubj     string
+}
+
+func newStreamSchema(sc *StreamSchema) (*streamSchema, error) {
+	if sc == nil {
+		return nil, nil
+	}
+	ss := &streamSchema{validator: sc.Validator, isubj: sc.InvalidSubject}
+	if len(sc.JSON) > 0 {
+		js, err := compileJSONSchema(sc.JSON)
+		if err != nil {
+			return nil, err
+		}
+		ss.json = js
+	}
+	return ss, nil
+}
+
+// checkSchema will validate a message from a publisher. If the message is invalid
+// we will respond with an error or route it to the invalid subject and return an error.
+// Lock should not be held.
+func (mset *stream) checkSchema(subject, reply string, hdr, msg []byte) error {
+	mset.mu.RLock()
+	ss, name, noAck, outq, s := mset.schema, mset.cfg.Name, mset.cfg.NoAck, mset.outq, mset.srv
+	mset.mu.RUnlock()
+
+	if ss == nil {
+		return nil
+	}
+
+	var err error
+	if ss.json != nil {
+		err = ss.json.validateMsg(msg)
+	}
+	if err == nil && ss.validator != _EMPTY_ {
+		if v := s.streamValidator(ss.validator); v != nil {
+			err = v(name, subject, hdr, msg)
+		} else {
+			err = fmt.Errorf("validator %q not registered", ss.validator)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	// Route to the invalid subject, whoever stores it will respond to the publisher.
+	if ss.isubj != _EMPTY_ {
+		reason := strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+		nhdr := genHeader(copyBytes(hdr), JSInvalidStream, name)
+		nhdr = genHeader(nhdr, JSInvalidSubject, subject)
+		nhdr = genHeader(nhdr, JSInvalidReason, reason)
+		outq.send(newJSPubMsg(ss.isubj, _EMPTY_, reply, nhdr, copyBytes(msg), nil, 0))
+		return NewJSStreamMsgInvalidError(err)
+	}
+
+	apiErr := NewJSStreamMsgInvalidError(err)
+	if !noAck && len(reply) > 0 {
+		resp := &JSPubAckResponse{PubAck: &PubAck{Stream: name}, Error: apiErr}
+		b, _ := json.Marshal(resp)
+		outq.sendMsg(reply, b)
+	}
+	return apiErr
+}
+
+// jsonSchema is the supported subset of JSON Schema.
+type jsonSchema struct {
+	Type                 jsonSchemaTypes        `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	// Annotations, which do not affect validation.
+	Schema      json.RawMessage `json:"$schema,omitempty"`
+	ID          json.RawMessage `json:"$id,omitempty"`
+	Comment     json.RawMessage `json:"$comment,omitempty"`
+	Title       json.RawMessage `json:"title,omitempty"`
+	Description json.RawMessage `json:"description,omitempty"`
+	Default     json.RawMessage `json:"default,omitempty"`
+	Examples    json.RawMessage `json:"examples,omitempty"`
+}
+
+// jsonSchemaTypes can be a single type or a list of types.
+type jsonSchemaTypes []string
+
+func (t *jsonSchemaTypes) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = jsonSchemaTypes{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return errors.New("type must be a string or an array of strings")
+	}
+	*t = many
+	return nil
+}
+
+var jsonSchemaKnownTypes = map[string]struct{}{
+	"null": {}, "boolean": {}, "object": {}, "array": {}, "number": {}, "integer": {}, "string": {},
+}
+
+func compileJSONSchema(b []byte) (*jsonSchema, error) {
+	var js jsonSchema
+	// Keywords we do not support would otherwise silently not be enforced.
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&js); err != nil {
+		return nil, err
+	}
+	if err := js.check(); err != nil {
+		return nil, err
+	}
+	return &js, nil
+}
+
+// check will make sure the schema only uses known types.
+func (js *jsonSchema) check() error {
+	for _, t := range js.Type {
+		if _, ok := jsonSchemaKnownTypes[t]; !ok {
+			return fmt.Errorf("unknown type %q", t)
+		}
+	}
+	for _, p := range js.Properties {
+		if p == nil {
+			continue
+		}
+		if err := p.check(); err != nil {
+			return err
+		}
+	}
+	if js.Items != nil {
+		return js.Items.check()
+	}
+	return nil
+}
+
+// validateMsg will validate that the payload is JSON conforming to the schema.
+func (js *jsonSchema) validateMsg(msg []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(msg, &v); err != nil {
+		return errors.New("payload is not valid JSON")
+	}
+	return js.validate("$", v)
+}
+
+func (js *jsonSchema) validate(path string, v interface{}) error {
+	if len(js.Type) > 0 {
+		var ok bool
+		for _, t := range js.Type {
+			if jsonSchemaIsType(t, v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s: expected %s", path, strings.Join(js.Type, " or "))
+		}
+	}
+	if len(js.Enum) > 0 {
+		var ok bool
+		for _, e := range js.Enum {
+			if reflect.DeepEqual(e, v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s: value not in enum", path)
+		}
+	}
+
+	switch tv := v.(type) {
+	case float64:
+		if js.Minimum != nil && tv < *js.Minimum {
+			return fmt.Errorf("%s: %v is less than minimum %v", path, tv, *js.Minimum)
+		}
+		if js.Maximum != nil && tv > *js.Maximum {
+			return fmt.Errorf("%s: %v is greater than maximum %v", path, tv, *js.Maximum)
+		}
+	case string:
+		l := utf8.RuneCountInString(tv)
+		if js.MinLength != nil && l < *js.MinLength {
+			return fmt.Errorf("%s: length %d is less than minLength %d", path, l, *js.MinLength)
+		}
+		if js.MaxLength != nil && l > *js.MaxLength {
+			return fmt.Errorf("%s: length %d is greater than maxLength %d", path, l, *js.MaxLength)
+		}
+	case []interface{}:
+		if js.MinItems != nil && len(tv) < *js.MinItems {
+			return fmt.Errorf("%s: %d items is less than minItems %d", path, len(tv), *js.MinItems)
+		}
+		if js.MaxItems != nil && len(tv) > *js.MaxItems {
+			return fmt.Errorf("%s: %d items is greater than maxItems %d", path, len(tv), *js.MaxItems)
+		}
+		if js.Items != nil {
+			for i, item := range tv {
+				if err := js.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, r := range js.Required {
+			if _, ok := tv[r]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, r)
+			}
+		}
+		// Sort for stable errors.
+		keys := make([]string, 0, len(tv))
+		for k := range tv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p, ok := js.Properties[k]
+			if !ok {
+				if js.AdditionalProperties != nil && !*js.AdditionalProperties {
+					return fmt.Errorf("%s: property %q is not allowed", path, k)
+				}
+				continue
+			}
+			if p == nil {
+				continue
+			}
+			if err := p.validate(path+"."+k, tv[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func jsonSchemaIsType(t string, v interface{}) bool {
+	switch tv := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case float64:
+		return t == "number" || t == "integer" && tv == math.Trunc(tv)
+	case []interface{}:
+		return t == "array"
+	case map[string]interface{}:
+		return t == "object"
+	}
+	return false
+}
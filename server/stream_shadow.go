@@ -0,0 +1,83 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+)
+
+// StreamShadow forwards a sample of the messages a stream ingests as they are stored,
+// e.g. to feed a staging environment with real traffic. Shadowed messages are sent by the
+// stream leader on a best effort basis and are not tracked.
+type StreamShadow struct {
+	// Subject the sampled messages are published to.
+	Subject string `json:"subject"`
+	// Optional account to forward to. It needs to import the subject from our account.
+	Account string `json:"account,omitempty"`
+	// Percentage of messages to forward, zero pauses forwarding.
+	Sample int `json:"sample"`
+}
+
+// Check the shadow config for a stream.
+func checkStreamShadow(s *Server, cfg *StreamConfig, acc *Account) error {
+	sh := cfg.Shadow
+	if sh.Sample < 0 || sh.Sample > 100 {
+		return errors.New("stream shadow sample needs to be between 0 and 100")
+	}
+	if !IsValidLiteralSubject(sh.Subject) {
+		return errors.New("stream shadow subject must be a valid literal subject")
+	}
+	for _, subj := range cfg.Subjects {
+		if SubjectsCollide(sh.Subject, subj) {
+			return errors.New("stream shadow subject forms a cycle")
+		}
+	}
+	if sh.Account != _EMPTY_ && acc != nil && sh.Account != acc.Name {
+		sacc, err := s.lookupAccount(sh.Account)
+		if err != nil {
+			return fmt.Errorf("stream shadow account %q not found", sh.Account)
+		}
+		if !sacc.importsStreamFrom(acc, sh.Subject) {
+			return fmt.Errorf("stream shadow account %q does not import %q", sh.Account, sh.Subject)
+		}
+	}
+	return nil
+}
+
+// importsStreamFrom returns true if we import the subject as a stream from the given account.
+func (a *Account) importsStreamFrom(src *Account, subject string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, si := range a.imports.streams {
+		if !si.invalid && si.acc != nil && si.acc.Name == src.Name && subjectIsSubsetMatch(subject, si.from) {
+			return true
+		}
+	}
+	return false
+}
+
+// shadowMsg will forward the message to our shadow subject if it is sampled.
+// Messages for other accounts flow through their import of the subject.
+func (mset *stream) shadowMsg(sh *StreamShadow, name, subject string, hdr, msg []byte, seq uint64) {
+	if sh.Sample <= 0 || sh.Sample < 100 && rand.Intn(100) >= sh.Sample {
+		return
+	}
+	nhdr := genHeader(copyBytes(hdr), JSStream, name)
+	nhdr = genHeader(nhdr, JSSubject, subject)
+	nhdr = genHeader(nhdr, JSSequence, strconv.FormatUint(seq, 10))
+	mset.outq.send(newJSPubMsg(sh.Subject, _EMPTY_, _EMPTY_, nhdr, copyBytes(msg), nil, 0))
+}
@@ -0,0 +1,325 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// Removals of consecutive sequences within this window are recorded as a single tombstone.
+const tombstoneCoalesceWindow = time.Second
+
+// Most tombstones we keep per stream, the oldest ones are dropped first.
+const streamTombstonesMax = 100_000
+
+// Most removed ranges we send in a single advisory.
+const tombstoneAdvisoryMax = 1000
+
+// File in the stream directory where we keep the tombstones of file based streams.
+const streamTombstonesFile = "tombstones.inf"
+
+// Tombstone records that a range of stream sequences was removed, either by
+// the retention policy, a delete or a purge. Clients and mirrors doing gap
+// detection can use them to tell removed messages from lost ones.
+type Tombstone struct {
+	First uint64    `json:"first_seq"`
+	Last  uint64    `json:"last_seq"`
+	Time  time.Time `json:"ts"`
+}
+
+// streamTombstones holds the tombstones of a stream. It has its own lock since
+// removals are reported by the store while the stream lock may be held.
+// Removals are collected for a coalesce window, then sent as a single advisory and,
+// for file based streams, written to the stream directory.
+type streamTombstones struct {
+	mu     sync.Mutex
+	stream string
+	domain string
+	ttl    time.Duration
+	leader bool
+	outq   *jsOutQ
+	ts     []*Tombstone
+	pend   []*Tombstone
+	file   string
+	dirty  bool
+	timer  *time.Timer
+}
+
+func newStreamTombstones(stream, domain string, ttl time.Duration) *streamTombstones {
+	return &streamTombstones{stream: stream, domain: domain, ttl: ttl}
+}
+
+// setRetention will set how long we keep tombstones, zero disables them.
+func (st *streamTombstones) setRetention(ttl time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.ttl = ttl
+	if ttl == 0 {
+		st.ts, st.pend = nil, nil
+	} else {
+		st.expire(time.Now())
+	}
+	st.markDirty()
+}
+
+// load will load the tombstones of a file based stream from the given file, which is
+// where we keep them from now on.
+func (st *streamTombstones) load(file string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.file = file
+	if st.ttl == 0 {
+		os.Remove(file)
+		return
+	}
+	if b, err := os.ReadFile(file); err == nil {
+		json.Unmarshal(b, &st.ts)
+		st.expire(time.Now())
+	}
+}
+
+// stop will stop collecting removals, and write what we have unless the stream is being deleted.
+func (st *streamTombstones) stop(store bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	st.pend = nil
+	if store && st.dirty {
+		st.store()
+	}
+	st.file = _EMPTY_
+}
+
+// enabled returns true if we keep tombstones.
+func (st *streamTombstones) enabled() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.ttl > 0
+}
+
+// setLeader will set if we send advisories for removals, only the leader does.
+func (st *streamTombstones) setLeader(isLeader bool, outq *jsOutQ) {
+	st.mu.Lock()
+	st.leader, st.outq = isLeader, outq
+	st.mu.Unlock()
+}
+
+// record will add a tombstone for the removed sequences.
+func (st *streamTombstones) record(first, last uint64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.ttl == 0 || first == 0 || last < first {
+		return
+	}
+	now := time.Now().UTC()
+	st.expire(now)
+
+	st.ts = appendTombstone(st.ts, first, last, now)
+	if len(st.ts) > streamTombstonesMax {
+		st.ts[0] = nil
+		st.ts = st.ts[1:]
+	}
+	if st.leader {
+		st.pend = appendTombstone(st.pend, first, last, now)
+	}
+	st.markDirty()
+}
+
+// Adds the removed range to the tombstones, extending the last one if it continues it
+// and was recorded within our coalesce window.
+func appendTombstone(ts []*Tombstone, first, last uint64, now time.Time) []*Tombstone {
+	if n := len(ts); n > 0 && ts[n-1].Last+1 == first && now.Sub(ts[n-1].Time) < tombstoneCoalesceWindow {
+		ts[n-1].Last = last
+		return ts
+	}
+	return append(ts, &Tombstone{First: first, Last: last, Time: now})
+}
+
+// Will flush what changed once our coalesce window has passed.
+// Lock should be held.
+func (st *streamTombstones) markDirty() {
+	st.dirty = true
+	if st.timer == nil && (st.file != _EMPTY_ || len(st.pend) > 0) {
+		st.timer = time.AfterFunc(tombstoneCoalesceWindow, st.flush)
+	}
+}
+
+// flush will send the advisories for what was removed since the last flush,
+// and write our tombstones if we keep them in a file.
+func (st *streamTombstones) flush() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.timer == nil {
+		// Stopped.
+		return
+	}
+	st.timer = nil
+	for len(st.pend) > 0 {
+		n := len(st.pend)
+		if n > tombstoneAdvisoryMax {
+			n = tombstoneAdvisoryMax
+		}
+		st.sendAdvisory(st.pend[:n])
+		st.pend = st.pend[n:]
+	}
+	st.pend = nil
+	if st.dirty {
+		st.store()
+	}
+}
+
+// Will write our tombstones if we keep them in a file.
+// Lock should be held.
+func (st *streamTombstones) store() {
+	st.dirty = false
+	if st.file == _EMPTY_ {
+		return
+	}
+	if len(st.ts) == 0 {
+		os.Remove(st.file)
+		return
+	}
+	b, _ := json.Marshal(st.ts)
+	os.WriteFile(st.file, b, defaultFilePerms)
+}
+
+// Drop tombstones past our retention. They are kept in the order they were recorded.
+// Lock should be held.
+func (st *streamTombstones) expire(now time.Time) {
+	var i int
+	for i < len(st.ts) && now.Sub(st.ts[i].Time) > st.ttl {
+		st.ts[i] = nil
+		i++
+	}
+	if i > 0 {
+		st.ts = st.ts[i:]
+	}
+}
+
+// get returns copies of the tombstones that overlap with the given range, in the order they were recorded.
+// A zero end means up to the last sequence.
+func (st *streamTombstones) get(start, end uint64) []*Tombstone {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.expire(time.Now())
+
+	ts := make([]*Tombstone, 0, len(st.ts))
+	for _, t := range st.ts {
+		if t.Last < start || (end > 0 && t.First > end) {
+			continue
+		}
+		tc := *t
+		ts = append(ts, &tc)
+	}
+	return ts
+}
+
+// Lock should be held.
+func (st *streamTombstones) sendAdvisory(removed []*Tombstone) {
+	if st.outq == nil || !st.leader {
+		return
+	}
+	first, last := removed[0].First, removed[0].Last
+	for _, t := range removed[1:] {
+		if t.First < first {
+			first = t.First
+		}
+		if t.Last > last {
+			last = t.Last
+		}
+	}
+	m := JSStreamMsgDeletedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamMsgDeletedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:  st.stream,
+		First:   first,
+		Last:    last,
+		Removed: removed,
+		Domain:  st.domain,
+	}
+	if j, err := json.Marshal(m); err == nil {
+		st.outq.sendMsg(JSAdvisoryStreamMsgDeletedPre+"."+st.stream, j)
+	}
+}
+
+// tombstones returns our tombstones overlapping with the given range.
+func (mset *stream) tombstones(start, end uint64) []*Tombstone {
+	if mset.tombs == nil {
+		return []*Tombstone{}
+	}
+	return mset.tombs.get(start, end)
+}
+
+// filteredSeqs returns the sequences of the messages on the subject.
+func (mset *stream) filteredSeqs(subject string) []uint64 {
+	mset.mu.RLock()
+	store := mset.store
+	mset.mu.RUnlock()
+
+	var seqs []uint64
+	var smv StoreMsg
+	wc := subjectHasWildcard(subject)
+	for seq := uint64(0); ; seq++ {
+		sm, nseq, err := store.LoadNextMsg(subject, wc, seq, &smv)
+		if err != nil || sm == nil {
+			break
+		}
+		seqs = append(seqs, nseq)
+		seq = nseq
+	}
+	return seqs
+}
+
+// recordRemovedSeqs will add tombstones for those of the sequences that were removed.
+func (mset *stream) recordRemovedSeqs(seqs []uint64) {
+	var smv StoreMsg
+	var first, last uint64
+	for _, seq := range seqs {
+		if _, err := mset.store.LoadMsg(seq, &smv); err == nil {
+			continue
+		}
+		if first > 0 && seq == last+1 {
+			last = seq
+			continue
+		}
+		if first > 0 {
+			mset.recordRemoved(first, last)
+		}
+		first, last = seq, seq
+	}
+	if first > 0 {
+		mset.recordRemoved(first, last)
+	}
+}
+
+// recordRemoved will add a tombstone for removed sequences if we keep them,
+// and drop them from our header index.
+// Does not grab the stream lock since called from store updates.
+func (mset *stream) recordRemoved(first, last uint64) {
+	if mset.tombs != nil {
+		mset.tombs.record(first, last)
+	}
+	mset.hidx.removeRange(first, last)
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// Header required on publishes to a single writer stream, with the fencing token returned
+// to the client that acquired the writer lease. It is not stored with the message.
+const JSWriterFence = "Nats-Writer-Fence"
+
+// Default time the writer of a single writer stream can be idle before another client
+// can acquire the lease without taking over.
+const defaultWriterLease = 30 * time.Second
+
+// streamWriter is the client that holds the writer lease of a single writer stream.
+// Kept on the leader only, so writers need to acquire the lease again after a leader change.
+type streamWriter struct {
+	fence string
+	last  time.Time
+}
+
+// Check the single writer config of a stream.
+func checkStreamSingleWriter(cfg *StreamConfig) error {
+	if cfg.WriterLease < 0 {
+		return errors.New("writer lease can not be negative")
+	}
+	if !cfg.SingleWriter {
+		if cfg.WriterLease > 0 {
+			return errors.New("writer lease requires single writer")
+		}
+		return nil
+	}
+	if cfg.Mirror != nil {
+		return errors.New("single writer not allowed on mirror")
+	}
+	if len(cfg.Sources) > 0 {
+		return errors.New("single writer not allowed with sources")
+	}
+	if cfg.Remote != nil {
+		return errors.New("single writer not allowed with remote")
+	}
+	if cfg.Aggregate != nil {
+		return errors.New("single writer not allowed with aggregate")
+	}
+	return nil
+}
+
+// Set if we only accept publishes from our writer.
+func (mset *stream) setSingleWriter(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&mset.swriter, v)
+}
+
+// Returns true if we only accept publishes from our writer.
+// Does not grab the stream lock since called from the inbound path.
+func (mset *stream) isSingleWriter() bool {
+	return atomic.LoadInt32(&mset.swriter) == 1
+}
+
+// writerLease returns how long our writer can be idle before it can be replaced.
+// Lock should be held.
+func (mset *stream) writerLease() time.Duration {
+	if mset.cfg.WriterLease > 0 {
+		return mset.cfg.WriterLease
+	}
+	return defaultWriterLease
+}
+
+// acquireWriter will give the writer lease to a client and return its fencing token.
+// The writer can acquire again with its fencing token, e.g. after reconnecting, and keeps it.
+// Fails if another client holds the lease and was active within it, unless taking over,
+// which fences off the previous writer.
+func (mset *stream) acquireWriter(fence string, takeover bool) (string, *ApiError) {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+
+	if !mset.cfg.SingleWriter {
+		return _EMPTY_, NewJSStreamNotSingleWriterError()
+	}
+	now := time.Now()
+	if w := mset.writer; w != nil {
+		if fence != _EMPTY_ && subtle.ConstantTimeCompare([]byte(fence), []byte(w.fence)) == 1 {
+			w.last = now
+			return w.fence, nil
+		}
+		if now.Sub(w.last) < mset.writerLease() && !takeover {
+			return _EMPTY_, NewJSStreamWriterActiveError()
+		}
+	}
+	mset.writer = &streamWriter{fence: nuid.Next(), last: now}
+	return mset.writer.fence, nil
+}
+
+// releaseWriter will release the writer lease, if held with the given fencing token.
+func (mset *stream) releaseWriter(fence string) *ApiError {
+	mset.mu.Lock()
+	defer mset.mu.Unlock()
+
+	if !mset.cfg.SingleWriter {
+		return NewJSStreamNotSingleWriterError()
+	}
+	w := mset.writer
+	if w == nil || subtle.ConstantTimeCompare([]byte(fence), []byte(w.fence)) != 1 {
+		return NewJSStreamWriterFencedError()
+	}
+	mset.writer = nil
+	return nil
+}
+
+// checkWriter will check that a publish carries the fencing token of our writer, and mark
+// the writer as active. Returns the headers without the fencing token.
+// Rejected publishes are answered here.
+func (mset *stream) checkWriter(reply string, hdr []byte) ([]byte, error) {
+	if !mset.isSingleWriter() {
+		return hdr, nil
+	}
+	mset.mu.Lock()
+	// Could have changed since we checked.
+	if !mset.cfg.SingleWriter {
+		mset.mu.Unlock()
+		return hdr, nil
+	}
+	fence := getHeader(JSWriterFence, hdr)
+	if w := mset.writer; w != nil && subtle.ConstantTimeCompare(fence, []byte(w.fence)) == 1 {
+		w.last = time.Now()
+		mset.mu.Unlock()
+		return removeHeaderIfPresent(copyBytes(hdr), JSWriterFence), nil
+	}
+	name, noAck, outq := mset.cfg.Name, mset.cfg.NoAck, mset.outq
+	mset.mu.Unlock()
+
+	apiErr := NewJSStreamWriterFencedError()
+	if !noAck && len(reply) > 0 {
+		resp := &JSPubAckResponse{PubAck: &PubAck{Stream: name}, Error: apiErr}
+		b, _ := json.Marshal(resp)
+		outq.sendMsg(reply, b)
+	}
+	return nil, apiErr
+}